@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"gpt-load/internal/handler"
+	"gpt-load/internal/middleware"
+	"gpt-load/internal/proxy"
+	"gpt-load/internal/quota"
+	"gpt-load/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newAdminServer creates the admin HTTP server, which listens on its own port
+// and accepts only the ADMIN_AUTH_KEY token
+func newAdminServer(keyManager types.KeyManager, adminManager types.AdminManager, configManager types.ConfigManager, requests types.RequestCounter, queue types.RequestQueue, handlers *handler.Handler, proxyServer *proxy.ProxyServer, quotaManager *quota.Manager) *http.Server {
+	serverConfig := configManager.GetServerConfig()
+	adminConfig := configManager.GetAdminConfig()
+
+	router := gin.New()
+	router.Use(middleware.Recovery())
+	router.Use(middleware.AdminAuth(adminConfig))
+
+	adminHandler := handler.NewAdminHandler(keyManager, adminManager, configManager, requests, queue)
+	router.GET("/admin/status", adminHandler.Status)
+	router.GET("/admin/config", adminHandler.Config)
+	router.GET("/admin/keys", adminHandler.ListKeys)
+	router.GET("/admin/keys/stats", adminHandler.KeyStats)
+	router.POST("/admin/keys/blacklist", adminHandler.BlacklistKey)
+	router.DELETE("/admin/keys/blacklist/:id", adminHandler.RecoverKey)
+	router.GET("/admin/circuits", adminHandler.Circuits)
+	router.GET("/admin/upstreams", handlers.Upstreams)
+	router.GET("/admin/upstreams/latency", proxyServer.UpstreamLatency)
+	if quotaManager != nil {
+		router.GET("/admin/quotas", quotaManager.UsageHandler)
+	}
+
+	return &http.Server{
+		Addr:           fmt.Sprintf("%s:%d", serverConfig.Host, adminConfig.Port),
+		Handler:        router,
+		ReadTimeout:    time.Duration(serverConfig.ReadTimeout) * time.Second,
+		WriteTimeout:   time.Duration(serverConfig.WriteTimeout) * time.Second,
+		IdleTimeout:    time.Duration(serverConfig.IdleTimeout) * time.Second,
+		MaxHeaderBytes: 1 << 20, // 1MB header limit
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"gpt-load/internal/redact"
+	"gpt-load/pkg/types"
+)
+
+func TestAdminBlacklistRoundTrip(t *testing.T) {
+	servers := startServers(t)
+	upstream, public, admin := servers.upstream, servers.public, servers.admin
+
+	listKeys := func() map[string]types.KeyStatus {
+		t.Helper()
+		resp := send(t, http.MethodGet, admin.URL+"/admin/keys", "admin-secret", "")
+		defer resp.Body.Close()
+		var listing struct {
+			Keys []types.KeyStatus `json:"keys"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&listing); err != nil {
+			t.Fatalf("decode /admin/keys: %v", err)
+		}
+		statuses := make(map[string]types.KeyStatus)
+		for _, key := range listing.Keys {
+			statuses[key.Preview] = key
+		}
+		return statuses
+	}
+	alpha, bravo := redact.MaskKey("sk-alpha-000001"), redact.MaskKey("sk-bravo-000002")
+	bravoID := listKeys()[bravo].ID
+	if alpha == bravo || bravoID == "" {
+		t.Fatalf("keys are not listed apart: %s, %s with id %q", alpha, bravo, bravoID)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		body       string
+		want       int
+		wantStatus map[string]string // Key preview to its status in /admin/keys
+		wantUsed   []string          // Keys the proxy sends upstream afterwards
+	}{
+		{name: "admin rejects client key", method: http.MethodGet, path: "/admin/keys", token: "client-key", want: http.StatusUnauthorized},
+		{name: "admin rejects no key", method: http.MethodGet, path: "/admin/keys", want: http.StatusUnauthorized},
+		{
+			name: "pool starts active", method: http.MethodGet, path: "/admin/keys", token: "admin-secret", want: http.StatusOK,
+			wantStatus: map[string]string{alpha: "active", bravo: "active"}, wantUsed: []string{"sk-alpha-000001", "sk-bravo-000002"},
+		},
+		{name: "unknown prefix", method: http.MethodPost, path: "/admin/keys/blacklist", token: "admin-secret", body: `{"prefix":"sk-charlie"}`, want: http.StatusNotFound},
+		{name: "ambiguous prefix", method: http.MethodPost, path: "/admin/keys/blacklist", token: "admin-secret", body: `{"prefix":"sk-"}`, want: http.StatusConflict},
+		{
+			name: "blacklist by prefix", method: http.MethodPost, path: "/admin/keys/blacklist", token: "admin-secret", body: `{"prefix":"sk-bravo"}`, want: http.StatusOK,
+			wantStatus: map[string]string{alpha: "active", bravo: "blacklisted"}, wantUsed: []string{"sk-alpha-000001"},
+		},
+		{
+			name: "recover by id", method: http.MethodDelete, path: "/admin/keys/blacklist/" + bravoID, token: "admin-secret", want: http.StatusOK,
+			wantStatus: map[string]string{alpha: "active", bravo: "active"}, wantUsed: []string{"sk-alpha-000001", "sk-bravo-000002"},
+		},
+		{name: "recover active key", method: http.MethodDelete, path: "/admin/keys/blacklist/" + bravoID, token: "admin-secret", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := send(t, tt.method, admin.URL+tt.path, tt.token, tt.body)
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+
+			statuses := listKeys()
+			for preview, want := range tt.wantStatus {
+				if got := statuses[preview].Status; got != want {
+					t.Errorf("%s status = %q, want %q", preview, got, want)
+				}
+			}
+			if tt.wantUsed == nil {
+				return
+			}
+			upstream.take()
+			chat(t, public, 4)
+			seen := upstream.take()
+			if len(seen) != len(tt.wantUsed) {
+				t.Errorf("proxy used keys %v, want %v", seen, tt.wantUsed)
+			}
+			for _, key := range tt.wantUsed {
+				if seen[key] == 0 {
+					t.Errorf("proxy never used %s, used %v", key, seen)
+				}
+			}
+		})
+	}
+}
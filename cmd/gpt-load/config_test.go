@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestAdminConfig(t *testing.T) {
+	servers := startServers(t)
+
+	// exportedConfig is the part of the export checked against the running config
+	type exportedConfig struct {
+		Keys struct {
+			APIKeys    []string `json:"apiKeys" yaml:"apiKeys"`
+			MaxRetries int      `json:"maxRetries" yaml:"maxRetries"`
+		} `json:"keys" yaml:"keys"`
+		OpenAI struct {
+			BaseURLs []string `json:"baseUrls" yaml:"baseUrls"`
+		} `json:"openai" yaml:"openai"`
+		Auth struct {
+			Enabled bool     `json:"enabled" yaml:"enabled"`
+			Keys    []string `json:"keys" yaml:"keys"`
+		} `json:"auth" yaml:"auth"`
+		Metrics struct {
+			Enabled bool `json:"enabled" yaml:"enabled"`
+		} `json:"metrics" yaml:"metrics"`
+	}
+
+	tests := []struct {
+		name            string
+		token           string
+		accept          string
+		want            int
+		wantContentType string
+		unmarshal       func([]byte, any) error
+	}{
+		{name: "client key rejected", token: "client-key", want: http.StatusUnauthorized},
+		{name: "JSON by default", token: "admin-secret", want: http.StatusOK, wantContentType: "application/json", unmarshal: json.Unmarshal},
+		{name: "JSON when asked", token: "admin-secret", accept: "application/json", want: http.StatusOK, wantContentType: "application/json", unmarshal: json.Unmarshal},
+		{name: "YAML", token: "admin-secret", accept: "application/yaml", want: http.StatusOK, wantContentType: "application/yaml", unmarshal: yaml.Unmarshal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, servers.admin.URL+"/admin/config", nil)
+			if err != nil {
+				t.Fatalf("NewRequest: %v", err)
+			}
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("GET /admin/config: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.want {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.want, body)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, tt.wantContentType) {
+				t.Errorf("Content-Type = %q, want %s", contentType, tt.wantContentType)
+			}
+			for _, secret := range []string{"sk-alpha-000001", "sk-bravo-000002", "client-key", "admin-secret"} {
+				if strings.Contains(string(body), secret) {
+					t.Errorf("export contains %q", secret)
+				}
+			}
+
+			var exported exportedConfig
+			if err := tt.unmarshal(body, &exported); err != nil {
+				t.Fatalf("parse export: %v\n%s", err, body)
+			}
+			if want := []string{"sk-****0001", "sk-****0002"}; !slices.Equal(exported.Keys.APIKeys, want) {
+				t.Errorf("API keys = %v, want %v", exported.Keys.APIKeys, want)
+			}
+			if want := []string{"[REDACTED]"}; !slices.Equal(exported.Auth.Keys, want) {
+				t.Errorf("auth keys = %v, want %v", exported.Auth.Keys, want)
+			}
+			if !slices.Equal(exported.OpenAI.BaseURLs, []string{servers.upstreamURL}) {
+				t.Errorf("upstreams = %v, want %s", exported.OpenAI.BaseURLs, servers.upstreamURL)
+			}
+			if exported.Keys.MaxRetries != 3 || !exported.Auth.Enabled || !exported.Metrics.Enabled {
+				t.Errorf("exported %+v, want MAX_RETRIES 3 with auth and metrics enabled", exported)
+			}
+		})
+	}
+}
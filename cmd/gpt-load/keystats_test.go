@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"gpt-load/internal/redact"
+	"gpt-load/pkg/types"
+)
+
+// keyStats fetches /admin/keys/stats, keyed by key preview
+func keyStats(t *testing.T, servers *testServers) map[string]types.KeyUsage {
+	t.Helper()
+	resp := send(t, http.MethodGet, servers.admin.URL+"/admin/keys/stats", "admin-secret", "")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("/admin/keys/stats status = %d", resp.StatusCode)
+	}
+	var entries []types.KeyUsage
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		t.Fatalf("decode /admin/keys/stats: %v", err)
+	}
+	stats := make(map[string]types.KeyUsage)
+	for _, entry := range entries {
+		stats[entry.Preview] = entry
+	}
+	return stats
+}
+
+func TestKeyStatsEndpoint(t *testing.T) {
+	servers := startServers(t)
+	keys := []string{"sk-alpha-000001", "sk-bravo-000002"}
+	// Failures blacklist the key at the default threshold
+	t.Cleanup(servers.keyManager.ResetBlacklist)
+
+	for _, token := range []string{"", "client-key"} {
+		resp := send(t, http.MethodGet, servers.admin.URL+"/admin/keys/stats", token, "")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("stats with token %q = %d, want 401", token, resp.StatusCode)
+		}
+	}
+
+	tests := []struct {
+		name string
+		// act drives the pool and returns the change it expects per key
+		act func(t *testing.T) map[string]types.KeyUsage
+	}{
+		{
+			name: "successes through the proxy",
+			act: func(t *testing.T) map[string]types.KeyUsage {
+				servers.upstream.take()
+				chat(t, servers.public, 4)
+				want := make(map[string]types.KeyUsage)
+				for key, n := range servers.upstream.take() {
+					want[key] = types.KeyUsage{Requests: int64(n), Successes: int64(n)}
+				}
+				return want
+			},
+		},
+		{
+			name: "failure blacklisting a key",
+			act: func(t *testing.T) map[string]types.KeyUsage {
+				servers.keyManager.RecordFailure("sk-bravo-000002", errors.New("upstream returned 500"))
+				return map[string]types.KeyUsage{"sk-bravo-000002": {Requests: 1, Errors: 1, Blacklists: 1}}
+			},
+		},
+		{
+			name: "successes after the recovery",
+			act: func(t *testing.T) map[string]types.KeyUsage {
+				servers.keyManager.ResetBlacklist()
+				servers.keyManager.RecordSuccess("sk-alpha-000001")
+				servers.keyManager.RecordSuccess("sk-bravo-000002")
+				return map[string]types.KeyUsage{
+					"sk-alpha-000001": {Requests: 1, Successes: 1},
+					"sk-bravo-000002": {Requests: 1, Successes: 1},
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := keyStats(t, servers)
+			want := tt.act(t)
+			after := keyStats(t, servers)
+
+			for _, key := range keys {
+				preview := redact.MaskKey(key)
+				got := types.KeyUsage{
+					Requests:   after[preview].Requests - before[preview].Requests,
+					Successes:  after[preview].Successes - before[preview].Successes,
+					Errors:     after[preview].Errors - before[preview].Errors,
+					Blacklists: after[preview].Blacklists - before[preview].Blacklists,
+				}
+				if got != want[key] {
+					t.Errorf("%s changed by %+v, want %+v", key, got, want[key])
+				}
+				if want[key].Requests > 0 && after[preview].LastUsed == nil {
+					t.Errorf("%s has no last use after a request", key)
+				}
+			}
+		})
+	}
+
+	// Keys used through the proxy have upstream latency, and the metrics show the same counts
+	stats := keyStats(t, servers)
+	samples := scrape(t, servers)
+	for _, key := range keys {
+		stat := stats[redact.MaskKey(key)]
+		if stat.AvgLatencyMs <= 0 {
+			t.Errorf("%s average latency = %vms, want above 0", key, stat.AvgLatencyMs)
+		}
+		for name, want := range map[string]int64{
+			"gptload_key_requests":   stat.Requests,
+			"gptload_key_successes":  stat.Successes,
+			"gptload_key_errors":     stat.Errors,
+			"gptload_key_blacklists": stat.Blacklists,
+		} {
+			sample := name + `{key_id="` + stat.ID + `"}`
+			if got, ok := samples[sample]; !ok || got != float64(want) {
+				t.Errorf("%s = %v (exposed %t), want %d", sample, got, ok, want)
+			}
+		}
+	}
+}
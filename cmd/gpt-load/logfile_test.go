@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"gpt-load/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// logSequence matches the sequence number of a test log line
+var logSequence = regexp.MustCompile(`line=(\d+)`)
+
+// readLogSequences returns the sequence numbers logged in each log file of dir, current file last
+func readLogSequences(t *testing.T, dir string) [][]int {
+	t.Helper()
+	backups, err := filepath.Glob(filepath.Join(dir, "gpt-load-*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(backups) // Backup names carry their rotation time
+	var files [][]int
+	for _, path := range append(backups, filepath.Join(dir, "gpt-load.log")) {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sequences []int
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if match := logSequence.FindStringSubmatch(scanner.Text()); match != nil {
+				n, _ := strconv.Atoi(match[1])
+				sequences = append(sequences, n)
+			}
+		}
+		file.Close()
+		files = append(files, sequences)
+	}
+	return files
+}
+
+// backupCount returns the number of rotated log files in dir
+func backupCount(t *testing.T, dir string) int {
+	t.Helper()
+	backups, err := filepath.Glob(filepath.Join(dir, "gpt-load-*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(backups)
+}
+
+func TestLogFileRotation(t *testing.T) {
+	dir := t.TempDir()
+	for key, value := range map[string]string{
+		"API_KEYS":                  "sk-logfile-000001",
+		"OPENAI_BASE_URL":           "https://api.example",
+		"LOG_ENABLE_FILE":           "true",
+		"LOG_FILE_PATH":             filepath.Join(dir, "gpt-load.log"),
+		"LOG_FILE_MAX_SIZE_MB":      "1",
+		"LOG_FILE_ROTATE_ON_SIGHUP": "true",
+	} {
+		t.Setenv(key, value)
+	}
+	configManager, err := config.NewManager()
+	if err != nil {
+		t.Fatalf("config.NewManager: %v", err)
+	}
+
+	standard := logrus.StandardLogger()
+	previousOut, previousFormatter, previousLevel := standard.Out, standard.Formatter, standard.GetLevel()
+	logFile := setupLogger(configManager)
+	t.Cleanup(func() {
+		logrus.SetOutput(previousOut)
+		logrus.SetFormatter(previousFormatter)
+		logrus.SetLevel(previousLevel)
+		logFile.Close()
+	})
+	if logFile == nil {
+		t.Fatal("setupLogger returned no log file with LOG_ENABLE_FILE set")
+	}
+	// Only the file, the rotation under test is configured by setupLogger
+	logrus.SetOutput(logFile)
+
+	signals := make(chan os.Signal)
+	defer close(signals)
+	go handleReloadSignals(signals, configManager, nil, logFile)
+
+	// Each step logs lines with increasing sequence numbers, then checks how many
+	// files exist and that every line is in exactly one of them, in order
+	next := 0
+	logLines := func(n int) {
+		for i := 0; i < n; i++ {
+			logrus.Infof("rotation test padding the line to a realistic length line=%d", next)
+			next++
+		}
+	}
+	tests := []struct {
+		name      string
+		run       func()
+		wantFiles int
+	}{
+		{name: "below the size limit", run: func() { logLines(100) }, wantFiles: 1},
+		{name: "size limit reached", run: func() { logLines(15000) }, wantFiles: 2},
+		{
+			name: "rotated on SIGHUP",
+			run: func() {
+				logLines(10)
+				signals <- syscall.SIGHUP
+				// The new file is created with the rename, so later lines land in it
+				deadline := time.Now().Add(2 * time.Second)
+				for backupCount(t, dir) < 2 && time.Now().Before(deadline) {
+					time.Sleep(5 * time.Millisecond)
+				}
+				logLines(10)
+			},
+			wantFiles: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run()
+			files := readLogSequences(t, dir)
+			if len(files) != tt.wantFiles {
+				t.Fatalf("%d log files, want %d", len(files), tt.wantFiles)
+			}
+			want := 0
+			for i, sequences := range files {
+				if len(sequences) == 0 {
+					t.Errorf("log file %d is empty", i)
+				}
+				for _, n := range sequences {
+					if n != want {
+						t.Fatalf("log file %d has line %d where line %d was expected", i, n, want)
+					}
+					want++
+				}
+			}
+			if want != next {
+				t.Errorf("found %d of %d logged lines", want, next)
+			}
+		})
+	}
+}
@@ -3,8 +3,10 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -12,18 +14,31 @@ import (
 	"syscall"
 	"time"
 
+	"gpt-load/internal/auth"
 	"gpt-load/internal/config"
 	"gpt-load/internal/handler"
 	"gpt-load/internal/keymanager"
 	"gpt-load/internal/middleware"
 	"gpt-load/internal/proxy"
+	"gpt-load/internal/quota"
+	"gpt-load/internal/ratelimit"
+	"gpt-load/internal/redact"
+	"gpt-load/internal/tlscert"
+	"gpt-load/internal/tracing"
 	"gpt-load/pkg/types"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 func main() {
+	configStdin := flag.Bool("config-stdin", false, "read the configuration as JSON from stdin, same as CONFIG_FROM_STDIN=true")
+	flag.Parse()
+	if *configStdin {
+		os.Setenv("CONFIG_FROM_STDIN", "true")
+	}
+
 	// Load configuration
 	configManager, err := config.NewManager()
 	if err != nil {
@@ -31,18 +46,49 @@ func main() {
 	}
 
 	// Setup logger
-	setupLogger(configManager)
+	logFile := setupLogger(configManager)
+	if logFile != nil {
+		defer logFile.Close()
+	}
 
 	// Display startup information
 	displayStartupInfo(configManager)
 
+	// Create background task scheduler
+	scheduler := configManager.GetScheduler()
+
 	// Create key manager
-	keyManager, err := keymanager.NewManager(configManager.GetKeysConfig())
+	keyManager, err := keymanager.NewManager(configManager.GetKeysConfig(), scheduler)
 	if err != nil {
 		logrus.Fatalf("Failed to create key manager: %v", err)
 	}
 	defer keyManager.Close()
 
+	// Create JWT verifier when a JWKS endpoint is configured
+	var tokenVerifier types.TokenVerifier
+	if authConfig := configManager.GetAuthConfig(); authConfig.JWKSURL != "" {
+		jwksManager, err := auth.NewManager(authConfig, scheduler)
+		if err != nil {
+			logrus.Fatalf("Failed to initialize JWKS: %v", err)
+		}
+		tokenVerifier = jwksManager
+	}
+
+	// Export traces when enabled, flushed during shutdown
+	if perfConfig := configManager.GetPerformanceConfig(); perfConfig.OTELEnabled {
+		shutdownTracing, err := tracing.Init(perfConfig)
+		if err != nil {
+			logrus.Fatalf("Failed to initialize tracing: %v", err)
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdownTracing(ctx); err != nil {
+				logrus.Errorf("Failed to flush traces: %v", err)
+			}
+		}()
+	}
+
 	// Create proxy server
 	proxyServer, err := proxy.NewProxyServer(keyManager, configManager)
 	if err != nil {
@@ -50,11 +96,49 @@ func main() {
 	}
 	defer proxyServer.Close()
 
+	// Probe keys to find working ones before serving traffic
+	if configManager.GetKeysConfig().KeyProbeOnStartup {
+		keyManager.ProbeKeys(proxyServer.ProbeKey)
+	}
+
+	// Verify blacklisted keys before they are recovered
+	if keysConfig := configManager.GetKeysConfig(); keysConfig.BlacklistProbeEnabled && keysConfig.BlacklistRecoverySeconds > 0 {
+		keyManager.EnableRecoveryProbe(proxyServer.ProbeKey)
+	}
+
 	// Create handlers
 	handlers := handler.NewHandler(keyManager, configManager)
 
+	// Hold back external traffic until the self-test has passed
+	var startupGate *middleware.StartupGate
+	if configManager.GetServerConfig().SelfTestOnStartup {
+		startupGate = middleware.NewStartupGate()
+	}
+
+	// Throttle each client separately when enabled
+	var clientLimiter types.ClientRateLimiter
+	if rateLimitConfig := configManager.GetRateLimitConfig(); rateLimitConfig.Enabled {
+		limiter, err := ratelimit.NewLimiter(rateLimitConfig, scheduler)
+		if err != nil {
+			logrus.Fatalf("Failed to create rate limiter: %v", err)
+		}
+		clientLimiter = limiter
+	}
+
+	// Count requests for the admin status endpoint
+	requestStats := middleware.NewRequestStats()
+
+	// Cap concurrent requests, queueing the overflow when MAX_QUEUE_SIZE is set
+	concurrencyLimiter := middleware.NewConcurrencyLimiter(configManager.GetPerformanceConfig())
+
+	// Track caller quotas, usage is served by the admin server
+	var quotaManager *quota.Manager
+	if quotaConfig := configManager.GetQuotaConfig(); quotaConfig.Enabled {
+		quotaManager = quota.NewManager(quotaConfig)
+	}
+
 	// Setup routes
-	router := setupRoutes(handlers, proxyServer, configManager)
+	router := setupRoutes(handlers, proxyServer, configManager, tokenVerifier, startupGate, clientLimiter, requestStats, concurrencyLimiter, quotaManager)
 
 	// Create HTTP server with optimized timeout configuration
 	serverConfig := configManager.GetServerConfig()
@@ -67,41 +151,143 @@ func main() {
 		MaxHeaderBytes: 1 << 20, // 1MB header limit
 	}
 
+	// Serve HTTPS when a certificate is configured
+	scheme := "http"
+	if serverConfig.TLSEnabled {
+		tlsConfig, err := tlscert.NewConfig(serverConfig, scheduler)
+		if err != nil {
+			logrus.Fatalf("Failed to configure TLS: %v", err)
+		}
+		server.TLSConfig = tlsConfig
+		scheme = "https"
+	}
+
+	// Start background tasks
+	scheduler.Start(context.Background())
+	defer scheduler.Stop()
+
+	// Listen before serving so the self-test can reach the server
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		logrus.Fatalf("Server startup failed: %v", err)
+	}
+
 	// Start server
 	go func() {
 		logrus.Info("GPT-Load proxy server started successfully")
-		logrus.Infof("Server address: http://%s:%d", serverConfig.Host, serverConfig.Port)
-		logrus.Infof("Statistics: http://%s:%d/stats", serverConfig.Host, serverConfig.Port)
-		logrus.Infof("Health check: http://%s:%d/health", serverConfig.Host, serverConfig.Port)
-		logrus.Infof("Reset keys: http://%s:%d/reset-keys", serverConfig.Host, serverConfig.Port)
-		logrus.Infof("Blacklist query: http://%s:%d/blacklist", serverConfig.Host, serverConfig.Port)
+		logrus.Infof("Server address: %s://%s:%d", scheme, serverConfig.Host, serverConfig.Port)
+		logrus.Infof("Statistics: %s://%s:%d/stats", scheme, serverConfig.Host, serverConfig.Port)
+		logrus.Infof("Health check: %s://%s:%d%s", scheme, serverConfig.Host, serverConfig.Port, serverConfig.HealthPath)
+		logrus.Infof("Readiness check: %s://%s:%d%s", scheme, serverConfig.Host, serverConfig.Port, serverConfig.ReadyPath)
+		logrus.Infof("Reset keys: %s://%s:%d/reset-keys", scheme, serverConfig.Host, serverConfig.Port)
+		logrus.Infof("Blacklist query: %s://%s:%d/blacklist", scheme, serverConfig.Host, serverConfig.Port)
 		logrus.Info("")
 
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		// The certificate comes from TLSConfig.GetCertificate, so no files are passed
+		serve := server.Serve
+		if server.TLSConfig != nil {
+			serve = func(l net.Listener) error { return server.ServeTLS(l, "", "") }
+		}
+		if err := serve(listener); err != nil && err != http.ErrServerClosed {
 			logrus.Fatalf("Server startup failed: %v", err)
 		}
 	}()
 
+	// Start the admin server on its own port
+	var adminServer *http.Server
+	if adminConfig := configManager.GetAdminConfig(); adminConfig.Enabled {
+		adminManager, ok := keyManager.(types.AdminManager)
+		if !ok {
+			logrus.Fatal("Key manager does not support the admin API")
+		}
+		adminServer = newAdminServer(keyManager, adminManager, configManager, requestStats, concurrencyLimiter, handlers, proxyServer, quotaManager)
+		go func() {
+			logrus.Infof("Admin server: http://%s:%d/admin/keys", serverConfig.Host, adminConfig.Port)
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logrus.Fatalf("Admin server startup failed: %v", err)
+			}
+		}()
+	}
+
+	// Start the metrics server on its own port
+	var metricsServer *http.Server
+	if metricsConfig := configManager.GetMetricsConfig(); metricsConfig.Enabled {
+		metricsServer = newMetricsServer(serverConfig, metricsConfig)
+		go func() {
+			logrus.Infof("Metrics: http://%s:%d/metrics", serverConfig.Host, metricsConfig.Port)
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logrus.Fatalf("Metrics server startup failed: %v", err)
+			}
+		}()
+	}
+
+	// Run the end-to-end self-test before accepting external traffic
+	if startupGate != nil {
+		if err := runSelfTest(listener, serverConfig, configManager.GetAuthConfig()); err != nil {
+			if serverConfig.SelfTestFailFast {
+				logrus.Fatalf("Startup self-test failed: %v", err)
+			}
+			logrus.Errorf("Startup self-test failed: %v", err)
+		}
+		startupGate.Open()
+	}
+
+	// Reload configurable state on SIGHUP
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
+	go handleReloadSignals(reload, configManager, keyManager, logFile)
+
 	// Wait for interrupt signal to gracefully shutdown the server
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	logrus.Info("Shutting down server...")
 
-	// Give outstanding requests a deadline for completion
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(serverConfig.GracefulShutdownTimeout)*time.Second)
+	shutdownServers(serverConfig, requestStats, server, adminServer, metricsServer)
+}
+
+// shutdownServers drains in-flight requests and closes the servers. Streams may
+// run up to WRITE_TIMEOUT, whatever is still running after the deadline is dropped.
+// The admin and metrics servers are nil when disabled.
+func shutdownServers(serverConfig types.ServerConfig, requestStats *middleware.RequestStats, server, adminServer, metricsServer *http.Server) error {
+	// Give outstanding requests a deadline for completion, streams may run up to WRITE_TIMEOUT
+	drainTimeout := time.Duration(serverConfig.GracefulShutdownTimeout) * time.Second
+	if streams := requestStats.Streaming(); streams > 0 {
+		drainTimeout = max(drainTimeout, time.Duration(serverConfig.WriteTimeout)*time.Second)
+		logrus.Infof("Waiting up to %v for %d streaming responses to complete", drainTimeout, streams)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
 	defer cancel()
 
 	// Attempt graceful shutdown
-	if err := server.Shutdown(ctx); err != nil {
-		logrus.Errorf("Server forced to shutdown: %v", err)
-	} else {
-		logrus.Info("Server exited gracefully")
+	if adminServer != nil {
+		if err := adminServer.Shutdown(ctx); err != nil {
+			logrus.Errorf("Admin server forced to shutdown: %v", err)
+		}
+	}
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(ctx); err != nil {
+			logrus.Errorf("Metrics server forced to shutdown: %v", err)
+		}
+	}
+	// Shutdown waits for open connections, the request counter also covers
+	// hijacked ones such as WebSocket tunnels
+	err := server.Shutdown(ctx)
+	if err == nil {
+		err = requestStats.Wait(ctx)
 	}
+	if err != nil {
+		logrus.Errorf("Server forced to shutdown: %v, dropping %d in-flight requests", err, requestStats.Counts().InFlight)
+		server.Close()
+		return err
+	}
+	logrus.Info("Server exited gracefully")
+	return nil
 }
 
 // setupRoutes configures the HTTP routes
-func setupRoutes(handlers *handler.Handler, proxyServer *proxy.ProxyServer, configManager types.ConfigManager) *gin.Engine {
+func setupRoutes(handlers *handler.Handler, proxyServer *proxy.ProxyServer, configManager types.ConfigManager, tokenVerifier types.TokenVerifier, startupGate *middleware.StartupGate, clientLimiter types.ClientRateLimiter, requestStats *middleware.RequestStats, concurrencyLimiter *middleware.ConcurrencyLimiter, quotaManager *quota.Manager) *gin.Engine {
 	// Set Gin mode
 	gin.SetMode(gin.ReleaseMode)
 
@@ -115,19 +301,55 @@ func setupRoutes(handlers *handler.Handler, proxyServer *proxy.ProxyServer, conf
 	})
 
 	// Add middleware
+	router.Use(requestStats.Handler())
 	router.Use(middleware.Recovery())
 	router.Use(middleware.ErrorHandler())
+
+	// Liveness answers even while the server is starting
+	serverConfig := configManager.GetServerConfig()
+	router.GET(serverConfig.HealthPath, handlers.Health)
+
+	if startupGate != nil {
+		router.Use(startupGate.Handler())
+	}
+	router.Use(middleware.RequestID(configManager.GetLogConfig().RequestIDHeader, configManager.GenerateRequestID))
+	if configManager.GetPerformanceConfig().OTELEnabled {
+		router.Use(tracing.Middleware())
+	}
+	router.Use(middleware.ContextLogger(configManager.GetLogConfig()))
 	router.Use(middleware.Logger(configManager.GetLogConfig()))
-	router.Use(middleware.CORS(configManager.GetCORSConfig()))
-	router.Use(middleware.RateLimiter(configManager.GetPerformanceConfig()))
+	if configManager.GetLogConfig().AuditLogEnabled {
+		router.Use(middleware.Audit(configManager.GetLogConfig()))
+	}
+	router.Use(middleware.CORS(configManager.GetCORSConfig))
+	if perfConfig := configManager.GetPerformanceConfig(); perfConfig.EnableGzip || perfConfig.EnableBrotli {
+		router.Use(middleware.Compression(perfConfig))
+	}
+
+	// Routes only get the middleware added before them, so readiness probes skip
+	// the IP filter, rate and concurrency limits, and authentication
+	router.GET(serverConfig.ReadyPath, handlers.Ready)
+
+	if maxBodyBytes := configManager.GetPerformanceConfig().MaxRequestBodyBytes; maxBodyBytes > 0 {
+		router.Use(middleware.RequestBodyLimit(int64(maxBodyBytes)))
+	}
+	if authConfig := configManager.GetAuthConfig(); len(authConfig.IPAllowlist) > 0 || len(authConfig.IPBlocklist) > 0 {
+		router.Use(middleware.IPFilter(authConfig))
+	}
+	if clientLimiter != nil {
+		router.Use(middleware.ClientRateLimit(clientLimiter, configManager.GetRateLimitConfig().LimitByHeader))
+	}
+	router.Use(concurrencyLimiter.Handler())
+
+	// Authentication checks the current config on each request, keys may be added by a reload
+	router.Use(middleware.Auth(configManager.GetAuthConfig, configManager.GetAdminConfig().AuthKey, tokenVerifier))
 
-	// Add authentication middleware if enabled
-	if configManager.GetAuthConfig().Enabled {
-		router.Use(middleware.Auth(configManager.GetAuthConfig()))
+	// Enforce caller quotas after authentication has identified the caller
+	if quotaManager != nil {
+		router.Use(middleware.Quota(quotaManager))
 	}
 
 	// Management endpoints
-	router.GET("/health", handlers.Health)
 	router.GET("/stats", handlers.Stats)
 	router.GET("/blacklist", handlers.Blacklist)
 	router.GET("/reset-keys", handlers.ResetKeys)
@@ -142,8 +364,8 @@ func setupRoutes(handlers *handler.Handler, proxyServer *proxy.ProxyServer, conf
 	return router
 }
 
-// setupLogger configures the logging system
-func setupLogger(configManager types.ConfigManager) {
+// setupLogger configures the logging system, returning the rotating log file if file logging is enabled
+func setupLogger(configManager types.ConfigManager) *lumberjack.Logger {
 	logConfig := configManager.GetLogConfig()
 
 	// Set log level
@@ -154,6 +376,9 @@ func setupLogger(configManager types.ConfigManager) {
 	}
 	logrus.SetLevel(level)
 
+	// Must be set before keys are loaded, their previews are masked once
+	redact.SetKeyMasking(logConfig.MaskKeys)
+
 	// Set log format
 	if logConfig.Format == "json" {
 		logrus.SetFormatter(&logrus.JSONFormatter{
@@ -174,61 +399,23 @@ func setupLogger(configManager types.ConfigManager) {
 		if err := os.MkdirAll(logDir, 0755); err != nil {
 			logrus.Warnf("Failed to create log directory: %v", err)
 		} else {
-			// Open log file
-			logFile, err := os.OpenFile(logConfig.FilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-			if err != nil {
-				logrus.Warnf("Failed to open log file: %v", err)
-			} else {
-				// Use both file and stdout
-				logrus.SetOutput(io.MultiWriter(os.Stdout, logFile))
+			// Rotation renames the file under the writer's lock, so no lines are lost
+			logFile := &lumberjack.Logger{
+				Filename:   logConfig.FilePath,
+				MaxSize:    logConfig.FileMaxSizeMB,
+				MaxBackups: logConfig.FileMaxBackups,
+				MaxAge:     logConfig.FileMaxAgeDays,
+				Compress:   logConfig.FileCompress,
 			}
+			// Use both file and stdout
+			logrus.SetOutput(io.MultiWriter(os.Stdout, logFile))
+			return logFile
 		}
 	}
+	return nil
 }
 
 // displayStartupInfo shows startup information
 func displayStartupInfo(configManager types.ConfigManager) {
-	serverConfig := configManager.GetServerConfig()
-	keysConfig := configManager.GetKeysConfig()
-	openaiConfig := configManager.GetOpenAIConfig()
-	authConfig := configManager.GetAuthConfig()
-	corsConfig := configManager.GetCORSConfig()
-	perfConfig := configManager.GetPerformanceConfig()
-	logConfig := configManager.GetLogConfig()
-
-	logrus.Info("Current Configuration:")
-	logrus.Infof("   Server: %s:%d", serverConfig.Host, serverConfig.Port)
-	logrus.Infof("   Keys file: %s", keysConfig.FilePath)
-	logrus.Infof("   Start index: %d", keysConfig.StartIndex)
-	logrus.Infof("   Blacklist threshold: %d errors", keysConfig.BlacklistThreshold)
-	logrus.Infof("   Max retries: %d", keysConfig.MaxRetries)
-	logrus.Infof("   Upstream URL: %s", openaiConfig.BaseURL)
-	logrus.Infof("   Request timeout: %ds", openaiConfig.RequestTimeout)
-	logrus.Infof("   Response timeout: %ds", openaiConfig.ResponseTimeout)
-	logrus.Infof("   Idle connection timeout: %ds", openaiConfig.IdleConnTimeout)
-
-	authStatus := "disabled"
-	if authConfig.Enabled {
-		authStatus = "enabled"
-	}
-	logrus.Infof("   Authentication: %s", authStatus)
-
-	corsStatus := "disabled"
-	if corsConfig.Enabled {
-		corsStatus = "enabled"
-	}
-	logrus.Infof("   CORS: %s", corsStatus)
-	logrus.Infof("   Max concurrent requests: %d", perfConfig.MaxConcurrentRequests)
-
-	gzipStatus := "disabled"
-	if perfConfig.EnableGzip {
-		gzipStatus = "enabled"
-	}
-	logrus.Infof("   Gzip compression: %s", gzipStatus)
-
-	requestLogStatus := "enabled"
-	if !logConfig.EnableRequest {
-		requestLogStatus = "disabled"
-	}
-	logrus.Infof("   Request logging: %s", requestLogStatus)
+	configManager.DisplayConfig()
 }
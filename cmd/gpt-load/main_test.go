@@ -0,0 +1,159 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"gpt-load/internal/config"
+	"gpt-load/internal/handler"
+	"gpt-load/internal/keymanager"
+	"gpt-load/internal/middleware"
+	"gpt-load/internal/proxy"
+	"gpt-load/pkg/types"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+// keyRecorder is an upstream that answers every request and remembers the keys it saw
+type keyRecorder struct {
+	mu   sync.Mutex
+	seen map[string]int
+}
+
+func (u *keyRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u.mu.Lock()
+	u.seen[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]++
+	u.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"choices":[]}`))
+}
+
+// take returns the keys seen since the last call
+func (u *keyRecorder) take() map[string]int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	seen := u.seen
+	u.seen = make(map[string]int)
+	return seen
+}
+
+// testServers are the servers main starts, wired to one key manager in front of a recording upstream
+type testServers struct {
+	upstream    *keyRecorder
+	upstreamURL string
+	keyManager  types.KeyManager
+	limiter     *middleware.ConcurrencyLimiter // Registers its metrics, so routes built by tests share it
+	public      *httptest.Server
+	admin       *httptest.Server
+	metrics     *httptest.Server
+	startupLog  *test.Hook // Everything logged while the servers were built
+}
+
+var (
+	servers     *testServers
+	serversOnce sync.Once
+)
+
+// startServers builds the servers the first time it is called and returns the
+// same ones afterwards. The key manager registers its metrics, so the binary can
+// build it only once. The pool holds sk-alpha-000001 and sk-bravo-000002, clients
+// authenticate with client-key and the admin server with admin-secret. The
+// servers live until the binary exits, tests must leave the pool as they found it.
+func startServers(t *testing.T) *testServers {
+	t.Helper()
+	serversOnce.Do(func() {
+		upstream := &keyRecorder{seen: make(map[string]int)}
+		upstreamServer := httptest.NewServer(upstream)
+
+		env := map[string]string{
+			"OPENAI_BASE_URL": upstreamServer.URL,
+			"API_KEYS":        "sk-alpha-000001,sk-bravo-000002",
+			"AUTH_KEYS":       "client-key",
+			"ADMIN_AUTH_KEY":  "admin-secret",
+			"METRICS_ENABLED": "true",
+		}
+		for key, value := range env {
+			os.Setenv(key, value)
+		}
+
+		// Record the startup logs at every level
+		startupLog := &test.Hook{}
+		previousHooks := logrus.StandardLogger().ReplaceHooks(logrus.LevelHooks{})
+		logrus.AddHook(startupLog)
+		previousLevel := logrus.GetLevel()
+		logrus.SetLevel(logrus.DebugLevel)
+		defer func() {
+			logrus.SetLevel(previousLevel)
+			logrus.StandardLogger().ReplaceHooks(previousHooks)
+		}()
+
+		configManager, err := config.NewManager()
+		if err != nil {
+			t.Fatalf("config.NewManager: %v", err)
+		}
+		configManager.DisplayConfig()
+		keyManager, err := keymanager.NewManager(configManager.GetKeysConfig(), configManager.GetScheduler())
+		if err != nil {
+			t.Fatalf("keymanager.NewManager: %v", err)
+		}
+		proxyServer, err := proxy.NewProxyServer(keyManager, configManager)
+		if err != nil {
+			t.Fatalf("NewProxyServer: %v", err)
+		}
+
+		handlers := handler.NewHandler(keyManager, configManager)
+		requestStats := middleware.NewRequestStats()
+		concurrencyLimiter := middleware.NewConcurrencyLimiter(configManager.GetPerformanceConfig())
+		adminServer := newAdminServer(keyManager, keyManager.(types.AdminManager), configManager, requestStats, concurrencyLimiter, handlers, proxyServer, nil)
+		metricsServer := newMetricsServer(configManager.GetServerConfig(), configManager.GetMetricsConfig())
+		servers = &testServers{
+			upstream:    upstream,
+			upstreamURL: upstreamServer.URL,
+			keyManager:  keyManager,
+			limiter:     concurrencyLimiter,
+			public:      httptest.NewServer(setupRoutes(handlers, proxyServer, configManager, nil, nil, nil, requestStats, concurrencyLimiter, nil)),
+			admin:       httptest.NewServer(adminServer.Handler),
+			metrics:     httptest.NewServer(metricsServer.Handler),
+			startupLog:  startupLog,
+		}
+	})
+	if servers == nil {
+		t.Fatal("servers failed to start")
+	}
+	return servers
+}
+
+// send makes a request authenticated with token and returns the response, the caller closes its body
+func send(t *testing.T, method, url, token, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	return resp
+}
+
+// chat sends n chat completions through the public server, failing unless each succeeds
+func chat(t *testing.T, public *httptest.Server, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		resp := send(t, http.MethodPost, public.URL+"/v1/chat/completions", "client-key", `{"model":"gpt-4o","messages":[]}`)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("proxy status = %d, want 200", resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"gpt-load/internal/redact"
+	"gpt-load/pkg/types"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+// fixtureSecrets are the full keys the test servers are configured with
+var fixtureSecrets = []string{"sk-alpha-000001", "sk-bravo-000002", "client-key", "admin-secret"}
+
+// checkNoSecrets fails if any log entry mentions a full secret, in its message or a field
+func checkNoSecrets(t *testing.T, entries []*logrus.Entry) {
+	t.Helper()
+	for _, entry := range entries {
+		line := entry.Message
+		for field, value := range entry.Data {
+			line += fmt.Sprintf(" %s=%v", field, value)
+		}
+		for _, secret := range fixtureSecrets {
+			if strings.Contains(line, secret) {
+				t.Errorf("log line %q contains %s", line, secret)
+			}
+		}
+	}
+}
+
+func TestLogsMaskKeys(t *testing.T) {
+	s := startServers(t)
+	tests := []struct {
+		name string
+		run  func(t *testing.T) []*logrus.Entry
+	}{
+		{
+			name: "startup",
+			run: func(t *testing.T) []*logrus.Entry {
+				entries := s.startupLog.AllEntries()
+				if len(entries) == 0 {
+					t.Fatal("no startup logs recorded")
+				}
+				return entries
+			},
+		},
+		{
+			name: "requests and key administration",
+			run: func(t *testing.T) []*logrus.Entry {
+				hook := &test.Hook{}
+				previousHooks := logrus.StandardLogger().ReplaceHooks(logrus.LevelHooks{})
+				logrus.AddHook(hook)
+				previousLevel := logrus.GetLevel()
+				logrus.SetLevel(logrus.DebugLevel)
+				defer func() {
+					logrus.SetLevel(previousLevel)
+					logrus.StandardLogger().ReplaceHooks(previousHooks)
+				}()
+
+				chat(t, s.public, 4)
+				resp := send(t, http.MethodPost, s.admin.URL+"/admin/keys/blacklist", "admin-secret", `{"prefix":"sk-bravo"}`)
+				resp.Body.Close()
+				resp = send(t, http.MethodGet, s.admin.URL+"/admin/keys", "admin-secret", "")
+				var listing struct {
+					Keys []types.KeyStatus `json:"keys"`
+				}
+				err := json.NewDecoder(resp.Body).Decode(&listing)
+				resp.Body.Close()
+				if err != nil {
+					t.Fatalf("decode /admin/keys: %v", err)
+				}
+				for _, key := range listing.Keys {
+					if key.Preview == redact.MaskKey("sk-bravo-000002") {
+						resp := send(t, http.MethodDelete, s.admin.URL+"/admin/keys/blacklist/"+key.ID, "admin-secret", "")
+						resp.Body.Close()
+						if resp.StatusCode != http.StatusOK {
+							t.Fatalf("recover sk-bravo status = %d, want 200", resp.StatusCode)
+						}
+					}
+				}
+				s.upstream.take()
+				return hook.AllEntries()
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkNoSecrets(t, tt.run(t))
+		})
+	}
+}
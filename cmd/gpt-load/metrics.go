@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"gpt-load/internal/metrics"
+	"gpt-load/pkg/types"
+)
+
+// newMetricsServer creates the HTTP server exposing Prometheus metrics on its
+// own port, keeping them off the proxy port
+func newMetricsServer(serverConfig types.ServerConfig, metricsConfig types.MetricsConfig) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+
+	return &http.Server{
+		Addr:              fmt.Sprintf("%s:%d", serverConfig.Host, metricsConfig.Port),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       time.Duration(serverConfig.IdleTimeout) * time.Second,
+	}
+}
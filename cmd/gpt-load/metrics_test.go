@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gpt-load/internal/redact"
+	"gpt-load/pkg/types"
+)
+
+// scrape fetches the metrics endpoint and returns each sample line's value, keyed
+// by its name and labels as exposed, e.g. gptload_keys_active
+func scrape(t *testing.T, servers *testServers) map[string]float64 {
+	t.Helper()
+	resp := send(t, http.MethodGet, servers.metrics.URL+"/metrics", "", "")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("/metrics status = %d", resp.StatusCode)
+	}
+
+	samples := make(map[string]float64)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		separator := strings.LastIndexByte(line, ' ')
+		value, err := strconv.ParseFloat(line[separator+1:], 64)
+		if err != nil {
+			t.Fatalf("sample %q: %v", line, err)
+		}
+		samples[line[:separator]] = value
+	}
+	return samples
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	servers := startServers(t)
+	requests := `gptload_requests_total{cost_center="",status_code="200",upstream="` + servers.upstreamURL + `"}`
+	durations := `gptload_request_duration_seconds_count{cost_center="",upstream="` + servers.upstreamURL + `"}`
+	bravoID := ""
+	for _, key := range servers.keyManager.(types.AdminManager).ListKeys() {
+		if key.Preview == redact.MaskKey("sk-bravo-000002") {
+			bravoID = key.ID
+		}
+	}
+
+	tests := []struct {
+		name string
+		// act changes the proxy state before the scrape
+		act             func(t *testing.T)
+		wantRequests    float64 // Change of the request counters since the previous step
+		wantActive      float64
+		wantBlacklisted float64
+	}{
+		{name: "idle", act: func(*testing.T) {}, wantActive: 2},
+		{name: "requests counted", act: func(t *testing.T) { chat(t, servers.public, 5) }, wantRequests: 5, wantActive: 2},
+		{
+			name: "blacklisted key",
+			act: func(t *testing.T) {
+				servers.keyManager.(types.AdminManager).ForceBlacklist(bravoID)
+				chat(t, servers.public, 3)
+			},
+			wantRequests: 3, wantActive: 1, wantBlacklisted: 1,
+		},
+		{name: "recovered key", act: func(*testing.T) { servers.keyManager.(types.AdminManager).RecoverKey(bravoID) }, wantActive: 2},
+	}
+	before := scrape(t, servers)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.act(t)
+			after := scrape(t, servers)
+			if got := after[requests] - before[requests]; got != tt.wantRequests {
+				t.Errorf("%s grew by %v, want %v", requests, got, tt.wantRequests)
+			}
+			if got := after[durations] - before[durations]; got != tt.wantRequests {
+				t.Errorf("%s grew by %v, want %v", durations, got, tt.wantRequests)
+			}
+			if got := after["gptload_keys_active"]; got != tt.wantActive {
+				t.Errorf("gptload_keys_active = %v, want %v", got, tt.wantActive)
+			}
+			if got := after["gptload_keys_blacklisted"]; got != tt.wantBlacklisted {
+				t.Errorf("gptload_keys_blacklisted = %v, want %v", got, tt.wantBlacklisted)
+			}
+			before = after
+		})
+	}
+}
+
+func TestMetricsOnlyOnMetricsPort(t *testing.T) {
+	servers := startServers(t)
+	tests := []struct {
+		name   string
+		url    string
+		token  string
+		status int
+	}{
+		{name: "metrics port", url: servers.metrics.URL + "/metrics", status: http.StatusOK},
+		{name: "other path on metrics port", url: servers.metrics.URL + "/stats", status: http.StatusNotFound},
+		// The proxy port forwards unknown paths upstream, which answers with a chat body
+		{name: "proxy port", url: servers.public.URL + "/metrics", token: "client-key", status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := send(t, http.MethodGet, tt.url, tt.token, "")
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if exposed := strings.Contains(string(body), "gptload_requests_total"); exposed != (tt.url == servers.metrics.URL+"/metrics") {
+				t.Errorf("metrics exposed = %v", exposed)
+			}
+		})
+	}
+}
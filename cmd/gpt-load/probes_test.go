@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gpt-load/internal/config"
+	"gpt-load/internal/handler"
+	"gpt-load/internal/middleware"
+	"gpt-load/internal/proxy"
+)
+
+// probe sends an unauthenticated GET and returns the status and body
+func probe(t *testing.T, url string) (int, string) {
+	t.Helper()
+	resp := send(t, http.MethodGet, url, "", "")
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestProbes(t *testing.T) {
+	servers := startServers(t)
+	tests := []struct {
+		name        string
+		blacklist   []string
+		wantReady   int
+		wantReadyJS string
+	}{
+		{name: "keys available", wantReady: http.StatusOK, wantReadyJS: `{"status":"ok"}`},
+		{name: "one key left", blacklist: []string{"sk-alpha-000001"}, wantReady: http.StatusOK, wantReadyJS: `{"status":"ok"}`},
+		{
+			name: "all keys blacklisted", blacklist: []string{"sk-alpha-000001", "sk-bravo-000002"},
+			wantReady: http.StatusServiceUnavailable, wantReadyJS: `{"reason":"no API keys available","status":"degraded"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range tt.blacklist {
+				servers.keyManager.BlacklistKey(key)
+			}
+			// Leave the shared pool as it was
+			defer servers.keyManager.ResetBlacklist()
+
+			if status, body := probe(t, servers.public.URL+"/ready"); status != tt.wantReady || body != tt.wantReadyJS {
+				t.Errorf("/ready = %d %s, want %d %s", status, body, tt.wantReady, tt.wantReadyJS)
+			}
+			// The process is alive whatever the pool looks like
+			if status, body := probe(t, servers.public.URL+"/health"); status != http.StatusOK || body != `{"status":"ok"}` {
+				t.Errorf("/health = %d %s, want 200", status, body)
+			}
+		})
+	}
+}
+
+func TestProbePaths(t *testing.T) {
+	servers := startServers(t)
+	t.Setenv("HEALTH_PATH", "/livez")
+	t.Setenv("READY_PATH", "/readyz")
+	configManager, err := config.NewManager()
+	if err != nil {
+		t.Fatalf("config.NewManager: %v", err)
+	}
+	proxyServer, err := proxy.NewProxyServer(servers.keyManager, configManager)
+	if err != nil {
+		t.Fatalf("NewProxyServer: %v", err)
+	}
+	t.Cleanup(proxyServer.Close)
+	public := httptest.NewServer(setupRoutes(handler.NewHandler(servers.keyManager, configManager), proxyServer, configManager, nil, nil, nil,
+		middleware.NewRequestStats(), servers.limiter, nil))
+	t.Cleanup(public.Close)
+
+	tests := []struct {
+		path       string
+		wantStatus int
+	}{
+		{path: "/livez", wantStatus: http.StatusOK},
+		{path: "/readyz", wantStatus: http.StatusOK},
+		// The default paths are ordinary proxied routes now, behind authentication
+		{path: "/health", wantStatus: http.StatusUnauthorized},
+		{path: "/ready", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if status, body := probe(t, public.URL+tt.path); status != tt.wantStatus {
+				t.Errorf("%s = %d %s, want %d", tt.path, status, body, tt.wantStatus)
+			}
+		})
+	}
+}
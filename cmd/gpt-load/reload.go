@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+
+	"gpt-load/pkg/types"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// handleReloadSignals reloads the configuration and the key file each time a
+// signal arrives, keeping the current settings or key pool if a reload fails.
+// A changed LOG_LEVEL is applied once the configuration is reloaded.
+// The log file is rotated as well when LOG_FILE_ROTATE_ON_SIGHUP is set.
+func handleReloadSignals(signals <-chan os.Signal, configManager types.ConfigManager, keyManager types.KeyManager, logFile *lumberjack.Logger) {
+	for range signals {
+		logrus.Info("Received SIGHUP, reloading")
+
+		if err := configManager.Reload(); err != nil {
+			logrus.Errorf("Failed to reload configuration, keeping current settings: %v", err)
+		} else if level, err := logrus.ParseLevel(configManager.GetLogConfig().Level); err == nil && level != logrus.GetLevel() {
+			logrus.SetLevel(level)
+			logrus.Infof("Log level set to %s", level)
+		}
+
+		if logFile != nil && configManager.GetLogConfig().FileRotateOnSIGHUP {
+			if err := logFile.Rotate(); err != nil {
+				logrus.Errorf("Failed to rotate log file: %v", err)
+			} else {
+				logrus.Info("Rotated log file")
+			}
+		}
+
+		keysConfig := configManager.GetKeysConfig()
+		if keysConfig.KeyFetchURL != "" {
+			logrus.Debug("Keys are refreshed from KEY_FETCH_URL, not reloading the key file")
+			continue
+		}
+		if keysConfig.KeyAWSSecretARN != "" {
+			logrus.Debug("Keys are loaded from KEY_AWS_SECRET_ARN at startup, not reloading the key file")
+			continue
+		}
+		if keysConfig.KeyFilePath == "" {
+			logrus.Debug("KEY_FILE_PATH is not set, no keys to reload")
+			continue
+		}
+		if err := keyManager.ReloadKeys(keysConfig.KeyFilePath); err != nil {
+			logrus.Errorf("Failed to reload keys, keeping current key pool: %v", err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"gpt-load/internal/config"
+	"gpt-load/pkg/types"
+)
+
+// reloadWithSIGHUP applies env, sends SIGHUP to the test process and waits until
+// the reload has swapped the configuration, marked by MAX_RETRIES taking retries.
+// The variables stay set for later steps, the caller restores them with t.Setenv.
+func reloadWithSIGHUP(t *testing.T, configManager types.ConfigManager, env map[string]string, retries int) {
+	t.Helper()
+	for key, value := range env {
+		os.Setenv(key, value)
+	}
+	os.Setenv("MAX_RETRIES", strconv.Itoa(retries))
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatalf("SIGHUP: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for configManager.GetKeysConfig().MaxRetries != retries {
+		if time.Now().After(deadline) {
+			t.Fatal("configuration not reloaded after SIGHUP")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestReloadOnSIGHUP(t *testing.T) {
+	for key, value := range map[string]string{
+		"API_KEYS":              "sk-reload-000001",
+		"OPENAI_BASE_URL":       "https://a.example,https://b.example",
+		"LOAD_BALANCE_STRATEGY": "round_robin",
+		"PORT":                  "7860",
+		"MAX_RETRIES":           "1",
+	} {
+		t.Setenv(key, value)
+	}
+	configManager, err := config.NewManager()
+	if err != nil {
+		t.Fatalf("config.NewManager: %v", err)
+	}
+	configManager.GetOpenAIConfig() // Advance the round-robin counter past the first upstream
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+	go handleReloadSignals(signals, configManager, nil, nil)
+
+	tests := []struct {
+		name      string
+		env       map[string]string
+		wantPicks []string // Upstreams returned by the next GetOpenAIConfig calls
+		wantPort  int
+	}{
+		{
+			name:      "changed upstreams restart the rotation",
+			env:       map[string]string{"OPENAI_BASE_URL": "https://c.example,https://d.example"},
+			wantPicks: []string{"https://c.example", "https://d.example", "https://c.example"},
+			wantPort:  7860,
+		},
+		{
+			name:      "startup setting ignored",
+			env:       map[string]string{"PORT": "9000"},
+			wantPicks: []string{"https://d.example", "https://c.example"},
+			wantPort:  7860,
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reloadWithSIGHUP(t, configManager, tt.env, i+2)
+
+			for j, want := range tt.wantPicks {
+				if got := configManager.GetOpenAIConfig().BaseURL; got != want {
+					t.Errorf("pick %d = %s, want %s", j, got, want)
+				}
+			}
+			if port := configManager.GetServerConfig().Port; port != tt.wantPort {
+				t.Errorf("port = %d, want %d", port, tt.wantPort)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gpt-load/internal/middleware"
+	"gpt-load/pkg/types"
+
+	"github.com/sirupsen/logrus"
+)
+
+// selfTestPayload is the synthetic chat completion sent by the startup self-test
+const selfTestPayload = `{"model":"gpt-3.5-turbo","messages":[{"role":"user","content":"ping"}],"max_tokens":1}`
+
+// runSelfTest sends a chat completion through the full middleware chain over loopback
+func runSelfTest(listener net.Listener, serverConfig types.ServerConfig, authConfig types.AuthConfig) error {
+	port := listener.Addr().(*net.TCPAddr).Port
+	scheme, client := "http", http.DefaultClient
+	if serverConfig.TLSEnabled {
+		// The certificate is issued for the public name, not the loopback address
+		scheme = "https"
+		client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	}
+	target := scheme + "://" + net.JoinHostPort("127.0.0.1", strconv.Itoa(port)) + "/v1/chat/completions"
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(serverConfig.SelfTestTimeoutSeconds)*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader([]byte(selfTestPayload)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(middleware.SelfTestHeader, "true")
+	if len(authConfig.Keys) > 0 {
+		req.Header.Set("Authorization", "Bearer "+authConfig.Keys[0])
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	logrus.Infof("Startup self-test passed (HTTP %d)", resp.StatusCode)
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"gpt-load/internal/middleware"
+	"gpt-load/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// slowResponse writes a first chunk, then the rest once the server is shutting down
+// and pause has passed, the last chunk marking a completed response
+func slowResponse(streaming bool, shuttingDown <-chan struct{}, pause time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if streaming {
+			middleware.MarkStreaming(c)
+			c.Header("Content-Type", "text/event-stream")
+		}
+		c.Writer.WriteString("data: first\n\n")
+		c.Writer.Flush()
+		<-shuttingDown
+		select {
+		case <-time.After(pause):
+		case <-c.Request.Context().Done():
+			return
+		}
+		c.Writer.WriteString("data: [DONE]\n\n")
+	}
+}
+
+func TestShutdownOnSIGTERM(t *testing.T) {
+	tests := []struct {
+		name          string
+		streaming     bool
+		drainSeconds  int // SERVER_GRACEFUL_SHUTDOWN_TIMEOUT
+		writeSeconds  int // SERVER_WRITE_TIMEOUT
+		pause         time.Duration
+		wantCompleted bool
+	}{
+		{name: "stream completes within the drain timeout", streaming: true, drainSeconds: 5, writeSeconds: 1, pause: 200 * time.Millisecond, wantCompleted: true},
+		{name: "stream gets WRITE_TIMEOUT to drain", streaming: true, drainSeconds: 1, writeSeconds: 5, pause: 1500 * time.Millisecond, wantCompleted: true},
+		{name: "request without a stream dropped after the drain timeout", drainSeconds: 1, writeSeconds: 5, pause: 1500 * time.Millisecond},
+		{name: "stream dropped after WRITE_TIMEOUT", streaming: true, drainSeconds: 1, writeSeconds: 1, pause: time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shuttingDown := make(chan struct{})
+			requestStats := middleware.NewRequestStats()
+			router := gin.New()
+			router.Use(requestStats.Handler())
+			router.POST("/v1/chat/completions", slowResponse(tt.streaming, shuttingDown, tt.pause))
+
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("Listen: %v", err)
+			}
+			server := &http.Server{Handler: router}
+			go server.Serve(listener)
+
+			resp, err := http.Post("http://"+listener.Addr().String()+"/v1/chat/completions", "application/json", strings.NewReader(`{"stream":true}`))
+			if err != nil {
+				t.Fatalf("POST: %v", err)
+			}
+			defer resp.Body.Close()
+			first := make([]byte, len("data: first\n\n"))
+			if _, err := io.ReadFull(resp.Body, first); err != nil {
+				t.Fatalf("read the first chunk: %v", err)
+			}
+
+			quit := make(chan os.Signal, 1)
+			signal.Notify(quit, syscall.SIGTERM)
+			defer signal.Stop(quit)
+			if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+				t.Fatalf("SIGTERM: %v", err)
+			}
+			<-quit
+
+			serverConfig := types.ServerConfig{GracefulShutdownTimeout: tt.drainSeconds, WriteTimeout: tt.writeSeconds}
+			shutdownErr := make(chan error, 1)
+			go func() { shutdownErr <- shutdownServers(serverConfig, requestStats, server, nil, nil) }()
+			close(shuttingDown)
+
+			// The client gets the whole response or a closed connection, never a hang
+			rest, readErr := io.ReadAll(resp.Body)
+			completed := readErr == nil && string(rest) == "data: [DONE]\n\n"
+			if completed != tt.wantCompleted {
+				t.Errorf("response completed = %v (read %q, %v), want %v", completed, rest, readErr, tt.wantCompleted)
+			}
+			if !tt.wantCompleted && readErr == nil && len(rest) > 0 {
+				t.Errorf("dropped response ended with %q, want it cut after the first chunk", rest)
+			}
+
+			select {
+			case err := <-shutdownErr:
+				if (err == nil) != tt.wantCompleted {
+					t.Errorf("shutdown error = %v, want an error only when requests are dropped", err)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("shutdown never returned")
+			}
+			if n := requestStats.Counts().InFlight; tt.wantCompleted && n != 0 {
+				t.Errorf("%d requests still in flight after a graceful shutdown", n)
+			}
+		})
+	}
+}
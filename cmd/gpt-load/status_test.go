@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"gpt-load/internal/version"
+	"gpt-load/pkg/types"
+)
+
+func TestAdminStatus(t *testing.T) {
+	servers := startServers(t)
+
+	getStatus := func(t *testing.T, token string) (int, types.StatusResponse) {
+		t.Helper()
+		resp := send(t, http.MethodGet, servers.admin.URL+"/admin/status", token, "")
+		defer resp.Body.Close()
+		var status types.StatusResponse
+		if resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+				t.Fatalf("decode /admin/status: %v", err)
+			}
+		}
+		return resp.StatusCode, status
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{name: "client key rejected", token: "client-key", want: http.StatusUnauthorized},
+		{name: "no key rejected", want: http.StatusUnauthorized},
+		{name: "admin key", token: "admin-secret", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, _ := getStatus(t, tt.token); code != tt.want {
+				t.Errorf("status = %d, want %d", code, tt.want)
+			}
+		})
+	}
+
+	_, before := getStatus(t, "admin-secret")
+	chat(t, servers.public, 3)
+	servers.upstream.take()
+	_, status := getStatus(t, "admin-secret")
+
+	if status.Version != version.Version {
+		t.Errorf("version = %q, want %q", status.Version, version.Version)
+	}
+	if status.UptimeSeconds < 0 || status.UptimeSeconds < before.UptimeSeconds {
+		t.Errorf("uptime went from %d to %d seconds", before.UptimeSeconds, status.UptimeSeconds)
+	}
+	if got := status.Requests.Total - before.Requests.Total; got != 3 {
+		t.Errorf("requests total grew by %d after 3 completions, want 3", got)
+	}
+	if status.Requests.InFlight != 0 || status.QueueDepth != 0 {
+		t.Errorf("%d requests in flight and %d queued with the proxy idle", status.Requests.InFlight, status.QueueDepth)
+	}
+	if want := (types.KeyCapacity{Total: 2, Active: 2}); status.Keys != want {
+		t.Errorf("keys = %+v, want %+v", status.Keys, want)
+	}
+	if len(status.Upstreams) != 1 || status.Upstreams[0].URL != servers.upstreamURL || !status.Upstreams[0].Healthy || status.Upstreams[0].Degraded {
+		t.Errorf("upstreams = %+v, want %s healthy", status.Upstreams, servers.upstreamURL)
+	}
+	if len(status.Upstreams) == 1 && status.Upstreams[0].LatencyEMAMs <= 0 {
+		t.Errorf("upstream average latency = %vms after 3 completions, want above 0", status.Upstreams[0].LatencyEMAMs)
+	}
+	wantConfig := types.StatusConfig{
+		UpstreamType:          "openai",
+		LoadBalance:           "round_robin",
+		MaxRetries:            3,
+		BlacklistThreshold:    1,
+		MaxConcurrentRequests: 100,
+		AuthEnabled:           true,
+	}
+	if status.Config != wantConfig {
+		t.Errorf("config = %+v, want %+v", status.Config, wantConfig)
+	}
+	if status.Memory.SysMB == 0 || status.Memory.SysMB < status.Memory.AllocMB {
+		t.Errorf("memory = %+v, want system memory covering the heap", status.Memory)
+	}
+	if status.Goroutines <= 0 {
+		t.Errorf("goroutines = %d", status.Goroutines)
+	}
+	if age := time.Since(status.Timestamp); age < 0 || age > time.Minute {
+		t.Errorf("timestamp %v is %v old", status.Timestamp, age)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gpt-load/internal/tlscert"
+	"gpt-load/pkg/types"
+)
+
+// noopScheduler is a scheduler that never runs its tasks
+type noopScheduler struct{}
+
+func (noopScheduler) AddTask(string, time.Duration, func(context.Context)) error { return nil }
+
+func (noopScheduler) Start(context.Context) {}
+
+func (noopScheduler) Stop() {}
+
+// writeCertificate writes a self-signed certificate for 127.0.0.1 and its key,
+// returning the file paths and a pool trusting the certificate
+func writeCertificate(t *testing.T) (certFile, keyFile string, roots *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	roots = x509.NewCertPool()
+	roots.AppendCertsFromPEM(certPEM)
+	return certFile, keyFile, roots
+}
+
+func TestProxyServesHTTPS(t *testing.T) {
+	s := startServers(t)
+	certFile, keyFile, roots := writeCertificate(t)
+	tlsConfig, err := tlscert.NewConfig(types.ServerConfig{TLSCertFile: certFile, TLSKeyFile: keyFile, TLSMinVersion: "TLS1.2"}, noopScheduler{})
+	if err != nil {
+		t.Fatalf("tlscert.NewConfig: %v", err)
+	}
+
+	// Served the way main serves the public router when TLS is enabled
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: s.public.Config.Handler, TLSConfig: tlsConfig}
+	go server.ServeTLS(listener, "", "")
+	t.Cleanup(func() { server.Close() })
+	address := listener.Addr().String()
+
+	tests := []struct {
+		name       string
+		url        string
+		maxVersion uint16
+		wantStatus int // 0 when the connection must fail
+	}{
+		{name: "https", url: "https://" + address, wantStatus: http.StatusOK},
+		{name: "tls 1.3", url: "https://" + address, maxVersion: tls.VersionTLS13, wantStatus: http.StatusOK},
+		{name: "below the minimum version", url: "https://" + address, maxVersion: tls.VersionTLS11},
+		{name: "plain http", url: "http://" + address, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, MaxVersion: tt.maxVersion}}}
+			req, err := http.NewRequest(http.MethodPost, tt.url+"/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o","messages":[]}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer client-key")
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := client.Do(req)
+			if tt.wantStatus == 0 {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatalf("status = %d, want the handshake to fail", resp.StatusCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+	s.upstream.take()
+}
@@ -0,0 +1,102 @@
+// Package apierror builds the error responses generated by the proxy itself,
+// in the OpenAI error schema clients already parse for upstream errors:
+//
+//	{"error": {"message": "...", "type": "...", "param": null, "code": 4001}}
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"gpt-load/internal/errors"
+)
+
+// Error is an error response. Status is the HTTP status it is sent with, a zero
+// Code is written as null and fields added with With go next to the error object.
+type Error struct {
+	Status  int
+	Code    errors.ErrorCode
+	Message string
+	Type    string
+
+	extra map[string]any
+}
+
+// object is the error object of the OpenAI schema
+type object struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Param   *string `json:"param"`
+	Code    any     `json:"code"`
+}
+
+// New creates an error response, deriving the error type from the code and status
+func New(status int, code errors.ErrorCode, message string) *Error {
+	return &Error{
+		Status:  status,
+		Code:    code,
+		Message: message,
+		Type:    errors.ErrorTypeForCode(code, status),
+	}
+}
+
+// NewAuthError creates a 401 response for a missing or invalid credential
+func NewAuthError(code errors.ErrorCode, message string) *Error {
+	return New(http.StatusUnauthorized, code, message)
+}
+
+// NewRateLimitError creates a 429 response for a request over a rate limit or quota
+func NewRateLimitError(code errors.ErrorCode, message string) *Error {
+	return New(http.StatusTooManyRequests, code, message)
+}
+
+// NewUpstreamError creates a response for a request the upstreams could not serve
+func NewUpstreamError(status int, code errors.ErrorCode, message string) *Error {
+	return New(status, code, message)
+}
+
+// NewInvalidRequestError creates a 400 response for a request that cannot be proxied
+func NewInvalidRequestError(code errors.ErrorCode, message string) *Error {
+	return New(http.StatusBadRequest, code, message)
+}
+
+// NewNotFoundError creates a 404 response for a resource that does not exist
+func NewNotFoundError(message string) *Error {
+	return New(http.StatusNotFound, 0, message)
+}
+
+// NewServerError creates a 500 response for a failure on the proxy's side
+func NewServerError(code errors.ErrorCode, message string) *Error {
+	return New(http.StatusInternalServerError, code, message)
+}
+
+// With adds a field next to the error object, such as the request ID
+func (e *Error) With(key string, value any) *Error {
+	if e.extra == nil {
+		e.extra = make(map[string]any)
+	}
+	e.extra[key] = value
+	return e
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// MarshalJSON writes the error in the OpenAI schema
+func (e *Error) MarshalJSON() ([]byte, error) {
+	body := make(map[string]any, len(e.extra)+1)
+	for key, value := range e.extra {
+		body[key] = value
+	}
+	errorObject := object{
+		Message: e.Message,
+		Type:    e.Type,
+	}
+	if e.Code != 0 {
+		errorObject.Code = e.Code
+	}
+	body["error"] = errorObject
+	return json.Marshal(body)
+}
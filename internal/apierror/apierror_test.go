@@ -0,0 +1,128 @@
+package apierror
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"gpt-load/internal/errors"
+)
+
+func TestConstructors(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        *Error
+		wantStatus int
+		wantJSON   string
+	}{
+		{
+			name:       "auth",
+			err:        NewAuthError(errors.ErrAuthInvalid, "Invalid authentication token"),
+			wantStatus: http.StatusUnauthorized,
+			wantJSON:   fmt.Sprintf(`{"error":{"message":"Invalid authentication token","type":"authentication_error","param":null,"code":%d}}`, errors.ErrAuthInvalid),
+		},
+		{
+			name:       "rate limit",
+			err:        NewRateLimitError(errors.ErrRateLimited, "Too many requests"),
+			wantStatus: http.StatusTooManyRequests,
+			wantJSON:   fmt.Sprintf(`{"error":{"message":"Too many requests","type":"rate_limit_exceeded","param":null,"code":%d}}`, errors.ErrRateLimited),
+		},
+		{
+			name:       "quota",
+			err:        NewRateLimitError(errors.ErrQuotaExceeded, "Quota exceeded"),
+			wantStatus: http.StatusTooManyRequests,
+			wantJSON:   fmt.Sprintf(`{"error":{"message":"Quota exceeded","type":"rate_limit_exceeded","param":null,"code":%d}}`, errors.ErrQuotaExceeded),
+		},
+		{
+			name:       "upstream unavailable",
+			err:        NewUpstreamError(http.StatusServiceUnavailable, errors.ErrNoKeysAvailable, "No API keys available"),
+			wantStatus: http.StatusServiceUnavailable,
+			wantJSON:   fmt.Sprintf(`{"error":{"message":"No API keys available","type":"service_unavailable","param":null,"code":%d}}`, errors.ErrNoKeysAvailable),
+		},
+		{
+			name:       "upstream unreachable",
+			err:        NewUpstreamError(http.StatusBadGateway, errors.ErrProxyRequest, "Upstream request failed"),
+			wantStatus: http.StatusBadGateway,
+			wantJSON:   fmt.Sprintf(`{"error":{"message":"Upstream request failed","type":"bad_gateway","param":null,"code":%d}}`, errors.ErrProxyRequest),
+		},
+		{
+			name:       "upstream timeout",
+			err:        NewUpstreamError(http.StatusGatewayTimeout, errors.ErrProxyTimeout, "Upstream timed out"),
+			wantStatus: http.StatusGatewayTimeout,
+			wantJSON:   fmt.Sprintf(`{"error":{"message":"Upstream timed out","type":"gateway_timeout","param":null,"code":%d}}`, errors.ErrProxyTimeout),
+		},
+		{
+			name:       "invalid request",
+			err:        NewInvalidRequestError(errors.ErrProxyRequest, "Invalid JSON body"),
+			wantStatus: http.StatusBadRequest,
+			wantJSON:   fmt.Sprintf(`{"error":{"message":"Invalid JSON body","type":"invalid_request_error","param":null,"code":%d}}`, errors.ErrProxyRequest),
+		},
+		{
+			name:       "rejected configuration",
+			err:        NewInvalidRequestError(errors.ErrConfigValidation, "MAX_RETRIES cannot be negative"),
+			wantStatus: http.StatusBadRequest,
+			wantJSON:   fmt.Sprintf(`{"error":{"message":"MAX_RETRIES cannot be negative","type":"invalid_request_error","param":null,"code":%d}}`, errors.ErrConfigValidation),
+		},
+		{
+			name:       "broken configuration",
+			err:        NewServerError(errors.ErrConfigInvalid, "Configuration unavailable"),
+			wantStatus: http.StatusInternalServerError,
+			wantJSON:   fmt.Sprintf(`{"error":{"message":"Configuration unavailable","type":"internal_server_error","param":null,"code":%d}}`, errors.ErrConfigInvalid),
+		},
+		{
+			name:       "not found has a null code",
+			err:        NewNotFoundError("Key not found"),
+			wantStatus: http.StatusNotFound,
+			wantJSON:   `{"error":{"message":"Key not found","type":"not_found_error","param":null,"code":null}}`,
+		},
+		{
+			name:       "IP filter",
+			err:        New(http.StatusForbidden, errors.ErrIPNotAllowed, "Client IP not allowed"),
+			wantStatus: http.StatusForbidden,
+			wantJSON:   fmt.Sprintf(`{"error":{"message":"Client IP not allowed","type":"permission_error","param":null,"code":%d}}`, errors.ErrIPNotAllowed),
+		},
+		{
+			name:       "body too large",
+			err:        New(http.StatusRequestEntityTooLarge, errors.ErrRequestTooLarge, "Request body too large"),
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantJSON:   fmt.Sprintf(`{"error":{"message":"Request body too large","type":"request_too_large","param":null,"code":%d}}`, errors.ErrRequestTooLarge),
+		},
+		{
+			name:       "extra fields next to the error",
+			err:        NewAuthError(errors.ErrAuthMissing, "Missing authentication token").With("request_id", "req-123"),
+			wantStatus: http.StatusUnauthorized,
+			wantJSON:   fmt.Sprintf(`{"error":{"message":"Missing authentication token","type":"authentication_error","param":null,"code":%d},"request_id":"req-123"}`, errors.ErrAuthMissing),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.err.Status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", tt.err.Status, tt.wantStatus)
+			}
+			data, err := json.Marshal(tt.err)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if string(data) != tt.wantJSON {
+				t.Errorf("JSON = %s, want %s", data, tt.wantJSON)
+			}
+
+			// Clients parse it with the schema they use for OpenAI errors
+			var body struct {
+				Error *struct {
+					Message string  `json:"message"`
+					Type    string  `json:"type"`
+					Param   *string `json:"param"`
+					Code    any     `json:"code"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal(data, &body); err != nil || body.Error == nil {
+				t.Fatalf("parse %s: %v", data, err)
+			}
+			if body.Error.Message != tt.err.Error() || body.Error.Type == "" || body.Error.Param != nil {
+				t.Errorf("parsed error = %+v", *body.Error)
+			}
+		})
+	}
+}
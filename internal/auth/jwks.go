@@ -0,0 +1,248 @@
+// Package auth provides JWT verification backed by a remote JWKS endpoint
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"gpt-load/internal/errors"
+	"gpt-load/pkg/types"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// clockSkewLeeway is the clock difference tolerated when checking exp and nbf claims
+const clockSkewLeeway = 30 * time.Second
+
+// Manager fetches and caches the JWKS used to verify JWT bearer tokens
+type Manager struct {
+	jwksURL    string
+	audience   string
+	httpClient *http.Client
+
+	keys  map[string]crypto.PublicKey
+	mutex sync.RWMutex
+}
+
+// jsonWebKey represents a single key in a JWKS document
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// NewManager creates a JWKS manager, fetching the key set once before returning
+func NewManager(config types.AuthConfig, scheduler types.Scheduler) (*Manager, error) {
+	m := &Manager{
+		jwksURL:    config.JWKSURL,
+		audience:   config.JWTAudience,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+
+	// Fail startup if the key set cannot be fetched
+	if err := m.refresh(context.Background()); err != nil {
+		return nil, errors.NewAppErrorWithCause(errors.ErrConfigInvalid, "Failed to fetch JWKS", err)
+	}
+
+	interval := time.Duration(config.JWKSRefreshInterval) * time.Second
+	if err := scheduler.AddTask("jwks-refresh", interval, func(ctx context.Context) {
+		if err := m.refresh(ctx); err != nil {
+			logrus.Errorf("Failed to refresh JWKS, keeping previous key set: %v", err)
+		}
+	}); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// VerifyToken verifies a JWT signature, expiry and audience, returning its subject
+// claim. Tokens without an exp claim are rejected.
+func (m *Manager) VerifyToken(tokenString string) (string, error) {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "ES256"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(clockSkewLeeway),
+	}
+	if m.audience != "" {
+		options = append(options, jwt.WithAudience(m.audience))
+	}
+
+	token, err := jwt.Parse(tokenString, m.lookupKey, options...)
+	if err != nil {
+		return "", err
+	}
+
+	subject, err := token.Claims.GetSubject()
+	if err != nil {
+		return "", err
+	}
+	return subject, nil
+}
+
+// lookupKey resolves the verification key for a token from its kid header
+func (m *Manager) lookupKey(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, fmt.Errorf("token has no kid header")
+	}
+
+	m.mutex.RLock()
+	key, exists := m.keys[kid]
+	m.mutex.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("unknown kid: %s", kid)
+	}
+
+	// Make sure the algorithm matches the key type
+	switch key.(type) {
+	case *rsa.PublicKey:
+		if token.Method.Alg() != "RS256" {
+			return nil, fmt.Errorf("algorithm %s does not match RSA key %s", token.Method.Alg(), kid)
+		}
+	case *ecdsa.PublicKey:
+		if token.Method.Alg() != "ES256" {
+			return nil, fmt.Errorf("algorithm %s does not match EC key %s", token.Method.Alg(), kid)
+		}
+	}
+	return key, nil
+}
+
+// refresh fetches the JWKS and atomically replaces the cached key set
+func (m *Manager) refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.jwksURL, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("JWKS endpoint returned HTTP %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	keys, err := parseJWKS(body)
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	m.keys = keys
+	m.mutex.Unlock()
+
+	logrus.Debugf("Loaded %d keys from JWKS", len(keys))
+	return nil
+}
+
+// parseJWKS parses a JWKS document into public keys keyed by kid. Keys of an
+// unsupported type or curve and malformed keys are skipped.
+func parseJWKS(body []byte) (map[string]crypto.PublicKey, error) {
+	var document struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil, fmt.Errorf("invalid JWKS document: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(document.Keys))
+	for _, jwk := range document.Keys {
+		if jwk.Kid == "" {
+			continue
+		}
+
+		var (
+			key crypto.PublicKey
+			err error
+		)
+		switch jwk.Kty {
+		case "RSA":
+			key, err = parseRSAKey(jwk)
+		case "EC":
+			key, err = parseECKey(jwk)
+		default:
+			logrus.Debugf("Skipping JWKS key %s with unsupported type %s", jwk.Kid, jwk.Kty)
+			continue
+		}
+		if err != nil {
+			logrus.Debugf("Skipping invalid JWKS key %s: %v", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS contains no usable keys")
+	}
+	return keys, nil
+}
+
+// parseRSAKey builds an RSA public key from its modulus and exponent
+func parseRSAKey(jwk jsonWebKey) (*rsa.PublicKey, error) {
+	n, err := decodeBigInt(jwk.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := decodeBigInt(jwk.E)
+	if err != nil {
+		return nil, err
+	}
+	if !e.IsInt64() {
+		return nil, fmt.Errorf("RSA exponent too large")
+	}
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+// parseECKey builds a P-256 public key from its coordinates
+func parseECKey(jwk jsonWebKey) (*ecdsa.PublicKey, error) {
+	if jwk.Crv != "P-256" {
+		return nil, fmt.Errorf("unsupported curve %s", jwk.Crv)
+	}
+	x, err := decodeBigInt(jwk.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := decodeBigInt(jwk.Y)
+	if err != nil {
+		return nil, err
+	}
+
+	curve := elliptic.P256()
+	if !curve.IsOnCurve(x, y) {
+		return nil, fmt.Errorf("point is not on curve %s", jwk.Crv)
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// decodeBigInt decodes a base64url-encoded big-endian integer
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,257 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gpt-load/pkg/types"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newTestManager returns a manager trusting one generated P-256 key with kid "test"
+func newTestManager(t *testing.T, audience string) (*Manager, *ecdsa.PrivateKey) {
+	t.Helper()
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	m := &Manager{
+		audience: audience,
+		keys:     map[string]crypto.PublicKey{"test": &privateKey.PublicKey},
+	}
+	return m, privateKey
+}
+
+// signToken signs claims with ES256 under kid "test"
+func signToken(t *testing.T, privateKey *ecdsa.PrivateKey, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = "test"
+	signed, err := token.SignedString(privateKey)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	return signed
+}
+
+func TestVerifyToken(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		claims  jwt.MapClaims
+		wantErr bool
+	}{
+		{name: "valid", claims: jwt.MapClaims{"sub": "alice", "aud": "gpt-load", "exp": now.Add(time.Hour).Unix()}},
+		{name: "missing exp", claims: jwt.MapClaims{"sub": "alice", "aud": "gpt-load"}, wantErr: true},
+		{name: "expired within leeway", claims: jwt.MapClaims{"sub": "alice", "aud": "gpt-load", "exp": now.Add(-10 * time.Second).Unix()}},
+		{name: "expired", claims: jwt.MapClaims{"sub": "alice", "aud": "gpt-load", "exp": now.Add(-time.Minute).Unix()}, wantErr: true},
+		{name: "not yet valid", claims: jwt.MapClaims{"sub": "alice", "aud": "gpt-load", "exp": now.Add(time.Hour).Unix(), "nbf": now.Add(time.Minute).Unix()}, wantErr: true},
+		{name: "wrong audience", claims: jwt.MapClaims{"sub": "alice", "aud": "other", "exp": now.Add(time.Hour).Unix()}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, privateKey := newTestManager(t, "gpt-load")
+			subject, err := m.VerifyToken(signToken(t, privateKey, tt.claims))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("VerifyToken accepted the token for %s", subject)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyToken: %v", err)
+			}
+			if subject != "alice" {
+				t.Errorf("subject = %q, want alice", subject)
+			}
+		})
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	p256 := fmt.Sprintf(`{"kty":"EC","kid":"p256","crv":"P-256","x":%q,"y":%q}`,
+		base64.RawURLEncoding.EncodeToString(privateKey.X.Bytes()), base64.RawURLEncoding.EncodeToString(privateKey.Y.Bytes()))
+	p384 := `{"kty":"EC","kid":"p384","crv":"P-384","x":"AQ","y":"AQ"}`
+	offCurve := `{"kty":"EC","kid":"off","crv":"P-256","x":"AQ","y":"AQ"}`
+	badRSA := `{"kty":"RSA","kid":"bad","n":"!!","e":"AQAB"}`
+	okp := `{"kty":"OKP","kid":"ed","crv":"Ed25519","x":"AQ"}`
+
+	tests := []struct {
+		name    string
+		keys    []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "usable key", keys: []string{p256}, want: []string{"p256"}},
+		{name: "unsupported curve skipped", keys: []string{p384, p256}, want: []string{"p256"}},
+		{name: "malformed keys skipped", keys: []string{offCurve, badRSA, p256}, want: []string{"p256"}},
+		{name: "unsupported type skipped", keys: []string{okp, p256}, want: []string{"p256"}},
+		{name: "no usable keys", keys: []string{p384, offCurve, okp}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := parseJWKS([]byte(`{"keys":[` + strings.Join(tt.keys, ",") + `]}`))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseJWKS returned %d keys, want an error", len(keys))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseJWKS: %v", err)
+			}
+			if len(keys) != len(tt.want) {
+				t.Errorf("parseJWKS returned %d keys, want %d", len(keys), len(tt.want))
+			}
+			for _, kid := range tt.want {
+				if _, exists := keys[kid]; !exists {
+					t.Errorf("key %s missing", kid)
+				}
+			}
+		})
+	}
+}
+
+// jwksFixture serves a JWKS document that tests can replace
+type jwksFixture struct {
+	*httptest.Server
+	mu       sync.Mutex
+	status   int
+	document string
+}
+
+func newJWKSFixture(t *testing.T, document string) *jwksFixture {
+	t.Helper()
+	fixture := &jwksFixture{status: http.StatusOK, document: document}
+	fixture.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fixture.mu.Lock()
+		defer fixture.mu.Unlock()
+		w.WriteHeader(fixture.status)
+		w.Write([]byte(fixture.document))
+	}))
+	t.Cleanup(fixture.Close)
+	return fixture
+}
+
+func (f *jwksFixture) serve(status int, document string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status = status
+	f.document = document
+}
+
+// ecJWKS returns a JWKS document holding privateKey's public key under kid
+func ecJWKS(kid string, privateKey *ecdsa.PrivateKey) string {
+	return fmt.Sprintf(`{"keys":[{"kty":"EC","kid":%q,"crv":"P-256","x":%q,"y":%q}]}`, kid,
+		base64.RawURLEncoding.EncodeToString(privateKey.X.FillBytes(make([]byte, 32))),
+		base64.RawURLEncoding.EncodeToString(privateKey.Y.FillBytes(make([]byte, 32))))
+}
+
+// taskRecorder is a scheduler that keeps the tasks added to it so tests can run them
+type taskRecorder struct {
+	tasks     map[string]func(context.Context)
+	intervals map[string]time.Duration
+}
+
+func (s *taskRecorder) AddTask(name string, interval time.Duration, fn func(context.Context)) error {
+	s.tasks[name] = fn
+	s.intervals[name] = interval
+	return nil
+}
+
+func (s *taskRecorder) Start(context.Context) {}
+
+func (s *taskRecorder) Stop() {}
+
+func TestNewManagerFetchesJWKS(t *testing.T) {
+	first, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	second, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	// signKid signs a valid token with privateKey under kid
+	signKid := func(kid string, privateKey *ecdsa.PrivateKey, exp time.Time) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"sub": "alice", "aud": "gpt-load", "exp": exp.Unix()})
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(privateKey)
+		if err != nil {
+			t.Fatalf("SignedString: %v", err)
+		}
+		return signed
+	}
+
+	fixture := newJWKSFixture(t, ecJWKS("first", first))
+	scheduler := &taskRecorder{tasks: make(map[string]func(context.Context)), intervals: make(map[string]time.Duration)}
+	m, err := NewManager(types.AuthConfig{JWKSURL: fixture.URL, JWKSRefreshInterval: 300, JWTAudience: "gpt-load"}, scheduler)
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	refresh := scheduler.tasks["jwks-refresh"]
+	if refresh == nil || scheduler.intervals["jwks-refresh"] != 5*time.Minute {
+		t.Fatalf("refresh task every %v, want every 5m", scheduler.intervals["jwks-refresh"])
+	}
+
+	// Each step optionally changes what the endpoint serves and refreshes, then verifies tokens
+	steps := []struct {
+		name     string
+		status   int
+		document string
+		token    string
+		wantErr  bool
+	}{
+		{name: "fetched on startup", token: signKid("first", first, time.Now().Add(time.Hour))},
+		{name: "expired token", token: signKid("first", first, time.Now().Add(-time.Hour)), wantErr: true},
+		{name: "unknown kid", token: signKid("second", second, time.Now().Add(time.Hour)), wantErr: true},
+		{name: "rotated key accepted", status: http.StatusOK, document: ecJWKS("second", second), token: signKid("second", second, time.Now().Add(time.Hour))},
+		{name: "retired key rejected", token: signKid("first", first, time.Now().Add(time.Hour)), wantErr: true},
+		{name: "failed refresh keeps keys", status: http.StatusInternalServerError, document: "oops", token: signKid("second", second, time.Now().Add(time.Hour))},
+		{name: "empty key set keeps keys", status: http.StatusOK, document: `{"keys":[]}`, token: signKid("second", second, time.Now().Add(time.Hour))},
+	}
+	for _, step := range steps {
+		if step.status != 0 {
+			fixture.serve(step.status, step.document)
+			refresh(context.Background())
+		}
+		subject, err := m.VerifyToken(step.token)
+		if step.wantErr {
+			if err == nil {
+				t.Errorf("%s: VerifyToken accepted the token", step.name)
+			}
+			continue
+		}
+		if err != nil || subject != "alice" {
+			t.Errorf("%s: VerifyToken = %q, %v, want alice", step.name, subject, err)
+		}
+	}
+}
+
+func TestNewManagerFailsWithoutJWKS(t *testing.T) {
+	fixture := newJWKSFixture(t, "")
+	fixture.serve(http.StatusNotFound, "")
+	scheduler := &taskRecorder{tasks: make(map[string]func(context.Context)), intervals: make(map[string]time.Duration)}
+	if _, err := NewManager(types.AuthConfig{JWKSURL: fixture.URL, JWKSRefreshInterval: 300}, scheduler); err == nil {
+		t.Error("NewManager succeeded without a key set")
+	}
+	if len(scheduler.tasks) != 0 {
+		t.Error("refresh task registered after a failed startup fetch")
+	}
+}
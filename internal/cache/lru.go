@@ -0,0 +1,154 @@
+// Package cache provides a size-bounded LRU cache for upstream responses
+package cache
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Entry is a cached response
+type Entry struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// size estimates the memory held by an entry
+func (e *Entry) size() int64 {
+	size := int64(len(e.Body))
+	for name, values := range e.Header {
+		size += int64(len(name))
+		for _, value := range values {
+			size += int64(len(value))
+		}
+	}
+	return size
+}
+
+// item is a cache entry with its key and expiry, stored in the LRU list
+type item struct {
+	key       string
+	entry     *Entry
+	size      int64
+	expiresAt time.Time
+}
+
+// Stats are the cache counters since creation
+type Stats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	Entries   int   `json:"entries"`
+	SizeBytes int64 `json:"sizeBytes"`
+}
+
+// LRU caches entries for a fixed TTL, evicting the least recently used
+// entries once the total size exceeds the limit. Lookups go through a
+// sync.Map; the recency list is guarded by a mutex.
+type LRU struct {
+	ttl     time.Duration
+	maxSize int64
+
+	items sync.Map // key -> *list.Element holding an *item
+
+	mu    sync.Mutex
+	order *list.List // Front is the most recently used
+	size  int64
+
+	hits      atomic.Int64
+	misses    atomic.Int64
+	evictions atomic.Int64
+}
+
+// NewLRU creates a cache holding up to maxSize bytes of entries for ttl each
+func NewLRU(ttl time.Duration, maxSize int64) *LRU {
+	return &LRU{
+		ttl:     ttl,
+		maxSize: maxSize,
+		order:   list.New(),
+	}
+}
+
+// Get returns the entry for key if present and not expired
+func (c *LRU) Get(key string) (*Entry, bool) {
+	value, exists := c.items.Load(key)
+	if !exists {
+		c.misses.Add(1)
+		return nil, false
+	}
+	element := value.(*list.Element)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// The element may have been evicted since the lookup
+	it, live := element.Value.(*item)
+	if !live || time.Now().After(it.expiresAt) {
+		if live {
+			c.remove(element)
+		}
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	c.hits.Add(1)
+	return it.entry, true
+}
+
+// Set stores an entry, replacing any previous entry for key. Entries larger
+// than the whole cache are not stored.
+func (c *LRU) Set(key string, entry *Entry) {
+	size := entry.size()
+	if size > c.maxSize {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if value, exists := c.items.Load(key); exists {
+		c.remove(value.(*list.Element))
+	}
+
+	element := c.order.PushFront(&item{
+		key:       key,
+		entry:     entry,
+		size:      size,
+		expiresAt: time.Now().Add(c.ttl),
+	})
+	c.items.Store(key, element)
+	c.size += size
+
+	for c.size > c.maxSize {
+		c.remove(c.order.Back())
+		c.evictions.Add(1)
+	}
+}
+
+// Stats returns the cache counters
+func (c *LRU) Stats() Stats {
+	c.mu.Lock()
+	entries, size := c.order.Len(), c.size
+	c.mu.Unlock()
+
+	return Stats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+		Entries:   entries,
+		SizeBytes: size,
+	}
+}
+
+// remove unlinks an element, must be called with mu held
+func (c *LRU) remove(element *list.Element) {
+	it := element.Value.(*item)
+	c.order.Remove(element)
+	c.items.CompareAndDelete(it.key, element)
+	c.size -= it.size
+	element.Value = nil
+}
@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// entry returns an entry whose size is n bytes
+func entry(n int) *Entry {
+	return &Entry{Status: 200, Body: []byte(strings.Repeat("x", n))}
+}
+
+func TestLRU(t *testing.T) {
+	const (
+		get = "get"
+		set = "set"
+	)
+	type op struct {
+		kind string
+		key  string
+		size int  // Body size for set
+		hit  bool // Expected result for get
+	}
+	tests := []struct {
+		name string
+		ops  []op
+		want Stats
+	}{
+		{name: "miss", ops: []op{{kind: get, key: "a"}}, want: Stats{Misses: 1}},
+		{
+			name: "hit after set",
+			ops:  []op{{kind: set, key: "a", size: 10}, {kind: get, key: "a", hit: true}, {kind: get, key: "a", hit: true}},
+			want: Stats{Hits: 2, Entries: 1, SizeBytes: 10},
+		},
+		{
+			name: "oldest evicted",
+			ops: []op{
+				{kind: set, key: "a", size: 40}, {kind: set, key: "b", size: 40}, {kind: set, key: "c", size: 40},
+				{kind: get, key: "a"}, {kind: get, key: "b", hit: true}, {kind: get, key: "c", hit: true},
+			},
+			want: Stats{Hits: 2, Misses: 1, Evictions: 1, Entries: 2, SizeBytes: 80},
+		},
+		{
+			name: "recently used kept",
+			ops: []op{
+				{kind: set, key: "a", size: 40}, {kind: set, key: "b", size: 40}, {kind: get, key: "a", hit: true},
+				{kind: set, key: "c", size: 40}, {kind: get, key: "a", hit: true}, {kind: get, key: "b"},
+			},
+			want: Stats{Hits: 2, Misses: 1, Evictions: 1, Entries: 2, SizeBytes: 80},
+		},
+		{
+			name: "large entry evicts several",
+			ops: []op{
+				{kind: set, key: "a", size: 30}, {kind: set, key: "b", size: 30}, {kind: set, key: "c", size: 30},
+				{kind: set, key: "d", size: 90}, {kind: get, key: "d", hit: true},
+			},
+			want: Stats{Hits: 1, Evictions: 3, Entries: 1, SizeBytes: 90},
+		},
+		{
+			name: "replaced entry resized",
+			ops:  []op{{kind: set, key: "a", size: 40}, {kind: set, key: "a", size: 10}, {kind: get, key: "a", hit: true}},
+			want: Stats{Hits: 1, Entries: 1, SizeBytes: 10},
+		},
+		{
+			name: "oversized entry not stored",
+			ops:  []op{{kind: set, key: "a", size: 101}, {kind: get, key: "a"}},
+			want: Stats{Misses: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewLRU(time.Minute, 100)
+			for i, op := range tt.ops {
+				switch op.kind {
+				case set:
+					c.Set(op.key, entry(op.size))
+				case get:
+					got, hit := c.Get(op.key)
+					if hit != op.hit {
+						t.Fatalf("op %d: Get(%s) hit = %v, want %v", i, op.key, hit, op.hit)
+					}
+					if hit && len(got.Body) == 0 {
+						t.Fatalf("op %d: Get(%s) returned an empty entry", i, op.key)
+					}
+				}
+			}
+			if stats := c.Stats(); stats != tt.want {
+				t.Errorf("stats = %+v, want %+v", stats, tt.want)
+			}
+		})
+	}
+}
+
+func TestLRUExpiry(t *testing.T) {
+	c := NewLRU(20*time.Millisecond, 100)
+	c.Set("a", entry(10))
+	if _, hit := c.Get("a"); !hit {
+		t.Fatal("fresh entry missed")
+	}
+	time.Sleep(40 * time.Millisecond)
+	if _, hit := c.Get("a"); hit {
+		t.Fatal("expired entry hit")
+	}
+	if stats := c.Stats(); stats != (Stats{Hits: 1, Misses: 1}) {
+		t.Errorf("stats = %+v, want the expired entry dropped", stats)
+	}
+}
+
+func TestEntrySizeCountsHeaders(t *testing.T) {
+	e := &Entry{Body: []byte("body"), Header: map[string][]string{"Content-Type": {"application/json"}}}
+	if size := e.size(); size != int64(len("body")+len("Content-Type")+len("application/json")) {
+		t.Errorf("size = %d", size)
+	}
+}
@@ -0,0 +1,140 @@
+// Package circuitbreaker provides a consecutive-failure circuit breaker
+package circuitbreaker
+
+import (
+	"sync"
+	"time"
+)
+
+// State is the state of a circuit breaker
+type State int
+
+const (
+	// StateClosed lets all traffic through
+	StateClosed State = iota
+	// StateOpen rejects traffic until the open timeout elapses
+	StateOpen
+	// StateHalfOpen lets traffic through on probation
+	StateHalfOpen
+)
+
+// String returns the state name
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "CLOSED"
+	case StateOpen:
+		return "OPEN"
+	case StateHalfOpen:
+		return "HALF_OPEN"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// CircuitBreaker opens after failThreshold consecutive failures, turns half
+// open once timeout has passed and closes again after successThreshold
+// consecutive successes. Any failure while half open reopens it.
+type CircuitBreaker struct {
+	failThreshold    int
+	successThreshold int
+	timeout          time.Duration
+	now              func() time.Time
+
+	mu        sync.Mutex
+	state     State
+	failures  int
+	successes int
+	openedAt  time.Time
+}
+
+// Snapshot is a point-in-time view of a circuit breaker
+type Snapshot struct {
+	State     State
+	Failures  int
+	Successes int
+	OpenedAt  time.Time // Zero unless the breaker has opened
+}
+
+// New creates a closed circuit breaker
+func New(failThreshold, successThreshold int, timeout time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		failThreshold:    failThreshold,
+		successThreshold: successThreshold,
+		timeout:          timeout,
+		now:              time.Now,
+	}
+}
+
+// Allow reports whether traffic may be sent
+func (cb *CircuitBreaker) Allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	return cb.currentState(cb.now()) != StateOpen
+}
+
+// RecordSuccess records a successful call
+func (cb *CircuitBreaker) RecordSuccess() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.currentState(cb.now()) {
+	case StateClosed:
+		cb.failures = 0
+	case StateHalfOpen:
+		cb.successes++
+		if cb.successes >= cb.successThreshold {
+			cb.state = StateClosed
+			cb.failures = 0
+			cb.successes = 0
+		}
+	}
+}
+
+// RecordFailure records a failed call
+func (cb *CircuitBreaker) RecordFailure() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	now := cb.now()
+	switch cb.currentState(now) {
+	case StateClosed:
+		cb.failures++
+		if cb.failures >= cb.failThreshold {
+			cb.open(now)
+		}
+	case StateHalfOpen:
+		cb.open(now)
+	}
+}
+
+// Snapshot returns the current state and counters
+func (cb *CircuitBreaker) Snapshot() Snapshot {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	return Snapshot{
+		State:     cb.currentState(cb.now()),
+		Failures:  cb.failures,
+		Successes: cb.successes,
+		OpenedAt:  cb.openedAt,
+	}
+}
+
+// currentState moves an open breaker to half open once its timeout has
+// passed, must be called with mu held
+func (cb *CircuitBreaker) currentState(now time.Time) State {
+	if cb.state == StateOpen && now.Sub(cb.openedAt) >= cb.timeout {
+		cb.state = StateHalfOpen
+		cb.successes = 0
+	}
+	return cb.state
+}
+
+// open trips the breaker, must be called with mu held
+func (cb *CircuitBreaker) open(now time.Time) {
+	cb.state = StateOpen
+	cb.openedAt = now
+	cb.successes = 0
+}
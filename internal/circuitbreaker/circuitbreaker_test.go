@@ -0,0 +1,109 @@
+package circuitbreaker
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestBreaker returns a breaker opening after 3 failures and closing after
+// 2 successes, on a clock that only moves when advance is called
+func newTestBreaker() (cb *CircuitBreaker, advance func(time.Duration)) {
+	now := time.Unix(1700000000, 0)
+	cb = New(3, 2, 30*time.Second)
+	cb.now = func() time.Time { return now }
+	return cb, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	const (
+		fail    = "fail"
+		succeed = "succeed"
+		wait    = "wait"
+	)
+	tests := []struct {
+		name  string
+		steps []string
+		want  State
+	}{
+		{name: "starts closed", want: StateClosed},
+		{name: "below threshold", steps: []string{fail, fail}, want: StateClosed},
+		{name: "opens at threshold", steps: []string{fail, fail, fail}, want: StateOpen},
+		{name: "success resets failures", steps: []string{fail, fail, succeed, fail, fail}, want: StateClosed},
+		{name: "successes ignored while open", steps: []string{fail, fail, fail, succeed, succeed}, want: StateOpen},
+		{name: "half open after timeout", steps: []string{fail, fail, fail, wait}, want: StateHalfOpen},
+		{name: "half open needs every success", steps: []string{fail, fail, fail, wait, succeed}, want: StateHalfOpen},
+		{name: "closes after successes", steps: []string{fail, fail, fail, wait, succeed, succeed}, want: StateClosed},
+		{name: "half open failure reopens", steps: []string{fail, fail, fail, wait, succeed, fail}, want: StateOpen},
+		{name: "reopen restarts timeout", steps: []string{fail, fail, fail, wait, fail, succeed}, want: StateOpen},
+		{name: "closed again needs full threshold", steps: []string{fail, fail, fail, wait, succeed, succeed, fail, fail}, want: StateClosed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cb, advance := newTestBreaker()
+			for _, step := range tt.steps {
+				switch step {
+				case fail:
+					cb.RecordFailure()
+				case succeed:
+					cb.RecordSuccess()
+				case wait:
+					advance(30 * time.Second)
+				}
+			}
+			if got := cb.Snapshot().State; got != tt.want {
+				t.Errorf("state = %s, want %s", got, tt.want)
+			}
+			if allowed := cb.Allow(); allowed != (tt.want != StateOpen) {
+				t.Errorf("Allow = %v in state %s", allowed, tt.want)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerStaysOpenUntilTimeout(t *testing.T) {
+	cb, advance := newTestBreaker()
+	for i := 0; i < 3; i++ {
+		cb.RecordFailure()
+	}
+	openedAt := cb.Snapshot().OpenedAt
+
+	advance(30*time.Second - time.Millisecond)
+	if cb.Allow() {
+		t.Fatal("breaker allowed traffic before the timeout")
+	}
+	advance(time.Millisecond)
+	if !cb.Allow() {
+		t.Fatal("breaker rejected traffic after the timeout")
+	}
+	if snapshot := cb.Snapshot(); !snapshot.OpenedAt.Equal(openedAt) {
+		t.Errorf("OpenedAt = %v, want %v", snapshot.OpenedAt, openedAt)
+	}
+}
+
+func TestCircuitBreakerConcurrentCounts(t *testing.T) {
+	const goroutines, calls = 8, 100
+	cb := New(goroutines*calls+1, 2, time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < calls; j++ {
+				cb.RecordFailure()
+				cb.Allow()
+			}
+		}()
+	}
+	wg.Wait()
+
+	snapshot := cb.Snapshot()
+	if snapshot.State != StateClosed || snapshot.Failures != goroutines*calls {
+		t.Fatalf("after %d failures: state %s with %d failures", goroutines*calls, snapshot.State, snapshot.Failures)
+	}
+	cb.RecordFailure()
+	if state := cb.Snapshot().State; state != StateOpen {
+		t.Errorf("state = %s after reaching the threshold, want OPEN", state)
+	}
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"time"
+
+	"gpt-load/internal/circuitbreaker"
+	"gpt-load/pkg/types"
+
+	"github.com/sirupsen/logrus"
+)
+
+// newCircuitBreakers creates one circuit breaker per upstream, including those only reached
+// through routing rules, reusing breakers from existing for upstreams that have one
+func newCircuitBreakers(openaiConfig types.OpenAIConfig, routing types.RoutingConfig, existing map[string]*circuitbreaker.CircuitBreaker) map[string]*circuitbreaker.CircuitBreaker {
+	timeout := time.Duration(openaiConfig.CircuitOpenTimeout) * time.Second
+	breakers := make(map[string]*circuitbreaker.CircuitBreaker, len(openaiConfig.BaseURLs))
+	add := func(baseURL string) {
+		if breaker, exists := existing[baseURL]; exists {
+			breakers[baseURL] = breaker
+		} else if _, exists := breakers[baseURL]; !exists {
+			breakers[baseURL] = circuitbreaker.New(openaiConfig.CircuitFailThreshold, openaiConfig.CircuitSuccessThreshold, timeout)
+		}
+	}
+	for _, baseURL := range openaiConfig.BaseURLs {
+		add(baseURL)
+	}
+	for _, baseURLs := range routing.Rules {
+		for _, baseURL := range baseURLs {
+			add(baseURL)
+		}
+	}
+	return breakers
+}
+
+// RecordUpstreamResult feeds the outcome of a request to the upstream's circuit breaker
+func (m *Manager) RecordUpstreamResult(baseURL string, failed bool) {
+	m.mu.RLock()
+	breaker, exists := m.breakers[baseURL]
+	openTimeout := m.config.OpenAI.CircuitOpenTimeout
+	m.mu.RUnlock()
+	if !exists {
+		return
+	}
+
+	before := breaker.Snapshot().State
+	if failed {
+		breaker.RecordFailure()
+	} else {
+		breaker.RecordSuccess()
+	}
+
+	if after := breaker.Snapshot().State; after != before {
+		switch after {
+		case circuitbreaker.StateOpen:
+			logrus.Warnf("Circuit for upstream %s opened, skipping it for %ds", baseURL, openTimeout)
+		case circuitbreaker.StateClosed:
+			logrus.Infof("Circuit for upstream %s closed", baseURL)
+		}
+	}
+}
+
+// GetCircuitStates returns the circuit breaker state of every upstream
+func (m *Manager) GetCircuitStates() []types.CircuitStatus {
+	m.mu.RLock()
+	baseURLs := m.config.OpenAI.BaseURLs
+	breakers := m.breakers
+	m.mu.RUnlock()
+
+	states := make([]types.CircuitStatus, 0, len(breakers))
+	for _, baseURL := range baseURLs {
+		breaker, exists := breakers[baseURL]
+		if !exists {
+			continue
+		}
+
+		snapshot := breaker.Snapshot()
+		status := types.CircuitStatus{
+			URL:      baseURL,
+			State:    snapshot.State.String(),
+			Failures: snapshot.Failures,
+		}
+		if !snapshot.OpenedAt.IsZero() {
+			status.OpenedAt = &snapshot.OpenedAt
+		}
+		states = append(states, status)
+	}
+	return states
+}
+
+// isCircuitOpen reports whether an upstream's circuit is open
+func (m *Manager) isCircuitOpen(baseURL string) bool {
+	m.mu.RLock()
+	breaker, exists := m.breakers[baseURL]
+	m.mu.RUnlock()
+	return exists && !breaker.Allow()
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"testing"
+
+	"gpt-load/internal/circuitbreaker"
+	"gpt-load/pkg/types"
+)
+
+// selectedUpstreams returns the upstreams n calls to GetOpenAIConfig pick
+func selectedUpstreams(m *Manager, n int) map[string]bool {
+	selected := make(map[string]bool)
+	for i := 0; i < n; i++ {
+		selected[m.GetOpenAIConfig().BaseURL] = true
+	}
+	return selected
+}
+
+func TestCircuitBreakerExcludesUpstream(t *testing.T) {
+	const a, b = "https://a.example", "https://b.example"
+	manager := newTestManager(t, map[string]string{
+		"API_KEYS":                          "sk-startup",
+		"OPENAI_BASE_URL":                   a + "," + b,
+		"CIRCUIT_BREAKER_FAIL_THRESHOLD":    "2",
+		"CIRCUIT_BREAKER_SUCCESS_THRESHOLD": "1",
+	})
+
+	// Each step reports its results, then checks selection and the admin view
+	steps := []struct {
+		name     string
+		results  map[string][]bool // Upstream to the failed flag of each result
+		selected []string
+		states   map[string]string
+	}{
+		{name: "all closed", selected: []string{a, b}, states: map[string]string{a: "CLOSED", b: "CLOSED"}},
+		{name: "b fails once", results: map[string][]bool{b: {true}}, selected: []string{a, b}, states: map[string]string{a: "CLOSED", b: "CLOSED"}},
+		{name: "b opens", results: map[string][]bool{b: {true}}, selected: []string{a}, states: map[string]string{a: "CLOSED", b: "OPEN"}},
+		{name: "a success keeps b open", results: map[string][]bool{a: {false}}, selected: []string{a}, states: map[string]string{a: "CLOSED", b: "OPEN"}},
+		{name: "every circuit open", results: map[string][]bool{a: {true, true}}, selected: []string{a, b}, states: map[string]string{a: "OPEN", b: "OPEN"}},
+	}
+	for _, step := range steps {
+		for baseURL, results := range step.results {
+			for _, failed := range results {
+				manager.RecordUpstreamResult(baseURL, failed)
+			}
+		}
+
+		selected := selectedUpstreams(manager, 20)
+		if len(selected) != len(step.selected) {
+			t.Errorf("%s: selected %v, want %v", step.name, selected, step.selected)
+		}
+		for _, baseURL := range step.selected {
+			if !selected[baseURL] {
+				t.Errorf("%s: %s never selected", step.name, baseURL)
+			}
+		}
+		for _, status := range manager.GetCircuitStates() {
+			if want := step.states[status.URL]; status.State != want {
+				t.Errorf("%s: %s circuit = %s, want %s", step.name, status.URL, status.State, want)
+			}
+			if (status.OpenedAt != nil) != (status.State == "OPEN") {
+				t.Errorf("%s: %s openedAt = %v in state %s", step.name, status.URL, status.OpenedAt, status.State)
+			}
+		}
+	}
+}
+
+func TestCircuitBreakerDisabledByDefault(t *testing.T) {
+	const a, b = "https://a.example", "https://b.example"
+	manager := newTestManager(t, map[string]string{"API_KEYS": "sk-startup", "OPENAI_BASE_URL": a + "," + b})
+	for i := 0; i < 10; i++ {
+		manager.RecordUpstreamResult(b, true)
+	}
+	if selected := selectedUpstreams(manager, 20); !selected[a] || !selected[b] {
+		t.Errorf("selected %v, want both upstreams", selected)
+	}
+	if states := manager.GetCircuitStates(); len(states) != 0 {
+		t.Errorf("GetCircuitStates = %v, want none", states)
+	}
+}
+
+func TestNewCircuitBreakersKeepsExisting(t *testing.T) {
+	openaiConfig := types.OpenAIConfig{BaseURLs: []string{"https://a.example", "https://b.example"}, CircuitFailThreshold: 1, CircuitSuccessThreshold: 1, CircuitOpenTimeout: 30}
+	routing := types.RoutingConfig{Rules: map[string][]string{"gpt-4o": {"https://b.example", "https://c.example"}}}
+	existing := map[string]*circuitbreaker.CircuitBreaker{
+		"https://a.example":   circuitbreaker.New(1, 1, 0),
+		"https://old.example": circuitbreaker.New(1, 1, 0),
+	}
+
+	breakers := newCircuitBreakers(openaiConfig, routing, existing)
+	if len(breakers) != 3 {
+		t.Errorf("%d breakers, want one each for a, b and c", len(breakers))
+	}
+	if breakers["https://a.example"] != existing["https://a.example"] {
+		t.Error("breaker of a still configured upstream was replaced")
+	}
+	for _, baseURL := range []string{"https://b.example", "https://c.example"} {
+		if breakers[baseURL] == nil {
+			t.Errorf("no breaker for %s", baseURL)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+
+	"gpt-load/internal/errors"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// mergeConfigFile layers a YAML or TOML config file between the defaults and the
+// environment: a setting comes from an environment variable when one is set, else
+// from the file, else its default. File keys follow the Config JSON tags, so
+// settings tagged json:"-" (secrets) can only come from the environment.
+func mergeConfigFile(envConfig *Config, path string) (*Config, error) {
+	values, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode through JSON so file keys match the JSON tags
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		return nil, errors.NewAppErrorWithCause(errors.ErrConfigInvalid, "Invalid config file", err)
+	}
+	var probeErrors []string
+	return mergeConfigJSON(loadConfig(func(string) string { return "" }, &probeErrors), envConfig, encoded, "Invalid config file")
+}
+
+// mergeConfigStdin layers the JSON configuration read from stdin over base, which
+// holds the defaults or the config file settings, with the environment still winning
+func mergeConfigStdin(base, envConfig *Config) (*Config, error) {
+	data, err := readStdinConfig()
+	if err != nil {
+		return nil, err
+	}
+	return mergeConfigJSON(base, envConfig, data, "Invalid stdin configuration")
+}
+
+// Stdin can only be read once, reloads reuse what was read at startup
+var (
+	stdin           io.Reader = os.Stdin // Replaced by tests
+	stdinConfigOnce sync.Once
+	stdinConfig     []byte
+	stdinConfigErr  error
+)
+
+// readStdinConfig reads the JSON configuration from stdin, refusing to wait on a terminal
+func readStdinConfig() ([]byte, error) {
+	stdinConfigOnce.Do(func() {
+		if file, ok := stdin.(*os.File); ok {
+			if info, err := file.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+				stdinConfigErr = errors.NewAppError(errors.ErrConfigInvalid, "Configuration from stdin requested but stdin is a terminal, pipe the JSON configuration in")
+				return
+			}
+		}
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			stdinConfigErr = errors.NewAppErrorWithCause(errors.ErrConfigInvalid, "Failed to read configuration from stdin", err)
+			return
+		}
+		stdinConfig = data
+	})
+	return stdinConfig, stdinConfigErr
+}
+
+// mergeConfigJSON decodes JSON settings over base, rejecting unknown keys, then
+// restores every setting controlled by a set environment variable from envConfig
+func mergeConfigJSON(base, envConfig *Config, data []byte, invalidMessage string) (*Config, error) {
+	merged := base
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(merged); err != nil {
+		return nil, errors.NewAppErrorWithDetails(errors.ErrConfigInvalid, invalidMessage, err.Error())
+	}
+	// A single JSON object, nothing may follow it
+	if decoder.More() {
+		return nil, errors.NewAppErrorWithDetails(errors.ErrConfigInvalid, invalidMessage, "unexpected data after the JSON object")
+	}
+
+	// Environment variables win over the file for every setting they control
+	mergedValue := reflect.ValueOf(merged).Elem()
+	envValue := reflect.ValueOf(envConfig).Elem()
+	for _, field := range envControlledFields() {
+		mergedValue.FieldByIndex(field).Set(envValue.FieldByIndex(field))
+	}
+
+	// A token source set outside the environment enables authentication as it does there
+	if len(merged.Auth.Keys) > 0 || merged.Auth.JWKSURL != "" {
+		merged.Auth.Enabled = true
+	}
+	return merged, nil
+}
+
+// readConfigFile decodes a config file, choosing the format by extension
+func readConfigFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.NewAppErrorWithCause(errors.ErrConfigInvalid, "Failed to read config file", err)
+	}
+
+	values := make(map[string]any)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	default:
+		return nil, errors.NewAppErrorWithDetails(errors.ErrConfigInvalid, "Unsupported config file format, use .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, errors.NewAppErrorWithCause(errors.ErrConfigInvalid, "Invalid config file", err)
+	}
+	return values, nil
+}
+
+// envControlledFields returns the indexes of the settings controlled by an environment
+// variable that is currently set. A variable controls the settings that change when it
+// is unset or set to "0" or "1", which also catches values that equal their default.
+func envControlledFields() [][]int {
+	// Find the variables the configuration reads that are set
+	var probeErrors []string
+	set := make(map[string]bool)
+	loadConfig(func(key string) string {
+		value := os.Getenv(key)
+		if value != "" {
+			set[key] = true
+		}
+		return value
+	}, &probeErrors)
+
+	controlled := make(map[[2]int]bool)
+	for key := range set {
+		probes := make([]reflect.Value, 0, 3)
+		for _, probe := range []string{"", "0", "1"} {
+			config := loadConfig(func(name string) string {
+				if name == key {
+					return probe
+				}
+				return os.Getenv(name)
+			}, &probeErrors)
+			probes = append(probes, reflect.ValueOf(config).Elem())
+		}
+
+		// Compare each setting of each section across the probes
+		for section := 0; section < probes[0].NumField(); section++ {
+			for setting := 0; setting < probes[0].Field(section).NumField(); setting++ {
+				first := probes[0].Field(section).Field(setting).Interface()
+				for _, probe := range probes[1:] {
+					if !reflect.DeepEqual(first, probe.Field(section).Field(setting).Interface()) {
+						controlled[[2]int{section, setting}] = true
+						break
+					}
+				}
+			}
+		}
+	}
+
+	fields := make([][]int, 0, len(controlled))
+	for index := range controlled {
+		fields = append(fields, []int{index[0], index[1]})
+	}
+	return fields
+}
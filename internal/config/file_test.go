@@ -0,0 +1,275 @@
+package config
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// writeConfigFile writes a config file named name and points CONFIG_FILE at it
+func writeConfigFile(t *testing.T, name, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+}
+
+// pipeStdin feeds content to the stdin configuration through a pipe and enables it
+func pipeStdin(t *testing.T, content string) {
+	t.Helper()
+	reader, writer := io.Pipe()
+	go func() {
+		writer.Write([]byte(content))
+		writer.Close()
+	}()
+	setStdin(t, reader)
+	t.Setenv("CONFIG_FROM_STDIN", "true")
+}
+
+// setStdin replaces stdin until the test ends, forgetting what was read before
+func setStdin(t *testing.T, r io.Reader) {
+	t.Helper()
+	previous := stdin
+	stdin, stdinConfigOnce, stdinConfig, stdinConfigErr = r, sync.Once{}, nil, nil
+	t.Cleanup(func() {
+		stdin, stdinConfigOnce, stdinConfig, stdinConfigErr = previous, sync.Once{}, nil, nil
+	})
+}
+
+func TestConfigFilePrecedence(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": "server:\n  port: 9000\nkeys:\n  maxRetries: 5\nauth:\n  keys: [file-client]\n",
+		"config.toml": "[server]\nport = 9000\n[keys]\nmaxRetries = 5\n[auth]\nkeys = [\"file-client\"]\n",
+	}
+	tests := []struct {
+		name        string
+		env         map[string]string
+		wantPort    int
+		wantRetries int
+		wantAuth    []string
+	}{
+		{name: "file over defaults", wantPort: 9000, wantRetries: 5, wantAuth: []string{"file-client"}},
+		{name: "env over file", env: map[string]string{"PORT": "8000", "AUTH_KEYS": "env-client"}, wantPort: 8000, wantRetries: 5, wantAuth: []string{"env-client"}},
+		{name: "env equal to the default", env: map[string]string{"PORT": "7860"}, wantPort: 7860, wantRetries: 5, wantAuth: []string{"file-client"}},
+		{name: "env set to zero", env: map[string]string{"MAX_RETRIES": "0"}, wantPort: 9000, wantRetries: 0, wantAuth: []string{"file-client"}},
+		{name: "empty env ignored", env: map[string]string{"PORT": ""}, wantPort: 9000, wantRetries: 5, wantAuth: []string{"file-client"}},
+	}
+	for name, content := range files {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				writeConfigFile(t, name, content)
+				t.Setenv("API_KEYS", "sk-startup")
+				for key, value := range tt.env {
+					t.Setenv(key, value)
+				}
+				config, _, err := buildConfig()
+				if err != nil {
+					t.Fatalf("buildConfig: %v", err)
+				}
+				if config.Server.Port != tt.wantPort {
+					t.Errorf("port = %d, want %d", config.Server.Port, tt.wantPort)
+				}
+				if config.Keys.MaxRetries != tt.wantRetries {
+					t.Errorf("max retries = %d, want %d", config.Keys.MaxRetries, tt.wantRetries)
+				}
+				if !slices.Equal(config.Auth.Keys, tt.wantAuth) || !config.Auth.Enabled {
+					t.Errorf("auth keys = %v enabled %v, want %v enabled", config.Auth.Keys, config.Auth.Enabled, tt.wantAuth)
+				}
+				// Settings absent from both keep their default
+				if config.Server.Host != "0.0.0.0" {
+					t.Errorf("host = %q, want the default", config.Server.Host)
+				}
+			})
+		}
+	}
+}
+
+func TestConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		missing bool
+		wantErr string
+	}{
+		{name: "unknown key", file: "config.yaml", content: "server:\n  prot: 9000\n", wantErr: "Invalid config file"},
+		{name: "secret from the file", file: "config.yaml", content: "keys:\n  KeyFetchURL: https://keys.example\n", wantErr: "Invalid config file"},
+		{name: "wrong type", file: "config.toml", content: "[server]\nport = \"high\"\n", wantErr: "Invalid config file"},
+		{name: "malformed yaml", file: "config.yml", content: "server: [\n", wantErr: "Invalid config file"},
+		{name: "malformed toml", file: "config.toml", content: "[server\n", wantErr: "Invalid config file"},
+		{name: "unsupported format", file: "config.json", content: "{}", wantErr: "Unsupported config file format"},
+		{name: "missing file", file: "config.yaml", missing: true, wantErr: "Failed to read config file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("API_KEYS", "sk-startup")
+			if tt.missing {
+				t.Setenv("CONFIG_FILE", filepath.Join(t.TempDir(), tt.file))
+			} else {
+				writeConfigFile(t, tt.file, tt.content)
+			}
+			if _, _, err := buildConfig(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("buildConfig error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateConfigFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "valid", content: "server:\n  port: 9000\n"},
+		{name: "invalid file setting", content: "server:\n  port: 70000\n", wantErr: "port"},
+		{name: "env fixes an invalid file setting", content: "server:\n  port: 70000\n", env: map[string]string{"PORT": "9000"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeConfigFile(t, "config.yaml", tt.content)
+			checkValidation(t, tt.env, tt.wantErr)
+		})
+	}
+}
+
+func TestConfigStdin(t *testing.T) {
+	const content = `{"server":{"port":9000},"keys":{"maxRetries":5},"auth":{"keys":["stdin-client"]}}`
+	tests := []struct {
+		name        string
+		file        string
+		env         map[string]string
+		wantPort    int
+		wantRetries int
+		wantHost    string
+		wantAuth    []string
+	}{
+		{name: "stdin over defaults", wantPort: 9000, wantRetries: 5, wantHost: "0.0.0.0", wantAuth: []string{"stdin-client"}},
+		{name: "env over stdin", env: map[string]string{"PORT": "8000", "AUTH_KEYS": "env-client"}, wantPort: 8000, wantRetries: 5, wantHost: "0.0.0.0", wantAuth: []string{"env-client"}},
+		{name: "env set to zero", env: map[string]string{"MAX_RETRIES": "0"}, wantPort: 9000, wantRetries: 0, wantHost: "0.0.0.0", wantAuth: []string{"stdin-client"}},
+		{
+			name:     "stdin over the config file",
+			file:     "server:\n  port: 9100\n  host: 127.0.0.1\nkeys:\n  maxRetries: 4\n",
+			wantPort: 9000, wantRetries: 5, wantHost: "127.0.0.1", wantAuth: []string{"stdin-client"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("API_KEYS", "sk-startup")
+			if tt.file != "" {
+				writeConfigFile(t, "config.yaml", tt.file)
+			}
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			pipeStdin(t, content)
+
+			config, _, err := buildConfig()
+			if err != nil {
+				t.Fatalf("buildConfig: %v", err)
+			}
+			if config.Server.Port != tt.wantPort || config.Server.Host != tt.wantHost {
+				t.Errorf("listen on %s:%d, want %s:%d", config.Server.Host, config.Server.Port, tt.wantHost, tt.wantPort)
+			}
+			if config.Keys.MaxRetries != tt.wantRetries {
+				t.Errorf("max retries = %d, want %d", config.Keys.MaxRetries, tt.wantRetries)
+			}
+			if !slices.Equal(config.Auth.Keys, tt.wantAuth) || !config.Auth.Enabled {
+				t.Errorf("auth keys = %v enabled %v, want %v enabled", config.Auth.Keys, config.Auth.Enabled, tt.wantAuth)
+			}
+			if !slices.Equal(config.Keys.APIKeys, []string{"sk-startup"}) {
+				t.Errorf("API keys = %v, want the environment's", config.Keys.APIKeys)
+			}
+
+			// A reload reads the same configuration, stdin being consumed
+			reloaded, _, err := buildConfig()
+			if err != nil {
+				t.Fatalf("rebuild: %v", err)
+			}
+			if reloaded.Server.Port != tt.wantPort {
+				t.Errorf("rebuilt port = %d, want %d", reloaded.Server.Port, tt.wantPort)
+			}
+		})
+	}
+}
+
+func TestConfigStdinDisabled(t *testing.T) {
+	t.Setenv("API_KEYS", "sk-startup")
+	reader, writer := io.Pipe()
+	defer writer.Close()
+	// Nothing is written, reading stdin would block
+	setStdin(t, reader)
+
+	config, _, err := buildConfig()
+	if err != nil {
+		t.Fatalf("buildConfig: %v", err)
+	}
+	if config.Server.Port != 7860 {
+		t.Errorf("port = %d, want the default", config.Server.Port)
+	}
+}
+
+func TestConfigStdinErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "unknown key", content: `{"server":{"prot":9000}}`, wantErr: "Invalid stdin configuration"},
+		{name: "wrong type", content: `{"server":{"port":"high"}}`, wantErr: "Invalid stdin configuration"},
+		{name: "malformed", content: `{"server":`, wantErr: "Invalid stdin configuration"},
+		{name: "empty", wantErr: "Invalid stdin configuration"},
+		{name: "data after the object", content: `{"server":{"port":9000}} {"keys":{}}`, wantErr: "unexpected data after the JSON object"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("API_KEYS", "sk-startup")
+			pipeStdin(t, tt.content)
+			if _, _, err := buildConfig(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("buildConfig error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigStdinTerminal(t *testing.T) {
+	// A character device, like a terminal, is refused instead of waited on
+	device, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Skipf("open %s: %v", os.DevNull, err)
+	}
+	defer device.Close()
+	t.Setenv("API_KEYS", "sk-startup")
+	t.Setenv("CONFIG_FROM_STDIN", "true")
+	setStdin(t, device)
+
+	if _, _, err := buildConfig(); err == nil || !strings.Contains(err.Error(), "stdin is a terminal") {
+		t.Errorf("buildConfig error = %v, want stdin refused", err)
+	}
+}
+
+func TestValidateConfigStdin(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "valid", content: `{"server":{"port":9000}}`},
+		{name: "invalid stdin setting", content: `{"server":{"port":70000}}`, wantErr: "port"},
+		{name: "env fixes an invalid stdin setting", content: `{"server":{"port":70000}}`, env: map[string]string{"PORT": "9000"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipeStdin(t, tt.content)
+			checkValidation(t, tt.env, tt.wantErr)
+		})
+	}
+}
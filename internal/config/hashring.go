@@ -0,0 +1,88 @@
+package config
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// ConsistentHashRing maps callers to upstream URLs so that adding or removing
+// an upstream only moves the callers assigned to it
+type ConsistentHashRing struct {
+	replicas int
+	ring     map[uint32]string
+	points   []uint32 // Sorted ring positions
+	mu       sync.RWMutex
+}
+
+// NewConsistentHashRing creates a ring with the given virtual nodes per upstream
+func NewConsistentHashRing(urls []string, replicas int) *ConsistentHashRing {
+	r := &ConsistentHashRing{
+		replicas: replicas,
+		ring:     make(map[uint32]string),
+	}
+	for _, url := range urls {
+		r.Add(url)
+	}
+	return r
+}
+
+// Add places an upstream's virtual nodes on the ring
+func (r *ConsistentHashRing) Add(url string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := 0; i < r.replicas; i++ {
+		r.ring[hashKey(url+"#"+strconv.Itoa(i))] = url
+	}
+	r.rebuild()
+}
+
+// Remove takes an upstream off the ring, its callers move to the next upstream
+func (r *ConsistentHashRing) Remove(url string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for point, owner := range r.ring {
+		if owner == url {
+			delete(r.ring, point)
+		}
+	}
+	r.rebuild()
+}
+
+// Get returns the upstream at the first ring position >= hash(callerID)
+func (r *ConsistentHashRing) Get(callerID string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.points) == 0 {
+		return ""
+	}
+
+	hash := hashKey(callerID)
+	index := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i] >= hash
+	})
+	if index == len(r.points) {
+		index = 0 // Wrap around
+	}
+	return r.ring[r.points[index]]
+}
+
+// rebuild refreshes the sorted ring positions, must be called with mu held
+func (r *ConsistentHashRing) rebuild() {
+	r.points = make([]uint32, 0, len(r.ring))
+	for point := range r.ring {
+		r.points = append(r.points, point)
+	}
+	sort.Slice(r.points, func(i, j int) bool {
+		return r.points[i] < r.points[j]
+	})
+}
+
+// hashKey hashes a ring key with CRC32
+func hashKey(key string) uint32 {
+	return crc32.ChecksumIEEE([]byte(key))
+}
@@ -0,0 +1,152 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// ringUpstreams returns n upstream URLs, named differently for each set
+func ringUpstreams(set, n int) []string {
+	urls := make([]string, n)
+	for i := range urls {
+		urls[i] = fmt.Sprintf("https://upstream-%d-%d.example.com", set, i)
+	}
+	return urls
+}
+
+// assignments routes callers through ring
+func assignments(ring *ConsistentHashRing, callers int) []string {
+	routed := make([]string, callers)
+	for i := range routed {
+		routed[i] = ring.Get(fmt.Sprintf("caller-%d", i))
+	}
+	return routed
+}
+
+func TestConsistentHashRingRebalancing(t *testing.T) {
+	const (
+		callers = 2000
+		sets    = 50
+	)
+	tests := []struct {
+		name   string
+		before int
+		add    bool
+	}{
+		{name: "add to 2", before: 2, add: true},
+		{name: "add to 4", before: 4, add: true},
+		{name: "add to 9", before: 9, add: true},
+		{name: "remove from 3", before: 3},
+		{name: "remove from 5", before: 5},
+		{name: "remove from 10", before: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The upstream joining or leaving owns 1/N of the ring, N counting it
+			n := tt.before
+			if tt.add {
+				n++
+			}
+
+			total := 0
+			for set := 0; set < sets; set++ {
+				urls := ringUpstreams(set, tt.before)
+				ring := NewConsistentHashRing(urls, 100)
+				before := assignments(ring, callers)
+				changed := urls[set%len(urls)]
+				if tt.add {
+					changed = fmt.Sprintf("https://new-%d.example.com", set)
+					ring.Add(changed)
+				} else {
+					ring.Remove(changed)
+				}
+				after := assignments(ring, callers)
+
+				for i := range before {
+					if before[i] == after[i] {
+						continue
+					}
+					total++
+					// Callers only move to a new upstream, or away from a removed one
+					if (tt.add && after[i] != changed) || (!tt.add && before[i] != changed) {
+						t.Fatalf("caller-%d moved from %s to %s", i, before[i], after[i])
+					}
+				}
+			}
+
+			// Allow 10% for the spread of 100 virtual nodes
+			average := float64(total) / float64(sets*callers)
+			if limit := 1.1 / float64(n); average > limit {
+				t.Errorf("%.3f of callers moved on average, want at most 1/%d", average, n)
+			}
+		})
+	}
+}
+
+func TestConsistentHashRingRemoveMovesOnlyItsCallers(t *testing.T) {
+	urls := ringUpstreams(0, 4)
+	ring := NewConsistentHashRing(urls, 100)
+	before := assignments(ring, 1000)
+	ring.Remove(urls[2])
+	after := assignments(ring, 1000)
+
+	for i := range before {
+		switch {
+		case after[i] == urls[2]:
+			t.Fatalf("caller-%d still routed to the removed upstream", i)
+		case before[i] != urls[2] && after[i] != before[i]:
+			t.Fatalf("caller-%d moved from %s to %s", i, before[i], after[i])
+		}
+	}
+}
+
+func TestConsistentHashRingGet(t *testing.T) {
+	tests := []struct {
+		name  string
+		urls  []string
+		empty bool
+	}{
+		{name: "empty ring", empty: true},
+		{name: "single upstream", urls: ringUpstreams(0, 1)},
+		{name: "several upstreams", urls: ringUpstreams(0, 3)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ring := NewConsistentHashRing(tt.urls, 100)
+			first := ring.Get("caller")
+			if (first == "") != tt.empty {
+				t.Fatalf("Get = %q, want empty %v", first, tt.empty)
+			}
+			for i := 0; i < 10; i++ {
+				if got := ring.Get("caller"); got != first {
+					t.Fatalf("Get = %q, later %q, want stable routing", first, got)
+				}
+			}
+		})
+	}
+}
+
+func TestGetUpstreamForCallerIsSticky(t *testing.T) {
+	urls := ringUpstreams(0, 3)
+	manager := newTestManager(t, map[string]string{
+		"API_KEYS":              "sk-startup",
+		"OPENAI_BASE_URL":       strings.Join(urls, ","),
+		"LOAD_BALANCE_STRATEGY": LoadBalanceConsistentHash,
+	})
+
+	seen := make(map[string]bool)
+	for i := 0; i < 300; i++ {
+		callerID := fmt.Sprintf("caller-%d", i)
+		first := manager.GetUpstreamForCaller(callerID, "")
+		for j := 0; j < 3; j++ {
+			if got := manager.GetUpstreamForCaller(callerID, ""); got != first {
+				t.Fatalf("%s routed to %s, then %s", callerID, first, got)
+			}
+		}
+		seen[first] = true
+	}
+	if len(seen) != len(urls) {
+		t.Errorf("callers reached %d of %d upstreams", len(seen), len(urls))
+	}
+}
@@ -0,0 +1,181 @@
+package config
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"gpt-load/internal/metrics"
+	"gpt-load/pkg/types"
+
+	"github.com/sirupsen/logrus"
+)
+
+// upstreamHealthState tracks consecutive check results of one upstream
+type upstreamHealthState struct {
+	failures  int
+	successes int
+	degraded  bool
+}
+
+// upstreamHealthChecker periodically probes every upstream and publishes the
+// set of degraded upstreams to the Manager. It only runs on the scheduler's
+// goroutine for its task, so its state needs no locking.
+type upstreamHealthChecker struct {
+	manager          *Manager
+	client           *http.Client
+	path             string
+	failThreshold    int
+	recoverThreshold int
+	states           map[string]*upstreamHealthState
+}
+
+// startHealthChecks registers the upstream health check task with the scheduler
+func (m *Manager) startHealthChecks() error {
+	openaiConfig := m.current().OpenAI
+	checker := &upstreamHealthChecker{
+		manager:          m,
+		client:           &http.Client{Timeout: 5 * time.Second},
+		path:             openaiConfig.HealthCheckPath,
+		failThreshold:    openaiConfig.HealthCheckFailThreshold,
+		recoverThreshold: openaiConfig.HealthCheckRecoverThreshold,
+		states:           make(map[string]*upstreamHealthState),
+	}
+
+	interval := time.Duration(openaiConfig.HealthCheckInterval) * time.Second
+	return m.scheduler.AddTask("upstream-health-check", interval, checker.run)
+}
+
+// run checks all upstreams once and updates the degraded set
+func (hc *upstreamHealthChecker) run(ctx context.Context) {
+	baseURLs := hc.manager.GetOpenAIConfig().BaseURLs
+
+	healthy := make([]bool, len(baseURLs))
+	var wg sync.WaitGroup
+	for i, baseURL := range baseURLs {
+		wg.Add(1)
+		go func(i int, baseURL string) {
+			defer wg.Done()
+			healthy[i] = hc.check(ctx, baseURL)
+		}(i, baseURL)
+	}
+	wg.Wait()
+
+	// Skip publishing a result cut short by shutdown
+	if ctx.Err() != nil {
+		return
+	}
+
+	degraded := make(map[string]bool)
+	for i, baseURL := range baseURLs {
+		state, exists := hc.states[baseURL]
+		if !exists {
+			state = &upstreamHealthState{}
+			hc.states[baseURL] = state
+		}
+
+		if healthy[i] {
+			state.failures = 0
+			state.successes++
+			if state.degraded && state.successes >= hc.recoverThreshold {
+				state.degraded = false
+				logrus.Infof("Upstream %s recovered after %d successful health checks", baseURL, state.successes)
+			}
+		} else {
+			state.successes = 0
+			state.failures++
+			if !state.degraded && state.failures >= hc.failThreshold {
+				state.degraded = true
+				logrus.Warnf("Upstream %s marked degraded after %d failed health checks, skipping it", baseURL, state.failures)
+			}
+		}
+
+		if state.degraded {
+			degraded[baseURL] = true
+			metrics.UpstreamHealth.WithLabelValues(baseURL).Set(0)
+		} else {
+			metrics.UpstreamHealth.WithLabelValues(baseURL).Set(1)
+		}
+	}
+
+	if len(degraded) > 0 && len(degraded) == len(baseURLs) {
+		logrus.Errorf("All %d upstreams are degraded, falling back to full rotation", len(baseURLs))
+	}
+	hc.manager.degradedUpstreams.Store(&degraded)
+}
+
+// check sends one health check request, any response below 500 counts as healthy
+func (hc *upstreamHealthChecker) check(ctx context.Context, baseURL string) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(baseURL, "/")+hc.path, nil)
+	if err != nil {
+		return false
+	}
+
+	resp, err := hc.client.Do(req)
+	if err != nil {
+		logrus.Debugf("Health check of %s failed: %v", baseURL, err)
+		return false
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		logrus.Debugf("Health check of %s returned HTTP %d", baseURL, resp.StatusCode)
+		return false
+	}
+	return true
+}
+
+// isDegraded reports whether the health checks currently mark an upstream as
+// degraded or its circuit is open
+func (m *Manager) isDegraded(baseURL string) bool {
+	degraded := m.degradedUpstreams.Load()
+	if degraded != nil && (*degraded)[baseURL] {
+		return true
+	}
+	return m.isCircuitOpen(baseURL)
+}
+
+// skipDegraded returns the first upstream at or after index in candidates that is not
+// degraded, or the upstream at index when all of them are
+func (m *Manager) skipDegraded(candidates []string, index uint64) string {
+	selected := candidates[index%uint64(len(candidates))]
+	if !m.isDegraded(selected) {
+		return selected
+	}
+
+	for offset := uint64(1); offset < uint64(len(candidates)); offset++ {
+		if candidate := candidates[(index+offset)%uint64(len(candidates))]; !m.isDegraded(candidate) {
+			logrus.Debugf("Skipping degraded upstream %s", selected)
+			return candidate
+		}
+	}
+	return selected
+}
+
+// GetUpstreamHealth returns the health check and circuit breaker state of every upstream
+func (m *Manager) GetUpstreamHealth() []types.UpstreamHealth {
+	circuits := make(map[string]string)
+	for _, circuit := range m.GetCircuitStates() {
+		circuits[circuit.URL] = circuit.State
+	}
+	degraded := m.degradedUpstreams.Load()
+	m.mu.RLock()
+	latencies := m.latencies
+	m.mu.RUnlock()
+
+	baseURLs := m.GetOpenAIConfig().BaseURLs
+	upstreams := make([]types.UpstreamHealth, 0, len(baseURLs))
+	for _, baseURL := range baseURLs {
+		upstream := types.UpstreamHealth{
+			URL:      baseURL,
+			Degraded: degraded != nil && (*degraded)[baseURL],
+			Circuit:  circuits[baseURL],
+		}
+		upstream.Healthy = !upstream.Degraded && !m.isCircuitOpen(baseURL)
+		upstream.LatencyEMAMs = float64(latencies.load(baseURL)) / float64(time.Millisecond)
+		upstreams = append(upstreams, upstream)
+	}
+	return upstreams
+}
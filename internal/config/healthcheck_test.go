@@ -0,0 +1,126 @@
+package config
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"gpt-load/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// switchableUpstream serves its health path with a status that can be changed
+type switchableUpstream struct {
+	*httptest.Server
+	status atomic.Int32
+}
+
+func newSwitchableUpstream(t *testing.T) *switchableUpstream {
+	t.Helper()
+	upstream := &switchableUpstream{}
+	upstream.status.Store(http.StatusOK)
+	upstream.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(int(upstream.status.Load()))
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream
+}
+
+// newTestHealthChecker returns the checker startHealthChecks would register
+func newTestHealthChecker(m *Manager) *upstreamHealthChecker {
+	openaiConfig := m.current().OpenAI
+	return &upstreamHealthChecker{
+		manager:          m,
+		client:           http.DefaultClient,
+		path:             openaiConfig.HealthCheckPath,
+		failThreshold:    openaiConfig.HealthCheckFailThreshold,
+		recoverThreshold: openaiConfig.HealthCheckRecoverThreshold,
+		states:           make(map[string]*upstreamHealthState),
+	}
+}
+
+func TestUpstreamHealthChecks(t *testing.T) {
+	a, b := newSwitchableUpstream(t), newSwitchableUpstream(t)
+	manager := newTestManager(t, map[string]string{
+		"API_KEYS":                       "sk-startup",
+		"OPENAI_BASE_URL":                a.URL + "," + b.URL,
+		"HEALTH_CHECK_PATH":              "/healthz",
+		"HEALTH_CHECK_FAIL_THRESHOLD":    "2",
+		"HEALTH_CHECK_RECOVER_THRESHOLD": "2",
+	})
+	checker := newTestHealthChecker(manager)
+
+	// Each step runs one round of checks with the given statuses
+	steps := []struct {
+		name      string
+		statusA   int32
+		statusB   int32
+		degradedA bool
+		degradedB bool
+	}{
+		{name: "both healthy", statusA: 200, statusB: 200},
+		{name: "b fails once", statusA: 200, statusB: 503},
+		{name: "b fails twice", statusA: 200, statusB: 503, degradedB: true},
+		{name: "client errors are healthy", statusA: 404, statusB: 503, degradedB: true},
+		{name: "b recovers once", statusA: 200, statusB: 200, degradedB: true},
+		{name: "b recovers twice", statusA: 200, statusB: 200},
+		{name: "a fails once", statusA: 500, statusB: 200},
+		{name: "both failing", statusA: 500, statusB: 500, degradedA: true},
+		{name: "both degraded", statusA: 500, statusB: 500, degradedA: true, degradedB: true},
+	}
+	for _, step := range steps {
+		a.status.Store(step.statusA)
+		b.status.Store(step.statusB)
+		checker.run(context.Background())
+
+		if got := manager.isDegraded(a.URL); got != step.degradedA {
+			t.Fatalf("%s: a degraded = %v, want %v", step.name, got, step.degradedA)
+		}
+		if got := manager.isDegraded(b.URL); got != step.degradedB {
+			t.Fatalf("%s: b degraded = %v, want %v", step.name, got, step.degradedB)
+		}
+		for baseURL, degraded := range map[string]bool{a.URL: step.degradedA, b.URL: step.degradedB} {
+			want := 1.0
+			if degraded {
+				want = 0
+			}
+			if gauge := testutil.ToFloat64(metrics.UpstreamHealth.WithLabelValues(baseURL)); gauge != want {
+				t.Fatalf("%s: gptload_upstream_health{url=%q} = %v, want %v", step.name, baseURL, gauge, want)
+			}
+		}
+
+		// Degraded upstreams are skipped, unless all of them are
+		counts := make(map[string]int)
+		for i := 0; i < 10; i++ {
+			counts[manager.GetOpenAIConfig().BaseURL]++
+		}
+		allDegraded := step.degradedA && step.degradedB
+		if (counts[a.URL] == 0) != (step.degradedA && !allDegraded) || (counts[b.URL] == 0) != (step.degradedB && !allDegraded) {
+			t.Fatalf("%s: selections %v", step.name, counts)
+		}
+	}
+}
+
+func TestUpstreamHealthCheckUnreachable(t *testing.T) {
+	a := newSwitchableUpstream(t)
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+	manager := newTestManager(t, map[string]string{
+		"API_KEYS":                    "sk-startup",
+		"OPENAI_BASE_URL":             a.URL + "," + unreachable.URL,
+		"HEALTH_CHECK_PATH":           "/healthz",
+		"HEALTH_CHECK_FAIL_THRESHOLD": "1",
+	})
+	newTestHealthChecker(manager).run(context.Background())
+
+	if !manager.isDegraded(unreachable.URL) || manager.isDegraded(a.URL) {
+		t.Errorf("health = %+v, want only the unreachable upstream degraded", manager.GetUpstreamHealth())
+	}
+}
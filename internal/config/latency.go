@@ -0,0 +1,125 @@
+package config
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// latencyEMAAlpha is the weight of the newest sample in the moving average
+const latencyEMAAlpha = 0.2
+
+// slaPenaltyWeight is the share of its normal picks an upstream keeps while its
+// average latency is above UPSTREAM_SLA_THRESHOLD_MS
+const slaPenaltyWeight = 0.1
+
+// latencyAverages tracks an exponential moving average of the response latency of
+// each upstream. Slots are fixed while the upstreams stay the same, so a reload
+// that only changes the SLA threshold keeps the averages.
+type latencyAverages struct {
+	slots        map[string]int // Upstream URL -> index into ema, never modified after creation
+	ema          []atomic.Int64 // Nanoseconds, 0 until the first sample
+	slaThreshold time.Duration  // Upstreams slower than this are deprioritised, 0 disables it
+}
+
+// newLatencyAverages creates averages with one slot per upstream
+func newLatencyAverages(baseURLs []string, slaThreshold time.Duration) *latencyAverages {
+	averages := &latencyAverages{
+		slots:        make(map[string]int, len(baseURLs)),
+		ema:          make([]atomic.Int64, len(baseURLs)),
+		slaThreshold: slaThreshold,
+	}
+	for i, baseURL := range baseURLs {
+		averages.slots[baseURL] = i
+	}
+	return averages
+}
+
+// withThreshold returns averages sharing the same slots with another SLA threshold
+func (la *latencyAverages) withThreshold(slaThreshold time.Duration) *latencyAverages {
+	return &latencyAverages{slots: la.slots, ema: la.ema, slaThreshold: slaThreshold}
+}
+
+// record folds a latency sample into the average of an upstream
+func (la *latencyAverages) record(baseURL string, latency time.Duration) {
+	slot, exists := la.slots[baseURL]
+	if !exists {
+		return
+	}
+	// 0 means unmeasured, so the average never drops to it
+	sample := max(int64(latency), 1)
+	for {
+		current := la.ema[slot].Load()
+		next := sample
+		if current > 0 {
+			next = max(current+int64(latencyEMAAlpha*float64(sample-current)), 1)
+		}
+		if la.ema[slot].CompareAndSwap(current, next) {
+			return
+		}
+	}
+}
+
+// load returns the average latency of an upstream, 0 until it was measured
+func (la *latencyAverages) load(baseURL string) time.Duration {
+	slot, exists := la.slots[baseURL]
+	if !exists {
+		return 0
+	}
+	return time.Duration(la.ema[slot].Load())
+}
+
+// RecordUpstreamLatency adds the time an upstream took to return response headers
+// to its moving average
+func (m *Manager) RecordUpstreamLatency(baseURL string, latency time.Duration) {
+	m.mu.RLock()
+	latencies := m.latencies
+	m.mu.RUnlock()
+	latencies.record(baseURL, latency)
+}
+
+// fastest returns the non-degraded upstream with the lowest average latency. Upstreams
+// not measured yet come first, so each gets a sample. The scan starts at index so
+// ties rotate, and falls back to the upstream at index when all of them are degraded.
+func (m *Manager) fastest(latencies *latencyAverages, candidates []string, index uint64) string {
+	best := ""
+	bestLatency := time.Duration(0)
+	for offset := uint64(0); offset < uint64(len(candidates)); offset++ {
+		candidate := candidates[(index+offset)%uint64(len(candidates))]
+		if m.isDegraded(candidate) {
+			continue
+		}
+		if latency := latencies.load(candidate); best == "" || latency < bestLatency {
+			best, bestLatency = candidate, latency
+		}
+	}
+	if best == "" {
+		return candidates[index%uint64(len(candidates))]
+	}
+	return best
+}
+
+// withinSLA deprioritises a selected upstream whose average latency is above the SLA
+// threshold. It keeps slaPenaltyWeight of its picks, the others go to the next
+// candidate within the threshold, if there is one.
+func (m *Manager) withinSLA(latencies *latencyAverages, candidates []string, selected string) string {
+	threshold := latencies.slaThreshold
+	if threshold <= 0 || len(candidates) < 2 || latencies.load(selected) <= threshold || rand.Float64() < slaPenaltyWeight {
+		return selected
+	}
+
+	start := 0
+	for i, candidate := range candidates {
+		if candidate == selected {
+			start = i
+			break
+		}
+	}
+	for offset := 1; offset < len(candidates); offset++ {
+		candidate := candidates[(start+offset)%len(candidates)]
+		if !m.isDegraded(candidate) && latencies.load(candidate) <= threshold {
+			return candidate
+		}
+	}
+	return selected
+}
@@ -0,0 +1,192 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+// newLatencyManager returns a manager over a and b with strategy and SLA threshold
+func newLatencyManager(t *testing.T, strategy, slaThresholdMs string) *Manager {
+	t.Helper()
+	return newTestManager(t, map[string]string{
+		"API_KEYS":                  "sk-startup",
+		"OPENAI_BASE_URL":           upstreamA + "," + upstreamB,
+		"LOAD_BALANCE_STRATEGY":     strategy,
+		"UPSTREAM_SLA_THRESHOLD_MS": slaThresholdMs,
+	})
+}
+
+// pickCounts counts the upstream of n selections
+func pickCounts(m *Manager, n int) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		counts[m.GetOpenAIConfig().BaseURL]++
+	}
+	return counts
+}
+
+func TestLatencyAverages(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []time.Duration
+		want    time.Duration
+	}{
+		{name: "unmeasured", want: 0},
+		{name: "first sample taken as is", samples: []time.Duration{100 * time.Millisecond}, want: 100 * time.Millisecond},
+		{name: "newest sample weighs a fifth", samples: []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}, want: 120 * time.Millisecond},
+		{name: "slowing down", samples: []time.Duration{100 * time.Millisecond, 600 * time.Millisecond, 600 * time.Millisecond}, want: 280 * time.Millisecond},
+		{name: "speeding up", samples: []time.Duration{time.Second, 500 * time.Millisecond}, want: 900 * time.Millisecond},
+		{name: "zero stays measured", samples: []time.Duration{0}, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			averages := newLatencyAverages([]string{upstreamA, upstreamB}, 0)
+			for _, sample := range tt.samples {
+				averages.record(upstreamA, sample)
+			}
+			if got := averages.load(upstreamA); got != tt.want {
+				t.Errorf("average = %v, want %v", got, tt.want)
+			}
+			if got := averages.load(upstreamB); got != 0 {
+				t.Errorf("other upstream average = %v, want 0", got)
+			}
+		})
+	}
+
+	// Upstreams outside the pool are ignored
+	averages := newLatencyAverages([]string{upstreamA}, 0)
+	averages.record("https://unknown.example", time.Second)
+	if got := averages.load("https://unknown.example"); got != 0 {
+		t.Errorf("unknown upstream average = %v, want 0", got)
+	}
+}
+
+func TestLeastLatency(t *testing.T) {
+	tests := []struct {
+		name      string
+		latencies map[string]time.Duration
+		degraded  []string
+		want      map[string]int // Picks of 20
+	}{
+		{name: "unmeasured pool rotates", want: map[string]int{upstreamA: 10, upstreamB: 10}},
+		{name: "unmeasured upstream first", latencies: map[string]time.Duration{upstreamA: 10 * time.Millisecond}, want: map[string]int{upstreamB: 20}},
+		{name: "faster upstream wins", latencies: map[string]time.Duration{upstreamA: 300 * time.Millisecond, upstreamB: 50 * time.Millisecond}, want: map[string]int{upstreamB: 20}},
+		{name: "degraded upstream skipped", latencies: map[string]time.Duration{upstreamA: 300 * time.Millisecond, upstreamB: 50 * time.Millisecond}, degraded: []string{upstreamB}, want: map[string]int{upstreamA: 20}},
+		{name: "all degraded rotates", latencies: map[string]time.Duration{upstreamA: 300 * time.Millisecond, upstreamB: 50 * time.Millisecond}, degraded: []string{upstreamA, upstreamB}, want: map[string]int{upstreamA: 10, upstreamB: 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newLatencyManager(t, LoadBalanceLeastLatency, "0")
+			for baseURL, latency := range tt.latencies {
+				manager.RecordUpstreamLatency(baseURL, latency)
+			}
+			degraded := make(map[string]bool)
+			for _, baseURL := range tt.degraded {
+				degraded[baseURL] = true
+			}
+			manager.degradedUpstreams.Store(&degraded)
+
+			counts := pickCounts(manager, 20)
+			if counts[upstreamA] != tt.want[upstreamA] || counts[upstreamB] != tt.want[upstreamB] {
+				t.Errorf("picks = %v, want %v", counts, tt.want)
+			}
+		})
+	}
+}
+
+func TestLeastLatencyFollowsSamples(t *testing.T) {
+	manager := newLatencyManager(t, LoadBalanceLeastLatency, "0")
+	// a answers in 200ms and b in 20ms, until b slows down to 500ms
+	latency := map[string]time.Duration{upstreamA: 200 * time.Millisecond, upstreamB: 20 * time.Millisecond}
+	counts := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		if i == 50 {
+			latency[upstreamB] = 500 * time.Millisecond
+		}
+		baseURL := manager.GetOpenAIConfig().BaseURL
+		counts[baseURL]++
+		manager.RecordUpstreamLatency(baseURL, latency[baseURL])
+	}
+	// b takes every pick but a's first one, then loses them once its average passes a's
+	if counts[upstreamB] < 50 || counts[upstreamA] < 40 {
+		t.Errorf("picks = %v, want b before the slowdown and a after it", counts)
+	}
+
+	if upstreams := manager.GetUpstreamHealth(); upstreams[0].LatencyEMAMs != 200 || upstreams[1].LatencyEMAMs <= 200 {
+		t.Errorf("reported averages = %vms and %vms, want 200ms and above", upstreams[0].LatencyEMAMs, upstreams[1].LatencyEMAMs)
+	}
+}
+
+func TestUpstreamSLAThreshold(t *testing.T) {
+	const picks = 4000
+	tests := []struct {
+		name      string
+		strategy  string
+		threshold string
+		latencies map[string]time.Duration
+		wantA     [2]float64 // Range of a's share of the picks
+	}{
+		{name: "disabled", strategy: LoadBalanceRoundRobin, threshold: "0", latencies: map[string]time.Duration{upstreamA: 3 * time.Second, upstreamB: 100 * time.Millisecond}, wantA: [2]float64{0.5, 0.5}},
+		{name: "both within", strategy: LoadBalanceRoundRobin, threshold: "2000", latencies: map[string]time.Duration{upstreamA: time.Second, upstreamB: 100 * time.Millisecond}, wantA: [2]float64{0.5, 0.5}},
+		// a keeps a tenth of its half, give or take the random draws
+		{name: "slow upstream deprioritised", strategy: LoadBalanceRoundRobin, threshold: "2000", latencies: map[string]time.Duration{upstreamA: 3 * time.Second, upstreamB: 100 * time.Millisecond}, wantA: [2]float64{0.03, 0.07}},
+		{name: "random deprioritised", strategy: LoadBalanceRandom, threshold: "2000", latencies: map[string]time.Duration{upstreamA: 3 * time.Second, upstreamB: 100 * time.Millisecond}, wantA: [2]float64{0.03, 0.07}},
+		{name: "unmeasured counts as within", strategy: LoadBalanceRoundRobin, threshold: "2000", latencies: map[string]time.Duration{upstreamB: 3 * time.Second}, wantA: [2]float64{0.93, 0.97}},
+		{name: "nowhere to go", strategy: LoadBalanceRoundRobin, threshold: "2000", latencies: map[string]time.Duration{upstreamA: 3 * time.Second, upstreamB: 3 * time.Second}, wantA: [2]float64{0.5, 0.5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newLatencyManager(t, tt.strategy, tt.threshold)
+			for baseURL, latency := range tt.latencies {
+				manager.RecordUpstreamLatency(baseURL, latency)
+			}
+			counts := pickCounts(manager, picks)
+			share := float64(counts[upstreamA]) / picks
+			if share < tt.wantA[0] || share > tt.wantA[1] {
+				t.Errorf("a got %.3f of the picks %v, want %.3f to %.3f", share, counts, tt.wantA[0], tt.wantA[1])
+			}
+		})
+	}
+}
+
+func TestReloadLatencyAverages(t *testing.T) {
+	manager := newLatencyManager(t, LoadBalanceLeastLatency, "0")
+	manager.RecordUpstreamLatency(upstreamA, 100*time.Millisecond)
+
+	// A new threshold keeps the averages
+	t.Setenv("UPSTREAM_SLA_THRESHOLD_MS", "50")
+	if err := manager.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if got := manager.latencies.load(upstreamA); got != 100*time.Millisecond {
+		t.Errorf("average after a threshold change = %v, want 100ms", got)
+	}
+	if got := manager.latencies.slaThreshold; got != 50*time.Millisecond {
+		t.Errorf("threshold after reload = %v, want 50ms", got)
+	}
+
+	// New upstreams start unmeasured
+	t.Setenv("OPENAI_BASE_URL", upstreamA+","+upstreamC)
+	if err := manager.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if got := manager.latencies.load(upstreamA); got != 0 {
+		t.Errorf("average after the upstreams changed = %v, want 0", got)
+	}
+}
+
+func TestValidateUpstreamSLAThreshold(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr string
+	}{
+		{value: "0"},
+		{value: "1500"},
+		{value: "-1", wantErr: "upstream SLA threshold cannot be less than 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			checkValidation(t, map[string]string{"UPSTREAM_SLA_THRESHOLD_MS": tt.value}, tt.wantErr)
+		})
+	}
+}
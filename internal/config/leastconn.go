@@ -0,0 +1,79 @@
+package config
+
+import (
+	"sync/atomic"
+)
+
+// connectionCounter tracks in-flight requests per upstream for least-connections balancing.
+// Slots are fixed at startup, so reordering upstreams doesn't move the counters.
+type connectionCounter struct {
+	slots    map[string]int // Upstream URL -> index into inFlight, never modified after startup
+	inFlight []int64
+}
+
+// newConnectionCounter creates a counter with one slot per upstream
+func newConnectionCounter(baseURLs []string) *connectionCounter {
+	counter := &connectionCounter{
+		slots:    make(map[string]int, len(baseURLs)),
+		inFlight: make([]int64, len(baseURLs)),
+	}
+	for i, baseURL := range baseURLs {
+		counter.slots[baseURL] = i
+	}
+	return counter
+}
+
+// load returns the number of requests in flight to an upstream
+func (cc *connectionCounter) load(baseURL string) int64 {
+	slot, exists := cc.slots[baseURL]
+	if !exists {
+		return 0
+	}
+	return atomic.LoadInt64(&cc.inFlight[slot])
+}
+
+// leastLoaded returns the non-degraded upstream with the fewest requests in flight.
+// The scan starts at index so that ties rotate instead of always favouring the first
+// upstream. Falls back to the upstream at index when all of them are degraded.
+func (m *Manager) leastLoaded(connections *connectionCounter, candidates []string, index uint64) string {
+	best := ""
+	bestLoad := int64(0)
+	for offset := uint64(0); offset < uint64(len(candidates)); offset++ {
+		candidate := candidates[(index+offset)%uint64(len(candidates))]
+		if m.isDegraded(candidate) {
+			continue
+		}
+		if load := connections.load(candidate); best == "" || load < bestLoad {
+			best, bestLoad = candidate, load
+		}
+	}
+	if best == "" {
+		return candidates[index%uint64(len(candidates))]
+	}
+	return best
+}
+
+// AcquireUpstream marks a request in flight to an upstream until the returned
+// function is called. Calling it more than once is harmless, and it is a no-op
+// unless least-connections balancing is selected.
+func (m *Manager) AcquireUpstream(baseURL string) func() {
+	m.mu.RLock()
+	connections := m.connections
+	m.mu.RUnlock()
+	if connections == nil {
+		return func() {}
+	}
+	slot, exists := connections.slots[baseURL]
+	if !exists {
+		return func() {}
+	}
+
+	// Release against the same counter even if a reload replaces it meanwhile
+	atomic.AddInt64(&connections.inFlight[slot], 1)
+	var released int32
+	return func() {
+		if atomic.CompareAndSwapInt32(&released, 0, 1) {
+			atomic.AddInt64(&connections.inFlight[slot], -1)
+		}
+	}
+}
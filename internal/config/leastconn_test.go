@@ -0,0 +1,143 @@
+package config
+
+import (
+	"sync"
+	"testing"
+)
+
+const (
+	upstreamA = "https://a.example"
+	upstreamB = "https://b.example"
+	upstreamC = "https://c.example"
+)
+
+// newLeastConnManager returns a manager balancing a, b and c by least connections
+func newLeastConnManager(t testing.TB) *Manager {
+	t.Helper()
+	for key, value := range map[string]string{
+		"API_KEYS":              "sk-startup",
+		"OPENAI_BASE_URL":       upstreamA + "," + upstreamB + "," + upstreamC,
+		"LOAD_BALANCE_STRATEGY": LoadBalanceLeastConnections,
+	} {
+		t.Setenv(key, value)
+	}
+	config, parseErrors, err := buildConfig()
+	if err != nil {
+		t.Fatalf("buildConfig: %v", err)
+	}
+	manager := &Manager{config: config, parseErrors: parseErrors}
+	if err := manager.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	manager.rebuildSelection(nil)
+	return manager
+}
+
+func TestLeastConnections(t *testing.T) {
+	tests := []struct {
+		name     string
+		inFlight map[string]int // Requests held open on each upstream
+		want     []string       // Upstreams the next picks may return
+	}{
+		{name: "idle pool rotates", want: []string{upstreamA, upstreamB, upstreamC}},
+		{name: "busiest skipped", inFlight: map[string]int{upstreamA: 1}, want: []string{upstreamB, upstreamC}},
+		{name: "least loaded wins", inFlight: map[string]int{upstreamA: 2, upstreamB: 1, upstreamC: 3}, want: []string{upstreamB}},
+		{name: "ties rotate", inFlight: map[string]int{upstreamA: 5, upstreamB: 2, upstreamC: 2}, want: []string{upstreamB, upstreamC}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newLeastConnManager(t)
+			for baseURL, n := range tt.inFlight {
+				for i := 0; i < n; i++ {
+					defer manager.AcquireUpstream(baseURL)()
+				}
+			}
+
+			seen := make(map[string]bool)
+			for i := 0; i < 12; i++ {
+				seen[manager.GetOpenAIConfig().BaseURL] = true
+			}
+			if len(seen) != len(tt.want) {
+				t.Errorf("picked %v, want %v", seen, tt.want)
+			}
+			for _, baseURL := range tt.want {
+				if !seen[baseURL] {
+					t.Errorf("%s never picked, picked %v", baseURL, seen)
+				}
+			}
+		})
+	}
+}
+
+func TestAcquireUpstreamRelease(t *testing.T) {
+	manager := newLeastConnManager(t)
+	release := manager.AcquireUpstream(upstreamA)
+	if load := manager.connections.load(upstreamA); load != 1 {
+		t.Fatalf("in flight = %d after acquire, want 1", load)
+	}
+	release()
+	release()
+	if load := manager.connections.load(upstreamA); load != 0 {
+		t.Errorf("in flight = %d after releasing twice, want 0", load)
+	}
+
+	// Unknown upstreams and other strategies are not counted
+	manager.AcquireUpstream("https://unknown.example")()
+	if load := manager.connections.load("https://unknown.example"); load != 0 {
+		t.Errorf("unknown upstream in flight = %d", load)
+	}
+}
+
+func TestAcquireUpstreamConcurrent(t *testing.T) {
+	manager := newLeastConnManager(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				baseURL := manager.GetOpenAIConfig().BaseURL
+				manager.AcquireUpstream(baseURL)()
+			}
+		}()
+	}
+	wg.Wait()
+	for _, baseURL := range []string{upstreamA, upstreamB, upstreamC} {
+		if load := manager.connections.load(baseURL); load != 0 {
+			t.Errorf("%s in flight = %d after every request finished", baseURL, load)
+		}
+	}
+}
+
+func TestValidateLoadBalanceStrategy(t *testing.T) {
+	tests := []struct {
+		strategy string
+		wantErr  string
+	}{
+		{strategy: LoadBalanceRoundRobin},
+		{strategy: LoadBalanceLeastConnections},
+		{strategy: LoadBalanceRandom},
+		{strategy: LoadBalanceWeighted},
+		{strategy: LoadBalanceLeastLatency},
+		{strategy: "fastest", wantErr: "invalid load balance strategy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			checkValidation(t, map[string]string{"LOAD_BALANCE_STRATEGY": tt.strategy}, tt.wantErr)
+		})
+	}
+}
+
+func BenchmarkGetOpenAIConfig(b *testing.B) {
+	for _, strategy := range []string{LoadBalanceRoundRobin, LoadBalanceLeastConnections} {
+		b.Run(strategy, func(b *testing.B) {
+			manager := newLeastConnManager(b)
+			manager.config.OpenAI.LoadBalanceStrategy = strategy
+			manager.rebuildSelection(nil)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				manager.AcquireUpstream(manager.GetOpenAIConfig().BaseURL)()
+			}
+		})
+	}
+}
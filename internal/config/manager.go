@@ -2,17 +2,30 @@
 package config
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
 	"net/url"
 	"os"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"text/template"
 
+	"gpt-load/internal/circuitbreaker"
 	"gpt-load/internal/errors"
+	"gpt-load/internal/ratelimit"
+	"gpt-load/internal/redact"
+	"gpt-load/internal/tlscert"
+	"gpt-load/internal/version"
 	"gpt-load/pkg/types"
 
-	"github.com/joho/godotenv"
 	"github.com/sirupsen/logrus"
 )
 
@@ -36,10 +49,76 @@ var DefaultConstants = Constants{
 	DefaultMaxFreeSockets: 10,
 }
 
+// Upstream load balancing strategies
+const (
+	LoadBalanceRoundRobin       = "round_robin"
+	LoadBalanceConsistentHash   = "consistent_hash"
+	LoadBalanceLeastConnections = "least_connections"
+	LoadBalanceRandom           = "random"
+	LoadBalanceWeighted         = "weighted"
+	LoadBalanceLeastLatency     = "least_latency"
+)
+
+// A/B upstream groups, group B is UPSTREAM_B_URLS
+const (
+	UpstreamGroupA = "A"
+	UpstreamGroupB = "B"
+)
+
+// Upstream API types
+const (
+	UpstreamTypeOpenAI    = "openai"
+	UpstreamTypeAzure     = "azure"
+	UpstreamTypeAnthropic = "anthropic"
+)
+
+// Response buffering modes
+const (
+	ResponseBufferingNone = "none"
+	ResponseBufferingFull = "full"
+)
+
+// managementPaths are the fixed routes of the management endpoints
+var managementPaths = []string{"/stats", "/blacklist", "/reset-keys", "/config", "/admin/upstreams", "/admin/upstreams/latency", "/admin/quotas"}
+
+// logFieldNamePattern matches valid log field names (no dots or spaces)
+var logFieldNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// headerNamePattern matches valid HTTP header names (RFC 7230 token)
+var headerNamePattern = regexp.MustCompile("^[!#$%&'*+\\-.^_`|~0-9A-Za-z]+$")
+
+// sigV4ServicePattern matches valid AWS signing service names
+var sigV4ServicePattern = regexp.MustCompile(`^[a-z][a-z0-9-]+$`)
+
 // Manager implements the ConfigManager interface
 type Manager struct {
-	config            *Config
+	config            *Config // Replaced wholesale on reload or reorder, never modified in place
 	roundRobinCounter uint64
+	groupBCounter     uint64              // Round-robin counter within upstream group B
+	snowflake         *snowflakeGenerator // Nil unless snowflake request IDs are selected
+
+	// Upstream selection state derived from config, rebuilt on reload
+	hashRing      *ConsistentHashRing                       // Nil unless consistent hashing is selected
+	weightedSlots []string                                  // Nil unless upstreams carry weights
+	failoverTiers []types.UpstreamTier                      // Nil unless a failover order is configured
+	router        *modelRouter                              // Nil unless routing rules are configured
+	connections   *connectionCounter                        // Nil unless least-connections balancing is selected
+	latencies     *latencyAverages                          // Moving average latency per upstream
+	breakers      map[string]*circuitbreaker.CircuitBreaker // Nil unless circuit breaking is enabled
+
+	// Upstreams failing active health checks, replaced wholesale by the checker
+	degradedUpstreams atomic.Pointer[map[string]bool]
+	scheduler         *Scheduler
+
+	// Guards config and the derived upstream selection state
+	mu sync.RWMutex
+	// Serializes reloads
+	reloadMu sync.Mutex
+
+	// Errors collected while parsing structured environment variables
+	parseErrors []string
+	// Variables set from the .env file rather than the process environment
+	dotenvKeys map[string]bool
 }
 
 // Config represents the application configuration
@@ -48,7 +127,12 @@ type Config struct {
 	Keys        types.KeysConfig        `json:"keys"`
 	OpenAI      types.OpenAIConfig      `json:"openai"`
 	Auth        types.AuthConfig        `json:"auth"`
+	Admin       types.AdminConfig       `json:"admin"`
+	Metrics     types.MetricsConfig     `json:"metrics"`
 	CORS        types.CORSConfig        `json:"cors"`
+	Quota       types.QuotaConfig       `json:"quota"`
+	RateLimit   types.RateLimitConfig   `json:"rateLimit"`
+	Routing     types.RoutingConfig     `json:"routing"`
 	Performance types.PerformanceConfig `json:"performance"`
 	Log         types.LogConfig         `json:"log"`
 }
@@ -56,251 +140,2129 @@ type Config struct {
 // NewManager creates a new configuration manager
 func NewManager() (types.ConfigManager, error) {
 	// Try to load .env file
-	if err := godotenv.Load(); err != nil {
+	dotenvKeys, err := loadDotenv()
+	if err != nil {
 		logrus.Info("Info: Create .env file to support environment variable configuration")
 	}
 
-	config := &Config{
+	config, parseErrors, err := buildConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	manager := &Manager{
+		config:      config,
+		scheduler:   NewScheduler(),
+		parseErrors: parseErrors,
+		dotenvKeys:  dotenvKeys,
+	}
+
+	// Validate configuration
+	if err := manager.Validate(); err != nil {
+		return nil, err
+	}
+
+	manager.rebuildSelection(nil)
+
+	if config.OpenAI.HealthCheckInterval > 0 {
+		if err := manager.startHealthChecks(); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.Server.RequestIDFormat == RequestIDFormatSnowflake {
+		manager.snowflake = newSnowflakeGenerator(config.Server.SnowflakeMachineID)
+	}
+
+	// Install custom error templates
+	if config.Server.ErrorTemplatesFile != "" {
+		if err := errors.LoadTemplates(config.Server.ErrorTemplatesFile); err != nil {
+			return nil, errors.NewAppErrorWithCause(errors.ErrConfigInvalid, "Failed to load error templates", err)
+		}
+	}
+
+	return manager, nil
+}
+
+// buildConfig reads the configuration from the environment, CONFIG_FILE and stdin
+func buildConfig() (*Config, []string, error) {
+	var parseErrors []string
+	envConfig := loadConfig(os.Getenv, &parseErrors)
+	config := envConfig
+
+	// Settings from CONFIG_FILE apply wherever the environment doesn't set them
+	if configFile := os.Getenv("CONFIG_FILE"); configFile != "" {
+		var err error
+		if config, err = mergeConfigFile(envConfig, configFile); err != nil {
+			return nil, nil, err
+		}
+		logrus.Infof("Loaded configuration file %s", configFile)
+	}
+
+	// Then the JSON piped to stdin, which takes precedence over the file
+	if parseBoolean(os.Getenv("CONFIG_FROM_STDIN"), false) {
+		base := config
+		if base == envConfig {
+			var probeErrors []string
+			base = loadConfig(func(string) string { return "" }, &probeErrors)
+		}
+		var err error
+		if config, err = mergeConfigStdin(base, envConfig); err != nil {
+			return nil, nil, err
+		}
+		logrus.Info("Loaded configuration from stdin")
+	}
+	if os.Getenv("AUTH_KEY") != "" {
+		if os.Getenv("AUTH_KEYS") != "" {
+			logrus.Warn("AUTH_KEY is ignored because AUTH_KEYS is set")
+		} else {
+			logrus.Warn("AUTH_KEY is deprecated, use AUTH_KEYS instead")
+		}
+	}
+
+	// Extract per-upstream weights and settings encoded in the URLs
+	config.OpenAI.BaseURLs, config.OpenAI.BaseURLWeights = parseUpstreamWeights(config.OpenAI.BaseURLs)
+	config.OpenAI.BaseURLs, config.OpenAI.UpstreamMaxResponseMB = parseUpstreamParams(config.OpenAI.BaseURLs, &parseErrors)
+	return config, parseErrors, nil
+}
+
+// loadConfig builds the configuration from environment lookups, collecting
+// errors from structured values in parseErrors
+func loadConfig(getenv func(string) string, parseErrors *[]string) *Config {
+	getEnvOrDefault := func(key, defaultValue string) string {
+		if value := getenv(key); value != "" {
+			return value
+		}
+		return defaultValue
+	}
+
+	// AUTH_JWT_JWKS_URL is accepted as an alias of AUTH_JWKS_URL
+	jwksURL := getEnvOrDefault("AUTH_JWKS_URL", getenv("AUTH_JWT_JWKS_URL"))
+	authKeys, authKeyLabels := parseAuthKeys(getenv("AUTH_KEYS"), getenv("AUTH_KEY"))
+
+	return &Config{
 		Server: types.ServerConfig{
-			Port:                    parseInteger(os.Getenv("PORT"), 7860),
+			Port:                    parseInteger(getenv("PORT"), 7860),
 			Host:                    getEnvOrDefault("HOST", "0.0.0.0"),
-			ReadTimeout:             parseInteger(os.Getenv("SERVER_READ_TIMEOUT"), 120),
-			WriteTimeout:            parseInteger(os.Getenv("SERVER_WRITE_TIMEOUT"), 1800),
-			IdleTimeout:             parseInteger(os.Getenv("SERVER_IDLE_TIMEOUT"), 120),
-			GracefulShutdownTimeout: parseInteger(os.Getenv("SERVER_GRACEFUL_SHUTDOWN_TIMEOUT"), 60),
+			ReadTimeout:             parseInteger(getenv("SERVER_READ_TIMEOUT"), 120),
+			WriteTimeout:            parseInteger(getenv("SERVER_WRITE_TIMEOUT"), 1800),
+			IdleTimeout:             parseInteger(getenv("SERVER_IDLE_TIMEOUT"), 120),
+			GracefulShutdownTimeout: parseInteger(getenv("SERVER_GRACEFUL_SHUTDOWN_TIMEOUT"), 60),
+			ErrorTemplatesFile:      getenv("ERROR_TEMPLATES_FILE"),
+			HealthResponseTemplate:  getenv("HEALTH_RESPONSE_TEMPLATE"),
+			SelfTestOnStartup:       parseBoolean(getenv("SELF_TEST_ON_STARTUP"), false),
+			SelfTestTimeoutSeconds:  parseInteger(getenv("SELF_TEST_TIMEOUT_SECONDS"), 10),
+			SelfTestFailFast:        parseBoolean(getenv("SELF_TEST_FAIL_FAST"), false),
+			RequestIDFormat:         getEnvOrDefault("REQUEST_ID_FORMAT", RequestIDFormatUUID),
+			SnowflakeMachineID:      parseInteger(getenv("SNOWFLAKE_MACHINE_ID"), -1),
+			TLSEnabled:              getenv("TLS_CERT_FILE") != "" && getenv("TLS_KEY_FILE") != "",
+			TLSCertFile:             getenv("TLS_CERT_FILE"),
+			TLSKeyFile:              getenv("TLS_KEY_FILE"),
+			TLSMinVersion:           getEnvOrDefault("TLS_MIN_VERSION", "TLS1.2"),
+			TLSCipherSuites:         parseArray(getenv("TLS_CIPHER_SUITES"), nil),
+			// Idle streams get an SSE comment after this many seconds
+			SSEHeartbeatIntervalSeconds: parseInteger(getenv("SSE_HEARTBEAT_INTERVAL_SECONDS"), 0),
+			// Client IP headers sent upstream
+			ForwardClientIP:   parseBoolean(getenv("FORWARD_CLIENT_IP"), true),
+			TrustedProxyCIDRs: parseArray(getenv("TRUSTED_PROXY_CIDRS"), nil),
+			// Probe routes for container orchestrators
+			HealthPath: getEnvOrDefault("HEALTH_PATH", "/health"),
+			ReadyPath:  getEnvOrDefault("READY_PATH", "/ready"),
 		},
 		Keys: types.KeysConfig{
-			APIKeys:            parseArray(os.Getenv("API_KEYS"), []string{}),
-			StartIndex:         parseInteger(os.Getenv("START_INDEX"), 0),
-			BlacklistThreshold: parseInteger(os.Getenv("BLACKLIST_THRESHOLD"), 1),
-			MaxRetries:         parseInteger(os.Getenv("MAX_RETRIES"), 3),
+			APIKeys:                      parseArray(getenv("API_KEYS"), []string{}),
+			KeyFilePath:                  strings.TrimSpace(getenv("KEY_FILE_PATH")),
+			KeyFetchURL:                  strings.TrimSpace(getenv("KEY_FETCH_URL")),
+			KeyFetchIntervalSeconds:      parseInteger(getenv("KEY_FETCH_INTERVAL_SECONDS"), 300),
+			KeyFetchAuthHeader:           strings.TrimSpace(getenv("KEY_FETCH_AUTH_HEADER")),
+			KeyAWSSecretARN:              strings.TrimSpace(getenv("KEY_AWS_SECRET_ARN")),
+			KeyAWSRegion:                 strings.TrimSpace(getenv("KEY_AWS_REGION")),
+			StartIndex:                   parseInteger(getenv("START_INDEX"), 0),
+			MaxKeyCount:                  parseInteger(getenv("MAX_KEY_COUNT"), 10000),
+			KeyMaxConcurrent:             parseInteger(getenv("KEY_MAX_CONCURRENT"), 0),
+			KeyRateLimitRPM:              parseInteger(getenv("KEY_RATE_LIMIT_RPM"), 0),
+			KeyRateLimitAlgorithm:        getEnvOrDefault("RATE_LIMIT_ALGORITHM", ratelimit.AlgorithmTokenBucket),
+			KeyRateLimitWindowSeconds:    parseInteger(getenv("RATE_LIMIT_WINDOW_SECONDS"), 60),
+			HotStandbyKey:                strings.TrimSpace(getenv("HOT_STANDBY_KEY")),
+			HotStandbyBlacklistThreshold: parseInteger(getenv("HOT_STANDBY_BLACKLIST_THRESHOLD"), 3),
+			BlacklistThreshold:           parseInteger(getenv("BLACKLIST_THRESHOLD"), 1),
+			BlacklistRecoverySeconds:     parseInteger(getenv("BLACKLIST_RECOVERY_AFTER_SECONDS"), 0),
+			BlacklistProbeEnabled:        parseBoolean(getenv("BLACKLIST_PROBE_ENABLED"), false),
+			Cooldown429Ms:                parseInteger(getenv("KEY_COOLDOWN_AFTER_429_MS"), 0),
+			MaxRetries:                   parseInteger(getenv("MAX_RETRIES"), 3),
+			RetryBaseDelayMs:             parseInteger(getenv("RETRY_BASE_DELAY_MS"), 100),
+			RetryMaxDelayMs:              parseInteger(getenv("RETRY_MAX_DELAY_MS"), 5000),
+			RetryJitterFactor:            parseFloat(getenv("RETRY_JITTER_FACTOR"), 1.0),
+			RetryStatusCodes:             parseStatusCodes(getEnvOrDefault("RETRY_STATUS_CODES", "429,500,502,503,504"), parseErrors),
+			RetryOn401:                   parseBoolean(getenv("RETRY_ON_401"), true),
+			RetryOn403:                   parseBoolean(getenv("RETRY_ON_403"), false),
+			KeyProbeOnStartup:            parseBoolean(getenv("KEY_PROBE_ON_STARTUP"), false),
+			KeyProbeConcurrency:          parseInteger(getenv("KEY_PROBE_CONCURRENCY"), 5),
+			KeyProbeTimeoutMs:            parseInteger(getenv("KEY_PROBE_TIMEOUT_MS"), 5000),
+			StartupWaitSeconds:           parseInteger(getenv("STARTUP_WAIT_SECONDS"), 30),
+			EmitCapacityHeaders:          parseBoolean(getenv("EMIT_CAPACITY_HEADERS"), false),
+			EmitCapacityHeadersPublic:    parseBoolean(getenv("EMIT_CAPACITY_HEADERS_PUBLIC"), false),
+			CoordinationStoreURL:         strings.TrimSpace(getenv("COORDINATION_STORE_URL")),
+			CoordinationSyncInterval:     parseInteger(getenv("COORDINATION_SYNC_INTERVAL_SECONDS"), 30),
+			StateStoreURL:                strings.TrimSpace(getenv("STATE_REDIS_URL")),
+			BlacklistWebhookURL:          strings.TrimSpace(getenv("BLACKLIST_WEBHOOK_URL")),
+			BlacklistWebhookSecret:       getenv("BLACKLIST_WEBHOOK_SECRET"),
+			ErrorSuppression:             parseErrorSuppression(getenv("KEY_ERROR_SUPPRESSION"), parseErrors),
+			// Rolling window for per-key usage statistics
+			StatsResetIntervalHours: parseInteger(getenv("STATS_RESET_INTERVAL_HOURS"), 0),
 		},
 		OpenAI: types.OpenAIConfig{
-			BaseURLs:        parseArray(os.Getenv("OPENAI_BASE_URL"), []string{"https://api.openai.com"}),
-			RequestTimeout:  parseInteger(os.Getenv("REQUEST_TIMEOUT"), DefaultConstants.DefaultTimeout),
-			ResponseTimeout: parseInteger(os.Getenv("RESPONSE_TIMEOUT"), 30),
-			IdleConnTimeout: parseInteger(os.Getenv("IDLE_CONN_TIMEOUT"), 120),
+			BaseURLs:                      parseArray(getenv("OPENAI_BASE_URL"), []string{"https://api.openai.com"}),
+			UpstreamBURLs:                 parseArray(getenv("UPSTREAM_B_URLS"), nil),
+			UpstreamBWeight:               parseInteger(getenv("UPSTREAM_B_WEIGHT"), 0),
+			UpstreamTiers:                 parseUpstreamTiers(getenv("UPSTREAM_FAILOVER_ORDER"), parseErrors),
+			HealthCheckInterval:           parseInteger(getenv("HEALTH_CHECK_INTERVAL"), 0),
+			HealthCheckPath:               getEnvOrDefault("HEALTH_CHECK_PATH", "/health"),
+			HealthCheckFailThreshold:      parseInteger(getenv("HEALTH_CHECK_FAIL_THRESHOLD"), 3),
+			HealthCheckRecoverThreshold:   parseInteger(getenv("HEALTH_CHECK_RECOVER_THRESHOLD"), 2),
+			CircuitFailThreshold:          parseInteger(getenv("CIRCUIT_BREAKER_FAIL_THRESHOLD"), 0),
+			CircuitSuccessThreshold:       parseInteger(getenv("CIRCUIT_BREAKER_SUCCESS_THRESHOLD"), 2),
+			CircuitOpenTimeout:            parseInteger(getenv("CIRCUIT_BREAKER_TIMEOUT"), 30),
+			MaxResponseBodySizeMB:         parseInteger(getenv("MAX_RESPONSE_BODY_SIZE_MB"), 0),
+			LoadBalanceStrategy:           getEnvOrDefault("LOAD_BALANCE_STRATEGY", LoadBalanceRoundRobin),
+			ConsistentHashReplicas:        parseInteger(getenv("CONSISTENT_HASH_REPLICAS"), 100),
+			RequestTimeout:                parseInteger(getenv("REQUEST_TIMEOUT"), DefaultConstants.DefaultTimeout),
+			ResponseTimeout:               parseInteger(getenv("RESPONSE_TIMEOUT"), 30),
+			IdleConnTimeout:               parseInteger(getenv("IDLE_CONN_TIMEOUT"), 120),
+			StatusRemap:                   parseStatusRemap(getenv("UPSTREAM_STATUS_REMAP"), parseErrors),
+			TimeoutWarningPercent:         parseFloat(getenv("TIMEOUT_WARNING_PERCENT"), 0),
+			MaxConnectAttemptsPerSecond:   parseInteger(getenv("UPSTREAM_MAX_CONNECT_ATTEMPTS_PER_SECOND"), 0),
+			ForwardResponseTrailers:       parseBoolean(getenv("FORWARD_RESPONSE_TRAILERS"), false),
+			GenericProxyMode:              parseBoolean(getenv("GENERIC_PROXY_MODE"), false),
+			InjectBodyFields:              parseInjectFields(getenv("UPSTREAM_INJECT_BODY_FIELDS"), parseErrors),
+			InjectBodyOverride:            parseBoolean(getenv("UPSTREAM_INJECT_BODY_OVERRIDE"), false),
+			FallbackUpstreamURL:           getenv("FALLBACK_UPSTREAM_URL"),
+			FallbackUpstreamKeys:          parseArray(getenv("FALLBACK_UPSTREAM_KEYS"), nil),
+			FallbackTriggerCodes:          parseStatusCodes(getEnvOrDefault("FALLBACK_TRIGGER_CODES", "502,503,504"), parseErrors),
+			MirrorURL:                     strings.TrimSpace(getenv("MIRROR_URL")),
+			MirrorSampleRate:              parseFloat(getenv("MIRROR_SAMPLE_RATE"), 1.0),
+			MirrorTimeoutMs:               parseInteger(getenv("MIRROR_TIMEOUT_MS"), 10000),
+			KeyHeader:                     getEnvOrDefault("UPSTREAM_KEY_HEADER", "Authorization"),
+			KeyFormat:                     getEnvOrDefault("UPSTREAM_KEY_FORMAT", "Bearer {key}"),
+			UpstreamType:                  getEnvOrDefault("UPSTREAM_TYPE", UpstreamTypeOpenAI),
+			AzureAPIVersion:               getEnvOrDefault("AZURE_API_VERSION", "2024-02-01"),
+			AzureDeployments:              parseAzureDeployments(getenv("AZURE_DEPLOYMENT_MAP"), parseErrors),
+			AnthropicAPIVersion:           getEnvOrDefault("ANTHROPIC_API_VERSION", "2023-06-01"),
+			UpstreamQueryParams:           strings.TrimSpace(getenv("UPSTREAM_QUERY_PARAMS")),
+			NormalizeMessageOrder:         parseBoolean(getenv("NORMALIZE_MESSAGE_ORDER"), false),
+			BroadcastEnabled:              parseBoolean(getenv("BROADCAST_ENABLED"), false),
+			BroadcastPaths:                parseArray(getenv("BROADCAST_PATHS"), []string{"/v1/models"}),
+			ForwardRequestIDToUpstream:    parseBoolean(getenv("FORWARD_REQUEST_ID_TO_UPSTREAM"), true),
+			UpstreamRequestIDHeader:       getEnvOrDefault("UPSTREAM_REQUEST_ID_HEADER", "X-Request-ID"),
+			CaptureUpstreamIDHeader:       getEnvOrDefault("CAPTURE_UPSTREAM_REQUEST_ID_HEADER", "openai-request-id"),
+			UpstreamUserAgent:             strings.TrimSpace(getenv("UPSTREAM_USER_AGENT")),
+			UpstreamDefaultUserAgent:      getEnvOrDefault("UPSTREAM_DEFAULT_USER_AGENT", "gpt-load/"+version.Version),
+			ModelTags:                     parseModelTags(getenv("MODEL_TAGS"), parseErrors),
+			LatencySortInterval:           parseInteger(getenv("UPSTREAM_LATENCY_SORT_INTERVAL_SECONDS"), 0),
+			LatencyWindow:                 parseInteger(getenv("UPSTREAM_LATENCY_WINDOW"), 100),
+			StreamingMetadataEventEnabled: parseBoolean(getenv("STREAMING_METADATA_EVENT_ENABLED"), false),
+			UpstreamHeaderHash:            parseBoolean(getenv("UPSTREAM_HEADER_HASH"), false),
+			AWSSigV4Enabled:               parseBoolean(getenv("UPSTREAM_AWS_SIGV4_ENABLED"), false),
+			AWSAccessKeyID:                getenv("AWS_ACCESS_KEY_ID"),
+			AWSSecretAccessKey:            getenv("AWS_SECRET_ACCESS_KEY"),
+			AWSSessionToken:               getenv("AWS_SESSION_TOKEN"),
+			AWSSigV4Service:               getEnvOrDefault("AWS_SIGV4_SERVICE", "bedrock"),
+			AWSRegion:                     getenv("AWS_REGION"),
+			UpstreamTLSCertFile:           getenv("UPSTREAM_TLS_CERT_FILE"),
+			UpstreamTLSKeyFile:            getenv("UPSTREAM_TLS_KEY_FILE"),
+			UpstreamTLSCAFile:             getenv("UPSTREAM_TLS_CA_FILE"),
+			UpstreamTLSSkipVerify:         parseBoolean(getenv("UPSTREAM_TLS_SKIP_VERIFY"), false),
+			UpstreamTLSCerts:              parseUpstreamTLSCerts(getenv, len(parseArray(getenv("OPENAI_BASE_URL"), nil))),
+			UpstreamHTTP2Enabled:          parseBoolean(getenv("UPSTREAM_HTTP2_ENABLED"), true),
+			UpstreamHTTP2StrictStreams:    parseBoolean(getenv("UPSTREAM_HTTP2_STRICT_MAX_CONCURRENT_STREAMS"), false),
+			// Connection phase timeouts, 0 keeps the 30s dial and RESPONSE_TIMEOUT
+			UpstreamConnectTimeoutMs:        parseInteger(getenv("UPSTREAM_CONNECT_TIMEOUT_MS"), 0),
+			UpstreamResponseHeaderTimeoutMs: parseInteger(getenv("UPSTREAM_RESPONSE_HEADER_TIMEOUT_MS"), 0),
+			// Latency SLA
+			UpstreamSLAThresholdMs: parseInteger(getenv("UPSTREAM_SLA_THRESHOLD_MS"), 0),
+			// Record TTLs shorter than DNS_CACHE_TTL_SECONDS win, NXDOMAIN is kept briefly
+			DNSCacheTTLSeconds:         parseInteger(getenv("DNS_CACHE_TTL_SECONDS"), 0),
+			DNSNegativeCacheTTLSeconds: parseInteger(getenv("DNS_NEGATIVE_CACHE_TTL_SECONDS"), 5),
+			// Per-upstream pool sizes, overridden by the _<INDEX> variants
+			UpstreamMaxIdleConns:        parseInteger(getenv("UPSTREAM_MAX_IDLE_CONNS"), 0),
+			UpstreamMaxIdleConnsPerHost: parseInteger(getenv("UPSTREAM_MAX_IDLE_CONNS_PER_HOST"), 0),
+			UpstreamMaxConnsPerHost:     parseInteger(getenv("UPSTREAM_MAX_CONNS_PER_HOST"), 0),
+			UpstreamPools:               parseUpstreamPools(getenv, len(parseArray(getenv("OPENAI_BASE_URL"), []string{"https://api.openai.com"}))),
 		},
 		Auth: types.AuthConfig{
-			Key:     os.Getenv("AUTH_KEY"),
-			Enabled: os.Getenv("AUTH_KEY") != "",
+			Keys:                authKeys,
+			KeyLabels:           authKeyLabels,
+			Enabled:             len(authKeys) > 0 || jwksURL != "",
+			JWKSURL:             jwksURL,
+			JWKSRefreshInterval: parseInteger(getenv("AUTH_JWKS_REFRESH_INTERVAL_SECONDS"), 3600),
+			JWTAudience:         strings.TrimSpace(getenv("AUTH_JWT_AUDIENCE")),
+			IPAllowlist:         parseArray(getenv("IP_ALLOWLIST"), nil),
+			IPBlocklist:         parseArray(getenv("IP_BLOCKLIST"), nil),
+			ClientIPHeader:      strings.TrimSpace(getenv("CLIENT_IP_HEADER")),
+			// Request paths that skip authentication
+			ExemptPaths: parseArray(getenv("AUTH_EXEMPT_PATHS"), nil),
+		},
+		Admin: types.AdminConfig{
+			Enabled: getenv("ADMIN_AUTH_KEY") != "",
+			Port:    parseInteger(getenv("ADMIN_PORT"), 7861),
+			AuthKey: getenv("ADMIN_AUTH_KEY"),
+		},
+		Metrics: types.MetricsConfig{
+			Enabled: parseBoolean(getenv("METRICS_ENABLED"), false),
+			Port:    parseInteger(getenv("METRICS_PORT"), 9090),
+		},
+		RateLimit: types.RateLimitConfig{
+			Enabled:           parseBoolean(getenv("RATE_LIMIT_ENABLED"), false),
+			RequestsPerMinute: parseInteger(getenv("RATE_LIMIT_REQUESTS_PER_MINUTE"), 60),
+			BurstSize:         parseInteger(getenv("RATE_LIMIT_BURST_SIZE"), 10),
+			LimitByHeader:     strings.TrimSpace(getenv("RATE_LIMIT_BY_HEADER")),
+			EntryTTLSeconds:   parseInteger(getenv("RATE_LIMIT_ENTRY_TTL_SECONDS"), 600),
+		},
+		Quota: types.QuotaConfig{
+			Enabled: parseBoolean(getenv("QUOTA_TRACKING_ENABLED"), false),
+			Period:  getEnvOrDefault("QUOTA_PERIOD", "daily"),
+			Quotas:  parseQuotas(getenv("QUOTAS"), parseErrors),
+		},
+		Routing: types.RoutingConfig{
+			Rules: parseRoutingRules(getenv("ROUTING_RULES"), parseErrors),
 		},
 		CORS: types.CORSConfig{
-			Enabled:          parseBoolean(os.Getenv("ENABLE_CORS"), true),
-			AllowedOrigins:   parseArray(os.Getenv("ALLOWED_ORIGINS"), []string{"*"}),
-			AllowedMethods:   parseArray(os.Getenv("ALLOWED_METHODS"), []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
-			AllowedHeaders:   parseArray(os.Getenv("ALLOWED_HEADERS"), []string{"*"}),
-			AllowCredentials: parseBoolean(os.Getenv("ALLOW_CREDENTIALS"), false),
+			Enabled:          parseBoolean(getenv("ENABLE_CORS"), true),
+			AllowedOrigins:   parseArray(getenv("ALLOWED_ORIGINS"), []string{"*"}),
+			AllowedMethods:   parseArray(getenv("ALLOWED_METHODS"), []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
+			AllowedHeaders:   parseArray(getenv("ALLOWED_HEADERS"), []string{"*"}),
+			AllowCredentials: parseBoolean(getenv("ALLOW_CREDENTIALS"), false),
 		},
 		Performance: types.PerformanceConfig{
-			MaxConcurrentRequests: parseInteger(os.Getenv("MAX_CONCURRENT_REQUESTS"), 100),
-			EnableGzip:            parseBoolean(os.Getenv("ENABLE_GZIP"), true),
+			MaxConcurrentRequests:   parseInteger(getenv("MAX_CONCURRENT_REQUESTS"), 100),
+			MaxQueueSize:            parseInteger(getenv("MAX_QUEUE_SIZE"), 0),
+			QueueTimeoutMs:          parseInteger(getenv("QUEUE_TIMEOUT_MS"), 30000),
+			EnableGzip:              parseBoolean(getenv("ENABLE_GZIP"), true),
+			EnableBrotli:            parseBoolean(getenv("ENABLE_BROTLI"), false),
+			CompressionPreferClient: parseBoolean(getenv("COMPRESSION_PREFER_CLIENT"), true),
+			SingleflightEnabled:     parseBoolean(getenv("SINGLEFLIGHT_ENABLED"), false),
+			MaxSSEEventsPerResponse: parseInteger(getenv("MAX_SSE_EVENTS_PER_RESPONSE"), 0),
+			MaxRequestBodyBytes:     parseInteger(getenv("MAX_REQUEST_BODY_BYTES"), 10*1024*1024),
+			MaxResponseBodyBytes:    parseInteger(getenv("MAX_RESPONSE_BODY_BYTES"), 0),
+			WSEnabled:               parseBoolean(getenv("WS_ENABLED"), false),
+			CacheEnabled:            parseBoolean(getenv("CACHE_ENABLED"), false),
+			CacheTTLSeconds:         parseInteger(getenv("CACHE_TTL_SECONDS"), 300),
+			CacheMaxSizeMB:          parseInteger(getenv("CACHE_MAX_SIZE_MB"), 64),
+			OTELEnabled:             parseBoolean(getenv("OTEL_ENABLED"), false),
+			OTELEndpoint:            getEnvOrDefault("OTEL_ENDPOINT", "http://localhost:4318"),
+			OTELServiceName:         getEnvOrDefault("OTEL_SERVICE_NAME", "gpt-load"),
+			// How response bodies are passed to the client
+			ResponseBuffering: strings.ToLower(getEnvOrDefault("RESPONSE_BUFFERING", ResponseBufferingNone)),
 		},
 		Log: types.LogConfig{
-			Level:         getEnvOrDefault("LOG_LEVEL", "info"),
-			Format:        getEnvOrDefault("LOG_FORMAT", "text"),
-			EnableFile:    parseBoolean(os.Getenv("LOG_ENABLE_FILE"), false),
-			FilePath:      getEnvOrDefault("LOG_FILE_PATH", "logs/app.log"),
-			EnableRequest: parseBoolean(os.Getenv("LOG_ENABLE_REQUEST"), true),
+			Level:                getEnvOrDefault("LOG_LEVEL", "info"),
+			Format:               getEnvOrDefault("LOG_FORMAT", "text"),
+			EnableFile:           parseBoolean(getenv("LOG_ENABLE_FILE"), false),
+			FilePath:             getEnvOrDefault("LOG_FILE_PATH", "logs/app.log"),
+			EnableRequest:        parseBoolean(getenv("LOG_ENABLE_REQUEST"), true),
+			RequestIDHeader:      getEnvOrDefault("LOG_REQUEST_ID_HEADER", "X-Request-ID"),
+			ExtractHeaders:       parseHeaderFields(getenv("LOG_EXTRACT_HEADERS"), parseErrors),
+			AuditLogEnabled:      parseBoolean(getenv("AUDIT_LOG_ENABLED"), false),
+			CloneRequestForAudit: parseBoolean(getenv("CLONE_REQUEST_FOR_AUDIT"), false),
+			ServerTimingEnabled:  parseBoolean(getenv("SERVER_TIMING_ENABLED"), false),
+			ExcludePaths:         parseArray(getenv("LOG_EXCLUDE_PATHS"), nil),
+			BodyRedactPatterns:   parseRedactPatterns(getenv("BODY_REDACT_PATTERNS"), parseErrors),
+			RequestFields:        parseArray(getenv("LOG_REQUEST_FIELDS"), types.RequestLogFields),
+			MaskKeys:             parseBoolean(getenv("LOG_MASK_KEYS"), true),
+			FileMaxSizeMB:        parseInteger(getenv("LOG_FILE_MAX_SIZE_MB"), 100),
+			FileMaxBackups:       parseInteger(getenv("LOG_FILE_MAX_BACKUPS"), 5),
+			FileMaxAgeDays:       parseInteger(getenv("LOG_FILE_MAX_AGE_DAYS"), 30),
+			FileCompress:         parseBoolean(getenv("LOG_FILE_COMPRESS"), false),
+			FileRotateOnSIGHUP:   parseBoolean(getenv("LOG_FILE_ROTATE_ON_SIGHUP"), false),
 		},
 	}
+}
 
-	manager := &Manager{config: config}
-
-	// Validate configuration
-	if err := manager.Validate(); err != nil {
-		return nil, err
-	}
-
-	return manager, nil
+// current returns the configuration in effect
+func (m *Manager) current() *Config {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.config
 }
 
 // GetServerConfig returns server configuration
 func (m *Manager) GetServerConfig() types.ServerConfig {
-	return m.config.Server
+	return m.current().Server
 }
 
 // GetKeysConfig returns keys configuration
 func (m *Manager) GetKeysConfig() types.KeysConfig {
-	return m.config.Keys
+	return m.current().Keys
 }
 
 // GetOpenAIConfig returns OpenAI configuration
 func (m *Manager) GetOpenAIConfig() types.OpenAIConfig {
+	m.mu.RLock()
 	config := m.config.OpenAI
-	if len(config.BaseURLs) > 1 {
+	slots := m.weightedSlots
+	tiers := m.failoverTiers
+	connections := m.connections
+	latencies := m.latencies
+	m.mu.RUnlock()
+
+	if len(config.UpstreamBURLs) == 0 {
+		if upstream := m.selectGroupA(config.LoadBalanceStrategy, config.BaseURLs, slots, tiers, connections, latencies); upstream != "" {
+			config.BaseURL = upstream
+		}
+		return config
+	}
+
+	// Draw the group first, then balance within it. Weights only apply to group A.
+	if rand.Intn(100) < config.UpstreamBWeight {
+		config.UpstreamGroup = UpstreamGroupB
+		config.BaseURL = m.selectUpstream(config.LoadBalanceStrategy, config.UpstreamBURLs, nil, connections, latencies, &m.groupBCounter)
+	} else {
+		config.UpstreamGroup = UpstreamGroupA
+		config.BaseURL = m.selectGroupA(config.LoadBalanceStrategy, config.BaseURLs, slots, tiers, connections, latencies)
+	}
+	return config
+}
+
+// selectGroupA picks one of the group A upstreams. With failover tiers it balances
+// within the first tier that has an upstream not degraded, ignoring weights, and
+// over the first tier when every upstream is degraded.
+func (m *Manager) selectGroupA(strategy string, baseURLs, slots []string, tiers []types.UpstreamTier, connections *connectionCounter, latencies *latencyAverages) string {
+	if len(tiers) == 0 {
+		return m.selectUpstream(strategy, baseURLs, slots, connections, latencies, &m.roundRobinCounter)
+	}
+
+	for i, tier := range tiers {
+		available := make([]string, 0, len(tier.BaseURLs))
+		for _, baseURL := range tier.BaseURLs {
+			if !m.isDegraded(baseURL) {
+				available = append(available, baseURL)
+			}
+		}
+		if len(available) > 0 {
+			if i > 0 {
+				logrus.Debugf("Upstream tier %s is down, failing over to tier %s", tiers[0].Name, tier.Name)
+			}
+			return m.selectUpstream(strategy, available, nil, connections, latencies, &m.roundRobinCounter)
+		}
+	}
+	return m.selectUpstream(strategy, tiers[0].BaseURLs, nil, connections, latencies, &m.roundRobinCounter)
+}
+
+// selectUpstream picks one of baseURLs with the load balancing strategy, or
+// returns "" when there are none. counter drives round-robin selection.
+// Upstreams over the SLA threshold lose most of their picks to faster ones.
+func (m *Manager) selectUpstream(strategy string, baseURLs, slots []string, connections *connectionCounter, latencies *latencyAverages, counter *uint64) string {
+	if len(baseURLs) > 1 && strategy == LoadBalanceLeastLatency {
+		// The counter only rotates the starting point among equally fast upstreams
+		index := atomic.AddUint64(counter, 1) - 1
+		return m.fastest(latencies, baseURLs, index)
+	}
+	return m.withinSLA(latencies, baseURLs, m.balanceUpstream(strategy, baseURLs, slots, connections, counter))
+}
+
+// balanceUpstream picks one of baseURLs with a strategy that ignores latency
+func (m *Manager) balanceUpstream(strategy string, baseURLs, slots []string, connections *connectionCounter, counter *uint64) string {
+	switch {
+	case len(baseURLs) > 1 && strategy == LoadBalanceLeastConnections:
+		// The counter only rotates the starting point among equally loaded upstreams
+		index := atomic.AddUint64(counter, 1) - 1
+		return m.leastLoaded(connections, baseURLs, index)
+	case len(baseURLs) > 1 && strategy == LoadBalanceRandom:
+		return m.skipDegraded(baseURLs, uint64(rand.Intn(len(baseURLs))))
+	case len(slots) > 0 && strategy == LoadBalanceWeighted:
+		// Each upstream appears in the slots as often as its weight
+		return m.skipDegraded(slots, uint64(rand.Intn(len(slots))))
+	case len(baseURLs) > 1 && strategy == LoadBalanceWeighted:
+		return m.skipDegraded(baseURLs, uint64(rand.Intn(len(baseURLs))))
+	case len(slots) > 0:
+		// Same counter over the weighted slots
+		index := atomic.AddUint64(counter, 1) - 1
+		return m.skipDegraded(slots, index)
+	case len(baseURLs) > 1:
 		// Use atomic counter for thread-safe round-robin
-		index := atomic.AddUint64(&m.roundRobinCounter, 1) - 1
-		config.BaseURL = config.BaseURLs[index%uint64(len(config.BaseURLs))]
-	} else if len(config.BaseURLs) == 1 {
-		config.BaseURL = config.BaseURLs[0]
+		index := atomic.AddUint64(counter, 1) - 1
+		return m.skipDegraded(baseURLs, index)
+	case len(baseURLs) == 1:
+		return baseURLs[0]
+	}
+	return ""
+}
+
+// GetOpenAIConfigForModel returns OpenAI configuration with the base URL taken from the
+// pool routed to the model, falling back to the round-robin upstream for unrouted models
+func (m *Manager) GetOpenAIConfigForModel(model string) types.OpenAIConfig {
+	upstream, routed := m.routeModel(model)
+	if !routed {
+		return m.GetOpenAIConfig()
 	}
+
+	config := m.current().OpenAI
+	config.BaseURL = upstream
 	return config
 }
 
+// SetUpstreamOrder replaces the upstream order, ignoring lists that are not a permutation of the configured upstreams
+func (m *Manager) SetUpstreamOrder(baseURLs []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(baseURLs) != len(m.config.OpenAI.BaseURLs) {
+		return
+	}
+	remaining := make(map[string]int, len(baseURLs))
+	for _, baseURL := range m.config.OpenAI.BaseURLs {
+		remaining[baseURL]++
+	}
+	for _, baseURL := range baseURLs {
+		if remaining[baseURL] == 0 {
+			return
+		}
+		remaining[baseURL]--
+	}
+
+	// Weights follow their upstreams
+	weightOf := make(map[string]int, len(baseURLs))
+	for i, baseURL := range m.config.OpenAI.BaseURLs {
+		weightOf[baseURL] = m.config.OpenAI.BaseURLWeights[i]
+	}
+	ordered := make([]string, len(baseURLs))
+	weights := make([]int, len(baseURLs))
+	for i, baseURL := range baseURLs {
+		ordered[i] = baseURL
+		weights[i] = weightOf[baseURL]
+	}
+	updated := *m.config
+	updated.OpenAI.BaseURLs = ordered
+	updated.OpenAI.BaseURLWeights = weights
+	m.config = &updated
+	m.weightedSlots = weightedSlotsFor(ordered, weights)
+}
+
+// GetModelTags returns the cost attribution tags configured for a model
+func (m *Manager) GetModelTags(model string) map[string]string {
+	return m.current().OpenAI.ModelTags[model]
+}
+
+// GetUpstreamForCaller returns the upstream URL a caller is pinned to by consistent hashing,
+// or the next round-robin upstream when consistent hashing is not enabled. Routing rules
+// take precedence, models with a rule always use their own pool.
+func (m *Manager) GetUpstreamForCaller(callerID, model string) string {
+	if upstream, routed := m.routeModel(model); routed {
+		return upstream
+	}
+
+	m.mu.RLock()
+	hashRing := m.hashRing
+	m.mu.RUnlock()
+	if hashRing == nil {
+		return m.GetOpenAIConfig().BaseURL
+	}
+
+	// Callers pinned to a degraded upstream temporarily rotate over the others
+	if upstream := hashRing.Get(callerID); !m.isDegraded(upstream) {
+		return upstream
+	}
+	return m.GetOpenAIConfig().BaseURL
+}
+
+// GenerateRequestID returns a new request ID in the configured format
+func (m *Manager) GenerateRequestID() string {
+	switch m.current().Server.RequestIDFormat {
+	case RequestIDFormatSnowflake:
+		return m.snowflake.Next()
+	case RequestIDFormatHex16:
+		return newHex16()
+	default:
+		return newUUID()
+	}
+}
+
 // GetAuthConfig returns authentication configuration
 func (m *Manager) GetAuthConfig() types.AuthConfig {
-	return m.config.Auth
+	return m.current().Auth
+}
+
+// GetAdminConfig returns admin server configuration
+func (m *Manager) GetAdminConfig() types.AdminConfig {
+	return m.current().Admin
+}
+
+// GetMetricsConfig returns metrics server configuration
+func (m *Manager) GetMetricsConfig() types.MetricsConfig {
+	return m.current().Metrics
 }
 
 // GetCORSConfig returns CORS configuration
 func (m *Manager) GetCORSConfig() types.CORSConfig {
-	return m.config.CORS
+	return m.current().CORS
 }
 
 // GetPerformanceConfig returns performance configuration
 func (m *Manager) GetPerformanceConfig() types.PerformanceConfig {
-	return m.config.Performance
+	return m.current().Performance
 }
 
 // GetLogConfig returns logging configuration
 func (m *Manager) GetLogConfig() types.LogConfig {
-	return m.config.Log
+	return m.current().Log
+}
+
+// GetRateLimitConfig returns per-client rate limiting configuration
+func (m *Manager) GetRateLimitConfig() types.RateLimitConfig {
+	return m.current().RateLimit
+}
+
+// GetRoutingConfig returns model routing configuration
+func (m *Manager) GetRoutingConfig() types.RoutingConfig {
+	return m.current().Routing
+}
+
+// GetQuotaConfig returns caller quota configuration
+func (m *Manager) GetQuotaConfig() types.QuotaConfig {
+	return m.current().Quota
+}
+
+// GetScheduler returns the shared background task scheduler
+func (m *Manager) GetScheduler() types.Scheduler {
+	return m.scheduler
 }
 
 // Validate validates the configuration
 func (m *Manager) Validate() error {
 	var validationErrors []string
 
+	// Report structured values that could not be parsed
+	validationErrors = append(validationErrors, m.parseErrors...)
+
 	// Validate port
 	if m.config.Server.Port < DefaultConstants.MinPort || m.config.Server.Port > DefaultConstants.MaxPort {
 		validationErrors = append(validationErrors, fmt.Sprintf("port must be between %d-%d", DefaultConstants.MinPort, DefaultConstants.MaxPort))
 	}
 
-	// Validate start index
-	if m.config.Keys.StartIndex < 0 {
-		validationErrors = append(validationErrors, "start index cannot be less than 0")
+	// Validate TLS
+	if (m.config.Server.TLSCertFile == "") != (m.config.Server.TLSKeyFile == "") {
+		validationErrors = append(validationErrors, "TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if m.config.Server.TLSEnabled {
+		if _, err := tlscert.ParseVersion(m.config.Server.TLSMinVersion); err != nil {
+			validationErrors = append(validationErrors, err.Error())
+		}
+		if _, err := tlscert.ParseCipherSuites(m.config.Server.TLSCipherSuites); err != nil {
+			validationErrors = append(validationErrors, err.Error())
+		} else if len(m.config.Server.TLSCipherSuites) > 0 && m.config.Server.TLSMinVersion == "TLS1.3" {
+			logrus.Warn("TLS_CIPHER_SUITES has no effect with TLS_MIN_VERSION=TLS1.3, TLS 1.3 suites are not configurable")
+		}
 	}
 
-	// Validate blacklist threshold
-	if m.config.Keys.BlacklistThreshold < 1 {
-		validationErrors = append(validationErrors, "blacklist threshold cannot be less than 1")
+	// Validate request ID format
+	switch m.config.Server.RequestIDFormat {
+	case RequestIDFormatUUID, RequestIDFormatHex16, RequestIDFormatSnowflake:
+	default:
+		validationErrors = append(validationErrors, fmt.Sprintf("invalid request ID format: %s (must be %s, %s or %s)", m.config.Server.RequestIDFormat, RequestIDFormatUUID, RequestIDFormatHex16, RequestIDFormatSnowflake))
+	}
+	if m.config.Server.SnowflakeMachineID != -1 && (m.config.Server.SnowflakeMachineID < 0 || m.config.Server.SnowflakeMachineID > snowflakeMaxMachineID) {
+		validationErrors = append(validationErrors, fmt.Sprintf("snowflake machine ID must be between 0-%d", snowflakeMaxMachineID))
 	}
 
-	// Validate timeout
-	if m.config.OpenAI.RequestTimeout < DefaultConstants.MinTimeout {
-		validationErrors = append(validationErrors, fmt.Sprintf("request timeout cannot be less than %ds", DefaultConstants.MinTimeout))
+	if m.config.Server.SelfTestOnStartup && m.config.Server.SelfTestTimeoutSeconds < 1 {
+		validationErrors = append(validationErrors, "self-test timeout cannot be less than 1s")
 	}
 
-	// Validate upstream URL format
-	if len(m.config.OpenAI.BaseURLs) == 0 {
-		validationErrors = append(validationErrors, "at least one upstream API URL is required")
+	if m.config.Server.SSEHeartbeatIntervalSeconds < 0 {
+		validationErrors = append(validationErrors, "SSE heartbeat interval cannot be negative")
 	}
-	for _, baseURL := range m.config.OpenAI.BaseURLs {
-		if _, err := url.Parse(baseURL); err != nil {
-			validationErrors = append(validationErrors, fmt.Sprintf("invalid upstream API URL format: %s", baseURL))
+
+	// Validate error templates
+	if m.config.Server.ErrorTemplatesFile != "" {
+		if _, err := errors.ParseTemplateFile(m.config.Server.ErrorTemplatesFile); err != nil {
+			validationErrors = append(validationErrors, fmt.Sprintf("invalid error templates: %v", err))
 		}
 	}
 
-	// Validate performance configuration
-	if m.config.Performance.MaxConcurrentRequests < 1 {
-		validationErrors = append(validationErrors, "max concurrent requests cannot be less than 1")
+	// Validate start index
+	if m.config.Keys.StartIndex < 0 {
+		validationErrors = append(validationErrors, "start index cannot be less than 0")
 	}
 
-	if len(validationErrors) > 0 {
-		logrus.Error("Configuration validation failed:")
-		for _, err := range validationErrors {
-			logrus.Errorf("   - %s", err)
-		}
-		return errors.NewAppErrorWithDetails(errors.ErrConfigValidation, "Configuration validation failed", strings.Join(validationErrors, "; "))
+	// The key file replaces API_KEYS rather than adding to it
+	if m.config.Keys.KeyFilePath != "" && len(m.config.Keys.APIKeys) > 0 {
+		logrus.Warn("KEY_FILE_PATH is set, API_KEYS will be ignored")
 	}
 
-	return nil
-}
+	// Validate key fetching, which replaces both the key file and API_KEYS
+	if m.config.Keys.KeyFetchURL != "" {
+		if parsed, err := url.Parse(m.config.Keys.KeyFetchURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			validationErrors = append(validationErrors, "invalid KEY_FETCH_URL: must be an http or https URL")
+		}
+		if m.config.Keys.KeyFetchIntervalSeconds < 1 {
+			validationErrors = append(validationErrors, "KEY_FETCH_INTERVAL_SECONDS must be at least 1")
+		}
+		if m.config.Keys.KeyFetchAuthHeader != "" {
+			if name, _, found := strings.Cut(m.config.Keys.KeyFetchAuthHeader, ":"); !found || !headerNamePattern.MatchString(strings.TrimSpace(name)) {
+				validationErrors = append(validationErrors, "invalid KEY_FETCH_AUTH_HEADER: expected <header>: <value>")
+			}
+		}
+		if m.config.Keys.KeyFilePath != "" || len(m.config.Keys.APIKeys) > 0 {
+			logrus.Warn("KEY_FETCH_URL is set, KEY_FILE_PATH and API_KEYS will be ignored")
+		}
+	}
 
-// DisplayConfig displays current configuration information
-func (m *Manager) DisplayConfig() {
-	logrus.Info("Current Configuration:")
-	logrus.Infof("   Server: %s:%d", m.config.Server.Host, m.config.Server.Port)
-	logrus.Infof("   API Keys loaded: %d", len(m.config.Keys.APIKeys))
-	logrus.Infof("   Start index: %d", m.config.Keys.StartIndex)
-	logrus.Infof("   Blacklist threshold: %d errors", m.config.Keys.BlacklistThreshold)
-	logrus.Infof("   Max retries: %d", m.config.Keys.MaxRetries)
-	logrus.Infof("   Upstream URLs: %s", strings.Join(m.config.OpenAI.BaseURLs, ", "))
-	logrus.Infof("   Request timeout: %ds", m.config.OpenAI.RequestTimeout)
-	logrus.Infof("   Response timeout: %ds", m.config.OpenAI.ResponseTimeout)
-	logrus.Infof("   Idle connection timeout: %ds", m.config.OpenAI.IdleConnTimeout)
+	// Validate the AWS secret, whose keys replace the key file and API_KEYS unless it cannot be read
+	if m.config.Keys.KeyAWSSecretARN != "" {
+		if !strings.HasPrefix(m.config.Keys.KeyAWSSecretARN, "arn:") || !strings.Contains(m.config.Keys.KeyAWSSecretARN, ":secretsmanager:") {
+			validationErrors = append(validationErrors, fmt.Sprintf("invalid KEY_AWS_SECRET_ARN: %s", m.config.Keys.KeyAWSSecretARN))
+		}
+		if m.config.Keys.KeyFetchURL != "" {
+			validationErrors = append(validationErrors, "KEY_FETCH_URL and KEY_AWS_SECRET_ARN cannot both be set")
+		}
+	} else if m.config.Keys.KeyAWSRegion != "" {
+		logrus.Warn("KEY_AWS_REGION is set without KEY_AWS_SECRET_ARN and has no effect")
+	}
 
-	authStatus := "disabled"
-	if m.config.Auth.Enabled {
-		authStatus = "enabled"
+	// Validate key count limit
+	if m.config.Keys.MaxKeyCount < 1 {
+		validationErrors = append(validationErrors, "max key count cannot be less than 1")
+	} else if m.config.Keys.StartIndex >= m.config.Keys.MaxKeyCount {
+		validationErrors = append(validationErrors, fmt.Sprintf("start index %d is past the max key count %d", m.config.Keys.StartIndex, m.config.Keys.MaxKeyCount))
 	}
-	logrus.Infof("   Authentication: %s", authStatus)
 
-	corsStatus := "disabled"
-	if m.config.CORS.Enabled {
-		corsStatus = "enabled"
+	// Validate per-key concurrency limit
+	if m.config.Keys.KeyMaxConcurrent < 0 {
+		validationErrors = append(validationErrors, "KEY_MAX_CONCURRENT cannot be negative")
 	}
-	logrus.Infof("   CORS: %s", corsStatus)
-	logrus.Infof("   Max concurrent requests: %d", m.config.Performance.MaxConcurrentRequests)
 
-	gzipStatus := "disabled"
-	if m.config.Performance.EnableGzip {
-		gzipStatus = "enabled"
+	// Validate per-key rate limit
+	if m.config.Keys.KeyRateLimitRPM < 0 {
+		validationErrors = append(validationErrors, "KEY_RATE_LIMIT_RPM cannot be negative")
+	}
+	switch m.config.Keys.KeyRateLimitAlgorithm {
+	case ratelimit.AlgorithmTokenBucket:
+	case ratelimit.AlgorithmSlidingWindow:
+		if m.config.Keys.KeyRateLimitWindowSeconds < 1 {
+			validationErrors = append(validationErrors, "RATE_LIMIT_WINDOW_SECONDS must be at least 1")
+		}
+	default:
+		validationErrors = append(validationErrors, fmt.Sprintf("invalid rate limit algorithm: %s (use %s or %s)",
+			m.config.Keys.KeyRateLimitAlgorithm, ratelimit.AlgorithmTokenBucket, ratelimit.AlgorithmSlidingWindow))
 	}
-	logrus.Infof("   Gzip compression: %s", gzipStatus)
 
-	requestLogStatus := "enabled"
-	if !m.config.Log.EnableRequest {
-		requestLogStatus = "disabled"
+	// Validate hot standby key
+	if m.config.Keys.HotStandbyKey != "" {
+		if m.config.Keys.HotStandbyBlacklistThreshold < 1 {
+			validationErrors = append(validationErrors, "hot standby blacklist threshold cannot be less than 1")
+		}
+		for _, key := range m.config.Keys.APIKeys {
+			if strings.TrimSpace(key) == m.config.Keys.HotStandbyKey {
+				validationErrors = append(validationErrors, "hot standby key must not also be a regular API key")
+				break
+			}
+		}
 	}
-	logrus.Infof("   Request logging: %s", requestLogStatus)
-}
 
-// Helper functions
+	// Validate retry backoff
+	if m.config.Keys.RetryBaseDelayMs < 0 {
+		validationErrors = append(validationErrors, "retry base delay cannot be negative")
+	} else if m.config.Keys.RetryMaxDelayMs < m.config.Keys.RetryBaseDelayMs {
+		validationErrors = append(validationErrors, "retry max delay cannot be less than the base delay")
+	}
+	if m.config.Keys.RetryJitterFactor < 0 || m.config.Keys.RetryJitterFactor > 1 {
+		validationErrors = append(validationErrors, "retry jitter factor must be between 0.0-1.0")
+	}
 
-// parseInteger parses integer environment variable
-func parseInteger(value string, defaultValue int) int {
-	if value == "" {
-		return defaultValue
+	// Validate blacklist threshold
+	if m.config.Keys.BlacklistThreshold < 1 {
+		validationErrors = append(validationErrors, "blacklist threshold cannot be less than 1")
 	}
-	if parsed, err := strconv.Atoi(value); err == nil {
-		return parsed
+	if m.config.Keys.BlacklistRecoverySeconds < 0 {
+		validationErrors = append(validationErrors, "blacklist recovery delay cannot be less than 0")
+	}
+	if m.config.Keys.StatsResetIntervalHours < 0 {
+		validationErrors = append(validationErrors, "STATS_RESET_INTERVAL_HOURS cannot be negative")
+	}
+	if m.config.Keys.BlacklistProbeEnabled {
+		if m.config.Keys.BlacklistRecoverySeconds == 0 {
+			logrus.Warn("BLACKLIST_PROBE_ENABLED has no effect without BLACKLIST_RECOVERY_AFTER_SECONDS")
+		}
+		if m.config.Keys.KeyProbeTimeoutMs < 1 {
+			validationErrors = append(validationErrors, "key probe timeout cannot be less than 1ms")
+		}
 	}
-	return defaultValue
-}
 
-// parseBoolean parses boolean environment variable
-func parseBoolean(value string, defaultValue bool) bool {
-	if value == "" {
-		return defaultValue
+	// Without an admin key no caller is an admin, so only public capacity headers can be emitted
+	if m.config.Keys.EmitCapacityHeaders && !m.config.Keys.EmitCapacityHeadersPublic && !hasAdminAuthKey(m.config.Auth, m.config.Admin) {
+		logrus.Warn("EMIT_CAPACITY_HEADERS only applies to admin callers, label an AUTH_KEYS entry admin:<key> or set EMIT_CAPACITY_HEADERS_PUBLIC=true to emit them to everyone")
 	}
 
-	lowerValue := strings.ToLower(value)
-	switch lowerValue {
-	case "true", "1", "yes", "on":
-		return true
-	case "false", "0", "no", "off":
-		return false
-	default:
-		return defaultValue
+	// Validate key pool coordination, only Redis stores are supported
+	if m.config.Keys.CoordinationStoreURL != "" {
+		if parsed, err := url.Parse(m.config.Keys.CoordinationStoreURL); err != nil || (parsed.Scheme != "redis" && parsed.Scheme != "rediss") {
+			validationErrors = append(validationErrors, "COORDINATION_STORE_URL must be a redis:// or rediss:// URL")
+		}
+		if m.config.Keys.CoordinationSyncInterval < 1 {
+			validationErrors = append(validationErrors, "coordination sync interval cannot be less than 1s")
+		}
 	}
-}
 
-// parseArray parses array environment variable (comma-separated)
-func parseArray(value string, defaultValue []string) []string {
-	if value == "" {
-		return defaultValue
+	// Validate key state store, reachability is checked when the key manager connects
+	if m.config.Keys.StateStoreURL != "" {
+		if parsed, err := url.Parse(m.config.Keys.StateStoreURL); err != nil || (parsed.Scheme != "redis" && parsed.Scheme != "rediss") {
+			validationErrors = append(validationErrors, "STATE_REDIS_URL must be a redis:// or rediss:// URL")
+		}
 	}
 
-	parts := strings.Split(value, ",")
-	result := make([]string, 0, len(parts))
-	for _, part := range parts {
-		if trimmed := strings.TrimSpace(part); trimmed != "" {
-			result = append(result, trimmed)
+	// Validate blacklist webhook, the URL is left out of the message as it may carry credentials
+	if m.config.Keys.BlacklistWebhookURL != "" {
+		if parsed, err := url.Parse(m.config.Keys.BlacklistWebhookURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			validationErrors = append(validationErrors, "BLACKLIST_WEBHOOK_URL must be an http:// or https:// URL")
 		}
+		if m.config.Keys.BlacklistWebhookSecret == "" {
+			logrus.Warn("BLACKLIST_WEBHOOK_SECRET is not set, blacklist webhooks will be sent unsigned")
+		}
+	} else if m.config.Keys.BlacklistWebhookSecret != "" {
+		logrus.Warn("BLACKLIST_WEBHOOK_SECRET is set without BLACKLIST_WEBHOOK_URL and has no effect")
 	}
 
-	if len(result) == 0 {
-		return defaultValue
+	// A cooldown longer than a request would wait effectively blacklists the key
+	if m.config.Keys.Cooldown429Ms < 0 {
+		validationErrors = append(validationErrors, "key cooldown after 429 cannot be less than 0")
+	} else if m.config.Keys.Cooldown429Ms > m.config.OpenAI.RequestTimeout*1000 {
+		validationErrors = append(validationErrors, fmt.Sprintf("key cooldown after 429 (%dms) cannot exceed the request timeout (%ds)", m.config.Keys.Cooldown429Ms, m.config.OpenAI.RequestTimeout))
 	}
-	return result
-}
 
-// getEnvOrDefault gets environment variable or default value
-func getEnvOrDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
+	// Validate key probing
+	if m.config.Keys.KeyProbeOnStartup {
+		if m.config.Keys.KeyProbeConcurrency < 1 {
+			validationErrors = append(validationErrors, "key probe concurrency cannot be less than 1")
+		}
+		if m.config.Keys.KeyProbeTimeoutMs < 1 {
+			validationErrors = append(validationErrors, "key probe timeout cannot be less than 1ms")
+		}
+		if m.config.Keys.StartupWaitSeconds < 1 {
+			validationErrors = append(validationErrors, "startup wait cannot be less than 1s")
+		}
+	}
+
+	// Validate key error suppression rules
+	for i, rule := range m.config.Keys.ErrorSuppression {
+		if len(rule.KeySuffix) < 4 {
+			validationErrors = append(validationErrors, fmt.Sprintf("key error suppression rule %d: key_suffix must be at least 4 characters", i+1))
+		}
+		if len(rule.SuppressCodes) == 0 {
+			validationErrors = append(validationErrors, fmt.Sprintf("key error suppression rule %d: suppress_codes cannot be empty", i+1))
+		}
+		for _, code := range rule.SuppressCodes {
+			if code < 400 || code > 599 {
+				validationErrors = append(validationErrors, fmt.Sprintf("key error suppression rule %d: suppress code %d is not a 4xx or 5xx status", i+1, code))
+			}
+		}
+		if len(rule.ForModels) == 0 {
+			validationErrors = append(validationErrors, fmt.Sprintf("key error suppression rule %d: for_models cannot be empty", i+1))
+		}
+	}
+
+	// Validate timeout
+	if m.config.OpenAI.RequestTimeout < DefaultConstants.MinTimeout {
+		validationErrors = append(validationErrors, fmt.Sprintf("request timeout cannot be less than %ds", DefaultConstants.MinTimeout))
+	}
+	if m.config.OpenAI.UpstreamConnectTimeoutMs < 0 {
+		validationErrors = append(validationErrors, "upstream connect timeout cannot be negative")
+	}
+	if m.config.OpenAI.UpstreamResponseHeaderTimeoutMs < 0 {
+		validationErrors = append(validationErrors, "upstream response header timeout cannot be negative")
+	}
+	if m.config.OpenAI.DNSCacheTTLSeconds < 0 || m.config.OpenAI.DNSNegativeCacheTTLSeconds < 0 {
+		validationErrors = append(validationErrors, "DNS cache TTLs cannot be negative")
+	}
+	pools := []types.UpstreamPool{{
+		MaxIdleConns:        m.config.OpenAI.UpstreamMaxIdleConns,
+		MaxIdleConnsPerHost: m.config.OpenAI.UpstreamMaxIdleConnsPerHost,
+		MaxConnsPerHost:     m.config.OpenAI.UpstreamMaxConnsPerHost,
+	}}
+	for _, pool := range m.config.OpenAI.UpstreamPools {
+		pools = append(pools, pool)
+	}
+	for _, pool := range pools {
+		if pool.MaxIdleConns < 0 || pool.MaxIdleConnsPerHost < 0 || pool.MaxConnsPerHost < 0 {
+			validationErrors = append(validationErrors, "upstream connection pool sizes cannot be negative")
+			break
+		}
+	}
+
+	// Validate upstream URL format
+	if len(m.config.OpenAI.BaseURLs) == 0 {
+		validationErrors = append(validationErrors, "at least one upstream API URL is required")
+	}
+	for _, baseURL := range m.config.OpenAI.BaseURLs {
+		if _, err := url.Parse(baseURL); err != nil {
+			validationErrors = append(validationErrors, fmt.Sprintf("invalid upstream API URL format: %s", baseURL))
+		}
+	}
+
+	for i, weight := range m.config.OpenAI.BaseURLWeights {
+		if weight < 1 || weight > MaxUpstreamWeight {
+			validationErrors = append(validationErrors, fmt.Sprintf("weight for upstream %s must be between 1-%d", m.config.OpenAI.BaseURLs[i], MaxUpstreamWeight))
+		}
+	}
+
+	// Validate upstream group B
+	for _, baseURL := range m.config.OpenAI.UpstreamBURLs {
+		if parsed, err := url.Parse(baseURL); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			validationErrors = append(validationErrors, fmt.Sprintf("invalid UPSTREAM_B_URLS entry: %s", baseURL))
+		}
+	}
+	if m.config.OpenAI.UpstreamBWeight < 0 || m.config.OpenAI.UpstreamBWeight > 100 {
+		validationErrors = append(validationErrors, "UPSTREAM_B_WEIGHT must be between 0-100")
+	}
+	if len(m.config.OpenAI.UpstreamBURLs) > 0 && m.config.OpenAI.LoadBalanceStrategy == LoadBalanceConsistentHash {
+		logrus.Warn("UPSTREAM_B_URLS is ignored with consistent_hash load balancing, callers stay on their group A upstream")
+	}
+
+	// Validate failover tiers
+	for _, tier := range m.config.OpenAI.UpstreamTiers {
+		for _, baseURL := range tier.BaseURLs {
+			if !slices.Contains(m.config.OpenAI.BaseURLs, baseURL) {
+				validationErrors = append(validationErrors, fmt.Sprintf("UPSTREAM_FAILOVER_ORDER entry %s is not in OPENAI_BASE_URL", baseURL))
+			}
+		}
+	}
+	if len(m.config.OpenAI.UpstreamTiers) > 0 && m.config.OpenAI.LoadBalanceStrategy == LoadBalanceConsistentHash {
+		logrus.Warn("UPSTREAM_FAILOVER_ORDER is ignored with consistent_hash load balancing")
+	}
+
+	// Validate active health checks
+	if m.config.OpenAI.HealthCheckInterval < 0 {
+		validationErrors = append(validationErrors, "health check interval cannot be less than 0")
+	} else if m.config.OpenAI.HealthCheckInterval > 0 {
+		if !strings.HasPrefix(m.config.OpenAI.HealthCheckPath, "/") {
+			validationErrors = append(validationErrors, "HEALTH_CHECK_PATH must start with /")
+		}
+		if m.config.OpenAI.HealthCheckFailThreshold < 1 || m.config.OpenAI.HealthCheckRecoverThreshold < 1 {
+			validationErrors = append(validationErrors, "health check fail and recover thresholds cannot be less than 1")
+		}
+	}
+
+	// Validate circuit breaker
+	if m.config.OpenAI.CircuitFailThreshold < 0 {
+		validationErrors = append(validationErrors, "circuit breaker fail threshold cannot be less than 0")
+	} else if m.config.OpenAI.CircuitFailThreshold > 0 {
+		if m.config.OpenAI.CircuitSuccessThreshold < 1 {
+			validationErrors = append(validationErrors, "circuit breaker success threshold cannot be less than 1")
+		}
+		if m.config.OpenAI.CircuitOpenTimeout < 1 {
+			validationErrors = append(validationErrors, "circuit breaker timeout cannot be less than 1s")
+		}
+	}
+
+	// Validate load balancing
+	switch m.config.OpenAI.LoadBalanceStrategy {
+	case LoadBalanceRoundRobin, LoadBalanceLeastConnections, LoadBalanceRandom, LoadBalanceWeighted, LoadBalanceLeastLatency:
+	case LoadBalanceConsistentHash:
+		if m.config.OpenAI.ConsistentHashReplicas < 1 {
+			validationErrors = append(validationErrors, "consistent hash replicas cannot be less than 1")
+		}
+	default:
+		validationErrors = append(validationErrors, fmt.Sprintf("invalid load balance strategy: %s (use %s, %s, %s, %s, %s or %s)",
+			m.config.OpenAI.LoadBalanceStrategy, LoadBalanceRoundRobin, LoadBalanceConsistentHash, LoadBalanceLeastConnections,
+			LoadBalanceRandom, LoadBalanceWeighted, LoadBalanceLeastLatency))
+	}
+	if m.config.OpenAI.UpstreamSLAThresholdMs < 0 {
+		validationErrors = append(validationErrors, "upstream SLA threshold cannot be less than 0")
+	} else if m.config.OpenAI.UpstreamSLAThresholdMs > 0 && m.config.OpenAI.LoadBalanceStrategy == LoadBalanceConsistentHash {
+		logrus.Warn("UPSTREAM_SLA_THRESHOLD_MS is ignored with consistent_hash load balancing")
+	}
+
+	if m.config.OpenAI.GenericProxyMode {
+		logrus.Warn("Generic proxy mode is enabled: retries, model tags, status remapping, singleflight, SigV4 and streaming metadata are disabled")
+	}
+
+	// Validate injected body fields
+	for path := range m.config.OpenAI.InjectBodyFields {
+		for _, segment := range strings.Split(path, ".") {
+			if segment == "" {
+				validationErrors = append(validationErrors, fmt.Sprintf("invalid injected body field path %q", path))
+				break
+			}
+		}
+		for other := range m.config.OpenAI.InjectBodyFields {
+			if strings.HasPrefix(other, path+".") {
+				validationErrors = append(validationErrors, fmt.Sprintf("injected body fields %q and %q conflict", path, other))
+			}
+		}
+	}
+
+	// Validate response body limits
+	if m.config.OpenAI.MaxResponseBodySizeMB < 0 {
+		validationErrors = append(validationErrors, "max response body size cannot be less than 0")
+	}
+	for baseURL, limit := range m.config.OpenAI.UpstreamMaxResponseMB {
+		if limit < 1 {
+			validationErrors = append(validationErrors, fmt.Sprintf("max_response_mb for upstream %s must be positive", baseURL))
+		}
+	}
+
+	// Validate upstream query params
+	if _, err := url.ParseQuery(m.config.OpenAI.UpstreamQueryParams); err != nil {
+		validationErrors = append(validationErrors, fmt.Sprintf("invalid UPSTREAM_QUERY_PARAMS: %v", err))
+	}
+
+	if m.config.OpenAI.NormalizeMessageOrder {
+		logrus.Warn("NORMALIZE_MESSAGE_ORDER is enabled, moving system messages to the front may change model behavior in multi-turn conversations")
+	}
+
+	// Broadcasting completions multiplies token cost by the number of upstreams
+	if m.config.OpenAI.BroadcastEnabled {
+		for _, path := range m.config.OpenAI.BroadcastPaths {
+			if path == "/v1/chat/completions" {
+				logrus.Warnf("BROADCAST_PATHS contains %s, every request will be billed by all %d upstreams", path, len(m.config.OpenAI.BaseURLs))
+			}
+		}
+	}
+
+	// Validate fallback upstream
+	if m.config.OpenAI.FallbackUpstreamURL != "" {
+		if parsed, err := url.Parse(m.config.OpenAI.FallbackUpstreamURL); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			validationErrors = append(validationErrors, fmt.Sprintf("invalid fallback upstream URL: %s", m.config.OpenAI.FallbackUpstreamURL))
+		}
+	}
+
+	// Validate mirror upstream
+	if m.config.OpenAI.MirrorURL != "" {
+		if parsed, err := url.Parse(m.config.OpenAI.MirrorURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			validationErrors = append(validationErrors, "MIRROR_URL must be an http or https URL")
+		}
+		if m.config.OpenAI.MirrorSampleRate < 0 || m.config.OpenAI.MirrorSampleRate > 1 {
+			validationErrors = append(validationErrors, "MIRROR_SAMPLE_RATE must be between 0.0 and 1.0")
+		}
+		if m.config.OpenAI.MirrorTimeoutMs < 1 {
+			validationErrors = append(validationErrors, "MIRROR_TIMEOUT_MS must be at least 1")
+		}
+	}
+
+	// Validate upstream key header
+	if !headerNamePattern.MatchString(m.config.OpenAI.KeyHeader) {
+		validationErrors = append(validationErrors, fmt.Sprintf("invalid UPSTREAM_KEY_HEADER: %q is not a valid HTTP header name", m.config.OpenAI.KeyHeader))
+	}
+	if m.config.OpenAI.ForwardRequestIDToUpstream && !headerNamePattern.MatchString(m.config.OpenAI.UpstreamRequestIDHeader) {
+		validationErrors = append(validationErrors, fmt.Sprintf("invalid UPSTREAM_REQUEST_ID_HEADER: %q is not a valid HTTP header name", m.config.OpenAI.UpstreamRequestIDHeader))
+	}
+	if m.config.OpenAI.CaptureUpstreamIDHeader != "" && !headerNamePattern.MatchString(m.config.OpenAI.CaptureUpstreamIDHeader) {
+		validationErrors = append(validationErrors, fmt.Sprintf("invalid CAPTURE_UPSTREAM_REQUEST_ID_HEADER: %q is not a valid HTTP header name", m.config.OpenAI.CaptureUpstreamIDHeader))
+	}
+	if !strings.Contains(m.config.OpenAI.KeyFormat, "{key}") {
+		validationErrors = append(validationErrors, "UPSTREAM_KEY_FORMAT must contain {key}")
+	}
+
+	// Validate upstream type
+	switch m.config.OpenAI.UpstreamType {
+	case UpstreamTypeOpenAI:
+	case UpstreamTypeAzure:
+		if m.config.OpenAI.AzureAPIVersion == "" {
+			validationErrors = append(validationErrors, "AZURE_API_VERSION is required when UPSTREAM_TYPE=azure")
+		}
+	case UpstreamTypeAnthropic:
+		if m.config.OpenAI.AnthropicAPIVersion == "" {
+			validationErrors = append(validationErrors, "ANTHROPIC_API_VERSION is required when UPSTREAM_TYPE=anthropic")
+		}
+	default:
+		validationErrors = append(validationErrors, fmt.Sprintf("invalid UPSTREAM_TYPE: %s (must be openai, azure or anthropic)", m.config.OpenAI.UpstreamType))
+	}
+	if m.config.OpenAI.UpstreamType != UpstreamTypeOpenAI {
+		if m.config.OpenAI.GenericProxyMode {
+			validationErrors = append(validationErrors, fmt.Sprintf("UPSTREAM_TYPE=%s cannot be combined with GENERIC_PROXY_MODE", m.config.OpenAI.UpstreamType))
+		}
+		if m.config.OpenAI.KeyHeader != "Authorization" || m.config.OpenAI.KeyFormat != "Bearer {key}" {
+			logrus.Warnf("UPSTREAM_TYPE=%s sends the key in its own header, UPSTREAM_KEY_HEADER and UPSTREAM_KEY_FORMAT are ignored", m.config.OpenAI.UpstreamType)
+		}
+	}
+	if m.config.OpenAI.UpstreamType != UpstreamTypeAzure && len(m.config.OpenAI.AzureDeployments) > 0 {
+		logrus.Warn("AZURE_DEPLOYMENT_MAP only applies when UPSTREAM_TYPE=azure")
+	}
+
+	// Validate model tags, keys are used as Prometheus label names
+	for model, tags := range m.config.OpenAI.ModelTags {
+		for key := range tags {
+			if !logFieldNamePattern.MatchString(key) {
+				validationErrors = append(validationErrors, fmt.Sprintf("invalid tag key %q for model %s: use letters, digits and underscores", key, model))
+			}
+		}
+	}
+
+	// Validate latency-based ordering
+	if m.config.OpenAI.LatencySortInterval < 0 {
+		validationErrors = append(validationErrors, "upstream latency sort interval cannot be less than 0")
+	} else if m.config.OpenAI.LatencySortInterval > 0 && m.config.OpenAI.LatencyWindow < 1 {
+		validationErrors = append(validationErrors, "upstream latency window cannot be less than 1")
+	}
+
+	// Validate timeout warning
+	if m.config.OpenAI.TimeoutWarningPercent < 0 || m.config.OpenAI.TimeoutWarningPercent > 100 {
+		validationErrors = append(validationErrors, "timeout warning percent must be between 0-100")
+	}
+
+	// Validate upstream connect rate limit
+	if m.config.OpenAI.MaxConnectAttemptsPerSecond < 0 {
+		validationErrors = append(validationErrors, "upstream max connect attempts per second cannot be less than 0")
+	} else if m.config.OpenAI.MaxConnectAttemptsPerSecond > 0 && len(m.config.OpenAI.BaseURLs) > 0 {
+		perUpstream := m.config.Performance.MaxConcurrentRequests / len(m.config.OpenAI.BaseURLs)
+		if m.config.OpenAI.MaxConnectAttemptsPerSecond < perUpstream {
+			logrus.Warnf("Upstream connect limit (%d/s) is below the per-upstream share of max concurrent requests (%d), cold starts may be throttled",
+				m.config.OpenAI.MaxConnectAttemptsPerSecond, perUpstream)
+		}
+	}
+
+	if m.config.OpenAI.StreamingMetadataEventEnabled {
+		logrus.Warn("Streaming metadata events are enabled, clients that parse SSE strictly may break on the non-standard gptload_metadata event")
+	}
+
+	if m.config.OpenAI.ForwardResponseTrailers {
+		logrus.Warn("Response trailer forwarding is enabled, most HTTP/1.1 clients ignore trailers, this is mainly useful with HTTP/2")
+	}
+
+	// Validate SigV4 signing
+	if m.config.OpenAI.AWSSigV4Enabled {
+		if m.config.OpenAI.AWSAccessKeyID == "" || m.config.OpenAI.AWSSecretAccessKey == "" {
+			validationErrors = append(validationErrors, "AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required when SigV4 signing is enabled")
+		}
+		if m.config.OpenAI.AWSRegion == "" {
+			validationErrors = append(validationErrors, "AWS_REGION is required when SigV4 signing is enabled")
+		}
+		if !sigV4ServicePattern.MatchString(m.config.OpenAI.AWSSigV4Service) {
+			validationErrors = append(validationErrors, fmt.Sprintf("invalid AWS_SIGV4_SERVICE %q", m.config.OpenAI.AWSSigV4Service))
+		}
+	}
+
+	// Validate upstream mTLS
+	if (m.config.OpenAI.UpstreamTLSCertFile == "") != (m.config.OpenAI.UpstreamTLSKeyFile == "") {
+		validationErrors = append(validationErrors, "UPSTREAM_TLS_CERT_FILE and UPSTREAM_TLS_KEY_FILE must be set together")
+	}
+	for index, override := range m.config.OpenAI.UpstreamTLSCerts {
+		if index < 0 || index >= len(m.config.OpenAI.BaseURLs) {
+			validationErrors = append(validationErrors, fmt.Sprintf("upstream TLS certificate override %d has no matching upstream URL", index))
+		} else if override.CertFile == "" || override.KeyFile == "" {
+			validationErrors = append(validationErrors, fmt.Sprintf("UPSTREAM_TLS_CERT_FILE_%d and UPSTREAM_TLS_KEY_FILE_%d must be set together", index, index))
+		}
+	}
+	if m.config.OpenAI.UpstreamTLSSkipVerify {
+		logrus.Warn("UPSTREAM_TLS_SKIP_VERIFY is enabled: upstream certificates are NOT verified and connections can be intercepted, never use this in production")
+	}
+
+	// Validate upstream status remapping
+	for source, target := range m.config.OpenAI.StatusRemap {
+		if source < 100 || source > 599 || target < 100 || target > 599 {
+			validationErrors = append(validationErrors, fmt.Sprintf("invalid status remap %d->%d: codes must be between 100-599", source, target))
+		} else if source/100 == 2 && target/100 == 2 {
+			validationErrors = append(validationErrors, fmt.Sprintf("status remap %d->%d is vacuous: both codes are 2xx", source, target))
+		}
+	}
+
+	// Validate JWKS configuration
+	if m.config.Auth.JWKSURL != "" {
+		if parsed, err := url.Parse(m.config.Auth.JWKSURL); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			validationErrors = append(validationErrors, fmt.Sprintf("invalid JWKS URL: %s", m.config.Auth.JWKSURL))
+		}
+		if m.config.Auth.JWKSRefreshInterval < 1 {
+			validationErrors = append(validationErrors, "JWKS refresh interval cannot be less than 1s")
+		}
+	} else if m.config.Auth.JWTAudience != "" {
+		logrus.Warn("AUTH_JWT_AUDIENCE is set without a JWKS URL and has no effect")
+	}
+
+	for _, path := range m.config.Auth.ExemptPaths {
+		if !strings.HasPrefix(path, "/") || strings.Contains(strings.TrimSuffix(path, "*"), "*") {
+			validationErrors = append(validationErrors, fmt.Sprintf("invalid AUTH_EXEMPT_PATHS entry %q: must start with / and may only end in *", path))
+		}
+	}
+
+	// Validate client IP filtering
+	for _, entry := range append(append([]string(nil), m.config.Auth.IPAllowlist...), m.config.Auth.IPBlocklist...) {
+		if !isIPOrCIDR(entry) {
+			validationErrors = append(validationErrors, fmt.Sprintf("invalid IP or CIDR range: %s", entry))
+		}
+	}
+	// Probe routes must not collide with each other or the management endpoints
+	for _, path := range []string{m.config.Server.HealthPath, m.config.Server.ReadyPath} {
+		if !strings.HasPrefix(path, "/") || slices.Contains(managementPaths, path) {
+			validationErrors = append(validationErrors, fmt.Sprintf("invalid probe path %q: must start with / and not be a management endpoint", path))
+		}
+	}
+	if m.config.Server.HealthPath == m.config.Server.ReadyPath {
+		validationErrors = append(validationErrors, "HEALTH_PATH and READY_PATH must differ")
+	}
+	for _, entry := range m.config.Server.TrustedProxyCIDRs {
+		if !isIPOrCIDR(entry) {
+			validationErrors = append(validationErrors, fmt.Sprintf("invalid trusted proxy IP or CIDR range: %s", entry))
+		}
+	}
+	if header := m.config.Auth.ClientIPHeader; header != "" && !headerNamePattern.MatchString(header) {
+		validationErrors = append(validationErrors, fmt.Sprintf("invalid client IP header name: %s", header))
+	}
+
+	// Validate admin server
+	if m.config.Admin.Enabled {
+		if m.config.Admin.Port < DefaultConstants.MinPort || m.config.Admin.Port > DefaultConstants.MaxPort {
+			validationErrors = append(validationErrors, fmt.Sprintf("admin port must be between %d-%d", DefaultConstants.MinPort, DefaultConstants.MaxPort))
+		} else if m.config.Admin.Port == m.config.Server.Port {
+			validationErrors = append(validationErrors, "admin port must differ from the server port")
+		}
+		if slices.Contains(m.config.Auth.Keys, m.config.Admin.AuthKey) {
+			validationErrors = append(validationErrors, "ADMIN_AUTH_KEY must differ from every AUTH_KEYS key")
+		}
+	}
+
+	// Validate metrics server
+	if m.config.Metrics.Enabled {
+		if m.config.Metrics.Port < DefaultConstants.MinPort || m.config.Metrics.Port > DefaultConstants.MaxPort {
+			validationErrors = append(validationErrors, fmt.Sprintf("metrics port must be between %d-%d", DefaultConstants.MinPort, DefaultConstants.MaxPort))
+		} else if m.config.Metrics.Port == m.config.Server.Port || (m.config.Admin.Enabled && m.config.Metrics.Port == m.config.Admin.Port) {
+			validationErrors = append(validationErrors, "metrics port must differ from the server and admin ports")
+		}
+	}
+
+	// Validate request ID header
+	if !headerNamePattern.MatchString(m.config.Log.RequestIDHeader) {
+		validationErrors = append(validationErrors, fmt.Sprintf("invalid LOG_REQUEST_ID_HEADER: %q is not a valid HTTP header name", m.config.Log.RequestIDHeader))
+	}
+
+	// Validate extracted log fields
+	for header, field := range m.config.Log.ExtractHeaders {
+		if !logFieldNamePattern.MatchString(field) {
+			validationErrors = append(validationErrors, fmt.Sprintf("invalid log field name %q for header %s: use letters, digits and underscores", field, header))
+		}
+	}
+
+	// Validate log file rotation
+	if m.config.Log.FileMaxSizeMB < 1 {
+		validationErrors = append(validationErrors, "LOG_FILE_MAX_SIZE_MB must be at least 1")
+	}
+	if m.config.Log.FileMaxBackups < 0 {
+		validationErrors = append(validationErrors, "LOG_FILE_MAX_BACKUPS cannot be negative")
+	}
+	if m.config.Log.FileMaxAgeDays < 0 {
+		validationErrors = append(validationErrors, "LOG_FILE_MAX_AGE_DAYS cannot be negative")
+	}
+
+	if !m.config.Log.MaskKeys {
+		logrus.Warn("LOG_MASK_KEYS is disabled, API keys will appear in full in logs and admin responses")
+	}
+
+	// Validate JSON request log fields
+	for _, field := range m.config.Log.RequestFields {
+		if !types.IsRequestLogField(field) {
+			validationErrors = append(validationErrors, fmt.Sprintf("invalid LOG_REQUEST_FIELDS entry %q: must be one of %s", field, strings.Join(types.RequestLogFields, ", ")))
+		}
+	}
+
+	// Never let an exclusion swallow API request logs
+	for _, prefix := range m.config.Log.ExcludePaths {
+		lowered := strings.ToLower(prefix)
+		if !strings.HasPrefix(lowered, "/") || strings.HasPrefix(lowered, "/v1") || strings.HasPrefix("/v1", lowered) {
+			validationErrors = append(validationErrors, fmt.Sprintf("invalid LOG_EXCLUDE_PATHS prefix %q: must start with / and not match /v1 paths", prefix))
+		}
+	}
+
+	// Compile body redaction patterns
+	if _, err := redact.New(m.config.Log.BodyRedactPatterns); err != nil {
+		validationErrors = append(validationErrors, fmt.Sprintf("invalid body redaction pattern: %v", err))
+	}
+
+	if m.config.Log.CloneRequestForAudit && !m.config.Log.AuditLogEnabled {
+		validationErrors = append(validationErrors, "CLONE_REQUEST_FOR_AUDIT requires AUDIT_LOG_ENABLED=true")
+	}
+
+	// Validate routing rules
+	for prefix, baseURLs := range m.config.Routing.Rules {
+		for _, baseURL := range baseURLs {
+			if parsed, err := url.Parse(baseURL); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+				validationErrors = append(validationErrors, fmt.Sprintf("invalid upstream URL %s in routing rule for %s", baseURL, prefix))
+			}
+		}
+	}
+
+	// Validate quotas
+	// Validate per-client rate limiting
+	if m.config.RateLimit.Enabled {
+		if m.config.RateLimit.RequestsPerMinute < 1 {
+			validationErrors = append(validationErrors, "rate limit requests per minute cannot be less than 1")
+		}
+		if m.config.RateLimit.BurstSize < 1 {
+			validationErrors = append(validationErrors, "rate limit burst size cannot be less than 1")
+		}
+		if m.config.RateLimit.EntryTTLSeconds < 1 {
+			validationErrors = append(validationErrors, "rate limit entry TTL cannot be less than 1s")
+		}
+	}
+
+	if m.config.Quota.Enabled {
+		if m.config.Quota.Period != "daily" && m.config.Quota.Period != "monthly" {
+			validationErrors = append(validationErrors, fmt.Sprintf("invalid quota period: %s (use daily or monthly)", m.config.Quota.Period))
+		}
+		if len(m.config.Quota.Quotas) == 0 {
+			logrus.Warn("Quota tracking is enabled but QUOTAS is empty, no caller is limited")
+		}
+	}
+	for caller, limit := range m.config.Quota.Quotas {
+		if limit.Requests < 0 || limit.Tokens < 0 {
+			validationErrors = append(validationErrors, fmt.Sprintf("quota values cannot be negative (caller %s)", maskValue(caller)))
+		}
+	}
+
+	// Validate performance configuration
+	if m.config.Performance.MaxConcurrentRequests < 1 {
+		validationErrors = append(validationErrors, "max concurrent requests cannot be less than 1")
+	}
+	if m.config.Performance.MaxQueueSize < 0 {
+		validationErrors = append(validationErrors, "MAX_QUEUE_SIZE cannot be negative")
+	}
+	if m.config.Performance.MaxQueueSize > 0 && m.config.Performance.QueueTimeoutMs < 1 {
+		validationErrors = append(validationErrors, "QUEUE_TIMEOUT_MS must be at least 1 when MAX_QUEUE_SIZE is set")
+	}
+	if m.config.Performance.MaxSSEEventsPerResponse < 0 {
+		validationErrors = append(validationErrors, "max SSE events per response cannot be less than 0")
+	}
+	switch m.config.Performance.ResponseBuffering {
+	case ResponseBufferingNone, ResponseBufferingFull:
+	default:
+		validationErrors = append(validationErrors, fmt.Sprintf("invalid response buffering mode: %s (must be %s or %s)", m.config.Performance.ResponseBuffering, ResponseBufferingNone, ResponseBufferingFull))
+	}
+	if m.config.Performance.MaxRequestBodyBytes < 0 {
+		validationErrors = append(validationErrors, "max request body size cannot be less than 0")
+	}
+	if m.config.Performance.MaxResponseBodyBytes < 0 {
+		validationErrors = append(validationErrors, "max response body bytes cannot be less than 0")
+	}
+	if m.config.Performance.CacheEnabled {
+		if m.config.Performance.CacheTTLSeconds < 1 {
+			validationErrors = append(validationErrors, "cache TTL cannot be less than 1s")
+		}
+		if m.config.Performance.CacheMaxSizeMB < 1 {
+			validationErrors = append(validationErrors, "cache max size cannot be less than 1MB")
+		}
+	}
+	if m.config.Performance.OTELEnabled {
+		if parsed, err := url.Parse(m.config.Performance.OTELEndpoint); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			validationErrors = append(validationErrors, fmt.Sprintf("invalid OTEL_ENDPOINT: %s", m.config.Performance.OTELEndpoint))
+		}
+	}
+
+	if len(validationErrors) > 0 {
+		logrus.Error("Configuration validation failed:")
+		for _, err := range validationErrors {
+			logrus.Errorf("   - %s", err)
+		}
+		return errors.NewAppErrorWithDetails(errors.ErrConfigValidation, "Configuration validation failed", strings.Join(validationErrors, "; "))
+	}
+
+	return nil
+}
+
+// DisplayConfig displays current configuration information
+func (m *Manager) DisplayConfig() {
+	logrus.Info("Current Configuration:")
+	logrus.Infof("   Server: %s:%d", m.config.Server.Host, m.config.Server.Port)
+	if m.config.Server.TLSEnabled {
+		logrus.Infof("   TLS: %s (min %s)", m.config.Server.TLSCertFile, m.config.Server.TLSMinVersion)
+	}
+	if m.config.Server.HealthResponseTemplate != "" {
+		logrus.Infof("   Health response: custom template")
+	}
+	if m.config.Server.SelfTestOnStartup {
+		logrus.Infof("   Startup self-test: enabled (timeout: %ds, fail fast: %t)", m.config.Server.SelfTestTimeoutSeconds, m.config.Server.SelfTestFailFast)
+	}
+	if m.config.Server.RequestIDFormat != RequestIDFormatUUID {
+		logrus.Infof("   Request ID format: %s", m.config.Server.RequestIDFormat)
+	}
+	if m.config.Server.ErrorTemplatesFile != "" {
+		logrus.Infof("   Error templates: %s", m.config.Server.ErrorTemplatesFile)
+	}
+	if m.config.Server.SSEHeartbeatIntervalSeconds > 0 {
+		logrus.Infof("   SSE heartbeat: every %ds of idle stream", m.config.Server.SSEHeartbeatIntervalSeconds)
+	}
+	logrus.Infof("   API Keys loaded: %d", len(m.config.Keys.APIKeys))
+	if m.config.Keys.KeyFetchURL != "" {
+		logrus.Infof("   Key fetch URL: [CONFIGURED] (refresh every %ds)", m.config.Keys.KeyFetchIntervalSeconds)
+	} else if m.config.Keys.KeyAWSSecretARN != "" {
+		logrus.Infof("   AWS secret: %s", m.config.Keys.KeyAWSSecretARN)
+	} else if m.config.Keys.KeyFilePath != "" {
+		logrus.Infof("   Key file: %s (reload with SIGHUP)", m.config.Keys.KeyFilePath)
+	}
+	if m.config.Keys.HotStandbyKey != "" {
+		logrus.Infof("   Hot standby key: [STANDBY KEY CONFIGURED] (threshold: %d)", m.config.Keys.HotStandbyBlacklistThreshold)
+	}
+	logrus.Infof("   Start index: %d", m.config.Keys.StartIndex)
+	logrus.Infof("   Blacklist threshold: %d errors", m.config.Keys.BlacklistThreshold)
+	if m.config.Keys.BlacklistRecoverySeconds > 0 {
+		logrus.Infof("   Blacklist recovery: after %ds (probe: %t)", m.config.Keys.BlacklistRecoverySeconds, m.config.Keys.BlacklistProbeEnabled)
+	}
+	if m.config.Keys.StatsResetIntervalHours > 0 {
+		logrus.Infof("   Key usage stats: reset every %dh", m.config.Keys.StatsResetIntervalHours)
+	}
+	if m.config.Keys.EmitCapacityHeaders {
+		logrus.Infof("   Capacity headers: enabled (public: %t)", m.config.Keys.EmitCapacityHeadersPublic)
+	}
+	if m.config.Keys.CoordinationStoreURL != "" {
+		logrus.Infof("   Key pool coordination: enabled (sync every %ds)", m.config.Keys.CoordinationSyncInterval)
+	}
+	if m.config.Keys.StateStoreURL != "" {
+		logrus.Info("   Key state persistence: enabled")
+	}
+	if m.config.Keys.BlacklistWebhookURL != "" {
+		logrus.Infof("   Blacklist webhook: enabled (signed: %t)", m.config.Keys.BlacklistWebhookSecret != "")
+	}
+	if m.config.Keys.Cooldown429Ms > 0 {
+		logrus.Infof("   Key cooldown after 429: %dms", m.config.Keys.Cooldown429Ms)
+	}
+	if m.config.Keys.KeyMaxConcurrent > 0 {
+		logrus.Infof("   Max concurrent requests per key: %d", m.config.Keys.KeyMaxConcurrent)
+	}
+	if m.config.Keys.KeyRateLimitRPM > 0 {
+		if m.config.Keys.KeyRateLimitAlgorithm == ratelimit.AlgorithmSlidingWindow {
+			logrus.Infof("   Rate limit per key: %d requests/minute (%s, %ds window)", m.config.Keys.KeyRateLimitRPM,
+				m.config.Keys.KeyRateLimitAlgorithm, m.config.Keys.KeyRateLimitWindowSeconds)
+		} else {
+			logrus.Infof("   Rate limit per key: %d requests/minute (%s)", m.config.Keys.KeyRateLimitRPM, m.config.Keys.KeyRateLimitAlgorithm)
+		}
+	}
+	logrus.Infof("   Max retries: %d", m.config.Keys.MaxRetries)
+	if m.config.Keys.RetryBaseDelayMs > 0 {
+		logrus.Infof("   Retry backoff: %dms base, %dms max, jitter %.2f", m.config.Keys.RetryBaseDelayMs, m.config.Keys.RetryMaxDelayMs, m.config.Keys.RetryJitterFactor)
+	}
+	logrus.Infof("   Retry on upstream status codes: %v", m.config.Keys.RetryStatusCodes)
+	logrus.Infof("   Retry with another key on 401/403: %t/%t", m.config.Keys.RetryOn401, m.config.Keys.RetryOn403)
+	if m.config.Keys.KeyProbeOnStartup {
+		logrus.Infof("   Key probe on startup: enabled (concurrency %d, timeout %dms, budget %ds)",
+			m.config.Keys.KeyProbeConcurrency, m.config.Keys.KeyProbeTimeoutMs, m.config.Keys.StartupWaitSeconds)
+	}
+	if len(m.config.Keys.ErrorSuppression) > 0 {
+		logrus.Infof("   Key error suppression rules: %d", len(m.config.Keys.ErrorSuppression))
+	}
+	logrus.Infof("   Upstream URLs: %s", strings.Join(m.config.OpenAI.BaseURLs, ", "))
+	if len(m.config.OpenAI.UpstreamBURLs) > 0 {
+		logrus.Infof("   Upstream group B: %s (%d%% of requests)", strings.Join(m.config.OpenAI.UpstreamBURLs, ", "), m.config.OpenAI.UpstreamBWeight)
+	}
+	if m.weightedSlots != nil {
+		logrus.Infof("   Upstream weights: %v", m.config.OpenAI.BaseURLWeights)
+	}
+	for i, tier := range m.failoverTiers {
+		logrus.Infof("   Upstream tier %d (%s): %s", i+1, tier.Name, strings.Join(tier.BaseURLs, ", "))
+	}
+	if m.config.OpenAI.HealthCheckInterval > 0 {
+		logrus.Infof("   Upstream health checks: GET %s every %ds (fail: %d, recover: %d)", m.config.OpenAI.HealthCheckPath, m.config.OpenAI.HealthCheckInterval,
+			m.config.OpenAI.HealthCheckFailThreshold, m.config.OpenAI.HealthCheckRecoverThreshold)
+	}
+	if m.config.OpenAI.CircuitFailThreshold > 0 {
+		logrus.Infof("   Circuit breaker: open after %d failures, probe after %ds, close after %d successes", m.config.OpenAI.CircuitFailThreshold,
+			m.config.OpenAI.CircuitOpenTimeout, m.config.OpenAI.CircuitSuccessThreshold)
+	}
+	if m.config.OpenAI.LoadBalanceStrategy == LoadBalanceConsistentHash {
+		logrus.Infof("   Load balancing: %s (%d replicas)", m.config.OpenAI.LoadBalanceStrategy, m.config.OpenAI.ConsistentHashReplicas)
+	} else {
+		logrus.Infof("   Load balancing: %s", m.config.OpenAI.LoadBalanceStrategy)
+	}
+	logrus.Infof("   Request timeout: %ds", m.config.OpenAI.RequestTimeout)
+	logrus.Infof("   Response timeout: %ds", m.config.OpenAI.ResponseTimeout)
+	if m.config.OpenAI.UpstreamConnectTimeoutMs > 0 {
+		logrus.Infof("   Upstream connect timeout: %dms", m.config.OpenAI.UpstreamConnectTimeoutMs)
+	}
+	if m.config.OpenAI.UpstreamResponseHeaderTimeoutMs > 0 {
+		logrus.Infof("   Upstream response header timeout: %dms", m.config.OpenAI.UpstreamResponseHeaderTimeoutMs)
+	}
+	if m.config.OpenAI.UpstreamSLAThresholdMs > 0 {
+		logrus.Infof("   Upstream latency SLA: %dms", m.config.OpenAI.UpstreamSLAThresholdMs)
+	}
+	logrus.Infof("   Idle connection timeout: %ds", m.config.OpenAI.IdleConnTimeout)
+	if m.config.OpenAI.DNSCacheTTLSeconds > 0 {
+		logrus.Infof("   DNS cache: %ds (not found: %ds)", m.config.OpenAI.DNSCacheTTLSeconds, m.config.OpenAI.DNSNegativeCacheTTLSeconds)
+	}
+	if m.config.OpenAI.UpstreamMaxIdleConns > 0 || m.config.OpenAI.UpstreamMaxIdleConnsPerHost > 0 || m.config.OpenAI.UpstreamMaxConnsPerHost > 0 || len(m.config.OpenAI.UpstreamPools) > 0 {
+		logrus.Infof("   Upstream connection pools: %d idle, %d idle per host, %d per host (%d overrides)", m.config.OpenAI.UpstreamMaxIdleConns,
+			m.config.OpenAI.UpstreamMaxIdleConnsPerHost, m.config.OpenAI.UpstreamMaxConnsPerHost, len(m.config.OpenAI.UpstreamPools))
+	}
+	if m.config.OpenAI.MaxConnectAttemptsPerSecond > 0 {
+		logrus.Infof("   Upstream connect limit: %d/s per upstream", m.config.OpenAI.MaxConnectAttemptsPerSecond)
+	}
+	if m.config.OpenAI.ForwardResponseTrailers {
+		logrus.Infof("   Response trailers: forwarded")
+	}
+	if m.config.OpenAI.GenericProxyMode {
+		logrus.Infof("   Proxy mode: generic")
+	}
+	if m.config.OpenAI.MaxResponseBodySizeMB > 0 {
+		logrus.Infof("   Max response body size: %d MB", m.config.OpenAI.MaxResponseBodySizeMB)
+	}
+	for baseURL, limit := range m.config.OpenAI.UpstreamMaxResponseMB {
+		logrus.Infof("   Max response body size for %s: %d MB", baseURL, limit)
+	}
+	if m.config.OpenAI.FallbackUpstreamURL != "" {
+		logrus.Infof("   Fallback upstream: %s (on %v)", m.config.OpenAI.FallbackUpstreamURL, m.config.OpenAI.FallbackTriggerCodes)
+	}
+	if m.config.OpenAI.MirrorURL != "" {
+		logrus.Infof("   Mirror upstream: %s (%.0f%% of requests, %dms timeout)", m.config.OpenAI.MirrorURL, m.config.OpenAI.MirrorSampleRate*100, m.config.OpenAI.MirrorTimeoutMs)
+	}
+	if len(m.config.OpenAI.InjectBodyFields) > 0 {
+		logrus.Infof("   Injected body fields: %d (override: %t)", len(m.config.OpenAI.InjectBodyFields), m.config.OpenAI.InjectBodyOverride)
+	}
+	if m.config.OpenAI.UpstreamType == UpstreamTypeAzure {
+		logrus.Infof("   Upstream type: Azure OpenAI (api-version %s, %d mapped deployments)", m.config.OpenAI.AzureAPIVersion, len(m.config.OpenAI.AzureDeployments))
+	} else if m.config.OpenAI.UpstreamType == UpstreamTypeAnthropic {
+		logrus.Infof("   Upstream type: Anthropic (version %s)", m.config.OpenAI.AnthropicAPIVersion)
+	} else if m.config.OpenAI.KeyHeader != "Authorization" {
+		logrus.Infof("   Upstream key header: %s", m.config.OpenAI.KeyHeader)
+	}
+	if m.config.OpenAI.UpstreamQueryParams != "" {
+		logrus.Infof("   Upstream query params: [CONFIGURED]")
+	}
+	if m.config.OpenAI.NormalizeMessageOrder {
+		logrus.Infof("   Message order normalization: enabled")
+	}
+	if m.config.OpenAI.BroadcastEnabled {
+		logrus.Infof("   Broadcast paths: %v", m.config.OpenAI.BroadcastPaths)
+	}
+	if m.config.OpenAI.ForwardRequestIDToUpstream {
+		logrus.Infof("   Upstream request ID header: %s", m.config.OpenAI.UpstreamRequestIDHeader)
+	}
+	if m.config.OpenAI.UpstreamUserAgent != "" {
+		logrus.Infof("   Upstream User-Agent: %s", m.config.OpenAI.UpstreamUserAgent)
+	}
+	if len(m.config.OpenAI.ModelTags) > 0 {
+		logrus.Infof("   Tagged models: %d", len(m.config.OpenAI.ModelTags))
+	}
+	if m.config.OpenAI.LatencySortInterval > 0 {
+		logrus.Infof("   Latency ordering: every %ds (window: %d)", m.config.OpenAI.LatencySortInterval, m.config.OpenAI.LatencyWindow)
+	}
+	if m.config.OpenAI.StreamingMetadataEventEnabled {
+		logrus.Infof("   Streaming metadata event: enabled")
+	}
+	if m.config.OpenAI.UpstreamHTTP2Enabled {
+		logrus.Infof("   Upstream HTTP/2: enabled (strict max concurrent streams: %t)", m.config.OpenAI.UpstreamHTTP2StrictStreams)
+	} else {
+		logrus.Infof("   Upstream HTTP/2: disabled")
+	}
+	if m.config.OpenAI.UpstreamTLSCertFile != "" || len(m.config.OpenAI.UpstreamTLSCerts) > 0 {
+		logrus.Infof("   Upstream mTLS: enabled (%d per-upstream certificates)", len(m.config.OpenAI.UpstreamTLSCerts))
+	}
+	if m.config.OpenAI.AWSSigV4Enabled {
+		logrus.Infof("   AWS SigV4 signing: %s (%s)", m.config.OpenAI.AWSSigV4Service, m.config.OpenAI.AWSRegion)
+	}
+	if m.config.OpenAI.TimeoutWarningPercent > 0 {
+		logrus.Infof("   Timeout warning: at %.0f%% of request timeout", m.config.OpenAI.TimeoutWarningPercent)
+	}
+	if len(m.config.OpenAI.StatusRemap) > 0 {
+		logrus.Infof("   Status remapping: %d rules", len(m.config.OpenAI.StatusRemap))
+	}
+
+	authStatus := "disabled"
+	if m.config.Auth.Enabled {
+		authStatus = "enabled"
+	}
+	logrus.Infof("   Authentication: %s", authStatus)
+	if len(m.config.Auth.Keys) > 1 {
+		logrus.Infof("   Auth keys: %d", len(m.config.Auth.Keys))
+	}
+	if m.config.Auth.JWKSURL != "" {
+		logrus.Infof("   JWKS: %s (refresh every %ds)", m.config.Auth.JWKSURL, m.config.Auth.JWKSRefreshInterval)
+		if m.config.Auth.JWTAudience != "" {
+			logrus.Infof("   JWT audience: %s", m.config.Auth.JWTAudience)
+		}
+	}
+	if m.config.Auth.Enabled && len(m.config.Auth.ExemptPaths) > 0 {
+		logrus.Infof("   Auth exempt paths: %v", m.config.Auth.ExemptPaths)
+	}
+	if len(m.config.Auth.IPAllowlist) > 0 || len(m.config.Auth.IPBlocklist) > 0 {
+		clientIPHeader := m.config.Auth.ClientIPHeader
+		if clientIPHeader == "" {
+			clientIPHeader = "X-Real-IP, X-Forwarded-For"
+		}
+		logrus.Infof("   IP filter: %d allowed, %d blocked (client IP from %s)", len(m.config.Auth.IPAllowlist), len(m.config.Auth.IPBlocklist), clientIPHeader)
+	}
+	if !m.config.Server.ForwardClientIP {
+		logrus.Info("   Client IP forwarding: disabled")
+	} else if len(m.config.Server.TrustedProxyCIDRs) > 0 {
+		logrus.Infof("   Trusted proxies: %s", strings.Join(m.config.Server.TrustedProxyCIDRs, ", "))
+	}
+	if m.config.Admin.Enabled {
+		logrus.Infof("   Admin server: %s:%d", m.config.Server.Host, m.config.Admin.Port)
+	}
+	if m.config.Metrics.Enabled {
+		logrus.Infof("   Metrics server: %s:%d", m.config.Server.Host, m.config.Metrics.Port)
+	}
+
+	corsStatus := "disabled"
+	if m.config.CORS.Enabled {
+		corsStatus = "enabled"
+	}
+	logrus.Infof("   CORS: %s", corsStatus)
+	logrus.Infof("   Max concurrent requests: %d", m.config.Performance.MaxConcurrentRequests)
+	if m.config.Performance.MaxQueueSize > 0 {
+		logrus.Infof("   Request queue: %d requests, %dms timeout", m.config.Performance.MaxQueueSize, m.config.Performance.QueueTimeoutMs)
+	}
+	if m.config.Performance.MaxRequestBodyBytes > 0 {
+		logrus.Infof("   Max request body size: %d bytes", m.config.Performance.MaxRequestBodyBytes)
+	}
+	if m.config.Performance.MaxResponseBodyBytes > 0 {
+		logrus.Infof("   Max response body size: %d bytes", m.config.Performance.MaxResponseBodyBytes)
+	}
+	if m.config.Performance.WSEnabled {
+		logrus.Infof("   WebSocket proxying: enabled")
+	}
+
+	gzipStatus := "disabled"
+	if m.config.Performance.EnableGzip {
+		gzipStatus = "enabled"
+	}
+	logrus.Infof("   Gzip compression: %s", gzipStatus)
+
+	if m.config.Performance.EnableBrotli {
+		logrus.Infof("   Brotli compression: enabled")
+	}
+
+	if m.config.Performance.SingleflightEnabled {
+		logrus.Infof("   Singleflight: enabled")
+	}
+	if m.config.Performance.MaxSSEEventsPerResponse > 0 {
+		logrus.Infof("   Max SSE events per response: %d", m.config.Performance.MaxSSEEventsPerResponse)
+	}
+	if m.config.Performance.ResponseBuffering == ResponseBufferingFull {
+		logrus.Info("   Response buffering: full")
+	}
+	if m.config.Performance.CacheEnabled {
+		logrus.Infof("   Response cache: %ds TTL, %dMB max", m.config.Performance.CacheTTLSeconds, m.config.Performance.CacheMaxSizeMB)
+	}
+	if m.config.Performance.OTELEnabled {
+		logrus.Infof("   Tracing: OTLP to %s as %s", m.config.Performance.OTELEndpoint, m.config.Performance.OTELServiceName)
+	}
+
+	requestLogStatus := "enabled"
+	if !m.config.Log.EnableRequest {
+		requestLogStatus = "disabled"
+	}
+	logrus.Infof("   Request logging: %s", requestLogStatus)
+	if m.config.Log.RequestIDHeader != "X-Request-ID" {
+		logrus.Infof("   Request ID header: %s", m.config.Log.RequestIDHeader)
+	}
+	if len(m.config.Log.ExtractHeaders) > 0 {
+		logrus.Infof("   Log fields from headers: %d", len(m.config.Log.ExtractHeaders))
+	}
+	if m.config.RateLimit.Enabled {
+		limitBy := "client IP"
+		if m.config.RateLimit.LimitByHeader != "" {
+			limitBy = m.config.RateLimit.LimitByHeader
+		}
+		logrus.Infof("   Rate limit: %d requests/min, burst %d, per %s", m.config.RateLimit.RequestsPerMinute, m.config.RateLimit.BurstSize, limitBy)
+	}
+	for prefix, baseURLs := range m.config.Routing.Rules {
+		logrus.Infof("   Model route: %s -> %s", prefix, strings.Join(baseURLs, ", "))
+	}
+	if m.config.Quota.Enabled {
+		logrus.Infof("   Quota tracking: %s (%d callers)", m.config.Quota.Period, len(m.config.Quota.Quotas))
+	}
+	if len(m.config.Log.ExcludePaths) > 0 {
+		logrus.Infof("   Log excluded paths: %v", m.config.Log.ExcludePaths)
+	}
+	if len(m.config.Log.BodyRedactPatterns) > 0 {
+		logrus.Infof("   Body redaction patterns: %d", len(m.config.Log.BodyRedactPatterns))
+	}
+	if m.config.Log.ServerTimingEnabled {
+		logrus.Infof("   Server-Timing header: enabled")
+	}
+	if m.config.Log.AuditLogEnabled {
+		auditMode := "reconstructed"
+		if m.config.Log.CloneRequestForAudit {
+			auditMode = "cloned request"
+		}
+		logrus.Infof("   Audit logging: enabled (%s)", auditMode)
+	}
+}
+
+// Helper functions
+
+// parseInteger parses integer environment variable
+func parseInteger(value string, defaultValue int) int {
+	if value == "" {
+		return defaultValue
+	}
+	if parsed, err := strconv.Atoi(value); err == nil {
+		return parsed
+	}
+	return defaultValue
+}
+
+// parseFloat parses float environment variable
+func parseFloat(value string, defaultValue float64) float64 {
+	if value == "" {
+		return defaultValue
+	}
+	if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+		return parsed
+	}
+	return defaultValue
+}
+
+// parseBoolean parses boolean environment variable
+func parseBoolean(value string, defaultValue bool) bool {
+	if value == "" {
+		return defaultValue
+	}
+
+	lowerValue := strings.ToLower(value)
+	switch lowerValue {
+	case "true", "1", "yes", "on":
+		return true
+	case "false", "0", "no", "off":
+		return false
+	default:
+		return defaultValue
+	}
+}
+
+// parseArray parses array environment variable (comma-separated)
+func parseArray(value string, defaultValue []string) []string {
+	if value == "" {
+		return defaultValue
+	}
+
+	parts := strings.Split(value, ",")
+	result := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if trimmed := strings.TrimSpace(part); trimmed != "" {
+			result = append(result, trimmed)
+		}
+	}
+
+	if len(result) == 0 {
+		return defaultValue
+	}
+	return result
+}
+
+// parseModelTags parses model tags (e.g. "gpt-4:cost_center=ml_team:priority=high,gpt-3.5-turbo:cost_center=product_team")
+func parseModelTags(value string, errs *[]string) map[string]map[string]string {
+	if value == "" {
+		return nil
+	}
+
+	modelTags := make(map[string]map[string]string)
+	for _, entry := range parseArray(value, nil) {
+		parts := strings.Split(entry, ":")
+		model := strings.TrimSpace(parts[0])
+		if model == "" || len(parts) < 2 {
+			*errs = append(*errs, fmt.Sprintf("invalid model tags %q, expected <model>:<key>=<value>[:<key>=<value>...]", entry))
+			continue
+		}
+
+		tags := modelTags[model]
+		if tags == nil {
+			tags = make(map[string]string)
+			modelTags[model] = tags
+		}
+		for _, tag := range parts[1:] {
+			key, tagValue, found := strings.Cut(tag, "=")
+			key, tagValue = strings.TrimSpace(key), strings.TrimSpace(tagValue)
+			if !found || key == "" {
+				*errs = append(*errs, fmt.Sprintf("invalid tag %q for model %s, expected <key>=<value>", tag, model))
+				continue
+			}
+			if _, exists := tags[key]; exists {
+				*errs = append(*errs, fmt.Sprintf("duplicate tag key %q for model %s", key, model))
+				continue
+			}
+			tags[key] = tagValue
+		}
+	}
+	return modelTags
+}
+
+// parseInjectFields parses extra request body fields from a JSON object
+func parseInjectFields(value string, errs *[]string) map[string]any {
+	if value == "" {
+		return nil
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		*errs = append(*errs, fmt.Sprintf("invalid UPSTREAM_INJECT_BODY_FIELDS JSON: %v", err))
+		return nil
+	}
+	return fields
+}
+
+// parseRedactPatterns parses a JSON array of body redaction regexes (e.g. ["\\b\\d{16}\\b"])
+func parseRedactPatterns(value string, errs *[]string) []string {
+	if value == "" {
+		return nil
+	}
+
+	var patterns []string
+	if err := json.Unmarshal([]byte(value), &patterns); err != nil {
+		*errs = append(*errs, fmt.Sprintf("invalid BODY_REDACT_PATTERNS JSON: %v", err))
+		return nil
+	}
+	return patterns
+}
+
+// parseQuotas parses caller quotas from JSON (e.g. {"teamA_key":{"requests":10000}})
+func parseQuotas(value string, errs *[]string) map[string]types.QuotaLimit {
+	if value == "" {
+		return nil
+	}
+
+	var quotas map[string]types.QuotaLimit
+	if err := json.Unmarshal([]byte(value), &quotas); err != nil {
+		*errs = append(*errs, fmt.Sprintf("invalid QUOTAS JSON: %v", err))
+		return nil
+	}
+	return quotas
+}
+
+// parseRoutingRules parses model routing rules (e.g. "gpt-4:https://a.openai.com,gpt-3.5:https://b.openai.com").
+// Repeating a prefix adds upstreams to its pool; the prefix ends at the last colon before the URL scheme.
+func parseRoutingRules(value string, errs *[]string) map[string][]string {
+	if value == "" {
+		return nil
+	}
+
+	rules := make(map[string][]string)
+	for _, entry := range parseArray(value, nil) {
+		schemeEnd := strings.Index(entry, "://")
+		separator := -1
+		if schemeEnd > 0 {
+			separator = strings.LastIndex(entry[:schemeEnd], ":")
+		}
+		if separator <= 0 {
+			*errs = append(*errs, fmt.Sprintf("invalid routing rule %q, expected <model prefix>:<upstream URL>", entry))
+			continue
+		}
+
+		prefix := strings.TrimSpace(entry[:separator])
+		baseURL := strings.TrimSpace(entry[separator+1:])
+		rules[prefix] = append(rules[prefix], baseURL)
+	}
+	return rules
+}
+
+// parseUpstreamTLSCerts reads per-upstream client certificates from UPSTREAM_TLS_CERT_FILE_<INDEX>
+// and UPSTREAM_TLS_KEY_FILE_<INDEX>, where INDEX is the 0-based position in OPENAI_BASE_URL
+func parseUpstreamTLSCerts(getenv func(string) string, upstreamCount int) map[int]types.UpstreamTLSCert {
+	var certs map[int]types.UpstreamTLSCert
+	for index := 0; index < upstreamCount; index++ {
+		override := types.UpstreamTLSCert{
+			CertFile: getenv(fmt.Sprintf("UPSTREAM_TLS_CERT_FILE_%d", index)),
+			KeyFile:  getenv(fmt.Sprintf("UPSTREAM_TLS_KEY_FILE_%d", index)),
+		}
+		if override.CertFile == "" && override.KeyFile == "" {
+			continue
+		}
+		if certs == nil {
+			certs = make(map[int]types.UpstreamTLSCert)
+		}
+		certs[index] = override
+	}
+	return certs
+}
+
+// parseUpstreamPools reads UPSTREAM_MAX_IDLE_CONNS_<INDEX>, UPSTREAM_MAX_IDLE_CONNS_PER_HOST_<INDEX>
+// and UPSTREAM_MAX_CONNS_PER_HOST_<INDEX>, where INDEX is the 0-based position in OPENAI_BASE_URL
+func parseUpstreamPools(getenv func(string) string, upstreamCount int) map[int]types.UpstreamPool {
+	var pools map[int]types.UpstreamPool
+	for index := 0; index < upstreamCount; index++ {
+		pool := types.UpstreamPool{
+			MaxIdleConns:        parseInteger(getenv(fmt.Sprintf("UPSTREAM_MAX_IDLE_CONNS_%d", index)), 0),
+			MaxIdleConnsPerHost: parseInteger(getenv(fmt.Sprintf("UPSTREAM_MAX_IDLE_CONNS_PER_HOST_%d", index)), 0),
+			MaxConnsPerHost:     parseInteger(getenv(fmt.Sprintf("UPSTREAM_MAX_CONNS_PER_HOST_%d", index)), 0),
+		}
+		if pool == (types.UpstreamPool{}) {
+			continue
+		}
+		if pools == nil {
+			pools = make(map[int]types.UpstreamPool)
+		}
+		pools[index] = pool
+	}
+	return pools
+}
+
+// maskValue hides most of a secret for display
+func maskValue(value string) string {
+	if len(value) <= 8 {
+		return "***"
+	}
+	return value[:4] + "..." + value[len(value)-4:]
+}
+
+// parseErrorSuppression parses key error suppression rules from JSON
+func parseErrorSuppression(value string, errs *[]string) []types.KeyErrorSuppression {
+	if value == "" {
+		return nil
+	}
+
+	var rules []types.KeyErrorSuppression
+	if err := json.Unmarshal([]byte(value), &rules); err != nil {
+		*errs = append(*errs, fmt.Sprintf("invalid KEY_ERROR_SUPPRESSION JSON: %v", err))
+		return nil
+	}
+	return rules
+}
+
+// parseStatusRemap parses status code remapping rules (e.g. "200->500,404->429")
+func parseStatusRemap(value string, errs *[]string) map[int]int {
+	if value == "" {
+		return nil
+	}
+
+	remap := make(map[int]int)
+	for _, rule := range parseArray(value, nil) {
+		// Accept both the arrow character and its ASCII form
+		parts := strings.SplitN(strings.ReplaceAll(rule, "→", "->"), "->", 2)
+		if len(parts) != 2 {
+			*errs = append(*errs, fmt.Sprintf("invalid status remap rule %q, expected <from>-><to>", rule))
+			continue
+		}
+
+		source, sourceErr := parseStatusCode(parts[0])
+		target, targetErr := parseStatusCode(parts[1])
+		if sourceErr != nil || targetErr != nil {
+			*errs = append(*errs, fmt.Sprintf("invalid status remap rule %q, codes must be 3-digit integers", rule))
+			continue
+		}
+		remap[source] = target
+	}
+	return remap
+}
+
+// parseStatusCode parses a 3-digit HTTP status code
+func parseStatusCode(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if len(value) != 3 {
+		return 0, fmt.Errorf("status code must have 3 digits: %s", value)
+	}
+	return strconv.Atoi(value)
+}
+
+// parseUpstreamWeights strips ":N" weight suffixes from upstream URLs, returning
+// the clean URLs and their weights (1 when no suffix is given)
+func parseUpstreamWeights(baseURLs []string) ([]string, []int) {
+	cleanURLs := make([]string, 0, len(baseURLs))
+	weights := make([]int, 0, len(baseURLs))
+	for _, baseURL := range baseURLs {
+		cleanURL, weight := splitUpstreamWeight(baseURL)
+		cleanURLs = append(cleanURLs, cleanURL)
+		weights = append(weights, weight)
+	}
+	return cleanURLs, weights
+}
+
+// parseAuthKeys parses AUTH_KEYS, comma-separated keys optionally prefixed with a
+// label ("team-a:sk-abc,team-b:sk-def"), falling back to the single key of the
+// deprecated AUTH_KEY, taken as is. It returns the keys and their labels.
+func parseAuthKeys(authKeys, legacyKey string) ([]string, []string) {
+	if authKeys == "" {
+		if legacyKey == "" {
+			return nil, nil
+		}
+		return []string{legacyKey}, []string{""}
+	}
+
+	var keys, labels []string
+	for _, entry := range parseArray(authKeys, nil) {
+		label, key, labelled := strings.Cut(entry, ":")
+		if !labelled {
+			label, key = "", entry
+		}
+		keys = append(keys, strings.TrimSpace(key))
+		labels = append(labels, strings.TrimSpace(label))
+	}
+	return keys, labels
+}
+
+// hasAdminAuthKey reports whether AUTH_KEYS has an entry labelled admin or holds the ADMIN_AUTH_KEY
+func hasAdminAuthKey(authConfig types.AuthConfig, adminConfig types.AdminConfig) bool {
+	for i, key := range authConfig.Keys {
+		if (i < len(authConfig.KeyLabels) && authConfig.KeyLabels[i] == types.AdminKeyLabel) || (adminConfig.AuthKey != "" && key == adminConfig.AuthKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseUpstreamTiers parses failover tiers from "tier:url" pairs
+// (e.g. "primary:https://a.example.com,fallback:https://b.example.com"),
+// ordering the tiers by their first appearance
+func parseUpstreamTiers(value string, errs *[]string) []types.UpstreamTier {
+	var tiers []types.UpstreamTier
+	tierIndex := make(map[string]int)
+	for _, entry := range parseArray(value, nil) {
+		name, baseURL, ok := strings.Cut(entry, ":")
+		name, baseURL = strings.TrimSpace(name), strings.TrimSpace(baseURL)
+		if !ok || name == "" || !strings.Contains(baseURL, "://") {
+			*errs = append(*errs, fmt.Sprintf("invalid UPSTREAM_FAILOVER_ORDER entry %q, expected tier:url", entry))
+			continue
+		}
+
+		index, exists := tierIndex[name]
+		if !exists {
+			index = len(tiers)
+			tierIndex[name] = index
+			tiers = append(tiers, types.UpstreamTier{Name: name})
+		}
+		tiers[index].BaseURLs = append(tiers[index].BaseURLs, baseURL)
+	}
+	return tiers
+}
+
+// failoverTiersFor returns the failover tiers with the upstreams missing from them
+// added to the last tier, or nil when no failover order is configured
+func failoverTiersFor(baseURLs []string, tiers []types.UpstreamTier) []types.UpstreamTier {
+	if len(tiers) == 0 {
+		return nil
+	}
+
+	listed := make(map[string]bool)
+	result := make([]types.UpstreamTier, len(tiers))
+	for i, tier := range tiers {
+		result[i] = types.UpstreamTier{Name: tier.Name, BaseURLs: slices.Clone(tier.BaseURLs)}
+		for _, baseURL := range tier.BaseURLs {
+			listed[baseURL] = true
+		}
+	}
+	last := &result[len(result)-1]
+	for _, baseURL := range baseURLs {
+		if !listed[baseURL] {
+			last.BaseURLs = append(last.BaseURLs, baseURL)
+		}
+	}
+	return result
+}
+
+// weightedSlotsFor returns the weighted selection sequence, or nil when all weights are equal
+func weightedSlotsFor(baseURLs []string, weights []int) []string {
+	for _, weight := range weights {
+		if weight != weights[0] {
+			return buildWeightedSlots(baseURLs, weights)
+		}
+	}
+	return nil
+}
+
+// parseUpstreamParams strips per-upstream settings from upstream URLs
+// (e.g. "https://api.example.com?max_response_mb=10"), returning the clean URLs
+func parseUpstreamParams(baseURLs []string, errs *[]string) ([]string, map[string]int) {
+	cleanURLs := make([]string, 0, len(baseURLs))
+	var maxResponseMB map[string]int
+
+	for _, baseURL := range baseURLs {
+		parsed, err := url.Parse(baseURL)
+		if err != nil || !parsed.Query().Has("max_response_mb") {
+			cleanURLs = append(cleanURLs, baseURL)
+			continue
+		}
+
+		query := parsed.Query()
+		value := query.Get("max_response_mb")
+		query.Del("max_response_mb")
+		parsed.RawQuery = query.Encode()
+		cleanURL := parsed.String()
+		cleanURLs = append(cleanURLs, cleanURL)
+
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			*errs = append(*errs, fmt.Sprintf("invalid max_response_mb %q for upstream %s", value, cleanURL))
+			continue
+		}
+		if maxResponseMB == nil {
+			maxResponseMB = make(map[string]int)
+		}
+		maxResponseMB[cleanURL] = limit
+	}
+	return cleanURLs, maxResponseMB
+}
+
+// parseStatusCodes parses a comma-separated list of HTTP status codes
+func parseStatusCodes(value string, errs *[]string) []int {
+	var codes []int
+	for _, part := range parseArray(value, nil) {
+		code, err := parseStatusCode(part)
+		if err != nil {
+			*errs = append(*errs, fmt.Sprintf("invalid status code list %q: %v", value, err))
+			return nil
+		}
+		codes = append(codes, code)
+	}
+	return codes
+}
+
+// parseHeaderFields parses header to field mappings (e.g. "X-Tenant-ID:tenant_id")
+func parseHeaderFields(value string, errs *[]string) map[string]string {
+	if value == "" {
+		return nil
+	}
+
+	fields := make(map[string]string)
+	for _, mapping := range parseArray(value, nil) {
+		header, field, found := strings.Cut(mapping, ":")
+		header, field = strings.TrimSpace(header), strings.TrimSpace(field)
+		if !found || header == "" || field == "" {
+			*errs = append(*errs, fmt.Sprintf("invalid header field mapping %q, expected <header>:<field>", mapping))
+			continue
+		}
+		fields[http.CanonicalHeaderKey(header)] = field
+	}
+	return fields
+}
+
+// parseAzureDeployments parses model to Azure deployment mappings (e.g. "gpt-4:prod-gpt4,gpt-4o:prod-gpt4o").
+// Model names may contain colons, so the deployment follows the last one.
+func parseAzureDeployments(value string, errs *[]string) map[string]string {
+	if value == "" {
+		return nil
+	}
+
+	deployments := make(map[string]string)
+	for _, mapping := range parseArray(value, nil) {
+		separator := strings.LastIndex(mapping, ":")
+		if separator < 0 {
+			*errs = append(*errs, fmt.Sprintf("invalid Azure deployment mapping %q, expected <model>:<deployment>", mapping))
+			continue
+		}
+		model, deployment := strings.TrimSpace(mapping[:separator]), strings.TrimSpace(mapping[separator+1:])
+		if model == "" || deployment == "" {
+			*errs = append(*errs, fmt.Sprintf("invalid Azure deployment mapping %q, expected <model>:<deployment>", mapping))
+			continue
+		}
+		deployments[model] = deployment
+	}
+	return deployments
+}
+
+// validateHealthTemplate checks that a health template parses, only references
+// known fields and renders valid JSON
+func validateHealthTemplate(text string) error {
+	tmpl, err := template.New("health").Parse(text)
+	if err != nil {
+		return err
+	}
+
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, types.HealthTemplateData{}); err != nil {
+		return err
+	}
+	if !json.Valid(rendered.Bytes()) {
+		return fmt.Errorf("rendered output is not valid JSON")
+	}
+	return nil
+}
+
+// getEnvOrDefault gets environment variable or default value
+func getEnvOrDefault(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
+
+// isIPOrCIDR reports whether value is a plain IP address or a CIDR range
+func isIPOrCIDR(value string) bool {
+	if net.ParseIP(value) != nil {
+		return true
+	}
+	_, _, err := net.ParseCIDR(value)
+	return err == nil
+}
@@ -0,0 +1,801 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gpt-load/pkg/types"
+)
+
+// validateEnv builds a manager from env and returns its validation error
+func validateEnv(t *testing.T, env map[string]string) error {
+	t.Helper()
+	t.Setenv("API_KEYS", "sk-startup")
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	config, parseErrors, err := buildConfig()
+	if err != nil {
+		return err
+	}
+	manager := &Manager{config: config, parseErrors: parseErrors}
+	return manager.Validate()
+}
+
+// checkValidation runs validateEnv and checks the error mentions wantErr, or that there is none
+func checkValidation(t *testing.T, env map[string]string, wantErr string) {
+	t.Helper()
+	err := validateEnv(t, env)
+	if wantErr == "" {
+		if err != nil {
+			t.Errorf("Validate: %v", err)
+		}
+		return
+	}
+	if err == nil || !strings.Contains(err.Error(), wantErr) {
+		t.Errorf("Validate error = %v, want one mentioning %q", err, wantErr)
+	}
+}
+
+func TestValidateSigV4(t *testing.T) {
+	credentials := map[string]string{
+		"UPSTREAM_AWS_SIGV4_ENABLED": "true",
+		"AWS_ACCESS_KEY_ID":          "AKIDEXAMPLE",
+		"AWS_SECRET_ACCESS_KEY":      "secret",
+		"AWS_REGION":                 "us-east-1",
+	}
+	tests := []struct {
+		name    string
+		service string
+		wantErr string
+	}{
+		{name: "bedrock", service: "bedrock"},
+		{name: "hyphenated", service: "bedrock-runtime"},
+		{name: "uppercase", service: "Bedrock", wantErr: "AWS_SIGV4_SERVICE"},
+		{name: "leading digit", service: "1bedrock", wantErr: "AWS_SIGV4_SERVICE"},
+		{name: "single letter", service: "b", wantErr: "AWS_SIGV4_SERVICE"},
+		{name: "slash", service: "bedrock/runtime", wantErr: "AWS_SIGV4_SERVICE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"AWS_SIGV4_SERVICE": tt.service}
+			for key, value := range credentials {
+				env[key] = value
+			}
+			checkValidation(t, env, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateBodyRedactPatterns(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns string
+		wantErr  string
+	}{
+		{name: "credit card", patterns: `["\\b\\d{16}\\b"]`},
+		{name: "several", patterns: `["\\b\\d{16}\\b","[\\w.+-]+@[\\w-]+\\.[\\w.]+"]`},
+		{name: "invalid regex", patterns: `["(unclosed"]`, wantErr: "invalid body redaction pattern"},
+		{name: "invalid json", patterns: `\b\d{16}\b`, wantErr: "invalid BODY_REDACT_PATTERNS JSON"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidation(t, map[string]string{"BODY_REDACT_PATTERNS": tt.patterns}, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateUpstreamQueryParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  string
+		wantErr string
+	}{
+		{name: "versioning", params: "api_version=2&region=us"},
+		{name: "empty", params: ""},
+		{name: "bad escape", params: "api_version=%zz", wantErr: "invalid UPSTREAM_QUERY_PARAMS"},
+		{name: "semicolon", params: "api_version=2;region=us", wantErr: "invalid UPSTREAM_QUERY_PARAMS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidation(t, map[string]string{"UPSTREAM_QUERY_PARAMS": tt.params}, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateLogExcludePaths(t *testing.T) {
+	tests := []struct {
+		name    string
+		paths   string
+		wantErr string
+	}{
+		{name: "health checks", paths: "/healthz,/ready"},
+		{name: "api prefix", paths: "/v1/models", wantErr: "LOG_EXCLUDE_PATHS"},
+		{name: "api prefix upper case", paths: "/V1", wantErr: "LOG_EXCLUDE_PATHS"},
+		{name: "covers api paths", paths: "/v", wantErr: "LOG_EXCLUDE_PATHS"},
+		{name: "root", paths: "/", wantErr: "LOG_EXCLUDE_PATHS"},
+		{name: "relative", paths: "healthz", wantErr: "LOG_EXCLUDE_PATHS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidation(t, map[string]string{"LOG_EXCLUDE_PATHS": tt.paths}, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateRetryBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "defaults"},
+		{name: "backoff disabled", env: map[string]string{"RETRY_BASE_DELAY_MS": "0", "RETRY_MAX_DELAY_MS": "0"}},
+		{name: "negative base", env: map[string]string{"RETRY_BASE_DELAY_MS": "-1"}, wantErr: "retry base delay"},
+		{name: "max below base", env: map[string]string{"RETRY_BASE_DELAY_MS": "500", "RETRY_MAX_DELAY_MS": "100"}, wantErr: "retry max delay"},
+		{name: "jitter off", env: map[string]string{"RETRY_JITTER_FACTOR": "0"}},
+		{name: "jitter above 1", env: map[string]string{"RETRY_JITTER_FACTOR": "1.5"}, wantErr: "retry jitter factor"},
+		{name: "negative jitter", env: map[string]string{"RETRY_JITTER_FACTOR": "-0.1"}, wantErr: "retry jitter factor"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidation(t, tt.env, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateTLS(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "plain http"},
+		{name: "certificate only", env: map[string]string{"TLS_CERT_FILE": "/etc/gpt-load/cert.pem"}, wantErr: "must be set together"},
+		{name: "key only", env: map[string]string{"TLS_KEY_FILE": "/etc/gpt-load/key.pem"}, wantErr: "must be set together"},
+		{name: "both files", env: map[string]string{"TLS_CERT_FILE": "/etc/gpt-load/cert.pem", "TLS_KEY_FILE": "/etc/gpt-load/key.pem"}},
+		{name: "tls 1.3", env: map[string]string{"TLS_MIN_VERSION": "TLS1.3"}},
+		{name: "unknown version", env: map[string]string{"TLS_MIN_VERSION": "TLS2.0"}, wantErr: "unknown TLS version"},
+		{name: "secure suite", env: map[string]string{"TLS_CIPHER_SUITES": "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"}},
+		{name: "insecure suite", env: map[string]string{"TLS_CIPHER_SUITES": "TLS_RSA_WITH_RC4_128_SHA"}, wantErr: "insecure TLS cipher suite"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Version and suites are only checked once TLS is enabled
+			if _, exists := tt.env["TLS_MIN_VERSION"]; exists || tt.env["TLS_CIPHER_SUITES"] != "" {
+				t.Setenv("TLS_CERT_FILE", "/etc/gpt-load/cert.pem")
+				t.Setenv("TLS_KEY_FILE", "/etc/gpt-load/key.pem")
+			}
+			checkValidation(t, tt.env, tt.wantErr)
+
+			config, _, err := buildConfig()
+			if err != nil {
+				t.Fatalf("buildConfig: %v", err)
+			}
+			wantEnabled := config.Server.TLSCertFile != "" && config.Server.TLSKeyFile != ""
+			if config.Server.TLSEnabled != wantEnabled {
+				t.Errorf("TLSEnabled = %v, want %v", config.Server.TLSEnabled, wantEnabled)
+			}
+		})
+	}
+}
+
+func TestValidateUpstreamTLS(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "client certificate", env: map[string]string{"UPSTREAM_TLS_CERT_FILE": "client.pem", "UPSTREAM_TLS_KEY_FILE": "client-key.pem"}},
+		{name: "certificate without key", env: map[string]string{"UPSTREAM_TLS_CERT_FILE": "client.pem"}, wantErr: "UPSTREAM_TLS_CERT_FILE and UPSTREAM_TLS_KEY_FILE"},
+		{name: "CA only", env: map[string]string{"UPSTREAM_TLS_CA_FILE": "ca.pem"}},
+		{
+			name: "per-upstream override",
+			env:  map[string]string{"OPENAI_BASE_URL": "https://a.example,https://b.example", "UPSTREAM_TLS_CERT_FILE_1": "b.pem", "UPSTREAM_TLS_KEY_FILE_1": "b-key.pem"},
+		},
+		{
+			name:    "override without key",
+			env:     map[string]string{"OPENAI_BASE_URL": "https://a.example,https://b.example", "UPSTREAM_TLS_CERT_FILE_1": "b.pem"},
+			wantErr: "UPSTREAM_TLS_CERT_FILE_1 and UPSTREAM_TLS_KEY_FILE_1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidation(t, tt.env, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateRequestLogFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		fields  string
+		wantErr string
+	}{
+		{name: "subset", fields: "method,status,latency_ms"},
+		{name: "every field", fields: "timestamp,method,path,status,upstream,key_id,latency_ms,request_id,client_ip,model"},
+		{name: "unknown field", fields: "method,body", wantErr: `invalid LOG_REQUEST_FIELDS entry "body"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidation(t, map[string]string{"LOG_REQUEST_FIELDS": tt.fields}, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateLogFileRotation(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "defaults"},
+		{name: "unlimited backups and age", env: map[string]string{"LOG_FILE_MAX_BACKUPS": "0", "LOG_FILE_MAX_AGE_DAYS": "0"}},
+		{name: "zero size", env: map[string]string{"LOG_FILE_MAX_SIZE_MB": "0"}, wantErr: "LOG_FILE_MAX_SIZE_MB"},
+		{name: "negative backups", env: map[string]string{"LOG_FILE_MAX_BACKUPS": "-1"}, wantErr: "LOG_FILE_MAX_BACKUPS"},
+		{name: "negative age", env: map[string]string{"LOG_FILE_MAX_AGE_DAYS": "-1"}, wantErr: "LOG_FILE_MAX_AGE_DAYS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidation(t, tt.env, tt.wantErr)
+		})
+	}
+}
+
+func TestParseAzureDeployments(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "empty"},
+		{name: "mappings", value: "gpt-4:prod-gpt4, gpt-4o:prod-gpt4o", want: map[string]string{"gpt-4": "prod-gpt4", "gpt-4o": "prod-gpt4o"}},
+		{name: "model with colons", value: "ft:gpt-4o:acme:acme-finetune", want: map[string]string{"ft:gpt-4o:acme": "acme-finetune"}},
+		{name: "missing separator", value: "gpt-4", want: map[string]string{}, wantErr: true},
+		{name: "missing deployment", value: "gpt-4:", want: map[string]string{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs []string
+			got := parseAzureDeployments(tt.value, &errs)
+			if (len(errs) > 0) != tt.wantErr {
+				t.Errorf("errors = %v, want error %v", errs, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("deployments = %v, want %v", got, tt.want)
+			}
+			for model, deployment := range tt.want {
+				if got[model] != deployment {
+					t.Errorf("deployment for %s = %q, want %q", model, got[model], deployment)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateUpstreamType(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "openai"},
+		{name: "azure", env: map[string]string{"UPSTREAM_TYPE": "azure", "AZURE_DEPLOYMENT_MAP": "gpt-4:prod"}},
+		{name: "azure with generic proxy mode", env: map[string]string{"UPSTREAM_TYPE": "azure", "GENERIC_PROXY_MODE": "true"}, wantErr: "GENERIC_PROXY_MODE"},
+		{name: "bad deployment map", env: map[string]string{"UPSTREAM_TYPE": "azure", "AZURE_DEPLOYMENT_MAP": "gpt-4"}, wantErr: "invalid Azure deployment mapping"},
+		{name: "anthropic", env: map[string]string{"UPSTREAM_TYPE": "anthropic"}},
+		{name: "anthropic with generic proxy mode", env: map[string]string{"UPSTREAM_TYPE": "anthropic", "GENERIC_PROXY_MODE": "true"}, wantErr: "GENERIC_PROXY_MODE"},
+		{name: "unknown type", env: map[string]string{"UPSTREAM_TYPE": "bedrock"}, wantErr: "invalid UPSTREAM_TYPE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidation(t, tt.env, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateKeyFetch(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "valid", env: map[string]string{"KEY_FETCH_URL": "https://secrets.example/keys", "KEY_FETCH_AUTH_HEADER": "Authorization: Bearer token"}},
+		{name: "not http", env: map[string]string{"KEY_FETCH_URL": "file:///etc/keys"}, wantErr: "invalid KEY_FETCH_URL"},
+		{name: "no host", env: map[string]string{"KEY_FETCH_URL": "https:///keys"}, wantErr: "invalid KEY_FETCH_URL"},
+		{name: "interval too short", env: map[string]string{"KEY_FETCH_URL": "https://secrets.example/keys", "KEY_FETCH_INTERVAL_SECONDS": "0"}, wantErr: "KEY_FETCH_INTERVAL_SECONDS"},
+		{name: "header without a value", env: map[string]string{"KEY_FETCH_URL": "https://secrets.example/keys", "KEY_FETCH_AUTH_HEADER": "Bearer token"}, wantErr: "invalid KEY_FETCH_AUTH_HEADER"},
+		{name: "bad header name", env: map[string]string{"KEY_FETCH_URL": "https://secrets.example/keys", "KEY_FETCH_AUTH_HEADER": "Bad Header: token"}, wantErr: "invalid KEY_FETCH_AUTH_HEADER"},
+		{
+			name:    "with an AWS secret",
+			env:     map[string]string{"KEY_FETCH_URL": "https://secrets.example/keys", "KEY_AWS_SECRET_ARN": "arn:aws:secretsmanager:us-east-1:123456789012:secret:keys"},
+			wantErr: "cannot both be set",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidation(t, tt.env, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateIPFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "IPs and ranges", env: map[string]string{"IP_ALLOWLIST": "10.0.0.0/8, 192.168.1.7", "IP_BLOCKLIST": "2001:db8::/32"}},
+		{name: "bad allowlist entry", env: map[string]string{"IP_ALLOWLIST": "10.0.0.0/33"}, wantErr: "invalid IP or CIDR range: 10.0.0.0/33"},
+		{name: "bad blocklist entry", env: map[string]string{"IP_BLOCKLIST": "example.com"}, wantErr: "invalid IP or CIDR range: example.com"},
+		{name: "client IP header", env: map[string]string{"CLIENT_IP_HEADER": "CF-Connecting-IP"}},
+		{name: "bad client IP header", env: map[string]string{"CLIENT_IP_HEADER": "Client IP"}, wantErr: "invalid client IP header name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidation(t, tt.env, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateKeyRateLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "token bucket", env: map[string]string{"KEY_RATE_LIMIT_RPM": "60"}},
+		{name: "sliding window", env: map[string]string{"KEY_RATE_LIMIT_RPM": "60", "RATE_LIMIT_ALGORITHM": "sliding_window", "RATE_LIMIT_WINDOW_SECONDS": "30"}},
+		{name: "negative rpm", env: map[string]string{"KEY_RATE_LIMIT_RPM": "-1"}, wantErr: "KEY_RATE_LIMIT_RPM cannot be negative"},
+		{name: "empty window", env: map[string]string{"RATE_LIMIT_ALGORITHM": "sliding_window", "RATE_LIMIT_WINDOW_SECONDS": "0"}, wantErr: "RATE_LIMIT_WINDOW_SECONDS must be at least 1"},
+		{name: "window ignored by the token bucket", env: map[string]string{"RATE_LIMIT_WINDOW_SECONDS": "0"}},
+		{name: "unknown algorithm", env: map[string]string{"RATE_LIMIT_ALGORITHM": "leaky_bucket"}, wantErr: "invalid rate limit algorithm: leaky_bucket"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidation(t, tt.env, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateRequestQueue(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "queue disabled", env: map[string]string{"MAX_QUEUE_SIZE": "0", "QUEUE_TIMEOUT_MS": "0"}},
+		{name: "queue enabled", env: map[string]string{"MAX_QUEUE_SIZE": "50", "QUEUE_TIMEOUT_MS": "1000"}},
+		{name: "negative size", env: map[string]string{"MAX_QUEUE_SIZE": "-1"}, wantErr: "MAX_QUEUE_SIZE cannot be negative"},
+		{name: "no timeout", env: map[string]string{"MAX_QUEUE_SIZE": "10", "QUEUE_TIMEOUT_MS": "0"}, wantErr: "QUEUE_TIMEOUT_MS must be at least 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidation(t, tt.env, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateMirror(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "disabled", env: map[string]string{"MIRROR_SAMPLE_RATE": "5"}},
+		{name: "enabled", env: map[string]string{"MIRROR_URL": "https://mirror.example.com", "MIRROR_SAMPLE_RATE": "0.25", "MIRROR_TIMEOUT_MS": "500"}},
+		{name: "not a URL", env: map[string]string{"MIRROR_URL": "mirror.example.com"}, wantErr: "MIRROR_URL must be an http or https URL"},
+		{name: "sample rate above one", env: map[string]string{"MIRROR_URL": "https://mirror.example.com", "MIRROR_SAMPLE_RATE": "1.5"}, wantErr: "MIRROR_SAMPLE_RATE must be between 0.0 and 1.0"},
+		{name: "negative sample rate", env: map[string]string{"MIRROR_URL": "https://mirror.example.com", "MIRROR_SAMPLE_RATE": "-0.1"}, wantErr: "MIRROR_SAMPLE_RATE must be between 0.0 and 1.0"},
+		{name: "no timeout", env: map[string]string{"MIRROR_URL": "https://mirror.example.com", "MIRROR_TIMEOUT_MS": "0"}, wantErr: "MIRROR_TIMEOUT_MS must be at least 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidation(t, tt.env, tt.wantErr)
+		})
+	}
+}
+
+func TestUpstreamGroupSplit(t *testing.T) {
+	const draws = 100000
+	for _, weight := range []int{0, 1, 10, 25, 50, 75, 99, 100} {
+		t.Run(fmt.Sprintf("weight=%d", weight), func(t *testing.T) {
+			manager := newTestManager(t, map[string]string{
+				"API_KEYS":          "sk-startup",
+				"OPENAI_BASE_URL":   "https://a1.example,https://a2.example",
+				"UPSTREAM_B_URLS":   "https://b1.example",
+				"UPSTREAM_B_WEIGHT": fmt.Sprint(weight),
+			})
+			groupB := 0
+			for i := 0; i < draws; i++ {
+				openaiConfig := manager.GetOpenAIConfig()
+				switch openaiConfig.UpstreamGroup {
+				case UpstreamGroupB:
+					groupB++
+					if openaiConfig.BaseURL != "https://b1.example" {
+						t.Fatalf("group B routed to %s", openaiConfig.BaseURL)
+					}
+				case UpstreamGroupA:
+					if !strings.HasPrefix(openaiConfig.BaseURL, "https://a") {
+						t.Fatalf("group A routed to %s", openaiConfig.BaseURL)
+					}
+				default:
+					t.Fatalf("upstream group = %q, want A or B", openaiConfig.UpstreamGroup)
+				}
+			}
+			if share := float64(groupB) / draws * 100; math.Abs(share-float64(weight)) > 1 {
+				t.Errorf("group B got %.2f%% of requests, want %d%% within 1%%", share, weight)
+			}
+		})
+	}
+}
+
+func TestUpstreamGroupStrategy(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		want      []string // BaseURL of successive picks
+		wantGroup string
+	}{
+		{
+			name: "no group B",
+			env:  map[string]string{"OPENAI_BASE_URL": "https://a1.example,https://a2.example"},
+			want: []string{"https://a1.example", "https://a2.example", "https://a1.example"},
+		},
+		{
+			name:      "round robin within group A",
+			env:       map[string]string{"OPENAI_BASE_URL": "https://a1.example,https://a2.example", "UPSTREAM_B_URLS": "https://b1.example", "UPSTREAM_B_WEIGHT": "0"},
+			want:      []string{"https://a1.example", "https://a2.example", "https://a1.example"},
+			wantGroup: UpstreamGroupA,
+		},
+		{
+			name:      "round robin within group B",
+			env:       map[string]string{"OPENAI_BASE_URL": "https://a1.example", "UPSTREAM_B_URLS": "https://b1.example,https://b2.example,https://b3.example", "UPSTREAM_B_WEIGHT": "100"},
+			want:      []string{"https://b1.example", "https://b2.example", "https://b3.example", "https://b1.example"},
+			wantGroup: UpstreamGroupB,
+		},
+		{
+			name: "weights only apply to group A",
+			env: map[string]string{
+				"OPENAI_BASE_URL": "https://a1.example:9,https://a2.example:1", "UPSTREAM_B_URLS": "https://b1.example,https://b2.example", "UPSTREAM_B_WEIGHT": "100",
+				"LOAD_BALANCE_STRATEGY": LoadBalanceWeighted,
+			},
+			want:      []string{"https://b1.example", "https://b2.example"}, // Any order, both picked
+			wantGroup: UpstreamGroupB,
+		},
+		{
+			name: "least connections within group B",
+			env: map[string]string{
+				"OPENAI_BASE_URL": "https://a1.example", "UPSTREAM_B_URLS": "https://b1.example,https://b2.example", "UPSTREAM_B_WEIGHT": "100",
+				"LOAD_BALANCE_STRATEGY": LoadBalanceLeastConnections,
+			},
+			want:      []string{"https://b1.example", "https://b2.example", "https://b1.example"},
+			wantGroup: UpstreamGroupB,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"API_KEYS": "sk-startup"}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			manager := newTestManager(t, env)
+			random := tt.env["LOAD_BALANCE_STRATEGY"] == LoadBalanceWeighted
+			seen := make(map[string]bool)
+			for i := 0; i < 50; i++ {
+				openaiConfig := manager.GetOpenAIConfig()
+				if openaiConfig.UpstreamGroup != tt.wantGroup {
+					t.Fatalf("upstream group = %q, want %q", openaiConfig.UpstreamGroup, tt.wantGroup)
+				}
+				seen[openaiConfig.BaseURL] = true
+				if !random && i < len(tt.want) && openaiConfig.BaseURL != tt.want[i] {
+					t.Errorf("pick %d = %s, want %s", i, openaiConfig.BaseURL, tt.want[i])
+				}
+			}
+			for _, baseURL := range tt.want {
+				if !seen[baseURL] {
+					t.Errorf("%s never picked, picked %v", baseURL, seen)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateUpstreamGroups(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "split", env: map[string]string{"UPSTREAM_B_URLS": "https://b1.example,https://b2.example", "UPSTREAM_B_WEIGHT": "30"}},
+		{name: "invalid URL", env: map[string]string{"UPSTREAM_B_URLS": "b1.example"}, wantErr: "invalid UPSTREAM_B_URLS entry: b1.example"},
+		{name: "weight above 100", env: map[string]string{"UPSTREAM_B_URLS": "https://b1.example", "UPSTREAM_B_WEIGHT": "101"}, wantErr: "UPSTREAM_B_WEIGHT must be between 0-100"},
+		{name: "negative weight", env: map[string]string{"UPSTREAM_B_WEIGHT": "-1"}, wantErr: "UPSTREAM_B_WEIGHT must be between 0-100"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidation(t, tt.env, tt.wantErr)
+		})
+	}
+}
+
+func TestParseUpstreamTiers(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		wantTiers []types.UpstreamTier
+		wantErrs  int
+	}{
+		{name: "unset"},
+		{
+			name:  "tiers in order of appearance",
+			value: "primary:https://a.example,fallback:https://c.example,primary:https://b.example",
+			wantTiers: []types.UpstreamTier{
+				{Name: "primary", BaseURLs: []string{"https://a.example", "https://b.example"}},
+				{Name: "fallback", BaseURLs: []string{"https://c.example"}},
+			},
+		},
+		{name: "spaces trimmed", value: " primary : https://a.example ", wantTiers: []types.UpstreamTier{{Name: "primary", BaseURLs: []string{"https://a.example"}}}},
+		{name: "missing tier", value: "https://a.example", wantErrs: 1},
+		{name: "empty tier name", value: ":https://a.example", wantErrs: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs []string
+			tiers := parseUpstreamTiers(tt.value, &errs)
+			if !reflect.DeepEqual(tiers, tt.wantTiers) {
+				t.Errorf("tiers = %+v, want %+v", tiers, tt.wantTiers)
+			}
+			if len(errs) != tt.wantErrs {
+				t.Errorf("errors = %v, want %d", errs, tt.wantErrs)
+			}
+		})
+	}
+}
+
+func TestValidateFailoverOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "listed upstreams", env: map[string]string{"UPSTREAM_FAILOVER_ORDER": "primary:https://a.example,fallback:https://b.example"}},
+		{name: "unknown upstream", env: map[string]string{"UPSTREAM_FAILOVER_ORDER": "primary:https://a.example,fallback:https://c.example"}, wantErr: "UPSTREAM_FAILOVER_ORDER entry https://c.example is not in OPENAI_BASE_URL"},
+		{name: "malformed entry", env: map[string]string{"UPSTREAM_FAILOVER_ORDER": "https://a.example"}, wantErr: "invalid UPSTREAM_FAILOVER_ORDER entry"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.env["OPENAI_BASE_URL"] = "https://a.example,https://b.example"
+			checkValidation(t, tt.env, tt.wantErr)
+		})
+	}
+}
+
+func TestFailoverTiers(t *testing.T) {
+	const p1, p2, f1, f2, rest = "https://p1.example", "https://p2.example", "https://f1.example", "https://f2.example", "https://rest.example"
+	tests := []struct {
+		name     string
+		degraded []string // Marked down by health checks
+		open     []string // Circuits opened
+		selected []string
+	}{
+		{name: "primary tier healthy", selected: []string{p1, p2}},
+		{name: "one primary down", degraded: []string{p1}, selected: []string{p2}},
+		{name: "primary tier down", degraded: []string{p1, p2}, selected: []string{f1, f2, rest}},
+		{name: "primary circuits open", open: []string{p1, p2}, selected: []string{f1, f2, rest}},
+		{name: "health check and circuit together", degraded: []string{p1}, open: []string{p2}, selected: []string{f1, f2, rest}},
+		{name: "every upstream down", degraded: []string{p1, p2, f1, f2, rest}, selected: []string{p1, p2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newTestManager(t, map[string]string{
+				"API_KEYS":                       "sk-startup",
+				"OPENAI_BASE_URL":                strings.Join([]string{p1, p2, f1, f2, rest}, ","),
+				"UPSTREAM_FAILOVER_ORDER":        "primary:" + p1 + ",primary:" + p2 + ",fallback:" + f1 + ",fallback:" + f2,
+				"LOAD_BALANCE_STRATEGY":          "round_robin",
+				"CIRCUIT_BREAKER_FAIL_THRESHOLD": "1",
+			})
+			degraded := make(map[string]bool)
+			for _, baseURL := range tt.degraded {
+				degraded[baseURL] = true
+			}
+			manager.degradedUpstreams.Store(&degraded)
+			for _, baseURL := range tt.open {
+				manager.RecordUpstreamResult(baseURL, true)
+			}
+
+			selected := selectedUpstreams(manager, 30)
+			if len(selected) != len(tt.selected) {
+				t.Errorf("selected %v, want %v", selected, tt.selected)
+			}
+			for _, baseURL := range tt.selected {
+				if !selected[baseURL] {
+					t.Errorf("%s never selected", baseURL)
+				}
+			}
+		})
+	}
+}
+
+func TestParseUpstreamPools(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want map[int]types.UpstreamPool
+	}{
+		{name: "no overrides"},
+		{
+			name: "per index",
+			env:  map[string]string{"UPSTREAM_MAX_IDLE_CONNS_0": "10", "UPSTREAM_MAX_CONNS_PER_HOST_1": "4", "UPSTREAM_MAX_IDLE_CONNS_PER_HOST_1": "2"},
+			want: map[int]types.UpstreamPool{0: {MaxIdleConns: 10}, 1: {MaxIdleConnsPerHost: 2, MaxConnsPerHost: 4}},
+		},
+		{name: "index past the upstreams", env: map[string]string{"UPSTREAM_MAX_IDLE_CONNS_2": "10"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pools := parseUpstreamPools(func(key string) string { return tt.env[key] }, 2)
+			if !reflect.DeepEqual(pools, tt.want) {
+				t.Errorf("pools = %v, want %v", pools, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateUpstreamPools(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "sizes", env: map[string]string{"UPSTREAM_MAX_IDLE_CONNS": "100", "UPSTREAM_MAX_CONNS_PER_HOST_0": "10"}},
+		{name: "negative shared size", env: map[string]string{"UPSTREAM_MAX_CONNS_PER_HOST": "-1"}, wantErr: "upstream connection pool sizes cannot be negative"},
+		{name: "negative override", env: map[string]string{"UPSTREAM_MAX_IDLE_CONNS_PER_HOST_0": "-1"}, wantErr: "upstream connection pool sizes cannot be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidation(t, tt.env, tt.wantErr)
+		})
+	}
+}
+
+func TestParseAuthKeys(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		wantKeys   []string
+		wantLabels []string
+	}{
+		{name: "unset"},
+		{name: "deprecated AUTH_KEY", env: map[string]string{"AUTH_KEY": "sk-legacy"}, wantKeys: []string{"sk-legacy"}, wantLabels: []string{""}},
+		{name: "AUTH_KEY with colons kept whole", env: map[string]string{"AUTH_KEY": "team:sk-legacy"}, wantKeys: []string{"team:sk-legacy"}, wantLabels: []string{""}},
+		{name: "multiple keys", env: map[string]string{"AUTH_KEYS": "sk-abc,sk-def"}, wantKeys: []string{"sk-abc", "sk-def"}, wantLabels: []string{"", ""}},
+		{name: "labelled keys", env: map[string]string{"AUTH_KEYS": "team-a:sk-abc,team-b:sk-def"}, wantKeys: []string{"sk-abc", "sk-def"}, wantLabels: []string{"team-a", "team-b"}},
+		{name: "mixed with spaces", env: map[string]string{"AUTH_KEYS": " team-a : sk-abc , sk-def "}, wantKeys: []string{"sk-abc", "sk-def"}, wantLabels: []string{"team-a", ""}},
+		{name: "AUTH_KEYS wins over AUTH_KEY", env: map[string]string{"AUTH_KEYS": "team-a:sk-abc", "AUTH_KEY": "sk-legacy"}, wantKeys: []string{"sk-abc"}, wantLabels: []string{"team-a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("API_KEYS", "sk-startup")
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			config, _, err := buildConfig()
+			if err != nil {
+				t.Fatalf("buildConfig: %v", err)
+			}
+			if !reflect.DeepEqual(config.Auth.Keys, tt.wantKeys) || !reflect.DeepEqual(config.Auth.KeyLabels, tt.wantLabels) {
+				t.Errorf("keys = %q labels %q, want %q labels %q", config.Auth.Keys, config.Auth.KeyLabels, tt.wantKeys, tt.wantLabels)
+			}
+			if config.Auth.Enabled != (len(tt.wantKeys) > 0) {
+				t.Errorf("auth enabled = %v with keys %q", config.Auth.Enabled, tt.wantKeys)
+			}
+		})
+	}
+}
+
+func TestValidateTrustedProxies(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr string
+	}{
+		{name: "CIDR and IP", value: "10.0.0.0/8,192.168.1.1,fd00::/8"},
+		{name: "invalid entry", value: "10.0.0.0/8,proxy.internal", wantErr: "invalid trusted proxy IP or CIDR range: proxy.internal"},
+		{name: "invalid prefix", value: "10.0.0.0/33", wantErr: "invalid trusted proxy IP or CIDR range: 10.0.0.0/33"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidation(t, map[string]string{"TRUSTED_PROXY_CIDRS": tt.value}, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateResponseBuffering(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr string
+	}{
+		{name: "default"},
+		{name: "none", value: "none"},
+		{name: "full in capitals", value: "FULL"},
+		{name: "unknown", value: "partial", wantErr: "invalid response buffering mode: partial"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidation(t, map[string]string{"RESPONSE_BUFFERING": tt.value}, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateAuthExemptPaths(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr string
+	}{
+		{name: "exact and prefix", value: "/health,/public/*"},
+		{name: "relative path", value: "health", wantErr: `invalid AUTH_EXEMPT_PATHS entry "health"`},
+		{name: "wildcard inside", value: "/v1/*/models", wantErr: `invalid AUTH_EXEMPT_PATHS entry "/v1/*/models"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidation(t, map[string]string{"AUTH_EXEMPT_PATHS": tt.value}, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateProbePaths(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "defaults", env: map[string]string{}},
+		{name: "custom paths", env: map[string]string{"HEALTH_PATH": "/livez", "READY_PATH": "/readyz"}},
+		{name: "relative path", env: map[string]string{"HEALTH_PATH": "livez"}, wantErr: `invalid probe path "livez"`},
+		{name: "management endpoint", env: map[string]string{"READY_PATH": "/stats"}, wantErr: `invalid probe path "/stats"`},
+		{name: "same path", env: map[string]string{"HEALTH_PATH": "/healthz", "READY_PATH": "/healthz"}, wantErr: "HEALTH_PATH and READY_PATH must differ"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidation(t, tt.env, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateStatsResetInterval(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr string
+	}{
+		{value: "0"},
+		{value: "24"},
+		{value: "-1", wantErr: "STATS_RESET_INTERVAL_HOURS cannot be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			checkValidation(t, map[string]string{"STATS_RESET_INTERVAL_HOURS": tt.value}, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateMaxResponseBodyBytes(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr string
+	}{
+		{value: "0"},
+		{value: "1048576"},
+		{value: "-1", wantErr: "max response body bytes cannot be less than 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			checkValidation(t, map[string]string{"MAX_RESPONSE_BODY_BYTES": tt.value}, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,357 @@
+package config
+
+import (
+	stderrors "errors"
+	"io/fs"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"gpt-load/internal/circuitbreaker"
+	"gpt-load/internal/errors"
+
+	"github.com/joho/godotenv"
+	"github.com/sirupsen/logrus"
+)
+
+// loadDotenv loads the .env file without overriding the process environment,
+// returning the variables it set
+func loadDotenv() (map[string]bool, error) {
+	values, err := godotenv.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]bool, len(values))
+	for key, value := range values {
+		if _, exists := os.LookupEnv(key); exists {
+			continue
+		}
+		os.Setenv(key, value)
+		keys[key] = true
+	}
+	return keys, nil
+}
+
+// reloadDotenv re-applies the .env file. Variables that came from a previous
+// load are updated or unset, the process environment still takes precedence.
+func reloadDotenv(previous map[string]bool) (map[string]bool, error) {
+	values, err := godotenv.Read()
+	if err != nil && !stderrors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	for key := range previous {
+		if _, exists := values[key]; !exists {
+			os.Unsetenv(key)
+		}
+	}
+
+	keys := make(map[string]bool, len(values))
+	for key, value := range values {
+		if _, exists := os.LookupEnv(key); exists && !previous[key] {
+			continue
+		}
+		os.Setenv(key, value)
+		keys[key] = true
+	}
+	return keys, nil
+}
+
+// Reload re-reads the environment, the .env file and CONFIG_FILE, validates the
+// result and swaps it in. Requests already running keep the configuration they
+// fetched. Settings that only take effect at startup keep their current values.
+func (m *Manager) Reload() error {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+
+	dotenvKeys, err := reloadDotenv(m.dotenvKeys)
+	if err != nil {
+		return errors.NewAppErrorWithCause(errors.ErrConfigInvalid, "Failed to read .env file", err)
+	}
+	m.dotenvKeys = dotenvKeys
+
+	config, parseErrors, err := buildConfig()
+	if err != nil {
+		return err
+	}
+	candidate := &Manager{config: config, parseErrors: parseErrors}
+	if err := candidate.Validate(); err != nil {
+		return err
+	}
+
+	previous := m.current()
+	keepStartupSetting("PORT", previous.Server.Port, &config.Server.Port)
+	keepStartupSetting("HOST", previous.Server.Host, &config.Server.Host)
+	keepStartupSetting("ADMIN_PORT", previous.Admin.Port, &config.Admin.Port)
+	keepStartupSetting("METRICS_PORT", previous.Metrics.Port, &config.Metrics.Port)
+	keepStartupSetting("REQUEST_ID_FORMAT", previous.Server.RequestIDFormat, &config.Server.RequestIDFormat)
+	keepStartupSetting("TLS_CERT_FILE", previous.Server.TLSCertFile, &config.Server.TLSCertFile)
+	keepStartupSetting("TLS_KEY_FILE", previous.Server.TLSKeyFile, &config.Server.TLSKeyFile)
+	keepStartupSetting("TLS_MIN_VERSION", previous.Server.TLSMinVersion, &config.Server.TLSMinVersion)
+	keepStartupSetting("MAX_QUEUE_SIZE", previous.Performance.MaxQueueSize, &config.Performance.MaxQueueSize)
+	keepStartupSetting("QUEUE_TIMEOUT_MS", previous.Performance.QueueTimeoutMs, &config.Performance.QueueTimeoutMs)
+	keepStartupSetting("MAX_REQUEST_BODY_BYTES", previous.Performance.MaxRequestBodyBytes, &config.Performance.MaxRequestBodyBytes)
+	keepStartupSetting("KEY_MAX_CONCURRENT", previous.Keys.KeyMaxConcurrent, &config.Keys.KeyMaxConcurrent)
+	keepStartupSetting("KEY_RATE_LIMIT_RPM", previous.Keys.KeyRateLimitRPM, &config.Keys.KeyRateLimitRPM)
+	keepStartupSetting("RATE_LIMIT_ALGORITHM", previous.Keys.KeyRateLimitAlgorithm, &config.Keys.KeyRateLimitAlgorithm)
+	keepStartupSetting("RATE_LIMIT_WINDOW_SECONDS", previous.Keys.KeyRateLimitWindowSeconds, &config.Keys.KeyRateLimitWindowSeconds)
+	keepStartupSetting("BLACKLIST_RECOVERY_AFTER_SECONDS", previous.Keys.BlacklistRecoverySeconds, &config.Keys.BlacklistRecoverySeconds)
+	keepStartupSetting("STATS_RESET_INTERVAL_HOURS", previous.Keys.StatsResetIntervalHours, &config.Keys.StatsResetIntervalHours)
+	keepStartupSetting("BLACKLIST_PROBE_ENABLED", previous.Keys.BlacklistProbeEnabled, &config.Keys.BlacklistProbeEnabled)
+	keepStartupSetting("KEY_AWS_SECRET_ARN", previous.Keys.KeyAWSSecretARN, &config.Keys.KeyAWSSecretARN)
+	keepStartupSetting("KEY_AWS_REGION", previous.Keys.KeyAWSRegion, &config.Keys.KeyAWSRegion)
+	keepStartupSetting("KEY_FETCH_INTERVAL_SECONDS", previous.Keys.KeyFetchIntervalSeconds, &config.Keys.KeyFetchIntervalSeconds)
+	keepStartupSetting("UPSTREAM_CONNECT_TIMEOUT_MS", previous.OpenAI.UpstreamConnectTimeoutMs, &config.OpenAI.UpstreamConnectTimeoutMs)
+	keepStartupSetting("UPSTREAM_RESPONSE_HEADER_TIMEOUT_MS", previous.OpenAI.UpstreamResponseHeaderTimeoutMs, &config.OpenAI.UpstreamResponseHeaderTimeoutMs)
+	keepStartupSetting("DNS_CACHE_TTL_SECONDS", previous.OpenAI.DNSCacheTTLSeconds, &config.OpenAI.DNSCacheTTLSeconds)
+	keepStartupSetting("DNS_NEGATIVE_CACHE_TTL_SECONDS", previous.OpenAI.DNSNegativeCacheTTLSeconds, &config.OpenAI.DNSNegativeCacheTTLSeconds)
+	keepStartupSetting("UPSTREAM_MAX_IDLE_CONNS", previous.OpenAI.UpstreamMaxIdleConns, &config.OpenAI.UpstreamMaxIdleConns)
+	keepStartupSetting("UPSTREAM_MAX_IDLE_CONNS_PER_HOST", previous.OpenAI.UpstreamMaxIdleConnsPerHost, &config.OpenAI.UpstreamMaxIdleConnsPerHost)
+	keepStartupSetting("UPSTREAM_MAX_CONNS_PER_HOST", previous.OpenAI.UpstreamMaxConnsPerHost, &config.OpenAI.UpstreamMaxConnsPerHost)
+	// May carry credentials, so the values are not logged
+	if config.Keys.KeyFetchURL != previous.Keys.KeyFetchURL || config.Keys.KeyFetchAuthHeader != previous.Keys.KeyFetchAuthHeader {
+		logrus.Warn("KEY_FETCH_URL and KEY_FETCH_AUTH_HEADER cannot change at runtime, keeping the current values until restart")
+		config.Keys.KeyFetchURL = previous.Keys.KeyFetchURL
+		config.Keys.KeyFetchAuthHeader = previous.Keys.KeyFetchAuthHeader
+	}
+	if !slices.Equal(config.Auth.IPAllowlist, previous.Auth.IPAllowlist) || !slices.Equal(config.Auth.IPBlocklist, previous.Auth.IPBlocklist) {
+		logrus.Warn("IP_ALLOWLIST and IP_BLOCKLIST cannot change at runtime, keeping the current values until restart")
+		config.Auth.IPAllowlist = previous.Auth.IPAllowlist
+		config.Auth.IPBlocklist = previous.Auth.IPBlocklist
+	}
+	keepStartupList("TRUSTED_PROXY_CIDRS", previous.Server.TrustedProxyCIDRs, &config.Server.TrustedProxyCIDRs)
+	keepStartupList("AUTH_EXEMPT_PATHS", previous.Auth.ExemptPaths, &config.Auth.ExemptPaths)
+	// The JWT verifier is created at startup
+	keepStartupSetting("AUTH_JWKS_URL", previous.Auth.JWKSURL, &config.Auth.JWKSURL)
+	keepStartupSetting("AUTH_JWKS_REFRESH_INTERVAL_SECONDS", previous.Auth.JWKSRefreshInterval, &config.Auth.JWKSRefreshInterval)
+	keepStartupSetting("AUTH_JWT_AUDIENCE", previous.Auth.JWTAudience, &config.Auth.JWTAudience)
+	config.Auth.Enabled = len(config.Auth.Keys) > 0 || config.Auth.JWKSURL != ""
+	// Removing every AUTH_KEYS entry must not open the proxy, the revoked keys are rejected anyway
+	if previous.Auth.Enabled && !config.Auth.Enabled {
+		logrus.Warn("Authentication cannot be disabled at runtime, rejecting the removed AUTH_KEYS until restart")
+		config.Auth.Enabled = true
+	}
+	keepStartupSetting("HEALTH_PATH", previous.Server.HealthPath, &config.Server.HealthPath)
+	keepStartupSetting("READY_PATH", previous.Server.ReadyPath, &config.Server.ReadyPath)
+	keepStartupSetting("CLIENT_IP_HEADER", previous.Auth.ClientIPHeader, &config.Auth.ClientIPHeader)
+	if config.Keys.BlacklistWebhookURL != previous.Keys.BlacklistWebhookURL || config.Keys.BlacklistWebhookSecret != previous.Keys.BlacklistWebhookSecret {
+		logrus.Warn("BLACKLIST_WEBHOOK_URL and BLACKLIST_WEBHOOK_SECRET cannot change at runtime, keeping the current values until restart")
+		config.Keys.BlacklistWebhookURL = previous.Keys.BlacklistWebhookURL
+		config.Keys.BlacklistWebhookSecret = previous.Keys.BlacklistWebhookSecret
+	}
+	keepStartupSetting("LOG_MASK_KEYS", previous.Log.MaskKeys, &config.Log.MaskKeys)
+	keepStartupSetting("LOG_ENABLE_FILE", previous.Log.EnableFile, &config.Log.EnableFile)
+	keepStartupSetting("LOG_FILE_PATH", previous.Log.FilePath, &config.Log.FilePath)
+	keepStartupSetting("LOG_FILE_MAX_SIZE_MB", previous.Log.FileMaxSizeMB, &config.Log.FileMaxSizeMB)
+	keepStartupSetting("LOG_FILE_MAX_BACKUPS", previous.Log.FileMaxBackups, &config.Log.FileMaxBackups)
+	keepStartupSetting("LOG_FILE_MAX_AGE_DAYS", previous.Log.FileMaxAgeDays, &config.Log.FileMaxAgeDays)
+	keepStartupSetting("LOG_FILE_COMPRESS", previous.Log.FileCompress, &config.Log.FileCompress)
+	config.Server.TLSEnabled = previous.Server.TLSEnabled
+	if !slices.Equal(previous.Server.TLSCipherSuites, config.Server.TLSCipherSuites) {
+		logrus.Warn("TLS_CIPHER_SUITES cannot change at runtime, keeping the current suites until restart")
+		config.Server.TLSCipherSuites = previous.Server.TLSCipherSuites
+	}
+
+	keepStartupSettings(previous, config)
+
+	m.mu.Lock()
+	m.config = config
+	m.rebuildSelection(previous)
+	m.mu.Unlock()
+
+	logrus.Info("Configuration reloaded")
+	return nil
+}
+
+// keepStartupSetting restores a setting that cannot change at runtime, warning when it differs
+func keepStartupSetting[T comparable](name string, current T, next *T) {
+	if *next != current {
+		logrus.Warnf("%s cannot change at runtime, keeping %v until restart", name, current)
+		*next = current
+	}
+}
+
+// keepStartupSettings restores the settings that components copy when they are
+// created at startup, such as the HTTP server, the upstream transports, the key
+// manager and the middleware chain
+func keepStartupSettings(previous, config *Config) {
+	// HTTP server and startup tasks
+	keepStartupSetting("SERVER_READ_TIMEOUT", previous.Server.ReadTimeout, &config.Server.ReadTimeout)
+	keepStartupSetting("SERVER_WRITE_TIMEOUT", previous.Server.WriteTimeout, &config.Server.WriteTimeout)
+	keepStartupSetting("SERVER_IDLE_TIMEOUT", previous.Server.IdleTimeout, &config.Server.IdleTimeout)
+	keepStartupSetting("SERVER_GRACEFUL_SHUTDOWN_TIMEOUT", previous.Server.GracefulShutdownTimeout, &config.Server.GracefulShutdownTimeout)
+	keepStartupSetting("ERROR_TEMPLATES_FILE", previous.Server.ErrorTemplatesFile, &config.Server.ErrorTemplatesFile)
+	keepStartupSetting("SELF_TEST_ON_STARTUP", previous.Server.SelfTestOnStartup, &config.Server.SelfTestOnStartup)
+	keepStartupSetting("SELF_TEST_TIMEOUT_SECONDS", previous.Server.SelfTestTimeoutSeconds, &config.Server.SelfTestTimeoutSeconds)
+	keepStartupSetting("SELF_TEST_FAIL_FAST", previous.Server.SelfTestFailFast, &config.Server.SelfTestFailFast)
+	keepStartupSetting("SNOWFLAKE_MACHINE_ID", previous.Server.SnowflakeMachineID, &config.Server.SnowflakeMachineID)
+	keepStartupSetting("METRICS_ENABLED", previous.Metrics.Enabled, &config.Metrics.Enabled)
+	keepStartupSecret("ADMIN_AUTH_KEY", previous.Admin.AuthKey, &config.Admin.AuthKey)
+	config.Admin.Enabled = previous.Admin.Enabled
+
+	// Key manager, SIGHUP only reloads the key file
+	keepStartupList("API_KEYS", previous.Keys.APIKeys, &config.Keys.APIKeys)
+	keepStartupSetting("START_INDEX", previous.Keys.StartIndex, &config.Keys.StartIndex)
+	keepStartupSetting("MAX_KEY_COUNT", previous.Keys.MaxKeyCount, &config.Keys.MaxKeyCount)
+	keepStartupSecret("HOT_STANDBY_KEY", previous.Keys.HotStandbyKey, &config.Keys.HotStandbyKey)
+	keepStartupSetting("HOT_STANDBY_BLACKLIST_THRESHOLD", previous.Keys.HotStandbyBlacklistThreshold, &config.Keys.HotStandbyBlacklistThreshold)
+	keepStartupSetting("BLACKLIST_THRESHOLD", previous.Keys.BlacklistThreshold, &config.Keys.BlacklistThreshold)
+	keepStartupSetting("KEY_COOLDOWN_AFTER_429_MS", previous.Keys.Cooldown429Ms, &config.Keys.Cooldown429Ms)
+	keepStartupSetting("KEY_PROBE_ON_STARTUP", previous.Keys.KeyProbeOnStartup, &config.Keys.KeyProbeOnStartup)
+	keepStartupSetting("KEY_PROBE_CONCURRENCY", previous.Keys.KeyProbeConcurrency, &config.Keys.KeyProbeConcurrency)
+	keepStartupSetting("KEY_PROBE_TIMEOUT_MS", previous.Keys.KeyProbeTimeoutMs, &config.Keys.KeyProbeTimeoutMs)
+	keepStartupSetting("STARTUP_WAIT_SECONDS", previous.Keys.StartupWaitSeconds, &config.Keys.StartupWaitSeconds)
+	keepStartupSecret("COORDINATION_STORE_URL", previous.Keys.CoordinationStoreURL, &config.Keys.CoordinationStoreURL)
+	keepStartupSetting("COORDINATION_SYNC_INTERVAL_SECONDS", previous.Keys.CoordinationSyncInterval, &config.Keys.CoordinationSyncInterval)
+	keepStartupSecret("STATE_REDIS_URL", previous.Keys.StateStoreURL, &config.Keys.StateStoreURL)
+
+	// Upstream transports, signer and request rewriting in the proxy server
+	keepStartupSetting("REQUEST_TIMEOUT", previous.OpenAI.RequestTimeout, &config.OpenAI.RequestTimeout)
+	keepStartupSetting("RESPONSE_TIMEOUT", previous.OpenAI.ResponseTimeout, &config.OpenAI.ResponseTimeout)
+	keepStartupSetting("IDLE_CONN_TIMEOUT", previous.OpenAI.IdleConnTimeout, &config.OpenAI.IdleConnTimeout)
+	keepStartupSetting("UPSTREAM_MAX_CONNECT_ATTEMPTS_PER_SECOND", previous.OpenAI.MaxConnectAttemptsPerSecond, &config.OpenAI.MaxConnectAttemptsPerSecond)
+	keepStartupSetting("UPSTREAM_HTTP2_ENABLED", previous.OpenAI.UpstreamHTTP2Enabled, &config.OpenAI.UpstreamHTTP2Enabled)
+	keepStartupSetting("UPSTREAM_HTTP2_STRICT_MAX_CONCURRENT_STREAMS", previous.OpenAI.UpstreamHTTP2StrictStreams, &config.OpenAI.UpstreamHTTP2StrictStreams)
+	keepStartupSetting("UPSTREAM_TLS_CERT_FILE", previous.OpenAI.UpstreamTLSCertFile, &config.OpenAI.UpstreamTLSCertFile)
+	keepStartupSetting("UPSTREAM_TLS_KEY_FILE", previous.OpenAI.UpstreamTLSKeyFile, &config.OpenAI.UpstreamTLSKeyFile)
+	keepStartupSetting("UPSTREAM_TLS_CA_FILE", previous.OpenAI.UpstreamTLSCAFile, &config.OpenAI.UpstreamTLSCAFile)
+	keepStartupSetting("UPSTREAM_TLS_SKIP_VERIFY", previous.OpenAI.UpstreamTLSSkipVerify, &config.OpenAI.UpstreamTLSSkipVerify)
+	keepStartupMap("UPSTREAM_TLS_CERT_FILE_<INDEX> and UPSTREAM_TLS_KEY_FILE_<INDEX>", previous.OpenAI.UpstreamTLSCerts, &config.OpenAI.UpstreamTLSCerts)
+	keepStartupMap("UPSTREAM_MAX_IDLE_CONNS_<INDEX>, UPSTREAM_MAX_IDLE_CONNS_PER_HOST_<INDEX> and UPSTREAM_MAX_CONNS_PER_HOST_<INDEX>", previous.OpenAI.UpstreamPools, &config.OpenAI.UpstreamPools)
+	keepStartupSetting("UPSTREAM_AWS_SIGV4_ENABLED", previous.OpenAI.AWSSigV4Enabled, &config.OpenAI.AWSSigV4Enabled)
+	keepStartupSetting("AWS_SIGV4_SERVICE", previous.OpenAI.AWSSigV4Service, &config.OpenAI.AWSSigV4Service)
+	keepStartupSetting("AWS_REGION", previous.OpenAI.AWSRegion, &config.OpenAI.AWSRegion)
+	if config.OpenAI.AWSAccessKeyID != previous.OpenAI.AWSAccessKeyID || config.OpenAI.AWSSecretAccessKey != previous.OpenAI.AWSSecretAccessKey ||
+		config.OpenAI.AWSSessionToken != previous.OpenAI.AWSSessionToken {
+		logrus.Warn("AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN cannot change at runtime, keeping the current values until restart")
+		config.OpenAI.AWSAccessKeyID = previous.OpenAI.AWSAccessKeyID
+		config.OpenAI.AWSSecretAccessKey = previous.OpenAI.AWSSecretAccessKey
+		config.OpenAI.AWSSessionToken = previous.OpenAI.AWSSessionToken
+	}
+	keepStartupSetting("GENERIC_PROXY_MODE", previous.OpenAI.GenericProxyMode, &config.OpenAI.GenericProxyMode)
+	if !reflect.DeepEqual(config.OpenAI.InjectBodyFields, previous.OpenAI.InjectBodyFields) {
+		logrus.Warn("UPSTREAM_INJECT_BODY_FIELDS cannot change at runtime, keeping the current value until restart")
+		config.OpenAI.InjectBodyFields = previous.OpenAI.InjectBodyFields
+	}
+	keepStartupSetting("UPSTREAM_INJECT_BODY_OVERRIDE", previous.OpenAI.InjectBodyOverride, &config.OpenAI.InjectBodyOverride)
+	keepStartupSecret("UPSTREAM_QUERY_PARAMS", previous.OpenAI.UpstreamQueryParams, &config.OpenAI.UpstreamQueryParams)
+	keepStartupSetting("NORMALIZE_MESSAGE_ORDER", previous.OpenAI.NormalizeMessageOrder, &config.OpenAI.NormalizeMessageOrder)
+	keepStartupSetting("BROADCAST_ENABLED", previous.OpenAI.BroadcastEnabled, &config.OpenAI.BroadcastEnabled)
+	keepStartupList("BROADCAST_PATHS", previous.OpenAI.BroadcastPaths, &config.OpenAI.BroadcastPaths)
+	keepStartupSetting("UPSTREAM_LATENCY_SORT_INTERVAL_SECONDS", previous.OpenAI.LatencySortInterval, &config.OpenAI.LatencySortInterval)
+	keepStartupSetting("UPSTREAM_LATENCY_WINDOW", previous.OpenAI.LatencyWindow, &config.OpenAI.LatencyWindow)
+	keepStartupSetting("HEALTH_CHECK_INTERVAL", previous.OpenAI.HealthCheckInterval, &config.OpenAI.HealthCheckInterval)
+	keepStartupSetting("HEALTH_CHECK_PATH", previous.OpenAI.HealthCheckPath, &config.OpenAI.HealthCheckPath)
+	keepStartupSetting("HEALTH_CHECK_FAIL_THRESHOLD", previous.OpenAI.HealthCheckFailThreshold, &config.OpenAI.HealthCheckFailThreshold)
+	keepStartupSetting("HEALTH_CHECK_RECOVER_THRESHOLD", previous.OpenAI.HealthCheckRecoverThreshold, &config.OpenAI.HealthCheckRecoverThreshold)
+
+	// Middleware created with the router
+	keepStartupSetting("RATE_LIMIT_ENABLED", previous.RateLimit.Enabled, &config.RateLimit.Enabled)
+	keepStartupSetting("RATE_LIMIT_REQUESTS_PER_MINUTE", previous.RateLimit.RequestsPerMinute, &config.RateLimit.RequestsPerMinute)
+	keepStartupSetting("RATE_LIMIT_BURST_SIZE", previous.RateLimit.BurstSize, &config.RateLimit.BurstSize)
+	keepStartupSetting("RATE_LIMIT_BY_HEADER", previous.RateLimit.LimitByHeader, &config.RateLimit.LimitByHeader)
+	keepStartupSetting("RATE_LIMIT_ENTRY_TTL_SECONDS", previous.RateLimit.EntryTTLSeconds, &config.RateLimit.EntryTTLSeconds)
+	keepStartupSetting("QUOTA_TRACKING_ENABLED", previous.Quota.Enabled, &config.Quota.Enabled)
+	keepStartupSetting("QUOTA_PERIOD", previous.Quota.Period, &config.Quota.Period)
+	keepStartupMap("QUOTAS", previous.Quota.Quotas, &config.Quota.Quotas)
+	keepStartupSetting("MAX_CONCURRENT_REQUESTS", previous.Performance.MaxConcurrentRequests, &config.Performance.MaxConcurrentRequests)
+	keepStartupSetting("ENABLE_GZIP", previous.Performance.EnableGzip, &config.Performance.EnableGzip)
+	keepStartupSetting("ENABLE_BROTLI", previous.Performance.EnableBrotli, &config.Performance.EnableBrotli)
+	keepStartupSetting("COMPRESSION_PREFER_CLIENT", previous.Performance.CompressionPreferClient, &config.Performance.CompressionPreferClient)
+	keepStartupSetting("SINGLEFLIGHT_ENABLED", previous.Performance.SingleflightEnabled, &config.Performance.SingleflightEnabled)
+	keepStartupSetting("MAX_SSE_EVENTS_PER_RESPONSE", previous.Performance.MaxSSEEventsPerResponse, &config.Performance.MaxSSEEventsPerResponse)
+	keepStartupSetting("CACHE_ENABLED", previous.Performance.CacheEnabled, &config.Performance.CacheEnabled)
+	keepStartupSetting("CACHE_TTL_SECONDS", previous.Performance.CacheTTLSeconds, &config.Performance.CacheTTLSeconds)
+	keepStartupSetting("CACHE_MAX_SIZE_MB", previous.Performance.CacheMaxSizeMB, &config.Performance.CacheMaxSizeMB)
+	keepStartupSetting("OTEL_ENABLED", previous.Performance.OTELEnabled, &config.Performance.OTELEnabled)
+	keepStartupSetting("OTEL_ENDPOINT", previous.Performance.OTELEndpoint, &config.Performance.OTELEndpoint)
+	keepStartupSetting("OTEL_SERVICE_NAME", previous.Performance.OTELServiceName, &config.Performance.OTELServiceName)
+
+	// Logging, LOG_LEVEL is applied on reload
+	keepStartupSetting("LOG_FORMAT", previous.Log.Format, &config.Log.Format)
+	keepStartupSetting("LOG_ENABLE_REQUEST", previous.Log.EnableRequest, &config.Log.EnableRequest)
+	keepStartupSetting("LOG_REQUEST_ID_HEADER", previous.Log.RequestIDHeader, &config.Log.RequestIDHeader)
+	keepStartupMap("LOG_EXTRACT_HEADERS", previous.Log.ExtractHeaders, &config.Log.ExtractHeaders)
+	keepStartupSetting("AUDIT_LOG_ENABLED", previous.Log.AuditLogEnabled, &config.Log.AuditLogEnabled)
+	keepStartupSetting("CLONE_REQUEST_FOR_AUDIT", previous.Log.CloneRequestForAudit, &config.Log.CloneRequestForAudit)
+	keepStartupSetting("SERVER_TIMING_ENABLED", previous.Log.ServerTimingEnabled, &config.Log.ServerTimingEnabled)
+	keepStartupList("LOG_EXCLUDE_PATHS", previous.Log.ExcludePaths, &config.Log.ExcludePaths)
+	keepStartupList("BODY_REDACT_PATTERNS", previous.Log.BodyRedactPatterns, &config.Log.BodyRedactPatterns)
+	keepStartupList("LOG_REQUEST_FIELDS", previous.Log.RequestFields, &config.Log.RequestFields)
+}
+
+// keepStartupSecret is keepStartupSetting for credentials, which are not logged
+func keepStartupSecret(name string, current string, next *string) {
+	if *next != current {
+		logrus.Warnf("%s cannot change at runtime, keeping the current value until restart", name)
+		*next = current
+	}
+}
+
+// keepStartupList is keepStartupSetting for list settings
+func keepStartupList[T comparable](name string, current []T, next *[]T) {
+	if !slices.Equal(*next, current) {
+		logrus.Warnf("%s cannot change at runtime, keeping the current value until restart", name)
+		*next = current
+	}
+}
+
+// keepStartupMap is keepStartupSetting for map settings
+func keepStartupMap[K, V comparable](name string, current map[K]V, next *map[K]V) {
+	if !maps.Equal(*next, current) {
+		logrus.Warnf("%s cannot change at runtime, keeping the current value until restart", name)
+		*next = current
+	}
+}
+
+// rebuildSelection derives the upstream selection state from the current config,
+// carrying over circuit breakers of upstreams that are still configured. Must be
+// called with mu held once the manager is shared.
+func (m *Manager) rebuildSelection(previous *Config) {
+	config := m.config
+	upstreamsChanged := previous == nil || !slices.Equal(previous.OpenAI.BaseURLs, config.OpenAI.BaseURLs) ||
+		!slices.Equal(previous.OpenAI.UpstreamBURLs, config.OpenAI.UpstreamBURLs)
+	if upstreamsChanged {
+		atomic.StoreUint64(&m.roundRobinCounter, 0)
+		atomic.StoreUint64(&m.groupBCounter, 0)
+	}
+
+	m.hashRing = nil
+	if config.OpenAI.LoadBalanceStrategy == LoadBalanceConsistentHash {
+		m.hashRing = NewConsistentHashRing(config.OpenAI.BaseURLs, config.OpenAI.ConsistentHashReplicas)
+	}
+	m.weightedSlots = weightedSlotsFor(config.OpenAI.BaseURLs, config.OpenAI.BaseURLWeights)
+	m.failoverTiers = failoverTiersFor(config.OpenAI.BaseURLs, config.OpenAI.UpstreamTiers)
+	m.router = newModelRouter(config.Routing.Rules)
+
+	// In-flight counts survive a reload unless the upstreams change
+	if config.OpenAI.LoadBalanceStrategy != LoadBalanceLeastConnections {
+		m.connections = nil
+	} else if m.connections == nil || upstreamsChanged {
+		m.connections = newConnectionCounter(append(slices.Clone(config.OpenAI.BaseURLs), config.OpenAI.UpstreamBURLs...))
+	}
+
+	// Latency averages also survive unless the upstreams change
+	slaThreshold := time.Duration(config.OpenAI.UpstreamSLAThresholdMs) * time.Millisecond
+	if m.latencies == nil || upstreamsChanged {
+		m.latencies = newLatencyAverages(append(slices.Clone(config.OpenAI.BaseURLs), config.OpenAI.UpstreamBURLs...), slaThreshold)
+	} else {
+		m.latencies = m.latencies.withThreshold(slaThreshold)
+	}
+
+	if config.OpenAI.CircuitFailThreshold <= 0 {
+		m.breakers = nil
+		return
+	}
+	var existing map[string]*circuitbreaker.CircuitBreaker
+	if previous != nil && previous.OpenAI.CircuitFailThreshold == config.OpenAI.CircuitFailThreshold &&
+		previous.OpenAI.CircuitSuccessThreshold == config.OpenAI.CircuitSuccessThreshold &&
+		previous.OpenAI.CircuitOpenTimeout == config.OpenAI.CircuitOpenTimeout {
+		existing = m.breakers
+	}
+	m.breakers = newCircuitBreakers(config.OpenAI, config.Routing, existing)
+}
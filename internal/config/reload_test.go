@@ -0,0 +1,98 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+// newTestManager returns a manager built from env, without the scheduler
+func newTestManager(t *testing.T, env map[string]string) *Manager {
+	t.Helper()
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	config, parseErrors, err := buildConfig()
+	if err != nil {
+		t.Fatalf("buildConfig: %v", err)
+	}
+	manager := &Manager{config: config, parseErrors: parseErrors}
+	if err := manager.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	manager.rebuildSelection(nil)
+	return manager
+}
+
+func TestReloadAppliesRuntimeSettings(t *testing.T) {
+	manager := newTestManager(t, map[string]string{
+		"API_KEYS":            "sk-startup",
+		"AUTH_KEYS":           "old-key,kept-key",
+		"ALLOWED_ORIGINS":     "https://a.example",
+		"BLACKLIST_THRESHOLD": "1",
+	})
+	t.Setenv("AUTH_KEYS", "kept-key")
+	t.Setenv("ALLOWED_ORIGINS", "https://b.example")
+	t.Setenv("MAX_RETRIES", "7")
+	if err := manager.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+
+	if keys := manager.GetAuthConfig().Keys; !slices.Equal(keys, []string{"kept-key"}) {
+		t.Errorf("AUTH_KEYS = %v, want [kept-key]", keys)
+	}
+	if origins := manager.GetCORSConfig().AllowedOrigins; !slices.Equal(origins, []string{"https://b.example"}) {
+		t.Errorf("ALLOWED_ORIGINS = %v, want [https://b.example]", origins)
+	}
+	if retries := manager.GetKeysConfig().MaxRetries; retries != 7 {
+		t.Errorf("MAX_RETRIES = %d, want 7", retries)
+	}
+}
+
+func TestReloadKeepsStartupSettings(t *testing.T) {
+	tests := []struct {
+		name  string
+		env   string
+		value string
+		check func(*Manager) bool
+	}{
+		{name: "blacklist threshold", env: "BLACKLIST_THRESHOLD", value: "5", check: func(m *Manager) bool { return m.GetKeysConfig().BlacklistThreshold == 1 }},
+		{name: "429 cooldown", env: "KEY_COOLDOWN_AFTER_429_MS", value: "500", check: func(m *Manager) bool { return m.GetKeysConfig().Cooldown429Ms == 0 }},
+		{name: "max key count", env: "MAX_KEY_COUNT", value: "10", check: func(m *Manager) bool { return m.GetKeysConfig().MaxKeyCount == 10000 }},
+		{name: "api keys", env: "API_KEYS", value: "sk-other", check: func(m *Manager) bool { return slices.Equal(m.GetKeysConfig().APIKeys, []string{"sk-startup"}) }},
+		{name: "hot standby key", env: "HOT_STANDBY_KEY", value: "sk-standby", check: func(m *Manager) bool { return m.GetKeysConfig().HotStandbyKey == "" }},
+		{name: "query params", env: "UPSTREAM_QUERY_PARAMS", value: "key=secret", check: func(m *Manager) bool { return m.GetOpenAIConfig().UpstreamQueryParams == "" }},
+		{name: "inject fields", env: "UPSTREAM_INJECT_BODY_FIELDS", value: `{"user":"proxy"}`, check: func(m *Manager) bool { return len(m.GetOpenAIConfig().InjectBodyFields) == 0 }},
+		{name: "request timeout", env: "REQUEST_TIMEOUT", value: "5", check: func(m *Manager) bool { return m.GetOpenAIConfig().RequestTimeout == DefaultConstants.DefaultTimeout }},
+		{name: "broadcast paths", env: "BROADCAST_PATHS", value: "/v1/other", check: func(m *Manager) bool {
+			return slices.Equal(m.GetOpenAIConfig().BroadcastPaths, []string{"/v1/models"})
+		}},
+		{name: "log format", env: "LOG_FORMAT", value: "json", check: func(m *Manager) bool { return m.GetLogConfig().Format == "text" }},
+		{name: "quotas", env: "QUOTAS", value: `{"alice":{"requests":100}}`, check: func(m *Manager) bool { return len(m.GetQuotaConfig().Quotas) == 0 }},
+		{name: "admin key", env: "ADMIN_AUTH_KEY", value: "admin-secret", check: func(m *Manager) bool { return !m.GetAdminConfig().Enabled && m.GetAdminConfig().AuthKey == "" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := newTestManager(t, map[string]string{"API_KEYS": "sk-startup"})
+			t.Setenv(tt.env, tt.value)
+			if err := manager.Reload(); err != nil {
+				t.Fatalf("Reload: %v", err)
+			}
+			if !tt.check(manager) {
+				t.Errorf("%s=%s was applied at runtime", tt.env, tt.value)
+			}
+		})
+	}
+}
+
+func TestReloadKeepsAuthenticationEnabled(t *testing.T) {
+	manager := newTestManager(t, map[string]string{"API_KEYS": "sk-startup", "AUTH_KEYS": "old-key"})
+	t.Setenv("AUTH_KEYS", "")
+	if err := manager.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+
+	authConfig := manager.GetAuthConfig()
+	if !authConfig.Enabled || len(authConfig.Keys) != 0 {
+		t.Errorf("auth after removing every key = enabled %v with %d keys, want enabled with none", authConfig.Enabled, len(authConfig.Keys))
+	}
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Request ID formats
+const (
+	RequestIDFormatUUID      = "uuid"
+	RequestIDFormatHex16     = "hex16"
+	RequestIDFormatSnowflake = "snowflake"
+)
+
+// Snowflake layout: 41-bit timestamp, 10-bit machine ID, 12-bit sequence
+const (
+	snowflakeMachineBits  = 10
+	snowflakeSequenceBits = 12
+	snowflakeMaxMachineID = 1<<snowflakeMachineBits - 1
+	snowflakeMaxSequence  = 1<<snowflakeSequenceBits - 1
+)
+
+// snowflakeEpoch is the custom epoch (2024-01-01 UTC) the timestamp counts from,
+// keeping the 41-bit timestamp valid for roughly 69 years
+var snowflakeEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+
+// snowflakeGenerator produces time-sortable 64-bit IDs
+type snowflakeGenerator struct {
+	machineID int64
+	lastMs    int64
+	sequence  int64
+	mu        sync.Mutex
+}
+
+// newSnowflakeGenerator creates a generator, deriving the machine ID from the hostname when machineID is negative
+func newSnowflakeGenerator(machineID int) *snowflakeGenerator {
+	if machineID < 0 {
+		machineID = hostnameMachineID()
+	}
+	return &snowflakeGenerator{machineID: int64(machineID)}
+}
+
+// Next returns the next ID as a decimal string
+func (g *snowflakeGenerator) Next() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now().UnixMilli() - snowflakeEpoch
+
+	// Never hand out a timestamp older than the last one, even if the clock moves backwards
+	if now < g.lastMs {
+		now = g.lastMs
+	}
+
+	if now == g.lastMs {
+		g.sequence = (g.sequence + 1) & snowflakeMaxSequence
+		if g.sequence == 0 {
+			// Sequence exhausted for this millisecond, wait for the next one
+			for now <= g.lastMs {
+				time.Sleep(100 * time.Microsecond)
+				now = time.Now().UnixMilli() - snowflakeEpoch
+			}
+		}
+	} else {
+		g.sequence = 0
+	}
+	g.lastMs = now
+
+	id := now<<(snowflakeMachineBits+snowflakeSequenceBits) | g.machineID<<snowflakeSequenceBits | g.sequence
+	return strconv.FormatInt(id, 10)
+}
+
+// hostnameMachineID derives a machine ID from a hash of the hostname
+func hostnameMachineID() int {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return 0
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(hostname))
+	return int(hash.Sum32() % (snowflakeMaxMachineID + 1))
+}
+
+// newUUID returns a random RFC 4122 version 4 UUID
+func newUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// newHex16 returns 16 random hex characters
+func newHex16() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestGenerateRequestID(t *testing.T) {
+	tests := []struct {
+		format string
+		want   *regexp.Regexp
+	}{
+		{format: RequestIDFormatUUID, want: regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)},
+		{format: RequestIDFormatHex16, want: regexp.MustCompile(`^[0-9a-f]{16}$`)},
+		{format: RequestIDFormatSnowflake, want: regexp.MustCompile(`^[1-9][0-9]*$`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			manager := newTestManager(t, map[string]string{"API_KEYS": "sk-startup", "REQUEST_ID_FORMAT": tt.format})
+			manager.snowflake = newSnowflakeGenerator(7)
+			seen := make(map[string]bool)
+			for i := 0; i < 1000; i++ {
+				id := manager.GenerateRequestID()
+				if !tt.want.MatchString(id) {
+					t.Fatalf("request ID %q does not match %s", id, tt.want)
+				}
+				if seen[id] {
+					t.Fatalf("request ID %q generated twice", id)
+				}
+				seen[id] = true
+			}
+		})
+	}
+}
+
+func TestSnowflakeIDsIncrease(t *testing.T) {
+	generator := newSnowflakeGenerator(7)
+	previous := int64(0)
+	// More IDs than the sequence holds, so some millisecond runs out of sequence numbers
+	for i := 0; i < 3*(snowflakeMaxSequence+1); i++ {
+		id, err := strconv.ParseInt(generator.Next(), 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id <= previous {
+			t.Fatalf("ID %d after %d, want increasing IDs", id, previous)
+		}
+		if machineID := id >> snowflakeSequenceBits & snowflakeMaxMachineID; machineID != 7 {
+			t.Fatalf("ID %d carries machine ID %d, want 7", id, machineID)
+		}
+		previous = id
+	}
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"sort"
+	"sync/atomic"
+)
+
+// RouteWildcard is the routing rule prefix matching any model without a more specific rule
+const RouteWildcard = "*"
+
+// routePool is the upstream pool of a routing rule, balanced round-robin
+type routePool struct {
+	baseURLs []string
+	counter  uint64
+}
+
+// modelRouter maps model name prefixes to upstream pools. Lookups probe one
+// map entry per distinct prefix length, longest first, so the cost depends on
+// the number of distinct lengths rather than the number of rules.
+type modelRouter struct {
+	pools         map[string]*routePool
+	prefixLengths []int      // Distinct prefix lengths, longest first
+	wildcard      *routePool // Nil unless a "*" rule is configured
+}
+
+// newModelRouter compiles routing rules, returning nil when there are none
+func newModelRouter(rules map[string][]string) *modelRouter {
+	if len(rules) == 0 {
+		return nil
+	}
+
+	router := &modelRouter{pools: make(map[string]*routePool, len(rules))}
+	seenLengths := make(map[int]bool)
+	for prefix, baseURLs := range rules {
+		pool := &routePool{baseURLs: baseURLs}
+		if prefix == RouteWildcard {
+			router.wildcard = pool
+			continue
+		}
+		router.pools[prefix] = pool
+		if !seenLengths[len(prefix)] {
+			seenLengths[len(prefix)] = true
+			router.prefixLengths = append(router.prefixLengths, len(prefix))
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(router.prefixLengths)))
+	return router
+}
+
+// match returns the pool of the longest prefix rule matching model, then the wildcard pool
+func (r *modelRouter) match(model string) *routePool {
+	for _, length := range r.prefixLengths {
+		if length > len(model) {
+			continue
+		}
+		if pool, exists := r.pools[model[:length]]; exists {
+			return pool
+		}
+	}
+	return r.wildcard
+}
+
+// routeModel picks the next upstream from the pool routed to model, skipping
+// degraded upstreams. Returns false when no rule covers the model.
+func (m *Manager) routeModel(model string) (string, bool) {
+	m.mu.RLock()
+	router := m.router
+	m.mu.RUnlock()
+	if router == nil {
+		return "", false
+	}
+	pool := router.match(model)
+	if pool == nil {
+		return "", false
+	}
+
+	index := atomic.AddUint64(&pool.counter, 1) - 1
+	return m.skipDegraded(pool.baseURLs, index), true
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseRoutingRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    map[string][]string
+		wantErr bool
+	}{
+		{name: "empty"},
+		{
+			name:  "one upstream per prefix",
+			value: "gpt-4:https://a.openai.com,gpt-3.5:https://b.openai.com",
+			want:  map[string][]string{"gpt-4": {"https://a.openai.com"}, "gpt-3.5": {"https://b.openai.com"}},
+		},
+		{
+			name:  "repeated prefix pools upstreams",
+			value: "gpt-4:https://a1.example,gpt-4:https://a2.example",
+			want:  map[string][]string{"gpt-4": {"https://a1.example", "https://a2.example"}},
+		},
+		{name: "prefix with a colon", value: "ft:gpt-4:https://ft.example:8443", want: map[string][]string{"ft:gpt-4": {"https://ft.example:8443"}}},
+		{name: "wildcard", value: "*:https://any.example", want: map[string][]string{"*": {"https://any.example"}}},
+		{name: "missing prefix", value: "https://a.example", want: map[string][]string{}, wantErr: true},
+		{name: "missing url scheme", value: "gpt-4:a.example", want: map[string][]string{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs []string
+			rules := parseRoutingRules(tt.value, &errs)
+			if (len(errs) > 0) != tt.wantErr {
+				t.Errorf("errors = %v, want error %v", errs, tt.wantErr)
+			}
+			if len(rules) != len(tt.want) {
+				t.Fatalf("rules = %v, want %v", rules, tt.want)
+			}
+			for prefix, baseURLs := range tt.want {
+				if !slices.Equal(rules[prefix], baseURLs) {
+					t.Errorf("rules[%s] = %v, want %v", prefix, rules[prefix], baseURLs)
+				}
+			}
+		})
+	}
+}
+
+func TestModelRouterMatch(t *testing.T) {
+	rules := map[string][]string{
+		"gpt-4":       {"https://gpt4.example"},
+		"gpt-4o-mini": {"https://mini.example"},
+		"gpt-3.5":     {"https://gpt35.example"},
+	}
+	tests := []struct {
+		name     string
+		wildcard bool
+		model    string
+		want     string // First upstream of the matched pool, empty for none
+	}{
+		{name: "exact prefix", model: "gpt-4", want: "https://gpt4.example"},
+		{name: "longer model", model: "gpt-4-turbo", want: "https://gpt4.example"},
+		{name: "longest prefix wins", model: "gpt-4o-mini-2024-07-18", want: "https://mini.example"},
+		{name: "shorter prefix below the longest", model: "gpt-4o", want: "https://gpt4.example"},
+		{name: "other pool", model: "gpt-3.5-turbo", want: "https://gpt35.example"},
+		{name: "no rule", model: "claude-3"},
+		{name: "shorter than every prefix", model: "gpt"},
+		{name: "empty model", model: ""},
+		{name: "wildcard catches the rest", wildcard: true, model: "claude-3", want: "https://any.example"},
+		{name: "wildcard below prefixes", wildcard: true, model: "gpt-4-turbo", want: "https://gpt4.example"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compiled := make(map[string][]string, len(rules)+1)
+			for prefix, baseURLs := range rules {
+				compiled[prefix] = baseURLs
+			}
+			if tt.wildcard {
+				compiled[RouteWildcard] = []string{"https://any.example"}
+			}
+			pool := newModelRouter(compiled).match(tt.model)
+			got := ""
+			if pool != nil {
+				got = pool.baseURLs[0]
+			}
+			if got != tt.want {
+				t.Errorf("match(%q) = %q, want %q", tt.model, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoutingIsolatesPools(t *testing.T) {
+	manager := newTestManager(t, map[string]string{
+		"API_KEYS":        "sk-startup",
+		"OPENAI_BASE_URL": "https://default.example",
+		"ROUTING_RULES":   "gpt-4:https://a1.example,gpt-4:https://a2.example,gpt-3.5:https://b.example",
+	})
+	tests := []struct {
+		model string
+		want  []string // Upstreams the model is balanced over
+	}{
+		{model: "gpt-4-turbo", want: []string{"https://a1.example", "https://a2.example"}},
+		{model: "gpt-3.5-turbo", want: []string{"https://b.example"}},
+		{model: "claude-3", want: []string{"https://default.example"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			for _, get := range []func() string{
+				func() string { return manager.GetOpenAIConfigForModel(tt.model).BaseURL },
+				func() string { return manager.GetUpstreamForCaller("caller", tt.model) },
+			} {
+				seen := make(map[string]int)
+				for i := 0; i < 20; i++ {
+					seen[get()]++
+				}
+				if len(seen) != len(tt.want) {
+					t.Errorf("%s routed to %v, want only %v", tt.model, seen, tt.want)
+				}
+				for _, baseURL := range tt.want {
+					if seen[baseURL] != 20/len(tt.want) {
+						t.Errorf("%s sent %d of 20 requests to %s, want an even round-robin", tt.model, seen[baseURL], baseURL)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestValidateRoutingRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		wantErr string
+	}{
+		{name: "valid", rules: "gpt-4:https://a.example,*:https://b.example"},
+		{name: "unparseable", rules: "https://a.example", wantErr: "invalid routing rule"},
+		{name: "upstream without host", rules: "gpt-4:https://", wantErr: "invalid upstream URL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidation(t, map[string]string{"ROUTING_RULES": tt.rules}, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"encoding/json"
+
+	"gpt-load/internal/redact"
+
+	"github.com/sirupsen/logrus"
+)
+
+// redactedValue replaces secrets that are shown in no form at all
+const redactedValue = "[REDACTED]"
+
+// Sanitize returns a deep copy of the configuration that is safe to expose.
+// API keys keep only their last 4 characters, AUTH_KEYS are redacted and
+// settings tagged json:"-" are left empty.
+func (c *Config) Sanitize() Config {
+	// A JSON round trip copies every slice and map and drops the json:"-" secrets
+	var sanitized Config
+	data, err := json.Marshal(c)
+	if err == nil {
+		err = json.Unmarshal(data, &sanitized)
+	}
+	if err != nil {
+		// Expose nothing rather than a partial copy
+		logrus.Errorf("Failed to copy configuration for export: %v", err)
+		return Config{}
+	}
+
+	for i, key := range sanitized.Keys.APIKeys {
+		sanitized.Keys.APIKeys[i] = redact.MaskKeyAlways(key)
+	}
+	for i := range sanitized.Auth.Keys {
+		sanitized.Auth.Keys[i] = redactedValue
+	}
+	return sanitized
+}
+
+// GetSanitizedConfig returns the running configuration with secrets masked
+func (m *Manager) GetSanitizedConfig() any {
+	return m.current().Sanitize()
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"gpt-load/pkg/types"
+)
+
+func TestSanitize(t *testing.T) {
+	secrets := []string{
+		"sk-live-alpha-0001", "sk-live-bravo-0002", "client-secret-key", "admin-secret-key",
+		"https://keys.internal/list?token=fetch-secret", "Authorization: Bearer fetch-header-secret",
+		"sk-fallback-secret", "AKIAFAKEACCESSKEY", "aws-secret-access-key", "webhook-hmac-secret",
+	}
+	config := &Config{
+		Server: types.ServerConfig{Port: 3000, Host: "0.0.0.0"},
+		Keys: types.KeysConfig{
+			APIKeys:                []string{"sk-live-alpha-0001", "sk-live-bravo-0002"},
+			MaxRetries:             3,
+			KeyFetchURL:            "https://keys.internal/list?token=fetch-secret",
+			KeyFetchAuthHeader:     "Authorization: Bearer fetch-header-secret",
+			BlacklistWebhookSecret: "webhook-hmac-secret",
+		},
+		OpenAI: types.OpenAIConfig{
+			BaseURLs:             []string{"https://api.openai.com"},
+			FallbackUpstreamKeys: []string{"sk-fallback-secret"},
+			AWSAccessKeyID:       "AKIAFAKEACCESSKEY",
+			AWSSecretAccessKey:   "aws-secret-access-key",
+		},
+		Auth:  types.AuthConfig{Enabled: true, Keys: []string{"client-secret-key"}},
+		Admin: types.AdminConfig{Enabled: true, Port: 3001, AuthKey: "admin-secret-key"},
+	}
+
+	sanitized := config.Sanitize()
+	data, err := json.Marshal(sanitized)
+	if err != nil {
+		t.Fatalf("marshal sanitized config: %v", err)
+	}
+	for _, secret := range secrets {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("sanitized config contains %q", secret)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		got, want any
+	}{
+		{name: "API keys keep their last 4 characters", got: sanitized.Keys.APIKeys, want: []string{"sk-****0001", "sk-****0002"}},
+		{name: "auth keys redacted", got: sanitized.Auth.Keys, want: []string{redactedValue}},
+		{name: "admin key left out", got: sanitized.Admin.AuthKey, want: ""},
+		{name: "fallback keys left out", got: len(sanitized.OpenAI.FallbackUpstreamKeys), want: 0},
+		{name: "AWS credentials left out", got: sanitized.OpenAI.AWSSecretAccessKey, want: ""},
+		{name: "key fetch URL left out", got: sanitized.Keys.KeyFetchURL, want: ""},
+		{name: "server kept", got: sanitized.Server, want: config.Server},
+		{name: "retries kept", got: sanitized.Keys.MaxRetries, want: 3},
+		{name: "upstreams kept", got: strings.Join(sanitized.OpenAI.BaseURLs, ","), want: "https://api.openai.com"},
+		{name: "admin port kept", got: sanitized.Admin.Port, want: 3001},
+		{name: "auth enabled kept", got: sanitized.Auth.Enabled, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if gotJSON, wantJSON := mustJSON(t, tt.got), mustJSON(t, tt.want); gotJSON != wantJSON {
+				t.Errorf("got %s, want %s", gotJSON, wantJSON)
+			}
+		})
+	}
+
+	// The copy is deep, masking it leaves the running configuration alone
+	sanitized.OpenAI.BaseURLs[0] = "https://changed.example"
+	if !slices.Equal(config.Keys.APIKeys, []string{"sk-live-alpha-0001", "sk-live-bravo-0002"}) || config.OpenAI.BaseURLs[0] != "https://api.openai.com" {
+		t.Errorf("Sanitize modified the running configuration: %v %v", config.Keys.APIKeys, config.OpenAI.BaseURLs)
+	}
+	if config.Admin.AuthKey != "admin-secret-key" || config.Auth.Keys[0] != "client-secret-key" {
+		t.Error("Sanitize cleared secrets of the running configuration")
+	}
+}
+
+func mustJSON(t *testing.T, value any) string {
+	t.Helper()
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("marshal %v: %v", value, err)
+	}
+	return string(data)
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gpt-load/internal/errors"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Scheduler runs named maintenance tasks at fixed intervals
+type Scheduler struct {
+	tasks   []*scheduledTask
+	ctx     context.Context
+	cancel  context.CancelFunc
+	started bool
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+}
+
+// scheduledTask represents a single periodic task
+type scheduledTask struct {
+	name     string
+	interval time.Duration
+	fn       func(ctx context.Context)
+}
+
+// NewScheduler creates a new, not yet started scheduler
+func NewScheduler() *Scheduler {
+	return &Scheduler{}
+}
+
+// AddTask registers a periodic task. Tasks added after Start begin running immediately.
+func (s *Scheduler) AddTask(name string, interval time.Duration, fn func(ctx context.Context)) error {
+	if name == "" {
+		return errors.NewAppError(errors.ErrConfigInvalid, "Task name cannot be empty")
+	}
+	if interval <= 0 {
+		return errors.NewAppErrorWithDetails(errors.ErrConfigInvalid, "Task interval must be positive", name)
+	}
+	if fn == nil {
+		return errors.NewAppErrorWithDetails(errors.ErrConfigInvalid, "Task function cannot be nil", name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, task := range s.tasks {
+		if task.name == name {
+			return errors.NewAppErrorWithDetails(errors.ErrConfigInvalid, "Task already registered", name)
+		}
+	}
+
+	task := &scheduledTask{name: name, interval: interval, fn: fn}
+	s.tasks = append(s.tasks, task)
+
+	if s.started {
+		s.launch(task)
+	}
+
+	logrus.Debugf("Scheduled task %s registered (interval: %v)", name, interval)
+	return nil
+}
+
+// Start starts all registered tasks. Cancelling ctx stops them.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return
+	}
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	s.started = true
+
+	for _, task := range s.tasks {
+		s.launch(task)
+	}
+}
+
+// Stop stops all tasks and waits for running executions to return
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	s.wg.Wait()
+}
+
+// launch starts the goroutine driving a task, must be called with mu held
+func (s *Scheduler) launch(task *scheduledTask) {
+	s.wg.Add(1)
+	go func(ctx context.Context) {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(task.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.execute(ctx, task)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}(s.ctx)
+}
+
+// execute runs a single task iteration, recovering from panics
+func (s *Scheduler) execute(ctx context.Context, task *scheduledTask) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			logrus.Errorf("Scheduled task %s panicked: %v", task.name, recovered)
+		}
+	}()
+
+	// Skip the run if shutdown raced with the tick
+	if ctx.Err() != nil {
+		return
+	}
+	task.fn(ctx)
+}
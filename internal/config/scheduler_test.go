@@ -0,0 +1,155 @@
+package config
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+// waitFor polls cond until it holds or a second has passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSchedulerRunsTasks(t *testing.T) {
+	scheduler := NewScheduler()
+	var early, late atomic.Int32
+	if err := scheduler.AddTask("early", 10*time.Millisecond, func(context.Context) { early.Add(1) }); err != nil {
+		t.Fatalf("AddTask: %v", err)
+	}
+
+	// Nothing runs before Start
+	time.Sleep(30 * time.Millisecond)
+	if n := early.Load(); n != 0 {
+		t.Fatalf("task ran %d times before Start", n)
+	}
+
+	scheduler.Start(context.Background())
+	defer scheduler.Stop()
+	start := time.Now()
+	waitFor(t, "three runs", func() bool { return early.Load() >= 3 })
+	// The first run waits for a full interval
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("three runs after %v, want at least three 10ms intervals", elapsed)
+	}
+
+	// Tasks added while running start right away
+	if err := scheduler.AddTask("late", 10*time.Millisecond, func(context.Context) { late.Add(1) }); err != nil {
+		t.Fatalf("AddTask: %v", err)
+	}
+	waitFor(t, "the late task", func() bool { return late.Load() >= 2 })
+}
+
+func TestSchedulerStopsOnCancel(t *testing.T) {
+	tests := []struct {
+		name string
+		stop func(cancel context.CancelFunc, scheduler *Scheduler)
+	}{
+		{name: "parent context cancelled", stop: func(cancel context.CancelFunc, _ *Scheduler) { cancel() }},
+		{name: "Stop", stop: func(_ context.CancelFunc, scheduler *Scheduler) { scheduler.Stop() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			scheduler := NewScheduler()
+			var runs atomic.Int32
+			stopped := make(chan struct{})
+			scheduler.AddTask("blocking", 10*time.Millisecond, func(ctx context.Context) {
+				// The first run blocks until the task's context ends
+				if runs.Add(1) == 1 {
+					<-ctx.Done()
+					close(stopped)
+				}
+			})
+			scheduler.Start(ctx)
+			waitFor(t, "the first run", func() bool { return runs.Load() == 1 })
+
+			tt.stop(cancel, scheduler)
+			select {
+			case <-stopped:
+			case <-time.After(time.Second):
+				t.Fatal("running task's context was not cancelled")
+			}
+			scheduler.Stop()
+
+			after := runs.Load()
+			time.Sleep(50 * time.Millisecond)
+			if n := runs.Load(); n != after {
+				t.Errorf("task ran %d more times after stopping", n-after)
+			}
+		})
+	}
+}
+
+func TestSchedulerRecoversPanics(t *testing.T) {
+	hook := &test.Hook{}
+	previousHooks := logrus.StandardLogger().ReplaceHooks(logrus.LevelHooks{})
+	logrus.AddHook(hook)
+	defer logrus.StandardLogger().ReplaceHooks(previousHooks)
+
+	scheduler := NewScheduler()
+	var panics, healthy atomic.Int32
+	scheduler.AddTask("panicking", 10*time.Millisecond, func(context.Context) {
+		panics.Add(1)
+		panic("boom")
+	})
+	scheduler.AddTask("healthy", 10*time.Millisecond, func(context.Context) { healthy.Add(1) })
+	scheduler.Start(context.Background())
+
+	// The panicking task keeps its schedule and leaves the others alone
+	waitFor(t, "repeated panics", func() bool { return panics.Load() >= 3 && healthy.Load() >= 3 })
+	scheduler.Stop()
+
+	logged := false
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == logrus.ErrorLevel && strings.Contains(entry.Message, "Scheduled task panicking panicked: boom") {
+			logged = true
+		}
+	}
+	if !logged {
+		t.Error("panic was not logged")
+	}
+}
+
+func TestSchedulerAddTaskErrors(t *testing.T) {
+	noop := func(context.Context) {}
+	tests := []struct {
+		name     string
+		task     string
+		interval time.Duration
+		fn       func(context.Context)
+		wantErr  string
+	}{
+		{name: "valid", task: "other", interval: time.Second, fn: noop},
+		{name: "empty name", interval: time.Second, fn: noop, wantErr: "Task name cannot be empty"},
+		{name: "zero interval", task: "zero", fn: noop, wantErr: "Task interval must be positive"},
+		{name: "negative interval", task: "negative", interval: -time.Second, fn: noop, wantErr: "Task interval must be positive"},
+		{name: "nil function", task: "nil", interval: time.Second, wantErr: "Task function cannot be nil"},
+		{name: "duplicate name", task: "existing", interval: time.Second, fn: noop, wantErr: "Task already registered"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheduler := NewScheduler()
+			if err := scheduler.AddTask("existing", time.Second, noop); err != nil {
+				t.Fatalf("AddTask: %v", err)
+			}
+			err := scheduler.AddTask(tt.task, tt.interval, tt.fn)
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("AddTask error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// MaxUpstreamWeight is the largest weight accepted in an OPENAI_BASE_URL weight suffix
+const MaxUpstreamWeight = 100
+
+// splitUpstreamWeight splits a trailing ":N" weight suffix from an upstream URL
+// (e.g. "https://a.openai.com:3"). When the suffix is syntactically the URL's
+// port it is only taken as a weight up to MaxUpstreamWeight, so ordinary ports
+// such as :8080 keep working. Returns weight 1 when there is no suffix.
+func splitUpstreamWeight(baseURL string) (string, int) {
+	schemeEnd := strings.Index(baseURL, "://")
+	idx := strings.LastIndex(baseURL, ":")
+	if schemeEnd < 0 || idx <= schemeEnd {
+		return baseURL, 1
+	}
+
+	suffix := baseURL[idx+1:]
+	weight, err := strconv.Atoi(suffix)
+	if err != nil || strings.TrimLeft(suffix, "0123456789") != "" {
+		return baseURL, 1
+	}
+
+	if parsed, err := url.Parse(baseURL); err == nil && parsed.Port() == suffix && parsed.Path == "" && parsed.RawQuery == "" && weight > MaxUpstreamWeight {
+		return baseURL, 1
+	}
+	return baseURL[:idx], weight
+}
+
+// buildWeightedSlots expands upstreams into a selection sequence in which each
+// upstream appears as often as its weight. Smooth weighted round-robin spreads
+// the picks, so weights 3 and 1 yield a, a, b, a rather than a, a, a, b.
+func buildWeightedSlots(baseURLs []string, weights []int) []string {
+	total := 0
+	for _, weight := range weights {
+		total += weight
+	}
+
+	current := make([]int, len(weights))
+	slots := make([]string, 0, total)
+	for len(slots) < total {
+		best := 0
+		for i, weight := range weights {
+			current[i] += weight
+			if current[i] > current[best] {
+				best = i
+			}
+		}
+		current[best] -= total
+		slots = append(slots, baseURLs[best])
+	}
+	return slots
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSplitUpstreamWeight(t *testing.T) {
+	tests := []struct {
+		baseURL    string
+		wantURL    string
+		wantWeight int
+	}{
+		{baseURL: "https://a.openai.com:3", wantURL: "https://a.openai.com", wantWeight: 3},
+		{baseURL: "https://a.openai.com", wantURL: "https://a.openai.com", wantWeight: 1},
+		{baseURL: "https://a.openai.com/v1:2", wantURL: "https://a.openai.com/v1", wantWeight: 2},
+		{baseURL: "http://localhost:8080", wantURL: "http://localhost:8080", wantWeight: 1},
+		{baseURL: "http://localhost:8080:5", wantURL: "http://localhost:8080", wantWeight: 5},
+		{baseURL: "https://a.openai.com:x", wantURL: "https://a.openai.com:x", wantWeight: 1},
+		{baseURL: "a.openai.com:3", wantURL: "a.openai.com:3", wantWeight: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.baseURL, func(t *testing.T) {
+			gotURL, gotWeight := splitUpstreamWeight(tt.baseURL)
+			if gotURL != tt.wantURL || gotWeight != tt.wantWeight {
+				t.Errorf("splitUpstreamWeight = %q, %d, want %q, %d", gotURL, gotWeight, tt.wantURL, tt.wantWeight)
+			}
+		})
+	}
+}
+
+func TestBuildWeightedSlots(t *testing.T) {
+	tests := []struct {
+		name    string
+		urls    []string
+		weights []int
+		want    []string
+	}{
+		{name: "3 to 1 spread", urls: []string{"a", "b"}, weights: []int{3, 1}, want: []string{"a", "a", "b", "a"}},
+		{name: "equal", urls: []string{"a", "b", "c"}, weights: []int{1, 1, 1}, want: []string{"a", "b", "c"}},
+		{name: "5 2 1", urls: []string{"a", "b", "c"}, weights: []int{5, 2, 1}, want: []string{"a", "b", "a", "a", "c", "a", "b", "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := buildWeightedSlots(tt.urls, tt.weights); !slices.Equal(got, tt.want) {
+				t.Errorf("buildWeightedSlots = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWeightedDistribution(t *testing.T) {
+	const calls = 10000
+	tests := []struct {
+		name     string
+		baseURLs string
+		strategy string
+		want     map[string]float64
+	}{
+		{
+			name:     "round robin 3 to 1",
+			baseURLs: "https://a.openai.com:3,https://b.openai.com:1",
+			want:     map[string]float64{"https://a.openai.com": 0.75, "https://b.openai.com": 0.25},
+		},
+		{
+			name:     "round robin 5 3 2",
+			baseURLs: "https://a.openai.com:5,https://b.openai.com:3,https://c.openai.com:2",
+			want:     map[string]float64{"https://a.openai.com": 0.5, "https://b.openai.com": 0.3, "https://c.openai.com": 0.2},
+		},
+		{
+			name:     "unweighted",
+			baseURLs: "https://a.openai.com,https://b.openai.com",
+			want:     map[string]float64{"https://a.openai.com": 0.5, "https://b.openai.com": 0.5},
+		},
+		{
+			name:     "weighted random",
+			baseURLs: "https://a.openai.com:3,https://b.openai.com:1",
+			strategy: LoadBalanceWeighted,
+			want:     map[string]float64{"https://a.openai.com": 0.75, "https://b.openai.com": 0.25},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"API_KEYS": "sk-startup", "OPENAI_BASE_URL": tt.baseURLs}
+			if tt.strategy != "" {
+				env["LOAD_BALANCE_STRATEGY"] = tt.strategy
+			}
+			manager := newTestManager(t, env)
+
+			counts := make(map[string]int)
+			for i := 0; i < calls; i++ {
+				counts[manager.GetOpenAIConfig().BaseURL]++
+			}
+			for baseURL, share := range tt.want {
+				// Random selection converges within a few standard deviations
+				if got := float64(counts[baseURL]) / calls; math.Abs(got-share) > 0.02 {
+					t.Errorf("%s got %.3f of calls, want %.2f", baseURL, got, share)
+				}
+			}
+			if len(counts) != len(tt.want) {
+				t.Errorf("calls reached %v", counts)
+			}
+		})
+	}
+}
+
+func TestValidateUpstreamWeights(t *testing.T) {
+	tests := []struct {
+		name     string
+		baseURLs string
+		wantErr  string
+	}{
+		{name: "weights", baseURLs: "https://a.openai.com:3,https://b.openai.com:1"},
+		{name: "zero weight", baseURLs: "https://a.openai.com:0", wantErr: "weight for upstream"},
+		{name: "weight too high", baseURLs: "https://a.openai.com/v1:" + strings.Repeat("9", 4), wantErr: "weight for upstream"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidation(t, map[string]string{"OPENAI_BASE_URL": tt.baseURLs}, tt.wantErr)
+		})
+	}
+}
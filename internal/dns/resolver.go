@@ -0,0 +1,155 @@
+// Package dns caches upstream host lookups, honouring the TTL of the records
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Resolver resolves host names through the system's DNS servers and caches the
+// answers. Addresses are kept for the shorter of the configured TTL and the
+// lowest TTL in the answer, hosts that do not exist for the negative TTL.
+type Resolver struct {
+	ttl         time.Duration
+	negativeTTL time.Duration
+	dialer      net.Dialer
+	server      string // Replaces the system's DNS servers when set, used by tests
+
+	mu      sync.Mutex
+	entries map[string]entry
+}
+
+// entry is a cached lookup, either addresses or a not-found error
+type entry struct {
+	addrs   []net.IPAddr
+	err     error
+	expires time.Time
+}
+
+// New creates a resolver caching answers for at most ttl
+func New(ttl, negativeTTL time.Duration) *Resolver {
+	return &Resolver{
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		entries:     make(map[string]entry),
+	}
+}
+
+// LookupIPAddr returns the addresses of host, from the cache while they are fresh
+func (r *Resolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	now := time.Now()
+	r.mu.Lock()
+	cached, ok := r.entries[host]
+	r.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.addrs, cached.err
+	}
+
+	// A resolver per lookup, so the TTLs seen belong to this host alone
+	observer := &ttlObserver{}
+	resolver := &net.Resolver{PreferGo: true, Dial: observer.dial(&r.dialer, r.server)}
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound && r.negativeTTL > 0 {
+			r.store(host, entry{err: err, expires: now.Add(r.negativeTTL)})
+		}
+		return nil, err
+	}
+
+	ttl := r.ttl
+	if recordTTL, ok := observer.minTTL(); ok && recordTTL < ttl {
+		ttl = recordTTL
+	}
+	r.store(host, entry{addrs: addrs, expires: now.Add(ttl)})
+	return addrs, nil
+}
+
+// store caches a lookup result
+func (r *Resolver) store(host string, e entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[host] = e
+}
+
+// ttlObserver records the lowest answer TTL in the DNS responses of one lookup.
+// Answers from /etc/hosts or over TCP are not seen and keep the configured TTL.
+type ttlObserver struct {
+	mu   sync.Mutex
+	ttl  time.Duration
+	seen bool
+}
+
+// dial returns a resolver dial function that inspects replies on UDP connections
+func (o *ttlObserver) dial(dialer *net.Dialer, server string) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		if server != "" {
+			address = server
+		}
+		conn, err := dialer.DialContext(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		// The resolver frames messages by whether the conn is a net.PacketConn,
+		// which the wrapper keeps by embedding the UDP conn itself
+		if udpConn, ok := conn.(*net.UDPConn); ok {
+			return &observedConn{UDPConn: udpConn, observer: o}, nil
+		}
+		return conn, nil
+	}
+}
+
+// observe takes the answer TTLs of a DNS response into account
+func (o *ttlObserver) observe(msg []byte) {
+	var parser dnsmessage.Parser
+	if _, err := parser.Start(msg); err != nil {
+		return
+	}
+	if err := parser.SkipAllQuestions(); err != nil {
+		return
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for {
+		header, err := parser.AnswerHeader()
+		if err != nil {
+			return
+		}
+		ttl := time.Duration(header.TTL) * time.Second
+		if !o.seen || ttl < o.ttl {
+			o.ttl = ttl
+			o.seen = true
+		}
+		if err := parser.SkipAnswer(); err != nil {
+			return
+		}
+	}
+}
+
+// minTTL returns the lowest TTL seen, if any answer was
+func (o *ttlObserver) minTTL() (time.Duration, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.ttl, o.seen
+}
+
+// observedConn passes every DNS response read to its observer
+type observedConn struct {
+	*net.UDPConn
+	observer *ttlObserver
+}
+
+// Read reads one DNS response
+func (c *observedConn) Read(b []byte) (int, error) {
+	n, err := c.UDPConn.Read(b)
+	if err == nil {
+		c.observer.observe(b[:n])
+	}
+	return n, err
+}
@@ -0,0 +1,139 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// mockServer answers A queries over UDP with 192.0.2.1, or NXDOMAIN for hosts
+// under missing., counting the A queries per host
+type mockServer struct {
+	conn net.PacketConn
+	ttl  uint32
+
+	mu      sync.Mutex
+	queries map[string]int
+}
+
+func newMockServer(t *testing.T, ttl uint32) *mockServer {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	s := &mockServer{conn: conn, ttl: ttl, queries: make(map[string]int)}
+	go s.serve()
+	return s
+}
+
+func (s *mockServer) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		var query dnsmessage.Message
+		if err := query.Unpack(buf[:n]); err != nil || len(query.Questions) != 1 {
+			continue
+		}
+		answer := s.answer(query)
+		reply, err := answer.Pack()
+		if err != nil {
+			continue
+		}
+		s.conn.WriteTo(reply, addr)
+	}
+}
+
+// answer builds the reply to one query
+func (s *mockServer) answer(query dnsmessage.Message) dnsmessage.Message {
+	question := query.Questions[0]
+	reply := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: query.ID, Response: true, Authoritative: true, RecursionAvailable: true},
+		Questions: query.Questions,
+	}
+	name := question.Name.String()
+	if question.Type == dnsmessage.TypeA {
+		s.mu.Lock()
+		s.queries[name]++
+		s.mu.Unlock()
+	}
+	if strings.HasPrefix(name, "missing.") {
+		reply.RCode = dnsmessage.RCodeNameError
+		return reply
+	}
+	if question.Type == dnsmessage.TypeA {
+		reply.Answers = []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: question.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: s.ttl},
+			Body:   &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}},
+		}}
+	}
+	return reply
+}
+
+// count returns the A queries seen for host
+func (s *mockServer) count(host string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queries[host]
+}
+
+func TestResolverCache(t *testing.T) {
+	tests := []struct {
+		name        string
+		host        string
+		recordTTL   uint32 // Seconds
+		ttl         time.Duration
+		negativeTTL time.Duration
+		wait        time.Duration // Between the two lookups
+		wantQueries int
+		wantErr     bool
+	}{
+		{name: "second lookup from the cache", host: "api.example.test.", recordTTL: 300, ttl: time.Minute, wantQueries: 1},
+		{name: "cache TTL expires", host: "api.example.test.", recordTTL: 300, ttl: 50 * time.Millisecond, wait: 100 * time.Millisecond, wantQueries: 2},
+		{name: "shorter record TTL wins", host: "api.example.test.", recordTTL: 0, ttl: time.Minute, wantQueries: 2},
+		{name: "caching disabled", host: "api.example.test.", recordTTL: 300, wantQueries: 2},
+		{name: "NXDOMAIN cached", host: "missing.example.test.", ttl: time.Minute, negativeTTL: time.Minute, wantQueries: 1, wantErr: true},
+		{name: "negative TTL expires", host: "missing.example.test.", ttl: time.Minute, negativeTTL: 50 * time.Millisecond, wait: 100 * time.Millisecond, wantQueries: 2, wantErr: true},
+		{name: "negative caching disabled", host: "missing.example.test.", ttl: time.Minute, wantQueries: 2, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newMockServer(t, tt.recordTTL)
+			resolver := New(tt.ttl, tt.negativeTTL)
+			resolver.server = server.conn.LocalAddr().String()
+
+			for i := 0; i < 2; i++ {
+				if i == 1 {
+					time.Sleep(tt.wait)
+				}
+				addrs, err := resolver.LookupIPAddr(context.Background(), tt.host)
+				if tt.wantErr {
+					var dnsErr *net.DNSError
+					if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+						t.Fatalf("lookup %d error = %v, want not found", i, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("lookup %d: %v", i, err)
+				}
+				if len(addrs) != 1 || !addrs[0].IP.Equal(net.IPv4(192, 0, 2, 1)) {
+					t.Errorf("lookup %d = %v, want [192.0.2.1]", i, addrs)
+				}
+			}
+			if got := server.count(tt.host); got != tt.wantQueries {
+				t.Errorf("DNS server got %d queries, want %d", got, tt.wantQueries)
+			}
+		})
+	}
+}
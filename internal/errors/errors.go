@@ -4,6 +4,7 @@ package errors
 import (
 	"fmt"
 	"net/http"
+	"time"
 )
 
 // ErrorCode represents different types of errors
@@ -35,6 +36,10 @@ const (
 	// Server errors
 	ErrServerInternal ErrorCode = iota + 5000
 	ErrServerUnavailable
+	ErrRateLimited
+	ErrQuotaExceeded
+	ErrIPNotAllowed
+	ErrRequestTooLarge
 )
 
 // AppError represents a custom application error
@@ -59,6 +64,22 @@ func (e *AppError) Unwrap() error {
 	return e.Cause
 }
 
+// RetryAfterError wraps an error that clears on its own after RetryAfter
+type RetryAfterError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+// Error implements the error interface
+func (e *RetryAfterError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
 // NewAppError creates a new application error
 func NewAppError(code ErrorCode, message string) *AppError {
 	return &AppError{
@@ -106,6 +127,61 @@ func getHTTPStatusForCode(code ErrorCode) int {
 	}
 }
 
+// ErrorTypeForCode returns the OpenAI-style error type for an error code,
+// falling back to the HTTP status for codes that do not imply one
+func ErrorTypeForCode(code ErrorCode, status int) string {
+	switch code {
+	case ErrAuthInvalid, ErrAuthMissing, ErrAuthExpired:
+		return "authentication_error"
+	case ErrIPNotAllowed:
+		return "permission_error"
+	case ErrRateLimited, ErrQuotaExceeded:
+		return "rate_limit_exceeded"
+	case ErrRequestTooLarge:
+		return "request_too_large"
+	case ErrConfigInvalid, ErrConfigMissing, ErrConfigValidation:
+		// A rejected configuration change is the caller's mistake, a broken running one is ours
+		if status < http.StatusInternalServerError {
+			return "invalid_request_error"
+		}
+		return "internal_server_error"
+	}
+	return ErrorTypeForStatus(status)
+}
+
+// ErrorTypeForStatus returns the OpenAI-style error type for an HTTP status code
+func ErrorTypeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "invalid_request_error"
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusRequestEntityTooLarge:
+		return "request_too_large"
+	case http.StatusTooManyRequests:
+		return "rate_limit_exceeded"
+	case http.StatusBadGateway:
+		return "bad_gateway"
+	case http.StatusServiceUnavailable:
+		return "service_unavailable"
+	case http.StatusGatewayTimeout:
+		return "gateway_timeout"
+	}
+
+	switch {
+	case status >= 500:
+		return "internal_server_error"
+	case status >= 400:
+		return "invalid_request_error"
+	default:
+		return ""
+	}
+}
+
 // IsRetryable determines if an error is retryable
 func IsRetryable(err error) bool {
 	if appErr, ok := err.(*AppError); ok {
@@ -123,6 +199,9 @@ func IsRetryable(err error) bool {
 var (
 	ErrNoAPIKeysAvailable     = NewAppError(ErrNoKeysAvailable, "No API keys available")
 	ErrAllAPIKeysBlacklisted  = NewAppError(ErrAllKeysBlacklisted, "All API keys are blacklisted")
+	ErrAllAPIKeysCoolingDown  = NewAppError(ErrNoKeysAvailable, "All available API keys are cooling down")
+	ErrAllAPIKeysBusy         = NewAppError(ErrNoKeysAvailable, "All available API keys are at their concurrency limit")
+	ErrAllAPIKeysRateLimited  = NewAppError(ErrNoKeysAvailable, "All available API keys are at their rate limit")
 	ErrInvalidConfiguration   = NewAppError(ErrConfigInvalid, "Invalid configuration")
 	ErrAuthenticationRequired = NewAppError(ErrAuthMissing, "Authentication required")
 	ErrInvalidAuthToken       = NewAppError(ErrAuthInvalid, "Invalid authentication token")
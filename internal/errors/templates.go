@@ -0,0 +1,115 @@
+package errors
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"text/template"
+)
+
+// Template names accepted in ERROR_TEMPLATES_FILE
+const (
+	TemplateRateLimit        = "rate_limit"
+	TemplateAuthFailed       = "auth_failed"
+	TemplateAllUpstreamsDown = "all_upstreams_down"
+	TemplateTimeout          = "timeout"
+)
+
+var (
+	templates      map[string]*template.Template
+	templatesMutex sync.RWMutex
+)
+
+// ErrTemplateNotFound is returned when no template is configured for an error code
+var ErrTemplateNotFound = fmt.Errorf("no error template configured")
+
+// ParseTemplateFile reads and compiles the error templates defined in a JSON file
+func ParseTemplateFile(path string) (map[string]*template.Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var definitions map[string]string
+	if err := json.Unmarshal(data, &definitions); err != nil {
+		return nil, fmt.Errorf("invalid error templates file: %w", err)
+	}
+
+	parsed := make(map[string]*template.Template, len(definitions))
+	for name, text := range definitions {
+		switch name {
+		case TemplateRateLimit, TemplateAuthFailed, TemplateAllUpstreamsDown, TemplateTimeout:
+		default:
+			return nil, fmt.Errorf("unknown error template %q", name)
+		}
+
+		tmpl, err := template.New(name).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid error template %q: %w", name, err)
+		}
+		parsed[name] = tmpl
+	}
+	return parsed, nil
+}
+
+// LoadTemplates compiles the templates in path and installs them
+func LoadTemplates(path string) error {
+	parsed, err := ParseTemplateFile(path)
+	if err != nil {
+		return err
+	}
+
+	templatesMutex.Lock()
+	templates = parsed
+	templatesMutex.Unlock()
+	return nil
+}
+
+// HasTemplate reports whether a template is configured for an error code
+func HasTemplate(code ErrorCode) bool {
+	return lookupTemplate(code) != nil
+}
+
+// RenderTemplate renders the operator-defined template for an error code
+func RenderTemplate(code ErrorCode, data any) ([]byte, error) {
+	tmpl := lookupTemplate(code)
+	if tmpl == nil {
+		return nil, ErrTemplateNotFound
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// lookupTemplate finds the template associated with an error code
+func lookupTemplate(code ErrorCode) *template.Template {
+	name := templateNameForCode(code)
+	if name == "" {
+		return nil
+	}
+
+	templatesMutex.RLock()
+	defer templatesMutex.RUnlock()
+	return templates[name]
+}
+
+// templateNameForCode maps error codes to template names
+func templateNameForCode(code ErrorCode) string {
+	switch code {
+	case ErrRateLimited, ErrQuotaExceeded, ErrServerUnavailable:
+		return TemplateRateLimit
+	case ErrAuthInvalid, ErrAuthMissing, ErrAuthExpired:
+		return TemplateAuthFailed
+	case ErrProxyRetryExhausted, ErrNoKeysAvailable, ErrAllKeysBlacklisted:
+		return TemplateAllUpstreamsDown
+	case ErrProxyTimeout:
+		return TemplateTimeout
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,90 @@
+package errors
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTemplates writes an error templates file and installs it for the test
+func writeTemplates(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "templates.json")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	t.Cleanup(func() {
+		templatesMutex.Lock()
+		templates = nil
+		templatesMutex.Unlock()
+	})
+	return path
+}
+
+func TestParseTemplateFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		wantErr  string
+	}{
+		{name: "every template", contents: `{"rate_limit":"a","auth_failed":"b","all_upstreams_down":"c","timeout":"d"}`},
+		{name: "unknown name", contents: `{"not_found":"x"}`, wantErr: `unknown error template "not_found"`},
+		{name: "invalid syntax", contents: `{"timeout":"{{.request_id"}`, wantErr: `invalid error template "timeout"`},
+		{name: "invalid json", contents: `{"timeout":`, wantErr: "invalid error templates file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseTemplateFile(writeTemplates(t, tt.contents))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ParseTemplateFile: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseTemplateFile error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	path := writeTemplates(t, `{
+		"rate_limit": "{\"msg\":\"slow down\",\"id\":\"{{.request_id}}\",\"retry\":{{.retry_after}}}",
+		"auth_failed": "{\"msg\":\"denied\",\"id\":\"{{.request_id}}\"}",
+		"all_upstreams_down": "{\"msg\":\"down\"}",
+		"timeout": "{\"msg\":\"timeout\",\"id\":\"{{.request_id}}\"}"
+	}`)
+	if err := LoadTemplates(path); err != nil {
+		t.Fatalf("LoadTemplates: %v", err)
+	}
+	data := map[string]any{"request_id": "req-1", "retry_after": 30}
+
+	tests := []struct {
+		name    string
+		code    ErrorCode
+		want    string
+		wantErr error
+	}{
+		{name: "rate limited", code: ErrRateLimited, want: `{"msg":"slow down","id":"req-1","retry":30}`},
+		{name: "quota exceeded", code: ErrQuotaExceeded, want: `{"msg":"slow down","id":"req-1","retry":30}`},
+		{name: "auth missing", code: ErrAuthMissing, want: `{"msg":"denied","id":"req-1"}`},
+		{name: "auth invalid", code: ErrAuthInvalid, want: `{"msg":"denied","id":"req-1"}`},
+		{name: "retries exhausted", code: ErrProxyRetryExhausted, want: `{"msg":"down"}`},
+		{name: "no keys", code: ErrNoKeysAvailable, want: `{"msg":"down"}`},
+		{name: "timeout", code: ErrProxyTimeout, want: `{"msg":"timeout","id":"req-1"}`},
+		{name: "no template for code", code: ErrConfigInvalid, wantErr: ErrTemplateNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered, err := RenderTemplate(tt.code, data)
+			if err != tt.wantErr {
+				t.Fatalf("RenderTemplate error = %v, want %v", err, tt.wantErr)
+			}
+			if string(rendered) != tt.want {
+				t.Errorf("RenderTemplate = %s, want %s", rendered, tt.want)
+			}
+		})
+	}
+}
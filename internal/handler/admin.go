@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+
+	"gpt-load/internal/apierror"
+	"gpt-load/internal/errors"
+	"gpt-load/internal/middleware"
+	"gpt-load/internal/version"
+	"gpt-load/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// AdminHandler serves the key management and status endpoints of the admin server
+type AdminHandler struct {
+	keyManager   types.KeyManager
+	adminManager types.AdminManager
+	config       types.ConfigManager
+	requests     types.RequestCounter
+	queue        types.RequestQueue
+}
+
+// NewAdminHandler creates a new admin handler instance
+func NewAdminHandler(keyManager types.KeyManager, adminManager types.AdminManager, config types.ConfigManager, requests types.RequestCounter, queue types.RequestQueue) *AdminHandler {
+	return &AdminHandler{
+		keyManager:   keyManager,
+		adminManager: adminManager,
+		config:       config,
+		requests:     requests,
+		queue:        queue,
+	}
+}
+
+// ListKeys handles key listing requests
+func (h *AdminHandler) ListKeys(c *gin.Context) {
+	keys := h.adminManager.ListKeys()
+	c.JSON(http.StatusOK, gin.H{
+		"keys":      keys,
+		"count":     len(keys),
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// KeyStats handles per-key usage statistics requests, answering with one entry per key
+func (h *AdminHandler) KeyStats(c *gin.Context) {
+	c.JSON(http.StatusOK, h.adminManager.KeyUsage())
+}
+
+// BlacklistKey handles requests to force-blacklist the key matching a prefix
+func (h *AdminHandler) BlacklistKey(c *gin.Context) {
+	var request struct {
+		Prefix string `json:"prefix" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		middleware.RespondError(c, apierror.NewInvalidRequestError(0, "Invalid request body, expected {\"prefix\": \"<key prefix>\"}"))
+		return
+	}
+
+	// The prefix must identify exactly one key
+	matches := h.adminManager.FindKeys(request.Prefix)
+	switch {
+	case len(matches) == 0:
+		middleware.RespondError(c, apierror.NewNotFoundError("No key matches the prefix"))
+		return
+	case len(matches) > 1:
+		middleware.RespondError(c, apierror.New(http.StatusConflict, 0, "Prefix matches more than one key").
+			With("matches", matches))
+		return
+	}
+
+	if !h.adminManager.ForceBlacklist(matches[0].ID) {
+		middleware.RespondError(c, apierror.NewNotFoundError("Key no longer exists"))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Key blacklisted",
+		"id":      matches[0].ID,
+		"preview": matches[0].Preview,
+	})
+}
+
+// RecoverKey handles requests to remove a key from the blacklist
+func (h *AdminHandler) RecoverKey(c *gin.Context) {
+	id := c.Param("id")
+	if !h.adminManager.RecoverKey(id) {
+		middleware.RespondError(c, apierror.NewNotFoundError("Key not found or not blacklisted"))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Key recovered",
+		"id":      id,
+	})
+}
+
+// Circuits handles upstream circuit breaker state requests
+func (h *AdminHandler) Circuits(c *gin.Context) {
+	circuits := h.config.GetCircuitStates()
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":   h.config.GetOpenAIConfig().CircuitFailThreshold > 0,
+		"circuits":  circuits,
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// Config handles configuration export requests, as JSON or as YAML when the client
+// accepts application/yaml. Secrets are masked or left out.
+func (h *AdminHandler) Config(c *gin.Context) {
+	sanitized := h.config.GetSanitizedConfig()
+	if !strings.Contains(c.GetHeader("Accept"), "yaml") {
+		c.JSON(http.StatusOK, sanitized)
+		return
+	}
+
+	data, err := configYAML(sanitized)
+	if err != nil {
+		middleware.RespondError(c, apierror.NewServerError(errors.ErrServerInternal, "Failed to render configuration as YAML"))
+		return
+	}
+	c.Data(http.StatusOK, "application/yaml; charset=utf-8", data)
+}
+
+// configYAML renders a configuration as YAML with the same keys as its JSON form,
+// so the output can be used as a CONFIG_FILE
+func configYAML(config any) ([]byte, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]any
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(values)
+}
+
+// Status handles runtime health summary requests
+func (h *AdminHandler) Status(c *gin.Context) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	openaiConfig := h.config.GetOpenAIConfig()
+	keysConfig := h.config.GetKeysConfig()
+
+	c.JSON(http.StatusOK, types.StatusResponse{
+		Version:       version.Version,
+		UptimeSeconds: int64(h.requests.Uptime().Seconds()),
+		Requests:      h.requests.Counts(),
+		QueueDepth:    h.queue.QueueDepth(),
+		Keys:          h.keyManager.GetCapacity(),
+		Upstreams:     h.config.GetUpstreamHealth(),
+		Config: types.StatusConfig{
+			UpstreamType:          openaiConfig.UpstreamType,
+			LoadBalance:           openaiConfig.LoadBalanceStrategy,
+			MaxRetries:            keysConfig.MaxRetries,
+			BlacklistThreshold:    keysConfig.BlacklistThreshold,
+			KeyMaxConcurrent:      keysConfig.KeyMaxConcurrent,
+			MaxConcurrentRequests: h.config.GetPerformanceConfig().MaxConcurrentRequests,
+			AuthEnabled:           h.config.GetAuthConfig().Enabled,
+			CircuitBreaker:        openaiConfig.CircuitFailThreshold > 0,
+			HealthChecks:          openaiConfig.HealthCheckInterval > 0,
+		},
+		Memory: types.StatusMemory{
+			AllocMB: bToMb(m.Alloc),
+			SysMB:   bToMb(m.Sys),
+			NumGC:   m.NumGC,
+		},
+		Goroutines: runtime.NumGoroutine(),
+		Timestamp:  time.Now().UTC(),
+	})
+}
@@ -2,10 +2,17 @@
 package handler
 
 import (
+	"bytes"
 	"net/http"
+	"os"
 	"runtime"
+	"text/template"
 	"time"
 
+	"gpt-load/internal/apierror"
+	"gpt-load/internal/errors"
+	"gpt-load/internal/middleware"
+	"gpt-load/internal/version"
 	"gpt-load/pkg/types"
 
 	"github.com/gin-gonic/gin"
@@ -14,46 +21,80 @@ import (
 
 // Handler contains dependencies for HTTP handlers
 type Handler struct {
-	keyManager types.KeyManager
-	config     types.ConfigManager
+	keyManager     types.KeyManager
+	config         types.ConfigManager
+	healthTemplate *template.Template // Nil unless HEALTH_RESPONSE_TEMPLATE is set
 }
 
 // NewHandler creates a new handler instance
 func NewHandler(keyManager types.KeyManager, config types.ConfigManager) *Handler {
-	return &Handler{
+	h := &Handler{
 		keyManager: keyManager,
 		config:     config,
 	}
+
+	// The template has already been checked by config validation
+	if text := config.GetServerConfig().HealthResponseTemplate; text != "" {
+		h.healthTemplate = template.Must(template.New("health").Parse(text))
+	}
+	return h
 }
 
-// Health handles health check requests
+// Health handles liveness probes, it answers as long as the process serves requests
 func (h *Handler) Health(c *gin.Context) {
-	stats := h.keyManager.GetStats()
+	if h.healthTemplate != nil {
+		h.renderHealthTemplate(c, http.StatusOK, h.keyManager.GetStats())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
 
-	status := "healthy"
-	httpStatus := http.StatusOK
+// Ready handles readiness probes, ready while a key is available and at least one
+// upstream passes its health checks with its circuit closed
+func (h *Handler) Ready(c *gin.Context) {
+	middleware.MarkMonitoring(c)
+
+	if reason := h.notReadyReason(); reason != "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "degraded", "reason": reason})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
 
-	// Check if there are any healthy keys
-	if stats.HealthyKeys == 0 {
-		status = "unhealthy"
-		httpStatus = http.StatusServiceUnavailable
+// notReadyReason explains why requests cannot be served, empty when they can
+func (h *Handler) notReadyReason() string {
+	if h.keyManager.GetStats().HealthyKeys == 0 {
+		return "no API keys available"
+	}
+	for _, upstream := range h.config.GetUpstreamHealth() {
+		if upstream.Healthy {
+			return ""
+		}
 	}
+	return "no healthy upstream"
+}
 
-	// Calculate uptime (this should be tracked from server start time)
-	uptime := "unknown"
+// renderHealthTemplate renders HEALTH_RESPONSE_TEMPLATE, rendered per request so uptime stays accurate
+func (h *Handler) renderHealthTemplate(c *gin.Context, httpStatus int, stats types.Stats) {
+	data := types.HealthTemplateData{
+		Version:         version.Version,
+		ActiveKeys:      stats.HealthyKeys,
+		BlacklistedKeys: stats.BlacklistedKeys,
+	}
+	data.InstanceID, _ = os.Hostname()
 	if startTime, exists := c.Get("serverStartTime"); exists {
 		if st, ok := startTime.(time.Time); ok {
-			uptime = time.Since(st).String()
+			data.UptimeSeconds = int64(time.Since(st).Seconds())
 		}
 	}
 
-	c.JSON(httpStatus, gin.H{
-		"status":       status,
-		"timestamp":    time.Now().UTC().Format(time.RFC3339),
-		"healthy_keys": stats.HealthyKeys,
-		"total_keys":   stats.TotalKeys,
-		"uptime":       uptime,
-	})
+	var body bytes.Buffer
+	if err := h.healthTemplate.Execute(&body, data); err != nil {
+		logrus.Errorf("Failed to render health response template: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error"})
+		return
+	}
+	c.Data(httpStatus, "application/json; charset=utf-8", body.Bytes())
 }
 
 // Stats handles statistics requests
@@ -116,10 +157,7 @@ func (h *Handler) ResetKeys(c *gin.Context) {
 	// Reload keys from file
 	if err := h.keyManager.LoadKeys(); err != nil {
 		logrus.Errorf("Failed to reload keys: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to reload keys",
-			"message": err.Error(),
-		})
+		middleware.RespondError(c, apierror.NewServerError(errors.ErrKeyFileInvalid, "Failed to reload keys: "+err.Error()))
 		return
 	}
 
@@ -137,11 +175,31 @@ func (h *Handler) ResetKeys(c *gin.Context) {
 
 // MethodNotAllowed handles 405 requests
 func (h *Handler) MethodNotAllowed(c *gin.Context) {
-	c.JSON(http.StatusMethodNotAllowed, gin.H{
-		"error":     "Method not allowed",
-		"path":      c.Request.URL.Path,
-		"method":    c.Request.Method,
-		"timestamp": time.Now().UTC().Format(time.RFC3339),
+	middleware.RespondError(c, apierror.New(http.StatusMethodNotAllowed, 0, "Method not allowed").
+		With("path", c.Request.URL.Path).
+		With("method", c.Request.Method).
+		With("timestamp", time.Now().UTC().Format(time.RFC3339)))
+}
+
+// Upstreams handles upstream listing requests, including per-upstream limits
+func (h *Handler) Upstreams(c *gin.Context) {
+	openaiConfig := h.config.GetOpenAIConfig()
+
+	upstreams := make([]gin.H, 0, len(openaiConfig.BaseURLs))
+	for i, baseURL := range openaiConfig.BaseURLs {
+		maxResponseMB := openaiConfig.MaxResponseBodySizeMB
+		if limit, exists := openaiConfig.UpstreamMaxResponseMB[baseURL]; exists {
+			maxResponseMB = limit
+		}
+		upstreams = append(upstreams, gin.H{
+			"url":             baseURL,
+			"weight":          openaiConfig.BaseURLWeights[i],
+			"max_response_mb": maxResponseMB,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"upstreams": upstreams,
 	})
 }
 
@@ -149,9 +207,7 @@ func (h *Handler) MethodNotAllowed(c *gin.Context) {
 func (h *Handler) GetConfig(c *gin.Context) {
 	// Only allow in development mode or with special header
 	if c.GetHeader("X-Debug-Config") != "true" {
-		c.JSON(http.StatusForbidden, gin.H{
-			"error": "Access denied",
-		})
+		middleware.RespondError(c, apierror.New(http.StatusForbidden, 0, "Access denied"))
 		return
 	}
 
@@ -170,7 +226,7 @@ func (h *Handler) GetConfig(c *gin.Context) {
 			"port": serverConfig.Port,
 		},
 		"keys": gin.H{
-			"file_path":           keysConfig.FilePath,
+			"api_keys_count":      len(keysConfig.APIKeys),
 			"start_index":         keysConfig.StartIndex,
 			"blacklist_threshold": keysConfig.BlacklistThreshold,
 			"max_retries":         keysConfig.MaxRetries,
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gpt-load/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// stubKeyManager reports a fixed number of available keys
+type stubKeyManager struct {
+	types.KeyManager
+	healthyKeys int
+}
+
+func (km stubKeyManager) GetStats() types.Stats {
+	return types.Stats{TotalKeys: 2, HealthyKeys: km.healthyKeys, BlacklistedKeys: 2 - km.healthyKeys}
+}
+
+// stubConfig reports fixed upstream health
+type stubConfig struct {
+	types.ConfigManager
+	upstreams []types.UpstreamHealth
+}
+
+func (stubConfig) GetServerConfig() types.ServerConfig { return types.ServerConfig{} }
+
+func (c stubConfig) GetUpstreamHealth() []types.UpstreamHealth { return c.upstreams }
+
+func TestProbes(t *testing.T) {
+	healthy := types.UpstreamHealth{URL: "https://a.example", Healthy: true, Circuit: "CLOSED"}
+	degraded := types.UpstreamHealth{URL: "https://b.example", Degraded: true, Circuit: "CLOSED"}
+	open := types.UpstreamHealth{URL: "https://c.example", Circuit: "OPEN"}
+	tests := []struct {
+		name        string
+		healthyKeys int
+		upstreams   []types.UpstreamHealth
+		wantStatus  int
+		wantBody    string
+	}{
+		{name: "ready", healthyKeys: 2, upstreams: []types.UpstreamHealth{healthy}, wantStatus: http.StatusOK, wantBody: `{"status":"ok"}`},
+		{name: "one upstream left", healthyKeys: 1, upstreams: []types.UpstreamHealth{degraded, open, healthy}, wantStatus: http.StatusOK, wantBody: `{"status":"ok"}`},
+		{name: "all keys blacklisted", healthyKeys: 0, upstreams: []types.UpstreamHealth{healthy}, wantStatus: http.StatusServiceUnavailable, wantBody: `{"reason":"no API keys available","status":"degraded"}`},
+		{name: "upstreams failing health checks", healthyKeys: 2, upstreams: []types.UpstreamHealth{degraded}, wantStatus: http.StatusServiceUnavailable, wantBody: `{"reason":"no healthy upstream","status":"degraded"}`},
+		{name: "every circuit open", healthyKeys: 2, upstreams: []types.UpstreamHealth{open}, wantStatus: http.StatusServiceUnavailable, wantBody: `{"reason":"no healthy upstream","status":"degraded"}`},
+		{name: "keys checked first", healthyKeys: 0, upstreams: []types.UpstreamHealth{degraded, open}, wantStatus: http.StatusServiceUnavailable, wantBody: `{"reason":"no API keys available","status":"degraded"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(stubKeyManager{healthyKeys: tt.healthyKeys}, stubConfig{upstreams: tt.upstreams})
+			router := gin.New()
+			router.GET("/health", h.Health)
+			router.GET("/ready", h.Ready)
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/ready", nil))
+			if recorder.Code != tt.wantStatus || recorder.Body.String() != tt.wantBody {
+				t.Errorf("ready = %d %s, want %d %s", recorder.Code, recorder.Body.String(), tt.wantStatus, tt.wantBody)
+			}
+
+			// Liveness is independent of keys and upstreams
+			recorder = httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health", nil))
+			if recorder.Code != http.StatusOK || recorder.Body.String() != `{"status":"ok"}` {
+				t.Errorf("health = %d %s, want 200 {\"status\":\"ok\"}", recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package keymanager
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gpt-load/pkg/types"
+
+	"github.com/sirupsen/logrus"
+)
+
+var _ types.AdminManager = (*Manager)(nil)
+
+// ListKeys returns the status of every key in the pool
+func (km *Manager) ListKeys() []types.KeyStatus {
+	return km.keyStatuses(func(string) bool { return true })
+}
+
+// FindKeys returns the status of every key starting with prefix
+func (km *Manager) FindKeys(prefix string) []types.KeyStatus {
+	if prefix == "" {
+		return nil
+	}
+	return km.keyStatuses(func(key string) bool { return strings.HasPrefix(key, prefix) })
+}
+
+// ForceBlacklist blacklists the key with the given ID, reporting whether it exists
+func (km *Manager) ForceBlacklist(id string) bool {
+	key, ok := km.keyByID(id)
+	if !ok {
+		return false
+	}
+	km.blacklist(key, "blacklisted via admin API")
+	logrus.Infof("Key %s blacklisted via admin API", id)
+	return true
+}
+
+// RecoverKey removes the key with the given ID from the blacklist, reporting
+// whether it was blacklisted
+func (km *Manager) RecoverKey(id string) bool {
+	key, ok := km.keyByID(id)
+	if !ok {
+		return false
+	}
+	if _, loaded := km.blacklistedKeys.LoadAndDelete(key); !loaded {
+		return false
+	}
+	atomic.AddInt64(&km.blacklistedCount, -1)
+	km.keyFailureCounts.Delete(key)
+	km.persistKey(key)
+	logrus.Infof("Key %s recovered via admin API", id)
+	return true
+}
+
+// keyStatuses builds the status of every key accepted by match
+func (km *Manager) keyStatuses(match func(key string) bool) []types.KeyStatus {
+	km.keysMutex.RLock()
+	defer km.keysMutex.RUnlock()
+
+	statuses := []types.KeyStatus{}
+	for i, key := range km.keys {
+		if !match(key) {
+			continue
+		}
+
+		status := types.KeyStatus{
+			ID:      keyID(key),
+			Preview: km.keyPreviews[i],
+			Status:  "active",
+		}
+		if count, exists := km.keyFailureCounts.Load(key); exists {
+			status.FailCount = int(atomic.LoadInt64(count.(*int64)))
+		}
+		if value, blacklisted := km.blacklistedKeys.Load(key); blacklisted {
+			blacklistedAt := value.(time.Time)
+			status.Status = "blacklisted"
+			status.BlacklistedAt = &blacklistedAt
+		} else if km.isCoolingDown(i) {
+			status.Status = "cooling_down"
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// keyByID looks up a key in the pool by its ID
+func (km *Manager) keyByID(id string) (string, bool) {
+	km.keysMutex.RLock()
+	defer km.keysMutex.RUnlock()
+
+	for _, key := range km.keys {
+		if keyID(key) == id {
+			return key, true
+		}
+	}
+	return "", false
+}
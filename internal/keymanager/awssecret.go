@@ -0,0 +1,101 @@
+package keymanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"gpt-load/internal/errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/sirupsen/logrus"
+)
+
+// awsSecretTimeout bounds reading the secret, including credential lookup retries
+const awsSecretTimeout = 30 * time.Second
+
+// secretsManagerClient is the part of the Secrets Manager API used to load keys,
+// satisfied by *secretsmanager.Client
+type secretsManagerClient interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// awsSecretSource loads the key pool from an AWS Secrets Manager secret holding
+// a JSON array of keys or one key per line
+type awsSecretSource struct {
+	secretARN string
+	client    secretsManagerClient
+}
+
+// newAWSSecretSource creates a Secrets Manager client from the default credential
+// chain (environment, shared config, IRSA web identity, instance role)
+func newAWSSecretSource(ctx context.Context, secretARN, region string) (*awsSecretSource, error) {
+	var options []func(*awsconfig.LoadOptions) error
+	if region != "" {
+		options = append(options, awsconfig.WithRegion(region))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &awsSecretSource{
+		secretARN: secretARN,
+		client:    secretsmanager.NewFromConfig(cfg),
+	}, nil
+}
+
+// reloadAWSSecretKeys replaces the key pool with the keys stored in KEY_AWS_SECRET_ARN.
+// The old pool stays in place if the secret cannot be read or holds no keys.
+func (km *Manager) reloadAWSSecretKeys(ctx context.Context) error {
+	rawKeys, err := km.awsSecret.fetch(ctx)
+	if err != nil {
+		return errors.NewAppErrorWithDetails(errors.ErrNoKeysAvailable, "Failed to read API keys from AWS Secrets Manager", err.Error())
+	}
+
+	keys, keyPreviews, err := km.buildKeys(rawKeys)
+	if err != nil {
+		return errors.NewAppErrorWithDetails(errors.ErrNoKeysAvailable, "No valid API keys found in AWS secret", km.awsSecret.secretARN)
+	}
+
+	km.swapKeys(keys, keyPreviews)
+
+	logrus.Infof("Successfully loaded %d API keys from AWS Secrets Manager", len(keys))
+	return nil
+}
+
+// fetch reads the secret and splits it into raw keys
+func (s *awsSecretSource) fetch(ctx context.Context) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, awsSecretTimeout)
+	defer cancel()
+
+	output, err := s.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(s.secretARN),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	value := aws.ToString(output.SecretString)
+	if output.SecretString == nil {
+		value = string(output.SecretBinary)
+	}
+	return parseSecretKeys(value)
+}
+
+// parseSecretKeys parses a secret holding a JSON array of keys or one key per line
+func parseSecretKeys(value string) ([]string, error) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "[") {
+		return strings.Split(value, "\n"), nil
+	}
+
+	var keys []string
+	if err := json.Unmarshal([]byte(value), &keys); err != nil {
+		return nil, fmt.Errorf("expected a JSON array of keys: %w", err)
+	}
+	return keys, nil
+}
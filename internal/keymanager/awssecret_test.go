@@ -0,0 +1,105 @@
+package keymanager
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"gpt-load/pkg/types"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// fakeSecretsManager serves one secret value, or fails with err
+type fakeSecretsManager struct {
+	output *secretsmanager.GetSecretValueOutput
+	err    error
+
+	requested string // SecretId of the last request
+}
+
+func (f *fakeSecretsManager) GetSecretValue(_ context.Context, params *secretsmanager.GetSecretValueInput, _ ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	f.requested = aws.ToString(params.SecretId)
+	return f.output, f.err
+}
+
+func TestAWSSecretKeys(t *testing.T) {
+	const arn = "arn:aws:secretsmanager:us-east-1:123456789012:secret:gpt-load-keys"
+	tests := []struct {
+		name     string
+		client   *fakeSecretsManager
+		config   types.KeysConfig
+		keyFile  []string // Lines of KEY_FILE_PATH, unset when nil
+		wantPool []string
+		wantErr  bool
+	}{
+		{
+			name:     "JSON array",
+			client:   &fakeSecretsManager{output: &secretsmanager.GetSecretValueOutput{SecretString: aws.String(`["sk-aws-a1", "sk-aws-b2"]`)}},
+			wantPool: []string{"sk-aws-a1", "sk-aws-b2"},
+		},
+		{
+			name:     "one key per line",
+			client:   &fakeSecretsManager{output: &secretsmanager.GetSecretValueOutput{SecretString: aws.String("sk-aws-a1\r\n\nsk-aws-b2\n")}},
+			wantPool: []string{"sk-aws-a1", "sk-aws-b2"},
+		},
+		{
+			name:     "binary secret",
+			client:   &fakeSecretsManager{output: &secretsmanager.GetSecretValueOutput{SecretBinary: []byte(`["sk-aws-c3"]`)}},
+			wantPool: []string{"sk-aws-c3"},
+		},
+		{
+			name:     "fetch fails with API_KEYS fallback",
+			client:   &fakeSecretsManager{err: errors.New("AccessDeniedException")},
+			config:   types.KeysConfig{APIKeys: []string{"sk-env-0001"}},
+			wantPool: []string{"sk-env-0001"},
+		},
+		{
+			name:     "empty secret with API_KEYS fallback",
+			client:   &fakeSecretsManager{output: &secretsmanager.GetSecretValueOutput{SecretString: aws.String("[]")}},
+			config:   types.KeysConfig{APIKeys: []string{"sk-env-0001"}},
+			wantPool: []string{"sk-env-0001"},
+		},
+		{
+			name:     "fetch fails with key file fallback",
+			client:   &fakeSecretsManager{err: errors.New("AccessDeniedException")},
+			config:   types.KeysConfig{APIKeys: []string{"sk-env-0001"}},
+			keyFile:  []string{"sk-file-0001", "sk-file-0002"},
+			wantPool: []string{"sk-file-0001", "sk-file-0002"},
+		},
+		{
+			name:     "secret replaces the key file",
+			client:   &fakeSecretsManager{output: &secretsmanager.GetSecretValueOutput{SecretString: aws.String(`["sk-aws-a1"]`)}},
+			keyFile:  []string{"sk-file-0001"},
+			wantPool: []string{"sk-aws-a1"},
+		},
+		{name: "fetch fails without fallback", client: &fakeSecretsManager{err: errors.New("AccessDeniedException")}, wantErr: true},
+		{
+			name:    "malformed JSON without fallback",
+			client:  &fakeSecretsManager{output: &secretsmanager.GetSecretValueOutput{SecretString: aws.String(`["sk-aws-a1",`)}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			config.MaxKeyCount = 100
+			km := &Manager{config: config, awsSecret: &awsSecretSource{secretARN: arn, client: tt.client}}
+			if tt.keyFile != nil {
+				km.keysFilePath = writeKeyFile(t, tt.keyFile)
+			}
+			err := km.LoadKeys()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadKeys error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.client.requested != arn {
+				t.Errorf("requested secret %q, want %q", tt.client.requested, arn)
+			}
+			if got := poolKeys(km); !tt.wantErr && !reflect.DeepEqual(got, tt.wantPool) {
+				t.Errorf("pool = %v, want %v", got, tt.wantPool)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package keymanager
+
+import "sync/atomic"
+
+// newInFlightCounters allocates one in-flight counter per key. Counters are
+// pointers so reordering the pool moves them without losing pending releases.
+func newInFlightCounters(n int) []*atomic.Int64 {
+	counters := make([]*atomic.Int64, n)
+	for i := range counters {
+		counters[i] = new(atomic.Int64)
+	}
+	return counters
+}
+
+// releaseNothing is the release function of keys without a concurrency cap
+func releaseNothing() {}
+
+// acquireKey takes one of a key's KEY_MAX_CONCURRENT slots, returning false when
+// the key is at capacity. Must be called with keysMutex held.
+func (km *Manager) acquireKey(keyIndex int) (func(), bool) {
+	limit := int64(km.config.KeyMaxConcurrent)
+	if limit <= 0 {
+		return releaseNothing, true
+	}
+
+	// Release against the same counters even if a reload replaces them meanwhile
+	inFlight := km.inFlight[keyIndex]
+	for {
+		current := inFlight.Load()
+		if current >= limit {
+			return nil, false
+		}
+		if inFlight.CompareAndSwap(current, current+1) {
+			break
+		}
+	}
+
+	var released atomic.Bool
+	return func() {
+		if released.CompareAndSwap(false, true) {
+			inFlight.Add(-1)
+		}
+	}, true
+}
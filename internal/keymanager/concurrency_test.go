@@ -0,0 +1,127 @@
+package keymanager
+
+import (
+	stderrors "errors"
+	"runtime"
+	"sync"
+	"testing"
+
+	"gpt-load/internal/errors"
+	"gpt-load/pkg/types"
+)
+
+func TestKeyMaxConcurrent(t *testing.T) {
+	tests := []struct {
+		name      string
+		limit     int
+		keys      int
+		wantSlots int // Keys handed out before the pool is saturated, -1 when never saturated
+	}{
+		{name: "one slot per key", limit: 1, keys: 2, wantSlots: 2},
+		{name: "three slots per key", limit: 3, keys: 2, wantSlots: 6},
+		{name: "unlimited", limit: 0, keys: 2, wantSlots: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			km := newTestManager(t, types.KeysConfig{KeyMaxConcurrent: tt.limit}, testKeys(tt.keys)...)
+			var held []*types.KeyInfo
+			perKey := map[string]int{}
+			for i := 0; i < 20; i++ {
+				keyInfo, err := km.GetNextKey()
+				if err != nil {
+					if !stderrors.Is(err, errors.ErrAllAPIKeysBusy) {
+						t.Fatalf("GetNextKey: %v, want ErrAllAPIKeysBusy", err)
+					}
+					break
+				}
+				held = append(held, keyInfo)
+				perKey[keyInfo.Key]++
+			}
+			if tt.wantSlots < 0 {
+				if len(held) != 20 {
+					t.Fatalf("pool saturated after %d keys without a limit", len(held))
+				}
+				return
+			}
+			if len(held) != tt.wantSlots {
+				t.Fatalf("handed out %d keys before saturating, want %d", len(held), tt.wantSlots)
+			}
+			for key, n := range perKey {
+				if n != tt.limit {
+					t.Errorf("key %s handed out %d times, want %d", key, n, tt.limit)
+				}
+			}
+
+			// Releasing twice frees a single slot, which the next request gets
+			released := held[0]
+			released.Release()
+			released.Release()
+			keyInfo, err := km.GetNextKey()
+			if err != nil {
+				t.Fatalf("GetNextKey after a release: %v", err)
+			}
+			if keyInfo.Key != released.Key {
+				t.Errorf("got key %s, want the released %s", keyInfo.Key, released.Key)
+			}
+			if _, err := km.GetNextKey(); !stderrors.Is(err, errors.ErrAllAPIKeysBusy) {
+				t.Errorf("GetNextKey = %v, want ErrAllAPIKeysBusy after the freed slot was taken", err)
+			}
+		})
+	}
+}
+
+func TestKeyMaxConcurrentAcrossReload(t *testing.T) {
+	km := newTestManager(t, types.KeysConfig{KeyMaxConcurrent: 1}, "sk-test-0000")
+	old, err := km.GetNextKey()
+	if err != nil {
+		t.Fatalf("GetNextKey: %v", err)
+	}
+
+	// The reloaded pool starts with free slots, a late release must not free one of them
+	built, previews, err := km.buildKeys([]string{"sk-test-0001"})
+	if err != nil {
+		t.Fatalf("buildKeys: %v", err)
+	}
+	km.swapKeys(built, previews)
+	current, err := km.GetNextKey()
+	if err != nil {
+		t.Fatalf("GetNextKey after reload: %v", err)
+	}
+	old.Release()
+	if _, err := km.GetNextKey(); !stderrors.Is(err, errors.ErrAllAPIKeysBusy) {
+		t.Errorf("GetNextKey = %v, want ErrAllAPIKeysBusy while %s is held", err, current.Key)
+	}
+}
+
+func TestKeyMaxConcurrentNeverExceeded(t *testing.T) {
+	const limit, workers = 2, 16
+	km := newTestManager(t, types.KeysConfig{KeyMaxConcurrent: limit}, testKeys(3)...)
+	var mu sync.Mutex
+	inFlight := map[string]int{}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				keyInfo, err := km.GetNextKey()
+				if err != nil {
+					continue
+				}
+				mu.Lock()
+				inFlight[keyInfo.Key]++
+				if n := inFlight[keyInfo.Key]; n > limit {
+					t.Errorf("key %s has %d requests in flight, limit %d", keyInfo.Key, n, limit)
+				}
+				mu.Unlock()
+				runtime.Gosched()
+
+				mu.Lock()
+				inFlight[keyInfo.Key]--
+				mu.Unlock()
+				keyInfo.Release()
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,196 @@
+package keymanager
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"gpt-load/internal/errors"
+	"gpt-load/pkg/types"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// coordinationKeyPrefix namespaces the per-instance key pool snapshots in the store
+const coordinationKeyPrefix = "gptload:keypool:"
+
+// keyState is one instance's view of a single key, keyed by hashed key ID
+type keyState struct {
+	Failures    int64 `json:"failures"`
+	Blacklisted bool  `json:"blacklisted"`
+}
+
+// coordinator shares key pool state with other instances through Redis.
+// Snapshots are merged as a max-register CRDT: the highest error count for a
+// key across instances wins, and the local instance makes its own blacklist
+// decisions from the merged counts.
+type coordinator struct {
+	km         *Manager
+	client     *redis.Client
+	instanceID string
+	ttl        time.Duration
+}
+
+// setupCoordination connects to the coordination store and registers the sync task
+func (km *Manager) setupCoordination(config types.KeysConfig, scheduler types.Scheduler) error {
+	options, err := redis.ParseURL(config.CoordinationStoreURL)
+	if err != nil {
+		return errors.NewAppErrorWithCause(errors.ErrConfigInvalid, "Invalid coordination store URL", err)
+	}
+
+	hostname, _ := os.Hostname()
+	interval := time.Duration(config.CoordinationSyncInterval) * time.Second
+	c := &coordinator{
+		km:         km,
+		client:     redis.NewClient(options),
+		instanceID: fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		// Snapshots of instances that stopped publishing expire on their own
+		ttl: 3 * interval,
+	}
+	km.coordinator = c
+
+	return scheduler.AddTask("key-coordination-sync", interval, func(ctx context.Context) {
+		if err := c.sync(ctx); err != nil {
+			logrus.Warnf("Key pool coordination sync failed: %v", err)
+		}
+	})
+}
+
+// sync publishes the local snapshot and merges the snapshots of all other instances
+func (c *coordinator) sync(ctx context.Context) error {
+	local := c.km.snapshot()
+	payload, err := json.Marshal(local)
+	if err != nil {
+		return err
+	}
+	if err := c.client.Set(ctx, coordinationKeyPrefix+c.instanceID, payload, c.ttl).Err(); err != nil {
+		return err
+	}
+
+	remote := make(map[string]keyState)
+	iter := c.client.Scan(ctx, 0, coordinationKeyPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		if iter.Val() == coordinationKeyPrefix+c.instanceID {
+			continue
+		}
+		data, err := c.client.Get(ctx, iter.Val()).Bytes()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		var instance map[string]keyState
+		if err := json.Unmarshal(data, &instance); err != nil {
+			logrus.Debugf("Skipping unreadable key pool snapshot %s: %v", iter.Val(), err)
+			continue
+		}
+		for keyID, state := range instance {
+			merged := remote[keyID]
+			merged.Failures = max(merged.Failures, state.Failures)
+			merged.Blacklisted = merged.Blacklisted || state.Blacklisted
+			remote[keyID] = merged
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+
+	c.km.mergeRemoteState(remote)
+	return nil
+}
+
+// close releases the store connection
+func (c *coordinator) close() {
+	if err := c.client.Close(); err != nil {
+		logrus.Debugf("Failed to close coordination store client: %v", err)
+	}
+}
+
+// keyID identifies a key in shared state and admin APIs without revealing it
+func keyID(key string) string {
+	digest := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(digest[:8])
+}
+
+// snapshot returns the local error count and blacklist state of every key with either
+func (km *Manager) snapshot() map[string]keyState {
+	states := make(map[string]keyState)
+	km.keyFailureCounts.Range(func(key, value any) bool {
+		if counter, ok := value.(*int64); ok {
+			states[keyID(key.(string))] = keyState{Failures: atomic.LoadInt64(counter)}
+		}
+		return true
+	})
+	km.blacklistedKeys.Range(func(key, value any) bool {
+		id := keyID(key.(string))
+		state := states[id]
+		state.Blacklisted = true
+		states[id] = state
+		return true
+	})
+	return states
+}
+
+// mergeRemoteState raises local error counts to the highest count seen by any
+// instance and blacklists keys whose merged count reaches the local threshold.
+// A key blacklisted elsewhere counts as having reached the threshold.
+func (km *Manager) mergeRemoteState(remote map[string]keyState) {
+	if len(remote) == 0 {
+		return
+	}
+
+	km.keysMutex.RLock()
+	keys := km.keys
+	km.keysMutex.RUnlock()
+
+	threshold := int64(km.config.BlacklistThreshold)
+	merged := 0
+	for _, key := range keys {
+		state, exists := remote[keyID(key)]
+		if !exists {
+			continue
+		}
+		if _, blacklisted := km.blacklistedKeys.Load(key); blacklisted {
+			continue
+		}
+
+		failures := state.Failures
+		if state.Blacklisted {
+			failures = max(failures, threshold)
+		}
+		if failures == 0 {
+			continue
+		}
+
+		value, _ := km.keyFailureCounts.LoadOrStore(key, new(int64))
+		counter, ok := value.(*int64)
+		if !ok {
+			continue
+		}
+		for {
+			current := atomic.LoadInt64(counter)
+			if current >= failures || atomic.CompareAndSwapInt64(counter, current, failures) {
+				break
+			}
+		}
+
+		if atomic.LoadInt64(counter) >= threshold {
+			km.blacklist(key, "blacklisted based on state shared by other instances")
+			merged++
+		} else {
+			km.persistKey(key)
+		}
+	}
+
+	if merged > 0 {
+		logrus.Infof("Blacklisted %d keys based on state shared by other instances", merged)
+	}
+}
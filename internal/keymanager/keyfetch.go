@@ -0,0 +1,91 @@
+package keymanager
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gpt-load/internal/errors"
+	"gpt-load/pkg/types"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxKeyFetchResponseBytes bounds the key list read from KEY_FETCH_URL
+const maxKeyFetchResponseBytes = 10 << 20
+
+// keyFetcher loads the key pool from an HTTP endpoint returning a JSON array of keys
+type keyFetcher struct {
+	url        string
+	authHeader string
+	httpClient *http.Client
+}
+
+// setupKeyFetch registers the task refreshing the key pool from KEY_FETCH_URL.
+// Keys are fetched once by LoadKeys before this is called.
+func (km *Manager) setupKeyFetch(config types.KeysConfig, scheduler types.Scheduler) error {
+	interval := time.Duration(config.KeyFetchIntervalSeconds) * time.Second
+	return scheduler.AddTask("key-fetch-refresh", interval, func(ctx context.Context) {
+		if err := km.reloadFetchedKeys(ctx); err != nil {
+			logrus.Errorf("Failed to refresh API keys, keeping current key pool: %v", err)
+		}
+	})
+}
+
+// reloadFetchedKeys replaces the key pool with the keys served by KEY_FETCH_URL.
+// The old pool stays in place if the fetch fails or returns no keys.
+func (km *Manager) reloadFetchedKeys(ctx context.Context) error {
+	rawKeys, err := km.fetcher.fetch(ctx)
+	if err != nil {
+		return errors.NewAppErrorWithDetails(errors.ErrNoKeysAvailable, "Failed to fetch API keys", err.Error())
+	}
+
+	keys, keyPreviews, err := km.buildKeys(rawKeys)
+	if err != nil {
+		return errors.NewAppError(errors.ErrNoKeysAvailable, "No valid API keys returned by key fetch URL")
+	}
+
+	km.swapKeys(keys, keyPreviews)
+
+	logrus.Infof("Successfully loaded %d API keys from key fetch URL", len(keys))
+	return nil
+}
+
+// fetch requests the key list, sending the configured "Name: value" auth header
+func (f *keyFetcher) fetch(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if name, value, found := strings.Cut(f.authHeader, ":"); found {
+		req.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		// Leave the URL out of the error, it may carry credentials
+		var urlErr *url.Error
+		if stderrors.As(err, &urlErr) {
+			return nil, urlErr.Err
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("key fetch URL returned HTTP %d", resp.StatusCode)
+	}
+
+	var keys []string
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxKeyFetchResponseBytes)).Decode(&keys); err != nil {
+		return nil, fmt.Errorf("expected a JSON array of keys: %w", err)
+	}
+	return keys, nil
+}
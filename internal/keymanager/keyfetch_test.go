@@ -0,0 +1,144 @@
+package keymanager
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gpt-load/pkg/types"
+)
+
+// taskRecorder is a scheduler that keeps the tasks added to it so tests can run them
+type taskRecorder struct {
+	tasks     map[string]func(context.Context)
+	intervals map[string]time.Duration
+}
+
+func newTaskRecorder() *taskRecorder {
+	return &taskRecorder{tasks: map[string]func(context.Context){}, intervals: map[string]time.Duration{}}
+}
+
+func (s *taskRecorder) AddTask(name string, interval time.Duration, fn func(context.Context)) error {
+	s.tasks[name] = fn
+	s.intervals[name] = interval
+	return nil
+}
+
+func (s *taskRecorder) Start(context.Context) {}
+
+func (s *taskRecorder) Stop() {}
+
+// poolKeys returns the keys currently in the pool
+func poolKeys(km *Manager) []string {
+	km.keysMutex.RLock()
+	defer km.keysMutex.RUnlock()
+	return append([]string(nil), km.keys...)
+}
+
+func TestKeyFetchRotation(t *testing.T) {
+	// The server answers every fetch with the current response, and counts
+	// fetches missing the auth header
+	var response atomic.Value
+	var unauthorized atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer fetch-token" {
+			unauthorized.Add(1)
+		}
+		current := response.Load().([2]string)
+		if current[0] != "" {
+			http.Error(w, current[0], http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, current[1])
+	}))
+	t.Cleanup(server.Close)
+
+	config := types.KeysConfig{
+		KeyFetchURL:             server.URL + "/keys",
+		KeyFetchIntervalSeconds: 60,
+		KeyFetchAuthHeader:      "Authorization: Bearer fetch-token",
+		MaxKeyCount:             3,
+		BlacklistThreshold:      1,
+	}
+	km := &Manager{config: config, fetcher: &keyFetcher{url: config.KeyFetchURL, authHeader: config.KeyFetchAuthHeader, httpClient: server.Client()}}
+	response.Store([2]string{"", `["sk-fetch-a1", "sk-fetch-b2"]`})
+	if err := km.LoadKeys(); err != nil {
+		t.Fatalf("LoadKeys: %v", err)
+	}
+	if got := poolKeys(km); !reflect.DeepEqual(got, []string{"sk-fetch-a1", "sk-fetch-b2"}) {
+		t.Fatalf("startup pool = %v", got)
+	}
+
+	scheduler := newTaskRecorder()
+	if err := km.setupKeyFetch(config, scheduler); err != nil {
+		t.Fatalf("setupKeyFetch: %v", err)
+	}
+	refresh := scheduler.tasks["key-fetch-refresh"]
+	if refresh == nil || scheduler.intervals["key-fetch-refresh"] != time.Minute {
+		t.Fatalf("refresh task %v every %v, want one every minute", refresh != nil, scheduler.intervals["key-fetch-refresh"])
+	}
+
+	// Each step changes the response and runs one refresh, the pool carries over to the next step
+	tests := []struct {
+		name     string
+		status   string // Error served instead of the body when set
+		body     string
+		wantPool []string
+	}{
+		{name: "rotated", body: `["sk-fetch-c3"]`, wantPool: []string{"sk-fetch-c3"}},
+		{name: "blank entries trimmed", body: `[" sk-fetch-d4 ", "", "sk-fetch-e5"]`, wantPool: []string{"sk-fetch-d4", "sk-fetch-e5"}},
+		{name: "server error keeps pool", status: "unavailable", wantPool: []string{"sk-fetch-d4", "sk-fetch-e5"}},
+		{name: "invalid JSON keeps pool", body: `{"keys":["sk-fetch-f6"]}`, wantPool: []string{"sk-fetch-d4", "sk-fetch-e5"}},
+		{name: "empty list keeps pool", body: `[]`, wantPool: []string{"sk-fetch-d4", "sk-fetch-e5"}},
+		{name: "recovered after errors", body: `["sk-fetch-g7"]`, wantPool: []string{"sk-fetch-g7"}},
+		{name: "MAX_KEY_COUNT applied", body: `["sk-fetch-1", "sk-fetch-2", "sk-fetch-3", "sk-fetch-4"]`, wantPool: []string{"sk-fetch-1", "sk-fetch-2", "sk-fetch-3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response.Store([2]string{tt.status, tt.body})
+			refresh(context.Background())
+			if got := poolKeys(km); !reflect.DeepEqual(got, tt.wantPool) {
+				t.Errorf("pool = %v, want %v", got, tt.wantPool)
+			}
+		})
+	}
+	if n := unauthorized.Load(); n != 0 {
+		t.Errorf("%d fetches were sent without the auth header", n)
+	}
+}
+
+func TestKeyFetchStartupError(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{name: "server error", handler: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) }},
+		{name: "not an array", handler: func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, `"sk-fetch-a1"`) }},
+		{name: "no keys", handler: func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, `["", " "]`) }},
+		{name: "connection dropped", handler: func(w http.ResponseWriter, r *http.Request) { panic(http.ErrAbortHandler) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			t.Cleanup(server.Close)
+			km := &Manager{
+				config:  types.KeysConfig{MaxKeyCount: 10},
+				fetcher: &keyFetcher{url: server.URL + "/keys?token=secret", httpClient: server.Client()},
+			}
+			err := km.LoadKeys()
+			if err == nil {
+				t.Fatalf("LoadKeys succeeded with pool %v, want an error", poolKeys(km))
+			}
+			// The URL may carry credentials and must stay out of errors
+			if strings.Contains(err.Error(), "secret") {
+				t.Errorf("error %q contains the key fetch URL", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package keymanager
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"gpt-load/internal/errors"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxKeyLineBytes is the longest line accepted in a key file
+const maxKeyLineBytes = 1 << 20
+
+// readKeyFile reads one key per line, skipping blank lines and # comments. It stops
+// after maxKeys keys, so a file that is far too large is not read to the end.
+func readKeyFile(path string, maxKeys int) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.NewAppErrorWithDetails(errors.ErrKeyFileNotFound, "Key file not found", path)
+		}
+		return nil, errors.NewAppErrorWithCause(errors.ErrKeyFileInvalid, "Failed to open key file", err)
+	}
+	defer file.Close()
+
+	var keys []string
+	discarded := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxKeyLineBytes)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// Keys past the limit are only counted, so the warning can say how many were lost
+		if len(keys) >= maxKeys {
+			discarded++
+			continue
+		}
+		keys = append(keys, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.NewAppErrorWithCause(errors.ErrKeyFileInvalid, "Failed to read key file", err)
+	}
+	if discarded > 0 {
+		logrus.Warnf("Key file %s has more than MAX_KEY_COUNT (%d) keys, discarded %d", path, maxKeys, discarded)
+	}
+	return keys, nil
+}
@@ -0,0 +1,142 @@
+package keymanager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"gpt-load/internal/redact"
+	"gpt-load/pkg/types"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+// writeKeyFile writes lines to a key file in a temporary directory
+func writeKeyFile(t *testing.T, lines []string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keys.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+func TestReadKeyFile(t *testing.T) {
+	longKey := "sk-" + strings.Repeat("x", 100*1024)
+	tests := []struct {
+		name          string
+		lines         []string
+		maxKeys       int
+		want          int
+		wantDiscarded int // Keys the warning reports as dropped, 0 for no warning
+	}{
+		{name: "stops at the limit", lines: testKeys(100), maxKeys: 10, want: 10, wantDiscarded: 90},
+		{name: "exactly the limit", lines: testKeys(10), maxKeys: 10, want: 10},
+		{name: "under the limit", lines: testKeys(5), maxKeys: 10, want: 5},
+		{name: "comments and blank lines skipped", lines: []string{"# pool", "", "sk-a", "  ", "#sk-b", "sk-c"}, maxKeys: 10, want: 2},
+		{name: "comments past the limit not counted", lines: []string{"sk-a", "sk-b", "# spare", "", "sk-c", "  ", "sk-d"}, maxKeys: 2, want: 2, wantDiscarded: 2},
+		{name: "line over 64KB", lines: []string{longKey, "sk-a"}, maxKeys: 10, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := &test.Hook{}
+			previousHooks := logrus.StandardLogger().ReplaceHooks(logrus.LevelHooks{})
+			logrus.AddHook(hook)
+			defer logrus.StandardLogger().ReplaceHooks(previousHooks)
+
+			keys, err := readKeyFile(writeKeyFile(t, tt.lines), tt.maxKeys)
+			if err != nil {
+				t.Fatalf("readKeyFile: %v", err)
+			}
+			if len(keys) != tt.want {
+				t.Errorf("readKeyFile returned %d keys, want %d", len(keys), tt.want)
+			}
+
+			var warnings []string
+			for _, entry := range hook.AllEntries() {
+				if entry.Level == logrus.WarnLevel {
+					warnings = append(warnings, entry.Message)
+				}
+			}
+			if tt.wantDiscarded == 0 {
+				if len(warnings) != 0 {
+					t.Errorf("unexpected warnings %q", warnings)
+				}
+				return
+			}
+			if want := fmt.Sprintf("has more than MAX_KEY_COUNT (%d) keys, discarded %d", tt.maxKeys, tt.wantDiscarded); len(warnings) != 1 || !strings.Contains(warnings[0], want) {
+				t.Errorf("warnings = %q, want one containing %q", warnings, want)
+			}
+		})
+	}
+}
+
+func TestReloadKeysAppliesMaxKeyCount(t *testing.T) {
+	km := newTestManager(t, types.KeysConfig{MaxKeyCount: 10}, "sk-initial")
+	if err := km.ReloadKeys(writeKeyFile(t, testKeys(100))); err != nil {
+		t.Fatalf("ReloadKeys: %v", err)
+	}
+	if total := km.GetCapacity().Total; total != 10 {
+		t.Errorf("loaded %d keys, want 10", total)
+	}
+}
+
+func TestReloadKeysHasNoTornReads(t *testing.T) {
+	oldKeys := testKeys(20)
+	newKeys := make([]string, 5)
+	for i := range newKeys {
+		newKeys[i] = fmt.Sprintf("sk-new-%04d", i)
+	}
+	valid := make(map[string]bool)
+	for _, key := range append(append([]string(nil), oldKeys...), newKeys...) {
+		valid[key] = true
+	}
+	paths := []string{writeKeyFile(t, newKeys), writeKeyFile(t, oldKeys)}
+	km := newTestManager(t, types.KeysConfig{}, oldKeys...)
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	errs := make(chan string, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				keyInfo, err := km.GetNextKey()
+				if err != nil {
+					continue
+				}
+				keyInfo.Release()
+				if !valid[keyInfo.Key] || keyInfo.Preview != redact.MaskKey(keyInfo.Key) {
+					errs <- fmt.Sprintf("torn pick %+v", keyInfo)
+					return
+				}
+				if total := km.GetCapacity().Total; total != len(oldKeys) && total != len(newKeys) {
+					errs <- fmt.Sprintf("pool size %d", total)
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 200; i++ {
+		if err := km.ReloadKeys(paths[i%2]); err != nil {
+			t.Fatalf("ReloadKeys: %v", err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
@@ -2,8 +2,8 @@
 package keymanager
 
 import (
-	"bufio"
-	"os"
+	"context"
+	"net/http"
 	"regexp"
 	"runtime"
 	"strings"
@@ -12,6 +12,8 @@ import (
 	"time"
 
 	"gpt-load/internal/errors"
+	"gpt-load/internal/metrics"
+	"gpt-load/internal/redact"
 	"gpt-load/pkg/types"
 
 	"github.com/sirupsen/logrus"
@@ -24,27 +26,50 @@ type Manager struct {
 	keyPreviews      []string
 	currentIndex     int64
 	blacklistedKeys  sync.Map
+	blacklistedCount int64
 	successCount     int64
 	failureCount     int64
 	keyFailureCounts sync.Map
 	config           types.KeysConfig
 
+	// Cooldown expiry (UnixNano) per key index, set when a key returns 429
+	cooldownUntil []atomic.Int64
+	// Requests in flight per key index, only tracked when KEY_MAX_CONCURRENT is set
+	inFlight []*atomic.Int64
+	// Rate limiter per key (string -> ratelimit.KeyLimiter), only tracked when KEY_RATE_LIMIT_RPM is set
+	keyBuckets sync.Map
+	// Usage counters per key (string -> *keyUsage) since the last stats reset
+	keyUsage sync.Map
+
+	// Probes blacklisted keys before recovery, nil unless BLACKLIST_PROBE_ENABLED is on
+	recoveryProbe atomic.Pointer[recoveryProbe]
+	// Loads the key pool from KEY_FETCH_URL, nil unless configured
+	fetcher *keyFetcher
+	// Loads the key pool from KEY_AWS_SECRET_ARN, nil unless configured
+	awsSecret *awsSecretSource
+	// Shares key pool state with other instances, nil unless a store is configured
+	coordinator *coordinator
+	// Posts blacklist events to BLACKLIST_WEBHOOK_URL, nil unless configured
+	notifier *blacklistNotifier
+	// Persists key state across restarts, nil unless a reachable store is configured
+	persister *statePersister
+
+	// Hot standby key, used only when every regular key is blacklisted
+	standbyFailures    int64
+	standbyBlacklisted atomic.Bool
+
 	// Performance optimization: pre-compiled regex patterns
 	permanentErrorPatterns []*regexp.Regexp
 
-	// Memory management
-	cleanupTicker *time.Ticker
-	stopCleanup   chan bool
-
 	// Read-write lock to protect key list
 	keysMutex sync.RWMutex
 }
 
 // NewManager creates a new key manager
-func NewManager(config types.KeysConfig) (types.KeyManager, error) {
+func NewManager(config types.KeysConfig, scheduler types.Scheduler) (types.KeyManager, error) {
 	km := &Manager{
+		keysFilePath: config.KeyFilePath,
 		currentIndex: int64(config.StartIndex),
-		stopCleanup:  make(chan bool),
 		config:       config,
 
 		// Pre-compile regex patterns
@@ -58,51 +83,189 @@ func NewManager(config types.KeysConfig) (types.KeyManager, error) {
 		},
 	}
 
-	// Start memory cleanup
-	km.setupMemoryCleanup()
+	metrics.RegisterKeyPool(
+		func() int { return km.GetCapacity().Active },
+		func() int { return km.GetCapacity().Blacklisted },
+	)
+	if config.Cooldown429Ms > 0 {
+		metrics.RegisterKeyCooldownActive(km.coolingDownCount)
+	}
+
+	metrics.RegisterKeyUsage(km.KeyUsage)
+
+	// Register memory cleanup
+	if err := km.setupMemoryCleanup(scheduler); err != nil {
+		return nil, err
+	}
+	if config.StatsResetIntervalHours > 0 {
+		if err := km.setupUsageReset(scheduler); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.BlacklistWebhookURL != "" {
+		km.notifier = newBlacklistNotifier(config.BlacklistWebhookURL, config.BlacklistWebhookSecret)
+	}
 
 	// Load keys
-	if len(config.APIKeys) == 0 {
+	if len(config.APIKeys) == 0 && config.KeyFilePath == "" && config.KeyFetchURL == "" && config.KeyAWSSecretARN == "" {
 		return nil, errors.NewAppError(errors.ErrNoKeysAvailable, "No API keys provided in environment variables")
 	}
 
+	if config.KeyFetchURL != "" {
+		km.fetcher = &keyFetcher{
+			url:        config.KeyFetchURL,
+			authHeader: config.KeyFetchAuthHeader,
+			httpClient: &http.Client{Timeout: 10 * time.Second},
+		}
+	}
+
+	if config.KeyAWSSecretARN != "" {
+		source, err := newAWSSecretSource(context.Background(), config.KeyAWSSecretARN, config.KeyAWSRegion)
+		if err != nil {
+			return nil, errors.NewAppErrorWithDetails(errors.ErrConfigInvalid, "Failed to configure AWS Secrets Manager client", err.Error())
+		}
+		km.awsSecret = source
+	}
+
 	if err := km.LoadKeys(); err != nil {
 		return nil, err
 	}
 
+	if km.fetcher != nil {
+		if err := km.setupKeyFetch(config, scheduler); err != nil {
+			return nil, err
+		}
+	}
+
+	// Restore persisted state before serving traffic
+	if config.StateStoreURL != "" {
+		if err := km.setupPersistence(config.StateStoreURL); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.CoordinationStoreURL != "" {
+		if err := km.setupCoordination(config, scheduler); err != nil {
+			return nil, err
+		}
+	}
+
 	return km, nil
 }
 
-// LoadKeys loads API keys from environment variables
+// LoadKeys loads API keys from the key fetch URL, the AWS secret or the key file
+// if configured, otherwise from environment variables. A failed AWS secret read
+// falls back to the key file or environment keys when there are any.
 func (km *Manager) LoadKeys() error {
+	if km.fetcher != nil {
+		return km.reloadFetchedKeys(context.Background())
+	}
+	if km.awsSecret != nil {
+		err := km.reloadAWSSecretKeys(context.Background())
+		if err == nil || (km.keysFilePath == "" && len(km.config.APIKeys) == 0) {
+			return err
+		}
+		logrus.Warnf("Falling back to locally configured keys: %v", err)
+	}
+	if km.keysFilePath != "" {
+		return km.ReloadKeys(km.keysFilePath)
+	}
+
+	keys, keyPreviews, err := km.buildKeys(km.config.APIKeys)
+	if err != nil {
+		return errors.NewAppError(errors.ErrNoKeysAvailable, "No valid API keys found in environment variables")
+	}
+
+	km.swapKeys(keys, keyPreviews)
+
+	logrus.Infof("Successfully loaded %d API keys from environment variables", len(keys))
+	return nil
+}
+
+// ReloadKeys replaces the key pool with the keys in a file, one key per line.
+// The old pool stays in place if the file cannot be read or holds no keys.
+func (km *Manager) ReloadKeys(path string) error {
+	rawKeys, err := readKeyFile(path, km.config.MaxKeyCount)
+	if err != nil {
+		return err
+	}
+
+	keys, keyPreviews, err := km.buildKeys(rawKeys)
+	if err != nil {
+		return errors.NewAppErrorWithDetails(errors.ErrKeyFileInvalid, "No valid API keys found in key file", path)
+	}
+
+	km.swapKeys(keys, keyPreviews)
+
+	logrus.Infof("Successfully loaded %d API keys from %s", len(keys), path)
+	return nil
+}
+
+// buildKeys trims raw keys, applies MAX_KEY_COUNT and creates their previews
+func (km *Manager) buildKeys(rawKeys []string) ([]string, []string, error) {
 	var keys []string
 	var keyPreviews []string
 
-	for _, key := range km.config.APIKeys {
+	discarded := 0
+	for _, key := range rawKeys {
 		trimmedKey := strings.TrimSpace(key)
+		if trimmedKey != "" && len(keys) >= km.config.MaxKeyCount {
+			discarded++
+			continue
+		}
 		if trimmedKey != "" {
 			keys = append(keys, trimmedKey)
-			// Create preview (first 8 chars + "..." + last 4 chars)
-			if len(trimmedKey) > 12 {
-				preview := trimmedKey[:8] + "..." + trimmedKey[len(trimmedKey)-4:]
-				keyPreviews = append(keyPreviews, preview)
-			} else {
-				keyPreviews = append(keyPreviews, trimmedKey)
-			}
+			keyPreviews = append(keyPreviews, redact.MaskKey(trimmedKey))
 		}
 	}
 
 	if len(keys) == 0 {
-		return errors.NewAppError(errors.ErrNoKeysAvailable, "No valid API keys found in environment variables")
+		return nil, nil, errors.ErrNoAPIKeysAvailable
+	}
+
+	if discarded > 0 {
+		logrus.Warnf("Key count exceeds MAX_KEY_COUNT (%d), discarded %d keys", km.config.MaxKeyCount, discarded)
+	}
+	return keys, keyPreviews, nil
+}
+
+// swapKeys installs a new key pool under the write lock, so readers see
+// either the old pool or the new one. State kept for keys that are no
+// longer in the pool is dropped.
+func (km *Manager) swapKeys(keys, keyPreviews []string) {
+	current := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		current[key] = struct{}{}
 	}
 
 	km.keysMutex.Lock()
 	km.keys = keys
 	km.keyPreviews = keyPreviews
+	km.cooldownUntil = make([]atomic.Int64, len(keys))
+	km.inFlight = newInFlightCounters(len(keys))
+	km.blacklistedKeys.Range(func(key, _ any) bool {
+		if _, exists := current[key.(string)]; !exists {
+			km.blacklistedKeys.Delete(key)
+			atomic.AddInt64(&km.blacklistedCount, -1)
+			km.persistKey(key.(string))
+		}
+		return true
+	})
+	km.keyFailureCounts.Range(func(key, _ any) bool {
+		if _, exists := current[key.(string)]; !exists {
+			km.keyFailureCounts.Delete(key)
+			km.persistKey(key.(string))
+		}
+		return true
+	})
+	km.keyBuckets.Range(func(key, _ any) bool {
+		if _, exists := current[key.(string)]; !exists {
+			km.keyBuckets.Delete(key)
+		}
+		return true
+	})
 	km.keysMutex.Unlock()
-
-	logrus.Infof("Successfully loaded %d API keys from environment variables", len(keys))
-	return nil
 }
 
 // GetNextKey gets the next available key (high-performance version)
@@ -119,45 +282,100 @@ func (km *Manager) GetNextKey() (*types.KeyInfo, error) {
 	keyIndex := int(currentIdx) % keysLen
 	selectedKey := km.keys[keyIndex]
 	keyPreview := km.keyPreviews[keyIndex]
-	km.keysMutex.RUnlock()
-
-	// Check if blacklisted
-	if _, blacklisted := km.blacklistedKeys.Load(selectedKey); !blacklisted {
-		return &types.KeyInfo{
-			Key:     selectedKey,
-			Index:   keyIndex,
-			Preview: keyPreview,
-		}, nil
+	coolingDown := km.isCoolingDown(keyIndex)
+
+	// Check if blacklisted, cooling down, at its concurrency cap or out of tokens
+	if !km.isBlacklisted(selectedKey) && !coolingDown {
+		if release, acquired := km.acquireKey(keyIndex); acquired {
+			if _, allowed := km.takeToken(selectedKey); allowed {
+				km.keysMutex.RUnlock()
+				return &types.KeyInfo{
+					Key:     selectedKey,
+					Index:   keyIndex,
+					Preview: keyPreview,
+					Tier:    types.KeyTierPrimary,
+					Release: release,
+				}, nil
+			}
+			release()
+		}
 	}
+	km.keysMutex.RUnlock()
 
 	// Slow path: find next available key
-	return km.findNextAvailableKey(keyIndex, keysLen)
+	return km.findNextAvailableKey(keyIndex)
 }
 
-// findNextAvailableKey finds the next available non-blacklisted key
-func (km *Manager) findNextAvailableKey(startIndex, keysLen int) (*types.KeyInfo, error) {
+// findNextAvailableKey finds the next available key that is neither blacklisted,
+// cooling down, at its concurrency cap nor out of tokens. The pool may have been
+// reloaded since startIndex was picked, so it is wrapped into the current pool.
+func (km *Manager) findNextAvailableKey(startIndex int) (*types.KeyInfo, error) {
 	km.keysMutex.RLock()
 	defer km.keysMutex.RUnlock()
 
+	keysLen := len(km.keys)
+	if keysLen == 0 {
+		return nil, errors.ErrNoAPIKeysAvailable
+	}
+	startIndex %= keysLen
+
 	blacklistedCount := 0
+	coolingDownCount := 0
+	busyCount := 0
+	rateLimitedCount := 0
+	var retryAfter time.Duration
 	for i := 0; i < keysLen; i++ {
 		keyIndex := (startIndex + i) % keysLen
 		selectedKey := km.keys[keyIndex]
 
-		if _, blacklisted := km.blacklistedKeys.Load(selectedKey); !blacklisted {
-			return &types.KeyInfo{
-				Key:     selectedKey,
-				Index:   keyIndex,
-				Preview: km.keyPreviews[keyIndex],
-			}, nil
+		if km.isBlacklisted(selectedKey) {
+			blacklistedCount++
+			continue
 		}
-		blacklistedCount++
+		if km.isCoolingDown(keyIndex) {
+			coolingDownCount++
+			continue
+		}
+		release, acquired := km.acquireKey(keyIndex)
+		if !acquired {
+			busyCount++
+			continue
+		}
+		if wait, allowed := km.takeToken(selectedKey); !allowed {
+			release()
+			if rateLimitedCount == 0 || wait < retryAfter {
+				retryAfter = wait
+			}
+			rateLimitedCount++
+			continue
+		}
+		return &types.KeyInfo{
+			Key:     selectedKey,
+			Index:   keyIndex,
+			Preview: km.keyPreviews[keyIndex],
+			Tier:    types.KeyTierPrimary,
+			Release: release,
+		}, nil
+	}
+
+	// Busy, rate limited and cooling keys come back on their own, so don't reset the blacklist for them
+	if busyCount > 0 {
+		return nil, errors.ErrAllAPIKeysBusy
+	}
+	if rateLimitedCount > 0 {
+		return nil, &errors.RetryAfterError{Err: errors.ErrAllAPIKeysRateLimited, RetryAfter: retryAfter}
+	}
+	if coolingDownCount > 0 {
+		return nil, errors.ErrAllAPIKeysCoolingDown
+	}
+
+	if blacklistedCount >= keysLen && km.config.HotStandbyKey != "" {
+		return km.standbyKey()
 	}
 
 	if blacklistedCount >= keysLen {
 		logrus.Warn("All keys are blacklisted, resetting blacklist")
-		km.blacklistedKeys = sync.Map{}
-		km.keyFailureCounts = sync.Map{}
+		km.ResetBlacklist()
 
 		// Return first key after reset
 		firstKey := km.keys[0]
@@ -167,26 +385,61 @@ func (km *Manager) findNextAvailableKey(startIndex, keysLen int) (*types.KeyInfo
 			Key:     firstKey,
 			Index:   0,
 			Preview: firstPreview,
+			Tier:    types.KeyTierPrimary,
+			Release: releaseNothing,
 		}, nil
 	}
 
 	return nil, errors.ErrAllAPIKeysBlacklisted
 }
 
+// standbyKey returns the hot standby key, unless it has been blacklisted too
+func (km *Manager) standbyKey() (*types.KeyInfo, error) {
+	if km.standbyBlacklisted.Load() {
+		return nil, errors.ErrAllAPIKeysBlacklisted
+	}
+
+	logrus.Error("All regular keys are blacklisted, serving request with the hot standby key")
+	return &types.KeyInfo{
+		Key:     km.config.HotStandbyKey,
+		Index:   -1,
+		Preview: "standby",
+		Tier:    types.KeyTierStandby,
+		Release: releaseNothing,
+	}, nil
+}
+
 // RecordSuccess records successful key usage
 func (km *Manager) RecordSuccess(key string) {
 	atomic.AddInt64(&km.successCount, 1)
+	km.recordUsage(key, true)
+	if key == km.config.HotStandbyKey {
+		atomic.StoreInt64(&km.standbyFailures, 0)
+		return
+	}
 	// Reset failure count for this key on success
-	km.keyFailureCounts.Delete(key)
+	if _, existed := km.keyFailureCounts.LoadAndDelete(key); existed {
+		km.persistKey(key)
+	}
 }
 
 // RecordFailure records key failure and potentially blacklists it
 func (km *Manager) RecordFailure(key string, err error) {
 	atomic.AddInt64(&km.failureCount, 1)
+	km.recordUsage(key, false)
+
+	// The standby key has its own threshold
+	if key == km.config.HotStandbyKey {
+		if km.isPermanentError(err) || int(atomic.AddInt64(&km.standbyFailures, 1)) >= km.config.HotStandbyBlacklistThreshold {
+			km.standbyBlacklisted.Store(true)
+			logrus.Error("Hot standby key blacklisted, no keys left")
+		}
+		return
+	}
 
 	// Check if this is a permanent error
 	if km.isPermanentError(err) {
-		km.blacklistedKeys.Store(key, time.Now())
+		km.blacklist(key, err.Error())
 		logrus.Debugf("Key blacklisted due to permanent error: %v", err)
 		return
 	}
@@ -198,12 +451,92 @@ func (km *Manager) RecordFailure(key string, err error) {
 
 		// Blacklist if threshold exceeded
 		if int(newFailCount) >= km.config.BlacklistThreshold {
-			km.blacklistedKeys.Store(key, time.Now())
+			km.blacklist(key, err.Error())
 			logrus.Debugf("Key blacklisted after %d failures", newFailCount)
+		} else {
+			km.persistKey(key)
+		}
+	}
+}
+
+// BlacklistKey blacklists a key immediately, bypassing the failure threshold
+func (km *Manager) BlacklistKey(key string) {
+	atomic.AddInt64(&km.failureCount, 1)
+	km.recordUsage(key, false)
+	if key == km.config.HotStandbyKey {
+		km.standbyBlacklisted.Store(true)
+		logrus.Error("Hot standby key blacklisted, no keys left")
+		return
+	}
+	km.blacklist(key, "rejected by upstream")
+	logrus.Debugf("Key blacklisted immediately")
+}
+
+// CooldownKey temporarily removes a key from selection after it returned 429
+func (km *Manager) CooldownKey(keyIndex int) {
+	if km.config.Cooldown429Ms <= 0 {
+		return
+	}
+
+	km.keysMutex.RLock()
+	defer km.keysMutex.RUnlock()
+
+	// The standby key (index -1) has no cooldown slot
+	if keyIndex < 0 || keyIndex >= len(km.cooldownUntil) {
+		return
+	}
+	cooldown := time.Duration(km.config.Cooldown429Ms) * time.Millisecond
+	km.cooldownUntil[keyIndex].Store(time.Now().Add(cooldown).UnixNano())
+	logrus.Debugf("Key %s cooling down for %v after HTTP 429", km.keyPreviews[keyIndex], cooldown)
+}
+
+// isCoolingDown reports whether a key is still cooling down, must be called with keysMutex held
+func (km *Manager) isCoolingDown(keyIndex int) bool {
+	return km.cooldownUntil[keyIndex].Load() > time.Now().UnixNano()
+}
+
+// coolingDownCount returns the number of keys currently cooling down
+func (km *Manager) coolingDownCount() int {
+	km.keysMutex.RLock()
+	defer km.keysMutex.RUnlock()
+
+	count := 0
+	for i := range km.cooldownUntil {
+		if km.isCoolingDown(i) {
+			count++
+		}
+	}
+	return count
+}
+
+// blacklist adds a key to the blacklist, keeping the blacklisted count in step.
+// The reason is reported to the blacklist webhook.
+func (km *Manager) blacklist(key, reason string) {
+	blacklistedAt := time.Now()
+	if _, loaded := km.blacklistedKeys.LoadOrStore(key, blacklistedAt); !loaded {
+		atomic.AddInt64(&km.blacklistedCount, 1)
+		km.usageOf(key).blacklists.Add(1)
+		km.persistKey(key)
+		if km.notifier != nil {
+			km.notifier.notify(key, reason, blacklistedAt)
 		}
 	}
 }
 
+// GetCapacity returns key pool sizes without the cost of full statistics
+func (km *Manager) GetCapacity() types.KeyCapacity {
+	km.keysMutex.RLock()
+	total := len(km.keys)
+	km.keysMutex.RUnlock()
+
+	blacklisted := int(atomic.LoadInt64(&km.blacklistedCount))
+	return types.KeyCapacity{
+		Total:       total,
+		Active:      total - blacklisted,
+		Blacklisted: blacklisted,
+	}
+}
+
 // isPermanentError checks if an error is permanent
 func (km *Manager) isPermanentError(err error) bool {
 	if err == nil {
@@ -252,10 +585,22 @@ func (km *Manager) GetStats() types.Stats {
 	}
 }
 
-// ResetBlacklist resets the blacklist
+// ResetBlacklist resets the blacklist, in the state store too. Entries are deleted
+// one by one, so concurrent lookups and blacklisting stay safe.
 func (km *Manager) ResetBlacklist() {
-	km.blacklistedKeys = sync.Map{}
-	km.keyFailureCounts = sync.Map{}
+	km.blacklistedKeys.Range(func(key, _ any) bool {
+		if _, loaded := km.blacklistedKeys.LoadAndDelete(key); loaded {
+			atomic.AddInt64(&km.blacklistedCount, -1)
+		}
+		return true
+	})
+	km.keyFailureCounts.Range(func(key, _ any) bool {
+		km.keyFailureCounts.Delete(key)
+		return true
+	})
+	km.standbyBlacklisted.Store(false)
+	atomic.StoreInt64(&km.standbyFailures, 0)
+	km.persistClear()
 	logrus.Info("Blacklist reset successfully")
 }
 
@@ -267,12 +612,6 @@ func (km *Manager) GetBlacklist() []types.BlacklistEntry {
 		keyStr := key.(string)
 		blacklistTime := value.(time.Time)
 
-		// Create preview
-		preview := keyStr
-		if len(keyStr) > 12 {
-			preview = keyStr[:8] + "..." + keyStr[len(keyStr)-4:]
-		}
-
 		// Get failure count
 		failCount := 0
 		if count, exists := km.keyFailureCounts.Load(keyStr); exists {
@@ -281,7 +620,7 @@ func (km *Manager) GetBlacklist() []types.BlacklistEntry {
 
 		blacklist = append(blacklist, types.BlacklistEntry{
 			Key:         keyStr,
-			Preview:     preview,
+			Preview:     redact.MaskKey(keyStr),
 			Reason:      "Exceeded failure threshold",
 			BlacklistAt: blacklistTime,
 			FailCount:   failCount,
@@ -292,33 +631,31 @@ func (km *Manager) GetBlacklist() []types.BlacklistEntry {
 	return blacklist
 }
 
-// setupMemoryCleanup sets up periodic memory cleanup
-func (km *Manager) setupMemoryCleanup() {
+// setupMemoryCleanup registers periodic memory cleanup with the scheduler
+func (km *Manager) setupMemoryCleanup(scheduler types.Scheduler) error {
 	// Reduce GC frequency to every 15 minutes to avoid performance impact
-	km.cleanupTicker = time.NewTicker(15 * time.Minute)
-	go func() {
-		for {
-			select {
-			case <-km.cleanupTicker.C:
-				// Only trigger GC if memory usage is high
-				var m runtime.MemStats
-				runtime.ReadMemStats(&m)
-				// Trigger GC only if allocated memory is above 100MB
-				if m.Alloc > 100*1024*1024 {
-					runtime.GC()
-					logrus.Debugf("Manual GC triggered, memory usage: %d MB", m.Alloc/1024/1024)
-				}
-			case <-km.stopCleanup:
-				return
-			}
+	return scheduler.AddTask("memory-cleanup", 15*time.Minute, func(ctx context.Context) {
+		// Only trigger GC if memory usage is high
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		// Trigger GC only if allocated memory is above 100MB
+		if m.Alloc > 100*1024*1024 {
+			runtime.GC()
+			logrus.Debugf("Manual GC triggered, memory usage: %d MB", m.Alloc/1024/1024)
 		}
-	}()
+	})
 }
 
 // Close closes the key manager and cleans up resources
 func (km *Manager) Close() {
-	if km.cleanupTicker != nil {
-		km.cleanupTicker.Stop()
+	// Background tasks are owned by the scheduler and stopped with it
+	if km.coordinator != nil {
+		km.coordinator.close()
+	}
+	if km.persister != nil {
+		km.persister.close()
+	}
+	if km.notifier != nil {
+		km.notifier.close()
 	}
-	close(km.stopCleanup)
 }
@@ -0,0 +1,129 @@
+package keymanager
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"gpt-load/pkg/types"
+)
+
+// newTestManager returns a manager holding keys, without scheduler tasks or stores
+func newTestManager(t *testing.T, config types.KeysConfig, keys ...string) *Manager {
+	t.Helper()
+	if config.MaxKeyCount == 0 {
+		config.MaxKeyCount = 1000
+	}
+	if config.BlacklistThreshold == 0 {
+		config.BlacklistThreshold = 1
+	}
+	km := &Manager{config: config}
+	built, previews, err := km.buildKeys(keys)
+	if err != nil {
+		t.Fatalf("buildKeys: %v", err)
+	}
+	km.swapKeys(built, previews)
+	return km
+}
+
+// testKeys returns n distinct keys
+func testKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("sk-test-%04d", i)
+	}
+	return keys
+}
+
+func TestGetNextKeyDuringReload(t *testing.T) {
+	large := testKeys(50)
+	small := testKeys(2)
+	km := newTestManager(t, types.KeysConfig{}, large...)
+	// Force every fast path pick onto the slow path, where the old length was reused
+	for _, key := range large {
+		km.blacklist(key, "test")
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if keyInfo, err := km.GetNextKey(); err == nil {
+					keyInfo.Release()
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 500; i++ {
+		pool := large
+		if i%2 == 0 {
+			pool = small
+		}
+		keys, previews, err := km.buildKeys(pool)
+		if err != nil {
+			t.Fatalf("buildKeys: %v", err)
+		}
+		km.swapKeys(keys, previews)
+		for _, key := range pool[:1] {
+			km.blacklist(key, "test")
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestGetNextKeySkipsBlacklisted(t *testing.T) {
+	tests := []struct {
+		name        string
+		keys        int
+		blacklisted []int
+		want        []string
+	}{
+		{name: "none blacklisted", keys: 3, want: []string{"sk-test-0000", "sk-test-0001", "sk-test-0002"}},
+		{name: "middle blacklisted", keys: 3, blacklisted: []int{1}, want: []string{"sk-test-0000", "sk-test-0002", "sk-test-0002"}},
+		{name: "all blacklisted resets", keys: 2, blacklisted: []int{0, 1}, want: []string{"sk-test-0000", "sk-test-0001"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := testKeys(tt.keys)
+			km := newTestManager(t, types.KeysConfig{}, keys...)
+			for _, index := range tt.blacklisted {
+				km.blacklist(keys[index], "test")
+			}
+			for i, want := range tt.want {
+				keyInfo, err := km.GetNextKey()
+				if err != nil {
+					t.Fatalf("pick %d: %v", i, err)
+				}
+				if keyInfo.Key != want {
+					t.Errorf("pick %d = %s, want %s", i, keyInfo.Key, want)
+				}
+			}
+		})
+	}
+}
+
+func TestResetBlacklistClearsCounts(t *testing.T) {
+	keys := testKeys(3)
+	km := newTestManager(t, types.KeysConfig{}, keys...)
+	for _, key := range keys {
+		km.blacklist(key, "test")
+	}
+	km.ResetBlacklist()
+
+	if capacity := km.GetCapacity(); capacity.Blacklisted != 0 || capacity.Active != 3 {
+		t.Errorf("capacity after reset = %+v, want 3 active and none blacklisted", capacity)
+	}
+	if blacklist := km.GetBlacklist(); len(blacklist) != 0 {
+		t.Errorf("blacklist after reset has %d entries", len(blacklist))
+	}
+}
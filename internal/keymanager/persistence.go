@@ -0,0 +1,221 @@
+package keymanager
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gpt-load/internal/errors"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// stateHashKey is the Redis hash holding persisted key state, one field per key ID
+	stateHashKey = "gptload:keystate"
+
+	// stateQueueSize bounds the pending writes, updates beyond it are dropped
+	stateQueueSize = 1024
+)
+
+// persistedState is the stored state of one key
+type persistedState struct {
+	Failures      int64      `json:"failures"`
+	BlacklistedAt *time.Time `json:"blacklistedAt,omitempty"`
+}
+
+// stateUpdate asks the writer to store the current state of a key, or to
+// clear all stored state
+type stateUpdate struct {
+	key   string
+	clear bool
+}
+
+// stateStore is the part of the Redis client the persister uses
+type stateStore interface {
+	HGetAll(ctx context.Context, key string) *redis.MapStringStringCmd
+	HSet(ctx context.Context, key string, values ...interface{}) *redis.IntCmd
+	HDel(ctx context.Context, key string, fields ...string) *redis.IntCmd
+	Del(ctx context.Context, keys ...string) *redis.IntCmd
+	Close() error
+}
+
+// statePersister writes key state through to Redis on a single goroutine,
+// so request paths only ever enqueue an update
+type statePersister struct {
+	km      *Manager
+	client  stateStore
+	updates chan stateUpdate
+	done    chan struct{}
+
+	// Guards sending on updates against close
+	mu     sync.RWMutex
+	closed bool
+}
+
+// setupPersistence connects to the state store and restores persisted key
+// state. An unreachable store is not fatal, the manager then runs without
+// persistence.
+func (km *Manager) setupPersistence(storeURL string) error {
+	options, err := redis.ParseURL(storeURL)
+	if err != nil {
+		return errors.NewAppErrorWithCause(errors.ErrConfigInvalid, "Invalid state store URL", err)
+	}
+	client := redis.NewClient(options)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		logrus.Warnf("State store unreachable, key state will not persist across restarts: %v", err)
+		client.Close()
+		return nil
+	}
+
+	km.startPersistence(ctx, client)
+	return nil
+}
+
+// startPersistence restores the key state held in store, then starts writing changes through to it
+func (km *Manager) startPersistence(ctx context.Context, store stateStore) {
+	p := &statePersister{
+		km:      km,
+		client:  store,
+		updates: make(chan stateUpdate, stateQueueSize),
+		done:    make(chan struct{}),
+	}
+	if err := p.restore(ctx); err != nil {
+		logrus.Warnf("Failed to restore key state, starting fresh: %v", err)
+	}
+
+	km.persister = p
+	go p.run()
+}
+
+// restore loads persisted state for the keys currently in the pool
+func (p *statePersister) restore(ctx context.Context) error {
+	stored, err := p.client.HGetAll(ctx, stateHashKey).Result()
+	if err != nil {
+		return err
+	}
+
+	p.km.keysMutex.RLock()
+	keys := p.km.keys
+	p.km.keysMutex.RUnlock()
+
+	restored := 0
+	for _, key := range keys {
+		data, exists := stored[keyID(key)]
+		if !exists {
+			continue
+		}
+
+		var state persistedState
+		if err := json.Unmarshal([]byte(data), &state); err != nil {
+			logrus.Debugf("Skipping unreadable state for key %s: %v", keyID(key), err)
+			continue
+		}
+		if state.Failures > 0 {
+			counter := state.Failures
+			p.km.keyFailureCounts.Store(key, &counter)
+		}
+		if state.BlacklistedAt != nil {
+			if _, loaded := p.km.blacklistedKeys.LoadOrStore(key, *state.BlacklistedAt); !loaded {
+				atomic.AddInt64(&p.km.blacklistedCount, 1)
+			}
+		}
+		restored++
+	}
+
+	if restored > 0 {
+		logrus.Infof("Restored persisted state of %d keys", restored)
+	}
+	return nil
+}
+
+// enqueue queues an update without blocking the caller
+func (p *statePersister) enqueue(update stateUpdate) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return
+	}
+	select {
+	case p.updates <- update:
+	default:
+		logrus.Warn("Key state write queue is full, dropping update")
+	}
+}
+
+// run applies queued updates until the queue is closed
+func (p *statePersister) run() {
+	defer close(p.done)
+
+	for update := range p.updates {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := p.write(ctx, update); err != nil {
+			logrus.Warnf("Failed to persist key state: %v", err)
+		}
+		cancel()
+	}
+}
+
+// write stores the key's current local state, deleting it once there is nothing to keep
+func (p *statePersister) write(ctx context.Context, update stateUpdate) error {
+	if update.clear {
+		return p.client.Del(ctx, stateHashKey).Err()
+	}
+
+	var state persistedState
+	if value, exists := p.km.keyFailureCounts.Load(update.key); exists {
+		state.Failures = atomic.LoadInt64(value.(*int64))
+	}
+	if value, blacklisted := p.km.blacklistedKeys.Load(update.key); blacklisted {
+		blacklistedAt := value.(time.Time)
+		state.BlacklistedAt = &blacklistedAt
+	}
+
+	if state.Failures == 0 && state.BlacklistedAt == nil {
+		return p.client.HDel(ctx, stateHashKey, keyID(update.key)).Err()
+	}
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return p.client.HSet(ctx, stateHashKey, keyID(update.key), payload).Err()
+}
+
+// close flushes the queued updates and releases the store connection
+func (p *statePersister) close() {
+	p.mu.Lock()
+	p.closed = true
+	close(p.updates)
+	p.mu.Unlock()
+
+	select {
+	case <-p.done:
+	case <-time.After(5 * time.Second):
+		logrus.Warn("Timed out flushing key state to the state store")
+	}
+	if err := p.client.Close(); err != nil {
+		logrus.Debugf("Failed to close state store client: %v", err)
+	}
+}
+
+// persistKey queues a write of the key's state, a no-op without a state store
+func (km *Manager) persistKey(key string) {
+	if km.persister != nil {
+		km.persister.enqueue(stateUpdate{key: key})
+	}
+}
+
+// persistClear queues clearing all stored state, a no-op without a state store
+func (km *Manager) persistClear() {
+	if km.persister != nil {
+		km.persister.enqueue(stateUpdate{clear: true})
+	}
+}
@@ -0,0 +1,271 @@
+package keymanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"gpt-load/pkg/types"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// fakeStore keeps one Redis hash in memory. Writes wait on release when it is set.
+type fakeStore struct {
+	mu      sync.Mutex
+	hashes  map[string]map[string]string
+	release chan struct{}
+	closed  bool
+}
+
+func newFakeStore(fields map[string]string) *fakeStore {
+	return &fakeStore{hashes: map[string]map[string]string{stateHashKey: fields}}
+}
+
+func (s *fakeStore) wait() {
+	if s.release != nil {
+		<-s.release
+	}
+}
+
+func (s *fakeStore) HGetAll(ctx context.Context, key string) *redis.MapStringStringCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fields := make(map[string]string, len(s.hashes[key]))
+	for field, value := range s.hashes[key] {
+		fields[field] = value
+	}
+	return redis.NewMapStringStringResult(fields, nil)
+}
+
+func (s *fakeStore) HSet(ctx context.Context, key string, values ...interface{}) *redis.IntCmd {
+	s.wait()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.hashes[key] == nil {
+		s.hashes[key] = make(map[string]string)
+	}
+	for i := 0; i+1 < len(values); i += 2 {
+		s.hashes[key][fmt.Sprint(values[i])] = fmt.Sprintf("%s", values[i+1])
+	}
+	return redis.NewIntResult(int64(len(values)/2), nil)
+}
+
+func (s *fakeStore) HDel(ctx context.Context, key string, fields ...string) *redis.IntCmd {
+	s.wait()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, field := range fields {
+		delete(s.hashes[key], field)
+	}
+	return redis.NewIntResult(int64(len(fields)), nil)
+}
+
+func (s *fakeStore) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	s.wait()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		delete(s.hashes, key)
+	}
+	return redis.NewIntResult(int64(len(keys)), nil)
+}
+
+func (s *fakeStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+// stored returns the persisted state of key, ok is false when none is stored
+func (s *fakeStore) stored(t *testing.T, key string) (persistedState, bool) {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, exists := s.hashes[stateHashKey][keyID(key)]
+	if !exists {
+		return persistedState{}, false
+	}
+	var state persistedState
+	if err := json.Unmarshal([]byte(data), &state); err != nil {
+		t.Fatalf("stored state of %s: %v", key, err)
+	}
+	return state, true
+}
+
+// encodeState returns the stored form of state
+func encodeState(t *testing.T, state persistedState) string {
+	t.Helper()
+	data, err := json.Marshal(state)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	return string(data)
+}
+
+func TestPersistenceWritesThrough(t *testing.T) {
+	keys := testKeys(3)
+	tests := []struct {
+		name string
+		// mutate changes the state of the pool, the persister is closed afterwards to flush it
+		mutate       func(km *Manager)
+		wantFailures []int64
+		wantBlocked  []bool
+		wantStored   []bool
+	}{
+		{
+			name:         "failures counted",
+			mutate:       func(km *Manager) { km.RecordFailure(keys[0], fmt.Errorf("timeout")) },
+			wantFailures: []int64{1, 0, 0}, wantBlocked: []bool{false, false, false}, wantStored: []bool{true, false, false},
+		},
+		{
+			name: "success clears failures",
+			mutate: func(km *Manager) {
+				km.RecordFailure(keys[0], fmt.Errorf("timeout"))
+				km.RecordSuccess(keys[0])
+			},
+			wantFailures: []int64{0, 0, 0}, wantBlocked: []bool{false, false, false}, wantStored: []bool{false, false, false},
+		},
+		{
+			name: "failure threshold blacklists",
+			mutate: func(km *Manager) {
+				for i := 0; i < 3; i++ {
+					km.RecordFailure(keys[1], fmt.Errorf("timeout"))
+				}
+			},
+			wantFailures: []int64{0, 3, 0}, wantBlocked: []bool{false, true, false}, wantStored: []bool{false, true, false},
+		},
+		{
+			name:         "force blacklisted",
+			mutate:       func(km *Manager) { km.BlacklistKey(keys[2]) },
+			wantFailures: []int64{0, 0, 0}, wantBlocked: []bool{false, false, true}, wantStored: []bool{false, false, true},
+		},
+		{
+			name: "recovered key cleared",
+			mutate: func(km *Manager) {
+				km.BlacklistKey(keys[2])
+				km.RecoverKey(keyID(keys[2]))
+			},
+			wantFailures: []int64{0, 0, 0}, wantBlocked: []bool{false, false, false}, wantStored: []bool{false, false, false},
+		},
+		{
+			name: "reset clears everything",
+			mutate: func(km *Manager) {
+				km.RecordFailure(keys[0], fmt.Errorf("timeout"))
+				km.BlacklistKey(keys[1])
+				km.ResetBlacklist()
+			},
+			wantFailures: []int64{0, 0, 0}, wantBlocked: []bool{false, false, false}, wantStored: []bool{false, false, false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeStore(nil)
+			km := newTestManager(t, types.KeysConfig{BlacklistThreshold: 3}, keys...)
+			km.startPersistence(context.Background(), store)
+			tt.mutate(km)
+			km.persister.close()
+
+			if !store.closed {
+				t.Error("store was not closed")
+			}
+			for i, key := range keys {
+				state, stored := store.stored(t, key)
+				if stored != tt.wantStored[i] {
+					t.Errorf("%s stored = %v, want %v", key, stored, tt.wantStored[i])
+				}
+				if state.Failures != tt.wantFailures[i] {
+					t.Errorf("%s failures = %d, want %d", key, state.Failures, tt.wantFailures[i])
+				}
+				if blocked := state.BlacklistedAt != nil; blocked != tt.wantBlocked[i] {
+					t.Errorf("%s blacklisted = %v, want %v", key, blocked, tt.wantBlocked[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPersistenceRestoresOnStartup(t *testing.T) {
+	keys := testKeys(4)
+	blacklistedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	store := newFakeStore(map[string]string{
+		keyID(keys[0]):          encodeState(t, persistedState{Failures: 2}),
+		keyID(keys[1]):          encodeState(t, persistedState{Failures: 3, BlacklistedAt: &blacklistedAt}),
+		keyID(keys[2]):          "not json",
+		keyID("sk-removed-key"): encodeState(t, persistedState{BlacklistedAt: &blacklistedAt}),
+	})
+	km := newTestManager(t, types.KeysConfig{BlacklistThreshold: 3}, keys...)
+	km.startPersistence(context.Background(), store)
+	defer km.persister.close()
+
+	tests := []struct {
+		key          string
+		wantFailures int64
+		wantBlocked  bool
+	}{
+		{key: keys[0], wantFailures: 2},
+		{key: keys[1], wantFailures: 3, wantBlocked: true},
+		{key: keys[2]},
+		{key: keys[3]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			failures := int64(0)
+			if value, exists := km.keyFailureCounts.Load(tt.key); exists {
+				failures = *value.(*int64)
+			}
+			if failures != tt.wantFailures {
+				t.Errorf("failures = %d, want %d", failures, tt.wantFailures)
+			}
+			value, blocked := km.blacklistedKeys.Load(tt.key)
+			if blocked != tt.wantBlocked {
+				t.Fatalf("blacklisted = %v, want %v", blocked, tt.wantBlocked)
+			}
+			if blocked && !value.(time.Time).Equal(blacklistedAt) {
+				t.Errorf("blacklisted at %v, want %v", value, blacklistedAt)
+			}
+		})
+	}
+	if capacity := km.GetCapacity(); capacity.Blacklisted != 1 {
+		t.Errorf("capacity = %+v, want one blacklisted key", capacity)
+	}
+
+	// The next failure on a restored count reaches the threshold
+	km.RecordFailure(keys[0], fmt.Errorf("timeout"))
+	if _, blocked := km.blacklistedKeys.Load(keys[0]); !blocked {
+		t.Error("restored failure count did not carry towards the threshold")
+	}
+}
+
+func TestPersistenceNeverBlocksRequests(t *testing.T) {
+	store := newFakeStore(nil)
+	store.release = make(chan struct{})
+	keys := testKeys(1)
+	km := newTestManager(t, types.KeysConfig{BlacklistThreshold: 1000000}, keys...)
+	km.startPersistence(context.Background(), store)
+
+	// The writer is stuck on the first write, so the queue fills and updates are dropped
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 2*stateQueueSize; i++ {
+			km.RecordFailure(keys[0], fmt.Errorf("timeout"))
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("RecordFailure blocked on the state store")
+	}
+
+	// Once released, the flush still stores the latest state
+	close(store.release)
+	km.persister.close()
+	if state, _ := store.stored(t, keys[0]); state.Failures != 2*stateQueueSize {
+		t.Errorf("stored failures = %d, want %d", state.Failures, 2*stateQueueSize)
+	}
+}
@@ -0,0 +1,142 @@
+package keymanager
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gpt-load/pkg/types"
+
+	"github.com/sirupsen/logrus"
+)
+
+// probeResult represents the outcome of probing a single key
+type probeResult int
+
+const (
+	probeUnverified probeResult = iota
+	probeWorking
+	probeInvalid
+)
+
+// ProbeKeys concurrently probes every key against the upstream and ranks the
+// pool: working keys first, then unverified keys, then invalid keys, which are
+// also blacklisted. Rotation restarts at the first working key.
+func (km *Manager) ProbeKeys(prober types.KeyProber) {
+	km.keysMutex.RLock()
+	keys := append([]string(nil), km.keys...)
+	km.keysMutex.RUnlock()
+
+	// Bound the whole probe by the startup wait
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(km.config.StartupWaitSeconds)*time.Second)
+	defer cancel()
+
+	timeout := time.Duration(km.config.KeyProbeTimeoutMs) * time.Millisecond
+	results := make([]probeResult, len(keys))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < km.config.KeyProbeConcurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = probeKey(ctx, prober, timeout, keys[i])
+			}
+		}()
+	}
+
+feed:
+	for i := range keys {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			logrus.Warn("Key probe did not finish within the startup wait, remaining keys are unverified")
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	// Rank keys, preserving original order within each group
+	order := make([]int, 0, len(keys))
+	counts := make(map[probeResult]int)
+	for _, group := range []probeResult{probeWorking, probeUnverified, probeInvalid} {
+		for i, result := range results {
+			if result == group {
+				order = append(order, i)
+				counts[group]++
+			}
+		}
+	}
+
+	if km.reorderKeys(keys, order) {
+		atomic.StoreInt64(&km.currentIndex, 0)
+	} else {
+		logrus.Warn("Key pool was replaced during the key probe, keeping its order")
+	}
+
+	for i, result := range results {
+		if result == probeInvalid {
+			km.blacklist(keys[i], "rejected by startup key probe")
+		}
+	}
+
+	logrus.Infof("Key probe finished: %d working, %d unverified, %d invalid",
+		counts[probeWorking], counts[probeUnverified], counts[probeInvalid])
+}
+
+// reorderKeys puts the pool in the order of indexes into snapshot, moving the
+// per-key previews, cooldowns and in-flight counters along with their keys.
+// It returns false, leaving the pool alone, when it no longer matches snapshot.
+func (km *Manager) reorderKeys(snapshot []string, order []int) bool {
+	km.keysMutex.Lock()
+	defer km.keysMutex.Unlock()
+
+	if !slices.Equal(km.keys, snapshot) {
+		return false
+	}
+
+	keys := make([]string, len(order))
+	keyPreviews := make([]string, len(order))
+	cooldownUntil := make([]atomic.Int64, len(order))
+	inFlight := make([]*atomic.Int64, len(order))
+	for position, index := range order {
+		keys[position] = km.keys[index]
+		keyPreviews[position] = km.keyPreviews[index]
+		cooldownUntil[position].Store(km.cooldownUntil[index].Load())
+		// Counters are moved rather than copied, releases still hold them
+		inFlight[position] = km.inFlight[index]
+	}
+	km.keys = keys
+	km.keyPreviews = keyPreviews
+	km.cooldownUntil = cooldownUntil
+	km.inFlight = inFlight
+	return true
+}
+
+// probeKey sends a lightweight authenticated request to check a key
+func probeKey(ctx context.Context, prober types.KeyProber, timeout time.Duration, key string) probeResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	resp, err := prober(ctx, key)
+	if err != nil {
+		return probeUnverified
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return probeWorking
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return probeInvalid
+	default:
+		return probeUnverified
+	}
+}
@@ -0,0 +1,154 @@
+package keymanager
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"gpt-load/pkg/types"
+)
+
+// stubProber answers each key with a fixed status, or an error for status 0
+func stubProber(statuses map[string]int) types.KeyProber {
+	return func(_ context.Context, key string) (*http.Response, error) {
+		status := statuses[key]
+		if status == 0 {
+			return nil, errors.New("connection refused")
+		}
+		return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader("{}"))}, nil
+	}
+}
+
+func TestProbeKeysRanksPool(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses map[string]int
+		want     []string
+		invalid  []string
+	}{
+		{
+			name:     "working first, invalid last",
+			statuses: map[string]int{"sk-key-aaaaaa": 401, "sk-key-bbbbbb": 500, "sk-key-cccccc": 200},
+			want:     []string{"sk-key-cccccc", "sk-key-bbbbbb", "sk-key-dddddd", "sk-key-aaaaaa"},
+			invalid:  []string{"sk-key-aaaaaa"},
+		},
+		{
+			name:     "all working keeps order",
+			statuses: map[string]int{"sk-key-aaaaaa": 200, "sk-key-bbbbbb": 200, "sk-key-cccccc": 200, "sk-key-dddddd": 200},
+			want:     []string{"sk-key-aaaaaa", "sk-key-bbbbbb", "sk-key-cccccc", "sk-key-dddddd"},
+		},
+		{
+			name:     "forbidden is invalid",
+			statuses: map[string]int{"sk-key-aaaaaa": 200, "sk-key-bbbbbb": 403, "sk-key-cccccc": 200, "sk-key-dddddd": 429},
+			want:     []string{"sk-key-aaaaaa", "sk-key-cccccc", "sk-key-dddddd", "sk-key-bbbbbb"},
+			invalid:  []string{"sk-key-bbbbbb"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			km := newTestManager(t, types.KeysConfig{StartupWaitSeconds: 5, KeyProbeTimeoutMs: 1000, KeyProbeConcurrency: 2}, "sk-key-aaaaaa", "sk-key-bbbbbb", "sk-key-cccccc", "sk-key-dddddd")
+			previews := make(map[string]string)
+			for i, key := range km.keys {
+				previews[key] = km.keyPreviews[i]
+			}
+			km.ProbeKeys(stubProber(tt.statuses))
+
+			if !slices.Equal(km.keys, tt.want) {
+				t.Errorf("keys = %v, want %v", km.keys, tt.want)
+			}
+			for i, key := range km.keys {
+				if preview := km.keyPreviews[i]; preview != previews[key] {
+					t.Errorf("preview %d = %q, want the preview of %s", i, preview, key)
+				}
+				if blacklisted := km.isBlacklisted(key); blacklisted != slices.Contains(tt.invalid, key) {
+					t.Errorf("%s blacklisted = %v", key, blacklisted)
+				}
+			}
+		})
+	}
+}
+
+func TestProbeKeysMovesPerKeyState(t *testing.T) {
+	km := newTestManager(t, types.KeysConfig{
+		StartupWaitSeconds:  5,
+		KeyProbeTimeoutMs:   1000,
+		KeyProbeConcurrency: 1,
+		KeyMaxConcurrent:    1,
+		Cooldown429Ms:       60000,
+	}, "sk-key-aaaaaa", "sk-key-bbbbbb", "sk-key-cccccc")
+	// The first key cools down, the second holds its only slot
+	km.CooldownKey(0)
+	release, ok := km.acquireKey(1)
+	if !ok {
+		t.Fatal("acquireKey failed")
+	}
+
+	km.ProbeKeys(stubProber(map[string]int{"sk-key-aaaaaa": 500, "sk-key-bbbbbb": 500, "sk-key-cccccc": 200}))
+	if want := []string{"sk-key-cccccc", "sk-key-aaaaaa", "sk-key-bbbbbb"}; !slices.Equal(km.keys, want) {
+		t.Fatalf("keys = %v, want %v", km.keys, want)
+	}
+
+	tests := []struct {
+		key      string
+		cooling  bool
+		inFlight int64
+	}{
+		{key: "sk-key-cccccc"},
+		{key: "sk-key-aaaaaa", cooling: true},
+		{key: "sk-key-bbbbbb", inFlight: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			index := slices.Index(km.keys, tt.key)
+			if cooling := km.isCoolingDown(index); cooling != tt.cooling {
+				t.Errorf("cooling down = %v, want %v", cooling, tt.cooling)
+			}
+			if inFlight := km.inFlight[index].Load(); inFlight != tt.inFlight {
+				t.Errorf("in flight = %d, want %d", inFlight, tt.inFlight)
+			}
+		})
+	}
+
+	// Releasing after the reorder frees the slot of the same key
+	release()
+	if inFlight := km.inFlight[slices.Index(km.keys, "sk-key-bbbbbb")].Load(); inFlight != 0 {
+		t.Errorf("in flight after release = %d, want 0", inFlight)
+	}
+}
+
+func TestProbeKeysKeepsReplacedPool(t *testing.T) {
+	km := newTestManager(t, types.KeysConfig{StartupWaitSeconds: 5, KeyProbeTimeoutMs: 1000, KeyProbeConcurrency: 1}, "sk-key-aaaaaa", "sk-key-bbbbbb")
+	replaced := false
+	prober := func(ctx context.Context, key string) (*http.Response, error) {
+		if !replaced {
+			replaced = true
+			built, previews, _ := km.buildKeys([]string{"sk-key-xxxxxx", "sk-key-yyyyyy"})
+			km.swapKeys(built, previews)
+		}
+		return stubProber(map[string]int{"sk-key-aaaaaa": 401, "sk-key-bbbbbb": 200})(ctx, key)
+	}
+	km.ProbeKeys(prober)
+
+	if want := []string{"sk-key-xxxxxx", "sk-key-yyyyyy"}; !slices.Equal(km.keys, want) {
+		t.Errorf("keys = %v, want the replaced pool %v", km.keys, want)
+	}
+}
+
+func TestProbeKeyTimeout(t *testing.T) {
+	slow := func(ctx context.Context, _ string) (*http.Response, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	start := time.Now()
+	if result := probeKey(context.Background(), slow, 10*time.Millisecond, "sk-key-aaaaaa"); result != probeUnverified {
+		t.Errorf("probeKey = %v, want unverified", result)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("probeKey took %v, want the per-key timeout", elapsed)
+	}
+}
@@ -0,0 +1,27 @@
+package keymanager
+
+import (
+	"time"
+
+	"gpt-load/internal/ratelimit"
+)
+
+// takeToken takes one of a key's KEY_RATE_LIMIT_RPM tokens, returning false and
+// the wait for the next token when the key is out of tokens
+func (km *Manager) takeToken(key string) (time.Duration, bool) {
+	rpm := km.config.KeyRateLimitRPM
+	if rpm <= 0 {
+		return 0, true
+	}
+
+	value, ok := km.keyBuckets.Load(key)
+	if !ok {
+		window := time.Duration(km.config.KeyRateLimitWindowSeconds) * time.Second
+		value, _ = km.keyBuckets.LoadOrStore(key, ratelimit.NewKeyLimiter(km.config.KeyRateLimitAlgorithm, rpm, window))
+	}
+	limiter := value.(ratelimit.KeyLimiter)
+	if limiter.Take() {
+		return 0, true
+	}
+	return limiter.Wait(), false
+}
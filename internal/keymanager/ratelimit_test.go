@@ -0,0 +1,83 @@
+package keymanager
+
+import (
+	stderrors "errors"
+	"testing"
+	"time"
+
+	"gpt-load/internal/errors"
+	"gpt-load/pkg/types"
+)
+
+func TestKeyRateLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		rpm       int
+		keys      int
+		wantTaken int // Keys handed out before every key is at its limit, -1 when never limited
+	}{
+		{name: "two per key", rpm: 2, keys: 2, wantTaken: 4},
+		{name: "one per key", rpm: 1, keys: 3, wantTaken: 3},
+		{name: "unlimited", rpm: 0, keys: 2, wantTaken: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			km := newTestManager(t, types.KeysConfig{KeyRateLimitRPM: tt.rpm}, testKeys(tt.keys)...)
+			perKey := map[string]int{}
+			var err error
+			for i := 0; i < 20; i++ {
+				var keyInfo *types.KeyInfo
+				if keyInfo, err = km.GetNextKey(); err != nil {
+					break
+				}
+				perKey[keyInfo.Key]++
+				keyInfo.Release()
+			}
+			if tt.wantTaken < 0 {
+				if err != nil {
+					t.Fatalf("GetNextKey without a rate limit: %v", err)
+				}
+				return
+			}
+
+			// Limited keys are skipped, so each one is used up before the request fails
+			taken := 0
+			for key, n := range perKey {
+				if n != tt.rpm {
+					t.Errorf("key %s handed out %d times, want %d", key, n, tt.rpm)
+				}
+				taken += n
+			}
+			if taken != tt.wantTaken || len(perKey) != tt.keys {
+				t.Errorf("handed out %d keys over %d keys, want %d over %d", taken, len(perKey), tt.wantTaken, tt.keys)
+			}
+			var retryAfterErr *errors.RetryAfterError
+			if !stderrors.As(err, &retryAfterErr) || !stderrors.Is(err, errors.ErrAllAPIKeysRateLimited) {
+				t.Fatalf("GetNextKey error = %v, want a RetryAfterError for ErrAllAPIKeysRateLimited", err)
+			}
+			if interval := time.Minute / time.Duration(tt.rpm); retryAfterErr.RetryAfter <= 0 || retryAfterErr.RetryAfter > interval {
+				t.Errorf("retry after %v, want up to one refill of %v", retryAfterErr.RetryAfter, interval)
+			}
+		})
+	}
+}
+
+func BenchmarkGetNextKeyRateLimited(b *testing.B) {
+	km := &Manager{config: types.KeysConfig{MaxKeyCount: 1000, BlacklistThreshold: 1, KeyRateLimitRPM: 1 << 30}}
+	keys, previews, err := km.buildKeys(testKeys(10))
+	if err != nil {
+		b.Fatal(err)
+	}
+	km.swapKeys(keys, previews)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			keyInfo, err := km.GetNextKey()
+			if err != nil {
+				b.Error(err)
+				return
+			}
+			keyInfo.Release()
+		}
+	})
+}
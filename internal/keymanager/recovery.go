@@ -0,0 +1,89 @@
+package keymanager
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gpt-load/internal/redact"
+	"gpt-load/pkg/types"
+
+	"github.com/sirupsen/logrus"
+)
+
+// recoveryProbe checks a blacklisted key against the upstream before it is
+// re-admitted, set only when BLACKLIST_PROBE_ENABLED is on
+type recoveryProbe struct {
+	prober  types.KeyProber
+	timeout time.Duration
+
+	// Keys with a probe in flight
+	probing sync.Map
+}
+
+// EnableRecoveryProbe makes blacklist recovery probe each key against the
+// upstream before re-admitting it
+func (km *Manager) EnableRecoveryProbe(prober types.KeyProber) {
+	km.recoveryProbe.Store(&recoveryProbe{
+		prober:  prober,
+		timeout: time.Duration(km.config.KeyProbeTimeoutMs) * time.Millisecond,
+	})
+}
+
+// isBlacklisted reports whether a key is blacklisted. Once BLACKLIST_RECOVERY_AFTER_SECONDS
+// has passed since the key was blacklisted it is re-admitted, right away or
+// after a successful probe.
+func (km *Manager) isBlacklisted(key string) bool {
+	value, blacklisted := km.blacklistedKeys.Load(key)
+	if !blacklisted {
+		return false
+	}
+	if km.config.BlacklistRecoverySeconds <= 0 {
+		return true
+	}
+
+	blacklistedAt := value.(time.Time)
+	if time.Since(blacklistedAt) < time.Duration(km.config.BlacklistRecoverySeconds)*time.Second {
+		return true
+	}
+
+	if probe := km.recoveryProbe.Load(); probe != nil {
+		// Keep skipping the key until the probe has passed
+		if _, running := probe.probing.LoadOrStore(key, struct{}{}); !running {
+			go km.probeBlacklistedKey(probe, key, blacklistedAt)
+		}
+		return true
+	}
+
+	km.recoverBlacklistedKey(key, blacklistedAt)
+	return false
+}
+
+// probeBlacklistedKey re-admits a key whose probe succeeds, otherwise it
+// stays blacklisted for another recovery period
+func (km *Manager) probeBlacklistedKey(probe *recoveryProbe, key string, blacklistedAt time.Time) {
+	defer probe.probing.Delete(key)
+
+	if probeKey(context.Background(), probe.prober, probe.timeout, key) == probeWorking {
+		km.recoverBlacklistedKey(key, blacklistedAt)
+		return
+	}
+
+	if km.blacklistedKeys.CompareAndSwap(key, blacklistedAt, time.Now()) {
+		km.persistKey(key)
+		logrus.Debugf("Key %s failed its recovery probe, keeping it blacklisted", redact.MaskKey(key))
+	}
+}
+
+// recoverBlacklistedKey removes a key from the blacklist, unless it was
+// blacklisted again or recovered elsewhere in the meantime
+func (km *Manager) recoverBlacklistedKey(key string, blacklistedAt time.Time) {
+	if !km.blacklistedKeys.CompareAndDelete(key, blacklistedAt) {
+		return
+	}
+	atomic.AddInt64(&km.blacklistedCount, -1)
+	km.keyFailureCounts.Delete(key)
+	km.persistKey(key)
+	logrus.Infof("Key %s recovered from blacklist after %v", redact.MaskKey(key), time.Since(blacklistedAt).Round(time.Second))
+}
@@ -0,0 +1,134 @@
+package keymanager
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"gpt-load/pkg/types"
+)
+
+// errServerError is a failure that blacklists keys at the test threshold of one
+var errServerError = errors.New("upstream returned 500")
+
+// backdateBlacklist moves the time a key was blacklisted into the past, as if
+// the clock had advanced by age
+func backdateBlacklist(t *testing.T, km *Manager, key string, age time.Duration) {
+	t.Helper()
+	if _, blacklisted := km.blacklistedKeys.Load(key); !blacklisted {
+		t.Fatalf("key %s is not blacklisted", key)
+	}
+	km.blacklistedKeys.Store(key, time.Now().Add(-age))
+}
+
+// selects reports whether GetNextKey hands out key within one pass over the pool
+func selects(t *testing.T, km *Manager, key string) bool {
+	t.Helper()
+	for i := 0; i < km.GetCapacity().Total; i++ {
+		keyInfo, err := km.GetNextKey()
+		if err != nil {
+			t.Fatalf("GetNextKey: %v", err)
+		}
+		keyInfo.Release()
+		if keyInfo.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func TestBlacklistRecovery(t *testing.T) {
+	const recovered, healthy = "sk-test-0000", "sk-test-0001"
+	tests := []struct {
+		name            string
+		recoverySeconds int
+		probeStatus     int // Status the recovery probe gets for the key, no probe when 0
+		age             time.Duration
+		wantSelected    bool
+	}{
+		{name: "recovery disabled", age: time.Hour},
+		{name: "before the recovery period", recoverySeconds: 60, age: 30 * time.Second},
+		{name: "after the recovery period", recoverySeconds: 60, age: 61 * time.Second, wantSelected: true},
+		{name: "probe passes", recoverySeconds: 60, probeStatus: http.StatusOK, age: 61 * time.Second, wantSelected: true},
+		{name: "probe fails", recoverySeconds: 60, probeStatus: http.StatusUnauthorized, age: 61 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			km := newTestManager(t, types.KeysConfig{BlacklistRecoverySeconds: tt.recoverySeconds, KeyProbeTimeoutMs: 1000}, recovered, healthy)
+			// The probe answers once the test has checked the key is skipped meanwhile
+			gate := make(chan struct{})
+			if tt.probeStatus != 0 {
+				prober := stubProber(map[string]int{recovered: tt.probeStatus})
+				km.EnableRecoveryProbe(func(ctx context.Context, key string) (*http.Response, error) {
+					<-gate
+					return prober(ctx, key)
+				})
+			}
+			km.RecordFailure(recovered, errServerError)
+			if selects(t, km, recovered) {
+				t.Fatal("freshly blacklisted key was selected")
+			}
+
+			backdateBlacklist(t, km, recovered, tt.age)
+			if tt.probeStatus != 0 {
+				// The probe runs in the background, the key is skipped until it passes
+				if selects(t, km, recovered) {
+					t.Fatal("key was selected before its recovery probe finished")
+				}
+				close(gate)
+				probe := km.recoveryProbe.Load()
+				deadline := time.Now().Add(2 * time.Second)
+				for {
+					if _, running := probe.probing.Load(recovered); !running || time.Now().After(deadline) {
+						break
+					}
+					time.Sleep(time.Millisecond)
+				}
+			}
+
+			if got := selects(t, km, recovered); got != tt.wantSelected {
+				t.Fatalf("key selected = %v, want %v", got, tt.wantSelected)
+			}
+			wantBlacklisted := 1
+			if tt.wantSelected {
+				wantBlacklisted = 0
+			}
+			if stats := km.GetStats(); stats.BlacklistedKeys != wantBlacklisted {
+				t.Errorf("%d blacklisted keys, want %d", stats.BlacklistedKeys, wantBlacklisted)
+			}
+			if tt.wantSelected {
+				if _, counted := km.keyFailureCounts.Load(recovered); counted {
+					t.Error("recovered key kept its failure count")
+				}
+			}
+		})
+	}
+}
+
+func TestBlacklistRecoveryAfterFailedProbe(t *testing.T) {
+	const key = "sk-test-0000"
+	km := newTestManager(t, types.KeysConfig{BlacklistRecoverySeconds: 60, KeyProbeTimeoutMs: 1000}, key, "sk-test-0001")
+	statuses := map[string]int{key: http.StatusUnauthorized}
+	km.EnableRecoveryProbe(stubProber(statuses))
+	km.RecordFailure(key, errServerError)
+
+	// A failed probe restarts the recovery period
+	backdateBlacklist(t, km, key, 61*time.Second)
+	km.isBlacklisted(key)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		value, _ := km.blacklistedKeys.Load(key)
+		if time.Since(value.(time.Time)) < time.Second {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("failed probe did not restart the recovery period")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if !km.isBlacklisted(key) {
+		t.Fatal("key recovered right after a failed probe")
+	}
+}
@@ -0,0 +1,91 @@
+package keymanager
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"gpt-load/pkg/types"
+
+	"github.com/sirupsen/logrus"
+)
+
+// keyUsage counts the use of one key since the last stats reset. It is updated
+// from concurrent requests without locking.
+type keyUsage struct {
+	successes    atomic.Int64
+	errors       atomic.Int64
+	blacklists   atomic.Int64
+	lastUsed     atomic.Int64 // UnixNano, 0 when never used
+	latencyTotal atomic.Int64 // Nanoseconds over latencyCount requests
+	latencyCount atomic.Int64
+}
+
+// usageOf returns the usage counters of key, creating them on first use
+func (km *Manager) usageOf(key string) *keyUsage {
+	if usage, ok := km.keyUsage.Load(key); ok {
+		return usage.(*keyUsage)
+	}
+	usage, _ := km.keyUsage.LoadOrStore(key, &keyUsage{})
+	return usage.(*keyUsage)
+}
+
+// recordUsage counts a finished request of key
+func (km *Manager) recordUsage(key string, success bool) {
+	usage := km.usageOf(key)
+	if success {
+		usage.successes.Add(1)
+	} else {
+		usage.errors.Add(1)
+	}
+	usage.lastUsed.Store(time.Now().UnixNano())
+}
+
+// RecordLatency adds the time the upstream took to answer a request made with key
+func (km *Manager) RecordLatency(key string, latency time.Duration) {
+	usage := km.usageOf(key)
+	usage.latencyTotal.Add(int64(latency))
+	usage.latencyCount.Add(1)
+}
+
+// KeyUsage returns the usage of every key in the pool since the last stats reset
+func (km *Manager) KeyUsage() []types.KeyUsage {
+	km.keysMutex.RLock()
+	defer km.keysMutex.RUnlock()
+
+	stats := make([]types.KeyUsage, 0, len(km.keys))
+	for i, key := range km.keys {
+		stat := types.KeyUsage{
+			ID:      keyID(key),
+			Preview: km.keyPreviews[i],
+		}
+		if value, ok := km.keyUsage.Load(key); ok {
+			usage := value.(*keyUsage)
+			stat.Successes = usage.successes.Load()
+			stat.Errors = usage.errors.Load()
+			stat.Requests = stat.Successes + stat.Errors
+			stat.Blacklists = usage.blacklists.Load()
+			if lastUsed := usage.lastUsed.Load(); lastUsed > 0 {
+				at := time.Unix(0, lastUsed)
+				stat.LastUsed = &at
+			}
+			if count := usage.latencyCount.Load(); count > 0 {
+				stat.AvgLatencyMs = float64(usage.latencyTotal.Load()) / float64(count) / float64(time.Millisecond)
+			}
+		}
+		stats = append(stats, stat)
+	}
+	return stats
+}
+
+// setupUsageReset starts a new stats window every STATS_RESET_INTERVAL_HOURS
+func (km *Manager) setupUsageReset(scheduler types.Scheduler) error {
+	interval := time.Duration(km.config.StatsResetIntervalHours) * time.Hour
+	return scheduler.AddTask("key-usage-reset", interval, func(ctx context.Context) {
+		km.keyUsage.Range(func(key, _ any) bool {
+			km.keyUsage.Delete(key)
+			return true
+		})
+		logrus.Debug("Key usage statistics reset")
+	})
+}
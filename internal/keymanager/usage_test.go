@@ -0,0 +1,122 @@
+package keymanager
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gpt-load/pkg/types"
+)
+
+func TestKeyUsage(t *testing.T) {
+	const alpha, bravo = "sk-usage-alpha", "sk-usage-bravo"
+	upstreamErr := errors.New("upstream returned 500")
+	success := func(key string) func(*Manager) { return func(km *Manager) { km.RecordSuccess(key) } }
+	failure := func(key string) func(*Manager) { return func(km *Manager) { km.RecordFailure(key, upstreamErr) } }
+	latency := func(key string, d time.Duration) func(*Manager) {
+		return func(km *Manager) { km.RecordLatency(key, d) }
+	}
+	recoverKey := func(key string) func(*Manager) { return func(km *Manager) { km.RecoverKey(keyID(key)) } }
+
+	tests := []struct {
+		name  string
+		steps []func(*Manager)
+		want  map[string]types.KeyUsage // Counters expected per key, alpha and bravo always listed
+	}{
+		{name: "unused pool", want: map[string]types.KeyUsage{alpha: {}, bravo: {}}},
+		{
+			name:  "successes and failures below the threshold",
+			steps: []func(*Manager){success(alpha), failure(alpha), success(alpha), success(bravo), failure(alpha), success(alpha)},
+			want: map[string]types.KeyUsage{
+				alpha: {Requests: 5, Successes: 3, Errors: 2},
+				bravo: {Requests: 1, Successes: 1},
+			},
+		},
+		{
+			name:  "failures reaching the threshold",
+			steps: []func(*Manager){failure(bravo), failure(bravo), failure(bravo)},
+			want: map[string]types.KeyUsage{
+				alpha: {},
+				bravo: {Requests: 3, Errors: 3, Blacklists: 1},
+			},
+		},
+		{
+			name:  "blacklisted again after recovery",
+			steps: []func(*Manager){failure(alpha), failure(alpha), failure(alpha), recoverKey(alpha), success(alpha), func(km *Manager) { km.BlacklistKey(alpha) }},
+			want: map[string]types.KeyUsage{
+				alpha: {Requests: 5, Successes: 1, Errors: 4, Blacklists: 2},
+				bravo: {},
+			},
+		},
+		{
+			name:  "average latency",
+			steps: []func(*Manager){latency(alpha, 100*time.Millisecond), success(alpha), latency(alpha, 300*time.Millisecond), success(alpha), latency(bravo, 50*time.Millisecond), failure(bravo)},
+			want: map[string]types.KeyUsage{
+				alpha: {Requests: 2, Successes: 2, AvgLatencyMs: 200},
+				bravo: {Requests: 1, Errors: 1, AvgLatencyMs: 50},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			km := newTestManager(t, types.KeysConfig{BlacklistThreshold: 3}, alpha, bravo)
+			start := time.Now()
+			for _, step := range tt.steps {
+				step(km)
+			}
+
+			stats := km.KeyUsage()
+			if len(stats) != 2 {
+				t.Fatalf("KeyUsage() listed %d keys, want 2", len(stats))
+			}
+			for i, key := range []string{alpha, bravo} {
+				got, want := stats[i], tt.want[key]
+				if got.ID != keyID(key) || got.Preview != km.keyPreviews[i] {
+					t.Errorf("entry %d = %s %s, want %s", i, got.ID, got.Preview, keyID(key))
+				}
+				if got.Requests != want.Requests || got.Successes != want.Successes || got.Errors != want.Errors || got.Blacklists != want.Blacklists {
+					t.Errorf("%s requests/successes/errors/blacklists = %d/%d/%d/%d, want %d/%d/%d/%d", key,
+						got.Requests, got.Successes, got.Errors, got.Blacklists, want.Requests, want.Successes, want.Errors, want.Blacklists)
+				}
+				if got.AvgLatencyMs != want.AvgLatencyMs {
+					t.Errorf("%s average latency = %vms, want %vms", key, got.AvgLatencyMs, want.AvgLatencyMs)
+				}
+				// Only finished requests count as use
+				if used := want.Requests > 0; (got.LastUsed != nil) != used {
+					t.Errorf("%s last used = %v, want set = %t", key, got.LastUsed, used)
+				} else if used && (got.LastUsed.Before(start) || got.LastUsed.After(time.Now())) {
+					t.Errorf("%s last used = %v, outside the test", key, got.LastUsed)
+				}
+			}
+		})
+	}
+}
+
+func TestKeyUsageReset(t *testing.T) {
+	km := newTestManager(t, types.KeysConfig{StatsResetIntervalHours: 6}, "sk-usage-alpha")
+	scheduler := newTaskRecorder()
+	if err := km.setupUsageReset(scheduler); err != nil {
+		t.Fatalf("setupUsageReset: %v", err)
+	}
+	if got := scheduler.intervals["key-usage-reset"]; got != 6*time.Hour {
+		t.Fatalf("reset interval = %v, want 6h", got)
+	}
+
+	km.RecordLatency("sk-usage-alpha", time.Second)
+	km.RecordSuccess("sk-usage-alpha")
+	km.BlacklistKey("sk-usage-alpha")
+	if got := km.KeyUsage()[0]; got.Requests != 2 || got.Blacklists != 1 {
+		t.Fatalf("before reset = %+v, want 2 requests and 1 blacklist", got)
+	}
+
+	scheduler.tasks["key-usage-reset"](context.Background())
+	if got := km.KeyUsage()[0]; got.Requests != 0 || got.Successes != 0 || got.Errors != 0 || got.Blacklists != 0 || got.AvgLatencyMs != 0 || got.LastUsed != nil {
+		t.Errorf("after reset = %+v, want a fresh window", got)
+	}
+	// The new window counts from zero
+	km.RecordFailure("sk-usage-alpha", errors.New("upstream returned 500"))
+	if got := km.KeyUsage()[0]; got.Requests != 1 || got.Errors != 1 {
+		t.Errorf("after the next request = %+v, want 1 error", got)
+	}
+}
@@ -0,0 +1,143 @@
+package keymanager
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"gpt-load/internal/redact"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// webhookQueueSize bounds the pending notifications, events beyond it are dropped
+	webhookQueueSize = 256
+
+	// webhookSignatureHeader carries the hex HMAC-SHA256 of the body
+	webhookSignatureHeader = "X-Signature"
+)
+
+// blacklistEvent is the payload posted to BLACKLIST_WEBHOOK_URL
+type blacklistEvent struct {
+	KeyID    string    `json:"key_id"`
+	FailedAt time.Time `json:"failed_at"`
+	Error    string    `json:"error"`
+}
+
+// blacklistNotifier posts blacklist events on a single goroutine, so
+// blacklisting a key only ever enqueues an event
+type blacklistNotifier struct {
+	url        string
+	secret     string
+	httpClient *http.Client
+	events     chan blacklistEvent
+	done       chan struct{}
+
+	// Guards sending on events against close
+	mu     sync.RWMutex
+	closed bool
+}
+
+// newBlacklistNotifier creates a notifier and starts its sender
+func newBlacklistNotifier(webhookURL, secret string) *blacklistNotifier {
+	n := &blacklistNotifier{
+		url:        webhookURL,
+		secret:     secret,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		events:     make(chan blacklistEvent, webhookQueueSize),
+		done:       make(chan struct{}),
+	}
+	go n.run()
+	return n
+}
+
+// notify queues an event for a newly blacklisted key without blocking the caller
+func (n *blacklistNotifier) notify(key, reason string, failedAt time.Time) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	if n.closed {
+		return
+	}
+	// The webhook leaves the process, so the key is masked even when LOG_MASK_KEYS is off
+	event := blacklistEvent{KeyID: redact.MaskKeyAlways(key), FailedAt: failedAt, Error: reason}
+	select {
+	case n.events <- event:
+	default:
+		logrus.Warn("Blacklist webhook queue is full, dropping notification")
+	}
+}
+
+// run sends queued events until the queue is closed
+func (n *blacklistNotifier) run() {
+	defer close(n.done)
+
+	for event := range n.events {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := n.send(ctx, event); err != nil {
+			logrus.Warnf("Failed to send blacklist webhook for key %s: %v", event.KeyID, err)
+		}
+		cancel()
+	}
+}
+
+// send posts a single signed event
+func (n *blacklistNotifier) send(ctx context.Context, event blacklistEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.secret != "" {
+		mac := hmac.New(sha256.New, []byte(n.secret))
+		mac.Write(body)
+		req.Header.Set(webhookSignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		// Leave the URL out of the error, it may carry credentials
+		var urlErr *url.Error
+		if stderrors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// close flushes the queued events
+func (n *blacklistNotifier) close() {
+	n.mu.Lock()
+	n.closed = true
+	close(n.events)
+	n.mu.Unlock()
+
+	select {
+	case <-n.done:
+	case <-time.After(5 * time.Second):
+		logrus.Warn("Timed out flushing blacklist webhook notifications")
+	}
+}
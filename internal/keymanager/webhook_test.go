@@ -0,0 +1,143 @@
+package keymanager
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gpt-load/internal/redact"
+	"gpt-load/pkg/types"
+)
+
+// receivedWebhook is a webhook request captured by the test receiver
+type receivedWebhook struct {
+	body      []byte
+	signature string
+}
+
+// newWebhookReceiver starts a server recording the webhooks posted to it
+func newWebhookReceiver(t *testing.T) (*httptest.Server, func() []receivedWebhook) {
+	t.Helper()
+	var mu sync.Mutex
+	var received []receivedWebhook
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, receivedWebhook{body: body, signature: r.Header.Get(webhookSignatureHeader)})
+		mu.Unlock()
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []receivedWebhook {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]receivedWebhook(nil), received...)
+	}
+}
+
+func TestBlacklistWebhook(t *testing.T) {
+	const key = "sk-webhook-secret-1234"
+	tests := []struct {
+		name      string
+		secret    string
+		blacklist func(km *Manager)
+		wantError string
+		wantCount int
+	}{
+		{
+			name:      "failure threshold",
+			secret:    "hook-secret",
+			blacklist: func(km *Manager) { km.RecordFailure(key, errServerError) },
+			wantError: "upstream returned 500",
+			wantCount: 1,
+		},
+		{
+			name:   "already blacklisted",
+			secret: "hook-secret",
+			blacklist: func(km *Manager) {
+				km.RecordFailure(key, errServerError)
+				km.BlacklistKey(key)
+				km.RecordFailure(key, errServerError)
+			},
+			wantError: "upstream returned 500",
+			wantCount: 1,
+		},
+		{name: "unsigned", blacklist: func(km *Manager) { km.RecordFailure(key, errServerError) }, wantError: "upstream returned 500", wantCount: 1},
+		{name: "not blacklisted", blacklist: func(km *Manager) { km.RecordSuccess(key) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, received := newWebhookReceiver(t)
+			km := newTestManager(t, types.KeysConfig{}, key, "sk-webhook-other-5678")
+			km.notifier = newBlacklistNotifier(server.URL+"/hooks", tt.secret)
+			before := time.Now()
+			tt.blacklist(km)
+			km.notifier.close()
+
+			webhooks := received()
+			if len(webhooks) != tt.wantCount {
+				t.Fatalf("received %d webhooks, want %d", len(webhooks), tt.wantCount)
+			}
+			for _, webhook := range webhooks {
+				var event struct {
+					KeyID    string    `json:"key_id"`
+					FailedAt time.Time `json:"failed_at"`
+					Error    string    `json:"error"`
+				}
+				if err := json.Unmarshal(webhook.body, &event); err != nil {
+					t.Fatalf("invalid payload %s: %v", webhook.body, err)
+				}
+				if event.KeyID != redact.MaskKeyAlways(key) || strings.Contains(string(webhook.body), key) {
+					t.Errorf("payload %s, want the masked key %s only", webhook.body, redact.MaskKeyAlways(key))
+				}
+				if event.Error != tt.wantError || event.FailedAt.Before(before.Truncate(time.Second)) || event.FailedAt.After(time.Now()) {
+					t.Errorf("payload %s, want error %q failed during the test", webhook.body, tt.wantError)
+				}
+
+				if tt.secret == "" {
+					if webhook.signature != "" {
+						t.Errorf("unsigned webhook carries signature %q", webhook.signature)
+					}
+					continue
+				}
+				mac := hmac.New(sha256.New, []byte(tt.secret))
+				mac.Write(webhook.body)
+				if want := hex.EncodeToString(mac.Sum(nil)); webhook.signature != want {
+					t.Errorf("signature = %q, want %q", webhook.signature, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBlacklistWebhookNeverBlocks(t *testing.T) {
+	// The receiver never answers, so the sender is stuck on the first event
+	stuck := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-stuck
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(stuck) })
+
+	keys := testKeys(webhookQueueSize * 2)
+	km := newTestManager(t, types.KeysConfig{}, keys...)
+	km.notifier = newBlacklistNotifier(server.URL, "hook-secret")
+
+	start := time.Now()
+	for _, key := range keys {
+		km.BlacklistKey(key)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("blacklisting %d keys took %v with a stuck webhook", len(keys), elapsed)
+	}
+	if stats := km.GetStats(); stats.BlacklistedKeys != len(keys) {
+		t.Errorf("%d keys blacklisted, want %d", stats.BlacklistedKeys, len(keys))
+	}
+}
@@ -0,0 +1,158 @@
+// Package metrics defines Prometheus instrumentation for the proxy
+package metrics
+
+import (
+	"net/http"
+
+	"gpt-load/pkg/types"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// RequestsTotal counts upstream attempts by upstream and status code, "error" when no response arrived
+	RequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gptload_requests_total",
+		Help: "Upstream request attempts, by upstream and response status code",
+	}, []string{"upstream", "status_code", "cost_center"})
+
+	// RequestDuration observes how long upstream attempts take to return response headers
+	RequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gptload_request_duration_seconds",
+		Help:    "Time until the upstream returned response headers",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"upstream", "cost_center"})
+
+	// UpstreamHealth reports the active health check result per upstream, 1 healthy and 0 degraded
+	UpstreamHealth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gptload_upstream_health",
+		Help: "Upstream health as seen by active health checks (1 healthy, 0 degraded)",
+	}, []string{"url"})
+
+	// UpstreamConnectRateLimited counts connection attempts rejected by the per-upstream connect limiter
+	UpstreamConnectRateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gptload_upstream_connect_rate_limited_total",
+		Help: "Upstream connection attempts rejected by the connect rate limiter",
+	}, []string{"upstream", "cost_center"})
+
+	// SingleflightCoalesced counts requests answered with another identical request's response
+	SingleflightCoalesced = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gptload_singleflight_coalesced_total",
+		Help: "Requests coalesced into an identical in-flight upstream request",
+	}, []string{"cost_center"})
+
+	// FallbackRequests counts requests served by the primary upstreams versus the local fallback
+	FallbackRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gptload_fallback_requests_total",
+		Help: "Requests served, by primary upstreams or the fallback upstream",
+	}, []string{"served_by", "cost_center"})
+
+	// SSELimitExceeded counts streaming responses cut off by MAX_SSE_EVENTS_PER_RESPONSE
+	SSELimitExceeded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gptload_sse_limit_exceeded_total",
+		Help: "Streaming responses closed after reaching the SSE event limit",
+	}, []string{"cost_center"})
+
+	// CacheRequests counts response cache lookups, by hit or miss
+	CacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gptload_cache_requests_total",
+		Help: "Response cache lookups, by whether the response was served from the cache",
+	}, []string{"result", "cost_center"})
+
+	// UpstreamGroupRequests counts upstream attempts per A/B upstream group
+	UpstreamGroupRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gptload_upstream_group_requests_total",
+		Help: "Upstream request attempts, by A/B upstream group",
+	}, []string{"group", "cost_center"})
+
+	// BroadcastRequests counts requests fanned out to every upstream, by outcome
+	BroadcastRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gptload_broadcast_requests_total",
+		Help: "Requests broadcast to all upstreams, by whether any upstream succeeded",
+	}, []string{"result", "cost_center"})
+)
+
+// RegisterKeyCooldownActive exposes the number of keys cooling down after a 429, read on every scrape
+func RegisterKeyCooldownActive(count func() int) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "gptload_key_cooldown_active",
+		Help: "Keys temporarily skipped after returning HTTP 429",
+	}, func() float64 { return float64(count()) })
+}
+
+// RegisterKeyPool exposes the active and blacklisted key counts, read on every scrape
+func RegisterKeyPool(active, blacklisted func() int) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "gptload_keys_active",
+		Help: "Keys available for selection",
+	}, func() float64 { return float64(active()) })
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "gptload_keys_blacklisted",
+		Help: "Keys currently blacklisted",
+	}, func() float64 { return float64(blacklisted()) })
+}
+
+// RegisterRequestQueueDepth exposes the number of requests waiting for a concurrency slot, read on every scrape
+func RegisterRequestQueueDepth(depth func() int) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "gptload_request_queue_depth",
+		Help: "Requests queued waiting for a MAX_CONCURRENT_REQUESTS slot",
+	}, func() float64 { return float64(depth()) })
+}
+
+// keyUsageCollector reports the usage of every key, read on every scrape. The values
+// cover the current stats window, so they are gauges rather than counters.
+type keyUsageCollector struct {
+	usage      func() []types.KeyUsage
+	requests   *prometheus.Desc
+	successes  *prometheus.Desc
+	errors     *prometheus.Desc
+	blacklists *prometheus.Desc
+	latency    *prometheus.Desc
+	lastUsed   *prometheus.Desc
+}
+
+// RegisterKeyUsage exposes per-key usage statistics, labelled by key ID
+func RegisterKeyUsage(usage func() []types.KeyUsage) {
+	labels := []string{"key_id"}
+	prometheus.MustRegister(&keyUsageCollector{
+		usage:      usage,
+		requests:   prometheus.NewDesc("gptload_key_requests", "Requests finished with the key in the current stats window", labels, nil),
+		successes:  prometheus.NewDesc("gptload_key_successes", "Successful requests with the key in the current stats window", labels, nil),
+		errors:     prometheus.NewDesc("gptload_key_errors", "Failed requests with the key in the current stats window", labels, nil),
+		blacklists: prometheus.NewDesc("gptload_key_blacklists", "Times the key was blacklisted in the current stats window", labels, nil),
+		latency:    prometheus.NewDesc("gptload_key_latency_avg_seconds", "Average time until the upstream answered requests with the key", labels, nil),
+		lastUsed:   prometheus.NewDesc("gptload_key_last_used_timestamp_seconds", "Unix time the key last finished a request", labels, nil),
+	})
+}
+
+// Describe sends the descriptors of the per-key metrics
+func (kc *keyUsageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- kc.requests
+	ch <- kc.successes
+	ch <- kc.errors
+	ch <- kc.blacklists
+	ch <- kc.latency
+	ch <- kc.lastUsed
+}
+
+// Collect sends the current usage of every key
+func (kc *keyUsageCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, key := range kc.usage() {
+		ch <- prometheus.MustNewConstMetric(kc.requests, prometheus.GaugeValue, float64(key.Requests), key.ID)
+		ch <- prometheus.MustNewConstMetric(kc.successes, prometheus.GaugeValue, float64(key.Successes), key.ID)
+		ch <- prometheus.MustNewConstMetric(kc.errors, prometheus.GaugeValue, float64(key.Errors), key.ID)
+		ch <- prometheus.MustNewConstMetric(kc.blacklists, prometheus.GaugeValue, float64(key.Blacklists), key.ID)
+		ch <- prometheus.MustNewConstMetric(kc.latency, prometheus.GaugeValue, key.AvgLatencyMs/1000, key.ID)
+		if key.LastUsed != nil {
+			ch <- prometheus.MustNewConstMetric(kc.lastUsed, prometheus.GaugeValue, float64(key.LastUsed.Unix()), key.ID)
+		}
+	}
+}
+
+// Handler serves all registered metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
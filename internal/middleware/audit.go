@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"gpt-load/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// auditRedactedHeaders lists headers whose values never appear in audit records
+var auditRedactedHeaders = map[string]bool{
+	"Authorization": true,
+	"X-Api-Key":     true,
+	"Cookie":        true,
+}
+
+// Audit creates a middleware that emits an audit record for every request.
+// With CLONE_REQUEST_FOR_AUDIT the record describes a copy of the request taken
+// before any handler runs, otherwise it is rebuilt from the processed request.
+func Audit(config types.LogConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		var clone *http.Request
+		if config.CloneRequestForAudit {
+			var err error
+			if clone, err = cloneRequest(c.Request); err != nil {
+				GetLogger(c).Errorf("Failed to clone request for audit: %v", err)
+			}
+		}
+
+		c.Next()
+
+		// The startup self-test is not caller traffic
+		if IsSelfTest(c) {
+			return
+		}
+
+		fields := logrus.Fields{
+			"status":    c.Writer.Status(),
+			"latency":   time.Since(start).String(),
+			"client_ip": c.ClientIP(),
+		}
+		if subject := c.GetString("authSubject"); subject != "" {
+			fields["subject"] = subject
+		}
+
+		log := GetLogger(c)
+		if clone != nil {
+			go writeClonedAuditRecord(log, fields, clone)
+			return
+		}
+
+		fields["method"] = c.Request.Method
+		fields["path"] = c.Request.URL.Path
+		if model := c.GetString("model"); model != "" {
+			fields["model"] = model
+		}
+		go log.WithFields(fields).Info("audit")
+	}
+}
+
+// cloneRequest copies a request with its own buffered body, restoring the original body
+func cloneRequest(req *http.Request) (*http.Request, error) {
+	clone := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return clone, nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	clone.Body = io.NopCloser(bytes.NewReader(body))
+	return clone, nil
+}
+
+// writeClonedAuditRecord logs the request exactly as it was received
+func writeClonedAuditRecord(log *logrus.Entry, fields logrus.Fields, clone *http.Request) {
+	fields["method"] = clone.Method
+	fields["path"] = clone.URL.Path
+	if clone.URL.RawQuery != "" {
+		fields["query"] = clone.URL.RawQuery
+	}
+
+	headers := make(map[string]string, len(clone.Header))
+	for name := range clone.Header {
+		if auditRedactedHeaders[name] {
+			headers[name] = "[REDACTED]"
+		} else {
+			headers[name] = clone.Header.Get(name)
+		}
+	}
+	fields["headers"] = headers
+
+	if clone.Body != nil {
+		body, err := io.ReadAll(clone.Body)
+		if err == nil && len(body) > 0 {
+			digest := sha256.Sum256(body)
+			fields["body_size"] = len(body)
+			fields["body_sha256"] = hex.EncodeToString(digest[:])
+		}
+	}
+
+	log.WithFields(fields).Info("audit")
+}
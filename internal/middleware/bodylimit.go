@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	stderrors "errors"
+	"fmt"
+	"net/http"
+
+	"gpt-load/internal/apierror"
+	"gpt-load/internal/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestBodyLimit creates a middleware that caps request bodies at maxBytes.
+// A larger Content-Length is rejected up front, other bodies fail to read
+// once they pass the limit.
+func RequestBodyLimit(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > maxBytes {
+			RespondBodyTooLarge(c, maxBytes)
+			c.Abort()
+			return
+		}
+		if c.Request.Body != nil {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		}
+		c.Next()
+	}
+}
+
+// IsBodyTooLarge reports whether err comes from reading past the request body limit
+func IsBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return stderrors.As(err, &maxBytesErr)
+}
+
+// RespondBodyTooLarge writes a 413 in the OpenAI error schema
+func RespondBodyTooLarge(c *gin.Context, maxBytes int64) {
+	GetLogger(c).Warnf("Request body from %s to %s exceeds %d bytes", c.ClientIP(), c.Request.URL.Path, maxBytes)
+	RespondError(c, apierror.New(http.StatusRequestEntityTooLarge, errors.ErrRequestTooLarge,
+		fmt.Sprintf("Request body exceeds the maximum size of %d bytes", maxBytes)))
+}
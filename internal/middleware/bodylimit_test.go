@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestBodyLimit(t *testing.T) {
+	const limit = 1024
+	tests := []struct {
+		name     string
+		size     int
+		chunked  bool // Send the body without a Content-Length
+		want     int
+		wantRead bool // Whether the handler read the whole body
+	}{
+		{name: "under the limit", size: limit - 1, want: http.StatusOK, wantRead: true},
+		{name: "exactly the limit", size: limit, want: http.StatusOK, wantRead: true},
+		{name: "one byte over", size: limit + 1, want: http.StatusRequestEntityTooLarge},
+		{name: "far over", size: 10 * limit, want: http.StatusRequestEntityTooLarge},
+		{name: "chunked under the limit", size: limit - 1, chunked: true, want: http.StatusOK, wantRead: true},
+		{name: "chunked exactly the limit", size: limit, chunked: true, want: http.StatusOK, wantRead: true},
+		{name: "chunked one byte over", size: limit + 1, chunked: true, want: http.StatusRequestEntityTooLarge},
+		{name: "empty", size: 0, want: http.StatusOK, wantRead: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			read := false
+			router := gin.New()
+			router.Use(RequestBodyLimit(limit))
+			router.POST("/v1/chat/completions", func(c *gin.Context) {
+				body, err := io.ReadAll(c.Request.Body)
+				if IsBodyTooLarge(err) {
+					RespondBodyTooLarge(c, limit)
+					return
+				}
+				read = err == nil && len(body) == tt.size
+				c.Status(http.StatusOK)
+			})
+
+			var body io.Reader = strings.NewReader(strings.Repeat("x", tt.size))
+			if tt.chunked {
+				body = io.MultiReader(body) // Hides the length from httptest.NewRequest
+			}
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", body)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.want {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.want)
+			}
+			if read != tt.wantRead {
+				t.Errorf("handler read the body = %v, want %v", read, tt.wantRead)
+			}
+			if tt.want != http.StatusRequestEntityTooLarge {
+				return
+			}
+			var response struct {
+				Error struct {
+					Message string `json:"message"`
+					Type    string `json:"type"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil || !strings.Contains(response.Error.Message, "1024 bytes") || response.Error.Type == "" {
+				t.Errorf("body %s, want an OpenAI error naming the limit", recorder.Body.String())
+			}
+		})
+	}
+}
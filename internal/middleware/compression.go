@@ -0,0 +1,201 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gpt-load/pkg/types"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+// Supported response encodings, in server preference order
+const (
+	encodingBrotli   = "br"
+	encodingGzip     = "gzip"
+	encodingIdentity = ""
+)
+
+// Compression creates a middleware that compresses responses using the best
+// encoding accepted by the client. Responses that already carry a
+// Content-Encoding (e.g. compressed upstream bodies) are passed through.
+func Compression(config types.PerformanceConfig) gin.HandlerFunc {
+	var supported []string
+	if config.EnableBrotli {
+		supported = append(supported, encodingBrotli)
+	}
+	if config.EnableGzip {
+		supported = append(supported, encodingGzip)
+	}
+
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"), supported, config.CompressionPreferClient)
+		writer := &compressWriter{ResponseWriter: c.Writer, encoding: encoding}
+		c.Writer = writer
+		defer writer.close()
+
+		c.Next()
+	}
+}
+
+// acceptedEncoding is a single Accept-Encoding entry
+type acceptedEncoding struct {
+	name    string
+	quality float64
+}
+
+// negotiateEncoding selects a response encoding from the Accept-Encoding header.
+// When preferClient is set the client's q-values decide the order, otherwise the
+// server order (Brotli, gzip) is used for any encoding the client accepts.
+func negotiateEncoding(header string, supported []string, preferClient bool) string {
+	if header == "" || len(supported) == 0 {
+		return encodingIdentity
+	}
+
+	accepted := parseAcceptEncoding(header)
+	qualityOf := func(name string) float64 {
+		if quality, ok := accepted[name]; ok {
+			return quality
+		}
+		if quality, ok := accepted["*"]; ok {
+			return quality
+		}
+		return 0
+	}
+
+	candidates := make([]acceptedEncoding, 0, len(supported))
+	for _, name := range supported {
+		if quality := qualityOf(name); quality > 0 {
+			candidates = append(candidates, acceptedEncoding{name: name, quality: quality})
+		}
+	}
+	if len(candidates) == 0 {
+		return encodingIdentity
+	}
+
+	if preferClient {
+		// Stable sort keeps server preference between equal q-values
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].quality > candidates[j].quality
+		})
+	}
+	return candidates[0].name
+}
+
+// parseAcceptEncoding parses an Accept-Encoding header into encoding -> q-value
+func parseAcceptEncoding(header string) map[string]float64 {
+	accepted := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		quality := 1.0
+		if key, value, found := strings.Cut(strings.TrimSpace(params), "="); found && strings.TrimSpace(key) == "q" {
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				quality = parsed
+			}
+		}
+		accepted[name] = quality
+	}
+	return accepted
+}
+
+// isCompressibleContentType reports whether a content type benefits from compression
+func isCompressibleContentType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	return strings.HasPrefix(mediaType, "text/") ||
+		mediaType == "application/json" ||
+		strings.HasSuffix(mediaType, "+json") ||
+		mediaType == "application/javascript" ||
+		mediaType == "application/xml"
+}
+
+// flushWriter is an encoder that can flush buffered data
+type flushWriter interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// compressWriter compresses the response body once its headers are known
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	encoder  flushWriter
+	decided  bool
+}
+
+// decide chooses whether to compress, based on the headers set by the handler
+func (w *compressWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" || !isCompressibleContentType(header.Get("Content-Type")) {
+		return
+	}
+	header.Add("Vary", "Accept-Encoding")
+
+	status := w.Status()
+	if w.encoding == encodingIdentity || status == http.StatusNoContent || status == http.StatusNotModified {
+		return
+	}
+
+	header.Set("Content-Encoding", w.encoding)
+	header.Del("Content-Length")
+	switch w.encoding {
+	case encodingBrotli:
+		w.encoder = brotli.NewWriter(w.ResponseWriter)
+	case encodingGzip:
+		w.encoder = gzip.NewWriter(w.ResponseWriter)
+	}
+}
+
+// Write compresses data when an encoding was selected
+func (w *compressWriter) Write(data []byte) (int, error) {
+	w.decide()
+	if w.encoder == nil {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.encoder.Write(data)
+}
+
+// WriteString compresses data when an encoding was selected
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Unwrap exposes the client's writer to http.ResponseController
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Flush flushes the encoder before the underlying writer, keeping streams incremental
+func (w *compressWriter) Flush() {
+	if w.encoder != nil {
+		w.encoder.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// close finishes the compressed stream
+func (w *compressWriter) close() {
+	if w.encoder != nil {
+		w.encoder.Close()
+	}
+}
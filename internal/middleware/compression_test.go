@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gpt-load/pkg/types"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	both := []string{encodingBrotli, encodingGzip}
+	tests := []struct {
+		name         string
+		header       string
+		supported    []string
+		preferClient bool
+		want         string
+	}{
+		{name: "brotli preferred by q-value", header: "br, gzip;q=0.9", supported: both, preferClient: true, want: encodingBrotli},
+		{name: "gzip preferred by q-value", header: "br;q=0.5, gzip", supported: both, preferClient: true, want: encodingGzip},
+		{name: "server order ignores q-values", header: "br;q=0.5, gzip", supported: both, want: encodingBrotli},
+		{name: "equal q-values keep server order", header: "gzip, br", supported: both, preferClient: true, want: encodingBrotli},
+		{name: "brotli disabled", header: "br, gzip;q=0.9", supported: []string{encodingGzip}, preferClient: true, want: encodingGzip},
+		{name: "gzip disabled", header: "gzip", supported: []string{encodingBrotli}, preferClient: true, want: encodingIdentity},
+		{name: "refused with q=0", header: "br;q=0, gzip;q=0", supported: both, preferClient: true, want: encodingIdentity},
+		{name: "wildcard", header: "*", supported: both, preferClient: true, want: encodingBrotli},
+		{name: "wildcard with brotli refused", header: "*, br;q=0", supported: both, preferClient: true, want: encodingGzip},
+		{name: "upper case", header: "GZIP", supported: both, preferClient: true, want: encodingGzip},
+		{name: "no header", supported: both, preferClient: true, want: encodingIdentity},
+		{name: "nothing enabled", header: "br, gzip", preferClient: true, want: encodingIdentity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := negotiateEncoding(tt.header, tt.supported, tt.preferClient); got != tt.want {
+				t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompression(t *testing.T) {
+	const body = `{"choices":[{"message":{"content":"hello hello hello hello"}}]}`
+	tests := []struct {
+		name         string
+		config       types.PerformanceConfig
+		accept       string
+		contentType  string
+		wantEncoding string
+		wantVary     bool
+	}{
+		{name: "brotli", config: types.PerformanceConfig{EnableGzip: true, EnableBrotli: true, CompressionPreferClient: true}, accept: "br, gzip;q=0.9", contentType: "application/json", wantEncoding: "br", wantVary: true},
+		{name: "gzip", config: types.PerformanceConfig{EnableGzip: true, EnableBrotli: true, CompressionPreferClient: true}, accept: "gzip", contentType: "application/json", wantEncoding: "gzip", wantVary: true},
+		{name: "identity still varies", config: types.PerformanceConfig{EnableGzip: true, CompressionPreferClient: true}, accept: "br", contentType: "application/json", wantVary: true},
+		{name: "binary not compressed", config: types.PerformanceConfig{EnableGzip: true, EnableBrotli: true, CompressionPreferClient: true}, accept: "br", contentType: "image/png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(Compression(tt.config))
+			router.GET("/v1/models", func(c *gin.Context) {
+				c.Data(http.StatusOK, tt.contentType, []byte(body))
+			})
+			req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+			req.Header.Set("Accept-Encoding", tt.accept)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			if encoding := recorder.Header().Get("Content-Encoding"); encoding != tt.wantEncoding {
+				t.Errorf("Content-Encoding = %q, want %q", encoding, tt.wantEncoding)
+			}
+			if vary := recorder.Header().Get("Vary") == "Accept-Encoding"; vary != tt.wantVary {
+				t.Errorf("Vary: Accept-Encoding = %v, want %v", vary, tt.wantVary)
+			}
+
+			var reader io.Reader = recorder.Body
+			switch tt.wantEncoding {
+			case "br":
+				reader = brotli.NewReader(recorder.Body)
+			case "gzip":
+				gzipReader, err := gzip.NewReader(recorder.Body)
+				if err != nil {
+					t.Fatalf("gzip.NewReader: %v", err)
+				}
+				reader = gzipReader
+			}
+			decoded, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("decoding body: %v", err)
+			}
+			if string(decoded) != body {
+				t.Errorf("body = %q, want %q", decoded, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"gpt-load/internal/apierror"
+	"gpt-load/internal/errors"
+	"gpt-load/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ClientIPRemoteAddr makes CLIENT_IP_HEADER ignore headers and use the connection address
+const ClientIPRemoteAddr = "RemoteAddr"
+
+// IPFilter creates a middleware that rejects clients on IP_BLOCKLIST and,
+// when IP_ALLOWLIST is set, clients not on it. An allowlisted IP is let
+// through even if it is also blocklisted.
+func IPFilter(config types.AuthConfig) gin.HandlerFunc {
+	allowlist := ParseIPNets(config.IPAllowlist)
+	blocklist := ParseIPNets(config.IPBlocklist)
+
+	return func(c *gin.Context) {
+		// The startup self-test always passes, health and readiness probes never reach this filter
+		if IsSelfTest(c) {
+			c.Next()
+			return
+		}
+
+		ip := clientIP(c.Request, config.ClientIPHeader)
+		allowed := ip != nil && ContainsIP(allowlist, ip)
+		if !allowed && (len(allowlist) > 0 || (ip != nil && ContainsIP(blocklist, ip))) {
+			GetLogger(c).Warnf("Rejected request from client IP %s", ip)
+			RespondError(c, apierror.New(http.StatusForbidden, errors.ErrIPNotAllowed, "Client IP not allowed"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// clientIP extracts the client IP from the configured header, or from
+// X-Real-IP, then X-Forwarded-For, then the connection address when no
+// header is configured
+func clientIP(req *http.Request, header string) net.IP {
+	var candidates []string
+	switch header {
+	case "":
+		candidates = []string{req.Header.Get("X-Real-IP"), req.Header.Get("X-Forwarded-For")}
+	case ClientIPRemoteAddr:
+	default:
+		candidates = []string{req.Header.Get(header)}
+	}
+
+	for _, value := range candidates {
+		// The first X-Forwarded-For entry is the original client
+		first, _, _ := strings.Cut(value, ",")
+		if ip := net.ParseIP(strings.TrimSpace(first)); ip != nil {
+			return ip
+		}
+	}
+
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// ParseIPNets parses IPs and CIDR ranges, a plain IP matches only itself.
+// Entries are checked during config validation, so invalid ones are skipped.
+func ParseIPNets(entries []string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				continue
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			nets = append(nets, ipNet)
+		}
+	}
+	return nets
+}
+
+// ContainsIP reports whether any of the networks contains ip
+func ContainsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
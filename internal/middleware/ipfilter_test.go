@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gpt-load/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string // CLIENT_IP_HEADER
+		headers map[string]string
+		want    string
+	}{
+		{name: "X-Real-IP first", headers: map[string]string{"X-Real-IP": "10.0.0.1", "X-Forwarded-For": "10.0.0.2"}, want: "10.0.0.1"},
+		{name: "X-Forwarded-For original client", headers: map[string]string{"X-Forwarded-For": " 10.0.0.2 , 172.16.0.1"}, want: "10.0.0.2"},
+		{name: "RemoteAddr without headers", want: "192.0.2.10"},
+		{name: "invalid header falls through", headers: map[string]string{"X-Real-IP": "unknown", "X-Forwarded-For": "10.0.0.2"}, want: "10.0.0.2"},
+		{name: "IPv6 header", headers: map[string]string{"X-Real-IP": "2001:db8::1"}, want: "2001:db8::1"},
+		{name: "configured header", header: "CF-Connecting-IP", headers: map[string]string{"CF-Connecting-IP": "10.0.0.3", "X-Real-IP": "10.0.0.1"}, want: "10.0.0.3"},
+		{name: "configured header missing", header: "CF-Connecting-IP", headers: map[string]string{"X-Real-IP": "10.0.0.1"}, want: "192.0.2.10"},
+		{name: "RemoteAddr forced", header: ClientIPRemoteAddr, headers: map[string]string{"X-Real-IP": "10.0.0.1", "X-Forwarded-For": "10.0.0.2"}, want: "192.0.2.10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+			req.RemoteAddr = "192.0.2.10:51234"
+			for header, value := range tt.headers {
+				req.Header.Set(header, value)
+			}
+			if got := clientIP(req, tt.header); !got.Equal(net.ParseIP(tt.want)) {
+				t.Errorf("clientIP = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPFilter(t *testing.T) {
+	tests := []struct {
+		name      string
+		allowlist []string
+		blocklist []string
+		ip        string
+		want      int
+	}{
+		{name: "no lists", ip: "203.0.113.7", want: http.StatusOK},
+		{name: "blocked IP", blocklist: []string{"203.0.113.7"}, ip: "203.0.113.7", want: http.StatusForbidden},
+		{name: "neighbour of a blocked IP", blocklist: []string{"203.0.113.7"}, ip: "203.0.113.8", want: http.StatusOK},
+		{name: "first address of a blocked range", blocklist: []string{"10.0.0.0/8"}, ip: "10.0.0.0", want: http.StatusForbidden},
+		{name: "last address of a blocked range", blocklist: []string{"10.0.0.0/8"}, ip: "10.255.255.255", want: http.StatusForbidden},
+		{name: "just past a blocked range", blocklist: []string{"10.0.0.0/8"}, ip: "11.0.0.0", want: http.StatusOK},
+		{name: "just before a blocked range", blocklist: []string{"10.0.0.0/8"}, ip: "9.255.255.255", want: http.StatusOK},
+		{name: "allowlisted range", allowlist: []string{"192.168.1.0/24"}, ip: "192.168.1.255", want: http.StatusOK},
+		{name: "outside the allowlist", allowlist: []string{"192.168.1.0/24"}, ip: "192.168.2.0", want: http.StatusForbidden},
+		{name: "allowlist overrides blocklist", allowlist: []string{"10.1.2.3"}, blocklist: []string{"10.0.0.0/8"}, ip: "10.1.2.3", want: http.StatusOK},
+		{name: "blocked outside the allowlist", allowlist: []string{"10.1.2.3"}, blocklist: []string{"10.0.0.0/8"}, ip: "10.1.2.4", want: http.StatusForbidden},
+		{name: "IPv6 range", blocklist: []string{"2001:db8::/32"}, ip: "2001:db8:ffff::1", want: http.StatusForbidden},
+		{name: "IPv6 outside the range", blocklist: []string{"2001:db8::/32"}, ip: "2001:db9::1", want: http.StatusOK},
+		{name: "IPv4-mapped IPv6 address", blocklist: []string{"10.0.0.0/8"}, ip: "::ffff:10.0.0.1", want: http.StatusForbidden},
+		{name: "unparsable IP with an allowlist", allowlist: []string{"10.0.0.0/8"}, ip: "not-an-ip", want: http.StatusForbidden},
+		{name: "unparsable IP with a blocklist", blocklist: []string{"10.0.0.0/8"}, ip: "not-an-ip", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(IPFilter(types.AuthConfig{IPAllowlist: tt.allowlist, IPBlocklist: tt.blocklist, ClientIPHeader: ClientIPRemoteAddr}))
+			router.GET("/v1/models", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+			req.RemoteAddr = net.JoinHostPort(tt.ip, "51234")
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			if recorder.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, tt.want, recorder.Body.String())
+			}
+		})
+	}
+}
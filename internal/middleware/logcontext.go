@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gpt-load/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// maxLogFieldValueLength bounds header values copied into log fields
+const maxLogFieldValueLength = 256
+
+// loggerKey is the gin context key for the request-scoped logger
+const loggerKey = "logger"
+
+// loggerContextKey is the request context key for the request-scoped logger
+type loggerContextKey struct{}
+
+// ContextLogger creates a middleware that attaches a request-scoped logger,
+// enriched with the header values configured in LOG_EXTRACT_HEADERS
+func ContextLogger(config types.LogConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fields := logrus.Fields{}
+		if requestID := GetRequestID(c); requestID != "" {
+			fields["request_id"] = requestID
+		}
+		for header, field := range config.ExtractHeaders {
+			if value := c.GetHeader(header); value != "" {
+				fields[field] = sanitizeLogValue(value)
+			}
+		}
+
+		SetLogger(c, logrus.WithFields(fields))
+		c.Next()
+	}
+}
+
+// SetLogger replaces the request-scoped logger
+func SetLogger(c *gin.Context, entry *logrus.Entry) {
+	c.Set(loggerKey, entry)
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), loggerContextKey{}, entry))
+}
+
+// GetLogger returns the request-scoped logger, or the standard logger if none is attached
+func GetLogger(c *gin.Context) *logrus.Entry {
+	if value, exists := c.Get(loggerKey); exists {
+		if entry, ok := value.(*logrus.Entry); ok {
+			return entry
+		}
+	}
+	return logrus.NewEntry(logrus.StandardLogger())
+}
+
+// LoggerFromContext returns the request-scoped logger stored in a request context
+func LoggerFromContext(ctx context.Context) *logrus.Entry {
+	if entry, ok := ctx.Value(loggerContextKey{}).(*logrus.Entry); ok {
+		return entry
+	}
+	return logrus.NewEntry(logrus.StandardLogger())
+}
+
+// sanitizeLogValue strips control characters and truncates a value to prevent log injection
+func sanitizeLogValue(value string) string {
+	value = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, value)
+
+	if len(value) > maxLogFieldValueLength {
+		// Cut at a rune boundary so a multi-byte character is not split
+		cut := maxLogFieldValueLength
+		for cut > 0 && !utf8.RuneStart(value[cut]) {
+			cut--
+		}
+		value = value[:cut]
+	}
+	return value
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSanitizeLogValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{name: "plain", value: "acme-client/1.0", want: "acme-client/1.0"},
+		{name: "control characters stripped", value: "line\r\nforged=1\x00", want: "lineforged=1"},
+		{name: "truncated", value: strings.Repeat("a", 300), want: strings.Repeat("a", maxLogFieldValueLength)},
+		{name: "multi-byte rune at the limit", value: strings.Repeat("a", maxLogFieldValueLength-1) + "é", want: strings.Repeat("a", maxLogFieldValueLength-1)},
+		{name: "multi-byte runes", value: strings.Repeat("日", 100), want: strings.Repeat("日", maxLogFieldValueLength/3)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sanitizeLogValue(tt.value)
+			if got != tt.want {
+				t.Errorf("sanitizeLogValue = %q, want %q", got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("sanitizeLogValue returned invalid UTF-8 %q", got)
+			}
+		})
+	}
+}
@@ -2,10 +2,15 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"fmt"
+	"path"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"gpt-load/internal/apierror"
 	"gpt-load/internal/errors"
 	"gpt-load/pkg/types"
 
@@ -15,14 +20,33 @@ import (
 
 // Logger creates a high-performance logging middleware
 func Logger(config types.LogConfig) gin.HandlerFunc {
+	// Path components are matched case-insensitively
+	excludePrefixes := make([]string, 0, len(config.ExcludePaths))
+	for _, prefix := range config.ExcludePaths {
+		excludePrefixes = append(excludePrefixes, strings.ToLower(prefix))
+	}
+
+	// JSON output logs one structured entry per request instead of a formatted line
+	structured := config.Format == "json"
+	includeFields := make(map[string]bool, len(config.RequestFields))
+	for _, field := range config.RequestFields {
+		includeFields[field] = true
+	}
+
 	return func(c *gin.Context) {
+		// Skip noisy paths such as health checks entirely
+		if isLogExcluded(excludePrefixes, c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
 		// Check if request logging is enabled
 		if !config.EnableRequest {
 			// Don't log requests, only process them
 			c.Next()
 			// Only log errors
 			if c.Writer.Status() >= 400 {
-				logrus.Errorf("Error %d: %s %s", c.Writer.Status(), c.Request.Method, c.Request.URL.Path)
+				GetLogger(c).Errorf("Error %d: %s %s", c.Writer.Status(), c.Request.Method, c.Request.URL.Path)
 			}
 			return
 		}
@@ -61,29 +85,38 @@ func Logger(config types.LogConfig) gin.HandlerFunc {
 			retryInfo = fmt.Sprintf(" - Retry[%d]", retryCount)
 		}
 
+		log := GetLogger(c)
+
 		// Filter health check and other monitoring endpoint logs to reduce noise
-		if isMonitoringEndpoint(path) {
+		if isMonitoringEndpoint(path) || c.GetBool(monitoringKey) {
 			// Only log errors for monitoring endpoints
 			if statusCode >= 400 {
-				logrus.Warnf("%s %s - %d - %v", method, fullPath, statusCode, latency)
+				log.Warnf("%s %s - %d - %v", method, fullPath, statusCode, latency)
 			}
 			return
 		}
 
+		if structured {
+			logStructuredRequest(c, includeFields, start, latency)
+			return
+		}
+
 		// Choose log level based on status code
 		if statusCode >= 500 {
-			logrus.Errorf("%s %s - %d - %v%s%s", method, fullPath, statusCode, latency, keyInfo, retryInfo)
+			log.Errorf("%s %s - %d - %v%s%s", method, fullPath, statusCode, latency, keyInfo, retryInfo)
 		} else if statusCode >= 400 {
-			logrus.Warnf("%s %s - %d - %v%s%s", method, fullPath, statusCode, latency, keyInfo, retryInfo)
+			log.Warnf("%s %s - %d - %v%s%s", method, fullPath, statusCode, latency, keyInfo, retryInfo)
 		} else {
-			logrus.Infof("%s %s - %d - %v%s%s", method, fullPath, statusCode, latency, keyInfo, retryInfo)
+			log.Infof("%s %s - %d - %v%s%s", method, fullPath, statusCode, latency, keyInfo, retryInfo)
 		}
 	}
 }
 
-// CORS creates a CORS middleware
-func CORS(config types.CORSConfig) gin.HandlerFunc {
+// CORS creates a CORS middleware, fetching the configuration per request so
+// reloaded origins and headers apply right away
+func CORS(getConfig func() types.CORSConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		config := getConfig()
 		if !config.Enabled {
 			c.Next()
 			return
@@ -122,9 +155,15 @@ func CORS(config types.CORSConfig) gin.HandlerFunc {
 	}
 }
 
-// Auth creates an authentication middleware
-func Auth(config types.AuthConfig) gin.HandlerFunc {
+// Auth creates an authentication middleware. The static AUTH_KEYS are checked
+// first, the label of the matching key is added to the request's log fields;
+// when a token verifier is provided, other tokens are verified as JWTs. The
+// configuration is fetched per request, so reloaded AUTH_KEYS apply right away.
+// Callers using a key labelled admin, or the ADMIN_AUTH_KEY listed in AUTH_KEYS,
+// are admins.
+func Auth(getConfig func() types.AuthConfig, adminKey string, verifier types.TokenVerifier) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		config := getConfig()
 		if !config.Enabled {
 			c.Next()
 			return
@@ -132,7 +171,12 @@ func Auth(config types.AuthConfig) gin.HandlerFunc {
 
 		// Skip authentication for management endpoints
 		path := c.Request.URL.Path
-		if path == "/health" || path == "/stats" || path == "/blacklist" || path == "/reset-keys" {
+		if path == "/stats" || path == "/blacklist" || path == "/reset-keys" {
+			c.Next()
+			return
+		}
+		if isAuthExempt(config.ExemptPaths, path) {
+			GetLogger(c).Debugf("Authentication skipped for exempt path %s", path)
 			c.Next()
 			return
 		}
@@ -140,10 +184,7 @@ func Auth(config types.AuthConfig) gin.HandlerFunc {
 		// Get authorization header
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(401, gin.H{
-				"error": "Authorization header required",
-				"code":  errors.ErrAuthMissing,
-			})
+			RespondError(c, apierror.NewAuthError(errors.ErrAuthMissing, "Authorization header required"))
 			c.Abort()
 			return
 		}
@@ -151,25 +192,84 @@ func Auth(config types.AuthConfig) gin.HandlerFunc {
 		// Check Bearer token format
 		const bearerPrefix = "Bearer "
 		if !strings.HasPrefix(authHeader, bearerPrefix) {
-			c.JSON(401, gin.H{
-				"error": "Invalid authorization format, expected 'Bearer <token>'",
-				"code":  errors.ErrAuthInvalid,
-			})
+			RespondError(c, apierror.NewAuthError(errors.ErrAuthInvalid, "Invalid authorization format, expected 'Bearer <token>'"))
 			c.Abort()
 			return
 		}
 
 		// Extract and validate token
 		token := authHeader[len(bearerPrefix):]
-		if token != config.Key {
-			c.JSON(401, gin.H{
-				"error": "Invalid authentication token",
-				"code":  errors.ErrAuthInvalid,
-			})
-			c.Abort()
+		for i, key := range config.Keys {
+			if key == "" || subtle.ConstantTimeCompare([]byte(token), []byte(key)) != 1 {
+				continue
+			}
+			// Keys from a config file may come without labels
+			label := ""
+			if i < len(config.KeyLabels) {
+				label = config.KeyLabels[i]
+			}
+			if label != "" {
+				SetLogger(c, GetLogger(c).WithField("auth_label", label))
+			}
+			if label == types.AdminKeyLabel || (adminKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(adminKey)) == 1) {
+				c.Set(authAdminKey, true)
+			}
+			c.Next()
 			return
 		}
 
+		if verifier != nil {
+			subject, err := verifier.VerifyToken(token)
+			if err == nil {
+				c.Set("authSubject", subject)
+				c.Next()
+				return
+			}
+			GetLogger(c).Debugf("JWT verification failed: %v", err)
+		}
+
+		RespondError(c, apierror.NewAuthError(errors.ErrAuthInvalid, "Invalid authentication token"))
+		c.Abort()
+	}
+}
+
+// isAuthExempt reports whether requestPath matches an AUTH_EXEMPT_PATHS entry, exactly
+// or, for entries ending in *, by prefix. Dot segments are resolved first, so
+// /public/../v1/chat/completions is not exempt under /public/*.
+func isAuthExempt(exemptPaths []string, requestPath string) bool {
+	cleaned := path.Clean(requestPath)
+	if strings.HasSuffix(requestPath, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	if !strings.HasPrefix(cleaned, "/") || slices.Contains(strings.Split(cleaned, "/"), "..") {
+		return false
+	}
+
+	for _, exempt := range exemptPaths {
+		if prefix, ok := strings.CutSuffix(exempt, "*"); ok {
+			if strings.HasPrefix(cleaned, prefix) {
+				return true
+			}
+		} else if cleaned == exempt {
+			return true
+		}
+	}
+	return false
+}
+
+// AdminAuth creates the authentication middleware for the admin server,
+// accepting only the ADMIN_AUTH_KEY bearer token
+func AdminAuth(config types.AdminConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		const bearerPrefix = "Bearer "
+		authHeader := c.GetHeader("Authorization")
+		token := strings.TrimPrefix(authHeader, bearerPrefix)
+		if !strings.HasPrefix(authHeader, bearerPrefix) || subtle.ConstantTimeCompare([]byte(token), []byte(config.AuthKey)) != 1 {
+			apiErr := apierror.NewAuthError(errors.ErrAuthInvalid, "Invalid admin authentication token")
+			c.JSON(apiErr.Status, apiErr)
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
@@ -179,41 +279,14 @@ func Recovery() gin.HandlerFunc {
 	return gin.CustomRecovery(func(c *gin.Context, recovered any) {
 		if err, ok := recovered.(string); ok {
 			logrus.Errorf("Panic recovered: %s", err)
-			c.JSON(500, gin.H{
-				"error": "Internal server error",
-				"code":  errors.ErrServerInternal,
-			})
 		} else {
 			logrus.Errorf("Panic recovered: %v", recovered)
-			c.JSON(500, gin.H{
-				"error": "Internal server error",
-				"code":  errors.ErrServerInternal,
-			})
 		}
+		RespondError(c, apierror.NewServerError(errors.ErrServerInternal, "Internal server error"))
 		c.Abort()
 	})
 }
 
-// RateLimiter creates a simple rate limiting middleware
-func RateLimiter(config types.PerformanceConfig) gin.HandlerFunc {
-	// Simple semaphore-based rate limiting
-	semaphore := make(chan struct{}, config.MaxConcurrentRequests)
-
-	return func(c *gin.Context) {
-		select {
-		case semaphore <- struct{}{}:
-			defer func() { <-semaphore }()
-			c.Next()
-		default:
-			c.JSON(429, gin.H{
-				"error": "Too many concurrent requests",
-				"code":  errors.ErrServerUnavailable,
-			})
-			c.Abort()
-		}
-	}
-}
-
 // ErrorHandler creates an error handling middleware
 func ErrorHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -225,26 +298,81 @@ func ErrorHandler() gin.HandlerFunc {
 
 			// Check if it's our custom error type
 			if appErr, ok := err.(*errors.AppError); ok {
-				c.JSON(appErr.HTTPStatus, gin.H{
-					"error": appErr.Message,
-					"code":  appErr.Code,
-				})
+				RespondError(c, apierror.New(appErr.HTTPStatus, appErr.Code, appErr.Message))
 				return
 			}
 
 			// Handle other errors
 			logrus.Errorf("Unhandled error: %v", err)
-			c.JSON(500, gin.H{
-				"error": "Internal server error",
-				"code":  errors.ErrServerInternal,
-			})
+			RespondError(c, apierror.NewServerError(errors.ErrServerInternal, "Internal server error"))
 		}
 	}
 }
 
+// authAdminKey marks requests authenticated with an admin key
+const authAdminKey = "authAdmin"
+
+// IsAdmin reports whether the caller authenticated with an AUTH_KEYS entry
+// labelled admin or with the ADMIN_AUTH_KEY
+func IsAdmin(c *gin.Context) bool {
+	return c.GetBool(authAdminKey)
+}
+
+// RespondError writes an error response carrying the request ID. When an error
+// template is configured for the code it is rendered instead of the default body;
+// streaming requests receive the rendered template wrapped in an SSE data event.
+func RespondError(c *gin.Context, apiErr *apierror.Error) {
+	if requestID := GetRequestID(c); requestID != "" {
+		apiErr.With("request_id", requestID)
+	}
+	if !errors.HasTemplate(apiErr.Code) {
+		c.JSON(apiErr.Status, apiErr)
+		return
+	}
+
+	retryAfter, _ := strconv.Atoi(c.Writer.Header().Get("Retry-After"))
+	rendered, err := errors.RenderTemplate(apiErr.Code, map[string]any{
+		"request_id":  GetRequestID(c),
+		"retry_after": retryAfter,
+	})
+	if err != nil {
+		logrus.Errorf("Failed to render error template for code %d: %v", apiErr.Code, err)
+		c.JSON(apiErr.Status, apiErr)
+		return
+	}
+
+	if c.GetBool("isStreamRequest") || strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+		c.Data(apiErr.Status, "text/event-stream", []byte(fmt.Sprintf("data: %s\n\n", rendered)))
+		return
+	}
+	c.Data(apiErr.Status, "application/json; charset=utf-8", rendered)
+}
+
+// isLogExcluded checks if the path matches one of the lowercased LOG_EXCLUDE_PATHS prefixes
+func isLogExcluded(prefixes []string, path string) bool {
+	if len(prefixes) == 0 {
+		return false
+	}
+	path = strings.ToLower(path)
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// monitoringKey marks probe requests, whose paths are configurable
+const monitoringKey = "monitoring"
+
+// MarkMonitoring logs the request like the other monitoring endpoints, only on errors
+func MarkMonitoring(c *gin.Context) {
+	c.Set(monitoringKey, true)
+}
+
 // isMonitoringEndpoint checks if the path is a monitoring endpoint
 func isMonitoringEndpoint(path string) bool {
-	monitoringPaths := []string{"/health", "/stats", "/blacklist", "/reset-keys"}
+	monitoringPaths := []string{"/stats", "/blacklist", "/reset-keys"}
 	for _, monitoringPath := range monitoringPaths {
 		if path == monitoringPath {
 			return true
@@ -0,0 +1,476 @@
+package middleware
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gpt-load/internal/apierror"
+	"gpt-load/internal/errors"
+	"gpt-load/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// serve runs one request through handler and returns the response
+func serve(handler gin.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.Use(handler)
+	router.Any("/*path", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestAuthReadsConfigPerRequest(t *testing.T) {
+	config := types.AuthConfig{Enabled: true, Keys: []string{"old-key", "kept-key"}}
+	auth := Auth(func() types.AuthConfig { return config }, "", nil)
+
+	tests := []struct {
+		name   string
+		keys   []string
+		token  string
+		status int
+	}{
+		{name: "key accepted", keys: []string{"old-key", "kept-key"}, token: "old-key", status: http.StatusOK},
+		{name: "revoked key rejected", keys: []string{"kept-key"}, token: "old-key", status: http.StatusUnauthorized},
+		{name: "remaining key accepted", keys: []string{"kept-key"}, token: "kept-key", status: http.StatusOK},
+		{name: "rotated key accepted", keys: []string{"new-key"}, token: "new-key", status: http.StatusOK},
+		{name: "no keys left", keys: nil, token: "kept-key", status: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Keys = tt.keys
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			if recorder := serve(auth, req); recorder.Code != tt.status {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestCORSReadsConfigPerRequest(t *testing.T) {
+	config := types.CORSConfig{Enabled: true, AllowedOrigins: []string{"https://a.example"}}
+	cors := CORS(func() types.CORSConfig { return config })
+
+	tests := []struct {
+		name    string
+		origins []string
+		origin  string
+		want    string
+	}{
+		{name: "origin allowed", origins: []string{"https://a.example"}, origin: "https://a.example", want: "https://a.example"},
+		{name: "origin removed", origins: []string{"https://b.example"}, origin: "https://a.example", want: ""},
+		{name: "origin added", origins: []string{"https://b.example"}, origin: "https://b.example", want: "https://b.example"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.AllowedOrigins = tt.origins
+			req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+			req.Header.Set("Origin", tt.origin)
+			if got := serve(cors, req).Header().Get("Access-Control-Allow-Origin"); got != tt.want {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// stubVerifier accepts one JWT and returns its subject
+type stubVerifier struct{}
+
+func (stubVerifier) VerifyToken(token string) (string, error) {
+	if token != "jwt-token" {
+		return "", stderrors.New("invalid token")
+	}
+	return "alice", nil
+}
+
+func TestAuthKeys(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    types.AuthConfig
+		token     string
+		status    int
+		wantLabel string
+	}{
+		{name: "single key", config: types.AuthConfig{Enabled: true, Keys: []string{"sk-only"}, KeyLabels: []string{""}}, token: "sk-only", status: http.StatusOK},
+		{name: "single key wrong token", config: types.AuthConfig{Enabled: true, Keys: []string{"sk-only"}, KeyLabels: []string{""}}, token: "sk-other", status: http.StatusUnauthorized},
+		{name: "first of several", config: types.AuthConfig{Enabled: true, Keys: []string{"sk-abc", "sk-def"}, KeyLabels: []string{"team-a", "team-b"}}, token: "sk-abc", status: http.StatusOK, wantLabel: "team-a"},
+		{name: "second of several", config: types.AuthConfig{Enabled: true, Keys: []string{"sk-abc", "sk-def"}, KeyLabels: []string{"team-a", "team-b"}}, token: "sk-def", status: http.StatusOK, wantLabel: "team-b"},
+		{name: "unlabelled among labelled", config: types.AuthConfig{Enabled: true, Keys: []string{"sk-abc", "sk-plain"}, KeyLabels: []string{"team-a", ""}}, token: "sk-plain", status: http.StatusOK},
+		{name: "keys without labels", config: types.AuthConfig{Enabled: true, Keys: []string{"sk-abc", "sk-def"}}, token: "sk-def", status: http.StatusOK},
+		{name: "none match", config: types.AuthConfig{Enabled: true, Keys: []string{"sk-abc", "sk-def"}, KeyLabels: []string{"team-a", "team-b"}}, token: "sk-ghi", status: http.StatusUnauthorized},
+		{name: "empty key never matches", config: types.AuthConfig{Enabled: true, Keys: []string{""}, KeyLabels: []string{"team-a"}}, token: "", status: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			label, labelled := "", false
+			router := gin.New()
+			router.Use(Auth(func() types.AuthConfig { return tt.config }, "", nil))
+			router.POST("/v1/chat/completions", func(c *gin.Context) {
+				value, ok := GetLogger(c).Data["auth_label"]
+				label, labelled = fmt.Sprint(value), ok
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			if recorder.Code != tt.status {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.status)
+			}
+			// The label is logged with the request, unlabelled keys add no field
+			if labelled != (tt.wantLabel != "") || (labelled && label != tt.wantLabel) {
+				t.Errorf("auth_label = %q (set %v), want %q", label, labelled, tt.wantLabel)
+			}
+		})
+	}
+}
+
+func TestIsAuthExempt(t *testing.T) {
+	exemptPaths := []string{"/health", "/ping", "/public/*"}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: "/health", want: true},
+		{path: "/ping", want: true},
+		{path: "/health/", want: false},
+		{path: "/healthz", want: false},
+		{path: "/public/", want: true},
+		{path: "/public/docs/index.html", want: true},
+		{path: "/public", want: false},
+		{path: "/v1/models", want: false},
+		{path: "/", want: false},
+		// Dot segments are resolved before matching
+		{path: "/public/../v1/chat/completions", want: false},
+		{path: "/public/docs/../../v1/models", want: false},
+		{path: "/public/..", want: false},
+		{path: "/health/../v1/models", want: false},
+		{path: "/v1/../health", want: true},
+		{path: "/public/./docs", want: true},
+		{path: "/public/a/../docs", want: true},
+		{path: "/public//docs", want: true},
+		{path: "public/docs", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := isAuthExempt(exemptPaths, tt.path); got != tt.want {
+				t.Errorf("isAuthExempt(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+// stubLimiter allows every client or none
+type stubLimiter struct{ allowed bool }
+
+func (l stubLimiter) Allow(string) (time.Duration, bool) { return time.Second, l.allowed }
+
+func TestAuthExemptPaths(t *testing.T) {
+	authConfig := types.AuthConfig{Enabled: true, Keys: []string{"client-key"}, ExemptPaths: []string{"/ping", "/public/*"}}
+	corsConfig := types.CORSConfig{Enabled: true, AllowedOrigins: []string{"https://app.example"}}
+	tests := []struct {
+		name       string
+		path       string
+		limited    bool
+		wantStatus int
+		wantLogged bool
+	}{
+		{name: "exact match", path: "/ping", wantStatus: http.StatusOK, wantLogged: true},
+		{name: "prefix match", path: "/public/status", wantStatus: http.StatusOK, wantLogged: true},
+		{name: "not exempt", path: "/v1/chat/completions", wantStatus: http.StatusUnauthorized},
+		{name: "exact entry is no prefix", path: "/ping/x", wantStatus: http.StatusUnauthorized},
+		{name: "traversal out of a prefix", path: "/public/../v1/chat/completions", wantStatus: http.StatusUnauthorized},
+		{name: "encoded traversal out of a prefix", path: "/public/%2e%2e/v1/chat/completions", wantStatus: http.StatusUnauthorized},
+		{name: "exempt path still rate limited", path: "/ping", limited: true, wantStatus: http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, hook := test.NewNullLogger()
+			logger.SetLevel(logrus.DebugLevel)
+			router := gin.New()
+			router.Use(func(c *gin.Context) { SetLogger(c, logrus.NewEntry(logger)) })
+			// The order main uses, with CORS and rate limiting ahead of authentication
+			router.Use(CORS(func() types.CORSConfig { return corsConfig }))
+			router.Use(ClientRateLimit(stubLimiter{allowed: !tt.limited}, ""))
+			router.Use(Auth(func() types.AuthConfig { return authConfig }, "", nil))
+			router.Any("/*path", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Origin", "https://app.example")
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if got := recorder.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example" {
+				t.Errorf("Access-Control-Allow-Origin = %q, want the CORS check applied", got)
+			}
+
+			logged := false
+			for _, entry := range hook.AllEntries() {
+				if entry.Level == logrus.DebugLevel && strings.Contains(entry.Message, "Authentication skipped for exempt path "+tt.path) {
+					logged = true
+				}
+			}
+			if logged != tt.wantLogged {
+				t.Errorf("exemption logged = %v, want %v", logged, tt.wantLogged)
+			}
+		})
+	}
+}
+
+func TestAuthMarksAdminCallers(t *testing.T) {
+	config := types.AuthConfig{
+		Enabled:   true,
+		Keys:      []string{"plain-key", "team-key", "ops-key", "admin-secret"},
+		KeyLabels: []string{"", "team", types.AdminKeyLabel, ""},
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		admin bool
+	}{
+		{name: "unlabelled key", token: "plain-key"},
+		{name: "other label", token: "team-key"},
+		{name: "admin label", token: "ops-key", admin: true},
+		{name: "admin auth key", token: "admin-secret", admin: true},
+		{name: "jwt subject", token: "jwt-token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			admin := false
+			router := gin.New()
+			router.Use(Auth(func() types.AuthConfig { return config }, "admin-secret", stubVerifier{}))
+			router.GET("/v1/models", func(c *gin.Context) {
+				admin = IsAdmin(c)
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", recorder.Code)
+			}
+			if admin != tt.admin {
+				t.Errorf("IsAdmin = %v, want %v", admin, tt.admin)
+			}
+		})
+	}
+}
+
+func TestAuthVerifiesJWTs(t *testing.T) {
+	config := types.AuthConfig{Enabled: true, Keys: []string{"static-key"}}
+	tests := []struct {
+		name        string
+		verifier    types.TokenVerifier
+		token       string
+		status      int
+		wantSubject string
+	}{
+		{name: "static key without verifier", token: "static-key", status: http.StatusOK},
+		{name: "static key with verifier", verifier: stubVerifier{}, token: "static-key", status: http.StatusOK},
+		{name: "jwt verified", verifier: stubVerifier{}, token: "jwt-token", status: http.StatusOK, wantSubject: "alice"},
+		{name: "invalid jwt", verifier: stubVerifier{}, token: "forged-token", status: http.StatusUnauthorized},
+		{name: "jwt without verifier", token: "jwt-token", status: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject := ""
+			router := gin.New()
+			router.Use(Auth(func() types.AuthConfig { return config }, "", tt.verifier))
+			router.GET("/v1/models", func(c *gin.Context) {
+				subject = c.GetString("authSubject")
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			if recorder.Code != tt.status {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.status)
+			}
+			if subject != tt.wantSubject {
+				t.Errorf("subject = %q, want %q", subject, tt.wantSubject)
+			}
+		})
+	}
+}
+
+func TestRespondErrorRendersTemplates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "templates.json")
+	if err := os.WriteFile(path, []byte(`{"rate_limit":"{\"id\":\"{{.request_id}}\",\"retry\":{{.retry_after}}}"}`), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := errors.LoadTemplates(path); err != nil {
+		t.Fatalf("LoadTemplates: %v", err)
+	}
+	t.Cleanup(func() {
+		// An empty file clears the installed templates
+		os.WriteFile(path, []byte(`{}`), 0o600)
+		errors.LoadTemplates(path)
+	})
+
+	tests := []struct {
+		name        string
+		code        errors.ErrorCode
+		accept      string
+		wantType    string
+		wantBody    string
+		wantDefault bool
+	}{
+		{name: "json", code: errors.ErrRateLimited, wantType: "application/json; charset=utf-8", wantBody: `{"id":"req-1","retry":30}`},
+		{name: "streaming", code: errors.ErrRateLimited, accept: "text/event-stream", wantType: "text/event-stream", wantBody: "data: {\"id\":\"req-1\",\"retry\":30}\n\n"},
+		{name: "no template", code: errors.ErrAuthInvalid, wantType: "application/json; charset=utf-8", wantDefault: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+			c.Request.Header.Set("Accept", tt.accept)
+			c.Set(requestIDKey, "req-1")
+			c.Header("Retry-After", "30")
+			RespondError(c, apierror.New(http.StatusTooManyRequests, tt.code, "Too many requests"))
+
+			if recorder.Code != http.StatusTooManyRequests {
+				t.Errorf("status = %d, want 429", recorder.Code)
+			}
+			if contentType := recorder.Header().Get("Content-Type"); contentType != tt.wantType {
+				t.Errorf("Content-Type = %q, want %q", contentType, tt.wantType)
+			}
+			body := recorder.Body.String()
+			if tt.wantDefault {
+				if !strings.Contains(body, "Too many requests") {
+					t.Errorf("body = %s, want the default error", body)
+				}
+				return
+			}
+			if body != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestLoggerExcludesPaths(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		status   int
+		requests int
+		wantLogs int
+	}{
+		{name: "health checks", path: "/healthz", status: http.StatusOK, requests: 100},
+		{name: "failing health checks", path: "/healthz", status: http.StatusServiceUnavailable, requests: 10},
+		{name: "case insensitive", path: "/HealthZ/live", status: http.StatusOK, requests: 10},
+		{name: "api requests logged", path: "/v1/models", status: http.StatusOK, requests: 10, wantLogs: 10},
+		{name: "similar path logged", path: "/health", status: http.StatusOK, requests: 1, wantLogs: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, hook := test.NewNullLogger()
+			handled := 0
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				SetLogger(c, logrus.NewEntry(logger))
+			})
+			router.Use(Logger(types.LogConfig{EnableRequest: true, ExcludePaths: []string{"/healthz"}}))
+			router.Any("/*path", func(c *gin.Context) {
+				handled++
+				c.Status(tt.status)
+			})
+
+			for i := 0; i < tt.requests; i++ {
+				router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+			}
+			if handled != tt.requests {
+				t.Errorf("handled %d of %d requests", handled, tt.requests)
+			}
+			if logs := len(hook.AllEntries()); logs != tt.wantLogs {
+				t.Errorf("%d requests produced %d log lines, want %d", tt.requests, logs, tt.wantLogs)
+			}
+		})
+	}
+}
+
+func TestMiddlewareErrorsUseOpenAISchema(t *testing.T) {
+	authConfig := types.AuthConfig{Enabled: true, Keys: []string{"client-key"}}
+	tests := []struct {
+		name       string
+		handler    gin.HandlerFunc
+		token      string
+		remoteAddr string
+		body       string
+		wantStatus int
+		wantType   string
+		wantCode   errors.ErrorCode
+	}{
+		{name: "missing key", handler: Auth(func() types.AuthConfig { return authConfig }, "", nil), wantStatus: http.StatusUnauthorized, wantType: "authentication_error", wantCode: errors.ErrAuthMissing},
+		{name: "invalid key", handler: Auth(func() types.AuthConfig { return authConfig }, "", nil), token: "wrong-key", wantStatus: http.StatusUnauthorized, wantType: "authentication_error", wantCode: errors.ErrAuthInvalid},
+		{
+			name:       "blocked IP",
+			handler:    IPFilter(types.AuthConfig{IPBlocklist: []string{"203.0.113.0/24"}, ClientIPHeader: ClientIPRemoteAddr}),
+			remoteAddr: "203.0.113.7:4000",
+			wantStatus: http.StatusForbidden, wantType: "permission_error", wantCode: errors.ErrIPNotAllowed,
+		},
+		{name: "body too large", handler: RequestBodyLimit(4), body: `{"model":"gpt-4o"}`, wantStatus: http.StatusRequestEntityTooLarge, wantType: "request_too_large", wantCode: errors.ErrRequestTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			if tt.remoteAddr != "" {
+				req.RemoteAddr = tt.remoteAddr
+			}
+			recorder := serve(tt.handler, req)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body.String())
+			}
+
+			var body map[string]map[string]any
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+				t.Fatalf("parse %s: %v", recorder.Body.String(), err)
+			}
+			errorObject, ok := body["error"]
+			if !ok {
+				t.Fatalf("body %s has no error object", recorder.Body.String())
+			}
+			for _, field := range []string{"message", "type", "param", "code"} {
+				if _, ok := errorObject[field]; !ok {
+					t.Errorf("error object %v has no %s", errorObject, field)
+				}
+			}
+			if message, _ := errorObject["message"].(string); message == "" {
+				t.Errorf("error object %v has no message", errorObject)
+			}
+			if errorObject["type"] != tt.wantType || errorObject["param"] != nil || errorObject["code"] != float64(tt.wantCode) {
+				t.Errorf("error object = %v, want type %s and code %d", errorObject, tt.wantType, tt.wantCode)
+			}
+		})
+	}
+}
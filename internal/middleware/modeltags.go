@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// modelTagsKey is the gin context key for the request's model tags
+const modelTagsKey = "modelTags"
+
+// modelTagsContextKey is the request context key for the request's model tags
+type modelTagsContextKey struct{}
+
+// SetModelTags attaches model tags to the request and adds them to the request-scoped logger
+func SetModelTags(c *gin.Context, tags map[string]string) {
+	if len(tags) == 0 {
+		return
+	}
+
+	c.Set(modelTagsKey, tags)
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), modelTagsContextKey{}, tags))
+
+	fields := make(logrus.Fields, len(tags))
+	for key, value := range tags {
+		fields[key] = value
+	}
+	SetLogger(c, GetLogger(c).WithFields(fields))
+}
+
+// GetModelTags returns the model tags attached to the request
+func GetModelTags(c *gin.Context) map[string]string {
+	if value, exists := c.Get(modelTagsKey); exists {
+		if tags, ok := value.(map[string]string); ok {
+			return tags
+		}
+	}
+	return nil
+}
+
+// ModelTagsFromContext returns the model tags stored in a request context
+func ModelTagsFromContext(ctx context.Context) map[string]string {
+	tags, _ := ctx.Value(modelTagsContextKey{}).(map[string]string)
+	return tags
+}
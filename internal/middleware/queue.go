@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"gpt-load/internal/apierror"
+	"gpt-load/internal/errors"
+	"gpt-load/internal/metrics"
+	"gpt-load/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ConcurrencyLimiter caps the requests served at once at MAX_CONCURRENT_REQUESTS.
+// Requests beyond the cap wait in a FIFO queue of up to MAX_QUEUE_SIZE for a
+// free slot, for at most QUEUE_TIMEOUT_MS.
+type ConcurrencyLimiter struct {
+	slots   chan struct{}
+	queue   chan struct{}
+	timeout time.Duration
+}
+
+// NewConcurrencyLimiter creates the limiter and exposes its queue depth as a metric
+func NewConcurrencyLimiter(config types.PerformanceConfig) *ConcurrencyLimiter {
+	l := &ConcurrencyLimiter{
+		slots:   make(chan struct{}, config.MaxConcurrentRequests),
+		queue:   make(chan struct{}, config.MaxQueueSize),
+		timeout: time.Duration(config.QueueTimeoutMs) * time.Millisecond,
+	}
+	metrics.RegisterRequestQueueDepth(l.QueueDepth)
+	return l
+}
+
+// Handler creates a middleware that holds a slot while the request is served
+func (l *ConcurrencyLimiter) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			if !l.wait(c) {
+				c.Abort()
+				return
+			}
+		}
+		defer func() { <-l.slots }()
+		c.Next()
+	}
+}
+
+// wait queues the request until a slot frees up, responding itself and
+// returning false when the queue is full or the wait times out. Blocked
+// senders on a channel are woken in arrival order, which keeps the queue FIFO.
+func (l *ConcurrencyLimiter) wait(c *gin.Context) bool {
+	select {
+	case l.queue <- struct{}{}:
+		defer func() { <-l.queue }()
+	default:
+		c.Header("Retry-After", "1")
+		RespondError(c, apierror.NewRateLimitError(errors.ErrRateLimited, "Too many concurrent requests"))
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), l.timeout)
+	defer cancel()
+
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		// Nobody is left to answer when the client gave up waiting
+		if c.Request.Context().Err() != nil {
+			return false
+		}
+		GetLogger(c).Warnf("Request timed out after %v in the concurrency queue", l.timeout)
+		RespondError(c, apierror.New(http.StatusGatewayTimeout, errors.ErrProxyTimeout, "Timed out waiting for a free request slot"))
+		return false
+	}
+}
+
+// QueueDepth returns the number of requests waiting for a slot
+func (l *ConcurrencyLimiter) QueueDepth() int {
+	return len(l.queue)
+}
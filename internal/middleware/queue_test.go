@@ -0,0 +1,171 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestLimiter builds a limiter without registering its queue depth metric,
+// which can only be registered once per process
+func newTestLimiter(slots, queueSize int, timeout time.Duration) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		slots:   make(chan struct{}, slots),
+		queue:   make(chan struct{}, queueSize),
+		timeout: timeout,
+	}
+}
+
+// blockingRouter serves requests through the limiter, each one sending its
+// X-Seq header on entered and holding its slot until release is closed
+func blockingRouter(l *ConcurrencyLimiter, entered chan<- string, release <-chan struct{}) *gin.Engine {
+	router := gin.New()
+	router.Use(l.Handler())
+	router.POST("/v1/chat/completions", func(c *gin.Context) {
+		entered <- c.GetHeader("X-Seq")
+		<-release
+		c.String(http.StatusOK, "ok")
+	})
+	return router
+}
+
+// serveAsync sends one request in the background, delivering its recorder when done
+func serveAsync(router *gin.Engine, seq int) <-chan *httptest.ResponseRecorder {
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		req.Header.Set("X-Seq", strconv.Itoa(seq))
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		done <- recorder
+	}()
+	return done
+}
+
+// waitForDepth waits until the limiter has depth requests queued
+func waitForDepth(t *testing.T, l *ConcurrencyLimiter, depth int) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); l.QueueDepth() != depth; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("queue depth = %d, want %d", l.QueueDepth(), depth)
+		}
+	}
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	tests := []struct {
+		name       string
+		slots      int
+		queueSize  int
+		timeout    time.Duration
+		wantStatus []int // Status of each request sent while every slot is held, in arrival order
+	}{
+		{name: "within the slots", slots: 3},
+		{name: "no queue rejects at once", slots: 1, wantStatus: []int{http.StatusTooManyRequests}},
+		{name: "queued until timeout", slots: 1, queueSize: 1, timeout: 20 * time.Millisecond, wantStatus: []int{http.StatusGatewayTimeout}},
+		{
+			name: "full queue rejects", slots: 1, queueSize: 2, timeout: 50 * time.Millisecond,
+			wantStatus: []int{http.StatusGatewayTimeout, http.StatusGatewayTimeout, http.StatusTooManyRequests},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestLimiter(tt.slots, tt.queueSize, tt.timeout)
+			entered := make(chan string, tt.slots)
+			release := make(chan struct{})
+			router := blockingRouter(l, entered, release)
+
+			var held []<-chan *httptest.ResponseRecorder
+			for i := 0; i < tt.slots; i++ {
+				held = append(held, serveAsync(router, i))
+				<-entered
+			}
+			var overflow []<-chan *httptest.ResponseRecorder
+			for i := range tt.wantStatus {
+				overflow = append(overflow, serveAsync(router, tt.slots+i))
+				if i < tt.queueSize {
+					waitForDepth(t, l, i+1)
+				}
+			}
+			for i, done := range overflow {
+				recorder := <-done
+				if recorder.Code != tt.wantStatus[i] {
+					t.Errorf("request %d status = %d, want %d", tt.slots+i, recorder.Code, tt.wantStatus[i])
+				}
+				if recorder.Code == http.StatusTooManyRequests && recorder.Header().Get("Retry-After") == "" {
+					t.Errorf("request %d rejected without Retry-After", tt.slots+i)
+				}
+			}
+
+			close(release)
+			for i, done := range held {
+				if recorder := <-done; recorder.Code != http.StatusOK {
+					t.Errorf("request %d status = %d, want 200", i, recorder.Code)
+				}
+			}
+			if n, depth := len(l.slots), l.QueueDepth(); n != 0 || depth != 0 {
+				t.Errorf("%d slots held and %d requests queued after every request finished", n, depth)
+			}
+		})
+	}
+}
+
+func TestConcurrencyLimiterQueueTimeouts(t *testing.T) {
+	l := newTestLimiter(1, 2, 30*time.Millisecond)
+	entered := make(chan string, 3)
+	release := make(chan struct{})
+	router := blockingRouter(l, entered, release)
+	defer close(release)
+
+	serveAsync(router, 0)
+	<-entered
+	start := time.Now()
+	first, second := serveAsync(router, 1), serveAsync(router, 2)
+	for _, done := range []<-chan *httptest.ResponseRecorder{first, second} {
+		recorder := <-done
+		if recorder.Code != http.StatusGatewayTimeout {
+			t.Errorf("queued request status = %d, want 504", recorder.Code)
+		}
+	}
+	if waited := time.Since(start); waited < 30*time.Millisecond || waited > time.Second {
+		t.Errorf("queued requests answered after %v, want about QUEUE_TIMEOUT_MS", waited)
+	}
+	if depth := l.QueueDepth(); depth != 0 {
+		t.Errorf("queue depth = %d after the timeouts, want 0", depth)
+	}
+}
+
+func TestConcurrencyLimiterFIFO(t *testing.T) {
+	const queued = 5
+	l := newTestLimiter(1, queued, 5*time.Second)
+	entered := make(chan string, queued+1)
+	release := make(chan struct{})
+	router := blockingRouter(l, entered, release)
+
+	responses := []<-chan *httptest.ResponseRecorder{serveAsync(router, 0)}
+	<-entered
+	// Wait for each request to queue so the arrival order is known
+	for i := 1; i <= queued; i++ {
+		responses = append(responses, serveAsync(router, i))
+		waitForDepth(t, l, i)
+	}
+
+	close(release)
+	for i := 1; i <= queued; i++ {
+		if seq := <-entered; seq != strconv.Itoa(i) {
+			t.Fatalf("request %s served in position %d, want arrival order", seq, i)
+		}
+	}
+	for i, done := range responses {
+		if recorder := <-done; recorder.Code != http.StatusOK {
+			t.Errorf("request %d status = %d, want 200", i, recorder.Code)
+		}
+	}
+	if depth := l.QueueDepth(); depth != 0 {
+		t.Errorf("queue depth = %d after draining, want 0", depth)
+	}
+}
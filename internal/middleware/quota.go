@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gpt-load/internal/apierror"
+	"gpt-load/internal/errors"
+	"gpt-load/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxUsageCaptureBytes bounds how much of a response is buffered to read token usage
+const maxUsageCaptureBytes = 1 << 20
+
+// Quota creates a middleware that enforces caller quotas and records usage
+func Quota(tracker types.QuotaTracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		caller := quotaCaller(c)
+		if caller == "" {
+			c.Next()
+			return
+		}
+
+		status, allowed := tracker.Check(caller)
+		if status.Limited {
+			c.Header("X-Quota-Remaining", strconv.FormatInt(status.Remaining, 10))
+			c.Header("X-Quota-Reset", strconv.FormatInt(status.ResetAt.Unix(), 10))
+		}
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(time.Until(status.ResetAt).Seconds())+1))
+			RespondError(c, apierror.NewRateLimitError(errors.ErrQuotaExceeded, "Quota exceeded"))
+			c.Abort()
+			return
+		}
+
+		writer := &usageCaptureWriter{ResponseWriter: c.Writer}
+		if status.Limited {
+			c.Writer = writer
+		}
+
+		c.Next()
+
+		if status.Limited && c.Writer.Status() < http.StatusBadRequest {
+			tracker.Record(caller, writer.totalTokens())
+		}
+	}
+}
+
+// quotaCaller identifies the caller a quota applies to: the JWT subject or the presented key
+func quotaCaller(c *gin.Context) string {
+	if subject := c.GetString("authSubject"); subject != "" {
+		return subject
+	}
+	return strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+}
+
+// usageCaptureWriter keeps a bounded copy of the response to read token usage from
+type usageCaptureWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+// Write writes to the client and records the data while under the capture limit
+func (w *usageCaptureWriter) Write(data []byte) (int, error) {
+	if w.body.Len()+len(data) <= maxUsageCaptureBytes {
+		w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString writes to the client and records the data while under the capture limit
+func (w *usageCaptureWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Unwrap exposes the client's writer to http.ResponseController
+func (w *usageCaptureWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// totalTokens returns usage.total_tokens from a JSON response, 0 if unavailable
+func (w *usageCaptureWriter) totalTokens() int64 {
+	var response struct {
+		Usage struct {
+			TotalTokens int64 `json:"total_tokens"`
+		} `json:"usage"`
+	}
+	if json.Unmarshal(w.body.Bytes(), &response) != nil {
+		return 0
+	}
+	return response.Usage.TotalTokens
+}
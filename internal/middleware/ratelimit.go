@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"math"
+	"strconv"
+
+	"gpt-load/internal/apierror"
+	"gpt-load/internal/errors"
+	"gpt-load/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ClientRateLimit creates a middleware that throttles each client separately.
+// Clients are identified by limitByHeader when set and present, otherwise by IP.
+func ClientRateLimit(limiter types.ClientRateLimiter, limitByHeader string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client := c.ClientIP()
+		if limitByHeader != "" {
+			if value := c.GetHeader(limitByHeader); value != "" {
+				client = value
+			}
+		}
+
+		retryAfter, allowed := limiter.Allow(client)
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			RespondError(c, apierror.NewRateLimitError(errors.ErrRateLimited, "Rate limit exceeded"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"gpt-load/internal/ratelimit"
+	"gpt-load/pkg/types"
+)
+
+// noopScheduler accepts tasks without running them
+type noopScheduler struct{}
+
+func (noopScheduler) AddTask(string, time.Duration, func(context.Context)) error { return nil }
+
+func (noopScheduler) Start(context.Context) {}
+
+func (noopScheduler) Stop() {}
+
+func TestClientRateLimit(t *testing.T) {
+	tests := []struct {
+		name          string
+		limitByHeader string
+		header        string   // Value every client sends in limitByHeader, none when empty
+		clients       []string // Client IPs
+		requests      []int    // Requests each client sends
+		wantAllowed   []int
+	}{
+		{name: "flooding ip throttled", clients: []string{"10.0.0.1", "10.0.0.2"}, requests: []int{100, 5}, wantAllowed: []int{10, 5}},
+		{name: "both ips flooding", clients: []string{"10.0.0.1", "10.0.0.2"}, requests: []int{100, 100}, wantAllowed: []int{10, 10}},
+		// Both IPs send the same header value, so they share one bucket
+		{name: "header identifies the client", limitByHeader: "X-Client-ID", header: "tenant", clients: []string{"10.0.0.1", "10.0.0.2"}, requests: []int{100, 100}, wantAllowed: []int{5, 5}},
+		{name: "ip used without the header", limitByHeader: "X-Client-ID", clients: []string{"10.0.0.1", "10.0.0.2"}, requests: []int{100, 5}, wantAllowed: []int{10, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter, err := ratelimit.NewLimiter(types.RateLimitConfig{RequestsPerMinute: 6, BurstSize: 10, EntryTTLSeconds: 60}, noopScheduler{})
+			if err != nil {
+				t.Fatalf("NewLimiter: %v", err)
+			}
+			handler := ClientRateLimit(limiter, tt.limitByHeader)
+
+			// Clients send side by side, each at 200 requests a second
+			allowed := make([]int, len(tt.clients))
+			for tick := 0; tick < slices.Max(tt.requests); tick++ {
+				for i, client := range tt.clients {
+					if tick >= tt.requests[i] {
+						continue
+					}
+					req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+					req.RemoteAddr = client + ":40000"
+					if tt.header != "" {
+						req.Header.Set(tt.limitByHeader, tt.header)
+					}
+					recorder := serve(handler, req)
+					switch recorder.Code {
+					case http.StatusOK:
+						allowed[i]++
+					case http.StatusTooManyRequests:
+						if retryAfter, err := strconv.Atoi(recorder.Header().Get("Retry-After")); err != nil || retryAfter < 1 {
+							t.Fatalf("Retry-After = %q, want whole seconds", recorder.Header().Get("Retry-After"))
+						}
+					default:
+						t.Fatalf("status = %d", recorder.Code)
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+			for i, client := range tt.clients {
+				if allowed[i] != tt.wantAllowed[i] {
+					t.Errorf("%s allowed %d of %d requests, want %d", client, allowed[i], tt.requests[i], tt.wantAllowed[i])
+				}
+			}
+		})
+	}
+}
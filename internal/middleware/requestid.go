@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader carries the request correlation ID unless LOG_REQUEST_ID_HEADER names another header
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDKey is the gin context key for the request correlation ID
+const requestIDKey = "requestID"
+
+// RequestID creates a middleware that assigns each request a correlation ID,
+// keeping a client-supplied ID from header and generating one otherwise
+func RequestID(header string, generate func() string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := sanitizeLogValue(c.GetHeader(header))
+		if requestID == "" {
+			requestID = generate()
+		}
+
+		c.Set(requestIDKey, requestID)
+		c.Header(header, requestID)
+		c.Next()
+	}
+}
+
+// GetRequestID returns the correlation ID of the current request
+func GetRequestID(c *gin.Context) string {
+	if requestID := c.GetString(requestIDKey); requestID != "" {
+		return requestID
+	}
+	return c.GetHeader(RequestIDHeader)
+}
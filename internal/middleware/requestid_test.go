@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gpt-load/internal/apierror"
+	"gpt-load/internal/errors"
+	"gpt-load/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+// captureStandardLog records what the standard logger writes until the test ends
+func captureStandardLog(t *testing.T) *test.Hook {
+	t.Helper()
+	hook := &test.Hook{}
+	previous := logrus.StandardLogger().ReplaceHooks(logrus.LevelHooks{})
+	logrus.AddHook(hook)
+	t.Cleanup(func() { logrus.StandardLogger().ReplaceHooks(previous) })
+	return hook
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string // LOG_REQUEST_ID_HEADER
+		incoming map[string]string
+		want     string
+	}{
+		{name: "incoming id preserved", header: RequestIDHeader, incoming: map[string]string{"X-Request-ID": "client-id-1"}, want: "client-id-1"},
+		{name: "missing id generated", header: RequestIDHeader, want: "generated-id"},
+		{name: "custom header", header: "X-Correlation-ID", incoming: map[string]string{"X-Correlation-ID": "corr-7"}, want: "corr-7"},
+		{name: "default header ignored with a custom one", header: "X-Correlation-ID", incoming: map[string]string{"X-Request-ID": "client-id-1"}, want: "generated-id"},
+		{name: "control characters stripped", header: RequestIDHeader, incoming: map[string]string{"X-Request-ID": "id-1\x1b[31m"}, want: "id-1[31m"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := captureStandardLog(t)
+			router := gin.New()
+			router.Use(RequestID(tt.header, func() string { return "generated-id" }))
+			router.Use(ContextLogger(types.LogConfig{}))
+			router.Any("/*path", func(c *gin.Context) {
+				GetLogger(c).Info("handling request")
+				RespondError(c, apierror.NewServerError(errors.ErrServerInternal, "failed"))
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+			for header, value := range tt.incoming {
+				req.Header.Set(header, value)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			if got := recorder.Header().Get(tt.header); got != tt.want {
+				t.Errorf("response %s = %q, want %q", tt.header, got, tt.want)
+			}
+			var body struct {
+				RequestID string `json:"request_id"`
+			}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil || body.RequestID != tt.want {
+				t.Errorf("error body %s, want request_id %q", recorder.Body.String(), tt.want)
+			}
+			entry := hook.LastEntry()
+			if entry == nil || entry.Data["request_id"] != tt.want {
+				t.Errorf("log entry %v, want request_id %q", entry, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"time"
+
+	"gpt-load/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// requestLogFields builds the structured fields of a request log entry,
+// keeping only the names listed in LOG_REQUEST_FIELDS
+func requestLogFields(c *gin.Context, include map[string]bool, start time.Time, latency time.Duration) logrus.Fields {
+	fields := logrus.Fields{}
+	for name := range include {
+		switch name {
+		case types.RequestLogFieldTimestamp:
+			fields[name] = start.Format(time.RFC3339Nano)
+		case types.RequestLogFieldMethod:
+			fields[name] = c.Request.Method
+		case types.RequestLogFieldPath:
+			fields[name] = c.Request.URL.Path
+		case types.RequestLogFieldStatus:
+			fields[name] = c.Writer.Status()
+		case types.RequestLogFieldUpstream:
+			if upstream := c.GetString("upstream"); upstream != "" {
+				fields[name] = upstream
+			}
+		case types.RequestLogFieldKeyID:
+			// The preview is already masked
+			if keyPreview := c.GetString("keyPreview"); keyPreview != "" {
+				fields[name] = keyPreview
+			}
+		case types.RequestLogFieldLatency:
+			fields[name] = float64(latency.Microseconds()) / 1000
+		case types.RequestLogFieldRequestID:
+			if requestID := GetRequestID(c); requestID != "" {
+				fields[name] = requestID
+			}
+		case types.RequestLogFieldClientIP:
+			fields[name] = c.ClientIP()
+		case types.RequestLogFieldModel:
+			if model := c.GetString("model"); model != "" {
+				fields[name] = model
+			}
+		}
+	}
+	return fields
+}
+
+// logStructuredRequest emits a single JSON-friendly entry for a finished request
+func logStructuredRequest(c *gin.Context, include map[string]bool, start time.Time, latency time.Duration) {
+	log := GetLogger(c)
+
+	// Start from the request-scoped fields, dropping built-in ones left out of LOG_REQUEST_FIELDS
+	data := make(logrus.Fields, len(log.Data))
+	for key, value := range log.Data {
+		if types.IsRequestLogField(key) && !include[key] {
+			continue
+		}
+		data[key] = value
+	}
+	for key, value := range requestLogFields(c, include, start, latency) {
+		data[key] = value
+	}
+	entry := log.Logger.WithFields(data)
+
+	statusCode := c.Writer.Status()
+	if statusCode >= 500 {
+		entry.Error("request")
+	} else if statusCode >= 400 {
+		entry.Warn("request")
+	} else {
+		entry.Info("request")
+	}
+}
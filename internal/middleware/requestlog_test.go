@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gpt-load/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func TestStructuredRequestLog(t *testing.T) {
+	// Each field with a check of its JSON type and value
+	checks := map[string]func(any) bool{
+		types.RequestLogFieldTimestamp: func(v any) bool {
+			s, ok := v.(string)
+			_, err := time.Parse(time.RFC3339Nano, s)
+			return ok && err == nil
+		},
+		types.RequestLogFieldMethod:    func(v any) bool { return v == http.MethodPost },
+		types.RequestLogFieldPath:      func(v any) bool { return v == "/v1/chat/completions" },
+		types.RequestLogFieldStatus:    func(v any) bool { _, ok := v.(float64); return ok },
+		types.RequestLogFieldUpstream:  func(v any) bool { return v == "https://api.openai.com" },
+		types.RequestLogFieldKeyID:     func(v any) bool { return v == "sk-a...7890" },
+		types.RequestLogFieldLatency:   func(v any) bool { ms, ok := v.(float64); return ok && ms >= 0 },
+		types.RequestLogFieldRequestID: func(v any) bool { return v == "req-1" },
+		types.RequestLogFieldClientIP:  func(v any) bool { return v == "192.0.2.1" },
+		types.RequestLogFieldModel:     func(v any) bool { return v == "gpt-4o" },
+	}
+	tests := []struct {
+		name      string
+		fields    []string
+		status    int
+		wantLevel string
+	}{
+		{name: "all fields", fields: types.RequestLogFields, status: http.StatusOK, wantLevel: "info"},
+		{name: "subset", fields: []string{types.RequestLogFieldMethod, types.RequestLogFieldStatus, types.RequestLogFieldLatency}, status: http.StatusOK, wantLevel: "info"},
+		{name: "client error", fields: types.RequestLogFields, status: http.StatusTooManyRequests, wantLevel: "warning"},
+		{name: "server error", fields: types.RequestLogFields, status: http.StatusBadGateway, wantLevel: "error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output bytes.Buffer
+			logger := logrus.New()
+			logger.SetOutput(&output)
+			logger.SetFormatter(&logrus.JSONFormatter{})
+
+			router := gin.New()
+			router.Use(RequestID(RequestIDHeader, func() string { return "req-1" }))
+			router.Use(func(c *gin.Context) {
+				// The request-scoped request_id is dropped when not listed
+				SetLogger(c, logrus.NewEntry(logger).WithField("request_id", GetRequestID(c)))
+			})
+			router.Use(Logger(types.LogConfig{EnableRequest: true, Format: "json", RequestFields: tt.fields}))
+			router.Any("/*path", func(c *gin.Context) {
+				c.Set("upstream", "https://api.openai.com")
+				c.Set("keyPreview", "sk-a...7890")
+				c.Set("model", "gpt-4o")
+				c.Status(tt.status)
+			})
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o"}`))
+			req.RemoteAddr = "192.0.2.1:4711"
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+			if len(lines) != 1 {
+				t.Fatalf("logged %d lines, want one entry per request:\n%s", len(lines), output.String())
+			}
+			var entry map[string]any
+			if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+				t.Fatalf("log line %q is not JSON: %v", lines[0], err)
+			}
+			if entry["level"] != tt.wantLevel {
+				t.Errorf("level = %v, want %s", entry["level"], tt.wantLevel)
+			}
+			if status, _ := entry[types.RequestLogFieldStatus].(float64); len(tt.fields) > 0 && int(status) != tt.status {
+				t.Errorf("status = %v, want %d", entry[types.RequestLogFieldStatus], tt.status)
+			}
+
+			included := make(map[string]bool)
+			for _, field := range tt.fields {
+				included[field] = true
+				if value, exists := entry[field]; !exists || !checks[field](value) {
+					t.Errorf("%s = %#v, want a valid value", field, value)
+				}
+			}
+			for _, field := range types.RequestLogFields {
+				if _, exists := entry[field]; exists && !included[field] {
+					t.Errorf("%s logged but not in LOG_REQUEST_FIELDS", field)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gpt-load/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Context keys linking a request to the RequestStats counting it
+const (
+	requestStatsKey  = "requestStats"
+	streamCountedKey = "streamCounted"
+)
+
+// RequestStats counts the requests handled by the proxy server since it started
+type RequestStats struct {
+	startTime time.Time
+	total     atomic.Int64
+	inFlight  atomic.Int64
+	streaming atomic.Int64
+	active    sync.WaitGroup
+}
+
+// NewRequestStats creates request counters starting now
+func NewRequestStats() *RequestStats {
+	return &RequestStats{startTime: time.Now()}
+}
+
+// Handler creates a middleware that counts every request while it is being served
+func (s *RequestStats) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s.total.Add(1)
+		s.inFlight.Add(1)
+		s.active.Add(1)
+		defer func() {
+			if c.GetBool(streamCountedKey) {
+				s.streaming.Add(-1)
+			}
+			s.inFlight.Add(-1)
+			s.active.Done()
+		}()
+		c.Set(requestStatsKey, s)
+		c.Next()
+	}
+}
+
+// MarkStreaming counts the request as a streaming response until it completes
+func MarkStreaming(c *gin.Context) {
+	value, _ := c.Get(requestStatsKey)
+	s, ok := value.(*RequestStats)
+	if !ok || c.GetBool(streamCountedKey) {
+		return
+	}
+	c.Set(streamCountedKey, true)
+	s.streaming.Add(1)
+}
+
+// Counts returns the total and in-flight request counts
+func (s *RequestStats) Counts() types.RequestCounts {
+	return types.RequestCounts{
+		Total:    s.total.Load(),
+		InFlight: s.inFlight.Load(),
+	}
+}
+
+// Streaming returns the number of streaming responses being written
+func (s *RequestStats) Streaming() int64 {
+	return s.streaming.Load()
+}
+
+// Wait blocks until every request being served has completed, including
+// hijacked connections such as WebSocket tunnels, or until ctx is done
+func (s *RequestStats) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.active.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Uptime returns how long the server has been running
+func (s *RequestStats) Uptime() time.Duration {
+	return time.Since(s.startTime)
+}
@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"gpt-load/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestStats(t *testing.T) {
+	stats := NewRequestStats()
+	// Requests to /hold wait until release is closed
+	held := make(chan struct{})
+	release := make(chan struct{})
+	router := gin.New()
+	router.Use(stats.Handler())
+	router.GET("/hold", func(c *gin.Context) {
+		MarkStreaming(c)
+		MarkStreaming(c) // Counted once
+		held <- struct{}{}
+		<-release
+	})
+	router.GET("/done", func(c *gin.Context) {})
+
+	serve := func(path string) {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	var wg sync.WaitGroup
+	tests := []struct {
+		name          string
+		run           func()
+		want          types.RequestCounts
+		wantStreaming int64
+	}{
+		{name: "idle", run: func() {}, want: types.RequestCounts{}},
+		{name: "completed requests", run: func() { serve("/done"); serve("/done") }, want: types.RequestCounts{Total: 2}},
+		{
+			name: "requests in flight",
+			run: func() {
+				for i := 0; i < 2; i++ {
+					wg.Add(1)
+					go func() { defer wg.Done(); serve("/hold") }()
+					<-held
+				}
+			},
+			want:          types.RequestCounts{Total: 4, InFlight: 2},
+			wantStreaming: 2,
+		},
+		{name: "in-flight requests finished", run: func() { close(release); wg.Wait() }, want: types.RequestCounts{Total: 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run()
+			if got := stats.Counts(); got != tt.want {
+				t.Errorf("counts = %+v, want %+v", got, tt.want)
+			}
+			if got := stats.Streaming(); got != tt.wantStreaming {
+				t.Errorf("streaming = %d, want %d", got, tt.wantStreaming)
+			}
+		})
+	}
+}
+
+func TestRequestStatsWait(t *testing.T) {
+	stats := NewRequestStats()
+	held := make(chan struct{})
+	release := make(chan struct{})
+	router := gin.New()
+	router.Use(stats.Handler())
+	router.GET("/hold", func(c *gin.Context) {
+		held <- struct{}{}
+		<-release
+	})
+	done := make(chan struct{})
+	go func() {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/hold", nil))
+		close(done)
+	}()
+	<-held
+
+	// The deadline passes while the request is still being served
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := stats.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait with a request in flight = %v, want the deadline", err)
+	}
+
+	close(release)
+	<-done
+	if err := stats.Wait(context.Background()); err != nil {
+		t.Errorf("Wait once every request finished = %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"sync/atomic"
+
+	"gpt-load/internal/apierror"
+	"gpt-load/internal/errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SelfTestHeader marks the startup self-test request
+const SelfTestHeader = "X-GPT-Load-Self-Test"
+
+// selfTestKey is the gin context key set on the self-test request
+const selfTestKey = "selfTest"
+
+// StartupGate holds back external traffic until the startup self-test has passed
+type StartupGate struct {
+	open atomic.Bool
+}
+
+// NewStartupGate creates a closed startup gate
+func NewStartupGate() *StartupGate {
+	return &StartupGate{}
+}
+
+// Open lets external traffic through
+func (g *StartupGate) Open() {
+	g.open.Store(true)
+}
+
+// Handler creates a middleware that rejects external requests while the gate is closed.
+// Only loopback requests carrying the self-test header are let through.
+func (g *StartupGate) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if g.open.Load() {
+			c.Next()
+			return
+		}
+
+		if c.GetHeader(SelfTestHeader) == "true" && isLoopbackRequest(c) {
+			c.Set(selfTestKey, true)
+			c.Next()
+			return
+		}
+
+		c.Header("Retry-After", "1")
+		apiErr := apierror.New(http.StatusServiceUnavailable, errors.ErrServerUnavailable, "Server is starting")
+		c.JSON(apiErr.Status, apiErr)
+		c.Abort()
+	}
+}
+
+// IsSelfTest reports whether the request is the startup self-test
+func IsSelfTest(c *gin.Context) bool {
+	return c.GetBool(selfTestKey)
+}
+
+// isLoopbackRequest reports whether the request came from the local host
+func isLoopbackRequest(c *gin.Context) bool {
+	host, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
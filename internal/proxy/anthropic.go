@@ -0,0 +1,471 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// anthropicChatPath is the OpenAI path translated to the Anthropic Messages API
+const anthropicChatPath = "/v1/chat/completions"
+
+// anthropicMessagesPath is the Anthropic Messages API path
+const anthropicMessagesPath = "/v1/messages"
+
+// Headers carrying the Anthropic API key and version
+const (
+	anthropicAPIKeyHeader  = "x-api-key"
+	anthropicVersionHeader = "anthropic-version"
+)
+
+// defaultAnthropicMaxTokens is sent when the client sets no limit, Anthropic requires one
+const defaultAnthropicMaxTokens = 4096
+
+// anthropicRequest is the subset of the Anthropic Messages API request that OpenAI requests map onto
+type anthropicRequest struct {
+	Model         string             `json:"model"`
+	System        string             `json:"system,omitempty"`
+	Messages      []anthropicMessage `json:"messages"`
+	MaxTokens     int                `json:"max_tokens"`
+	Temperature   *float64           `json:"temperature,omitempty"`
+	TopP          *float64           `json:"top_p,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Stream        bool               `json:"stream,omitempty"`
+	Metadata      *anthropicMetadata `json:"metadata,omitempty"`
+}
+
+// anthropicMessage is a single conversation turn, content is a string or content blocks
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content any    `json:"content"`
+}
+
+// anthropicMetadata identifies the end user to Anthropic
+type anthropicMetadata struct {
+	UserID string `json:"user_id"`
+}
+
+// anthropicContentBlock is a text or image content block
+type anthropicContentBlock struct {
+	Type   string                `json:"type"`
+	Text   string                `json:"text,omitempty"`
+	Source *anthropicImageSource `json:"source,omitempty"`
+}
+
+// anthropicImageSource is an inline base64 image or an image URL
+type anthropicImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// anthropicResponse is a non-streaming Anthropic Messages API response
+type anthropicResponse struct {
+	ID         string                  `json:"id"`
+	Model      string                  `json:"model"`
+	Content    []anthropicContentBlock `json:"content"`
+	StopReason string                  `json:"stop_reason"`
+	Usage      anthropicUsage          `json:"usage"`
+}
+
+// anthropicUsage reports token usage
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// anthropicError is the Anthropic error body
+type anthropicError struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// openAIChatRequest is the subset of the OpenAI chat completion request that is translated
+type openAIChatRequest struct {
+	Model               string          `json:"model"`
+	Messages            []openAIMessage `json:"messages"`
+	MaxTokens           int             `json:"max_tokens"`
+	MaxCompletionTokens int             `json:"max_completion_tokens"`
+	Temperature         *float64        `json:"temperature"`
+	TopP                *float64        `json:"top_p"`
+	Stop                json.RawMessage `json:"stop"`
+	Stream              bool            `json:"stream"`
+	User                string          `json:"user"`
+}
+
+// openAIMessage is a chat message, content is a string or content parts
+type openAIMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// openAIContentPart is a text or image_url content part
+type openAIContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	ImageURL struct {
+		URL string `json:"url"`
+	} `json:"image_url"`
+}
+
+// toAnthropicRequest translates an OpenAI chat completion request into an Anthropic
+// Messages API request, lifting system messages into the system prompt
+func toAnthropicRequest(body []byte) ([]byte, error) {
+	var request openAIChatRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, fmt.Errorf("invalid chat completion request: %w", err)
+	}
+
+	translated := anthropicRequest{
+		Model:       request.Model,
+		MaxTokens:   request.MaxCompletionTokens,
+		Temperature: request.Temperature,
+		TopP:        request.TopP,
+		Stream:      request.Stream,
+	}
+	if translated.MaxTokens == 0 {
+		translated.MaxTokens = request.MaxTokens
+	}
+	if translated.MaxTokens == 0 {
+		translated.MaxTokens = defaultAnthropicMaxTokens
+	}
+	if request.User != "" {
+		translated.Metadata = &anthropicMetadata{UserID: request.User}
+	}
+
+	stop, err := parseStopSequences(request.Stop)
+	if err != nil {
+		return nil, err
+	}
+	translated.StopSequences = stop
+
+	var system []string
+	for _, message := range request.Messages {
+		switch message.Role {
+		case "system", "developer":
+			text, err := textContent(message.Content)
+			if err != nil {
+				return nil, err
+			}
+			system = append(system, text)
+		case "user", "assistant":
+			content, err := anthropicContent(message.Content)
+			if err != nil {
+				return nil, err
+			}
+			translated.Messages = append(translated.Messages, anthropicMessage{Role: message.Role, Content: content})
+		default:
+			return nil, fmt.Errorf("message role %q is not supported by Anthropic upstreams", message.Role)
+		}
+	}
+	translated.System = strings.Join(system, "\n\n")
+
+	return json.Marshal(translated)
+}
+
+// parseStopSequences accepts the OpenAI stop parameter as a string or an array
+func parseStopSequences(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var single string
+	if json.Unmarshal(raw, &single) == nil {
+		return []string{single}, nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(raw, &multiple); err != nil {
+		return nil, fmt.Errorf("invalid stop parameter: %w", err)
+	}
+	return multiple, nil
+}
+
+// textContent flattens message content into plain text, for the system prompt
+func textContent(raw json.RawMessage) (string, error) {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return text, nil
+	}
+
+	var parts []openAIContentPart
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", fmt.Errorf("invalid message content: %w", err)
+	}
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// anthropicContent maps message content onto Anthropic content, keeping
+// plain strings as is and converting content parts to content blocks
+func anthropicContent(raw json.RawMessage) (any, error) {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return text, nil
+	}
+
+	var parts []openAIContentPart
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return nil, fmt.Errorf("invalid message content: %w", err)
+	}
+	blocks := make([]anthropicContentBlock, 0, len(parts))
+	for _, part := range parts {
+		switch part.Type {
+		case "text":
+			blocks = append(blocks, anthropicContentBlock{Type: "text", Text: part.Text})
+		case "image_url":
+			blocks = append(blocks, anthropicContentBlock{Type: "image", Source: anthropicImage(part.ImageURL.URL)})
+		default:
+			return nil, fmt.Errorf("content part type %q is not supported by Anthropic upstreams", part.Type)
+		}
+	}
+	return blocks, nil
+}
+
+// anthropicImage maps an image URL onto an image source, data URLs become inline base64 images
+func anthropicImage(imageURL string) *anthropicImageSource {
+	if rest, found := strings.CutPrefix(imageURL, "data:"); found {
+		if mediaType, data, found := strings.Cut(rest, ";base64,"); found {
+			return &anthropicImageSource{Type: "base64", MediaType: mediaType, Data: data}
+		}
+	}
+	return &anthropicImageSource{Type: "url", URL: imageURL}
+}
+
+// openAIFinishReason maps an Anthropic stop reason onto an OpenAI finish reason
+func openAIFinishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "":
+		return ""
+	default:
+		return "stop"
+	}
+}
+
+// fromAnthropicResponse translates an Anthropic message into an OpenAI chat completion
+func fromAnthropicResponse(body []byte) ([]byte, error) {
+	var response anthropicResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("invalid Anthropic response: %w", err)
+	}
+
+	var text strings.Builder
+	for _, block := range response.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+
+	return json.Marshal(map[string]any{
+		"id":      response.ID,
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   response.Model,
+		"choices": []map[string]any{{
+			"index":         0,
+			"message":       map[string]any{"role": "assistant", "content": text.String()},
+			"finish_reason": openAIFinishReason(response.StopReason),
+		}},
+		"usage": map[string]any{
+			"prompt_tokens":     response.Usage.InputTokens,
+			"completion_tokens": response.Usage.OutputTokens,
+			"total_tokens":      response.Usage.InputTokens + response.Usage.OutputTokens,
+		},
+	})
+}
+
+// fromAnthropicError translates an Anthropic error body into the OpenAI error shape,
+// bodies that are not Anthropic errors are returned unchanged
+func fromAnthropicError(body []byte) []byte {
+	var anthropic anthropicError
+	if err := json.Unmarshal(body, &anthropic); err != nil || anthropic.Error.Message == "" {
+		return body
+	}
+
+	translated, err := json.Marshal(map[string]any{
+		"error": map[string]any{
+			"message": anthropic.Error.Message,
+			"type":    anthropic.Error.Type,
+			"param":   nil,
+			"code":    nil,
+		},
+	})
+	if err != nil {
+		return body
+	}
+	return translated
+}
+
+// anthropicStream translates an Anthropic SSE stream into OpenAI chat completion chunks
+type anthropicStream struct {
+	source  io.ReadCloser
+	reader  *bufio.Reader
+	pending bytes.Buffer
+	data    []string
+	id      string
+	model   string
+	created int64
+	done    bool
+}
+
+// newAnthropicStream wraps an Anthropic streaming response body
+func newAnthropicStream(body io.ReadCloser) io.ReadCloser {
+	return &anthropicStream{
+		source:  body,
+		reader:  bufio.NewReader(body),
+		created: time.Now().Unix(),
+	}
+}
+
+// Read returns translated chunks, reading upstream events as needed
+func (s *anthropicStream) Read(p []byte) (int, error) {
+	for s.pending.Len() == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+
+		line, err := s.reader.ReadString('\n')
+		if line != "" {
+			s.processLine(strings.TrimRight(line, "\r\n"))
+		}
+		if err != nil {
+			// Dispatch a final event left without its terminating blank line
+			s.processLine("")
+			if s.pending.Len() > 0 {
+				break
+			}
+			return 0, err
+		}
+	}
+	return s.pending.Read(p)
+}
+
+// Close closes the upstream body
+func (s *anthropicStream) Close() error {
+	return s.source.Close()
+}
+
+// processLine collects data lines, dispatching the event at each blank line
+func (s *anthropicStream) processLine(line string) {
+	if line == "" {
+		if len(s.data) > 0 {
+			s.processEvent([]byte(strings.Join(s.data, "\n")))
+			s.data = s.data[:0]
+		}
+		return
+	}
+	// The event type is repeated in the data, so event lines are not needed
+	if data, found := strings.CutPrefix(line, "data:"); found {
+		s.data = append(s.data, strings.TrimPrefix(data, " "))
+	}
+}
+
+// processEvent translates a single Anthropic event
+func (s *anthropicStream) processEvent(data []byte) {
+	var event struct {
+		Type    string `json:"type"`
+		Message struct {
+			ID    string `json:"id"`
+			Model string `json:"model"`
+		} `json:"message"`
+		Delta struct {
+			Type       string `json:"type"`
+			Text       string `json:"text"`
+			StopReason string `json:"stop_reason"`
+		} `json:"delta"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return
+	}
+
+	switch event.Type {
+	case "message_start":
+		s.id, s.model = event.Message.ID, event.Message.Model
+		s.writeChunk(map[string]any{"role": "assistant", "content": ""}, nil)
+	case "content_block_delta":
+		if event.Delta.Type == "text_delta" {
+			s.writeChunk(map[string]any{"content": event.Delta.Text}, nil)
+		}
+	case "message_delta":
+		if event.Delta.StopReason != "" {
+			finishReason := openAIFinishReason(event.Delta.StopReason)
+			s.writeChunk(map[string]any{}, &finishReason)
+		}
+	case "message_stop":
+		s.pending.WriteString("data: [DONE]\n\n")
+		s.done = true
+	case "error":
+		s.pending.WriteString("data: ")
+		s.pending.Write(fromAnthropicError(data))
+		s.pending.WriteString("\n\n")
+		s.done = true
+	}
+}
+
+// writeChunk queues an OpenAI chat completion chunk
+func (s *anthropicStream) writeChunk(delta map[string]any, finishReason *string) {
+	chunk, err := json.Marshal(map[string]any{
+		"id":      s.id,
+		"object":  "chat.completion.chunk",
+		"created": s.created,
+		"model":   s.model,
+		"choices": []map[string]any{{
+			"index":         0,
+			"delta":         delta,
+			"finish_reason": finishReason,
+		}},
+	})
+	if err != nil {
+		return
+	}
+	s.pending.WriteString("data: ")
+	s.pending.Write(chunk)
+	s.pending.WriteString("\n\n")
+}
+
+// anthropicResponseBody translates a buffered non-streaming response on first read,
+// passing bodies that are not Anthropic messages through unchanged
+type anthropicResponseBody struct {
+	source     io.ReadCloser
+	translated *bytes.Reader
+}
+
+// newAnthropicResponseBody wraps an Anthropic non-streaming response body
+func newAnthropicResponseBody(body io.ReadCloser) io.ReadCloser {
+	return &anthropicResponseBody{source: body}
+}
+
+// Read returns the translated body
+func (b *anthropicResponseBody) Read(p []byte) (int, error) {
+	if b.translated == nil {
+		body, err := io.ReadAll(b.source)
+		if err != nil {
+			return 0, err
+		}
+		if translated, err := fromAnthropicResponse(body); err == nil {
+			body = translated
+		}
+		b.translated = bytes.NewReader(body)
+	}
+	return b.translated.Read(p)
+}
+
+// Close closes the upstream body
+func (b *anthropicResponseBody) Close() error {
+	return b.source.Close()
+}
@@ -0,0 +1,276 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestToAnthropicRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    string // Expected Anthropic request, compared as JSON
+		wantErr bool
+	}{
+		{
+			name: "system prompt lifted",
+			body: `{"model":"claude-3-5-sonnet","messages":[{"role":"system","content":"Be brief."},{"role":"developer","content":[{"type":"text","text":"Use English."}]},{"role":"user","content":"hi"}]}`,
+			want: `{"model":"claude-3-5-sonnet","system":"Be brief.\n\nUse English.","messages":[{"role":"user","content":"hi"}],"max_tokens":4096}`,
+		},
+		{
+			name: "roles and sampling kept",
+			body: `{"model":"claude","messages":[{"role":"user","content":"a"},{"role":"assistant","content":"b"},{"role":"user","content":"c"}],"temperature":0.2,"top_p":0.9,"stream":true,"user":"u-1"}`,
+			want: `{"model":"claude","messages":[{"role":"user","content":"a"},{"role":"assistant","content":"b"},{"role":"user","content":"c"}],"max_tokens":4096,"temperature":0.2,"top_p":0.9,"stream":true,"metadata":{"user_id":"u-1"}}`,
+		},
+		{
+			name: "max_tokens mapped",
+			body: `{"model":"claude","messages":[],"max_tokens":256}`,
+			want: `{"model":"claude","messages":null,"max_tokens":256}`,
+		},
+		{
+			name: "max_completion_tokens preferred",
+			body: `{"model":"claude","messages":[],"max_tokens":256,"max_completion_tokens":512}`,
+			want: `{"model":"claude","messages":null,"max_tokens":512}`,
+		},
+		{
+			name: "stop string",
+			body: `{"model":"claude","messages":[],"stop":"END"}`,
+			want: `{"model":"claude","messages":null,"max_tokens":4096,"stop_sequences":["END"]}`,
+		},
+		{
+			name: "stop array",
+			body: `{"model":"claude","messages":[],"stop":["END","STOP"]}`,
+			want: `{"model":"claude","messages":null,"max_tokens":4096,"stop_sequences":["END","STOP"]}`,
+		},
+		{
+			name: "content parts",
+			body: `{"model":"claude","messages":[{"role":"user","content":[{"type":"text","text":"what is this?"},{"type":"image_url","image_url":{"url":"data:image/png;base64,iVBOR"}},{"type":"image_url","image_url":{"url":"https://img.example/cat.png"}}]}]}`,
+			want: `{"model":"claude","messages":[{"role":"user","content":[{"type":"text","text":"what is this?"},{"type":"image","source":{"type":"base64","media_type":"image/png","data":"iVBOR"}},{"type":"image","source":{"type":"url","url":"https://img.example/cat.png"}}]}],"max_tokens":4096}`,
+		},
+		{name: "tool role", body: `{"model":"claude","messages":[{"role":"tool","content":"42"}]}`, wantErr: true},
+		{name: "audio part", body: `{"model":"claude","messages":[{"role":"user","content":[{"type":"input_audio"}]}]}`, wantErr: true},
+		{name: "bad stop", body: `{"model":"claude","messages":[],"stop":42}`, wantErr: true},
+		{name: "not json", body: `{"model":`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toAnthropicRequest([]byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("toAnthropicRequest error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				assertJSONEqual(t, got, tt.want)
+			}
+		})
+	}
+}
+
+// assertJSONEqual fails unless got and want hold the same JSON value
+func assertJSONEqual(t *testing.T, got []byte, want string) {
+	t.Helper()
+	var gotValue, wantValue any
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Fatalf("invalid JSON %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatalf("invalid expected JSON %s: %v", want, err)
+	}
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Errorf("got %s\nwant %s", got, want)
+	}
+}
+
+func TestFromAnthropicError(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "anthropic error",
+			body: `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+			want: `{"error":{"message":"Overloaded","type":"overloaded_error","param":null,"code":null}}`,
+		},
+		{name: "other body unchanged", body: `{"error":{"message":""}}`, want: `{"error":{"message":""}}`},
+		{name: "not json unchanged", body: `upstream unavailable`, want: `upstream unavailable`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fromAnthropicError([]byte(tt.body))
+			if json.Valid([]byte(tt.want)) {
+				assertJSONEqual(t, got, tt.want)
+			} else if string(got) != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// anthropicStreamEvents is a streamed Anthropic message saying "Hello world"
+const anthropicStreamEvents = "event: message_start\n" +
+	"data: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"model\":\"claude-3-5-sonnet\"}}\n\n" +
+	"event: content_block_start\n" +
+	"data: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"text\",\"text\":\"\"}}\n\n" +
+	"event: ping\n" +
+	"data: {\"type\":\"ping\"}\n\n" +
+	"event: content_block_delta\n" +
+	"data: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"Hello\"}}\n\n" +
+	"event: content_block_delta\n" +
+	"data: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\" world\"}}\n\n" +
+	"event: content_block_stop\n" +
+	"data: {\"type\":\"content_block_stop\",\"index\":0}\n\n" +
+	"event: message_delta\n" +
+	"data: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"},\"usage\":{\"output_tokens\":2}}\n\n" +
+	"event: message_stop\n" +
+	"data: {\"type\":\"message_stop\"}\n\n"
+
+func TestProxyAnthropicRoundTrip(t *testing.T) {
+	type chunk struct {
+		ID      string `json:"id"`
+		Object  string `json:"object"`
+		Model   string `json:"model"`
+		Choices []struct {
+			Delta        map[string]string `json:"delta"`
+			Message      map[string]string `json:"message"`
+			FinishReason *string           `json:"finish_reason"`
+		} `json:"choices"`
+		Usage map[string]int `json:"usage"`
+		Error struct {
+			Message string `json:"message"`
+			Type    string `json:"type"`
+		} `json:"error"`
+	}
+
+	tests := []struct {
+		name        string
+		body        string
+		status      int    // Upstream status
+		response    string // Upstream body
+		wantStatus  int
+		wantRequest string   // Anthropic request the upstream receives
+		wantEvents  []string // Content of each translated stream chunk, "[DONE]" for the end
+		check       func(t *testing.T, response chunk)
+	}{
+		{
+			name:        "completion",
+			body:        `{"model":"claude-3-5-sonnet","messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"hi"}],"max_tokens":64}`,
+			status:      http.StatusOK,
+			response:    `{"id":"msg_1","model":"claude-3-5-sonnet","content":[{"type":"text","text":"Hello"},{"type":"text","text":" world"}],"stop_reason":"max_tokens","usage":{"input_tokens":5,"output_tokens":2}}`,
+			wantStatus:  http.StatusOK,
+			wantRequest: `{"model":"claude-3-5-sonnet","system":"Be brief.","messages":[{"role":"user","content":"hi"}],"max_tokens":64}`,
+			check: func(t *testing.T, response chunk) {
+				if response.Object != "chat.completion" || response.ID != "msg_1" || len(response.Choices) != 1 {
+					t.Fatalf("response = %+v, want one chat.completion choice", response)
+				}
+				choice := response.Choices[0]
+				if choice.Message["role"] != "assistant" || choice.Message["content"] != "Hello world" || choice.FinishReason == nil || *choice.FinishReason != "length" {
+					t.Errorf("choice = %+v, want the assistant text finished by length", choice)
+				}
+				if response.Usage["prompt_tokens"] != 5 || response.Usage["completion_tokens"] != 2 || response.Usage["total_tokens"] != 7 {
+					t.Errorf("usage = %v", response.Usage)
+				}
+			},
+		},
+		{
+			name:        "stream",
+			body:        `{"model":"claude-3-5-sonnet","stream":true,"messages":[{"role":"user","content":"hi"}]}`,
+			status:      http.StatusOK,
+			response:    anthropicStreamEvents,
+			wantStatus:  http.StatusOK,
+			wantRequest: `{"model":"claude-3-5-sonnet","messages":[{"role":"user","content":"hi"}],"max_tokens":4096,"stream":true}`,
+			wantEvents:  []string{"", "Hello", " world", "finish:stop", "[DONE]"},
+		},
+		{
+			name:        "error",
+			body:        `{"model":"claude-3-5-sonnet","messages":[{"role":"user","content":"hi"}]}`,
+			status:      http.StatusBadRequest,
+			response:    `{"type":"error","error":{"type":"invalid_request_error","message":"max_tokens: too large"}}`,
+			wantStatus:  http.StatusBadRequest,
+			wantRequest: `{"model":"claude-3-5-sonnet","messages":[{"role":"user","content":"hi"}],"max_tokens":4096}`,
+			check: func(t *testing.T, response chunk) {
+				if response.Error.Message != "max_tokens: too large" || response.Error.Type != "invalid_request_error" {
+					t.Errorf("error = %+v, want the Anthropic error in the OpenAI shape", response.Error)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPath, gotKey, gotVersion, gotAuthorization string
+			var gotRequest []byte
+			router := newTestProxy(t, map[string]string{"UPSTREAM_TYPE": "anthropic", "MAX_RETRIES": "0"}, newTestKeyManager("sk-ant-0001"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath, gotKey, gotVersion, gotAuthorization = r.URL.Path, r.Header.Get("x-api-key"), r.Header.Get("anthropic-version"), r.Header.Get("Authorization")
+				gotRequest, _ = io.ReadAll(r.Body)
+				if strings.HasPrefix(tt.response, "event:") {
+					w.Header().Set("Content-Type", "text/event-stream")
+				} else {
+					w.Header().Set("Content-Type", "application/json")
+				}
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.response)
+			}))
+			proxy := httptest.NewServer(router)
+			t.Cleanup(proxy.Close)
+
+			req, _ := http.NewRequest(http.MethodPost, proxy.URL+"/v1/chat/completions", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer client-token")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("POST: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if gotPath != "/v1/messages" || gotKey != "sk-ant-0001" || gotVersion != "2023-06-01" || gotAuthorization != "" {
+				t.Errorf("upstream saw %s with x-api-key %q, anthropic-version %q, Authorization %q", gotPath, gotKey, gotVersion, gotAuthorization)
+			}
+			assertJSONEqual(t, gotRequest, tt.wantRequest)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+
+			if tt.wantEvents == nil {
+				var response chunk
+				if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+					t.Fatalf("decode response: %v", err)
+				}
+				tt.check(t, response)
+				return
+			}
+
+			var events []string
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				data, found := strings.CutPrefix(scanner.Text(), "data: ")
+				if !found {
+					continue
+				}
+				if data == "[DONE]" {
+					events = append(events, data)
+					continue
+				}
+				var event chunk
+				if err := json.Unmarshal([]byte(data), &event); err != nil {
+					t.Fatalf("invalid chunk %s: %v", data, err)
+				}
+				if event.Object != "chat.completion.chunk" || event.ID != "msg_1" || event.Model != "claude-3-5-sonnet" {
+					t.Errorf("chunk %s, want chat.completion.chunk of msg_1", data)
+				}
+				if reason := event.Choices[0].FinishReason; reason != nil {
+					events = append(events, "finish:"+*reason)
+				} else {
+					events = append(events, event.Choices[0].Delta["content"])
+				}
+			}
+			if !reflect.DeepEqual(events, tt.wantEvents) {
+				t.Errorf("events = %q, want %q", events, tt.wantEvents)
+			}
+		})
+	}
+}
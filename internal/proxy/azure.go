@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"gpt-load/internal/config"
+	"gpt-load/pkg/types"
+)
+
+// azureAPIKeyHeader carries the bare API key for Azure OpenAI
+const azureAPIKeyHeader = "api-key"
+
+// azureDeploymentPattern matches deployment names that are safe to place in a URL path
+var azureDeploymentPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// rewriteAzureURL maps an OpenAI request path onto the Azure OpenAI layout, e.g.
+// /v1/chat/completions -> /openai/deployments/<deployment>/chat/completions?api-version=<version>.
+// Requests without a model, such as /v1/models, go to /openai/models.
+func rewriteAzureURL(target *url.URL, basePath, requestPath, model string, openaiConfig types.OpenAIConfig) error {
+	prefix := strings.TrimSuffix(basePath, "/") + "/openai"
+	if model != "" {
+		deployment := model
+		if mapped, exists := openaiConfig.AzureDeployments[model]; exists {
+			deployment = mapped
+		}
+		if !azureDeploymentPattern.MatchString(deployment) {
+			return fmt.Errorf("invalid Azure deployment name %q", deployment)
+		}
+		prefix += "/deployments/" + deployment
+	}
+	target.Path = prefix + strings.TrimPrefix(requestPath, "/v1")
+
+	// An api-version sent by the client or UPSTREAM_QUERY_PARAMS wins
+	query := target.Query()
+	if query.Get("api-version") == "" {
+		query.Set("api-version", openaiConfig.AzureAPIVersion)
+	}
+	target.RawQuery = query.Encode()
+	return nil
+}
+
+// setUpstreamKey sets the header carrying the upstream API key, never forwarding the
+// caller's own credentials. Azure and Anthropic expect the bare key in their own
+// headers, other upstreams use UPSTREAM_KEY_HEADER and UPSTREAM_KEY_FORMAT.
+func setUpstreamKey(header http.Header, openaiConfig types.OpenAIConfig, key string) {
+	header.Del("Authorization")
+	switch openaiConfig.UpstreamType {
+	case config.UpstreamTypeAzure:
+		header.Set(azureAPIKeyHeader, key)
+	case config.UpstreamTypeAnthropic:
+		header.Set(anthropicAPIKeyHeader, key)
+		header.Set(anthropicVersionHeader, openaiConfig.AnthropicAPIVersion)
+	default:
+		header.Set(openaiConfig.KeyHeader, strings.ReplaceAll(openaiConfig.KeyFormat, "{key}", key))
+	}
+}
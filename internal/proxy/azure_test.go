@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProxyAzure(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		method    string
+		path      string
+		body      string
+		wantPath  string // Upstream path and query, empty when the request must not reach it
+		wantError int
+	}{
+		{
+			name:     "mapped deployment",
+			method:   http.MethodPost,
+			path:     "/v1/chat/completions",
+			body:     `{"model":"gpt-4","messages":[]}`,
+			wantPath: "/openai/deployments/prod-gpt4/chat/completions?api-version=2024-02-01",
+		},
+		{
+			name:     "unmapped model is the deployment",
+			method:   http.MethodPost,
+			path:     "/v1/embeddings",
+			body:     `{"model":"text-embedding-3-small","input":"hi"}`,
+			wantPath: "/openai/deployments/text-embedding-3-small/embeddings?api-version=2024-02-01",
+		},
+		{
+			name:     "model with colon maps after the last one",
+			method:   http.MethodPost,
+			path:     "/v1/chat/completions",
+			body:     `{"model":"ft:gpt-4o:acme","messages":[]}`,
+			wantPath: "/openai/deployments/acme-finetune/chat/completions?api-version=2024-02-01",
+		},
+		{
+			name:     "configured api version",
+			env:      map[string]string{"AZURE_API_VERSION": "2024-06-01"},
+			method:   http.MethodPost,
+			path:     "/v1/chat/completions",
+			body:     `{"model":"gpt-4","messages":[]}`,
+			wantPath: "/openai/deployments/prod-gpt4/chat/completions?api-version=2024-06-01",
+		},
+		{
+			name:     "client api version wins",
+			method:   http.MethodPost,
+			path:     "/v1/chat/completions?api-version=2023-05-15",
+			body:     `{"model":"gpt-4","messages":[]}`,
+			wantPath: "/openai/deployments/prod-gpt4/chat/completions?api-version=2023-05-15",
+		},
+		{
+			name:     "request without a model",
+			method:   http.MethodGet,
+			path:     "/v1/models",
+			wantPath: "/openai/models?api-version=2024-02-01",
+		},
+		{
+			name:      "unsafe deployment name",
+			method:    http.MethodPost,
+			path:      "/v1/chat/completions",
+			body:      `{"model":"../admin","messages":[]}`,
+			wantError: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPath, gotKey, gotAuthorization string
+			env := map[string]string{
+				"UPSTREAM_TYPE":        "azure",
+				"AZURE_DEPLOYMENT_MAP": "gpt-4:prod-gpt4,ft:gpt-4o:acme:acme-finetune",
+			}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			router := newTestProxy(t, env, newTestKeyManager("azure-key-0001"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.RequestURI()
+				gotKey = r.Header.Get("api-key")
+				gotAuthorization = r.Header.Get("Authorization")
+				w.Write([]byte(`{"choices":[]}`))
+			}))
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer client-token")
+			recorder := proxyRequest(router, req)
+
+			if tt.wantError != 0 {
+				if recorder.Code != tt.wantError || gotPath != "" {
+					t.Errorf("status = %d and upstream saw %q, want %d without reaching the upstream", recorder.Code, gotPath, tt.wantError)
+				}
+				return
+			}
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", recorder.Code, recorder.Body.String())
+			}
+			if gotPath != tt.wantPath {
+				t.Errorf("upstream path = %s, want %s", gotPath, tt.wantPath)
+			}
+			if gotKey != "azure-key-0001" || gotAuthorization != "" {
+				t.Errorf("api-key = %q, Authorization = %q, want only the api-key header", gotKey, gotAuthorization)
+			}
+		})
+	}
+}
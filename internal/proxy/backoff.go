@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gpt-load/pkg/types"
+)
+
+// retryDelay returns the wait before a retry, doubling the base delay for
+// each earlier retry up to maxDelay, plus random jitter of up to
+// jitterFactor x base. attempt is 0 for the first retry.
+func retryDelay(attempt int, base, maxDelay time.Duration, jitterFactor float64) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+
+	// Double step by step so large attempt counts cannot overflow
+	delay := base
+	for i := 0; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxDelay)
+
+	if jitter := time.Duration(jitterFactor * float64(base)); jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(jitter) + 1))
+	}
+	return delay
+}
+
+// sleepContext waits for d, returning false if ctx is done first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP
+// date, capped to maxDelay. ok is false when the header is missing or invalid.
+func parseRetryAfter(value string, maxDelay time.Duration) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	var delay time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		delay = time.Duration(min(seconds, math.MaxInt32)) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		delay = time.Until(date)
+	} else {
+		return 0, false
+	}
+	return min(max(delay, 0), maxDelay), true
+}
+
+// retryAfterSeconds reads a Retry-After header as whole seconds, rounded up.
+// It returns 0 when the header is missing, invalid or already in the past.
+func retryAfterSeconds(value string) int {
+	delay, ok := parseRetryAfter(value, math.MaxInt32*time.Second)
+	if !ok {
+		return 0
+	}
+	return int(math.Ceil(delay.Seconds()))
+}
+
+// maxRetryAfterSeconds returns the longest Retry-After the upstreams sent across all attempts
+func maxRetryAfterSeconds(retryErrors []types.RetryError) int {
+	longest := 0
+	for _, retryError := range retryErrors {
+		longest = max(longest, retryError.RetryAfterSeconds)
+	}
+	return longest
+}
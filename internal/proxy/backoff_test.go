@@ -0,0 +1,186 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gpt-load/pkg/types"
+)
+
+func TestRetryDelay(t *testing.T) {
+	const (
+		base     = 100 * time.Millisecond
+		maxDelay = 5 * time.Second
+	)
+	// Milliseconds before jitter for attempts 0-9
+	doubling := []time.Duration{100, 200, 400, 800, 1600, 3200, 5000, 5000, 5000, 5000}
+	tests := []struct {
+		name         string
+		base         time.Duration
+		jitterFactor float64
+		want         []time.Duration
+	}{
+		{name: "no jitter", base: base, want: doubling},
+		{name: "half jitter", base: base, jitterFactor: 0.5, want: doubling},
+		{name: "full jitter", base: base, jitterFactor: 1, want: doubling},
+		{name: "backoff disabled", jitterFactor: 1, want: []time.Duration{0, 0, 0, 0, 0, 0, 0, 0, 0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jitter := time.Duration(tt.jitterFactor * float64(tt.base))
+			for attempt, want := range tt.want {
+				low := want * time.Millisecond
+				high := low + jitter
+				// Enough draws to see the jitter spread when there is one
+				spread := false
+				for i := 0; i < 200; i++ {
+					delay := retryDelay(attempt, tt.base, maxDelay, tt.jitterFactor)
+					if delay < low || delay > high {
+						t.Fatalf("attempt %d delay = %v, want within [%v, %v]", attempt, delay, low, high)
+					}
+					spread = spread || delay != low
+				}
+				if spread != (jitter > 0) {
+					t.Errorf("attempt %d jittered = %v, want %v", attempt, spread, jitter > 0)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryDelayLargeAttempt(t *testing.T) {
+	if delay := retryDelay(1000, 100*time.Millisecond, 5*time.Second, 0); delay != 5*time.Second {
+		t.Errorf("retryDelay(1000) = %v, want the 5s cap", delay)
+	}
+}
+
+func TestSleepContext(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		delay time.Duration
+		want  bool
+	}{
+		{name: "elapsed", ctx: context.Background(), delay: time.Millisecond, want: true},
+		{name: "no delay", ctx: context.Background(), want: true},
+		{name: "canceled", ctx: canceled, delay: time.Hour},
+		{name: "canceled without delay", ctx: canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sleepContext(tt.ctx, tt.delay); got != tt.want {
+				t.Errorf("sleepContext = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryBackoffEndsOnDisconnect(t *testing.T) {
+	var attempts atomic.Int32
+	router := newTestProxy(t, map[string]string{
+		"MAX_RETRIES":         "3",
+		"RETRY_BASE_DELAY_MS": "10000",
+		"RETRY_MAX_DELAY_MS":  "10000",
+	}, newTestKeyManager("sk-a", "sk-b"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	proxyRequest(router, chatRequest().WithContext(ctx))
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("request took %v, want the backoff cut short by the disconnect", elapsed)
+	}
+	if got := attempts.Load(); got != 1 {
+		t.Errorf("upstream saw %d attempts, want 1", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	const maxDelay = 10 * time.Second
+	tests := []struct {
+		name   string
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{name: "missing"},
+		{name: "seconds", value: "3", want: 3 * time.Second, wantOK: true},
+		{name: "zero", value: "0", wantOK: true},
+		{name: "capped", value: "3600", want: maxDelay, wantOK: true},
+		{name: "negative", value: "-5", wantOK: true},
+		{name: "date in the past", value: "Wed, 21 Oct 2015 07:28:00 GMT", wantOK: true},
+		{name: "date far ahead", value: time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), want: maxDelay, wantOK: true},
+		{name: "invalid", value: "soon"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseRetryAfter(tt.value, maxDelay)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("parseRetryAfter(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	// A near date is roughly the time until it, to the second
+	got, ok := parseRetryAfter(time.Now().Add(5*time.Second).UTC().Format(http.TimeFormat), maxDelay)
+	if !ok || got < 3*time.Second || got > 5*time.Second {
+		t.Errorf("Retry-After five seconds ahead = %v, %v", got, ok)
+	}
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		min, max int // A date is read against the clock, so allow a second either way
+	}{
+		{name: "missing"},
+		{name: "seconds", value: "30", min: 30, max: 30},
+		{name: "zero", value: "0"},
+		{name: "beyond RETRY_MAX_DELAY_MS", value: "86400", min: 86400, max: 86400},
+		{name: "date ahead", value: time.Now().Add(90 * time.Second).UTC().Format(http.TimeFormat), min: 89, max: 91},
+		{name: "date in the past", value: "Wed, 21 Oct 2015 07:28:00 GMT"},
+		{name: "invalid", value: "tomorrow"},
+		{name: "fractional seconds", value: "1.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryAfterSeconds(tt.value); got < tt.min || got > tt.max {
+				t.Errorf("retryAfterSeconds(%q) = %d, want between %d and %d", tt.value, got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestMaxRetryAfterSeconds(t *testing.T) {
+	tests := []struct {
+		name        string
+		retryAfters []int
+		want        int
+	}{
+		{name: "no attempts"},
+		{name: "none sent", retryAfters: []int{0, 0}},
+		{name: "longest wins", retryAfters: []int{5, 30, 10}, want: 30},
+		{name: "some without", retryAfters: []int{0, 12, 0}, want: 12},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var retryErrors []types.RetryError
+			for i, retryAfter := range tt.retryAfters {
+				retryErrors = append(retryErrors, types.RetryError{StatusCode: http.StatusTooManyRequests, Attempt: i + 1, RetryAfterSeconds: retryAfter})
+			}
+			if got := maxRetryAfterSeconds(retryErrors); got != tt.want {
+				t.Errorf("maxRetryAfterSeconds = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
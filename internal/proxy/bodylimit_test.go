@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"gpt-load/internal/middleware"
+)
+
+func TestProxyRequestBodyLimit(t *testing.T) {
+	const limit = 2048
+	// A chat completion padded to size bytes
+	chatBody := func(size int) string {
+		prefix, suffix := `{"model":"gpt-4o","messages":[{"role":"user","content":"`, `"}]}`
+		return prefix + strings.Repeat("x", size-len(prefix)-len(suffix)) + suffix
+	}
+	tests := []struct {
+		name    string
+		env     map[string]string
+		size    int
+		chunked bool
+		want    int
+	}{
+		{name: "just under the limit", size: limit - 1, want: http.StatusOK},
+		{name: "just over the limit", size: limit + 1, want: http.StatusRequestEntityTooLarge},
+		{name: "chunked just under the limit", size: limit - 1, chunked: true, want: http.StatusOK},
+		{name: "chunked just over the limit", size: limit + 1, chunked: true, want: http.StatusRequestEntityTooLarge},
+		{name: "generic mode under the limit", env: map[string]string{"GENERIC_PROXY_MODE": "true"}, size: limit - 1, chunked: true, want: http.StatusOK},
+		{name: "generic mode over the limit", env: map[string]string{"GENERIC_PROXY_MODE": "true"}, size: limit + 1, chunked: true, want: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var upstreamCalls atomic.Int32
+			env := map[string]string{"MAX_REQUEST_BODY_BYTES": "2048", "MAX_RETRIES": "0"}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			router := newTestProxy(t, env, newTestKeyManager("sk-body-0001"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// Generic mode streams the body, so it only fails while the upstream reads it
+				if _, err := io.ReadAll(r.Body); err != nil {
+					return
+				}
+				upstreamCalls.Add(1)
+				w.Write([]byte(`{"choices":[]}`))
+			}))
+			router.Use(middleware.RequestBodyLimit(limit))
+			// A real server, the generic mode reverse proxy needs a connection
+			proxy := httptest.NewServer(router)
+			t.Cleanup(proxy.Close)
+
+			var body io.Reader = strings.NewReader(chatBody(tt.size))
+			if tt.chunked {
+				body = io.MultiReader(body) // Sent with chunked encoding
+			}
+			resp, err := http.Post(proxy.URL+"/v1/chat/completions", "application/json", body)
+			if err != nil {
+				t.Fatalf("POST: %v", err)
+			}
+			responseBody, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.want {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.want, responseBody)
+			}
+			wantCalls := int32(0)
+			if tt.want == http.StatusOK {
+				wantCalls = 1
+			}
+			if n := upstreamCalls.Load(); n != wantCalls {
+				t.Errorf("upstream answered %d requests, want %d", n, wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gpt-load/internal/apierror"
+	"gpt-load/internal/config"
+	"gpt-load/internal/errors"
+	"gpt-load/internal/metrics"
+	"gpt-load/internal/middleware"
+	"gpt-load/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Values of the result label of gptload_broadcast_requests_total
+const (
+	broadcastResultSuccess = "success"
+	broadcastResultFailed  = "failed"
+)
+
+// broadcastResult is a single upstream's answer to a broadcast request
+type broadcastResult struct {
+	index   int
+	keyInfo *types.KeyInfo
+	resp    *http.Response
+	err     error
+}
+
+// executeBroadcast sends the request to every upstream concurrently and returns
+// the first 2xx response, cancelling the others. When every upstream fails the
+// most common error status is returned along with all upstream errors.
+func (ps *ProxyServer) executeBroadcast(c *gin.Context, bodyBytes []byte) {
+	log := middleware.GetLogger(c)
+	openaiConfig := ps.configManager.GetOpenAIConfig()
+	upstreams := openaiConfig.BaseURLs
+
+	results := make(chan broadcastResult, len(upstreams))
+	cancels := make([]context.CancelFunc, len(upstreams))
+	defer func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}()
+	for i, upstream := range upstreams {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(openaiConfig.RequestTimeout)*time.Second)
+		cancels[i] = cancel
+		go func(index int, upstream string) {
+			result := ps.sendBroadcast(ctx, c, openaiConfig, upstream, bodyBytes)
+			result.index = index
+			results <- result
+		}(i, upstream)
+	}
+
+	var winner *broadcastResult
+	statusCounts := make(map[int]int)
+	var upstreamErrors []types.RetryError
+	received := 0
+	for received < len(upstreams) {
+		result := <-results
+		received++
+
+		if result.err == nil && result.resp.StatusCode >= 200 && result.resp.StatusCode < 300 {
+			winner = &result
+			break
+		}
+
+		statusCode, message := http.StatusBadGateway, ""
+		if result.err != nil {
+			message = result.err.Error()
+			if result.keyInfo != nil {
+				go ps.keyManager.RecordFailure(result.keyInfo.Key, result.err)
+			}
+		} else {
+			statusCode = result.resp.StatusCode
+			body, _ := io.ReadAll(io.LimitReader(result.resp.Body, 64*1024))
+			result.resp.Body.Close()
+			message = string(body)
+			go ps.keyManager.RecordFailure(result.keyInfo.Key, fmt.Errorf("HTTP %d", statusCode))
+		}
+		cancels[result.index]()
+
+		statusCounts[statusCode]++
+		keyIndex := -1
+		if result.keyInfo != nil {
+			keyIndex = result.keyInfo.Index
+		}
+		upstreamErrors = append(upstreamErrors, types.RetryError{
+			StatusCode:   statusCode,
+			ErrorMessage: message,
+			KeyIndex:     keyIndex,
+			Attempt:      1,
+		})
+	}
+
+	if winner == nil {
+		metrics.BroadcastRequests.WithLabelValues(broadcastResultFailed, costCenter(c.Request.Context())).Inc()
+		statusCode := majorityStatusCode(statusCounts)
+		log.Warnf("Broadcast request failed on all %d upstreams (returning HTTP %d)", len(upstreams), statusCode)
+		middleware.RespondError(c, apierror.NewUpstreamError(statusCode, errors.ErrProxyRetryExhausted, "All upstreams failed").
+			With("upstream_errors", upstreamErrors).
+			With("timestamp", time.Now().UTC().Format(time.RFC3339)))
+		return
+	}
+
+	// Cancel the slower upstreams and release whatever they still return
+	for i, cancel := range cancels {
+		if i != winner.index {
+			cancel()
+		}
+	}
+	go func(pending int) {
+		for ; pending > 0; pending-- {
+			if result := <-results; result.resp != nil {
+				result.resp.Body.Close()
+			}
+		}
+	}(len(upstreams) - received)
+
+	metrics.BroadcastRequests.WithLabelValues(broadcastResultSuccess, costCenter(c.Request.Context())).Inc()
+	go ps.keyManager.RecordSuccess(winner.keyInfo.Key)
+
+	resp := winner.resp
+	defer resp.Body.Close()
+	for key, values := range resp.Header {
+		for _, value := range values {
+			c.Header(key, value)
+		}
+	}
+	c.Status(resp.StatusCode)
+	ps.handleNormalResponse(c, resp)
+}
+
+// sendBroadcast sends one copy of a broadcast request to a single upstream
+func (ps *ProxyServer) sendBroadcast(ctx context.Context, c *gin.Context, openaiConfig types.OpenAIConfig, upstream string, bodyBytes []byte) broadcastResult {
+	keyInfo, err := ps.keyManager.GetNextKey()
+	if err != nil {
+		return broadcastResult{err: err}
+	}
+	// A successful response holds the key's concurrency slot until its body is closed
+	handedOff := false
+	defer func() {
+		if !handedOff {
+			keyInfo.Release()
+		}
+	}()
+
+	upstreamURL, err := url.Parse(upstream)
+	if err != nil {
+		return broadcastResult{keyInfo: keyInfo, err: err}
+	}
+	basePath := upstreamURL.Path
+	upstreamURL.Path = strings.TrimSuffix(basePath, "/") + c.Request.URL.Path
+	upstreamURL.RawQuery = mergeUpstreamQuery(c.Request.URL.RawQuery, ps.upstreamQuery)
+	if openaiConfig.UpstreamType == config.UpstreamTypeAzure {
+		if err := rewriteAzureURL(upstreamURL, basePath, c.Request.URL.Path, c.GetString("model"), openaiConfig); err != nil {
+			return broadcastResult{keyInfo: keyInfo, err: err}
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, c.Request.Method, upstreamURL.String(), bytes.NewReader(bodyBytes))
+	if err != nil {
+		return broadcastResult{keyInfo: keyInfo, err: err}
+	}
+	req.ContentLength = int64(len(bodyBytes))
+
+	for key, values := range c.Request.Header {
+		if key != "Host" && key != "Authorization" {
+			for _, value := range values {
+				req.Header.Add(key, value)
+			}
+		}
+	}
+	setUpstreamKey(req.Header, openaiConfig, keyInfo.Key)
+	setUpstreamUserAgent(req.Header, openaiConfig)
+	ps.setForwardedHeaders(req.Header, c.Request)
+	if openaiConfig.ForwardRequestIDToUpstream {
+		if requestID := middleware.GetRequestID(c); requestID != "" {
+			req.Header.Set(openaiConfig.UpstreamRequestIDHeader, requestID)
+		}
+	}
+
+	if ps.signer != nil {
+		if err := ps.signer.sign(ctx, req, bodyBytes); err != nil {
+			return broadcastResult{keyInfo: keyInfo, err: err}
+		}
+	}
+
+	resp, err := ps.httpClient.Do(req)
+	if err != nil {
+		err = redactUpstreamQuery(err, ps.upstreamQuery)
+		// Losing the race is not the key's fault
+		if stderrors.Is(err, context.Canceled) {
+			return broadcastResult{err: err}
+		}
+		return broadcastResult{keyInfo: keyInfo, err: err}
+	}
+	resp.Body = newLimitedBody(resp.Body, responseLimit(openaiConfig, upstream, ps.configManager.GetPerformanceConfig().MaxResponseBodyBytes))
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: keyInfo.Release}
+	handedOff = true
+	return broadcastResult{keyInfo: keyInfo, resp: resp}
+}
+
+// releasingBody runs release once the response body is closed
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+// Close closes the body and runs release
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
+
+// majorityStatusCode returns the most common status code, preferring the lower code on ties
+func majorityStatusCode(statusCounts map[int]int) int {
+	majority, majorityCount := http.StatusBadGateway, 0
+	for statusCode, count := range statusCounts {
+		if count > majorityCount || (count == majorityCount && statusCode < majority) {
+			majority, majorityCount = statusCode, count
+		}
+	}
+	return majority
+}
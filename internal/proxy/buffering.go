@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gpt-load/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bufferedWriter holds the whole response body for RESPONSE_BUFFERING=full,
+// flushes are ignored until the response is sent
+type bufferedWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+// Write buffers the data
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+// WriteString buffers the data
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// Flush does nothing, the body is sent once complete
+func (w *bufferedWriter) Flush() {}
+
+// sendBuffered restores the client's writer and sends the buffered response in
+// one write, with its exact Content-Length unless trailers follow
+func (ps *ProxyServer) sendBuffered(c *gin.Context, buffered *bufferedWriter) {
+	c.Writer = buffered.ResponseWriter
+
+	header := c.Writer.Header()
+	status := c.Writer.Status()
+	if header.Get("Trailer") == "" && status != http.StatusNoContent && status != http.StatusNotModified {
+		header.Set("Content-Length", strconv.Itoa(buffered.body.Len()))
+	}
+	// The body may have taken most of the write timeout to arrive
+	ps.extendWriteDeadline(c)
+
+	c.Writer.WriteHeaderNow()
+	if _, err := c.Writer.Write(buffered.body.Bytes()); err != nil {
+		middleware.GetLogger(c).Debugf("Failed to write buffered response: %v", err)
+	}
+}
+
+// deadlineFlusher extends the server's write deadline on every flush, so a
+// response that keeps making progress is not cut off by SERVER_WRITE_TIMEOUT
+type deadlineFlusher struct {
+	flusher http.Flusher
+	ps      *ProxyServer
+	c       *gin.Context
+}
+
+// Flush sends buffered data to the client and extends the write deadline
+func (f deadlineFlusher) Flush() {
+	f.flusher.Flush()
+	f.ps.extendWriteDeadline(f.c)
+}
+
+// extendWriteDeadline moves the write deadline SERVER_WRITE_TIMEOUT past now
+func (ps *ProxyServer) extendWriteDeadline(c *gin.Context) {
+	timeout := time.Duration(ps.configManager.GetServerConfig().WriteTimeout) * time.Second
+	if timeout <= 0 {
+		return
+	}
+	// Unsupported when a wrapper hides the connection, the original deadline then applies
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Now().Add(timeout))
+}
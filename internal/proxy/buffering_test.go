@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slowUpstream writes chunks with pause between them, flushing each one
+func slowUpstream(contentType string, chunks []string, pause time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		for i, chunk := range chunks {
+			if i > 0 {
+				time.Sleep(pause)
+			}
+			w.Write([]byte(chunk))
+			w.(http.Flusher).Flush()
+		}
+	}
+}
+
+func TestResponseBuffering(t *testing.T) {
+	const pause = 400 * time.Millisecond
+	tests := []struct {
+		name        string
+		mode        string
+		stream      bool
+		contentType string
+		chunks      []string
+		wantEarly   bool // The first chunk arrives before the upstream pauses
+	}{
+		{name: "none passes stream chunks on", mode: "none", stream: true, contentType: "text/event-stream", chunks: []string{"data: a\n\n", "data: [DONE]\n\n"}, wantEarly: true},
+		{name: "none passes response chunks on", mode: "none", contentType: "application/json", chunks: []string{`{"choices":`, `[]}`}, wantEarly: true},
+		{name: "full holds the stream back", mode: "full", stream: true, contentType: "text/event-stream", chunks: []string{"data: a\n\n", "data: [DONE]\n\n"}},
+		{name: "full holds the response back", mode: "full", contentType: "application/json", chunks: []string{`{"choices":`, `[]}`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"RESPONSE_BUFFERING": tt.mode, "SSE_HEARTBEAT_INTERVAL_SECONDS": "0"}
+			router := newTestProxy(t, env, newTestKeyManager("sk-buffer"), slowUpstream(tt.contentType, tt.chunks, pause))
+			proxy := httptest.NewServer(router)
+			t.Cleanup(proxy.Close)
+
+			body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`
+			if tt.stream {
+				body = `{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"hi"}]}`
+			}
+			start := time.Now()
+			resp, err := http.Post(proxy.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+			if err != nil {
+				t.Fatalf("POST: %v", err)
+			}
+			defer resp.Body.Close()
+
+			reader := bufio.NewReader(resp.Body)
+			first := make([]byte, len(tt.chunks[0]))
+			if _, err := io.ReadFull(reader, first); err != nil {
+				t.Fatalf("read the first chunk: %v", err)
+			}
+			firstAt := time.Since(start)
+			rest, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("read the rest: %v", err)
+			}
+			if got, want := string(first)+string(rest), strings.Join(tt.chunks, ""); got != want {
+				t.Errorf("body = %q, want %q", got, want)
+			}
+
+			if early := firstAt < pause/2; early != tt.wantEarly {
+				t.Errorf("first chunk after %v, want before the upstream's pause = %v", firstAt, tt.wantEarly)
+			}
+			// Only a complete response can say how long it is
+			if full := resp.ContentLength == int64(len(strings.Join(tt.chunks, ""))); full == tt.wantEarly {
+				t.Errorf("Content-Length = %d in %s mode", resp.ContentLength, tt.mode)
+			}
+		})
+	}
+}
+
+func TestResponseBufferingExtendsWriteDeadline(t *testing.T) {
+	// Six chunks 300ms apart outlast a one second write timeout
+	chunks := []string{"data: 1\n\n", "data: 2\n\n", "data: 3\n\n", "data: 4\n\n", "data: 5\n\n", "data: [DONE]\n\n"}
+	env := map[string]string{"RESPONSE_BUFFERING": "none", "SERVER_WRITE_TIMEOUT": "1", "SSE_HEARTBEAT_INTERVAL_SECONDS": "0"}
+	router := newTestProxy(t, env, newTestKeyManager("sk-buffer"), slowUpstream("text/event-stream", chunks, 300*time.Millisecond))
+	proxy := httptest.NewUnstartedServer(router)
+	proxy.Config.WriteTimeout = time.Second
+	proxy.Start()
+	t.Cleanup(proxy.Close)
+
+	resp, err := http.Post(proxy.URL+"/v1/chat/completions", "application/json", strings.NewReader(`{"model":"gpt-4o","stream":true,"messages":[]}`))
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("stream cut off after %q: %v", body, err)
+	}
+	if want := strings.Join(chunks, ""); string(body) != want {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+}
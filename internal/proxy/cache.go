@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+
+	"gpt-load/internal/cache"
+	"gpt-load/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Response cache lookup results, used as metric label values
+const (
+	cacheResultHit  = "hit"
+	cacheResultMiss = "miss"
+)
+
+// cacheablePath is the only request path whose responses are cached
+const cacheablePath = "/v1/chat/completions"
+
+// isCacheable reports whether a request may be answered from the response cache
+func (ps *ProxyServer) isCacheable(c *gin.Context, isStreamRequest bool) bool {
+	return ps.responseCache != nil && !isStreamRequest &&
+		c.Request.Method == http.MethodPost && c.Request.URL.Path == cacheablePath
+}
+
+// cacheKey hashes the canonical form of a JSON body, so key order and
+// whitespace don't cause misses; a body that isn't JSON is hashed as is
+func cacheKey(bodyBytes []byte) string {
+	canonical := bodyBytes
+	var parsed any
+	if err := json.Unmarshal(bodyBytes, &parsed); err == nil {
+		if encoded, err := json.Marshal(parsed); err == nil {
+			canonical = encoded
+		}
+	}
+	digest := sha256.Sum256(canonical)
+	return hex.EncodeToString(digest[:])
+}
+
+// executeCached answers the request from the response cache, or runs execute
+// and caches a successful response
+func (ps *ProxyServer) executeCached(c *gin.Context, bodyBytes []byte, execute func()) {
+	key := cacheKey(bodyBytes)
+	if entry, hit := ps.responseCache.Get(key); hit {
+		metrics.CacheRequests.WithLabelValues(cacheResultHit, costCenter(c.Request.Context())).Inc()
+
+		// Headers of this request, such as its request ID, take precedence
+		for name, values := range entry.Header {
+			if _, exists := c.Writer.Header()[name]; !exists {
+				c.Writer.Header()[name] = values
+			}
+		}
+		c.Header("X-GPT-Load-Cache", "HIT")
+		c.Status(entry.Status)
+		c.Writer.Write(entry.Body)
+		return
+	}
+	metrics.CacheRequests.WithLabelValues(cacheResultMiss, costCenter(c.Request.Context())).Inc()
+
+	c.Header("X-GPT-Load-Cache", "MISS")
+	writer := &captureWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+	execute()
+	c.Writer = writer.ResponseWriter
+
+	if writer.Status() == http.StatusOK {
+		ps.responseCache.Set(key, &cache.Entry{
+			Status: writer.Status(),
+			Header: writer.Header().Clone(),
+			Body:   writer.body.Bytes(),
+		})
+	}
+}
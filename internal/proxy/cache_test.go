@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCacheKey(t *testing.T) {
+	base := `{"model":"gpt-4o","temperature":0.2,"messages":[{"role":"user","content":"hi"}]}`
+	tests := []struct {
+		name string
+		body string
+		same bool
+	}{
+		{name: "identical", body: base, same: true},
+		{name: "whitespace", body: "{ \"model\": \"gpt-4o\",\n \"temperature\": 0.2, \"messages\": [{\"role\": \"user\", \"content\": \"hi\"}] }", same: true},
+		{name: "key order", body: `{"messages":[{"content":"hi","role":"user"}],"temperature":0.2,"model":"gpt-4o"}`, same: true},
+		{name: "model changed", body: `{"model":"gpt-4o-mini","temperature":0.2,"messages":[{"role":"user","content":"hi"}]}`},
+		{name: "temperature changed", body: `{"model":"gpt-4o","temperature":0.3,"messages":[{"role":"user","content":"hi"}]}`},
+		{name: "content changed", body: `{"model":"gpt-4o","temperature":0.2,"messages":[{"role":"user","content":"hi!"}]}`},
+		{name: "role changed", body: `{"model":"gpt-4o","temperature":0.2,"messages":[{"role":"system","content":"hi"}]}`},
+		{name: "field added", body: `{"model":"gpt-4o","temperature":0.2,"messages":[{"role":"user","content":"hi"}],"user":"alice"}`},
+		{name: "field removed", body: `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`},
+		{name: "message order", body: `{"model":"gpt-4o","temperature":0.2,"messages":[{"role":"user","content":"hi"},{"role":"user","content":"hi"}]}`},
+		{name: "not json", body: `model=gpt-4o`},
+	}
+	want := cacheKey([]byte(base))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if same := cacheKey([]byte(tt.body)) == want; same != tt.same {
+				t.Errorf("same cache key = %v, want %v", same, tt.same)
+			}
+		})
+	}
+}
+
+func TestProxyResponseCache(t *testing.T) {
+	const body = `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`
+	// Each step sends one request through the same proxy
+	steps := []struct {
+		name        string
+		method      string
+		path        string
+		body        string
+		wantCache   string // X-GPT-Load-Cache, empty when the cache is bypassed
+		wantForward bool   // Whether the request reached the upstream with a key
+	}{
+		{name: "first request", body: body, wantCache: "MISS", wantForward: true},
+		{name: "repeat served from cache", body: body, wantCache: "HIT"},
+		{name: "reordered body served from cache", body: `{"messages":[{"content":"hi","role":"user"}],"model":"gpt-4o"}`, wantCache: "HIT"},
+		{name: "changed field", body: `{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}]}`, wantCache: "MISS", wantForward: true},
+		{name: "streaming bypasses", body: `{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"hi"}]}`, wantForward: true},
+		{name: "streaming repeat bypasses", body: `{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"hi"}]}`, wantForward: true},
+		{name: "other path bypasses", path: "/v1/embeddings", body: body, wantForward: true},
+		{name: "error not cached", body: `{"model":"fail","messages":[]}`, wantCache: "MISS", wantForward: true},
+		{name: "error repeat forwarded", body: `{"model":"fail","messages":[]}`, wantCache: "MISS", wantForward: true},
+	}
+
+	var forwarded atomic.Int32
+	keyManager := newTestKeyManager("sk-a", "sk-b")
+	router := newTestProxy(t, map[string]string{"CACHE_ENABLED": "true", "MAX_RETRIES": "0"}, keyManager, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded.Add(1)
+		if requestBody, _ := io.ReadAll(r.Body); strings.Contains(string(requestBody), `"fail"`) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"message":"bad model"}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"hello"}}]}`))
+	}))
+	for _, step := range steps {
+		path := step.path
+		if path == "" {
+			path = "/v1/chat/completions"
+		}
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(step.body))
+		req.Header.Set("Content-Type", "application/json")
+		forwardedBefore, picksBefore := forwarded.Load(), keyManager.picks()
+		recorder := proxyRequest(router, req)
+
+		if got := recorder.Header().Get("X-GPT-Load-Cache"); got != step.wantCache {
+			t.Errorf("%s: X-GPT-Load-Cache = %q, want %q", step.name, got, step.wantCache)
+		}
+		if got := forwarded.Load() > forwardedBefore; got != step.wantForward {
+			t.Errorf("%s: forwarded = %v, want %v", step.name, got, step.wantForward)
+		}
+		if got := keyManager.picks() > picksBefore; got != step.wantForward {
+			t.Errorf("%s: key used = %v, want %v", step.name, got, step.wantForward)
+		}
+		if step.wantCache == "HIT" && (recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), "hello")) {
+			t.Errorf("%s: cached response %d %s", step.name, recorder.Code, recorder.Body.String())
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"gpt-load/internal/errors"
+	"gpt-load/pkg/types"
+)
+
+// limitedKeyManager is a testKeyManager handing out each key to at most limit
+// requests at a time, like KEY_MAX_CONCURRENT
+type limitedKeyManager struct {
+	*testKeyManager
+
+	limit    int
+	mu       sync.Mutex
+	inFlight map[string]int
+}
+
+func (km *limitedKeyManager) GetNextKey() (*types.KeyInfo, error) {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	for range km.keys {
+		keyInfo, err := km.testKeyManager.GetNextKey()
+		if err != nil {
+			return nil, err
+		}
+		if km.inFlight[keyInfo.Key] >= km.limit {
+			continue
+		}
+		km.inFlight[keyInfo.Key]++
+		var once sync.Once
+		keyInfo.Release = func() {
+			once.Do(func() {
+				km.mu.Lock()
+				defer km.mu.Unlock()
+				km.inFlight[keyInfo.Key]--
+			})
+		}
+		return keyInfo, nil
+	}
+	return nil, errors.ErrAllAPIKeysBusy
+}
+
+// held returns the number of key slots currently taken
+func (km *limitedKeyManager) held() int {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	total := 0
+	for _, n := range km.inFlight {
+		total += n
+	}
+	return total
+}
+
+func TestProxyKeyConcurrencyLimit(t *testing.T) {
+	km := &limitedKeyManager{testKeyManager: newTestKeyManager("sk-busy-0001", "sk-busy-0002"), limit: 1, inFlight: map[string]int{}}
+	// The upstream holds each request until the channel it hands to the test is closed
+	started := make(chan chan struct{})
+	router := newTestProxy(t, map[string]string{"MAX_RETRIES": "2"}, km, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		answer := make(chan struct{})
+		started <- answer
+		<-answer
+		w.Write([]byte(`{"choices":[]}`))
+	}))
+
+	// Saturate both keys
+	results := make(chan int, 2)
+	var pending []chan struct{}
+	for i := 0; i < 2; i++ {
+		go func() { results <- proxyRequest(router, chatRequest()).Code }()
+		pending = append(pending, <-started)
+	}
+
+	tests := []struct {
+		name       string
+		before     func()
+		wantStatus int
+	}{
+		{name: "all keys saturated", wantStatus: http.StatusTooManyRequests},
+		{
+			name: "slot released",
+			before: func() {
+				close(pending[0])
+				if status := <-results; status != http.StatusOK {
+					t.Fatalf("saturating request status = %d, want 200", status)
+				}
+			},
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.before != nil {
+				tt.before()
+			}
+			done := make(chan int)
+			go func() { done <- proxyRequest(router, chatRequest()).Code }()
+			if tt.wantStatus == http.StatusOK {
+				select {
+				case answer := <-started:
+					close(answer)
+				case <-time.After(5 * time.Second):
+					t.Fatal("request never reached the upstream after a slot was released")
+				}
+			}
+			if status := <-done; status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+		})
+	}
+
+	close(pending[1])
+	if status := <-results; status != http.StatusOK {
+		t.Errorf("saturating request status = %d, want 200", status)
+	}
+	if n := km.held(); n != 0 {
+		t.Errorf("%d key slots still held after every request finished", n)
+	}
+}
@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"context"
+	stderrors "errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"gpt-load/internal/dns"
+	"gpt-load/internal/metrics"
+	"gpt-load/internal/middleware"
+	"gpt-load/pkg/types"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+// errConnectRateLimited is returned when an upstream's connect budget is exhausted
+var errConnectRateLimited = stderrors.New("upstream connect rate limit exceeded")
+
+// errTLSHandshakeTimeout is returned when the upstream TLS handshake outlives its timeout
+var errTLSHandshakeTimeout = stderrors.New("upstream TLS handshake timeout")
+
+// defaultDialTimeout bounds TCP connection setup when UPSTREAM_CONNECT_TIMEOUT_MS is unset
+const defaultDialTimeout = 30 * time.Second
+
+// dialFunc matches http.Transport.DialContext
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// connectLimiter applies a token bucket per upstream address to connection
+// establishment, so a failing upstream is not hammered with new connections
+type connectLimiter struct {
+	limit    rate.Limit
+	burst    int
+	limiters sync.Map // addr -> *rate.Limiter
+}
+
+// newConnectLimiter creates a limiter allowing attemptsPerSecond new connections per upstream
+func newConnectLimiter(attemptsPerSecond int) *connectLimiter {
+	return &connectLimiter{
+		limit: rate.Limit(attemptsPerSecond),
+		burst: attemptsPerSecond,
+	}
+}
+
+// wrap returns a dial function that rejects connections over the budget
+func (cl *connectLimiter) wrap(dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		limiter, _ := cl.limiters.LoadOrStore(addr, rate.NewLimiter(cl.limit, cl.burst))
+		if !limiter.(*rate.Limiter).Allow() {
+			metrics.UpstreamConnectRateLimited.WithLabelValues(addr, costCenter(ctx)).Inc()
+			logrus.Debugf("Connect rate limit exceeded for upstream %s", addr)
+			return nil, errConnectRateLimited
+		}
+		return dial(ctx, network, addr)
+	}
+}
+
+// resolvingDial returns a dial function resolving host names through the cache
+// and trying each address in turn, IP addresses are dialled as they are
+func resolvingDial(resolver *dns.Resolver, dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			return dial(ctx, network, addr)
+		}
+
+		addrs, err := resolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+		}
+		var firstErr error
+		for _, ip := range addrs {
+			conn, err := dial(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		return nil, firstErr
+	}
+}
+
+// costCenter returns the cost_center model tag of a request, used as a metric label
+func costCenter(ctx context.Context) string {
+	return middleware.ModelTagsFromContext(ctx)["cost_center"]
+}
+
+// connectTimeouts returns the TCP dial and TLS handshake timeouts. UPSTREAM_CONNECT_TIMEOUT_MS
+// bounds both phases when set, otherwise dialing gets 30s and the handshake RESPONSE_TIMEOUT.
+func connectTimeouts(openaiConfig types.OpenAIConfig) (dial, handshake time.Duration) {
+	if openaiConfig.UpstreamConnectTimeoutMs > 0 {
+		timeout := time.Duration(openaiConfig.UpstreamConnectTimeoutMs) * time.Millisecond
+		return timeout, timeout
+	}
+	return defaultDialTimeout, time.Duration(openaiConfig.ResponseTimeout) * time.Second
+}
+
+// isConnectError reports whether a request failed before a connection to the
+// upstream was established, which says nothing about the key it carried
+func isConnectError(err error) bool {
+	var opErr *net.OpError
+	if stderrors.As(err, &opErr) && opErr.Op == "dial" || stderrors.Is(err, errTLSHandshakeTimeout) {
+		return true
+	}
+	// net/http does not export its TLS handshake timeout error
+	return strings.Contains(err.Error(), "TLS handshake timeout")
+}
@@ -0,0 +1,248 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gpt-load/pkg/types"
+)
+
+func TestConnectTimeouts(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        types.OpenAIConfig
+		wantDial      time.Duration
+		wantHandshake time.Duration
+	}{
+		{name: "defaults", config: types.OpenAIConfig{ResponseTimeout: 30}, wantDial: 30 * time.Second, wantHandshake: 30 * time.Second},
+		{name: "handshake follows RESPONSE_TIMEOUT", config: types.OpenAIConfig{ResponseTimeout: 5}, wantDial: 30 * time.Second, wantHandshake: 5 * time.Second},
+		{name: "connect timeout bounds both", config: types.OpenAIConfig{ResponseTimeout: 30, UpstreamConnectTimeoutMs: 250}, wantDial: 250 * time.Millisecond, wantHandshake: 250 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dial, handshake := connectTimeouts(tt.config)
+			if dial != tt.wantDial || handshake != tt.wantHandshake {
+				t.Errorf("connectTimeouts = %v, %v, want %v, %v", dial, handshake, tt.wantDial, tt.wantHandshake)
+			}
+		})
+	}
+}
+
+func TestIsConnectError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "dial refused", err: fmt.Errorf("Post: %w", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}), want: true},
+		{name: "dial timeout", err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("i/o timeout")}, want: true},
+		{name: "TLS handshake timeout", err: errors.New("net/http: TLS handshake timeout"), want: true},
+		{name: "upstream TLS handshake timeout", err: &url.Error{Op: "Post", URL: "https://upstream", Err: errTLSHandshakeTimeout}, want: true},
+		{name: "read reset", err: &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}},
+		{name: "response header timeout", err: errors.New("net/http: timeout awaiting response headers")},
+		{name: "connect rate limited", err: errConnectRateLimited},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isConnectError(tt.err); got != tt.want {
+				t.Errorf("isConnectError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// slowAcceptListener hands out every connection after delay, so the TCP
+// connection is up but the TLS handshake waits like on an overloaded upstream
+type slowAcceptListener struct {
+	net.Listener
+	delay    time.Duration
+	accepted atomic.Int64
+	conns    chan net.Conn
+	done     chan struct{}
+}
+
+func newSlowAcceptListener(inner net.Listener, delay time.Duration) *slowAcceptListener {
+	l := &slowAcceptListener{Listener: inner, delay: delay, conns: make(chan net.Conn), done: make(chan struct{})}
+	go func() {
+		defer close(l.done)
+		for {
+			conn, err := inner.Accept()
+			if err != nil {
+				return
+			}
+			l.accepted.Add(1)
+			// Each connection waits on its own so one slow handshake does not hold up the next
+			go func() {
+				time.Sleep(l.delay)
+				select {
+				case l.conns <- conn:
+				case <-l.done:
+					conn.Close()
+				}
+			}()
+		}
+	}()
+	return l
+}
+
+func (l *slowAcceptListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// newSlowTLSUpstream starts a TLS upstream that accepts connections after delay
+func newSlowTLSUpstream(t *testing.T, delay time.Duration) (*httptest.Server, *slowAcceptListener) {
+	t.Helper()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"slow","choices":[]}`))
+	}))
+	listener := newSlowAcceptListener(server.Listener, delay)
+	server.Listener = listener
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server, listener
+}
+
+// closedURL returns the URL of a port nothing listens on
+func closedURL(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	listener.Close()
+	return "http://" + listener.Addr().String()
+}
+
+func TestUpstreamConnectTimeout(t *testing.T) {
+	slow, slowListener := newSlowTLSUpstream(t, 2*time.Second)
+	quick, _ := newSlowTLSUpstream(t, 50*time.Millisecond)
+	tests := []struct {
+		name       string
+		env        map[string]string
+		wantStatus int
+		wantID     string // Upstream that answered, "good" for the plain upstream
+	}{
+		{
+			name:       "handshake timeout retried on the next upstream",
+			env:        map[string]string{"UPSTREAM_CONNECT_TIMEOUT_MS": "150", "OPENAI_BASE_URL": slow.URL + ",{upstream}"},
+			wantStatus: http.StatusOK, wantID: "good",
+		},
+		{
+			name: "handshake timeout with upstream TLS settings",
+			env: map[string]string{
+				"UPSTREAM_CONNECT_TIMEOUT_MS": "150", "UPSTREAM_TLS_SKIP_VERIFY": "true", "OPENAI_BASE_URL": slow.URL + ",{upstream}",
+			},
+			wantStatus: http.StatusOK, wantID: "good",
+		},
+		{
+			name:       "slow accept within the timeout",
+			env:        map[string]string{"UPSTREAM_CONNECT_TIMEOUT_MS": "1000", "UPSTREAM_TLS_SKIP_VERIFY": "true", "OPENAI_BASE_URL": quick.URL},
+			wantStatus: http.StatusOK, wantID: "slow",
+		},
+		{
+			name:       "refused connection retried on the next upstream",
+			env:        map[string]string{"OPENAI_BASE_URL": closedURL(t) + ",{upstream}"},
+			wantStatus: http.StatusOK, wantID: "good",
+		},
+		{
+			name:       "no retries left",
+			env:        map[string]string{"UPSTREAM_CONNECT_TIMEOUT_MS": "150", "OPENAI_BASE_URL": slow.URL, "MAX_RETRIES": "0"},
+			wantStatus: http.StatusBadGateway,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dialled := slowListener.accepted.Load()
+			env := map[string]string{"MAX_RETRIES": "1", "LOAD_BALANCE_STRATEGY": "round_robin"}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			keyManager := newTestKeyManager("sk-connect")
+			router := newTestProxy(t, env, keyManager, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"id":"good","choices":[]}`))
+			}))
+
+			// Round robin starts on either upstream, two requests try both
+			for i := 0; i < 2; i++ {
+				start := time.Now()
+				recorder := proxyRequest(router, chatRequest())
+				if recorder.Code != tt.wantStatus {
+					t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body.String())
+				}
+				if tt.wantID != "" && !strings.Contains(recorder.Body.String(), `"id":"`+tt.wantID+`"`) {
+					t.Errorf("body = %s, want the %s upstream's response", recorder.Body.String(), tt.wantID)
+				}
+				// The slow upstream accepts after 2s, the timeout fires long before
+				if elapsed := time.Since(start); elapsed > time.Second {
+					t.Errorf("request took %v, want the connect timeout to cut it short", elapsed)
+				}
+			}
+
+			if strings.Contains(tt.env["OPENAI_BASE_URL"], slow.URL) && slowListener.accepted.Load() == dialled {
+				t.Error("the slow upstream was never dialled")
+			}
+
+			// A failed connect says nothing about the key
+			time.Sleep(20 * time.Millisecond)
+			keyManager.mu.Lock()
+			failures := keyManager.failures["sk-connect"]
+			keyManager.mu.Unlock()
+			if failures != 0 {
+				t.Errorf("%d failures recorded for the key, want 0", failures)
+			}
+		})
+	}
+}
+
+func TestUpstreamResponseHeaderTimeout(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		stream     bool
+		wantStatus int
+	}{
+		{name: "headers in time", env: map[string]string{"UPSTREAM_RESPONSE_HEADER_TIMEOUT_MS": "2000"}, wantStatus: http.StatusOK},
+		{name: "headers too late", env: map[string]string{"UPSTREAM_RESPONSE_HEADER_TIMEOUT_MS": "100"}, wantStatus: http.StatusBadGateway},
+		{name: "stream headers too late", env: map[string]string{"UPSTREAM_RESPONSE_HEADER_TIMEOUT_MS": "100"}, stream: true, wantStatus: http.StatusBadGateway},
+		{name: "unset keeps RESPONSE_TIMEOUT", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"MAX_RETRIES": "0"}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			router := newTestProxy(t, env, newTestKeyManager("sk-headers"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(400 * time.Millisecond)
+				w.Write([]byte(`{"choices":[]}`))
+			}))
+
+			req := chatRequest()
+			if tt.stream {
+				req = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o","stream":true,"messages":[]}`))
+				req.Header.Set("Content-Type", "application/json")
+			}
+			start := time.Now()
+			recorder := proxyRequest(router, req)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body.String())
+			}
+			if elapsed := time.Since(start); tt.wantStatus != http.StatusOK && elapsed > 350*time.Millisecond {
+				t.Errorf("gave up after %v, want about 100ms", elapsed)
+			}
+		})
+	}
+}
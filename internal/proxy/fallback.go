@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gpt-load/internal/apierror"
+	"gpt-load/internal/errors"
+	"gpt-load/internal/metrics"
+	"gpt-load/internal/middleware"
+	"gpt-load/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Values of the served_by label of gptload_fallback_requests_total
+const (
+	servedByPrimary  = "primary"
+	servedByFallback = "fallback"
+)
+
+// shouldFallback reports whether every failed attempt indicates the primary upstreams are down.
+// Network errors (no status code) count as down.
+func shouldFallback(openaiConfig types.OpenAIConfig, retryErrors []types.RetryError) bool {
+	if openaiConfig.FallbackUpstreamURL == "" || len(retryErrors) == 0 {
+		return false
+	}
+
+	for _, retryError := range retryErrors {
+		if retryError.StatusCode == 0 {
+			continue
+		}
+		triggered := false
+		for _, code := range openaiConfig.FallbackTriggerCodes {
+			if retryError.StatusCode == code {
+				triggered = true
+				break
+			}
+		}
+		if !triggered {
+			return false
+		}
+	}
+	return true
+}
+
+// executeFallback sends the request once to the fallback upstream with its own keys
+func (ps *ProxyServer) executeFallback(c *gin.Context, openaiConfig types.OpenAIConfig, bodyBytes []byte, isStreamRequest bool) {
+	log := middleware.GetLogger(c)
+	log.Warnf("All primary upstreams failed, falling back to %s", openaiConfig.FallbackUpstreamURL)
+	metrics.FallbackRequests.WithLabelValues(servedByFallback, costCenter(c.Request.Context())).Inc()
+
+	targetURL := strings.TrimSuffix(openaiConfig.FallbackUpstreamURL, "/") + c.Request.URL.Path
+	if c.Request.URL.RawQuery != "" {
+		targetURL += "?" + c.Request.URL.RawQuery
+	}
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if isStreamRequest {
+		ctx, cancel = context.WithCancel(c.Request.Context())
+	} else {
+		ctx, cancel = context.WithTimeout(c.Request.Context(), time.Duration(openaiConfig.RequestTimeout)*time.Second)
+	}
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, c.Request.Method, targetURL, bytes.NewReader(bodyBytes))
+	if err != nil {
+		log.Errorf("Failed to create fallback request: %v", err)
+		middleware.RespondError(c, apierror.NewServerError(errors.ErrProxyRequest, "Failed to create fallback request"))
+		return
+	}
+	req.ContentLength = int64(len(bodyBytes))
+
+	for key, values := range c.Request.Header {
+		if key != "Host" && key != "Authorization" {
+			for _, value := range values {
+				req.Header.Add(key, value)
+			}
+		}
+	}
+	setUpstreamUserAgent(req.Header, openaiConfig)
+	ps.setForwardedHeaders(req.Header, c.Request)
+
+	// Local fallbacks often need no key at all
+	if keys := openaiConfig.FallbackUpstreamKeys; len(keys) > 0 {
+		index := atomic.AddUint64(&ps.fallbackKeyCounter, 1) - 1
+		req.Header.Set("Authorization", "Bearer "+keys[index%uint64(len(keys))])
+	}
+
+	client := ps.httpClient
+	if isStreamRequest {
+		client = ps.streamClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Errorf("Fallback request failed: %v", err)
+		middleware.RespondError(c, apierror.NewUpstreamError(http.StatusBadGateway, errors.ErrProxyRetryExhausted, "All upstreams including the fallback failed"))
+		return
+	}
+	defer resp.Body.Close()
+
+	for key, values := range resp.Header {
+		for _, value := range values {
+			c.Header(key, value)
+		}
+	}
+	c.Status(resp.StatusCode)
+
+	if isStreamRequest {
+		ps.handleStreamingResponse(c, resp, nil)
+	} else {
+		ps.handleNormalResponse(c, resp)
+	}
+}
@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"gpt-load/internal/middleware"
+)
+
+// setForwardedHeaders tells the upstream who the client is. A trusted proxy's
+// X-Forwarded-* headers are extended, anyone else's are replaced so a client
+// cannot spoof its address. With FORWARD_CLIENT_IP disabled the client IP
+// headers are stripped instead.
+func (ps *ProxyServer) setForwardedHeaders(header http.Header, req *http.Request) {
+	peer, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		peer = req.RemoteAddr
+	}
+	peerIP := net.ParseIP(peer)
+	trusted := peerIP != nil && middleware.ContainsIP(ps.trustedProxies, peerIP)
+
+	if !ps.configManager.GetServerConfig().ForwardClientIP {
+		header.Del("X-Forwarded-For")
+		header.Del("X-Real-IP")
+	} else {
+		chain := peer
+		realIP := peer
+		if trusted {
+			if prior := req.Header.Values("X-Forwarded-For"); len(prior) > 0 {
+				chain = strings.Join(prior, ", ") + ", " + peer
+			}
+			if prior := req.Header.Get("X-Real-IP"); prior != "" {
+				realIP = prior
+			}
+		}
+		header.Set("X-Forwarded-For", chain)
+		header.Set("X-Real-IP", realIP)
+	}
+
+	host := req.Host
+	proto := "http"
+	if req.TLS != nil {
+		proto = "https"
+	}
+	if trusted {
+		if prior := req.Header.Get("X-Forwarded-Host"); prior != "" {
+			host = prior
+		}
+		if prior := req.Header.Get("X-Forwarded-Proto"); prior != "" {
+			proto = prior
+		}
+	}
+	header.Set("X-Forwarded-Host", host)
+	header.Set("X-Forwarded-Proto", proto)
+}
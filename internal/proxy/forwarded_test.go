@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestForwardedHeaders(t *testing.T) {
+	const trustedPeer, untrustedPeer = "10.0.0.5:4321", "203.0.113.9:4321"
+	existing := http.Header{
+		"X-Forwarded-For":   {"198.51.100.7, 10.0.0.9"},
+		"X-Real-Ip":         {"198.51.100.7"},
+		"X-Forwarded-Host":  {"api.example.com"},
+		"X-Forwarded-Proto": {"https"},
+	}
+	tests := []struct {
+		name      string
+		forward   string
+		peer      string
+		header    http.Header
+		wantFor   string
+		wantReal  string
+		wantHost  string
+		wantProto string
+	}{
+		{name: "trusted proxy extends the chain", forward: "true", peer: trustedPeer, header: existing, wantFor: "198.51.100.7, 10.0.0.9, 10.0.0.5", wantReal: "198.51.100.7", wantHost: "api.example.com", wantProto: "https"},
+		{name: "trusted proxy without headers", forward: "true", peer: trustedPeer, wantFor: "10.0.0.5", wantReal: "10.0.0.5", wantHost: "example.com", wantProto: "http"},
+		{name: "untrusted client headers replaced", forward: "true", peer: untrustedPeer, header: existing, wantFor: "203.0.113.9", wantReal: "203.0.113.9", wantHost: "example.com", wantProto: "http"},
+		{name: "untrusted client without headers", forward: "true", peer: untrustedPeer, wantFor: "203.0.113.9", wantReal: "203.0.113.9", wantHost: "example.com", wantProto: "http"},
+		{name: "disabled strips a trusted chain", forward: "false", peer: trustedPeer, header: existing, wantHost: "api.example.com", wantProto: "https"},
+		{name: "disabled without headers", forward: "false", peer: trustedPeer, wantHost: "example.com", wantProto: "http"},
+		{name: "disabled strips spoofed headers", forward: "false", peer: untrustedPeer, header: existing, wantHost: "example.com", wantProto: "http"},
+		{name: "disabled untrusted without headers", forward: "false", peer: untrustedPeer, wantHost: "example.com", wantProto: "http"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen := make(chan http.Header, 1)
+			env := map[string]string{"FORWARD_CLIENT_IP": tt.forward, "TRUSTED_PROXY_CIDRS": "10.0.0.0/8"}
+			router := newTestProxy(t, env, newTestKeyManager("sk-forwarded"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen <- r.Header.Clone()
+				w.Write([]byte(`{"choices":[]}`))
+			}))
+
+			req := chatRequest()
+			req.RemoteAddr = tt.peer
+			for key, values := range tt.header {
+				req.Header[key] = values
+			}
+			if recorder := proxyRequest(router, req); recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", recorder.Code, recorder.Body.String())
+			}
+
+			got := <-seen
+			want := map[string]string{
+				"X-Forwarded-For":   tt.wantFor,
+				"X-Real-Ip":         tt.wantReal,
+				"X-Forwarded-Host":  tt.wantHost,
+				"X-Forwarded-Proto": tt.wantProto,
+			}
+			for key, value := range want {
+				if values := got.Values(key); len(values) > 1 || got.Get(key) != value {
+					t.Errorf("%s = %q, want %q", key, values, value)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"gpt-load/internal/apierror"
+	"gpt-load/internal/errors"
+	"gpt-load/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleGeneric forwards a request as a transparent reverse proxy, without any
+// OpenAI-specific parsing. The body is streamed unchanged, so requests are not retried.
+func (ps *ProxyServer) handleGeneric(c *gin.Context) {
+	log := middleware.GetLogger(c)
+
+	keyInfo, err := ps.keyManager.GetNextKey()
+	if err != nil {
+		var retryAfterErr *errors.RetryAfterError
+		if stderrors.As(err, &retryAfterErr) {
+			respondKeysRateLimited(c, retryAfterErr.RetryAfter)
+			return
+		}
+		log.Errorf("Failed to get key: %v", err)
+		middleware.RespondError(c, apierror.NewUpstreamError(http.StatusServiceUnavailable, errors.ErrNoKeysAvailable, "No API keys available"))
+		return
+	}
+	defer keyInfo.Release()
+	c.Set("keyIndex", keyInfo.Index)
+	c.Set("keyPreview", keyInfo.Preview)
+
+	openaiConfig := ps.configManager.GetOpenAIConfig()
+	upstreamURL, err := url.Parse(openaiConfig.BaseURL)
+	if err != nil {
+		log.Errorf("Failed to parse upstream URL: %v", err)
+		middleware.RespondError(c, apierror.NewServerError(errors.ErrConfigInvalid, "Invalid upstream URL configured"))
+		return
+	}
+
+	reverseProxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(upstreamURL)
+			r.Out.Host = upstreamURL.Host
+
+			// Never forward the caller's own credentials
+			r.Out.Header.Del("Authorization")
+			r.Out.Header.Set(openaiConfig.KeyHeader, strings.ReplaceAll(openaiConfig.KeyFormat, "{key}", keyInfo.Key))
+			setUpstreamUserAgent(r.Out.Header, openaiConfig)
+			ps.setForwardedHeaders(r.Out.Header, r.In)
+		},
+		Transport:     ps.streamClient.Transport,
+		FlushInterval: -1, // Flush immediately so streamed responses pass through
+		ModifyResponse: func(resp *http.Response) error {
+			if resp.StatusCode >= 400 {
+				go ps.keyManager.RecordFailure(keyInfo.Key, fmt.Errorf("HTTP %d", resp.StatusCode))
+			} else {
+				go ps.keyManager.RecordSuccess(keyInfo.Key)
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			if isIgnorableStreamError(err) {
+				log.Debugf("Generic proxy connection closed: %v", err)
+				return
+			}
+			if middleware.IsBodyTooLarge(err) {
+				middleware.RespondBodyTooLarge(c, int64(ps.configManager.GetPerformanceConfig().MaxRequestBodyBytes))
+				return
+			}
+			log.Warnf("Generic proxy request failed: %v", err)
+			go ps.keyManager.RecordFailure(keyInfo.Key, err)
+			middleware.RespondError(c, apierror.NewUpstreamError(http.StatusBadGateway, errors.ErrProxyRequest, "Upstream request failed"))
+		},
+	}
+
+	reverseProxy.ServeHTTP(c.Writer, c.Request)
+}
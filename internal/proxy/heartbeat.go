@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+// sseHeartbeat is the SSE comment written while a stream is idle, clients ignore it
+const sseHeartbeat = ": heartbeat\n\n"
+
+// readResult is the outcome of one upstream read
+type readResult struct {
+	n   int
+	err error
+}
+
+// heartbeatReader wraps a streaming upstream body. When a Read waits longer than
+// interval for upstream data it writes an SSE heartbeat comment to the client, so
+// proxies and load balancers do not drop the idle connection.
+//
+// The upstream is read on a helper goroutine into the caller's buffer, but the
+// heartbeat is written from Read itself, on the goroutine that copies the stream
+// to the client, so it can never interleave with a data write. Heartbeats are
+// only sent between events, never in the middle of one.
+type heartbeatReader struct {
+	writer   io.Writer
+	flusher  http.Flusher
+	interval time.Duration
+
+	requests chan []byte
+	results  chan readResult
+	err      error // Sticky error once the client went away
+
+	lineStart bool // Nothing but \r returned since the last \n
+	pending   bool // The current event has content
+}
+
+// newHeartbeatReader wraps body, an interval of 0 disables heartbeats. The
+// returned function stops the helper goroutine and must be called once the
+// body is no longer read.
+func newHeartbeatReader(body io.Reader, writer io.Writer, flusher http.Flusher, interval time.Duration) (io.Reader, func()) {
+	if interval <= 0 {
+		return body, func() {}
+	}
+
+	h := &heartbeatReader{
+		writer:    writer,
+		flusher:   flusher,
+		interval:  interval,
+		requests:  make(chan []byte),
+		results:   make(chan readResult, 1), // Never blocks once Read gave up waiting
+		lineStart: true,
+	}
+	go func() {
+		for p := range h.requests {
+			n, err := body.Read(p)
+			h.results <- readResult{n: n, err: err}
+		}
+	}()
+	return h, func() { close(h.requests) }
+}
+
+// Read waits for the next upstream read, writing a heartbeat after every
+// interval without data
+func (h *heartbeatReader) Read(p []byte) (int, error) {
+	if h.err != nil {
+		return 0, h.err
+	}
+
+	h.requests <- p
+	timer := time.NewTimer(h.interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case result := <-h.results:
+			h.track(p[:result.n])
+			return result.n, result.err
+		case <-timer.C:
+			if h.lineStart && !h.pending {
+				if _, err := io.WriteString(h.writer, sseHeartbeat); err != nil {
+					// The helper still owns p, so no more reads are possible
+					h.err = err
+					return 0, err
+				}
+				h.flusher.Flush()
+			}
+			timer.Reset(h.interval)
+		}
+	}
+}
+
+// track follows event boundaries in the data passed to the client
+func (h *heartbeatReader) track(data []byte) {
+	for _, b := range data {
+		switch b {
+		case '\r':
+		case '\n':
+			if h.lineStart {
+				h.pending = false
+			}
+			h.lineStart = true
+		default:
+			h.lineStart = false
+			h.pending = true
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countingFlusher counts the flushes a heartbeat reader makes
+type countingFlusher struct{ flushes int }
+
+func (f *countingFlusher) Flush() { f.flushes++ }
+
+// heartbeats matches a run of heartbeats, turned into a | marker in the test output
+var heartbeats = regexp.MustCompile(`(: heartbeat\n\n)+`)
+
+func TestHeartbeatReader(t *testing.T) {
+	const interval = 20 * time.Millisecond
+	// step is one upstream write, optionally followed by a pause of several intervals
+	type step struct {
+		data  string
+		pause bool
+	}
+	tests := []struct {
+		name     string
+		interval time.Duration
+		steps    []step
+		want     string // Client output with each run of heartbeats shown as |
+	}{
+		{
+			name:     "pause between events",
+			interval: interval,
+			steps:    []step{{data: "data: a\n\n", pause: true}, {data: "data: b\n\n"}},
+			want:     "data: a\n\n|data: b\n\n",
+		},
+		{
+			name:     "pause before the first event",
+			interval: interval,
+			steps:    []step{{pause: true}, {data: "data: a\n\n"}},
+			want:     "|data: a\n\n",
+		},
+		{
+			name:     "pause inside an event",
+			interval: interval,
+			steps:    []step{{data: "data: a", pause: true}, {data: "\n\n"}},
+			want:     "data: a\n\n",
+		},
+		{
+			name:     "pause between the lines of an event",
+			interval: interval,
+			steps:    []step{{data: "event: delta\n", pause: true}, {data: "data: a\n\n"}},
+			want:     "event: delta\ndata: a\n\n",
+		},
+		{
+			name:     "CRLF events",
+			interval: interval,
+			steps:    []step{{data: "data: a\r\n\r\n", pause: true}, {data: "data: b\r\n\r\n"}},
+			want:     "data: a\r\n\r\n|data: b\r\n\r\n",
+		},
+		{
+			name:     "no pause",
+			interval: interval,
+			steps:    []step{{data: "data: a\n\n"}, {data: "data: b\n\n"}},
+			want:     "data: a\n\ndata: b\n\n",
+		},
+		{
+			name:  "disabled",
+			steps: []step{{data: "data: a\n\n", pause: true}, {data: "data: b\n\n"}},
+			want:  "data: a\n\ndata: b\n\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream, upstreamWriter := io.Pipe()
+			go func() {
+				for _, s := range tt.steps {
+					if s.data != "" {
+						upstreamWriter.Write([]byte(s.data))
+					}
+					if s.pause {
+						time.Sleep(4 * interval)
+					}
+				}
+				upstreamWriter.Close()
+			}()
+
+			// Data and heartbeats go to the same writer, as they do with the gin writer.
+			// The wrapper hides Buffer.ReadFrom, which reads straight into the buffer.
+			var client bytes.Buffer
+			writer := struct{ io.Writer }{&client}
+			flusher := &countingFlusher{}
+			body, stop := newHeartbeatReader(upstream, writer, flusher, tt.interval)
+			defer stop()
+			if _, err := io.Copy(writer, body); err != nil {
+				t.Fatalf("copy: %v", err)
+			}
+
+			if got := heartbeats.ReplaceAllString(client.String(), "|"); got != tt.want {
+				t.Errorf("client got %q, want %q", got, tt.want)
+			}
+			if sent := strings.Count(client.String(), sseHeartbeat); flusher.flushes != sent {
+				t.Errorf("flushed %d times for %d heartbeats", flusher.flushes, sent)
+			}
+		})
+	}
+}
+
+// failingWriter fails every write, like a client that went away
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errClientGone }
+
+var errClientGone = errors.New("client gone")
+
+func TestHeartbeatReaderClientGone(t *testing.T) {
+	upstream, upstreamWriter := io.Pipe()
+	defer upstreamWriter.Close()
+	body, stop := newHeartbeatReader(upstream, failingWriter{}, &countingFlusher{}, 10*time.Millisecond)
+	defer stop()
+
+	buf := make([]byte, 64)
+	for i := 0; i < 2; i++ {
+		if _, err := body.Read(buf); !errors.Is(err, errClientGone) {
+			t.Errorf("read %d error = %v, want the heartbeat write error", i, err)
+		}
+	}
+}
+
+func TestProxyStreamHeartbeat(t *testing.T) {
+	tests := []struct {
+		name          string
+		interval      string
+		contentType   string
+		wantHeartbeat bool
+	}{
+		{name: "event stream", interval: "1", contentType: "text/event-stream", wantHeartbeat: true},
+		{name: "disabled", interval: "0", contentType: "text/event-stream"},
+		{name: "not an event stream", interval: "1", contentType: "application/x-ndjson"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestProxy(t, map[string]string{"SSE_HEARTBEAT_INTERVAL_SECONDS": tt.interval}, newTestKeyManager("sk-stream"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"a\"}}]}\n\n"))
+				w.(http.Flusher).Flush()
+				// Pause mid-stream for longer than the heartbeat interval
+				time.Sleep(1300 * time.Millisecond)
+				w.Write([]byte("data: [DONE]\n\n"))
+			}))
+			proxy := httptest.NewServer(router)
+			t.Cleanup(proxy.Close)
+
+			resp, err := http.Post(proxy.URL+"/v1/chat/completions", "application/json", strings.NewReader(`{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+			if err != nil {
+				t.Fatalf("POST: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			want := "data: {\"choices\":[{\"delta\":{\"content\":\"a\"}}]}\n\ndata: [DONE]\n\n"
+			if tt.wantHeartbeat {
+				want = "data: {\"choices\":[{\"delta\":{\"content\":\"a\"}}]}\n\n|data: [DONE]\n\n"
+			}
+			if got := heartbeats.ReplaceAllString(string(body), "|"); got != want {
+				t.Errorf("client got %q, want %q", got, want)
+			}
+		})
+	}
+}
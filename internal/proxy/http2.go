@@ -0,0 +1,32 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+
+	"gpt-load/pkg/types"
+
+	"golang.org/x/net/http2"
+)
+
+// configureHTTP2 enables or disables HTTP/2 on an upstream transport. HTTP/2 is
+// negotiated through ALPN, so it only applies to HTTPS upstreams.
+func configureHTTP2(transport *http.Transport, openaiConfig types.OpenAIConfig) error {
+	if !openaiConfig.UpstreamHTTP2Enabled {
+		// A non-nil empty map stops the transport from negotiating h2
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		return nil
+	}
+
+	h2Transport, err := http2.ConfigureTransports(transport)
+	if err != nil {
+		return err
+	}
+	// Ping connections that have been silent this long, dropping dead ones
+	// instead of waiting on them until the request times out
+	h2Transport.ReadIdleTimeout = time.Duration(openaiConfig.IdleConnTimeout) * time.Second
+	h2Transport.StrictMaxConcurrentStreams = openaiConfig.UpstreamHTTP2StrictStreams
+	return nil
+}
@@ -0,0 +1,161 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gpt-load/pkg/types"
+)
+
+// newHTTP2Upstream starts an HTTPS upstream offering HTTP/2 and returns it with a
+// transport trusting its certificate, configured by configureHTTP2
+func newHTTP2Upstream(t testing.TB, enabled bool, handler http.Handler) (*httptest.Server, *http.Transport) {
+	t.Helper()
+	server := httptest.NewUnstartedServer(handler)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	transport := &http.Transport{TLSClientConfig: server.Client().Transport.(*http.Transport).TLSClientConfig.Clone(), ForceAttemptHTTP2: true}
+	if err := configureHTTP2(transport, types.OpenAIConfig{UpstreamHTTP2Enabled: enabled, IdleConnTimeout: 30}); err != nil {
+		t.Fatalf("configureHTTP2: %v", err)
+	}
+	t.Cleanup(transport.CloseIdleConnections)
+	return server, transport
+}
+
+func TestConfigureHTTP2(t *testing.T) {
+	tests := []struct {
+		name      string
+		enabled   bool
+		wantProto string
+	}{
+		{name: "enabled", enabled: true, wantProto: "HTTP/2.0"},
+		{name: "disabled", wantProto: "HTTP/1.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var upstreamProto string
+			server, transport := newHTTP2Upstream(t, tt.enabled, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				upstreamProto = r.Proto
+			}))
+			resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+			if err != nil {
+				t.Fatalf("GET: %v", err)
+			}
+			resp.Body.Close()
+			if resp.Proto != tt.wantProto || upstreamProto != tt.wantProto {
+				t.Errorf("client saw %s, upstream saw %s, want %s", resp.Proto, upstreamProto, tt.wantProto)
+			}
+		})
+	}
+}
+
+func TestProxyStreamsOverHTTP2(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeClientCertificate(t, dir, "client")
+	tests := []struct {
+		name      string
+		enabled   string
+		wantProto string
+	}{
+		{name: "http2", enabled: "true", wantProto: "HTTP/2.0"},
+		{name: "http1", enabled: "false", wantProto: "HTTP/1.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Each event waits until the client read the previous one, so buffering deadlocks
+			next := make(chan struct{})
+			upstream, caFile := newTLSUpstream(t, dir, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				for i := 0; i < 3; i++ {
+					fmt.Fprintf(w, "data: {\"n\":%d}\n\n", i)
+					w.(http.Flusher).Flush()
+					<-next
+				}
+				io.WriteString(w, "data: [DONE]\n\n")
+			})
+			router := newTestProxyFor(t, map[string]string{
+				"UPSTREAM_HTTP2_ENABLED": tt.enabled,
+				"UPSTREAM_TLS_CA_FILE":   caFile,
+				"UPSTREAM_TLS_CERT_FILE": certFile,
+				"UPSTREAM_TLS_KEY_FILE":  keyFile,
+			}, newTestKeyManager("sk-stream-0001"), upstream)
+			proxy := httptest.NewServer(router)
+			t.Cleanup(proxy.Close)
+
+			resp, err := http.Post(proxy.URL+"/v1/chat/completions", "application/json", strings.NewReader(`{"model":"gpt-4o","stream":true,"messages":[]}`))
+			if err != nil {
+				t.Fatalf("POST: %v", err)
+			}
+			defer resp.Body.Close()
+			if proto := resp.Header.Get("X-Proto"); proto != tt.wantProto {
+				t.Errorf("upstream saw %s, want %s", proto, tt.wantProto)
+			}
+
+			reader := bufio.NewReader(resp.Body)
+			for i := 0; i < 3; i++ {
+				want := fmt.Sprintf("data: {\"n\":%d}", i)
+				if line := readEvent(t, reader); line != want {
+					t.Fatalf("event %d = %q, want %q", i, line, want)
+				}
+				next <- struct{}{}
+			}
+			if line := readEvent(t, reader); line != "data: [DONE]" {
+				t.Errorf("last event = %q, want [DONE]", line)
+			}
+		})
+	}
+}
+
+// readEvent returns the next non-empty line of an event stream
+func readEvent(t *testing.T, reader *bufio.Reader) string {
+	t.Helper()
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("stream ended: %v", err)
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+}
+
+func BenchmarkUpstreamStreaming(b *testing.B) {
+	// A mock streaming completion of 20 chunks
+	stream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 20; i++ {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":\"token %d\"}}]}\n\n", i)
+			w.(http.Flusher).Flush()
+		}
+		io.WriteString(w, "data: [DONE]\n\n")
+	})
+	for _, bc := range []struct {
+		name    string
+		enabled bool
+	}{{name: "http1", enabled: false}, {name: "http2", enabled: true}} {
+		b.Run(bc.name, func(b *testing.B) {
+			server, transport := newHTTP2Upstream(b, bc.enabled, stream)
+			client := &http.Client{Transport: transport}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					resp, err := client.Get(server.URL)
+					if err != nil {
+						b.Error(err)
+						return
+					}
+					io.Copy(io.Discard, resp.Body)
+					resp.Body.Close()
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// injectBodyFields merges configured fields into a JSON request body. Field
+// names may use dot notation for nested paths (e.g. "metadata.source"). Caller
+// values win unless override is set. Bodies that are not JSON objects are
+// returned unchanged.
+func injectBodyFields(body []byte, fields map[string]any, override bool) []byte {
+	if len(fields) == 0 || len(bytes.TrimSpace(body)) == 0 {
+		return body
+	}
+
+	// UseNumber keeps large integers intact through the round trip
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var payload map[string]any
+	if err := decoder.Decode(&payload); err != nil || payload == nil {
+		return body
+	}
+
+	for path, value := range fields {
+		setPath(payload, strings.Split(path, "."), value, override)
+	}
+
+	merged, err := json.Marshal(payload)
+	if err != nil {
+		return body
+	}
+	return merged
+}
+
+// setPath sets a nested value, creating intermediate objects as needed. Existing
+// non-object values on the path are only replaced when override is set.
+func setPath(object map[string]any, path []string, value any, override bool) {
+	key := path[0]
+	if len(path) == 1 {
+		if _, exists := object[key]; !exists || override {
+			object[key] = value
+		}
+		return
+	}
+
+	child, isObject := object[key].(map[string]any)
+	if !isObject {
+		if _, exists := object[key]; exists && !override {
+			return
+		}
+		child = make(map[string]any)
+		object[key] = child
+	}
+	setPath(child, path[1:], value, override)
+}
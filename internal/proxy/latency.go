@@ -0,0 +1,145 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"gpt-load/internal/apierror"
+	"gpt-load/internal/middleware"
+	"gpt-load/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// latencyBuffer is a fixed-size circular buffer of recent upstream latencies
+type latencyBuffer struct {
+	samples []time.Duration
+	next    int
+	full    bool
+}
+
+// add records a sample, overwriting the oldest once the buffer is full
+func (b *latencyBuffer) add(latency time.Duration) {
+	b.samples[b.next] = latency
+	b.next = (b.next + 1) % len(b.samples)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// sorted returns a sorted copy of the recorded samples
+func (b *latencyBuffer) sorted() []time.Duration {
+	count := b.next
+	if b.full {
+		count = len(b.samples)
+	}
+	samples := make([]time.Duration, count)
+	copy(samples, b.samples[:count])
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	return samples
+}
+
+// percentile returns the p-th percentile of sorted samples
+func percentile(samples []time.Duration, p float64) time.Duration {
+	if len(samples) == 0 {
+		return 0
+	}
+	index := int(float64(len(samples)-1) * p / 100)
+	return samples[index]
+}
+
+// latencyTracker keeps recent latencies per upstream and reorders upstreams by p95
+type latencyTracker struct {
+	window  int
+	buffers map[string]*latencyBuffer
+	mu      sync.RWMutex
+}
+
+// newLatencyTracker creates a tracker keeping the last window samples per upstream
+func newLatencyTracker(window int) *latencyTracker {
+	return &latencyTracker{
+		window:  window,
+		buffers: make(map[string]*latencyBuffer),
+	}
+}
+
+// record adds a latency sample for an upstream
+func (t *latencyTracker) record(upstream string, latency time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	buffer, exists := t.buffers[upstream]
+	if !exists {
+		buffer = &latencyBuffer{samples: make([]time.Duration, t.window)}
+		t.buffers[upstream] = buffer
+	}
+	buffer.add(latency)
+}
+
+// snapshot returns the sorted samples per upstream
+func (t *latencyTracker) snapshot() map[string][]time.Duration {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	snapshot := make(map[string][]time.Duration, len(t.buffers))
+	for upstream, buffer := range t.buffers {
+		snapshot[upstream] = buffer.sorted()
+	}
+	return snapshot
+}
+
+// sortUpstreams orders upstreams by ascending p95, upstreams without samples go last
+func (t *latencyTracker) sortUpstreams(upstreams []string) []string {
+	snapshot := t.snapshot()
+
+	ordered := make([]string, len(upstreams))
+	copy(ordered, upstreams)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		left, right := snapshot[ordered[i]], snapshot[ordered[j]]
+		if len(left) == 0 {
+			return false
+		}
+		if len(right) == 0 {
+			return true
+		}
+		return percentile(left, 95) < percentile(right, 95)
+	})
+	return ordered
+}
+
+// startLatencySort registers the periodic upstream reordering task
+func (ps *ProxyServer) startLatencySort(interval time.Duration) error {
+	return ps.configManager.GetScheduler().AddTask("upstream-latency-sort", interval, func(ctx context.Context) {
+		current := ps.configManager.GetOpenAIConfig().BaseURLs
+		ordered := ps.latencyTracker.sortUpstreams(current)
+		ps.configManager.SetUpstreamOrder(ordered)
+		logrus.Debugf("Upstreams ordered by p95 latency: %v", ordered)
+	})
+}
+
+// UpstreamLatency handles upstream latency percentile queries
+func (ps *ProxyServer) UpstreamLatency(c *gin.Context) {
+	if ps.latencyTracker == nil {
+		middleware.RespondError(c, apierror.NewNotFoundError("Upstream latency tracking is disabled"))
+		return
+	}
+
+	upstreams := make(map[string]types.LatencyPercentiles)
+	for upstream, samples := range ps.latencyTracker.snapshot() {
+		upstreams[upstream] = types.LatencyPercentiles{
+			Samples: len(samples),
+			P50Ms:   percentile(samples, 50).Milliseconds(),
+			P95Ms:   percentile(samples, 95).Milliseconds(),
+			P99Ms:   percentile(samples, 99).Milliseconds(),
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"upstreams": upstreams,
+		"order":     ps.configManager.GetOpenAIConfig().BaseURLs,
+	})
+}
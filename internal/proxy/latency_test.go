@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUpstreamLatencySelection(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		requests int
+		maxSlow  int // Requests the slow upstream may get
+		minSlow  int
+	}{
+		// Each upstream is measured once, then the fast one takes everything
+		{name: "least latency", env: map[string]string{"LOAD_BALANCE_STRATEGY": "least_latency"}, requests: 20, minSlow: 1, maxSlow: 1},
+		{name: "round robin ignores latency", env: map[string]string{"LOAD_BALANCE_STRATEGY": "round_robin"}, requests: 20, minSlow: 10, maxSlow: 10},
+		// After its first answer the slow upstream keeps about a tenth of its half
+		{name: "round robin over the SLA", env: map[string]string{"LOAD_BALANCE_STRATEGY": "round_robin", "UPSTREAM_SLA_THRESHOLD_MS": "40"}, requests: 40, minSlow: 1, maxSlow: 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits := make(chan string, tt.requests)
+			upstream := func(name string, delay time.Duration) *httptest.Server {
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					time.Sleep(delay)
+					hits <- name
+					w.Write([]byte(`{"choices":[]}`))
+				}))
+				t.Cleanup(server.Close)
+				return server
+			}
+			slow := upstream("slow", 80*time.Millisecond)
+			fast := upstream("fast", 0)
+
+			env := map[string]string{"OPENAI_BASE_URL": slow.URL + "," + fast.URL}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			router := newTestProxyFor(t, env, newTestKeyManager("sk-latency"), fast)
+			for i := 0; i < tt.requests; i++ {
+				if recorder := proxyRequest(router, chatRequest()); recorder.Code != http.StatusOK {
+					t.Fatalf("request %d status = %d: %s", i, recorder.Code, recorder.Body.String())
+				}
+			}
+			close(hits)
+
+			counts := make(map[string]int)
+			for name := range hits {
+				counts[name]++
+			}
+			if counts["slow"] < tt.minSlow || counts["slow"] > tt.maxSlow {
+				t.Errorf("picks = %v, want %d to %d on the slow upstream", counts, tt.minSlow, tt.maxSlow)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	stderrors "errors"
+	"io"
+	"net/http"
+
+	"gpt-load/internal/apierror"
+	"gpt-load/internal/errors"
+	"gpt-load/internal/middleware"
+	"gpt-load/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// errResponseTooLarge is returned once an upstream response exceeds its size limit
+var errResponseTooLarge = stderrors.New("upstream response body exceeds size limit")
+
+// limitedBody wraps an upstream response body, failing once it goes past limit bytes.
+// The upstream body is closed at that point, so the connection is dropped rather
+// than drained.
+type limitedBody struct {
+	io.ReadCloser
+	limit    int64
+	read     int64
+	exceeded bool
+}
+
+// newLimitedBody wraps body with a limit in bytes, 0 means unlimited
+func newLimitedBody(body io.ReadCloser, limit int64) io.ReadCloser {
+	if limit <= 0 {
+		return body
+	}
+	return &limitedBody{ReadCloser: body, limit: limit}
+}
+
+// Read reads from the body, truncating at the limit
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.exceeded {
+		return 0, errResponseTooLarge
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if b.read >= b.limit {
+		// A body of exactly limit bytes is fine, only one more byte exceeds it
+		var probe [1]byte
+		n, err := b.ReadCloser.Read(probe[:])
+		if n == 0 {
+			return 0, err
+		}
+		b.exceeded = true
+		b.ReadCloser.Close()
+		return 0, errResponseTooLarge
+	}
+	if remaining := b.limit - b.read; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	return n, err
+}
+
+// responseLimit returns the body limit in bytes for an upstream: its own MB limit,
+// else the global one, capped by MAX_RESPONSE_BODY_BYTES. 0 means unlimited.
+func responseLimit(openaiConfig types.OpenAIConfig, upstream string, maxBytes int) int64 {
+	limitMB := openaiConfig.MaxResponseBodySizeMB
+	if perUpstream, exists := openaiConfig.UpstreamMaxResponseMB[upstream]; exists {
+		limitMB = perUpstream
+	}
+
+	limit := int64(limitMB) << 20
+	if maxBytes > 0 && (limit == 0 || int64(maxBytes) < limit) {
+		limit = int64(maxBytes)
+	}
+	return limit
+}
+
+// respondResponseTooLarge reports a response cut off at its size limit. When nothing
+// has reached the client yet, because the upstream declared the size up front or
+// the response is buffered, the client gets a 502 instead. Otherwise the truncated
+// response just ends.
+func (ps *ProxyServer) respondResponseTooLarge(c *gin.Context, resp *http.Response) {
+	middleware.GetLogger(c).WithFields(logrus.Fields{
+		"request_id": middleware.GetRequestID(c),
+		"upstream":   c.GetString("upstream"),
+	}).Warn("Upstream response exceeded the body size limit, closing upstream connection")
+
+	if c.Writer.Written() {
+		return
+	}
+	if buffered, ok := c.Writer.(*bufferedWriter); ok {
+		buffered.body.Reset()
+	}
+	// Drop the upstream headers already copied for the truncated body
+	for name := range resp.Header {
+		c.Writer.Header().Del(name)
+	}
+	c.Writer.Header().Del("Trailer")
+	middleware.RespondError(c, apierror.NewUpstreamError(http.StatusBadGateway, errors.ErrProxyResponse, "Upstream response exceeds the size limit"))
+}
@@ -0,0 +1,220 @@
+package proxy
+
+import (
+	"bytes"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gpt-load/internal/middleware"
+	"gpt-load/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+// closeRecorder is a response body that remembers whether it was closed
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (b *closeRecorder) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestLimitedBody(t *testing.T) {
+	const limit = 64
+	tests := []struct {
+		name       string
+		size       int
+		bufferSize int
+		wantErr    bool
+	}{
+		{name: "under the limit", size: limit - 1, bufferSize: 512},
+		{name: "exactly the limit", size: limit, bufferSize: 512},
+		{name: "exactly the limit in small reads", size: limit, bufferSize: 7},
+		{name: "exactly the limit in one byte reads", size: limit, bufferSize: 1},
+		{name: "one byte over", size: limit + 1, bufferSize: 512, wantErr: true},
+		{name: "one byte over in small reads", size: limit + 1, bufferSize: 7, wantErr: true},
+		{name: "one byte over in one byte reads", size: limit + 1, bufferSize: 1, wantErr: true},
+		{name: "far over", size: limit * 10, bufferSize: 512, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := &closeRecorder{Reader: bytes.NewReader(bytes.Repeat([]byte("x"), tt.size))}
+			body := newLimitedBody(upstream, limit)
+
+			var read []byte
+			buffer := make([]byte, tt.bufferSize)
+			var err error
+			for err == nil {
+				var n int
+				n, err = body.Read(buffer)
+				read = append(read, buffer[:n]...)
+			}
+			if tt.wantErr != stderrors.Is(err, errResponseTooLarge) || !tt.wantErr && err != io.EOF {
+				t.Fatalf("error = %v, want response too large = %t", err, tt.wantErr)
+			}
+			if want := min(tt.size, limit); len(read) != want {
+				t.Errorf("read %d bytes, want %d", len(read), want)
+			}
+			// Going over closes the upstream body, a body within the limit is left to the caller
+			if upstream.closed != tt.wantErr {
+				t.Errorf("upstream body closed = %t, want %t", upstream.closed, tt.wantErr)
+			}
+			if tt.wantErr {
+				if n, err := body.Read(buffer); n != 0 || !stderrors.Is(err, errResponseTooLarge) {
+					t.Errorf("read after the limit = %d, %v, want the limit error again", n, err)
+				}
+			}
+		})
+	}
+
+	// No limit leaves the body as it is
+	upstream := &closeRecorder{Reader: strings.NewReader("body")}
+	if body := newLimitedBody(upstream, 0); body != io.ReadCloser(upstream) {
+		t.Errorf("newLimitedBody with no limit wrapped the body")
+	}
+}
+
+func TestResponseLimit(t *testing.T) {
+	const upstream = "https://a.example"
+	tests := []struct {
+		name       string
+		globalMB   int
+		upstreamMB map[string]int
+		maxBytes   int
+		wantLimit  int64
+	}{
+		{name: "unlimited"},
+		{name: "global MB limit", globalMB: 2, wantLimit: 2 << 20},
+		{name: "upstream MB limit wins", globalMB: 2, upstreamMB: map[string]int{upstream: 5}, wantLimit: 5 << 20},
+		{name: "upstream lifts the limit", globalMB: 2, upstreamMB: map[string]int{upstream: 0}, wantLimit: 0},
+		{name: "other upstream ignored", globalMB: 2, upstreamMB: map[string]int{"https://b.example": 5}, wantLimit: 2 << 20},
+		{name: "bytes alone", maxBytes: 1000, wantLimit: 1000},
+		{name: "bytes below the MB limit", globalMB: 1, maxBytes: 1000, wantLimit: 1000},
+		{name: "MB limit below the bytes", globalMB: 1, maxBytes: 5 << 20, wantLimit: 1 << 20},
+		{name: "bytes cap a lifted upstream", globalMB: 2, upstreamMB: map[string]int{upstream: 0}, maxBytes: 1000, wantLimit: 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openaiConfig := types.OpenAIConfig{MaxResponseBodySizeMB: tt.globalMB, UpstreamMaxResponseMB: tt.upstreamMB}
+			if got := responseLimit(openaiConfig, upstream, tt.maxBytes); got != tt.wantLimit {
+				t.Errorf("responseLimit = %d, want %d", got, tt.wantLimit)
+			}
+		})
+	}
+}
+
+func TestProxyResponseBodyLimit(t *testing.T) {
+	const limit = 1024
+	tests := []struct {
+		name      string
+		env       map[string]string
+		size      int
+		chunked   bool // Sent without a Content-Length, so the size is only known while copying
+		stream    bool
+		want      int
+		wantBytes int  // Body bytes the client gets, -1 for an error response
+		wantCut   bool // The upstream sees its connection closed before it finishes
+	}{
+		{name: "declared exactly the limit", size: limit, want: http.StatusOK, wantBytes: limit},
+		{name: "declared one byte over", size: limit + 1, want: http.StatusBadGateway, wantBytes: -1},
+		{name: "chunked exactly the limit", size: limit, chunked: true, want: http.StatusOK, wantBytes: limit},
+		{name: "chunked one byte over", size: limit + 1, chunked: true, want: http.StatusOK, wantBytes: limit, wantCut: true},
+		{name: "stream exactly the limit", size: limit, chunked: true, stream: true, want: http.StatusOK, wantBytes: limit},
+		{name: "stream one byte over", size: limit + 1, chunked: true, stream: true, want: http.StatusOK, wantBytes: limit, wantCut: true},
+		{name: "buffered exactly the limit", env: map[string]string{"RESPONSE_BUFFERING": "full"}, size: limit, chunked: true, want: http.StatusOK, wantBytes: limit},
+		{name: "buffered one byte over", env: map[string]string{"RESPONSE_BUFFERING": "full"}, size: limit + 1, chunked: true, want: http.StatusBadGateway, wantBytes: -1, wantCut: true},
+		{name: "MB limit alone", env: map[string]string{"MAX_RESPONSE_BODY_BYTES": "0", "MAX_RESPONSE_BODY_SIZE_MB": "1"}, size: limit + 1, chunked: true, want: http.StatusOK, wantBytes: limit + 1},
+	}
+	baseline := runtime.NumGoroutine()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cut := make(chan bool, 1)
+			upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contentType := "application/json"
+				if tt.stream {
+					contentType = "text/event-stream"
+				}
+				w.Header().Set("Content-Type", contentType)
+				if !tt.chunked {
+					w.Header().Set("Content-Length", strconv.Itoa(tt.size))
+				}
+				w.Write(bytes.Repeat([]byte("x"), tt.size))
+				if !tt.chunked {
+					return
+				}
+				// Hold the response open, only a closed connection ends it early
+				w.(http.Flusher).Flush()
+				select {
+				case <-r.Context().Done():
+					cut <- true
+				case <-time.After(300 * time.Millisecond):
+					cut <- false
+				}
+			})
+			env := map[string]string{"MAX_RESPONSE_BODY_BYTES": strconv.Itoa(limit), "SSE_HEARTBEAT_INTERVAL_SECONDS": "0"}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			router := newTestProxy(t, env, newTestKeyManager("sk-response-limit"), upstream)
+			logger, hook := test.NewNullLogger()
+			router.Use(func(c *gin.Context) {
+				middleware.SetLogger(c, logrus.NewEntry(logger))
+				c.Next()
+			})
+
+			req := chatRequest()
+			req.Header.Set(middleware.RequestIDHeader, "req-response-limit")
+			recorder := proxyRequest(router, req)
+			if recorder.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %.200s", recorder.Code, tt.want, recorder.Body.String())
+			}
+			if tt.wantBytes < 0 {
+				if !strings.Contains(recorder.Body.String(), "exceeds the size limit") {
+					t.Errorf("body = %.200s, want the size limit error", recorder.Body.String())
+				}
+			} else if recorder.Body.Len() != tt.wantBytes {
+				t.Errorf("client got %d bytes, want %d", recorder.Body.Len(), tt.wantBytes)
+			}
+			if tt.chunked {
+				if got := <-cut; got != tt.wantCut {
+					t.Errorf("upstream connection closed early = %t, want %t", got, tt.wantCut)
+				}
+			}
+
+			// Every truncation is logged with where it came from
+			var warning *logrus.Entry
+			for _, entry := range hook.AllEntries() {
+				if strings.Contains(entry.Message, "exceeded the body size limit") {
+					warning = entry
+				}
+			}
+			if truncated := tt.size > limit && tt.wantBytes != tt.size; (warning != nil) != truncated {
+				t.Fatalf("truncation logged = %t, want %t", warning != nil, truncated)
+			}
+			if warning != nil && (warning.Data["request_id"] != "req-response-limit" || !strings.HasPrefix(fmt.Sprint(warning.Data["upstream"]), "http://127.0.0.1:")) {
+				t.Errorf("truncation logged with %v, want the request ID and upstream URL", warning.Data)
+			}
+		})
+	}
+
+	// Closed upstream connections leave no goroutines behind once the servers are gone
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > baseline && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if leaked := runtime.NumGoroutine() - baseline; leaked > 0 {
+		t.Errorf("%d goroutines left over after the tests", leaked)
+	}
+}
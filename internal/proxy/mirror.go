@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	stderrors "errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gpt-load/internal/middleware"
+	"gpt-load/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// shouldMirror decides whether a request is copied to MIRROR_URL
+func shouldMirror(openaiConfig types.OpenAIConfig) bool {
+	return openaiConfig.MirrorURL != "" && rand.Float64() < openaiConfig.MirrorSampleRate
+}
+
+// mirrorRequest sends a copy of the client request to MIRROR_URL in the
+// background with the same key. The response is discarded, so the mirror can
+// never slow down or change what the client gets.
+func (ps *ProxyServer) mirrorRequest(c *gin.Context, openaiConfig types.OpenAIConfig, key string, bodyBytes []byte) {
+	path := c.Request.URL.Path
+	targetURL := strings.TrimSuffix(openaiConfig.MirrorURL, "/") + path
+	if c.Request.URL.RawQuery != "" {
+		targetURL += "?" + c.Request.URL.RawQuery
+	}
+
+	// Copy now, the gin context is reused once the handler returns
+	header := make(http.Header, len(c.Request.Header))
+	for name, values := range c.Request.Header {
+		if name != "Host" {
+			header[name] = append([]string(nil), values...)
+		}
+	}
+	setUpstreamKey(header, openaiConfig, key)
+	setUpstreamUserAgent(header, openaiConfig)
+	ps.setForwardedHeaders(header, c.Request)
+
+	method := c.Request.Method
+	log := middleware.GetLogger(c)
+	timeout := time.Duration(openaiConfig.MirrorTimeoutMs) * time.Millisecond
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, method, targetURL, bytes.NewReader(bodyBytes))
+		if err != nil {
+			log.Warnf("Failed to create mirror request: %v", err)
+			return
+		}
+		req.Header = header
+		req.ContentLength = int64(len(bodyBytes))
+
+		resp, err := ps.mirrorClient.Do(req)
+		if err != nil {
+			// Leave the URL out of the error, it may carry credentials
+			var urlErr *url.Error
+			if stderrors.As(err, &urlErr) {
+				err = urlErr.Err
+			}
+			log.Warnf("Mirror request to %s failed: %v", path, err)
+			return
+		}
+		defer resp.Body.Close()
+		io.Copy(io.Discard, resp.Body)
+
+		if resp.StatusCode >= 400 {
+			log.Warnf("Mirror request to %s returned HTTP %d", path, resp.StatusCode)
+		}
+	}()
+}
@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// mirroredRequest is what the mirror upstream received
+type mirroredRequest struct {
+	path, query, auth, header, body string
+}
+
+func TestProxyMirror(t *testing.T) {
+	tests := []struct {
+		name         string
+		env          map[string]string
+		mirror       func(w http.ResponseWriter, r *http.Request) // Nil for an unreachable mirror
+		failFirstKey bool                                         // The first key gets a 500 and the request is retried
+		wantMirrored int
+	}{
+		{name: "mirrored", mirror: func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(`{"choices":[]}`)) }, wantMirrored: 1},
+		{
+			name: "mirror fails",
+			mirror: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "mirror broken", http.StatusInternalServerError)
+			},
+			wantMirrored: 1,
+		},
+		{
+			name: "mirror slow",
+			env:  map[string]string{"MIRROR_TIMEOUT_MS": "50"},
+			mirror: func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(5 * time.Second):
+				}
+			},
+			wantMirrored: 1,
+		},
+		{name: "mirror unreachable"},
+		{name: "not sampled", env: map[string]string{"MIRROR_SAMPLE_RATE": "0"}, mirror: func(w http.ResponseWriter, r *http.Request) {}},
+		{name: "retries not mirrored", mirror: func(w http.ResponseWriter, r *http.Request) {}, failFirstKey: true, wantMirrored: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mirrored := make(chan mirroredRequest, 4)
+			mirrorServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				mirrored <- mirroredRequest{r.URL.Path, r.URL.RawQuery, r.Header.Get("Authorization"), r.Header.Get("X-Client-Trace"), string(body)}
+				tt.mirror(w, r)
+			}))
+			t.Cleanup(mirrorServer.Close)
+			if tt.mirror == nil {
+				mirrorServer.Close()
+			}
+
+			env := map[string]string{"MIRROR_URL": mirrorServer.URL, "MIRROR_SAMPLE_RATE": "1"}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			var upstreamCalls atomic.Int32
+			router := newTestProxy(t, env, newTestKeyManager("sk-first", "sk-second"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				upstreamCalls.Add(1)
+				if tt.failFirstKey && r.Header.Get("Authorization") == "Bearer sk-first" {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				w.Write([]byte(`{"id":"primary","choices":[]}`))
+			}))
+
+			req := chatRequest()
+			req.URL.RawQuery = "api-version=1"
+			req.Header.Set("X-Client-Trace", "trace-1")
+			start := time.Now()
+			recorder := proxyRequest(router, req)
+
+			// The mirror never changes or delays the primary response
+			if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), `"primary"`) {
+				t.Errorf("primary response = %d %s, want 200 from the upstream", recorder.Code, recorder.Body.String())
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("primary response took %v", elapsed)
+			}
+			wantCalls := int32(1)
+			if tt.failFirstKey {
+				wantCalls = 2
+			}
+			if n := upstreamCalls.Load(); n != wantCalls {
+				t.Errorf("upstream called %d times, want %d", n, wantCalls)
+			}
+
+			for i := 0; i < tt.wantMirrored; i++ {
+				select {
+				case got := <-mirrored:
+					want := mirroredRequest{"/v1/chat/completions", "api-version=1", "Bearer sk-first", "trace-1", `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`}
+					if got != want {
+						t.Errorf("mirror received %+v, want %+v", got, want)
+					}
+				case <-time.After(2 * time.Second):
+					t.Fatal("mirror never received the request")
+				}
+			}
+			select {
+			case got := <-mirrored:
+				t.Errorf("mirror received an extra request %+v", got)
+			case <-time.After(100 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func TestProxyMirrorTimeout(t *testing.T) {
+	canceled := make(chan time.Duration, 1)
+	mirrorServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The server only notices the client hanging up once the body is read
+		io.ReadAll(r.Body)
+		start := time.Now()
+		select {
+		case <-r.Context().Done():
+			canceled <- time.Since(start)
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	t.Cleanup(mirrorServer.Close)
+
+	env := map[string]string{"MIRROR_URL": mirrorServer.URL, "MIRROR_TIMEOUT_MS": "50"}
+	router := newTestProxy(t, env, newTestKeyManager("sk-first"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"choices":[]}`))
+	}))
+	if recorder := proxyRequest(router, chatRequest()); recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", recorder.Code)
+	}
+
+	// The mirror call is abandoned after MIRROR_TIMEOUT_MS, though the client is long done
+	select {
+	case waited := <-canceled:
+		if waited > time.Second {
+			t.Errorf("mirror call lived %v, want about 50ms", waited)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("mirror call outlived MIRROR_TIMEOUT_MS")
+	}
+}
@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"time"
+
+	"gpt-load/internal/errors"
+	"gpt-load/pkg/types"
+)
+
+// upstreamTLS holds the client TLS settings for upstream connections, with
+// per-upstream client certificates keyed by dial address
+type upstreamTLS struct {
+	base             *tls.Config
+	byAddr           map[string]*tls.Config
+	handshakeTimeout time.Duration
+}
+
+// newUpstreamTLS loads the upstream client certificates and CA pool, returning
+// nil when no upstream TLS settings are configured
+func newUpstreamTLS(openaiConfig types.OpenAIConfig) (*upstreamTLS, error) {
+	if openaiConfig.UpstreamTLSCertFile == "" && openaiConfig.UpstreamTLSCAFile == "" &&
+		!openaiConfig.UpstreamTLSSkipVerify && len(openaiConfig.UpstreamTLSCerts) == 0 {
+		return nil, nil
+	}
+
+	base := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		NextProtos:         []string{"http/1.1"},
+		InsecureSkipVerify: openaiConfig.UpstreamTLSSkipVerify,
+	}
+	if openaiConfig.UpstreamHTTP2Enabled {
+		base.NextProtos = []string{"h2", "http/1.1"}
+	}
+	if openaiConfig.UpstreamTLSCAFile != "" {
+		pem, err := os.ReadFile(openaiConfig.UpstreamTLSCAFile)
+		if err != nil {
+			return nil, errors.NewAppErrorWithCause(errors.ErrConfigInvalid, "Failed to read upstream TLS CA file", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.NewAppErrorWithDetails(errors.ErrConfigInvalid, "Upstream TLS CA file contains no certificates", openaiConfig.UpstreamTLSCAFile)
+		}
+		base.RootCAs = pool
+	}
+	if openaiConfig.UpstreamTLSCertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(openaiConfig.UpstreamTLSCertFile, openaiConfig.UpstreamTLSKeyFile)
+		if err != nil {
+			return nil, errors.NewAppErrorWithCause(errors.ErrConfigInvalid, "Failed to load upstream TLS client certificate", err)
+		}
+		base.Certificates = []tls.Certificate{certificate}
+	}
+
+	_, handshakeTimeout := connectTimeouts(openaiConfig)
+	ut := &upstreamTLS{
+		base:             base,
+		byAddr:           make(map[string]*tls.Config, len(openaiConfig.UpstreamTLSCerts)),
+		handshakeTimeout: handshakeTimeout,
+	}
+	for index, override := range openaiConfig.UpstreamTLSCerts {
+		addr, err := dialAddr(openaiConfig.BaseURLs[index])
+		if err != nil {
+			return nil, errors.NewAppErrorWithCause(errors.ErrConfigInvalid, "Invalid upstream URL", err)
+		}
+		certificate, err := tls.LoadX509KeyPair(override.CertFile, override.KeyFile)
+		if err != nil {
+			return nil, errors.NewAppErrorWithCause(errors.ErrConfigInvalid, fmt.Sprintf("Failed to load TLS client certificate for upstream %d", index), err)
+		}
+		config := base.Clone()
+		config.Certificates = []tls.Certificate{certificate}
+		ut.byAddr[addr] = config
+	}
+	return ut, nil
+}
+
+// dialAddr returns the host:port address a transport dials for an upstream URL
+func dialAddr(baseURL string) (string, error) {
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+	port := parsed.Port()
+	if port == "" {
+		port = "443"
+		if parsed.Scheme == "http" {
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(parsed.Hostname(), port), nil
+}
+
+// wrap returns a TLS dial function presenting the client certificate configured for the address
+func (ut *upstreamTLS) wrap(dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		config, exists := ut.byAddr[addr]
+		if !exists {
+			config = ut.base
+		}
+		config = config.Clone()
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			config.ServerName = host
+		}
+
+		handshakeCtx, cancel := context.WithTimeout(ctx, ut.handshakeTimeout)
+		defer cancel()
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.HandshakeContext(handshakeCtx); err != nil {
+			conn.Close()
+			// Only this handshake timed out, not the request
+			if handshakeCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+				return nil, errTLSHandshakeTimeout
+			}
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+}
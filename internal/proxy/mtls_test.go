@@ -0,0 +1,202 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gpt-load/pkg/types"
+)
+
+// writeClientCertificate writes a self-signed client certificate named commonName
+// and its key to dir, returning their paths
+func writeClientCertificate(t *testing.T, dir, commonName string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, commonName+".pem"), filepath.Join(dir, commonName+"-key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// newTLSUpstream starts an HTTPS upstream requiring a client certificate and
+// writes its certificate to a CA file. The upstream reports the common name of
+// the client certificate and the protocol in the X-Client and X-Proto headers.
+func newTLSUpstream(t *testing.T, dir string, handler http.HandlerFunc) (server *httptest.Server, caFile string) {
+	t.Helper()
+	server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Client", r.TLS.PeerCertificates[0].Subject.CommonName)
+		w.Header().Set("X-Proto", r.Proto)
+		if handler != nil {
+			handler(w, r)
+			return
+		}
+		w.Write([]byte(`{"choices":[]}`))
+	}))
+	server.EnableHTTP2 = true
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	caFile = filepath.Join(dir, "upstream-ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return server, caFile
+}
+
+func TestProxyUpstreamMTLS(t *testing.T) {
+	dir := t.TempDir()
+	defaultCert, defaultKey := writeClientCertificate(t, dir, "default")
+	overrideCert, overrideKey := writeClientCertificate(t, dir, "override")
+	server, caFile := newTLSUpstream(t, dir, nil)
+
+	tests := []struct {
+		name       string
+		env        map[string]string
+		wantClient string // Client certificate the upstream sees, empty when the request must fail
+	}{
+		{
+			name:       "default certificate",
+			env:        map[string]string{"UPSTREAM_TLS_CERT_FILE": defaultCert, "UPSTREAM_TLS_KEY_FILE": defaultKey, "UPSTREAM_TLS_CA_FILE": caFile},
+			wantClient: "default",
+		},
+		{
+			name: "per-upstream override",
+			env: map[string]string{
+				"UPSTREAM_TLS_CERT_FILE": defaultCert, "UPSTREAM_TLS_KEY_FILE": defaultKey, "UPSTREAM_TLS_CA_FILE": caFile,
+				"UPSTREAM_TLS_CERT_FILE_0": overrideCert, "UPSTREAM_TLS_KEY_FILE_0": overrideKey,
+			},
+			wantClient: "override",
+		},
+		{
+			name:       "override without a default",
+			env:        map[string]string{"UPSTREAM_TLS_CA_FILE": caFile, "UPSTREAM_TLS_CERT_FILE_0": overrideCert, "UPSTREAM_TLS_KEY_FILE_0": overrideKey},
+			wantClient: "override",
+		},
+		{
+			name:       "skip verify",
+			env:        map[string]string{"UPSTREAM_TLS_CERT_FILE": defaultCert, "UPSTREAM_TLS_KEY_FILE": defaultKey, "UPSTREAM_TLS_SKIP_VERIFY": "true"},
+			wantClient: "default",
+		},
+		{name: "no client certificate", env: map[string]string{"UPSTREAM_TLS_CA_FILE": caFile}},
+		{name: "untrusted upstream", env: map[string]string{"UPSTREAM_TLS_CERT_FILE": defaultCert, "UPSTREAM_TLS_KEY_FILE": defaultKey}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"MAX_RETRIES": "0"}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			router := newTestProxyFor(t, env, newTestKeyManager("sk-mtls-0001"), server)
+			recorder := proxyRequest(router, chatRequest())
+
+			if tt.wantClient == "" {
+				if recorder.Code == http.StatusOK {
+					t.Fatalf("status = 200 with client %q, want the handshake to fail", recorder.Header().Get("X-Client"))
+				}
+				return
+			}
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", recorder.Code, recorder.Body.String())
+			}
+			if client := recorder.Header().Get("X-Client"); client != tt.wantClient {
+				t.Errorf("upstream saw client certificate %q, want %q", client, tt.wantClient)
+			}
+		})
+	}
+}
+
+func TestNewUpstreamTLSErrors(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeClientCertificate(t, dir, "client")
+	emptyCA := filepath.Join(dir, "empty.pem")
+	if err := os.WriteFile(emptyCA, []byte("no certificates here"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		config  types.OpenAIConfig
+		wantNil bool
+		wantErr bool
+	}{
+		{name: "not configured", wantNil: true},
+		{name: "client certificate", config: types.OpenAIConfig{UpstreamTLSCertFile: certFile, UpstreamTLSKeyFile: keyFile}},
+		{name: "missing CA file", config: types.OpenAIConfig{UpstreamTLSCAFile: filepath.Join(dir, "missing.pem")}, wantErr: true},
+		{name: "CA file without certificates", config: types.OpenAIConfig{UpstreamTLSCAFile: emptyCA}, wantErr: true},
+		{name: "key does not match", config: types.OpenAIConfig{UpstreamTLSCertFile: certFile, UpstreamTLSKeyFile: certFile}, wantErr: true},
+		{
+			name: "broken override",
+			config: types.OpenAIConfig{
+				BaseURLs:         []string{"https://a.example"},
+				UpstreamTLSCerts: map[int]types.UpstreamTLSCert{0: {CertFile: certFile, KeyFile: filepath.Join(dir, "missing.pem")}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ut, err := newUpstreamTLS(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newUpstreamTLS error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (ut == nil) != tt.wantNil {
+				t.Errorf("newUpstreamTLS = %v, want nil %v", ut, tt.wantNil)
+			}
+		})
+	}
+}
+
+func TestDialAddr(t *testing.T) {
+	tests := []struct {
+		baseURL string
+		want    string
+	}{
+		{baseURL: "https://api.example", want: "api.example:443"},
+		{baseURL: "http://api.example/v1", want: "api.example:80"},
+		{baseURL: "https://api.example:8443", want: "api.example:8443"},
+		{baseURL: "https://[::1]:8443", want: "[::1]:8443"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.baseURL, func(t *testing.T) {
+			got, err := dialAddr(tt.baseURL)
+			if err != nil || got != tt.want {
+				t.Errorf("dialAddr(%q) = %q, %v, want %q", tt.baseURL, got, err, tt.want)
+			}
+		})
+	}
+}
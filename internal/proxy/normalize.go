@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// normalizeMessageOrder moves system messages ahead of all other messages in a
+// chat request body. The remaining messages keep their original sequence, so
+// tool and function results stay directly after the assistant message that
+// called them. Bodies without a messages array, or already in order, are
+// returned unchanged.
+func normalizeMessageOrder(body []byte) []byte {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return body
+	}
+
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(body, &payload); err != nil || payload == nil {
+		return body
+	}
+	var messages []json.RawMessage
+	if err := json.Unmarshal(payload["messages"], &messages); err != nil || len(messages) < 2 {
+		return body
+	}
+
+	system := make([]json.RawMessage, 0, len(messages))
+	others := make([]json.RawMessage, 0, len(messages))
+	reordered := false
+	for _, message := range messages {
+		var header struct {
+			Role string `json:"role"`
+		}
+		if err := json.Unmarshal(message, &header); err == nil && header.Role == "system" {
+			if len(others) > 0 {
+				reordered = true
+			}
+			system = append(system, message)
+			continue
+		}
+		others = append(others, message)
+	}
+	if !reordered {
+		return body
+	}
+
+	normalized, err := json.Marshal(append(system, others...))
+	if err != nil {
+		return body
+	}
+	payload["messages"] = normalized
+
+	rewritten, err := json.Marshal(payload)
+	if err != nil {
+		return body
+	}
+	return rewritten
+}
@@ -0,0 +1,134 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// messageRoles returns the roles and contents of a body's messages, in order
+func messageRoles(t *testing.T, body []byte) []string {
+	t.Helper()
+	var payload struct {
+		Messages []struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("normalized body %s is not valid JSON: %v", body, err)
+	}
+	roles := make([]string, len(payload.Messages))
+	for i, message := range payload.Messages {
+		roles[i] = message.Role + ":" + message.Content
+	}
+	return roles
+}
+
+func TestNormalizeMessageOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{
+			name: "system moved first",
+			body: `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"},{"role":"system","content":"be brief"}]}`,
+			want: []string{"system:be brief", "user:hi"},
+		},
+		{
+			name: "mixed order with tools",
+			body: `{"model":"gpt-4o","messages":[` +
+				`{"role":"user","content":"weather?"},` +
+				`{"role":"system","content":"s1"},` +
+				`{"role":"assistant","content":"call"},` +
+				`{"role":"tool","content":"sunny"},` +
+				`{"role":"system","content":"s2"},` +
+				`{"role":"assistant","content":"fn"},` +
+				`{"role":"function","content":"42"},` +
+				`{"role":"user","content":"thanks"}]}`,
+			want: []string{"system:s1", "system:s2", "user:weather?", "assistant:call", "tool:sunny", "assistant:fn", "function:42", "user:thanks"},
+		},
+		{
+			name: "already ordered",
+			body: `{"messages":[{"role":"system","content":"s"},{"role":"user","content":"u"},{"role":"assistant","content":"a"}]}`,
+			want: []string{"system:s", "user:u", "assistant:a"},
+		},
+		{
+			name: "no system message",
+			body: `{"messages":[{"role":"assistant","content":"a"},{"role":"user","content":"u"}]}`,
+			want: []string{"assistant:a", "user:u"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := messageRoles(t, normalizeMessageOrder([]byte(tt.body))); !slices.Equal(got, tt.want) {
+				t.Errorf("messages = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeMessageOrderKeepsOtherBodies(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "empty", body: ""},
+		{name: "not json", body: "not json"},
+		{name: "no messages", body: `{"model":"text-embedding-3-small","input":"hi"}`},
+		{name: "single message", body: `{"messages":[{"role":"user","content":"hi"}]}`},
+		{name: "already ordered", body: `{"messages": [{"role":"system","content":"s"}, {"role":"user","content":"u"}], "temperature": 0.5}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeMessageOrder([]byte(tt.body)); string(got) != tt.body {
+				t.Errorf("normalizeMessageOrder = %s, want the body unchanged", got)
+			}
+		})
+	}
+}
+
+func TestNormalizeMessageOrderKeepsFields(t *testing.T) {
+	body := `{"model":"gpt-4o","temperature":0.2,"messages":[{"role":"user","content":"hi","name":"alice"},{"role":"system","content":"s"}]}`
+	var payload map[string]any
+	if err := json.Unmarshal(normalizeMessageOrder([]byte(body)), &payload); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if payload["model"] != "gpt-4o" || payload["temperature"] != 0.2 {
+		t.Errorf("top-level fields changed: %v", payload)
+	}
+	if name := payload["messages"].([]any)[1].(map[string]any)["name"]; name != "alice" {
+		t.Errorf("message name = %v, want alice", name)
+	}
+}
+
+func TestProxyNormalizesMessageOrder(t *testing.T) {
+	const body = `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"},{"role":"system","content":"s"}]}`
+	tests := []struct {
+		name string
+		env  map[string]string
+		want []string
+	}{
+		{name: "disabled", want: []string{"user:hi", "system:s"}},
+		{name: "enabled", env: map[string]string{"NORMALIZE_MESSAGE_ORDER": "true"}, want: []string{"system:s", "user:hi"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received []byte
+			router := newTestProxy(t, tt.env, newTestKeyManager("sk-upstream"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received, _ = io.ReadAll(r.Body)
+				w.Write([]byte(`{"choices":[]}`))
+			}))
+			proxyRequest(router, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)))
+
+			if got := messageRoles(t, received); !slices.Equal(got, tt.want) {
+				t.Errorf("upstream messages = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+
+	"gpt-load/internal/errors"
+	"gpt-load/pkg/types"
+)
+
+// upstreamTransports gives every upstream host its own connection pool, routing
+// requests by URL host. Other hosts, such as group B, the fallback and the mirror,
+// share one transport.
+type upstreamTransports struct {
+	shared *http.Transport
+	byHost map[string]*http.Transport
+}
+
+// newUpstreamTransports creates the shared transport and one per upstream with the
+// pool sizes configured for it. Every transport gets its own HTTP/2 pool.
+func newUpstreamTransports(newTransport func() *http.Transport, openaiConfig types.OpenAIConfig) (*upstreamTransports, error) {
+	ut := &upstreamTransports{
+		shared: newTransport(),
+		byHost: make(map[string]*http.Transport, len(openaiConfig.BaseURLs)),
+	}
+	for index, baseURL := range openaiConfig.BaseURLs {
+		parsed, err := url.Parse(baseURL)
+		if err != nil {
+			return nil, errors.NewAppErrorWithCause(errors.ErrConfigInvalid, "Invalid upstream URL", err)
+		}
+		// Upstreams on the same host share the pool of the first one
+		if _, exists := ut.byHost[parsed.Host]; exists {
+			continue
+		}
+
+		transport := newTransport()
+		applyUpstreamPool(transport, upstreamPool(openaiConfig, index))
+		if err := configureHTTP2(transport, openaiConfig); err != nil {
+			return nil, err
+		}
+		ut.byHost[parsed.Host] = transport
+	}
+	if err := configureHTTP2(ut.shared, openaiConfig); err != nil {
+		return nil, err
+	}
+	return ut, nil
+}
+
+// upstreamPool returns the pool sizes of the upstream at index, its overrides
+// taking precedence over the shared UPSTREAM_MAX_* settings
+func upstreamPool(openaiConfig types.OpenAIConfig, index int) types.UpstreamPool {
+	pool := types.UpstreamPool{
+		MaxIdleConns:        openaiConfig.UpstreamMaxIdleConns,
+		MaxIdleConnsPerHost: openaiConfig.UpstreamMaxIdleConnsPerHost,
+		MaxConnsPerHost:     openaiConfig.UpstreamMaxConnsPerHost,
+	}
+	override := openaiConfig.UpstreamPools[index]
+	if override.MaxIdleConns > 0 {
+		pool.MaxIdleConns = override.MaxIdleConns
+	}
+	if override.MaxIdleConnsPerHost > 0 {
+		pool.MaxIdleConnsPerHost = override.MaxIdleConnsPerHost
+	}
+	if override.MaxConnsPerHost > 0 {
+		pool.MaxConnsPerHost = override.MaxConnsPerHost
+	}
+	return pool
+}
+
+// applyUpstreamPool sets the configured pool sizes, leaving the transport's own where unset
+func applyUpstreamPool(transport *http.Transport, pool types.UpstreamPool) {
+	if pool.MaxIdleConns > 0 {
+		transport.MaxIdleConns = pool.MaxIdleConns
+	}
+	if pool.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = pool.MaxIdleConnsPerHost
+	}
+	if pool.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = pool.MaxConnsPerHost
+	}
+}
+
+// RoundTrip sends the request through the transport of its upstream
+func (ut *upstreamTransports) RoundTrip(req *http.Request) (*http.Response, error) {
+	if transport, ok := ut.byHost[req.URL.Host]; ok {
+		return transport.RoundTrip(req)
+	}
+	return ut.shared.RoundTrip(req)
+}
+
+// CloseIdleConnections closes the idle connections of every transport
+func (ut *upstreamTransports) CloseIdleConnections() {
+	for _, transport := range ut.byHost {
+		transport.CloseIdleConnections()
+	}
+	ut.shared.CloseIdleConnections()
+}
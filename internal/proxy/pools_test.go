@@ -0,0 +1,190 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"gpt-load/pkg/types"
+)
+
+func TestUpstreamPool(t *testing.T) {
+	shared := types.OpenAIConfig{UpstreamMaxIdleConns: 50, UpstreamMaxIdleConnsPerHost: 10, UpstreamMaxConnsPerHost: 20}
+	tests := []struct {
+		name      string
+		overrides map[int]types.UpstreamPool
+		index     int
+		want      types.UpstreamPool
+	}{
+		{name: "shared settings", index: 0, want: types.UpstreamPool{MaxIdleConns: 50, MaxIdleConnsPerHost: 10, MaxConnsPerHost: 20}},
+		{
+			name:      "full override",
+			overrides: map[int]types.UpstreamPool{1: {MaxIdleConns: 5, MaxIdleConnsPerHost: 2, MaxConnsPerHost: 3}},
+			index:     1,
+			want:      types.UpstreamPool{MaxIdleConns: 5, MaxIdleConnsPerHost: 2, MaxConnsPerHost: 3},
+		},
+		{
+			name:      "partial override",
+			overrides: map[int]types.UpstreamPool{1: {MaxConnsPerHost: 3}},
+			index:     1,
+			want:      types.UpstreamPool{MaxIdleConns: 50, MaxIdleConnsPerHost: 10, MaxConnsPerHost: 3},
+		},
+		{
+			name:      "override of another upstream",
+			overrides: map[int]types.UpstreamPool{1: {MaxConnsPerHost: 3}},
+			index:     0,
+			want:      types.UpstreamPool{MaxIdleConns: 50, MaxIdleConnsPerHost: 10, MaxConnsPerHost: 20},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := shared
+			config.UpstreamPools = tt.overrides
+			if got := upstreamPool(config, tt.index); got != tt.want {
+				t.Errorf("upstreamPool = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpstreamTransports(t *testing.T) {
+	upstreams := make([]*httptest.Server, 2)
+	for i := range upstreams {
+		upstreams[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		t.Cleanup(upstreams[i].Close)
+	}
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(other.Close)
+
+	// Every transport records its dials, to see which pool a request used
+	var mu sync.Mutex
+	var transports []*http.Transport
+	dials := make(map[*http.Transport][]string)
+	newTransport := func() *http.Transport {
+		transport := &http.Transport{MaxIdleConns: 100, MaxIdleConnsPerHost: 20}
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			mu.Lock()
+			dials[transport] = append(dials[transport], addr)
+			mu.Unlock()
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		}
+		transports = append(transports, transport)
+		return transport
+	}
+
+	config := types.OpenAIConfig{
+		// The second upstream on the first host shares its pool
+		BaseURLs:                []string{upstreams[0].URL, upstreams[1].URL, upstreams[0].URL + "/v2"},
+		UpstreamMaxConnsPerHost: 8,
+		UpstreamPools:           map[int]types.UpstreamPool{1: {MaxIdleConnsPerHost: 4}},
+	}
+	ut, err := newUpstreamTransports(newTransport, config)
+	if err != nil {
+		t.Fatalf("newUpstreamTransports: %v", err)
+	}
+	defer ut.CloseIdleConnections()
+	if len(ut.byHost) != 2 || len(transports) != 3 {
+		t.Fatalf("%d upstream transports of %d, want one per host and a shared one", len(ut.byHost), len(transports))
+	}
+
+	tests := []struct {
+		name            string
+		url             string
+		transport       *http.Transport
+		wantMaxConns    int
+		wantIdlePerHost int
+	}{
+		{name: "first upstream", url: upstreams[0].URL, transport: ut.byHost[strings.TrimPrefix(upstreams[0].URL, "http://")], wantMaxConns: 8, wantIdlePerHost: 20},
+		{name: "overridden upstream", url: upstreams[1].URL, transport: ut.byHost[strings.TrimPrefix(upstreams[1].URL, "http://")], wantMaxConns: 8, wantIdlePerHost: 4},
+		{name: "other host", url: other.URL, transport: ut.shared, wantIdlePerHost: 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.transport == nil {
+				t.Fatal("no transport for the upstream")
+			}
+			if tt.transport.MaxConnsPerHost != tt.wantMaxConns || tt.transport.MaxIdleConnsPerHost != tt.wantIdlePerHost {
+				t.Errorf("pool = %d per host, %d idle per host, want %d, %d", tt.transport.MaxConnsPerHost, tt.transport.MaxIdleConnsPerHost, tt.wantMaxConns, tt.wantIdlePerHost)
+			}
+
+			req, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+			resp, err := ut.RoundTrip(req)
+			if err != nil {
+				t.Fatalf("RoundTrip: %v", err)
+			}
+			resp.Body.Close()
+			mu.Lock()
+			defer mu.Unlock()
+			if addrs := dials[tt.transport]; len(addrs) != 1 || addrs[0] != req.URL.Host {
+				t.Errorf("transport dialled %v, want only %s", addrs, req.URL.Host)
+			}
+		})
+	}
+}
+
+// BenchmarkUpstreamTransports sends bursts of concurrent requests, comparing a pool
+// keeping enough idle connections per upstream with the default transport, which
+// keeps two idle and redials the rest on every burst
+func BenchmarkUpstreamTransports(b *testing.B) {
+	const burst = 16
+	var dialled atomic.Int64
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"choices":[]}`))
+	}))
+	upstream.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			dialled.Add(1)
+		}
+	}
+	upstream.Start()
+	defer upstream.Close()
+
+	benchmarks := []struct {
+		name      string
+		transport func() http.RoundTripper
+	}{
+		{name: "default transport", transport: func() http.RoundTripper {
+			return http.DefaultTransport.(*http.Transport).Clone()
+		}},
+		{name: "upstream pools", transport: func() http.RoundTripper {
+			ut, err := newUpstreamTransports(func() *http.Transport { return http.DefaultTransport.(*http.Transport).Clone() },
+				types.OpenAIConfig{BaseURLs: []string{upstream.URL}, UpstreamMaxIdleConnsPerHost: burst})
+			if err != nil {
+				b.Fatalf("newUpstreamTransports: %v", err)
+			}
+			return ut
+		}},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			client := &http.Client{Transport: bm.transport()}
+			defer client.CloseIdleConnections()
+			dialled.Store(0)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var wg sync.WaitGroup
+				for j := 0; j < burst; j++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						resp, err := client.Get(upstream.URL)
+						if err != nil {
+							b.Error(err)
+							return
+						}
+						io.Copy(io.Discard, resp.Body)
+						resp.Body.Close()
+					}()
+				}
+				wg.Wait()
+			}
+			b.ReportMetric(float64(dialled.Load())/float64(b.N), "conns/op")
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"gpt-load/internal/config"
+)
+
+// ProbeKey sends GET /v1/models authenticated with key, built and sent the same
+// way as proxied requests so probes honour mTLS, SigV4, Azure and proxy settings.
+// It satisfies types.KeyProber.
+func (ps *ProxyServer) ProbeKey(ctx context.Context, key string) (*http.Response, error) {
+	openaiConfig := ps.configManager.GetOpenAIConfig()
+	upstreamURL, err := url.Parse(openaiConfig.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	basePath := upstreamURL.Path
+	upstreamURL.Path = strings.TrimSuffix(basePath, "/") + "/v1/models"
+	upstreamURL.RawQuery = mergeUpstreamQuery("", ps.upstreamQuery)
+	if openaiConfig.UpstreamType == config.UpstreamTypeAzure {
+		if err := rewriteAzureURL(upstreamURL, basePath, "/v1/models", "", openaiConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, upstreamURL.String(), nil)
+	if err != nil {
+		return nil, redactUpstreamQuery(err, ps.upstreamQuery)
+	}
+	setUpstreamKey(req.Header, openaiConfig, key)
+	setUpstreamUserAgent(req.Header, openaiConfig)
+
+	if ps.signer != nil {
+		if err := ps.signer.sign(ctx, req, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := ps.httpClient.Do(req)
+	if err != nil {
+		return nil, redactUpstreamQuery(err, ps.upstreamQuery)
+	}
+	return resp, nil
+}
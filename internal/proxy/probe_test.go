@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"gpt-load/pkg/types"
+)
+
+// stubConfigManager serves a fixed upstream configuration
+type stubConfigManager struct {
+	types.ConfigManager
+	openaiConfig types.OpenAIConfig
+}
+
+func (m stubConfigManager) GetOpenAIConfig() types.OpenAIConfig {
+	return m.openaiConfig
+}
+
+func TestProbeKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     types.OpenAIConfig
+		query      url.Values
+		wantURI    string
+		wantHeader string
+		wantValue  string
+	}{
+		{
+			name:       "openai",
+			config:     types.OpenAIConfig{KeyHeader: "Authorization", KeyFormat: "Bearer {key}", UpstreamDefaultUserAgent: "gpt-load"},
+			wantURI:    "/base/v1/models",
+			wantHeader: "Authorization",
+			wantValue:  "Bearer sk-probe",
+		},
+		{
+			name:       "upstream query params",
+			config:     types.OpenAIConfig{KeyHeader: "X-Api-Key", KeyFormat: "{key}"},
+			query:      url.Values{"tenant": {"acme"}},
+			wantURI:    "/base/v1/models?tenant=acme",
+			wantHeader: "X-Api-Key",
+			wantValue:  "sk-probe",
+		},
+		{
+			name:       "azure",
+			config:     types.OpenAIConfig{UpstreamType: "azure", AzureAPIVersion: "2024-02-01"},
+			wantURI:    "/base/openai/models?api-version=2024-02-01",
+			wantHeader: "api-key",
+			wantValue:  "sk-probe",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *http.Request
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer upstream.Close()
+
+			tt.config.BaseURL = upstream.URL + "/base"
+			ps := &ProxyServer{
+				configManager: stubConfigManager{openaiConfig: tt.config},
+				httpClient:    upstream.Client(),
+				upstreamQuery: tt.query,
+			}
+			resp, err := ps.ProbeKey(context.Background(), "sk-probe")
+			if err != nil {
+				t.Fatalf("ProbeKey: %v", err)
+			}
+			resp.Body.Close()
+
+			if got.Method != http.MethodGet || got.RequestURI != tt.wantURI {
+				t.Errorf("request = %s %s, want GET %s", got.Method, got.RequestURI, tt.wantURI)
+			}
+			if value := got.Header.Get(tt.wantHeader); value != tt.wantValue {
+				t.Errorf("%s = %q, want %q", tt.wantHeader, value, tt.wantValue)
+			}
+		})
+	}
+}
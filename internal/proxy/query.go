@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	stderrors "errors"
+	"net/url"
+)
+
+// mergeUpstreamQuery merges the configured UPSTREAM_QUERY_PARAMS into a request
+// query string, the configured values win on conflict
+func mergeUpstreamQuery(rawQuery string, params url.Values) string {
+	if len(params) == 0 {
+		return rawQuery
+	}
+
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		query = url.Values{}
+	}
+	for key, values := range params {
+		query[key] = values
+	}
+	return query.Encode()
+}
+
+// redactUpstreamQuery removes the configured query params from the URL carried
+// by a transport error, so they don't end up in logs or error responses
+func redactUpstreamQuery(err error, params url.Values) error {
+	var urlErr *url.Error
+	if len(params) == 0 || !stderrors.As(err, &urlErr) {
+		return err
+	}
+
+	parsed, parseErr := url.Parse(urlErr.URL)
+	if parseErr != nil {
+		return err
+	}
+	query := parsed.Query()
+	for key := range params {
+		query.Del(key)
+	}
+	parsed.RawQuery = query.Encode()
+	urlErr.URL = parsed.String()
+	return err
+}
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMergeUpstreamQuery(t *testing.T) {
+	params := url.Values{"api_version": {"2"}, "region": {"us"}}
+	tests := []struct {
+		name     string
+		rawQuery string
+		params   url.Values
+		want     string
+	}{
+		{name: "no request query", params: params, want: "api_version=2&region=us"},
+		{name: "sse stream flag kept", rawQuery: "stream=true", params: params, want: "api_version=2&region=us&stream=true"},
+		{name: "upstream params win", rawQuery: "api_version=1&stream=true", params: params, want: "api_version=2&region=us&stream=true"},
+		{name: "no params configured", rawQuery: "stream=true&b=%20", want: "stream=true&b=%20"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeUpstreamQuery(tt.rawQuery, tt.params); got != tt.want {
+				t.Errorf("mergeUpstreamQuery(%q) = %q, want %q", tt.rawQuery, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactUpstreamQuery(t *testing.T) {
+	params := url.Values{"api_version": {"2"}}
+	_, err := http.Get("http://127.0.0.1:0/v1/chat/completions?api_version=2&stream=true")
+	if err == nil {
+		t.Fatal("request to port 0 succeeded")
+	}
+	message := redactUpstreamQuery(err, params).Error()
+	if strings.Contains(message, "api_version") {
+		t.Errorf("error %q still carries the upstream params", message)
+	}
+	if !strings.Contains(message, "stream=true") {
+		t.Errorf("error %q lost the request's own query", message)
+	}
+}
+
+func TestProxyAppendsUpstreamQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		body string
+		want url.Values
+	}{
+		{name: "plain request", path: "/v1/chat/completions", body: `{"model":"gpt-4o"}`, want: url.Values{"api_version": {"2"}, "region": {"us"}}},
+		{name: "sse request", path: "/v1/chat/completions?stream=true", body: `{"model":"gpt-4o"}`, want: url.Values{"api_version": {"2"}, "region": {"us"}, "stream": {"true"}}},
+		{name: "conflict", path: "/v1/chat/completions?api_version=1", body: `{"model":"gpt-4o"}`, want: url.Values{"api_version": {"2"}, "region": {"us"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received url.Values
+			router := newTestProxy(t, map[string]string{"UPSTREAM_QUERY_PARAMS": "api_version=2&region=us"}, newTestKeyManager("sk-upstream"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received = r.URL.Query()
+				w.Write([]byte(`{"choices":[]}`))
+			}))
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			proxyRequest(router, req)
+
+			if received.Encode() != tt.want.Encode() {
+				t.Errorf("upstream query = %s, want %s", received.Encode(), tt.want.Encode())
+			}
+		})
+	}
+}
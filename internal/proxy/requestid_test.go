@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"gpt-load/internal/middleware"
+)
+
+func TestProxyForwardsRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		incoming string // Client X-Request-ID, generated when empty
+		header   string // Upstream header expected to carry the ID
+		want     string
+	}{
+		{name: "incoming id forwarded", incoming: "req-42", header: "X-Request-ID", want: "req-42"},
+		{name: "generated id forwarded", header: "X-Request-ID", want: "generated-id"},
+		{name: "custom upstream header", env: map[string]string{"UPSTREAM_REQUEST_ID_HEADER": "X-Client-Request-Id"}, incoming: "req-42", header: "X-Client-Request-Id", want: "req-42"},
+		{name: "forwarding disabled", env: map[string]string{"FORWARD_REQUEST_ID_TO_UPSTREAM": "false"}, header: "X-Request-ID"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received string
+			router := newTestProxy(t, tt.env, newTestKeyManager("sk-upstream"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received = r.Header.Get(tt.header)
+				w.Write([]byte(`{"choices":[]}`))
+			}))
+			router.Use(middleware.RequestID(middleware.RequestIDHeader, func() string { return "generated-id" }))
+
+			req := chatRequest()
+			if tt.incoming != "" {
+				req.Header.Set("X-Request-ID", tt.incoming)
+			}
+			recorder := proxyRequest(router, req)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", recorder.Code)
+			}
+			if received != tt.want {
+				t.Errorf("upstream %s = %q, want %q", tt.header, received, tt.want)
+			}
+			want := tt.incoming
+			if want == "" {
+				want = "generated-id"
+			}
+			if got := recorder.Header().Get("X-Request-ID"); got != want {
+				t.Errorf("response X-Request-ID = %q, want %q", got, want)
+			}
+		})
+	}
+}
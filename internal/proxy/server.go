@@ -4,20 +4,36 @@ package proxy
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	stderrors "errors"
 	"fmt"
 	"io"
+	"math"
+	"net"
 	"net/http"
 	"net/url"
+	"slices"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
 
+	"gpt-load/internal/apierror"
+	"gpt-load/internal/cache"
+	"gpt-load/internal/config"
+	"gpt-load/internal/dns"
 	"gpt-load/internal/errors"
+	"gpt-load/internal/metrics"
+	"gpt-load/internal/middleware"
+	"gpt-load/internal/redact"
+	"gpt-load/internal/tracing"
 	"gpt-load/pkg/types"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
 )
 
 // A list of errors that are considered normal during streaming when a client disconnects.
@@ -38,14 +54,43 @@ func isIgnorableStreamError(err error) bool {
 	return false
 }
 
+// isTimeoutError checks if an upstream request failed because it timed out
+func isTimeoutError(err error) bool {
+	if stderrors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return stderrors.As(err, &netErr) && netErr.Timeout()
+}
+
 // ProxyServer represents the proxy server
 type ProxyServer struct {
 	keyManager    types.KeyManager
 	configManager types.ConfigManager
 	httpClient    *http.Client
-	streamClient  *http.Client // Dedicated client for streaming
-	requestCount  int64
-	startTime     time.Time
+	streamClient  *http.Client        // Dedicated client for streaming
+	mirrorClient  *http.Client        // Bounded by MIRROR_TIMEOUT_MS per request
+	flightGroup   *singleflight.Group // Nil unless singleflight is enabled
+	responseCache *cache.LRU          // Nil unless response caching is enabled
+	signer        *requestSigner      // Nil unless SigV4 signing is enabled
+	// Nil unless latency-based upstream ordering is enabled
+	latencyTracker *latencyTracker
+	serverTiming   bool
+	genericMode    bool
+	injectFields   map[string]any
+	injectOverride bool
+	normalizeOrder bool
+	upstreamQuery  url.Values
+	maxSSEEvents   int
+	// Request paths broadcast to every upstream, nil unless broadcasting is enabled
+	broadcastPaths map[string]bool
+	redactor       *redact.Redactor // Nil unless body redaction patterns are configured
+	// Proxies whose X-Forwarded-* headers are extended rather than replaced
+	trustedProxies []*net.IPNet
+	// Round-robin counter over fallback upstream keys
+	fallbackKeyCounter uint64
+	requestCount       int64
+	startTime          time.Time
 }
 
 // NewProxyServer creates a new proxy server
@@ -53,33 +98,83 @@ func NewProxyServer(keyManager types.KeyManager, configManager types.ConfigManag
 	openaiConfig := configManager.GetOpenAIConfig()
 	perfConfig := configManager.GetPerformanceConfig()
 
-	// Create high-performance HTTP client
-	transport := &http.Transport{
-		MaxIdleConns:          100,
-		MaxIdleConnsPerHost:   20,
-		MaxConnsPerHost:       0,
-		IdleConnTimeout:       time.Duration(openaiConfig.IdleConnTimeout) * time.Second,
-		TLSHandshakeTimeout:   time.Duration(openaiConfig.ResponseTimeout) * time.Second,
-		ExpectContinueTimeout: 1 * time.Second,
-		DisableCompression:    !perfConfig.EnableGzip,
-		ForceAttemptHTTP2:     true,
-		WriteBufferSize:       32 * 1024,
-		ReadBufferSize:        32 * 1024,
-	}
-
-	// Create dedicated transport for streaming, optimize TCP parameters
-	streamTransport := &http.Transport{
-		MaxIdleConns:          200,
-		MaxIdleConnsPerHost:   40,
-		MaxConnsPerHost:       0,
-		IdleConnTimeout:       time.Duration(openaiConfig.IdleConnTimeout) * time.Second,
-		TLSHandshakeTimeout:   time.Duration(openaiConfig.ResponseTimeout) * time.Second,
-		ExpectContinueTimeout: 1 * time.Second,
-		DisableCompression:    true, // Always disable compression for streaming
-		ForceAttemptHTTP2:     true,
-		WriteBufferSize:       64 * 1024,
-		ReadBufferSize:        64 * 1024,
-		ResponseHeaderTimeout: time.Duration(openaiConfig.ResponseTimeout) * time.Second,
+	// Dialer shared by both transports, optionally rate limited per upstream
+	dialTimeout, handshakeTimeout := connectTimeouts(openaiConfig)
+	dialer := &net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	dialContext := dialer.DialContext
+	if openaiConfig.DNSCacheTTLSeconds > 0 {
+		resolver := dns.New(time.Duration(openaiConfig.DNSCacheTTLSeconds)*time.Second, time.Duration(openaiConfig.DNSNegativeCacheTTLSeconds)*time.Second)
+		dialContext = resolvingDial(resolver, dialContext)
+	}
+	// Outside the resolver, so the budget stays per upstream host rather than per address
+	if openaiConfig.MaxConnectAttemptsPerSecond > 0 {
+		dialContext = newConnectLimiter(openaiConfig.MaxConnectAttemptsPerSecond).wrap(dialContext)
+	}
+
+	// Client certificates for upstreams requiring mTLS
+	clientTLS, err := newUpstreamTLS(openaiConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create high-performance HTTP transports
+	newTransport := func() *http.Transport {
+		transport := &http.Transport{
+			DialContext:           dialContext,
+			MaxIdleConns:          100,
+			MaxIdleConnsPerHost:   20,
+			MaxConnsPerHost:       0,
+			IdleConnTimeout:       time.Duration(openaiConfig.IdleConnTimeout) * time.Second,
+			TLSHandshakeTimeout:   handshakeTimeout,
+			ExpectContinueTimeout: 1 * time.Second,
+			DisableCompression:    !perfConfig.EnableGzip,
+			ForceAttemptHTTP2:     true,
+			WriteBufferSize:       32 * 1024,
+			ReadBufferSize:        32 * 1024,
+			ResponseHeaderTimeout: time.Duration(openaiConfig.UpstreamResponseHeaderTimeoutMs) * time.Millisecond,
+		}
+		if clientTLS != nil {
+			transport.DialTLSContext = clientTLS.wrap(dialContext)
+		}
+		return transport
+	}
+
+	// Create dedicated transports for streaming, optimize TCP parameters
+	newStreamTransport := func() *http.Transport {
+		streamTransport := &http.Transport{
+			DialContext:           dialContext,
+			MaxIdleConns:          200,
+			MaxIdleConnsPerHost:   40,
+			MaxConnsPerHost:       0,
+			IdleConnTimeout:       time.Duration(openaiConfig.IdleConnTimeout) * time.Second,
+			TLSHandshakeTimeout:   handshakeTimeout,
+			ExpectContinueTimeout: 1 * time.Second,
+			DisableCompression:    true, // Always disable compression for streaming
+			ForceAttemptHTTP2:     true,
+			WriteBufferSize:       64 * 1024,
+			ReadBufferSize:        64 * 1024,
+			ResponseHeaderTimeout: time.Duration(openaiConfig.ResponseTimeout) * time.Second,
+		}
+		if openaiConfig.UpstreamResponseHeaderTimeoutMs > 0 {
+			streamTransport.ResponseHeaderTimeout = time.Duration(openaiConfig.UpstreamResponseHeaderTimeoutMs) * time.Millisecond
+		}
+		if clientTLS != nil {
+			streamTransport.DialTLSContext = clientTLS.wrap(dialContext)
+		}
+		return streamTransport
+	}
+
+	// One connection pool per upstream for each kind of request
+	transport, err := newUpstreamTransports(newTransport, openaiConfig)
+	if err != nil {
+		return nil, err
+	}
+	streamTransport, err := newUpstreamTransports(newStreamTransport, openaiConfig)
+	if err != nil {
+		return nil, err
 	}
 
 	httpClient := &http.Client{
@@ -92,42 +187,165 @@ func NewProxyServer(keyManager types.KeyManager, configManager types.ConfigManag
 		Transport: streamTransport,
 	}
 
-	return &ProxyServer{
-		keyManager:    keyManager,
-		configManager: configManager,
-		httpClient:    httpClient,
-		streamClient:  streamClient,
-		startTime:     time.Now(),
-	}, nil
+	var flightGroup *singleflight.Group
+	if perfConfig.SingleflightEnabled {
+		flightGroup = &singleflight.Group{}
+	}
+
+	var responseCache *cache.LRU
+	if perfConfig.CacheEnabled {
+		responseCache = cache.NewLRU(time.Duration(perfConfig.CacheTTLSeconds)*time.Second, int64(perfConfig.CacheMaxSizeMB)*1024*1024)
+	}
+
+	var signer *requestSigner
+	if openaiConfig.AWSSigV4Enabled {
+		signer = newRequestSigner(openaiConfig)
+	}
+
+	// Both were already checked by Validate
+	upstreamQuery, err := url.ParseQuery(openaiConfig.UpstreamQueryParams)
+	if err != nil {
+		return nil, err
+	}
+	redactor, err := redact.New(configManager.GetLogConfig().BodyRedactPatterns)
+	if err != nil {
+		return nil, err
+	}
+
+	ps := &ProxyServer{
+		keyManager:     keyManager,
+		configManager:  configManager,
+		httpClient:     httpClient,
+		streamClient:   streamClient,
+		mirrorClient:   &http.Client{Transport: transport},
+		flightGroup:    flightGroup,
+		responseCache:  responseCache,
+		signer:         signer,
+		serverTiming:   configManager.GetLogConfig().ServerTimingEnabled,
+		genericMode:    openaiConfig.GenericProxyMode,
+		injectFields:   openaiConfig.InjectBodyFields,
+		injectOverride: openaiConfig.InjectBodyOverride,
+		normalizeOrder: openaiConfig.NormalizeMessageOrder,
+		upstreamQuery:  upstreamQuery,
+		maxSSEEvents:   perfConfig.MaxSSEEventsPerResponse,
+		redactor:       redactor,
+		trustedProxies: middleware.ParseIPNets(configManager.GetServerConfig().TrustedProxyCIDRs),
+		startTime:      time.Now(),
+	}
+
+	if openaiConfig.BroadcastEnabled {
+		ps.broadcastPaths = make(map[string]bool, len(openaiConfig.BroadcastPaths))
+		for _, path := range openaiConfig.BroadcastPaths {
+			ps.broadcastPaths[path] = true
+		}
+	}
+
+	if openaiConfig.LatencySortInterval > 0 {
+		ps.latencyTracker = newLatencyTracker(openaiConfig.LatencyWindow)
+		if err := ps.startLatencySort(time.Duration(openaiConfig.LatencySortInterval) * time.Second); err != nil {
+			return nil, err
+		}
+	}
+
+	return ps, nil
 }
 
 // HandleProxy handles proxy requests
 func (ps *ProxyServer) HandleProxy(c *gin.Context) {
+	log := middleware.GetLogger(c)
+
 	startTime := time.Now()
 
-	// Increment request count
-	atomic.AddInt64(&ps.requestCount, 1)
+	// Increment request count, the startup self-test is not counted
+	if !middleware.IsSelfTest(c) {
+		atomic.AddInt64(&ps.requestCount, 1)
+	}
+
+	// Report key pool capacity before anything writes the body
+	if keysConfig := ps.configManager.GetKeysConfig(); keysConfig.EmitCapacityHeaders && (keysConfig.EmitCapacityHeadersPublic || middleware.IsAdmin(c)) {
+		capacity := ps.keyManager.GetCapacity()
+		c.Header("X-GPT-Load-Keys-Total", strconv.Itoa(capacity.Total))
+		c.Header("X-GPT-Load-Keys-Active", strconv.Itoa(capacity.Active))
+		c.Header("X-GPT-Load-Keys-Blacklisted", strconv.Itoa(capacity.Blacklisted))
+	}
+
+	// Hold the whole response back until it is complete, upgrades are never buffered
+	if ps.configManager.GetPerformanceConfig().ResponseBuffering == config.ResponseBufferingFull && !isWebSocketUpgrade(c.Request) {
+		buffered := &bufferedWriter{ResponseWriter: c.Writer}
+		c.Writer = buffered
+		defer ps.sendBuffered(c, buffered)
+	}
+
+	// Transparent reverse proxy, no OpenAI-specific handling
+	if ps.genericMode {
+		ps.handleGeneric(c)
+		return
+	}
+
+	// Real-time APIs are tunnelled as WebSocket connections
+	if isWebSocketUpgrade(c.Request) && ps.configManager.GetPerformanceConfig().WSEnabled {
+		ps.handleWebSocket(c)
+		return
+	}
 
 	// Cache all request body upfront
 	var bodyBytes []byte
 	if c.Request.Body != nil {
 		var err error
 		bodyBytes, err = io.ReadAll(c.Request.Body)
+		if middleware.IsBodyTooLarge(err) {
+			middleware.RespondBodyTooLarge(c, int64(ps.configManager.GetPerformanceConfig().MaxRequestBodyBytes))
+			return
+		}
 		if err != nil {
-			logrus.Errorf("Failed to read request body: %v", err)
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "Failed to read request body",
-				"code":  errors.ErrProxyRequest,
-			})
+			log.Errorf("Failed to read request body: %v", err)
+			middleware.RespondError(c, apierror.NewInvalidRequestError(errors.ErrProxyRequest, "Failed to read request body"))
 			return
 		}
 	}
 
+	// Merge provider-specific fields before anything inspects the body
+	if len(ps.injectFields) > 0 {
+		bodyBytes = injectBodyFields(bodyBytes, ps.injectFields, ps.injectOverride)
+	}
+
+	// Put system messages first for models that expect them there
+	if ps.normalizeOrder {
+		bodyBytes = normalizeMessageOrder(bodyBytes)
+	}
+
+	// Extract model name for logging and attach its cost attribution tags
+	model := extractModel(bodyBytes)
+	c.Set("model", model)
+	middleware.SetModelTags(c, ps.configManager.GetModelTags(model))
+
 	// Determine if this is a streaming request using cached data
 	isStreamRequest := ps.isStreamRequest(bodyBytes, c)
+	c.Set("isStreamRequest", isStreamRequest)
+
+	// Send selected non-streaming paths to every upstream at once
+	if !isStreamRequest && ps.broadcastPaths[c.Request.URL.Path] {
+		ps.executeBroadcast(c, bodyBytes)
+		return
+	}
+
+	execute := func() {
+		// Coalesce identical concurrent non-streaming requests
+		if ps.flightGroup != nil && !isStreamRequest {
+			ps.executeCoalesced(c, startTime, bodyBytes)
+			return
+		}
 
-	// Execute request with retry
-	ps.executeRequestWithRetry(c, startTime, bodyBytes, isStreamRequest, 0, nil)
+		// Execute request with retry
+		ps.executeRequestWithRetry(c, startTime, bodyBytes, isStreamRequest, 0, nil)
+	}
+
+	// Answer repeated non-streaming chat completions without using a key
+	if ps.isCacheable(c, isStreamRequest) {
+		ps.executeCached(c, bodyBytes, execute)
+		return
+	}
+	execute()
 }
 
 // isStreamRequest determines if this is a streaming request
@@ -153,40 +371,133 @@ func (ps *ProxyServer) isStreamRequest(bodyBytes []byte, c *gin.Context) bool {
 	return false
 }
 
+// extractModel extracts the model field from a JSON request body
+func extractModel(bodyBytes []byte) string {
+	if len(bodyBytes) == 0 {
+		return ""
+	}
+	var payload struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(bodyBytes, &payload); err != nil {
+		return ""
+	}
+	return payload.Model
+}
+
+// startTimeoutWarning schedules a warning log at TIMEOUT_WARNING_PERCENT of the
+// request timeout. The returned function cancels the warning and is safe to call twice.
+func (ps *ProxyServer) startTimeoutWarning(c *gin.Context, openaiConfig types.OpenAIConfig, isStreamRequest bool) func() {
+	log := middleware.GetLogger(c)
+
+	if isStreamRequest || openaiConfig.TimeoutWarningPercent <= 0 {
+		return func() {}
+	}
+
+	attemptStart := time.Now()
+	requestID := middleware.GetRequestID(c)
+	model := c.GetString("model")
+	warnAfter := time.Duration(float64(openaiConfig.RequestTimeout) * float64(time.Second) * openaiConfig.TimeoutWarningPercent / 100)
+
+	timer := time.AfterFunc(warnAfter, func() {
+		log.WithFields(logrus.Fields{
+			"request_id": requestID,
+			"upstream":   openaiConfig.BaseURL,
+			"model":      model,
+			"elapsed":    time.Since(attemptStart).String(),
+		}).Warnf("Request still in flight, approaching %ds timeout", openaiConfig.RequestTimeout)
+	})
+	return func() { timer.Stop() }
+}
+
+// retryWithBackoff waits out the retry backoff, then makes the next attempt.
+// A client disconnect during the wait abandons the request.
+func (ps *ProxyServer) retryWithBackoff(c *gin.Context, startTime time.Time, bodyBytes []byte, isStreamRequest bool, retryCount int, retryErrors []types.RetryError) {
+	// No wait when the retry budget is already spent
+	if keysConfig := ps.configManager.GetKeysConfig(); retryCount <= keysConfig.MaxRetries {
+		delay := retryDelay(retryCount-1,
+			time.Duration(keysConfig.RetryBaseDelayMs)*time.Millisecond,
+			time.Duration(keysConfig.RetryMaxDelayMs)*time.Millisecond,
+			keysConfig.RetryJitterFactor)
+		if !sleepContext(c.Request.Context(), delay) {
+			middleware.GetLogger(c).Debugf("Client disconnected during retry backoff (attempt %d)", retryCount+1)
+			return
+		}
+	}
+	ps.executeRequestWithRetry(c, startTime, bodyBytes, isStreamRequest, retryCount, retryErrors)
+}
+
 // executeRequestWithRetry executes request with retry logic
 func (ps *ProxyServer) executeRequestWithRetry(c *gin.Context, startTime time.Time, bodyBytes []byte, isStreamRequest bool, retryCount int, retryErrors []types.RetryError) {
+	log := middleware.GetLogger(c)
+
 	keysConfig := ps.configManager.GetKeysConfig()
 
 	if retryCount > keysConfig.MaxRetries {
-		logrus.Debugf("Max retries exceeded (%d)", retryCount-1)
+		log.Debugf("Max retries exceeded (%d)", retryCount-1)
+
+		// Try the fallback upstream once when the primaries look down
+		if openaiConfig := ps.configManager.GetOpenAIConfig(); shouldFallback(openaiConfig, retryErrors) {
+			ps.executeFallback(c, openaiConfig, bodyBytes, isStreamRequest)
+			return
+		}
 
-		errorResponse := gin.H{
-			"error":        "Max retries exceeded",
-			"code":         errors.ErrProxyRetryExhausted,
-			"retry_count":  retryCount - 1,
-			"retry_errors": retryErrors,
-			"timestamp":    time.Now().UTC().Format(time.RFC3339),
+		// Report the final attempt timing out separately from general exhaustion
+		errorCode := errors.ErrProxyRetryExhausted
+		if len(retryErrors) > 0 && retryErrors[len(retryErrors)-1].Timeout {
+			errorCode = errors.ErrProxyTimeout
 		}
 
 		statusCode := http.StatusBadGateway
 		if len(retryErrors) > 0 && retryErrors[len(retryErrors)-1].StatusCode > 0 {
-			statusCode = retryErrors[len(retryErrors)-1].StatusCode
+			remap := ps.configManager.GetOpenAIConfig().StatusRemap
+			statusCode = remapStatusCode(middleware.GetLogger(c), remap, retryErrors[len(retryErrors)-1].StatusCode)
+		}
+
+		// Tell the client to wait as long as the most patient upstream asked
+		if statusCode == http.StatusTooManyRequests {
+			if retryAfter := maxRetryAfterSeconds(retryErrors); retryAfter > 0 {
+				c.Header("Retry-After", strconv.Itoa(retryAfter))
+			}
 		}
 
-		c.JSON(statusCode, errorResponse)
+		middleware.RespondError(c, apierror.NewUpstreamError(statusCode, errorCode, "Max retries exceeded").
+			With("retry_count", retryCount-1).
+			With("retry_errors", retryErrors).
+			With("timestamp", time.Now().UTC().Format(time.RFC3339)))
 		return
 	}
 
 	// Get key information
 	keyInfo, err := ps.keyManager.GetNextKey()
 	if err != nil {
-		logrus.Errorf("Failed to get key: %v", err)
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"error": "No API keys available",
-			"code":  errors.ErrNoKeysAvailable,
-		})
+		// Saturated keys free up as requests finish, so back off and retry as after a 429
+		if stderrors.Is(err, errors.ErrAllAPIKeysBusy) {
+			log.Debugf("All keys are at their concurrency limit (attempt %d)", retryCount+1)
+			retryErrors = append(retryErrors, types.RetryError{
+				StatusCode:   http.StatusTooManyRequests,
+				ErrorMessage: err.Error(),
+				KeyIndex:     -1,
+				Attempt:      retryCount + 1,
+			})
+			ps.retryWithBackoff(c, startTime, bodyBytes, isStreamRequest, retryCount+1, retryErrors)
+			return
+		}
+
+		// Keys out of tokens refill on a known schedule, so tell the client when to come back
+		var retryAfterErr *errors.RetryAfterError
+		if stderrors.As(err, &retryAfterErr) {
+			log.Warnf("All keys are at their rate limit, next token in %v", retryAfterErr.RetryAfter)
+			respondKeysRateLimited(c, retryAfterErr.RetryAfter)
+			return
+		}
+
+		log.Errorf("Failed to get key: %v", err)
+		middleware.RespondError(c, apierror.NewUpstreamError(http.StatusServiceUnavailable, errors.ErrNoKeysAvailable, "No API keys available"))
 		return
 	}
+	// Hold the key's concurrency slot until the response is fully handled
+	defer keyInfo.Release()
 
 	// Set key information to context (for logging)
 	c.Set("keyIndex", keyInfo.Index)
@@ -197,15 +508,23 @@ func (ps *ProxyServer) executeRequestWithRetry(c *gin.Context, startTime time.Ti
 		c.Set("retryCount", retryCount)
 	}
 
-	// Get a base URL from the config manager (handles round-robin)
-	openaiConfig := ps.configManager.GetOpenAIConfig()
+	// Get a base URL from the config manager (handles model routing and round-robin)
+	openaiConfig := ps.configManager.GetOpenAIConfigForModel(c.GetString("model"))
+	if openaiConfig.LoadBalanceStrategy == config.LoadBalanceConsistentHash {
+		openaiConfig.BaseURL = ps.configManager.GetUpstreamForCaller(callerID(c), c.GetString("model"))
+		openaiConfig.UpstreamGroup = ""
+	}
+	if openaiConfig.UpstreamGroup != "" {
+		log = log.WithField("upstream_group", openaiConfig.UpstreamGroup)
+		middleware.SetLogger(c, log)
+		log.Debugf("Routing attempt to upstream group %s (%s)", openaiConfig.UpstreamGroup, openaiConfig.BaseURL)
+		metrics.UpstreamGroupRequests.WithLabelValues(openaiConfig.UpstreamGroup, costCenter(c.Request.Context())).Inc()
+	}
+	c.Set("upstream", openaiConfig.BaseURL)
 	upstreamURL, err := url.Parse(openaiConfig.BaseURL)
 	if err != nil {
-		logrus.Errorf("Failed to parse upstream URL: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Invalid upstream URL configured",
-			"code":  errors.ErrConfigInvalid,
-		})
+		log.Errorf("Failed to parse upstream URL: %v", err)
+		middleware.RespondError(c, apierror.NewServerError(errors.ErrConfigInvalid, "Invalid upstream URL configured"))
 		return
 	}
 
@@ -217,7 +536,33 @@ func (ps *ProxyServer) executeRequestWithRetry(c *gin.Context, startTime time.Ti
 	} else {
 		targetURL.Path = targetURL.Path + c.Request.URL.Path
 	}
-	targetURL.RawQuery = c.Request.URL.RawQuery
+	targetURL.RawQuery = mergeUpstreamQuery(c.Request.URL.RawQuery, ps.upstreamQuery)
+	if openaiConfig.UpstreamType == config.UpstreamTypeAzure {
+		if err := rewriteAzureURL(&targetURL, upstreamURL.Path, c.Request.URL.Path, c.GetString("model"), openaiConfig); err != nil {
+			log.Warnf("Cannot route request to Azure: %v", err)
+			middleware.RespondError(c, apierror.NewInvalidRequestError(errors.ErrProxyRequest, "Model cannot be used as an Azure deployment name"))
+			return
+		}
+	}
+
+	// Chat completions become Anthropic Messages API requests, the OpenAI body
+	// is kept for retries, caching and coalescing
+	upstreamBody := bodyBytes
+	translateAnthropic := openaiConfig.UpstreamType == config.UpstreamTypeAnthropic && c.Request.URL.Path == anthropicChatPath
+	if translateAnthropic {
+		upstreamBody, err = toAnthropicRequest(bodyBytes)
+		if err != nil {
+			log.Warnf("Cannot translate request for Anthropic: %v", err)
+			middleware.RespondError(c, apierror.NewInvalidRequestError(errors.ErrProxyRequest, err.Error()))
+			return
+		}
+		targetURL.Path = strings.TrimSuffix(upstreamURL.Path, "/") + anthropicMessagesPath
+	}
+
+	// Copy the first attempt of sampled requests to the mirror upstream
+	if retryCount == 0 && len(retryErrors) == 0 && shouldMirror(openaiConfig) {
+		ps.mirrorRequest(c, openaiConfig, keyInfo.Key, bodyBytes)
+	}
 
 	// Use different timeout strategies for streaming and non-streaming requests
 	var ctx context.Context
@@ -233,34 +578,54 @@ func (ps *ProxyServer) executeRequestWithRetry(c *gin.Context, startTime time.Ti
 	}
 	defer cancel()
 
+	// Warn when a non-streaming request approaches its timeout
+	stopTimeoutWarning := ps.startTimeoutWarning(c, openaiConfig, isStreamRequest)
+	defer stopTimeoutWarning()
+
+	// Trace the upstream attempt as part of the caller's trace
+	ctx, span := tracing.StartUpstreamSpan(ctx, openaiConfig.BaseURL, keyInfo.Key, c.GetString("model"))
+	defer span.End()
+
 	// Create request using cached bodyBytes
 	req, err := http.NewRequestWithContext(
 		ctx,
 		c.Request.Method,
 		targetURL.String(),
-		bytes.NewReader(bodyBytes),
+		bytes.NewReader(upstreamBody),
 	)
 	if err != nil {
-		logrus.Errorf("Failed to create upstream request: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to create upstream request",
-			"code":  errors.ErrProxyRequest,
-		})
+		log.Errorf("Failed to create upstream request: %v", err)
+		middleware.RespondError(c, apierror.NewServerError(errors.ErrProxyRequest, "Failed to create upstream request"))
 		return
 	}
-	req.ContentLength = int64(len(bodyBytes))
+	req.ContentLength = int64(len(upstreamBody))
 
-	// Copy request headers
+	// Copy request headers. A protocol upgrade cannot be relayed as a plain HTTP
+	// request, upgrades are only tunnelled by handleWebSocket.
 	for key, values := range c.Request.Header {
-		if key != "Host" {
+		if key != "Host" && key != "Connection" && key != "Upgrade" {
 			for _, value := range values {
 				req.Header.Add(key, value)
 			}
 		}
 	}
+	// Translated responses are rewritten, so let the transport decompress them
+	if translateAnthropic {
+		req.Header.Del("Accept-Encoding")
+	}
 
-	// Set authorization header
-	req.Header.Set("Authorization", "Bearer "+keyInfo.Key)
+	setUpstreamKey(req.Header, openaiConfig, keyInfo.Key)
+	setUpstreamUserAgent(req.Header, openaiConfig)
+	ps.setForwardedHeaders(req.Header, c.Request)
+
+	tracing.Inject(ctx, req.Header)
+
+	// Let the upstream's logs be correlated with ours
+	if openaiConfig.ForwardRequestIDToUpstream {
+		if requestID := middleware.GetRequestID(c); requestID != "" {
+			req.Header.Set(openaiConfig.UpstreamRequestIDHeader, requestID)
+		}
+	}
 
 	// Choose appropriate client based on request type
 	var client *http.Client
@@ -272,20 +637,47 @@ func (ps *ProxyServer) executeRequestWithRetry(c *gin.Context, startTime time.Ti
 		client = ps.httpClient
 	}
 
-	// Send request
+	// Sign last so the signature covers the final request
+	if ps.signer != nil {
+		if err := ps.signer.sign(ctx, req, upstreamBody); err != nil {
+			log.Errorf("Failed to sign upstream request: %v", err)
+			middleware.RespondError(c, apierror.NewServerError(errors.ErrProxyRequest, "Failed to sign upstream request"))
+			return
+		}
+	}
+
+	// Send request, counting it in flight until the response is fully handled
+	releaseUpstream := ps.configManager.AcquireUpstream(openaiConfig.BaseURL)
+	defer releaseUpstream()
+	attemptStart := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
+		releaseUpstream()
+		keyInfo.Release()
+		err = redactUpstreamQuery(err, ps.upstreamQuery)
+		metrics.RequestsTotal.WithLabelValues(openaiConfig.BaseURL, "error", costCenter(c.Request.Context())).Inc()
+		tracing.RecordError(span, err)
 		responseTime := time.Since(startTime)
 
 		// Log failure
 		if retryCount > 0 {
-			logrus.Warnf("Retry request failed (attempt %d): %v (response time: %v)", retryCount+1, err, responseTime)
+			log.Warnf("Retry request failed (attempt %d): %v (response time: %v)", retryCount+1, err, responseTime)
 		} else {
-			logrus.Warnf("Initial request failed: %v (response time: %v)", err, responseTime)
+			log.Warnf("Initial request failed: %v (response time: %v)", err, responseTime)
 		}
 
-		// Record failure asynchronously
-		go ps.keyManager.RecordFailure(keyInfo.Key, err)
+		// Record failure asynchronously, a connect that was rate limited or failed
+		// is not the key's fault, and the retry may pick another upstream
+		if !stderrors.Is(err, errConnectRateLimited) {
+			if !isConnectError(err) {
+				go ps.keyManager.RecordFailure(keyInfo.Key, err)
+			}
+
+			// Nor the upstream's, and neither is the client going away
+			if c.Request.Context().Err() == nil {
+				ps.configManager.RecordUpstreamResult(openaiConfig.BaseURL, true)
+			}
+		}
 
 		// Record retry error information
 		if retryErrors == nil {
@@ -296,29 +688,56 @@ func (ps *ProxyServer) executeRequestWithRetry(c *gin.Context, startTime time.Ti
 			ErrorMessage: err.Error(),
 			KeyIndex:     keyInfo.Index,
 			Attempt:      retryCount + 1,
+			Timeout:      isTimeoutError(err),
 		})
 
 		// Retry
-		ps.executeRequestWithRetry(c, startTime, bodyBytes, isStreamRequest, retryCount+1, retryErrors)
+		stopTimeoutWarning()
+		ps.retryWithBackoff(c, startTime, bodyBytes, isStreamRequest, retryCount+1, retryErrors)
 		return
 	}
 	defer resp.Body.Close()
 
+	ps.configManager.RecordUpstreamResult(openaiConfig.BaseURL, resp.StatusCode >= http.StatusInternalServerError)
+
+	upstreamLatency := time.Since(attemptStart)
+	metrics.RequestsTotal.WithLabelValues(openaiConfig.BaseURL, strconv.Itoa(resp.StatusCode), costCenter(c.Request.Context())).Inc()
+	metrics.RequestDuration.WithLabelValues(openaiConfig.BaseURL, costCenter(c.Request.Context())).Observe(upstreamLatency.Seconds())
+	tracing.RecordStatus(span, resp.StatusCode)
+	if ps.latencyTracker != nil {
+		ps.latencyTracker.record(openaiConfig.BaseURL, upstreamLatency)
+	}
+	ps.configManager.RecordUpstreamLatency(openaiConfig.BaseURL, upstreamLatency)
+	ps.keyManager.RecordLatency(keyInfo.Key, upstreamLatency)
+
 	responseTime := time.Since(startTime)
 
+	// Tag the rest of this request's logs with the upstream's own request ID
+	if openaiConfig.CaptureUpstreamIDHeader != "" {
+		if upstreamRequestID := resp.Header.Get(openaiConfig.CaptureUpstreamIDHeader); upstreamRequestID != "" {
+			log = log.WithField("upstream_request_id", upstreamRequestID)
+			middleware.SetLogger(c, log)
+		}
+	}
+
 	// Check if HTTP status code requires retry
 	if resp.StatusCode >= 400 {
 		// Log failure
 		if retryCount > 0 {
-			logrus.Debugf("Retry request returned error %d (attempt %d) (response time: %v)", resp.StatusCode, retryCount+1, responseTime)
+			log.Debugf("Retry request returned error %d (attempt %d) (response time: %v)", resp.StatusCode, retryCount+1, responseTime)
 		} else {
-			logrus.Debugf("Initial request returned error %d (response time: %v)", resp.StatusCode, responseTime)
+			log.Debugf("Initial request returned error %d (response time: %v)", resp.StatusCode, responseTime)
 		}
 
 		// Read response body to get error information
 		var errorMessage string
-		if bodyBytes, err := io.ReadAll(resp.Body); err == nil {
-			errorMessage = string(bodyBytes)
+		errorBody, readErr := io.ReadAll(resp.Body)
+		if readErr == nil {
+			if openaiConfig.UpstreamType == config.UpstreamTypeAnthropic {
+				errorBody = fromAnthropicError(errorBody)
+				resp.Header.Del("Content-Length")
+			}
+			errorMessage = string(errorBody)
 		} else {
 			errorMessage = fmt.Sprintf("HTTP %d", resp.StatusCode)
 		}
@@ -329,39 +748,133 @@ func (ps *ProxyServer) executeRequestWithRetry(c *gin.Context, startTime time.Ti
 			} `json:"error"`
 		}
 
-		if err := json.Unmarshal([]byte(errorMessage), &jsonError); err == nil && jsonError.Error.Message != "" {
-			logrus.Warnf("Http Error: %s", jsonError.Error.Message)
+		suppressed := isErrorSuppressed(keysConfig.ErrorSuppression, keyInfo.Key, resp.StatusCode, c.GetString("model"))
+		if suppressed {
+			log.Debugf("Suppressed known HTTP %d from key %s for model %s, retrying with another key", resp.StatusCode, keyInfo.Preview, c.GetString("model"))
+		} else if err := json.Unmarshal([]byte(errorMessage), &jsonError); err == nil && jsonError.Error.Message != "" {
+			log.Warnf("Http Error: %s", ps.redactor.Redact(jsonError.Error.Message))
 		} else {
-			logrus.Warnf("Http Error: %s", errorMessage)
+			log.Warnf("Http Error: %s", ps.redactor.Redact(errorMessage))
 		}
 
-		// Record failure asynchronously
-		go ps.keyManager.RecordFailure(keyInfo.Key, fmt.Errorf("HTTP %d", resp.StatusCode))
-
 		// Record retry error information
 		if retryErrors == nil {
 			retryErrors = make([]types.RetryError, 0)
 		}
-		retryErrors = append(retryErrors, types.RetryError{
+		retryError := types.RetryError{
 			StatusCode:   resp.StatusCode,
 			ErrorMessage: errorMessage,
 			KeyIndex:     keyInfo.Index,
 			Attempt:      retryCount + 1,
-		})
+		}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			retryError.RetryAfterSeconds = retryAfterSeconds(resp.Header.Get("Retry-After"))
+		}
+		retryErrors = append(retryErrors, retryError)
+
+		// Known model-specific failures don't count against the key
+		if suppressed {
+			stopTimeoutWarning()
+			releaseUpstream()
+			keyInfo.Release()
+			ps.retryWithBackoff(c, startTime, bodyBytes, isStreamRequest, retryCount+1, retryErrors)
+			return
+		}
+
+		// Authentication errors usually mean the key itself is invalid or expired
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			retryOnAuthError := (resp.StatusCode == http.StatusUnauthorized && keysConfig.RetryOn401) ||
+				(resp.StatusCode == http.StatusForbidden && keysConfig.RetryOn403)
+
+			// MAX_RETRIES=0 disables retries even for authentication errors
+			if !retryOnAuthError || keysConfig.MaxRetries == 0 {
+				go ps.keyManager.RecordFailure(keyInfo.Key, fmt.Errorf("HTTP %d", resp.StatusCode))
+				stopTimeoutWarning()
+				ps.writeUpstreamError(c, openaiConfig, resp, errorBody)
+				return
+			}
+
+			// Blacklist immediately regardless of the threshold
+			ps.keyManager.BlacklistKey(keyInfo.Key)
+			log.Debugf("Key %s rejected with HTTP %d, retrying with another key", keyInfo.Preview, resp.StatusCode)
+
+			// Auth retries don't count against MAX_RETRIES, but are bounded by the pool size
+			authRetries := len(retryErrors) - retryCount
+			if authRetries < ps.keyManager.GetStats().TotalKeys {
+				stopTimeoutWarning()
+				releaseUpstream()
+				keyInfo.Release()
+				ps.executeRequestWithRetry(c, startTime, bodyBytes, isStreamRequest, retryCount, retryErrors)
+				return
+			}
+		} else {
+			// Other errors are about the request rather than the key, so pass them through
+			if !slices.Contains(keysConfig.RetryStatusCodes, resp.StatusCode) {
+				log.Debugf("HTTP %d is not in RETRY_STATUS_CODES, returning it to the client", resp.StatusCode)
+				stopTimeoutWarning()
+				ps.writeUpstreamError(c, openaiConfig, resp, errorBody)
+				return
+			}
+
+			// Record failure asynchronously
+			go ps.keyManager.RecordFailure(keyInfo.Key, fmt.Errorf("HTTP %d", resp.StatusCode))
+			if resp.StatusCode == http.StatusTooManyRequests {
+				ps.keyManager.CooldownKey(keyInfo.Index)
+
+				// Wait as long as the upstream asks instead of the usual backoff
+				maxDelay := time.Duration(keysConfig.RetryMaxDelayMs) * time.Millisecond
+				if delay, ok := parseRetryAfter(resp.Header.Get("Retry-After"), maxDelay); ok && retryCount < keysConfig.MaxRetries {
+					stopTimeoutWarning()
+					releaseUpstream()
+					keyInfo.Release()
+					if !sleepContext(c.Request.Context(), delay) {
+						log.Debugf("Client disconnected during Retry-After wait (attempt %d)", retryCount+2)
+						return
+					}
+					ps.executeRequestWithRetry(c, startTime, bodyBytes, isStreamRequest, retryCount+1, retryErrors)
+					return
+				}
+			}
+		}
 
 		// Retry
-		ps.executeRequestWithRetry(c, startTime, bodyBytes, isStreamRequest, retryCount+1, retryErrors)
+		stopTimeoutWarning()
+		releaseUpstream()
+		keyInfo.Release()
+		ps.retryWithBackoff(c, startTime, bodyBytes, isStreamRequest, retryCount+1, retryErrors)
 		return
 	}
 
 	// Success - record success asynchronously
 	go ps.keyManager.RecordSuccess(keyInfo.Key)
+	if openaiConfig.FallbackUpstreamURL != "" {
+		metrics.FallbackRequests.WithLabelValues(servedByPrimary, costCenter(c.Request.Context())).Inc()
+	}
 
 	// Log final success result
 	if retryCount > 0 {
-		logrus.Debugf("Request succeeded after %d retries (response time: %v)", retryCount, responseTime)
+		log.Debugf("Request succeeded after %d retries (response time: %v)", retryCount, responseTime)
 	} else {
-		logrus.Debugf("Request succeeded on first attempt (response time: %v)", responseTime)
+		log.Debugf("Request succeeded on first attempt (response time: %v)", responseTime)
+	}
+
+	// Guard against upstreams sending unbounded bodies, a declared size over the
+	// limit is rejected before anything reaches the client
+	bodyLimit := responseLimit(openaiConfig, openaiConfig.BaseURL, ps.configManager.GetPerformanceConfig().MaxResponseBodyBytes)
+	resp.Body = newLimitedBody(resp.Body, bodyLimit)
+	if bodyLimit > 0 && resp.ContentLength > bodyLimit {
+		ps.respondResponseTooLarge(c, resp)
+		return
+	}
+
+	// Present Anthropic responses to the client as OpenAI chat completions
+	if translateAnthropic {
+		resp.Header.Del("Content-Length")
+		if isStreamRequest {
+			resp.Body = newAnthropicStream(resp.Body)
+		} else {
+			resp.Body = newAnthropicResponseBody(resp.Body)
+		}
 	}
 
 	// Copy response headers
@@ -371,51 +884,231 @@ func (ps *ProxyServer) executeRequestWithRetry(c *gin.Context, startTime time.Ti
 		}
 	}
 
-	// Set status code
-	c.Status(resp.StatusCode)
+	// Expose the timing breakdown, streaming bodies are still in flight so only connect time is known
+	if ps.serverTiming {
+		proxyTime := attemptStart.Sub(startTime)
+		if isStreamRequest {
+			c.Header("Server-Timing", formatServerTiming(
+				serverTimingMetric{name: "proxy", duration: proxyTime},
+				serverTimingMetric{name: "upstream_connect", duration: upstreamLatency},
+			))
+		} else {
+			c.Header("Server-Timing", formatServerTiming(
+				serverTimingMetric{name: "proxy", duration: proxyTime},
+				serverTimingMetric{name: "upstream", duration: upstreamLatency},
+				serverTimingMetric{name: "total", duration: time.Since(startTime)},
+			))
+		}
+	}
+
+	// Announce upstream trailers before the body is written
+	if openaiConfig.ForwardResponseTrailers {
+		announceTrailers(c, resp)
+	}
+
+	// Set status code, applying any configured remapping
+	statusCode := remapStatusCode(log, openaiConfig.StatusRemap, resp.StatusCode)
+	c.Status(statusCode)
 
 	// Handle streaming and non-streaming responses
 	if isStreamRequest {
-		ps.handleStreamingResponse(c, resp)
+		var metadata *streamMetadata
+		if openaiConfig.StreamingMetadataEventEnabled {
+			metadata = newStreamMetadata(openaiConfig.BaseURL, openaiConfig.UpstreamHeaderHash, retryCount+1, keyInfo.Tier, startTime)
+		}
+		ps.handleStreamingResponse(c, resp, metadata)
+	} else if statusCode != resp.StatusCode {
+		ps.handleRemappedResponse(c, resp, statusCode)
 	} else {
 		ps.handleNormalResponse(c, resp)
 	}
+
+	// Trailer values are only available once the body is fully consumed
+	if openaiConfig.ForwardResponseTrailers {
+		copyTrailers(c, resp)
+	}
+}
+
+// announceTrailers declares the upstream's trailer names on the downstream response
+func announceTrailers(c *gin.Context, resp *http.Response) {
+	if len(resp.Trailer) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(resp.Trailer))
+	for name := range resp.Trailer {
+		names = append(names, name)
+	}
+	c.Writer.Header().Set("Trailer", strings.Join(names, ", "))
+}
+
+// copyTrailers copies upstream trailer values to the downstream response
+func copyTrailers(c *gin.Context, resp *http.Response) {
+	log := middleware.GetLogger(c)
+
+	for name, values := range resp.Trailer {
+		for _, value := range values {
+			c.Writer.Header().Add(name, value)
+		}
+	}
+
+	if status := resp.Trailer.Get("Grpc-Status"); status != "" {
+		log.Debugf("Upstream gRPC trailers: Grpc-Status=%s Grpc-Message=%s", status, resp.Trailer.Get("Grpc-Message"))
+	}
+}
+
+// isErrorSuppressed reports whether a status code is a known failure of this key for the model
+func isErrorSuppressed(rules []types.KeyErrorSuppression, key string, statusCode int, model string) bool {
+	for _, rule := range rules {
+		if !strings.HasSuffix(key, rule.KeySuffix) {
+			continue
+		}
+		codeMatches := false
+		for _, code := range rule.SuppressCodes {
+			if code == statusCode {
+				codeMatches = true
+				break
+			}
+		}
+		if !codeMatches {
+			continue
+		}
+		for _, ruleModel := range rule.ForModels {
+			if ruleModel == model {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setUpstreamUserAgent replaces the client's User-Agent with UPSTREAM_USER_AGENT, or sets
+// UPSTREAM_DEFAULT_USER_AGENT when the client sent none, so the Go client's default never goes out
+func setUpstreamUserAgent(header http.Header, openaiConfig types.OpenAIConfig) {
+	switch {
+	case openaiConfig.UpstreamUserAgent != "":
+		header.Set("User-Agent", openaiConfig.UpstreamUserAgent)
+	case header.Get("User-Agent") == "":
+		header.Set("User-Agent", openaiConfig.UpstreamDefaultUserAgent)
+	}
+}
+
+// callerID identifies the caller for upstream affinity: the JWT subject,
+// a hash of the presented credential, or the client IP
+func callerID(c *gin.Context) string {
+	if subject := c.GetString("authSubject"); subject != "" {
+		return subject
+	}
+	if credential := c.GetHeader("Authorization"); credential != "" {
+		digest := sha256.Sum256([]byte(credential))
+		return hex.EncodeToString(digest[:])
+	}
+	return c.ClientIP()
+}
+
+// writeUpstreamError passes an upstream error response through to the client,
+// applying UPSTREAM_STATUS_REMAP to its status code
+func (ps *ProxyServer) writeUpstreamError(c *gin.Context, openaiConfig types.OpenAIConfig, resp *http.Response, body []byte) {
+	log := middleware.GetLogger(c)
+
+	for key, values := range resp.Header {
+		for _, value := range values {
+			c.Header(key, value)
+		}
+	}
+	c.Status(remapStatusCode(log, openaiConfig.StatusRemap, resp.StatusCode))
+	if _, err := c.Writer.Write(body); err != nil {
+		log.Errorf("Failed to write response body: %v", err)
+	}
+}
+
+// respondKeysRateLimited rejects a request when every key is out of KEY_RATE_LIMIT_RPM
+// tokens, with Retry-After set to when the first key gets a token back
+func respondKeysRateLimited(c *gin.Context, retryAfter time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	middleware.RespondError(c, apierror.NewRateLimitError(errors.ErrRateLimited, "All API keys are at their rate limit"))
+}
+
+// remapStatusCode substitutes an upstream status code according to UPSTREAM_STATUS_REMAP,
+// logging the substitution to the request logger
+func remapStatusCode(log *logrus.Entry, remap map[int]int, statusCode int) int {
+	remapped, ok := remap[statusCode]
+	if !ok {
+		return statusCode
+	}
+	log.Debugf("Remapping upstream status %d to %d", statusCode, remapped)
+	return remapped
 }
 
 // handleStreamingResponse handles streaming responses
-func (ps *ProxyServer) handleStreamingResponse(c *gin.Context, resp *http.Response) {
+func (ps *ProxyServer) handleStreamingResponse(c *gin.Context, resp *http.Response, metadata *streamMetadata) {
+	log := middleware.GetLogger(c)
+
+	// Streams get longer to drain on shutdown
+	middleware.MarkStreaming(c)
+
 	// Set headers for streaming
 	c.Header("Cache-Control", "no-cache")
 	c.Header("Connection", "keep-alive")
 
 	// Stream response directly
-	flusher, ok := c.Writer.(http.Flusher)
+	writerFlusher, ok := c.Writer.(http.Flusher)
 	if !ok {
-		logrus.Error("Streaming unsupported")
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Streaming unsupported",
-			"code":  errors.ErrServerInternal,
-		})
+		log.Error("Streaming unsupported")
+		middleware.RespondError(c, apierror.NewServerError(errors.ErrServerInternal, "Streaming unsupported"))
+		return
+	}
+	flusher := deadlineFlusher{flusher: writerFlusher, ps: ps, c: c}
+
+	// Stop runaway streams after the configured number of events
+	body := newSSEEventLimiter(resp.Body, ps.maxSSEEvents)
+
+	// Keep idle SSE connections open while the upstream is slow to produce events,
+	// pointless when the client only receives the complete response
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") && ps.configManager.GetPerformanceConfig().ResponseBuffering != config.ResponseBufferingFull {
+		interval := time.Duration(ps.configManager.GetServerConfig().SSEHeartbeatIntervalSeconds) * time.Second
+		var stopHeartbeat func()
+		body, stopHeartbeat = newHeartbeatReader(body, c.Writer, flusher, interval)
+		defer stopHeartbeat()
+	}
+
+	// Append the metadata event, which needs line-based parsing
+	if metadata != nil {
+		if err := copyStreamWithMetadata(c, body, flusher, metadata); err != nil && err != io.EOF {
+			if stderrors.Is(err, errSSEEventLimit) {
+				ps.writeSSELimitEvent(c, flusher)
+			} else if stderrors.Is(err, errResponseTooLarge) {
+				ps.respondResponseTooLarge(c, resp)
+			} else if isIgnorableStreamError(err) {
+				log.Debugf("Stream closed by client or network: %v", err)
+			} else {
+				log.Errorf("Error copying streaming response: %v", err)
+			}
+		}
 		return
 	}
 
 	// Copy streaming data with optimized buffer size
 	buffer := make([]byte, 32*1024) // 32KB buffer for better performance
 	for {
-		n, err := resp.Body.Read(buffer)
+		n, err := body.Read(buffer)
 		if n > 0 {
 			if _, writeErr := c.Writer.Write(buffer[:n]); writeErr != nil {
-				logrus.Errorf("Failed to write streaming data: %v", writeErr)
+				log.Errorf("Failed to write streaming data: %v", writeErr)
 				break
 			}
 			flusher.Flush()
 		}
 		if err != nil {
 			if err != io.EOF {
-				if isIgnorableStreamError(err) {
-					logrus.Debugf("Stream closed by client or network: %v", err)
+				if stderrors.Is(err, errSSEEventLimit) {
+					ps.writeSSELimitEvent(c, flusher)
+				} else if stderrors.Is(err, errResponseTooLarge) {
+					ps.respondResponseTooLarge(c, resp)
+				} else if isIgnorableStreamError(err) {
+					log.Debugf("Stream closed by client or network: %v", err)
 				} else {
-					logrus.Errorf("Error reading streaming response: %v", err)
+					log.Errorf("Error reading streaming response: %v", err)
 				}
 			}
 			break
@@ -423,11 +1116,75 @@ func (ps *ProxyServer) handleStreamingResponse(c *gin.Context, resp *http.Respon
 	}
 }
 
+// writeSSELimitEvent ends a stream that hit MAX_SSE_EVENTS_PER_RESPONSE with an error event.
+// Returning afterwards closes the upstream body, dropping the upstream connection.
+func (ps *ProxyServer) writeSSELimitEvent(c *gin.Context, flusher http.Flusher) {
+	middleware.GetLogger(c).WithFields(logrus.Fields{
+		"request_id": middleware.GetRequestID(c),
+		"events":     ps.maxSSEEvents,
+	}).Warn("Streaming response exceeded the SSE event limit, closing upstream connection")
+	metrics.SSELimitExceeded.WithLabelValues(costCenter(c.Request.Context())).Inc()
+
+	if _, err := c.Writer.Write([]byte(sseLimitEvent)); err == nil {
+		flusher.Flush()
+	}
+}
+
 // handleNormalResponse handles normal responses
 func (ps *ProxyServer) handleNormalResponse(c *gin.Context, resp *http.Response) {
-	// Copy response body
-	if _, err := io.Copy(c.Writer, resp.Body); err != nil {
-		logrus.Errorf("Failed to copy response body: %v", err)
+	log := middleware.GetLogger(c)
+
+	// Pass each chunk on as it arrives, a buffered writer ignores the flushes
+	flusher := deadlineFlusher{flusher: c.Writer, ps: ps, c: c}
+	buffer := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(buffer)
+		if n > 0 {
+			if _, writeErr := c.Writer.Write(buffer[:n]); writeErr != nil {
+				log.Errorf("Failed to copy response body: %v", writeErr)
+				return
+			}
+			flusher.Flush()
+		}
+		if err != nil {
+			if stderrors.Is(err, errResponseTooLarge) {
+				ps.respondResponseTooLarge(c, resp)
+			} else if err != io.EOF {
+				log.Errorf("Failed to copy response body: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// handleRemappedResponse handles responses whose status code was remapped,
+// rewriting the JSON error type to match the new status code
+func (ps *ProxyServer) handleRemappedResponse(c *gin.Context, resp *http.Response, statusCode int) {
+	log := middleware.GetLogger(c)
+
+	body, err := io.ReadAll(resp.Body)
+	if stderrors.Is(err, errResponseTooLarge) {
+		ps.respondResponseTooLarge(c, resp)
+		return
+	} else if err != nil {
+		log.Errorf("Failed to read response body: %v", err)
+		return
+	}
+
+	var payload map[string]any
+	if json.Unmarshal(body, &payload) == nil {
+		if errorObject, ok := payload["error"].(map[string]any); ok {
+			errorObject["type"] = errors.ErrorTypeForStatus(statusCode)
+			if rewritten, err := json.Marshal(payload); err == nil {
+				body = rewritten
+			}
+		}
+	}
+
+	// Body length may have changed
+	c.Writer.Header().Del("Content-Length")
+	if _, err := c.Writer.Write(body); err != nil {
+		log.Errorf("Failed to write response body: %v", err)
 	}
 }
 
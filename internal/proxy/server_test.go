@@ -0,0 +1,594 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gpt-load/internal/config"
+	"gpt-load/internal/errors"
+	"gpt-load/internal/metrics"
+	"gpt-load/internal/middleware"
+	"gpt-load/internal/version"
+	"gpt-load/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// newTestContext returns a gin context recording its response
+func newTestContext() (*gin.Context, *httptest.ResponseRecorder) {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	return c, recorder
+}
+
+// testKeyManager hands out its keys round robin, skipping blacklisted ones,
+// and records what the proxy reports about them
+type testKeyManager struct {
+	types.KeyManager
+
+	mu          sync.Mutex
+	keys        []string
+	next        int
+	blacklisted map[string]bool
+	failures    map[string]int
+	successes   map[string]int
+}
+
+func newTestKeyManager(keys ...string) *testKeyManager {
+	return &testKeyManager{
+		keys:        keys,
+		blacklisted: make(map[string]bool),
+		failures:    make(map[string]int),
+		successes:   make(map[string]int),
+	}
+}
+
+func (km *testKeyManager) GetNextKey() (*types.KeyInfo, error) {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	for range km.keys {
+		index := km.next % len(km.keys)
+		km.next++
+		if key := km.keys[index]; !km.blacklisted[key] {
+			return &types.KeyInfo{Key: key, Index: index, Preview: key, Release: func() {}}, nil
+		}
+	}
+	return nil, errors.ErrAllAPIKeysBlacklisted
+}
+
+func (km *testKeyManager) RecordSuccess(key string) {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	km.successes[key]++
+}
+
+func (km *testKeyManager) RecordFailure(key string, _ error) {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	km.failures[key]++
+}
+
+func (km *testKeyManager) BlacklistKey(key string) {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	km.blacklisted[key] = true
+}
+
+func (km *testKeyManager) isBlacklisted(key string) bool {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	return km.blacklisted[key]
+}
+
+// picks returns how many keys GetNextKey has handed out
+func (km *testKeyManager) picks() int {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	return km.next
+}
+
+func (km *testKeyManager) RecordLatency(string, time.Duration) {}
+
+func (km *testKeyManager) CooldownKey(int) {}
+
+func (km *testKeyManager) GetStats() types.Stats {
+	return types.Stats{TotalKeys: len(km.keys)}
+}
+
+func (km *testKeyManager) GetCapacity() types.KeyCapacity {
+	return types.KeyCapacity{Total: len(km.keys)}
+}
+
+// newTestProxy returns a router serving the proxy in front of upstream, configured
+// from env like the binary. Retries back off for a millisecond unless env says otherwise.
+func newTestProxy(t *testing.T, env map[string]string, keyManager types.KeyManager, upstream http.Handler) *gin.Engine {
+	t.Helper()
+	server := httptest.NewServer(upstream)
+	t.Cleanup(server.Close)
+	return newTestProxyFor(t, env, keyManager, server)
+}
+
+// newTestProxyFor is newTestProxy for an upstream server the caller started, such as a TLS one
+func newTestProxyFor(t *testing.T, env map[string]string, keyManager types.KeyManager, server *httptest.Server) *gin.Engine {
+	t.Helper()
+	t.Setenv("OPENAI_BASE_URL", server.URL)
+	t.Setenv("API_KEYS", "sk-config")
+	t.Setenv("RETRY_BASE_DELAY_MS", "1")
+	t.Setenv("RETRY_MAX_DELAY_MS", "1")
+	for key, value := range env {
+		t.Setenv(key, strings.ReplaceAll(value, "{upstream}", server.URL))
+	}
+	configManager, err := config.NewManager()
+	if err != nil {
+		t.Fatalf("config.NewManager: %v", err)
+	}
+	proxyServer, err := NewProxyServer(keyManager, configManager)
+	if err != nil {
+		t.Fatalf("NewProxyServer: %v", err)
+	}
+	t.Cleanup(proxyServer.Close)
+
+	router := gin.New()
+	router.NoRoute(proxyServer.HandleProxy)
+	return router
+}
+
+// proxyRequest sends a request through router and returns the response
+func proxyRequest(router *gin.Engine, req *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+// chatRequest returns a non-streaming chat completion request
+func chatRequest() *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func TestWriteUpstreamErrorRemapsStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		remap  map[int]int
+		status int
+		want   int
+	}{
+		{name: "no remap", status: http.StatusBadRequest, want: http.StatusBadRequest},
+		{name: "remapped", remap: map[int]int{401: 502}, status: http.StatusUnauthorized, want: http.StatusBadGateway},
+		{name: "other status kept", remap: map[int]int{401: 502}, status: http.StatusForbidden, want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, recorder := newTestContext()
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{"Content-Type": {"application/json"}}}
+			(&ProxyServer{}).writeUpstreamError(c, types.OpenAIConfig{StatusRemap: tt.remap}, resp, []byte(`{"error":{}}`))
+
+			if recorder.Code != tt.want {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.want)
+			}
+			if body := recorder.Body.String(); body != `{"error":{}}` {
+				t.Errorf("body = %q, want the upstream body", body)
+			}
+		})
+	}
+}
+
+func TestRemapStatusCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		remap  map[int]int
+		status int
+		want   int
+		logged bool
+	}{
+		{name: "no remap", status: http.StatusTooManyRequests, want: http.StatusTooManyRequests},
+		{name: "remapped", remap: map[int]int{429: 503}, status: http.StatusTooManyRequests, want: http.StatusServiceUnavailable, logged: true},
+		{name: "unmapped status", remap: map[int]int{429: 503}, status: http.StatusBadGateway, want: http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, hook := test.NewNullLogger()
+			logger.SetLevel(logrus.DebugLevel)
+			if got := remapStatusCode(logger.WithField("request_id", "req-1"), tt.remap, tt.status); got != tt.want {
+				t.Errorf("remapStatusCode = %d, want %d", got, tt.want)
+			}
+
+			entry := hook.LastEntry()
+			if !tt.logged {
+				if entry != nil {
+					t.Errorf("unexpected log entry %q", entry.Message)
+				}
+				return
+			}
+			if entry == nil || entry.Data["request_id"] != "req-1" {
+				t.Errorf("remap was not logged with the request fields")
+			}
+		})
+	}
+}
+
+func TestRetryOnAuthError(t *testing.T) {
+	tests := []struct {
+		name            string
+		env             map[string]string
+		keys            []string
+		rejectStatus    int
+		want            int
+		wantBlacklisted []string
+	}{
+		{name: "401 retried with another key", keys: []string{"sk-bad", "sk-good"}, rejectStatus: http.StatusUnauthorized, want: http.StatusOK, wantBlacklisted: []string{"sk-bad"}},
+		{name: "401 passed through when disabled", env: map[string]string{"RETRY_ON_401": "false"}, keys: []string{"sk-bad", "sk-good"}, rejectStatus: http.StatusUnauthorized, want: http.StatusUnauthorized},
+		{name: "401 passed through with MAX_RETRIES=0", env: map[string]string{"MAX_RETRIES": "0"}, keys: []string{"sk-bad", "sk-good"}, rejectStatus: http.StatusUnauthorized, want: http.StatusUnauthorized},
+		{name: "403 passed through by default", keys: []string{"sk-bad", "sk-good"}, rejectStatus: http.StatusForbidden, want: http.StatusForbidden},
+		{name: "403 retried when enabled", env: map[string]string{"RETRY_ON_403": "true"}, keys: []string{"sk-bad", "sk-good"}, rejectStatus: http.StatusForbidden, want: http.StatusOK, wantBlacklisted: []string{"sk-bad"}},
+		{
+			name:            "auth retries not counted against MAX_RETRIES",
+			env:             map[string]string{"MAX_RETRIES": "1"},
+			keys:            []string{"sk-bad-1", "sk-bad-2", "sk-bad-3", "sk-good"},
+			rejectStatus:    http.StatusUnauthorized,
+			want:            http.StatusOK,
+			wantBlacklisted: []string{"sk-bad-1", "sk-bad-2", "sk-bad-3"},
+		},
+		{name: "every key rejected", keys: []string{"sk-bad-1", "sk-bad-2"}, rejectStatus: http.StatusUnauthorized, want: http.StatusServiceUnavailable, wantBlacklisted: []string{"sk-bad-1", "sk-bad-2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyManager := newTestKeyManager(tt.keys...)
+			router := newTestProxy(t, tt.env, keyManager, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer sk-bad") {
+					w.WriteHeader(tt.rejectStatus)
+					w.Write([]byte(`{"error":{"message":"invalid api key"}}`))
+					return
+				}
+				w.Write([]byte(`{"choices":[]}`))
+			}))
+
+			if recorder := proxyRequest(router, chatRequest()); recorder.Code != tt.want {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.want)
+			}
+			for _, key := range tt.keys {
+				if blacklisted := keyManager.isBlacklisted(key); blacklisted != slices.Contains(tt.wantBlacklisted, key) {
+					t.Errorf("%s blacklisted = %v", key, blacklisted)
+				}
+			}
+		})
+	}
+}
+
+func TestBodyRedactionOnlyInLogs(t *testing.T) {
+	const card = "4111111111111111"
+	var received string
+	router := newTestProxy(t, map[string]string{"BODY_REDACT_PATTERNS": `["\\b\\d{16}\\b"]`}, newTestKeyManager("sk-upstream"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"message":"card ` + card + ` was declined"}}`))
+	}))
+	logger, hook := test.NewNullLogger()
+	router.Use(func(c *gin.Context) {
+		middleware.SetLogger(c, logrus.NewEntry(logger))
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o","messages":[{"role":"user","content":"charge `+card+`"}]}`))
+	recorder := proxyRequest(router, req)
+
+	if !strings.Contains(received, card) {
+		t.Errorf("upstream received %s, want the original body", received)
+	}
+	if !strings.Contains(recorder.Body.String(), card) {
+		t.Errorf("client received %s, want the original upstream error", recorder.Body.String())
+	}
+	logged := false
+	for _, entry := range hook.AllEntries() {
+		if strings.Contains(entry.Message, card) {
+			t.Errorf("log entry %q contains the card number", entry.Message)
+		}
+		if strings.Contains(entry.Message, "card [REDACTED] was declined") {
+			logged = true
+		}
+	}
+	if !logged {
+		t.Error("upstream error was not logged redacted")
+	}
+}
+
+// rateLimitedKeyManager is a testKeyManager whose keys are all at their rate limit
+type rateLimitedKeyManager struct {
+	*testKeyManager
+	retryAfter time.Duration
+}
+
+func (km *rateLimitedKeyManager) GetNextKey() (*types.KeyInfo, error) {
+	return nil, &errors.RetryAfterError{Err: errors.ErrAllAPIKeysRateLimited, RetryAfter: km.retryAfter}
+}
+
+func TestKeysRateLimitedRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter time.Duration
+		want       string // Retry-After header, rounded up to whole seconds
+	}{
+		{name: "under a second", retryAfter: 200 * time.Millisecond, want: "1"},
+		{name: "whole seconds", retryAfter: 3 * time.Second, want: "3"},
+		{name: "fraction rounded up", retryAfter: 3*time.Second + time.Millisecond, want: "4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var upstreamCalls int
+			km := &rateLimitedKeyManager{testKeyManager: newTestKeyManager("sk-rpm-0001"), retryAfter: tt.retryAfter}
+			router := newTestProxy(t, nil, km, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				upstreamCalls++
+			}))
+			recorder := proxyRequest(router, chatRequest())
+
+			if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") != tt.want {
+				t.Errorf("status %d with Retry-After %q, want 429 with %q", recorder.Code, recorder.Header().Get("Retry-After"), tt.want)
+			}
+			if upstreamCalls != 0 {
+				t.Errorf("upstream called %d times with every key at its rate limit", upstreamCalls)
+			}
+		})
+	}
+}
+
+func TestRetryStatusCodes(t *testing.T) {
+	tests := []struct {
+		name         string
+		env          map[string]string
+		status       int // Status the first key gets, the second key succeeds
+		want         int
+		wantCalls    int
+		wantFailures int // Failures recorded for the first key
+	}{
+		{name: "429 retried", status: http.StatusTooManyRequests, want: http.StatusOK, wantCalls: 2, wantFailures: 1},
+		{name: "500 retried", status: http.StatusInternalServerError, want: http.StatusOK, wantCalls: 2, wantFailures: 1},
+		{name: "502 retried", status: http.StatusBadGateway, want: http.StatusOK, wantCalls: 2, wantFailures: 1},
+		{name: "503 retried", status: http.StatusServiceUnavailable, want: http.StatusOK, wantCalls: 2, wantFailures: 1},
+		{name: "504 retried", status: http.StatusGatewayTimeout, want: http.StatusOK, wantCalls: 2, wantFailures: 1},
+		{name: "400 passed through", status: http.StatusBadRequest, want: http.StatusBadRequest, wantCalls: 1},
+		{name: "404 passed through", status: http.StatusNotFound, want: http.StatusNotFound, wantCalls: 1},
+		{name: "422 passed through", status: http.StatusUnprocessableEntity, want: http.StatusUnprocessableEntity, wantCalls: 1},
+		{name: "501 passed through", status: http.StatusNotImplemented, want: http.StatusNotImplemented, wantCalls: 1},
+		{name: "custom list retries 418", env: map[string]string{"RETRY_STATUS_CODES": "418"}, status: http.StatusTeapot, want: http.StatusOK, wantCalls: 2, wantFailures: 1},
+		{name: "custom list passes 500 through", env: map[string]string{"RETRY_STATUS_CODES": "418"}, status: http.StatusInternalServerError, want: http.StatusInternalServerError, wantCalls: 1},
+		{name: "retries exhausted", env: map[string]string{"MAX_RETRIES": "0"}, status: http.StatusServiceUnavailable, want: http.StatusServiceUnavailable, wantCalls: 1, wantFailures: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			keyManager := newTestKeyManager("sk-first", "sk-second")
+			router := newTestProxy(t, tt.env, keyManager, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if r.Header.Get("Authorization") == "Bearer sk-first" {
+					w.WriteHeader(tt.status)
+					w.Write([]byte(`{"error":{"message":"upstream error"}}`))
+					return
+				}
+				w.Write([]byte(`{"choices":[]}`))
+			}))
+
+			if recorder := proxyRequest(router, chatRequest()); recorder.Code != tt.want {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.want)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("upstream called %d times, want %d", calls, tt.wantCalls)
+			}
+			// Failures are recorded asynchronously
+			var failures int
+			for deadline := time.Now().Add(time.Second); ; time.Sleep(5 * time.Millisecond) {
+				keyManager.mu.Lock()
+				failures = keyManager.failures["sk-first"]
+				keyManager.mu.Unlock()
+				if failures >= tt.wantFailures || time.Now().After(deadline) {
+					break
+				}
+			}
+			if failures != tt.wantFailures {
+				t.Errorf("%d failures recorded for the first key, want %d", failures, tt.wantFailures)
+			}
+			if keyManager.isBlacklisted("sk-first") {
+				t.Error("first key blacklisted, only 401 and 403 blacklist at once")
+			}
+		})
+	}
+}
+
+func TestRetryHonoursRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+		maxDelayMs string
+		minWait    time.Duration
+		maxWait    time.Duration
+	}{
+		{name: "no header uses the backoff", maxDelayMs: "1", maxWait: 500 * time.Millisecond},
+		{name: "seconds capped to RETRY_MAX_DELAY_MS", retryAfter: "30", maxDelayMs: "150", minWait: 150 * time.Millisecond, maxWait: time.Second},
+		{name: "date capped to RETRY_MAX_DELAY_MS", retryAfter: time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), maxDelayMs: "150", minWait: 150 * time.Millisecond, maxWait: time.Second},
+		{name: "zero", retryAfter: "0", maxDelayMs: "5000", maxWait: 500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var firstAt, retryAt time.Time
+			router := newTestProxy(t, map[string]string{"RETRY_MAX_DELAY_MS": tt.maxDelayMs}, newTestKeyManager("sk-first", "sk-second"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") == "Bearer sk-first" {
+					firstAt = time.Now()
+					if tt.retryAfter != "" {
+						w.Header().Set("Retry-After", tt.retryAfter)
+					}
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				retryAt = time.Now()
+				w.Write([]byte(`{"choices":[]}`))
+			}))
+
+			if recorder := proxyRequest(router, chatRequest()); recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", recorder.Code)
+			}
+			if wait := retryAt.Sub(firstAt); wait < tt.minWait || wait > tt.maxWait {
+				t.Errorf("retried after %v, want between %v and %v", wait, tt.minWait, tt.maxWait)
+			}
+		})
+	}
+}
+
+func TestUpstreamGroupRouting(t *testing.T) {
+	tests := []struct {
+		name      string
+		weight    string
+		wantGroup string // Group that serves every request
+	}{
+		{name: "all to group A", weight: "0", wantGroup: config.UpstreamGroupA},
+		{name: "all to group B", weight: "100", wantGroup: config.UpstreamGroupB},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var groupBCalls int
+			groupB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				groupBCalls++
+				w.Write([]byte(`{"choices":[]}`))
+			}))
+			t.Cleanup(groupB.Close)
+			var groupACalls int
+			router := newTestProxy(t, map[string]string{"UPSTREAM_B_URLS": groupB.URL, "UPSTREAM_B_WEIGHT": tt.weight}, newTestKeyManager("sk-first"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				groupACalls++
+				w.Write([]byte(`{"choices":[]}`))
+			}))
+
+			const requests = 5
+			before := testutil.ToFloat64(metrics.UpstreamGroupRequests.WithLabelValues(tt.wantGroup, ""))
+			for i := 0; i < requests; i++ {
+				if recorder := proxyRequest(router, chatRequest()); recorder.Code != http.StatusOK {
+					t.Fatalf("status = %d, want 200", recorder.Code)
+				}
+			}
+
+			wantA, wantB := requests, 0
+			if tt.wantGroup == config.UpstreamGroupB {
+				wantA, wantB = 0, requests
+			}
+			if groupACalls != wantA || groupBCalls != wantB {
+				t.Errorf("group A served %d and group B %d, want %d and %d", groupACalls, groupBCalls, wantA, wantB)
+			}
+			if n := testutil.ToFloat64(metrics.UpstreamGroupRequests.WithLabelValues(tt.wantGroup, "")) - before; n != requests {
+				t.Errorf("group %s counted %.0f requests, want %d", tt.wantGroup, n, requests)
+			}
+		})
+	}
+}
+
+func TestRetryAfterForwarded(t *testing.T) {
+	inTwoMinutes := time.Now().Add(2 * time.Minute).UTC().Format(http.TimeFormat)
+	tests := []struct {
+		name       string
+		responses  []string // Retry-After sent by each key in turn, "500" answers HTTP 500 instead
+		wantStatus int
+		wantMin    int // Forwarded Retry-After, 0 when none
+		wantMax    int
+	}{
+		{name: "longest seconds", responses: []string{"5", "30", "10"}, wantStatus: http.StatusTooManyRequests, wantMin: 30, wantMax: 30},
+		{name: "date beats seconds", responses: []string{"30", inTwoMinutes, "10"}, wantStatus: http.StatusTooManyRequests, wantMin: 119, wantMax: 121},
+		{name: "some keys send none", responses: []string{"", "7", ""}, wantStatus: http.StatusTooManyRequests, wantMin: 7, wantMax: 7},
+		{name: "invalid and past values ignored", responses: []string{"soon", "Wed, 21 Oct 2015 07:28:00 GMT", "3"}, wantStatus: http.StatusTooManyRequests, wantMin: 3, wantMax: 3},
+		{name: "none sent", responses: []string{"", "", ""}, wantStatus: http.StatusTooManyRequests},
+		{name: "last attempt not a 429", responses: []string{"30", "30", "500"}, wantStatus: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := []string{"sk-key-0", "sk-key-1", "sk-key-2"}
+			router := newTestProxy(t, map[string]string{"MAX_RETRIES": "2"}, newTestKeyManager(keys...), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				response := tt.responses[slices.Index(keys, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))]
+				if response == "500" {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				if response != "" {
+					w.Header().Set("Retry-After", response)
+				}
+				w.WriteHeader(http.StatusTooManyRequests)
+			}))
+
+			recorder := proxyRequest(router, chatRequest())
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			header := recorder.Header().Get("Retry-After")
+			if tt.wantMax == 0 {
+				if header != "" {
+					t.Errorf("Retry-After = %q, want none", header)
+				}
+				return
+			}
+			if got, err := strconv.Atoi(header); err != nil || got < tt.wantMin || got > tt.wantMax {
+				t.Errorf("Retry-After = %q, want between %d and %d", header, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestUpstreamUserAgent(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		clientUA string
+		want     string
+	}{
+		{name: "override replaces the client's", env: map[string]string{"UPSTREAM_USER_AGENT": "acme-proxy/2.0"}, clientUA: "openai-python/1.40.0", want: "acme-proxy/2.0"},
+		{name: "override without a client User-Agent", env: map[string]string{"UPSTREAM_USER_AGENT": "acme-proxy/2.0"}, want: "acme-proxy/2.0"},
+		{name: "client passes through", clientUA: "openai-python/1.40.0", want: "openai-python/1.40.0"},
+		{name: "default carries the version", want: "gpt-load/" + version.Version},
+		{name: "configured default", env: map[string]string{"UPSTREAM_DEFAULT_USER_AGENT": "acme/1"}, want: "acme/1"},
+		{name: "configured default keeps the client's", env: map[string]string{"UPSTREAM_DEFAULT_USER_AGENT": "acme/1"}, clientUA: "curl/8.5", want: "curl/8.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen := make(chan string, 2)
+			capture := func(w http.ResponseWriter, r *http.Request) {
+				seen <- r.Header.Get("User-Agent")
+				w.Write([]byte(`{"choices":[]}`))
+			}
+			// The mirror gets the same User-Agent as the upstream
+			mirror := httptest.NewServer(http.HandlerFunc(capture))
+			t.Cleanup(mirror.Close)
+			env := map[string]string{"MIRROR_URL": mirror.URL, "MIRROR_SAMPLE_RATE": "1"}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			router := newTestProxy(t, env, newTestKeyManager("sk-agent"), http.HandlerFunc(capture))
+
+			req := chatRequest()
+			if tt.clientUA != "" {
+				req.Header.Set("User-Agent", tt.clientUA)
+			}
+			if recorder := proxyRequest(router, req); recorder.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", recorder.Code, recorder.Body.String())
+			}
+			for i := 0; i < 2; i++ {
+				select {
+				case got := <-seen:
+					if got != tt.want {
+						t.Errorf("User-Agent = %q, want %q", got, tt.want)
+					}
+				case <-time.After(2 * time.Second):
+					t.Fatalf("%d of 2 requests seen", i)
+				}
+			}
+		})
+	}
+}
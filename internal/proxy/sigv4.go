@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"gpt-load/pkg/types"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// requestSigner signs upstream requests with AWS SigV4 for Bedrock-compatible endpoints
+type requestSigner struct {
+	signer      *v4.Signer
+	credentials aws.Credentials
+	service     string
+	region      string
+	now         func() time.Time
+}
+
+// newRequestSigner creates a SigV4 signer from the upstream configuration
+func newRequestSigner(config types.OpenAIConfig) *requestSigner {
+	return &requestSigner{
+		signer: v4.NewSigner(),
+		credentials: aws.Credentials{
+			AccessKeyID:     config.AWSAccessKeyID,
+			SecretAccessKey: config.AWSSecretAccessKey,
+			SessionToken:    config.AWSSessionToken,
+		},
+		service: config.AWSSigV4Service,
+		region:  config.AWSRegion,
+		now:     time.Now,
+	}
+}
+
+// sign signs the request in place, the body must be the buffered bytes already set on req
+func (s *requestSigner) sign(ctx context.Context, req *http.Request, body []byte) error {
+	// SigV4 replaces bearer authentication
+	req.Header.Del("Authorization")
+
+	payloadHash := sha256.Sum256(body)
+	return s.signer.SignHTTP(ctx, s.credentials, req, hex.EncodeToString(payloadHash[:]), s.service, s.region, s.now())
+}
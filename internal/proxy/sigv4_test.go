@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"gpt-load/pkg/types"
+)
+
+// The vanilla cases are vectors from the AWS Signature Version 4 test suite, the
+// others were recorded from the signer, which also signs Content-Length
+func TestRequestSignerSign(t *testing.T) {
+	signedAt := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		method    string
+		url       string
+		header    http.Header
+		body      string
+		token     string
+		wantAuth  string
+		wantToken bool
+	}{
+		{
+			name:     "get-vanilla",
+			method:   http.MethodGet,
+			url:      "https://example.amazonaws.com/",
+			wantAuth: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:     "post-vanilla",
+			method:   http.MethodPost,
+			url:      "https://example.amazonaws.com/",
+			wantAuth: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+		{
+			name:     "post-x-www-form-urlencoded",
+			method:   http.MethodPost,
+			url:      "https://example.amazonaws.com/",
+			header:   http.Header{"Content-Type": {"application/x-www-form-urlencoded"}},
+			body:     "Param1=value1",
+			wantAuth: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=content-length;content-type;host;x-amz-date, Signature=fec50118d90ecf934441dd37fb9a49bd7f5adb6450802ca3a0977623bbb7c27f",
+		},
+		{
+			name:      "session token",
+			method:    http.MethodGet,
+			url:       "https://example.amazonaws.com/",
+			token:     "AQoDYXdzEPT//////////wEXAMPLE",
+			wantAuth:  "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date;x-amz-security-token, Signature=e10798a7d4e6903cdea527f4ce90552d0984c47cedb232694699be85918af680",
+			wantToken: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer := newRequestSigner(types.OpenAIConfig{
+				AWSAccessKeyID:     "AKIDEXAMPLE",
+				AWSSecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+				AWSSessionToken:    tt.token,
+				AWSSigV4Service:    "service",
+				AWSRegion:          "us-east-1",
+			})
+			signer.now = func() time.Time { return signedAt }
+
+			req, err := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("NewRequest: %v", err)
+			}
+			for key, values := range tt.header {
+				req.Header[key] = values
+			}
+			req.Header.Set("Authorization", "Bearer sk-upstream")
+			if err := signer.sign(context.Background(), req, []byte(tt.body)); err != nil {
+				t.Fatalf("sign: %v", err)
+			}
+
+			if token := req.Header.Get("X-Amz-Security-Token"); (token != "") != tt.wantToken || (tt.wantToken && token != tt.token) {
+				t.Errorf("X-Amz-Security-Token = %q, want %q", token, tt.token)
+			}
+			if auth := req.Header.Get("Authorization"); auth != tt.wantAuth {
+				t.Errorf("Authorization = %q, want %q", auth, tt.wantAuth)
+			}
+			if date := req.Header.Get("X-Amz-Date"); date != "20150830T123600Z" {
+				t.Errorf("X-Amz-Date = %q, want 20150830T123600Z", date)
+			}
+		})
+	}
+}
+
+func TestProxySignsFinalRequest(t *testing.T) {
+	env := map[string]string{
+		"UPSTREAM_AWS_SIGV4_ENABLED":  "true",
+		"AWS_ACCESS_KEY_ID":           "AKIDEXAMPLE",
+		"AWS_SECRET_ACCESS_KEY":       "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		"AWS_REGION":                  "us-east-1",
+		"AWS_SIGV4_SERVICE":           "bedrock",
+		"UPSTREAM_INJECT_BODY_FIELDS": `{"user":"proxy"}`,
+	}
+	verifier := newRequestSigner(types.OpenAIConfig{
+		AWSAccessKeyID:     env["AWS_ACCESS_KEY_ID"],
+		AWSSecretAccessKey: env["AWS_SECRET_ACCESS_KEY"],
+		AWSSigV4Service:    env["AWS_SIGV4_SERVICE"],
+		AWSRegion:          env["AWS_REGION"],
+	})
+
+	router := newTestProxy(t, env, newTestKeyManager("sk-upstream"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), `"user":"proxy"`) {
+			t.Errorf("upstream body %s is missing the injected field", body)
+		}
+
+		// Re-sign what arrived, the signature only matches if it covered the final request
+		signedAt, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+		if err != nil {
+			t.Errorf("X-Amz-Date: %v", err)
+		}
+		verifier.now = func() time.Time { return signedAt }
+		replay, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), bytes.NewReader(body))
+		_, signedHeaders, _ := strings.Cut(r.Header.Get("Authorization"), "SignedHeaders=")
+		signedHeaders, _, _ = strings.Cut(signedHeaders, ",")
+		for _, name := range strings.Split(signedHeaders, ";") {
+			if name != "host" && name != "x-amz-date" && name != "content-length" {
+				replay.Header.Set(name, r.Header.Get(name))
+			}
+		}
+		verifier.sign(context.Background(), replay, body)
+		if got, want := r.Header.Get("Authorization"), replay.Header.Get("Authorization"); got != want {
+			t.Errorf("Authorization = %q, want %q", got, want)
+		}
+		w.Write([]byte(`{"choices":[]}`))
+	}))
+
+	if recorder := proxyRequest(router, chatRequest()); recorder.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", recorder.Code)
+	}
+}
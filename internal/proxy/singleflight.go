@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"gpt-load/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// flightResponse is the response produced by a leading request, shared with coalesced callers
+type flightResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// captureWriter records everything written to the client so it can be replayed
+type captureWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+// Write writes to the client and records the data
+func (w *captureWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString writes to the client and records the data
+func (w *captureWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Unwrap exposes the client's writer to http.ResponseController
+func (w *captureWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// requestFingerprint identifies requests that can be answered by the same upstream call
+func requestFingerprint(c *gin.Context, bodyBytes []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(c.Request.Method))
+	hash.Write([]byte{0})
+	hash.Write([]byte(c.Request.URL.Path))
+	hash.Write([]byte{0})
+	hash.Write([]byte(c.Request.URL.RawQuery))
+	hash.Write([]byte{0})
+	hash.Write(bodyBytes)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// executeCoalesced executes a non-streaming request once for all identical concurrent callers
+func (ps *ProxyServer) executeCoalesced(c *gin.Context, startTime time.Time, bodyBytes []byte) {
+	leader := false
+	result, _, _ := ps.flightGroup.Do(requestFingerprint(c, bodyBytes), func() (any, error) {
+		leader = true
+
+		writer := &captureWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		ps.executeRequestWithRetry(c, startTime, bodyBytes, false, 0, nil)
+		c.Writer = writer.ResponseWriter
+
+		return &flightResponse{
+			status: writer.Status(),
+			header: writer.Header().Clone(),
+			body:   writer.body.Bytes(),
+		}, nil
+	})
+	if leader {
+		return
+	}
+
+	// Replay the leader's response, success or error, to this caller
+	metrics.SingleflightCoalesced.WithLabelValues(costCenter(c.Request.Context())).Inc()
+	response := result.(*flightResponse)
+	for name, values := range response.header {
+		c.Writer.Header()[name] = values
+	}
+	c.Status(response.status)
+	c.Writer.Write(response.body)
+}
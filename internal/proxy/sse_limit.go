@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	stderrors "errors"
+	"io"
+)
+
+// errSSEEventLimit is returned once a streaming response exceeds MAX_SSE_EVENTS_PER_RESPONSE
+var errSSEEventLimit = stderrors.New("SSE event limit exceeded")
+
+// sseLimitEvent is sent to the client in place of the events beyond the limit
+const sseLimitEvent = "data: {\"error\":{\"message\":\"SSE event limit exceeded\"}}\n\n"
+
+// sseEventLimiter passes through an SSE stream until limit events have been
+// read, each event being terminated by a blank line. Reads past the limit fail
+// with errSSEEventLimit, unless the stream ends right at the limit.
+type sseEventLimiter struct {
+	body      io.Reader
+	limit     int
+	events    int
+	lineStart bool // Nothing but \r read since the last \n
+	pending   bool // The current event has content
+	reached   bool
+}
+
+// newSSEEventLimiter wraps a streaming body, 0 means unlimited
+func newSSEEventLimiter(body io.Reader, limit int) io.Reader {
+	if limit <= 0 {
+		return body
+	}
+	return &sseEventLimiter{body: body, limit: limit, lineStart: true}
+}
+
+// Read reads from the stream, stopping right after the last allowed event
+func (l *sseEventLimiter) Read(p []byte) (int, error) {
+	if l.reached {
+		return l.readPastLimit(p)
+	}
+
+	n, err := l.body.Read(p)
+	for i := 0; i < n; i++ {
+		switch p[i] {
+		case '\r':
+		case '\n':
+			if l.lineStart && l.pending {
+				l.events++
+				l.pending = false
+				if l.events >= l.limit {
+					l.reached = true
+					return i + 1, nil
+				}
+			}
+			l.lineStart = true
+		default:
+			l.lineStart = false
+			l.pending = true
+		}
+	}
+	return n, err
+}
+
+// readPastLimit reports the limit as exceeded once the upstream sends anything more
+func (l *sseEventLimiter) readPastLimit(p []byte) (int, error) {
+	for {
+		n, err := l.body.Read(p)
+		if n > 0 {
+			return 0, errSSEEventLimit
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// metadataEventName is the SSE event type carrying per-request metadata
+const metadataEventName = "gptload_metadata"
+
+// streamMetadata describes the upstream attempt that served a streaming response
+type streamMetadata struct {
+	upstream  string
+	attempt   int
+	keyTier   string
+	startTime time.Time
+}
+
+// metadataEvent is the payload of the gptload_metadata SSE event
+type metadataEvent struct {
+	Upstream  string `json:"upstream"`
+	Attempt   int    `json:"attempt"`
+	TTFBMs    int64  `json:"ttfb_ms"`
+	LatencyMs int64  `json:"latency_ms"`
+	KeyTier   string `json:"key_tier"`
+}
+
+// newStreamMetadata captures attempt metadata, hashing the upstream URL when configured
+func newStreamMetadata(upstream string, hashUpstream bool, attempt int, keyTier string, startTime time.Time) *streamMetadata {
+	if hashUpstream {
+		digest := sha256.Sum256([]byte(upstream))
+		upstream = hex.EncodeToString(digest[:8])
+	}
+	return &streamMetadata{upstream: upstream, attempt: attempt, keyTier: keyTier, startTime: startTime}
+}
+
+// copyStreamWithMetadata copies an SSE stream line by line and emits a
+// gptload_metadata event once the upstream's [DONE] event is complete
+func copyStreamWithMetadata(c *gin.Context, body io.Reader, flusher http.Flusher, metadata *streamMetadata) error {
+	reader := bufio.NewReaderSize(body, 32*1024)
+	var ttfb time.Duration
+	done := false
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if ttfb == 0 {
+				ttfb = time.Since(metadata.startTime)
+			}
+			if _, writeErr := c.Writer.Write(line); writeErr != nil {
+				return writeErr
+			}
+
+			trimmed := bytes.TrimSpace(line)
+			if bytes.Equal(trimmed, []byte("data: [DONE]")) {
+				done = true
+			} else if done && len(trimmed) == 0 {
+				// The [DONE] event is terminated, append ours
+				writeMetadataEvent(c, metadata, ttfb)
+				done = false
+			}
+
+			// Flush once no more data is immediately available
+			if reader.Buffered() == 0 {
+				flusher.Flush()
+			}
+		}
+		if err != nil {
+			if done {
+				// Stream ended without the blank line closing [DONE]
+				c.Writer.Write([]byte("\n"))
+				writeMetadataEvent(c, metadata, ttfb)
+			}
+			flusher.Flush()
+			return err
+		}
+	}
+}
+
+// writeMetadataEvent writes the gptload_metadata SSE event
+func writeMetadataEvent(c *gin.Context, metadata *streamMetadata, ttfb time.Duration) {
+	payload, err := json.Marshal(metadataEvent{
+		Upstream:  metadata.upstream,
+		Attempt:   metadata.attempt,
+		TTFBMs:    ttfb.Milliseconds(),
+		LatencyMs: time.Since(metadata.startTime).Milliseconds(),
+		KeyTier:   metadata.keyTier,
+	})
+	if err != nil {
+		return
+	}
+	c.Writer.Write([]byte("event: " + metadataEventName + "\ndata: "))
+	c.Writer.Write(payload)
+	c.Writer.Write([]byte("\n\n"))
+}
@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gpt-load/internal/middleware"
+	"gpt-load/pkg/types"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestStartTimeoutWarning(t *testing.T) {
+	tests := []struct {
+		name     string
+		percent  float64
+		stream   bool
+		delay    time.Duration
+		wantWarn bool
+	}{
+		{name: "slow upstream", percent: 2, delay: 200 * time.Millisecond, wantWarn: true},
+		{name: "fast upstream", percent: 50},
+		{name: "disabled", delay: 200 * time.Millisecond},
+		{name: "streaming skipped", percent: 2, stream: true, delay: 200 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(tt.delay)
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer upstream.Close()
+
+			logger, hook := test.NewNullLogger()
+			c, _ := newTestContext()
+			c.Set("model", "gpt-4o")
+			middleware.SetLogger(c, logrus.NewEntry(logger))
+			openaiConfig := types.OpenAIConfig{BaseURL: upstream.URL, RequestTimeout: 1, TimeoutWarningPercent: tt.percent}
+
+			stop := (&ProxyServer{}).startTimeoutWarning(c, openaiConfig, tt.stream)
+			resp, err := upstream.Client().Get(upstream.URL)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			resp.Body.Close()
+			stop()
+			// A stopped timer must not fire later
+			time.Sleep(50 * time.Millisecond)
+
+			entries := hook.AllEntries()
+			if !tt.wantWarn {
+				if len(entries) != 0 {
+					t.Errorf("unexpected warning %q", entries[0].Message)
+				}
+				return
+			}
+			if len(entries) != 1 || entries[0].Level != logrus.WarnLevel {
+				t.Fatalf("got %d log entries, want one warning", len(entries))
+			}
+			for _, field := range []string{"upstream", "model", "elapsed", "request_id"} {
+				if _, exists := entries[0].Data[field]; !exists {
+					t.Errorf("warning is missing %s", field)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package proxy
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// serverTimingMetric is a single Server-Timing entry (RFC 7809 / W3C Server Timing).
+// Names are fixed identifiers, so no caller-controlled data reaches the header.
+type serverTimingMetric struct {
+	name     string
+	duration time.Duration
+}
+
+// formatServerTiming builds a Server-Timing header value
+func formatServerTiming(metrics ...serverTimingMetric) string {
+	entries := make([]string, 0, len(metrics))
+	for _, metric := range metrics {
+		ms := float64(metric.duration.Microseconds()) / 1000
+		entries = append(entries, metric.name+";dur="+strconv.FormatFloat(ms, 'f', 1, 64))
+	}
+	return strings.Join(entries, ",")
+}
@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+
+	"gpt-load/internal/tracing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestProxyTracesUpstreamAttempts(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		provider.Shutdown(context.Background())
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	var forwarded []trace.SpanContext
+	router := newTestProxy(t, nil, newTestKeyManager("sk-first-0001", "sk-second-0002"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = append(forwarded, trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), propagation.HeaderCarrier(r.Header))))
+		// The first key fails, so the request is retried with the second
+		if r.Header.Get("Authorization") == "Bearer sk-first-0001" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"choices":[]}`))
+	}))
+	router.Use(tracing.Middleware())
+
+	req := chatRequest()
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if recorder := proxyRequest(router, req); recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", recorder.Code)
+	}
+
+	// Spans are exported as they end, and the first attempt ends after the retry
+	spans := exporter.GetSpans()
+	slices.SortFunc(spans, func(a, b tracetest.SpanStub) int { return a.StartTime.Compare(b.StartTime) })
+	tests := []struct {
+		keyID  string
+		status int64
+		failed bool
+	}{
+		{keyID: "0001", status: http.StatusBadGateway, failed: true},
+		{keyID: "0002", status: http.StatusOK},
+	}
+	if len(spans) != len(tests) || len(forwarded) != len(tests) {
+		t.Fatalf("%d spans for %d upstream attempts, want %d", len(spans), len(forwarded), len(tests))
+	}
+	for i, tt := range tests {
+		span := spans[i]
+		attributes := make(map[attribute.Key]attribute.Value)
+		for _, kv := range span.Attributes {
+			attributes[kv.Key] = kv.Value
+		}
+		if span.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || span.Parent.SpanID().String() != "00f067aa0ba902b7" {
+			t.Errorf("attempt %d: trace %s parent %s, want children of the caller's span", i, span.SpanContext.TraceID(), span.Parent.SpanID())
+		}
+		if forwarded[i].SpanID() != span.SpanContext.SpanID() {
+			t.Errorf("attempt %d: upstream saw parent %s, want span %s", i, forwarded[i].SpanID(), span.SpanContext.SpanID())
+		}
+		if got := attributes["gptload.key.id"].AsString(); got != tt.keyID {
+			t.Errorf("attempt %d: key id %q, want %q", i, got, tt.keyID)
+		}
+		if got := attributes["gptload.model"].AsString(); got != "gpt-4o" {
+			t.Errorf("attempt %d: model %q, want gpt-4o", i, got)
+		}
+		if attributes["gptload.upstream.url"].AsString() == "" {
+			t.Errorf("attempt %d: no upstream url", i)
+		}
+		if got := attributes["http.response.status_code"].AsInt64(); got != tt.status {
+			t.Errorf("attempt %d: status code %d, want %d", i, got, tt.status)
+		}
+		if failed := span.Status.Code == codes.Error; failed != tt.failed {
+			t.Errorf("attempt %d: span failed %v, want %v", i, failed, tt.failed)
+		}
+	}
+}
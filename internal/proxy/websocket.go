@@ -0,0 +1,177 @@
+package proxy
+
+import (
+	"context"
+	stderrors "errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gpt-load/internal/apierror"
+	"gpt-load/internal/errors"
+	"gpt-load/internal/middleware"
+	"gpt-load/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+// isWebSocketUpgrade reports whether the client asks to switch to the WebSocket protocol
+func isWebSocketUpgrade(req *http.Request) bool {
+	return strings.EqualFold(req.Header.Get("Upgrade"), "websocket")
+}
+
+// wsMessage is one WebSocket message, its payload type tells text from binary
+type wsMessage struct {
+	data        []byte
+	payloadType byte
+}
+
+// wsFrames relays messages unchanged, keeping their payload type
+var wsFrames = websocket.Codec{
+	Marshal: func(v any) ([]byte, byte, error) {
+		msg := v.(*wsMessage)
+		return msg.data, msg.payloadType, nil
+	},
+	Unmarshal: func(data []byte, payloadType byte, v any) error {
+		msg := v.(*wsMessage)
+		msg.data = data
+		msg.payloadType = payloadType
+		return nil
+	},
+}
+
+// handleWebSocket tunnels a WebSocket connection to the same path on the upstream,
+// with a key from the pool injected as for HTTP requests. The upstream is dialled
+// before the client is upgraded, so connection failures still get an HTTP error.
+func (ps *ProxyServer) handleWebSocket(c *gin.Context) {
+	log := middleware.GetLogger(c)
+
+	keyInfo, err := ps.keyManager.GetNextKey()
+	if err != nil {
+		var retryAfterErr *errors.RetryAfterError
+		if stderrors.As(err, &retryAfterErr) {
+			respondKeysRateLimited(c, retryAfterErr.RetryAfter)
+			return
+		}
+		log.Errorf("Failed to get key: %v", err)
+		middleware.RespondError(c, apierror.NewUpstreamError(http.StatusServiceUnavailable, errors.ErrNoKeysAvailable, "No API keys available"))
+		return
+	}
+	// The key is held for the whole session
+	defer keyInfo.Release()
+	c.Set("keyIndex", keyInfo.Index)
+	c.Set("keyPreview", keyInfo.Preview)
+
+	openaiConfig := ps.configManager.GetOpenAIConfig()
+	c.Set("upstream", openaiConfig.BaseURL)
+	upstreamConfig, err := upstreamWebSocketConfig(c.Request, openaiConfig, keyInfo.Key)
+	if err != nil {
+		log.Errorf("Failed to parse upstream URL: %v", err)
+		middleware.RespondError(c, apierror.NewServerError(errors.ErrConfigInvalid, "Invalid upstream URL configured"))
+		return
+	}
+	ps.setForwardedHeaders(upstreamConfig.Header, c.Request)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(openaiConfig.RequestTimeout)*time.Second)
+	upstream, err := upstreamConfig.DialContext(ctx)
+	cancel()
+	if err != nil {
+		log.Warnf("WebSocket connection to upstream failed: %v", err)
+		go ps.keyManager.RecordFailure(keyInfo.Key, err)
+		middleware.RespondError(c, apierror.NewUpstreamError(http.StatusBadGateway, errors.ErrProxyRequest, "Upstream WebSocket connection failed"))
+		return
+	}
+	defer upstream.Close()
+	go ps.keyManager.RecordSuccess(keyInfo.Key)
+
+	server := websocket.Server{
+		// Auth already ran, and the client gets the subprotocol the upstream chose
+		Handshake: func(config *websocket.Config, _ *http.Request) error {
+			config.Protocol = upstream.Config().Protocol
+			return nil
+		},
+		Handler: func(client *websocket.Conn) {
+			log.Debugf("WebSocket tunnel to %s opened", upstreamConfig.Location.Path)
+			if err := tunnelWebSocket(client, upstream); err != nil && err != io.EOF {
+				log.Debugf("WebSocket tunnel closed: %v", err)
+			}
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// upstreamWebSocketConfig builds the upstream handshake for a client request: the
+// base URL with a ws:// or wss:// scheme, the client's headers and subprotocols,
+// and the upstream key in place of the client's credentials
+func upstreamWebSocketConfig(req *http.Request, openaiConfig types.OpenAIConfig, key string) (*websocket.Config, error) {
+	location, err := url.Parse(openaiConfig.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	switch location.Scheme {
+	case "https":
+		location.Scheme = "wss"
+	case "http":
+		location.Scheme = "ws"
+	}
+	location.Path = strings.TrimSuffix(location.Path, "/") + req.URL.Path
+	location.RawQuery = req.URL.RawQuery
+
+	origin := &url.URL{Scheme: strings.Replace(location.Scheme, "ws", "http", 1), Host: location.Host}
+	if clientOrigin, err := url.Parse(req.Header.Get("Origin")); err == nil && clientOrigin.Host != "" {
+		origin = clientOrigin
+	}
+
+	config := &websocket.Config{
+		Location: location,
+		Origin:   origin,
+		Version:  websocket.ProtocolVersionHybi13,
+		Header:   make(http.Header),
+	}
+	for name, values := range req.Header {
+		// The handshake headers are the tunnel's own, and extensions are not supported
+		if name == "Host" || name == "Origin" || name == "Upgrade" || name == "Connection" || strings.HasPrefix(name, "Sec-Websocket-") {
+			continue
+		}
+		config.Header[name] = append([]string(nil), values...)
+	}
+	for _, protocol := range strings.Split(req.Header.Get("Sec-Websocket-Protocol"), ",") {
+		if protocol = strings.TrimSpace(protocol); protocol != "" {
+			config.Protocol = append(config.Protocol, protocol)
+		}
+	}
+	setUpstreamKey(config.Header, openaiConfig, key)
+	setUpstreamUserAgent(config.Header, openaiConfig)
+	return config, nil
+}
+
+// tunnelWebSocket relays messages both ways until either side closes, then
+// closes the other side too. It returns the error that ended the tunnel.
+func tunnelWebSocket(client, upstream *websocket.Conn) error {
+	done := make(chan error, 2)
+	go func() { done <- relayWebSocket(client, upstream) }()
+	go func() { done <- relayWebSocket(upstream, client) }()
+
+	err := <-done
+	// Closing sends a close frame and unblocks the other relay
+	client.Close()
+	upstream.Close()
+	<-done
+	return err
+}
+
+// relayWebSocket copies messages from src to dst until src fails or closes
+func relayWebSocket(dst, src *websocket.Conn) error {
+	for {
+		var msg wsMessage
+		if err := wsFrames.Receive(src, &msg); err != nil {
+			return err
+		}
+		if err := wsFrames.Send(dst, &msg); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// wsHandshake is what the upstream saw of the tunnel's handshake
+type wsHandshake struct {
+	auth, path, query, protocol string
+}
+
+// newEchoUpstream starts a WebSocket upstream echoing every message with its
+// payload type, reporting each handshake on the returned channel
+func newEchoUpstream(t *testing.T) (*httptest.Server, <-chan wsHandshake) {
+	t.Helper()
+	handshakes := make(chan wsHandshake, 4)
+	upstream := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		req := ws.Request()
+		handshakes <- wsHandshake{req.Header.Get("Authorization"), req.URL.Path, req.URL.RawQuery, strings.Join(ws.Config().Protocol, ",")}
+		for {
+			var msg wsMessage
+			if err := wsFrames.Receive(ws, &msg); err != nil {
+				return
+			}
+			if err := wsFrames.Send(ws, &msg); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream, handshakes
+}
+
+// dialProxy opens a WebSocket through the proxy, sending the client's own credentials
+func dialProxy(t *testing.T, proxy *httptest.Server, path string) (*websocket.Conn, error) {
+	t.Helper()
+	config, err := websocket.NewConfig("ws"+strings.TrimPrefix(proxy.URL, "http")+path, "http://localhost")
+	if err != nil {
+		t.Fatalf("websocket.NewConfig: %v", err)
+	}
+	config.Header.Set("Authorization", "Bearer client-token")
+	config.Protocol = []string{"realtime"}
+	return websocket.DialConfig(config)
+}
+
+// waitForRelease waits until the tunnel gave its key back
+func waitForRelease(t *testing.T, km *limitedKeyManager) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); km.held() != 0; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d keys still held after the tunnel closed", km.held())
+		}
+	}
+}
+
+func TestWebSocketTunnel(t *testing.T) {
+	upstream, handshakes := newEchoUpstream(t)
+	km := &limitedKeyManager{testKeyManager: newTestKeyManager("sk-ws-0001"), limit: 1, inFlight: map[string]int{}}
+	proxy := httptest.NewServer(newTestProxyFor(t, map[string]string{"WS_ENABLED": "true"}, km, upstream))
+	t.Cleanup(proxy.Close)
+
+	client, err := dialProxy(t, proxy, "/v1/realtime?model=gpt-4o-realtime")
+	if err != nil {
+		t.Fatalf("dial through the proxy: %v", err)
+	}
+
+	// The upstream gets the pool key in place of the client's credentials
+	select {
+	case got := <-handshakes:
+		want := wsHandshake{"Bearer sk-ws-0001", "/v1/realtime", "model=gpt-4o-realtime", "realtime"}
+		if got != want {
+			t.Errorf("upstream handshake = %+v, want %+v", got, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("upstream never saw the handshake")
+	}
+
+	tests := []struct {
+		name string
+		msg  wsMessage
+	}{
+		{name: "text", msg: wsMessage{data: []byte(`{"type":"session.update"}`), payloadType: websocket.TextFrame}},
+		{name: "binary", msg: wsMessage{data: []byte{0, 1, 2, 0xff}, payloadType: websocket.BinaryFrame}},
+		{name: "large text", msg: wsMessage{data: bytes.Repeat([]byte("a"), 256<<10), payloadType: websocket.TextFrame}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := tt.msg
+			if err := wsFrames.Send(client, &msg); err != nil {
+				t.Fatalf("send: %v", err)
+			}
+			client.SetReadDeadline(time.Now().Add(2 * time.Second))
+			var echoed wsMessage
+			if err := wsFrames.Receive(client, &echoed); err != nil {
+				t.Fatalf("receive: %v", err)
+			}
+			if !bytes.Equal(echoed.data, tt.msg.data) || echoed.payloadType != tt.msg.payloadType {
+				t.Errorf("echoed %d bytes of type %d, want %d bytes of type %d", len(echoed.data), echoed.payloadType, len(tt.msg.data), tt.msg.payloadType)
+			}
+		})
+	}
+
+	// The key is held for the whole session
+	if n := km.held(); n != 1 {
+		t.Errorf("%d keys held during the session, want 1", n)
+	}
+	client.Close()
+	waitForRelease(t, km)
+}
+
+func TestWebSocketUpstreamDisconnect(t *testing.T) {
+	upstream := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		websocket.Message.Send(ws, "bye")
+	}))
+	t.Cleanup(upstream.Close)
+	km := &limitedKeyManager{testKeyManager: newTestKeyManager("sk-ws-0001"), limit: 1, inFlight: map[string]int{}}
+	proxy := httptest.NewServer(newTestProxyFor(t, map[string]string{"WS_ENABLED": "true"}, km, upstream))
+	t.Cleanup(proxy.Close)
+
+	client, err := dialProxy(t, proxy, "/v1/realtime")
+	if err != nil {
+		t.Fatalf("dial through the proxy: %v", err)
+	}
+	defer client.Close()
+
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg string
+	if err := websocket.Message.Receive(client, &msg); err != nil || msg != "bye" {
+		t.Fatalf("receive = %q, %v, want the upstream's last message", msg, err)
+	}
+	// The upstream hanging up closes the client side instead of leaving it open
+	if err := websocket.Message.Receive(client, &msg); err == nil || strings.Contains(err.Error(), "timeout") {
+		t.Errorf("receive after the upstream closed = %q, %v, want the connection closed", msg, err)
+	}
+	waitForRelease(t, km)
+}
+
+func TestWebSocketClientDisconnect(t *testing.T) {
+	closed := make(chan error, 1)
+	upstream := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var msg string
+		closed <- websocket.Message.Receive(ws, &msg)
+	}))
+	t.Cleanup(upstream.Close)
+	km := &limitedKeyManager{testKeyManager: newTestKeyManager("sk-ws-0001"), limit: 1, inFlight: map[string]int{}}
+	proxy := httptest.NewServer(newTestProxyFor(t, map[string]string{"WS_ENABLED": "true"}, km, upstream))
+	t.Cleanup(proxy.Close)
+
+	client, err := dialProxy(t, proxy, "/v1/realtime")
+	if err != nil {
+		t.Fatalf("dial through the proxy: %v", err)
+	}
+	client.Close()
+
+	select {
+	case err := <-closed:
+		if err == nil || strings.Contains(err.Error(), "timeout") {
+			t.Errorf("upstream receive = %v, want the tunnel closed", err)
+		}
+	case <-time.After(7 * time.Second):
+		t.Fatal("upstream connection outlived the client")
+	}
+	waitForRelease(t, km)
+}
+
+func TestWebSocketUpstreamUnreachable(t *testing.T) {
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	upstream.Close()
+	km := newTestKeyManager("sk-ws-0001")
+	proxy := httptest.NewServer(newTestProxyFor(t, map[string]string{"WS_ENABLED": "true"}, km, upstream))
+	t.Cleanup(proxy.Close)
+
+	req, _ := http.NewRequest(http.MethodGet, proxy.URL+"/v1/realtime", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("upgrade request: %v", err)
+	}
+	resp.Body.Close()
+
+	// The client is only upgraded once the upstream answered
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("status = %d, want 502", resp.StatusCode)
+	}
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(5 * time.Millisecond) {
+		km.mu.Lock()
+		failures := km.failures["sk-ws-0001"]
+		km.mu.Unlock()
+		if failures == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d failures recorded for the key, want 1", failures)
+		}
+	}
+}
+
+func TestWebSocketDisabled(t *testing.T) {
+	upstream, handshakes := newEchoUpstream(t)
+	proxy := httptest.NewServer(newTestProxyFor(t, map[string]string{"WS_ENABLED": "false"}, newTestKeyManager("sk-ws-0001"), upstream))
+	t.Cleanup(proxy.Close)
+
+	if client, err := dialProxy(t, proxy, "/v1/realtime"); err == nil {
+		client.Close()
+		t.Fatal("WebSocket tunnelled with WS_ENABLED=false")
+	}
+	select {
+	case got := <-handshakes:
+		t.Errorf("upstream accepted a WebSocket %+v", got)
+	default:
+	}
+}
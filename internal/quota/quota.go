@@ -0,0 +1,146 @@
+// Package quota tracks per-caller usage against daily or monthly quotas
+package quota
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"gpt-load/pkg/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Quota periods
+const (
+	PeriodDaily   = "daily"
+	PeriodMonthly = "monthly"
+)
+
+// usage is a caller's consumption in the current period
+type usage struct {
+	requests int64
+	tokens   int64
+}
+
+// Manager keeps per-caller usage in memory, resetting it at period boundaries
+type Manager struct {
+	period string
+	quotas map[string]types.QuotaLimit
+
+	usage   map[string]*usage
+	resetAt time.Time
+	mu      sync.Mutex
+}
+
+// NewManager creates a quota manager for the configured callers
+func NewManager(config types.QuotaConfig) *Manager {
+	return &Manager{
+		period:  config.Period,
+		quotas:  config.Quotas,
+		usage:   make(map[string]*usage),
+		resetAt: nextReset(config.Period, time.Now().UTC()),
+	}
+}
+
+// Check reports the caller's remaining quota and whether another request is allowed.
+// Callers without a configured quota are unlimited.
+func (m *Manager) Check(caller string) (types.QuotaStatus, bool) {
+	limit, limited := m.quotas[caller]
+	if !limited {
+		return types.QuotaStatus{}, true
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.resetIfDue()
+
+	used := m.usage[caller]
+	if used == nil {
+		used = &usage{}
+	}
+
+	status := types.QuotaStatus{Limited: true, ResetAt: m.resetAt}
+	allowed := true
+	if limit.Requests > 0 {
+		status.Remaining = limit.Requests - used.requests
+		allowed = status.Remaining > 0
+	} else if limit.Tokens > 0 {
+		status.Remaining = limit.Tokens - used.tokens
+	}
+	if limit.Tokens > 0 && used.tokens >= limit.Tokens {
+		allowed = false
+	}
+	if status.Remaining < 0 {
+		status.Remaining = 0
+	}
+	return status, allowed
+}
+
+// Record deducts a completed request and its token usage from the caller's quota
+func (m *Manager) Record(caller string, tokens int64) {
+	if _, limited := m.quotas[caller]; !limited {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.resetIfDue()
+
+	used := m.usage[caller]
+	if used == nil {
+		used = &usage{}
+		m.usage[caller] = used
+	}
+	used.requests++
+	used.tokens += tokens
+}
+
+// UsageHandler handles quota usage queries
+func (m *Manager) UsageHandler(c *gin.Context) {
+	m.mu.Lock()
+	m.resetIfDue()
+	callers := make(map[string]types.QuotaUsage, len(m.quotas))
+	for caller, limit := range m.quotas {
+		entry := types.QuotaUsage{Limit: limit}
+		if used := m.usage[caller]; used != nil {
+			entry.Requests = used.requests
+			entry.Tokens = used.tokens
+		}
+		callers[maskCaller(caller)] = entry
+	}
+	resetAt := m.resetAt
+	m.mu.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{
+		"period":   m.period,
+		"reset_at": resetAt.Format(time.RFC3339),
+		"callers":  callers,
+	})
+}
+
+// resetIfDue clears usage once the period has ended, must be called with mu held
+func (m *Manager) resetIfDue() {
+	now := time.Now().UTC()
+	if now.Before(m.resetAt) {
+		return
+	}
+	m.usage = make(map[string]*usage)
+	m.resetAt = nextReset(m.period, now)
+}
+
+// nextReset returns the next midnight UTC (daily) or first of the month (monthly)
+func nextReset(period string, now time.Time) time.Time {
+	if period == PeriodMonthly {
+		return time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+}
+
+// maskCaller hides most of a caller credential in admin output
+func maskCaller(caller string) string {
+	if len(caller) <= 8 {
+		return caller
+	}
+	return caller[:4] + "..." + caller[len(caller)-4:]
+}
@@ -0,0 +1,87 @@
+// Package ratelimit throttles clients with one token bucket per client
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gpt-load/pkg/types"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+// bucket is a client's token bucket and when it was last used
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// Limiter keeps a token bucket per client, evicting buckets idle longer than the TTL
+type Limiter struct {
+	limit rate.Limit
+	burst int
+	ttl   time.Duration
+
+	buckets map[string]*bucket
+	mu      sync.Mutex
+}
+
+// NewLimiter creates a limiter and registers its eviction task with the scheduler
+func NewLimiter(config types.RateLimitConfig, scheduler types.Scheduler) (*Limiter, error) {
+	l := &Limiter{
+		limit:   rate.Limit(float64(config.RequestsPerMinute) / 60),
+		burst:   config.BurstSize,
+		ttl:     time.Duration(config.EntryTTLSeconds) * time.Second,
+		buckets: make(map[string]*bucket),
+	}
+
+	// Check for idle buckets a few times per TTL
+	if err := scheduler.AddTask("rate-limit-eviction", l.ttl/4, func(context.Context) {
+		if evicted := l.evict(time.Now()); evicted > 0 {
+			logrus.Debugf("Evicted %d idle rate limit buckets", evicted)
+		}
+	}); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Allow takes a token from the client's bucket. When the bucket is empty it
+// reports how long until the next token is available.
+func (l *Limiter) Allow(client string) (time.Duration, bool) {
+	now := time.Now()
+
+	l.mu.Lock()
+	b, exists := l.buckets[client]
+	if !exists {
+		b = &bucket{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.buckets[client] = b
+	}
+	b.lastSeen = now
+	l.mu.Unlock()
+
+	reservation := b.limiter.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		// Give the token back, the request is rejected rather than delayed
+		reservation.CancelAt(now)
+		return delay, false
+	}
+	return 0, true
+}
+
+// evict drops buckets idle for longer than the TTL, returning how many were dropped
+func (l *Limiter) evict(now time.Time) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	evicted := 0
+	for client, b := range l.buckets {
+		if now.Sub(b.lastSeen) > l.ttl {
+			delete(l.buckets, client)
+			evicted++
+		}
+	}
+	return evicted
+}
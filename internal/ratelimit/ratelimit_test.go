@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gpt-load/pkg/types"
+)
+
+// taskRecorder is a scheduler that only records the tasks added to it
+type taskRecorder struct {
+	names     []string
+	intervals []time.Duration
+}
+
+func (s *taskRecorder) AddTask(name string, interval time.Duration, _ func(context.Context)) error {
+	s.names = append(s.names, name)
+	s.intervals = append(s.intervals, interval)
+	return nil
+}
+
+func (s *taskRecorder) Start(context.Context) {}
+
+func (s *taskRecorder) Stop() {}
+
+// newTestLimiter returns a limiter for perMinute requests with bursts of burst and a one minute TTL
+func newTestLimiter(t *testing.T, perMinute, burst int) *Limiter {
+	t.Helper()
+	scheduler := &taskRecorder{}
+	l, err := NewLimiter(types.RateLimitConfig{RequestsPerMinute: perMinute, BurstSize: burst, EntryTTLSeconds: 60}, scheduler)
+	if err != nil {
+		t.Fatalf("NewLimiter: %v", err)
+	}
+	if len(scheduler.names) != 1 || scheduler.intervals[0] != 15*time.Second {
+		t.Fatalf("eviction tasks %v every %v, want one every 15s", scheduler.names, scheduler.intervals)
+	}
+	return l
+}
+
+func TestLimiterAllow(t *testing.T) {
+	tests := []struct {
+		name        string
+		perMinute   int
+		burst       int
+		requests    int
+		wantAllowed int
+	}{
+		{name: "within burst", perMinute: 60, burst: 10, requests: 5, wantAllowed: 5},
+		{name: "burst exhausted", perMinute: 60, burst: 10, requests: 200, wantAllowed: 10},
+		{name: "burst of one", perMinute: 600, burst: 1, requests: 3, wantAllowed: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestLimiter(t, tt.perMinute, tt.burst)
+			refill := time.Minute / time.Duration(tt.perMinute)
+			allowed := 0
+			for i := 0; i < tt.requests; i++ {
+				retryAfter, ok := l.Allow("10.0.0.1")
+				if ok {
+					allowed++
+					continue
+				}
+				if retryAfter <= 0 || retryAfter > refill {
+					t.Errorf("retry after %v, want within one refill of %v", retryAfter, refill)
+				}
+			}
+			if allowed != tt.wantAllowed {
+				t.Errorf("allowed %d of %d requests, want %d", allowed, tt.requests, tt.wantAllowed)
+			}
+			if _, ok := l.Allow("10.0.0.2"); !ok {
+				t.Error("other client was throttled")
+			}
+		})
+	}
+}
+
+func TestLimiterEvict(t *testing.T) {
+	l := newTestLimiter(t, 60, 1)
+	l.Allow("idle")
+	l.Allow("busy")
+	now := time.Now()
+	l.buckets["idle"].lastSeen = now.Add(-61 * time.Second)
+
+	if evicted := l.evict(now); evicted != 1 {
+		t.Errorf("evicted %d buckets, want 1", evicted)
+	}
+	if _, exists := l.buckets["idle"]; exists {
+		t.Error("idle bucket kept")
+	}
+	if _, exists := l.buckets["busy"]; !exists {
+		t.Error("busy bucket evicted")
+	}
+
+	// An evicted client starts over with a full bucket
+	if _, ok := l.Allow("idle"); !ok {
+		t.Error("evicted client was throttled")
+	}
+	if _, ok := l.Allow("busy"); ok {
+		t.Error("busy client got a second burst")
+	}
+}
@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Per-key rate limiting algorithms
+const (
+	AlgorithmTokenBucket   = "token_bucket"
+	AlgorithmSlidingWindow = "sliding_window"
+)
+
+// KeyLimiter limits the requests sent with a single key
+type KeyLimiter interface {
+	// Take takes a request slot, returning false when the limit is reached
+	Take() bool
+	// Wait returns how long until Take will succeed again, 0 if it would now
+	Wait() time.Duration
+}
+
+// NewKeyLimiter creates a limiter allowing perMinute requests per minute with the
+// given algorithm. A sliding window allows the same rate over window, so a
+// 30 second window admits perMinute/2 requests in any 30 seconds.
+func NewKeyLimiter(algorithm string, perMinute int, window time.Duration) KeyLimiter {
+	if algorithm != AlgorithmSlidingWindow {
+		return NewTokenBucket(perMinute)
+	}
+	limit := max(int(int64(perMinute)*int64(window)/int64(time.Minute)), 1)
+	return NewSlidingWindow(limit, window)
+}
+
+// SlidingWindow allows at most limit takes in any span of window, unlike a
+// token bucket it never lets a full burst through on either side of a boundary.
+// The times of the last limit takes are kept in a circular buffer.
+type SlidingWindow struct {
+	window int64 // Nanoseconds
+
+	mu    sync.Mutex
+	times []int64 // UnixNano of the last takes, 0 for unused slots
+	next  int     // Slot of the oldest take, overwritten by the next one
+}
+
+// NewSlidingWindow creates a window allowing limit takes per window
+func NewSlidingWindow(limit int, window time.Duration) *SlidingWindow {
+	return &SlidingWindow{
+		window: int64(window),
+		times:  make([]int64, limit),
+	}
+}
+
+// Take takes a slot, returning false when limit takes happened within the last window
+func (w *SlidingWindow) Take() bool {
+	return w.takeAt(time.Now().UnixNano())
+}
+
+// takeAt is Take at the time now, in UnixNano
+func (w *SlidingWindow) takeAt(now int64) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if oldest := w.times[w.next]; oldest != 0 && now-oldest < w.window {
+		return false
+	}
+	w.times[w.next] = now
+	w.next = (w.next + 1) % len(w.times)
+	return true
+}
+
+// Wait returns how long until the oldest take leaves the window, 0 if Take would succeed now
+func (w *SlidingWindow) Wait() time.Duration {
+	now := time.Now().UnixNano()
+
+	w.mu.Lock()
+	oldest := w.times[w.next]
+	w.mu.Unlock()
+
+	if oldest == 0 {
+		return 0
+	}
+	return time.Duration(max(oldest+w.window-now, 0))
+}
@@ -0,0 +1,168 @@
+package ratelimit
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+func TestSlidingWindowNeverExceedsLimit(t *testing.T) {
+	// For any limit, window and spacing of attempts, no span of one window
+	// admits more than limit takes, and a take is refused only when limit
+	// takes already happened within the last window
+	property := func(limitSeed uint8, windowMs uint16, gapsMs []uint16) bool {
+		limit := int(limitSeed%20) + 1
+		window := int64(windowMs%5000+1) * int64(time.Millisecond)
+		w := NewSlidingWindow(limit, time.Duration(window))
+
+		now := int64(1)
+		var admitted []int64
+		for _, gap := range gapsMs {
+			now += int64(gap%2000) * int64(time.Millisecond) / 4
+			inWindow := 0
+			for _, at := range admitted {
+				if now-at < window {
+					inWindow++
+				}
+			}
+			if w.takeAt(now) {
+				if inWindow >= limit {
+					return false
+				}
+				admitted = append(admitted, now)
+			} else if inWindow < limit {
+				return false
+			}
+		}
+		for i := limit; i < len(admitted); i++ {
+			if admitted[i]-admitted[i-limit] < window {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(property, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSlidingWindowBoundary(t *testing.T) {
+	// A token bucket would admit a full burst on each side of the boundary
+	const second = int64(time.Second)
+	w := NewSlidingWindow(3, time.Second)
+	tests := []struct {
+		at   int64
+		want bool
+	}{
+		{at: second - 3, want: true},
+		{at: second - 2, want: true},
+		{at: second - 1, want: true},
+		{at: second, want: false},
+		{at: 2*second - 4, want: false},
+		{at: 2*second - 3, want: true},
+		{at: 2*second - 2, want: true},
+		{at: 2*second - 2, want: false},
+	}
+	for _, tt := range tests {
+		if got := w.takeAt(tt.at); got != tt.want {
+			t.Errorf("take at %dns = %v, want %v", tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestSlidingWindowWait(t *testing.T) {
+	w := NewSlidingWindow(2, time.Minute)
+	if wait := w.Wait(); wait != 0 {
+		t.Errorf("empty window waits %v, want 0", wait)
+	}
+	w.Take()
+	w.Take()
+	if w.Take() {
+		t.Fatal("took a third slot in a window of two")
+	}
+	if wait := w.Wait(); wait <= 59*time.Second || wait > time.Minute {
+		t.Errorf("full window waits %v, want just under a minute", wait)
+	}
+}
+
+func TestSlidingWindowConcurrent(t *testing.T) {
+	const limit = 50
+	w := NewSlidingWindow(limit, time.Minute)
+	var taken atomic.Int32
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				if w.Take() {
+					taken.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if n := taken.Load(); n != limit {
+		t.Errorf("took %d slots concurrently, want %d", n, limit)
+	}
+}
+
+func TestNewKeyLimiter(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm string
+		perMinute int
+		window    time.Duration
+		want      int // Takes admitted at once
+	}{
+		{name: "token bucket", algorithm: AlgorithmTokenBucket, perMinute: 10, window: 30 * time.Second, want: 10},
+		{name: "default is token bucket", perMinute: 10, window: 30 * time.Second, want: 10},
+		{name: "minute window", algorithm: AlgorithmSlidingWindow, perMinute: 10, window: time.Minute, want: 10},
+		{name: "half minute window", algorithm: AlgorithmSlidingWindow, perMinute: 10, window: 30 * time.Second, want: 5},
+		{name: "at least one", algorithm: AlgorithmSlidingWindow, perMinute: 1, window: 10 * time.Second, want: 1},
+		{name: "longer window", algorithm: AlgorithmSlidingWindow, perMinute: 10, window: 2 * time.Minute, want: 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewKeyLimiter(tt.algorithm, tt.perMinute, tt.window)
+			taken := 0
+			for i := 0; i < 100; i++ {
+				if limiter.Take() {
+					taken++
+				}
+			}
+			if taken != tt.want {
+				t.Errorf("took %d, want %d", taken, tt.want)
+			}
+		})
+	}
+}
+
+// limiterSink keeps benchmarked limiters on the heap, as they are in the key manager
+var limiterSink KeyLimiter
+
+func BenchmarkKeyLimiterMemory(b *testing.B) {
+	// The token bucket is a fixed size, the sliding window keeps one timestamp per request
+	for _, rpm := range []int{60, 600, 6000} {
+		for _, algorithm := range []string{AlgorithmTokenBucket, AlgorithmSlidingWindow} {
+			b.Run(fmt.Sprintf("%s/rpm=%d", algorithm, rpm), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					limiterSink = NewKeyLimiter(algorithm, rpm, time.Minute)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkSlidingWindowTake(b *testing.B) {
+	w := NewSlidingWindow(1<<16, time.Nanosecond) // Never full
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			w.Take()
+		}
+	})
+}
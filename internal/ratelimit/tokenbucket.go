@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// TokenBucket is a lock-free token bucket refilled lazily on Take. Instead of
+// counting tokens it tracks the time at which the bucket would be full again,
+// so a single compare-and-swap both refills and takes a token.
+type TokenBucket struct {
+	interval int64 // Nanoseconds to refill one token
+	capacity int64 // Nanoseconds to refill the whole bucket
+
+	// UnixNano at which the bucket is full again, in the past when it is full already
+	fullAt atomic.Int64
+}
+
+// NewTokenBucket creates a full bucket allowing perMinute takes per minute,
+// with bursts of up to perMinute takes
+func NewTokenBucket(perMinute int) *TokenBucket {
+	interval := int64(time.Minute) / int64(perMinute)
+	return &TokenBucket{
+		interval: interval,
+		capacity: interval * int64(perMinute),
+	}
+}
+
+// Take takes a token, returning false when the bucket is empty
+func (b *TokenBucket) Take() bool {
+	now := time.Now().UnixNano()
+	for {
+		fullAt := b.fullAt.Load()
+		next := max(fullAt, now) + b.interval
+		if next-now > b.capacity {
+			return false
+		}
+		if b.fullAt.CompareAndSwap(fullAt, next) {
+			return true
+		}
+	}
+}
+
+// Wait returns how long until Take will succeed again, 0 if it would now
+func (b *TokenBucket) Wait() time.Duration {
+	now := time.Now().UnixNano()
+	wait := max(b.fullAt.Load(), now) + b.interval - now - b.capacity
+	return time.Duration(max(wait, 0))
+}
@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	tests := []struct {
+		name      string
+		perMinute int
+		takes     int
+		wantTaken int
+	}{
+		{name: "within the burst", perMinute: 10, takes: 5, wantTaken: 5},
+		{name: "burst exhausted", perMinute: 10, takes: 50, wantTaken: 10},
+		{name: "one per minute", perMinute: 1, takes: 3, wantTaken: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewTokenBucket(tt.perMinute)
+			if wait := b.Wait(); wait != 0 {
+				t.Errorf("full bucket waits %v, want 0", wait)
+			}
+			taken := 0
+			for i := 0; i < tt.takes; i++ {
+				if b.Take() {
+					taken++
+				}
+			}
+			if taken != tt.wantTaken {
+				t.Fatalf("took %d of %d tokens, want %d", taken, tt.takes, tt.wantTaken)
+			}
+			interval := time.Minute / time.Duration(tt.perMinute)
+			if wait := b.Wait(); tt.takes > tt.wantTaken && (wait <= 0 || wait > interval) {
+				t.Errorf("empty bucket waits %v, want up to one refill of %v", wait, interval)
+			}
+		})
+	}
+}
+
+func TestTokenBucketRefill(t *testing.T) {
+	b := NewTokenBucket(6000) // One token every 10ms
+	for b.Take() {
+	}
+	wait := b.Wait()
+	if wait <= 0 || wait > 10*time.Millisecond {
+		t.Fatalf("empty bucket waits %v, want up to 10ms", wait)
+	}
+	time.Sleep(wait)
+	if !b.Take() {
+		t.Fatal("no token after waiting for the refill")
+	}
+	if b.Take() {
+		t.Error("took two tokens after one refill")
+	}
+}
+
+func TestTokenBucketConcurrent(t *testing.T) {
+	const perMinute = 100
+	b := NewTokenBucket(perMinute)
+	var taken atomic.Int32
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				if b.Take() {
+					taken.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	// Refills during the test add at most a token or two
+	if n := taken.Load(); n < perMinute || n > perMinute+2 {
+		t.Errorf("took %d tokens concurrently, want %d", n, perMinute)
+	}
+}
+
+func BenchmarkTokenBucketTake(b *testing.B) {
+	bucket := NewTokenBucket(1 << 30) // Never empty, so every Take refills and takes
+	b.Run("serial", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			bucket.Take()
+		}
+	})
+	b.Run("parallel", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				bucket.Take()
+			}
+		})
+	})
+}
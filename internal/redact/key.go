@@ -0,0 +1,35 @@
+package redact
+
+import "sync/atomic"
+
+// maskedKeyPrefix replaces everything but the last characters of a masked key
+const maskedKeyPrefix = "sk-****"
+
+// maskedKeySuffixLength is the number of trailing key characters left visible
+const maskedKeySuffixLength = 4
+
+// keyMaskingDisabled turns MaskKey into a no-op, set from LOG_MASK_KEYS
+var keyMaskingDisabled atomic.Bool
+
+// SetKeyMasking enables or disables API key masking process-wide
+func SetKeyMasking(enabled bool) {
+	keyMaskingDisabled.Store(!enabled)
+}
+
+// MaskKey returns a form of an API key that is safe to log, keeping only its
+// last 4 characters. Keys too short to hide anything are masked completely.
+func MaskKey(key string) string {
+	if keyMaskingDisabled.Load() {
+		return key
+	}
+	return MaskKeyAlways(key)
+}
+
+// MaskKeyAlways masks a key like MaskKey, even when masking is disabled. It is
+// meant for data leaving the process.
+func MaskKeyAlways(key string) string {
+	if len(key) <= 2*maskedKeySuffixLength {
+		return maskedKeyPrefix
+	}
+	return maskedKeyPrefix + key[len(key)-maskedKeySuffixLength:]
+}
@@ -0,0 +1,31 @@
+package redact
+
+import "testing"
+
+func TestMaskKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		key        string
+		masking    bool
+		want       string
+		wantAlways string
+	}{
+		{name: "openai key", key: "sk-proj-abcdef123456", masking: true, want: "sk-****3456", wantAlways: "sk-****3456"},
+		{name: "any format", key: "AIzaSyExample9876", masking: true, want: "sk-****9876", wantAlways: "sk-****9876"},
+		{name: "short key hidden completely", key: "sk-12345", masking: true, want: "sk-****", wantAlways: "sk-****"},
+		{name: "empty", key: "", masking: true, want: "sk-****", wantAlways: "sk-****"},
+		{name: "masking disabled", key: "sk-proj-abcdef123456", want: "sk-proj-abcdef123456", wantAlways: "sk-****3456"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetKeyMasking(tt.masking)
+			t.Cleanup(func() { SetKeyMasking(true) })
+			if got := MaskKey(tt.key); got != tt.want {
+				t.Errorf("MaskKey(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+			if got := MaskKeyAlways(tt.key); got != tt.wantAlways {
+				t.Errorf("MaskKeyAlways(%q) = %q, want %q", tt.key, got, tt.wantAlways)
+			}
+		})
+	}
+}
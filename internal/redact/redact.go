@@ -0,0 +1,43 @@
+// Package redact provides redaction of bodies and API keys before they are logged
+package redact
+
+import (
+	"regexp"
+)
+
+// Placeholder replaces every redacted match
+const Placeholder = "[REDACTED]"
+
+// Redactor replaces matches of a set of regular expressions in log copies of bodies.
+// Compiled regexps are safe for concurrent use, so a single Redactor is shared.
+type Redactor struct {
+	patterns []*regexp.Regexp
+}
+
+// New compiles the redaction patterns, returning an error for the first invalid one
+func New(patterns []string) (*Redactor, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, re)
+	}
+	return &Redactor{patterns: compiled}, nil
+}
+
+// Redact returns body with all pattern matches replaced, a nil Redactor returns body unchanged
+func (r *Redactor) Redact(body string) string {
+	if r == nil {
+		return body
+	}
+	for _, re := range r.patterns {
+		body = re.ReplaceAllLiteralString(body, Placeholder)
+	}
+	return body
+}
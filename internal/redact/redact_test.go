@@ -0,0 +1,61 @@
+package redact
+
+import "testing"
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		body     string
+		want     string
+	}{
+		{
+			name:     "credit card",
+			patterns: []string{`\b\d{16}\b`},
+			body:     `{"messages":[{"role":"user","content":"my card is 4111111111111111, thanks"}]}`,
+			want:     `{"messages":[{"role":"user","content":"my card is [REDACTED], thanks"}]}`,
+		},
+		{
+			name:     "longer digit runs kept",
+			patterns: []string{`\b\d{16}\b`},
+			body:     `order 41111111111111112222`,
+			want:     `order 41111111111111112222`,
+		},
+		{
+			name:     "every match",
+			patterns: []string{`\b\d{16}\b`},
+			body:     `4111111111111111 and 5500000000000004`,
+			want:     `[REDACTED] and [REDACTED]`,
+		},
+		{
+			name:     "several patterns",
+			patterns: []string{`\b\d{16}\b`, `[\w.+-]+@[\w-]+\.[\w.]+`},
+			body:     `alice@example.com paid with 4111111111111111`,
+			want:     `[REDACTED] paid with [REDACTED]`,
+		},
+		{
+			name:     "replacement taken literally",
+			patterns: []string{`(secret)`},
+			body:     `the secret`,
+			want:     `the [REDACTED]`,
+		},
+		{name: "no patterns", body: `4111111111111111`, want: `4111111111111111`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redactor, err := New(tt.patterns)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			if got := redactor.Redact(tt.body); got != tt.want {
+				t.Errorf("Redact = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRejectsInvalidPattern(t *testing.T) {
+	if _, err := New([]string{`\b\d{16}\b`, `(unclosed`}); err == nil {
+		t.Error("New accepted an invalid pattern")
+	}
+}
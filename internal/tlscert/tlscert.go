@@ -0,0 +1,160 @@
+// Package tlscert provides the server TLS configuration, reloading the
+// certificate when its files change
+package tlscert
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"gpt-load/internal/errors"
+	"gpt-load/pkg/types"
+
+	"github.com/sirupsen/logrus"
+)
+
+// reloadInterval is how often the certificate files are checked for changes
+const reloadInterval = 30 * time.Second
+
+// versions maps TLS_MIN_VERSION values to TLS versions
+var versions = map[string]uint16{
+	"TLS1.0": tls.VersionTLS10,
+	"TLS1.1": tls.VersionTLS11,
+	"TLS1.2": tls.VersionTLS12,
+	"TLS1.3": tls.VersionTLS13,
+}
+
+// ParseVersion returns the TLS version for a name such as TLS1.2
+func ParseVersion(name string) (uint16, error) {
+	version, exists := versions[name]
+	if !exists {
+		return 0, fmt.Errorf("unknown TLS version %s (use TLS1.0, TLS1.1, TLS1.2 or TLS1.3)", name)
+	}
+	return version, nil
+}
+
+// ParseCipherSuites returns the IDs of cipher suites given by their standard
+// names, accepting only suites without known security issues
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	byName := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		byName[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, exists := byName[name]
+		if !exists {
+			return nil, fmt.Errorf("unknown or insecure TLS cipher suite %s", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// NewConfig creates the server TLS configuration, its certificate reloaded by a scheduled task
+func NewConfig(serverConfig types.ServerConfig, scheduler types.Scheduler) (*tls.Config, error) {
+	minVersion, err := ParseVersion(serverConfig.TLSMinVersion)
+	if err != nil {
+		return nil, errors.NewAppErrorWithCause(errors.ErrConfigInvalid, "Invalid TLS_MIN_VERSION", err)
+	}
+	cipherSuites, err := ParseCipherSuites(serverConfig.TLSCipherSuites)
+	if err != nil {
+		return nil, errors.NewAppErrorWithCause(errors.ErrConfigInvalid, "Invalid TLS_CIPHER_SUITES", err)
+	}
+
+	reloader, err := newReloader(serverConfig.TLSCertFile, serverConfig.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := scheduler.AddTask("tls-certificate-reload", reloadInterval, reloader.reloadIfChanged); err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: reloader.getCertificate,
+	}
+	// Go only applies the list to TLS 1.2 and earlier, TLS 1.3 suites are fixed
+	if len(cipherSuites) > 0 {
+		tlsConfig.CipherSuites = cipherSuites
+	}
+	return tlsConfig, nil
+}
+
+// reloader serves the current certificate and replaces it when its files change
+type reloader struct {
+	certFile string
+	keyFile  string
+
+	certificate atomic.Pointer[tls.Certificate]
+	modTime     time.Time // Latest modification time of the loaded files, only used by the reload task
+}
+
+// newReloader loads the certificate, failing if it cannot be loaded
+func newReloader(certFile, keyFile string) (*reloader, error) {
+	r := &reloader{certFile: certFile, keyFile: keyFile}
+
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return nil, errors.NewAppErrorWithCause(errors.ErrConfigInvalid, "Failed to read TLS certificate", err)
+	}
+	if err := r.load(); err != nil {
+		return nil, errors.NewAppErrorWithCause(errors.ErrConfigInvalid, "Failed to load TLS certificate", err)
+	}
+	r.modTime = modTime
+	return r, nil
+}
+
+// getCertificate implements tls.Config.GetCertificate
+func (r *reloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.certificate.Load(), nil
+}
+
+// load reads the certificate and key pair and makes it current
+func (r *reloader) load() error {
+	certificate, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.certificate.Store(&certificate)
+	return nil
+}
+
+// latestModTime returns the later modification time of the certificate and key files
+func (r *reloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// reloadIfChanged reloads the certificate when either file changed, keeping the
+// current certificate if the new one cannot be loaded
+func (r *reloader) reloadIfChanged(ctx context.Context) {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		logrus.Errorf("Failed to check TLS certificate files: %v", err)
+		return
+	}
+	if !modTime.After(r.modTime) {
+		return
+	}
+
+	if err := r.load(); err != nil {
+		logrus.Errorf("Failed to reload TLS certificate, keeping current certificate: %v", err)
+		return
+	}
+	r.modTime = modTime
+	logrus.Info("Reloaded TLS certificate")
+}
@@ -0,0 +1,220 @@
+package tlscert
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"gpt-load/pkg/types"
+)
+
+// taskRecorder is a scheduler that only records the tasks added to it
+type taskRecorder struct {
+	names     []string
+	intervals []time.Duration
+}
+
+func (s *taskRecorder) AddTask(name string, interval time.Duration, _ func(context.Context)) error {
+	s.names = append(s.names, name)
+	s.intervals = append(s.intervals, interval)
+	return nil
+}
+
+func (s *taskRecorder) Start(context.Context) {}
+
+func (s *taskRecorder) Stop() {}
+
+// writeCertificate writes a self-signed certificate for 127.0.0.1 named commonName
+// and its key to certFile and keyFile
+func writeCertificate(t *testing.T, certFile, keyFile, commonName string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    uint16
+		wantErr bool
+	}{
+		{name: "TLS1.0", want: tls.VersionTLS10},
+		{name: "TLS1.2", want: tls.VersionTLS12},
+		{name: "TLS1.3", want: tls.VersionTLS13},
+		{name: "tls1.2", wantErr: true},
+		{name: "SSL3.0", wantErr: true},
+		{name: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseVersion(tt.name)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseVersion(%q) = %#x, %v, want %#x, error %v", tt.name, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	tests := []struct {
+		name    string
+		names   []string
+		want    []uint16
+		wantErr bool
+	}{
+		{name: "none", want: []uint16{}},
+		{
+			name:  "secure suites",
+			names: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256"},
+			want:  []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256},
+		},
+		{name: "insecure suite", names: []string{"TLS_RSA_WITH_RC4_128_SHA"}, wantErr: true},
+		{name: "unknown suite", names: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", "AES128"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCipherSuites(tt.names)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCipherSuites(%v) error = %v, want error %v", tt.names, err, tt.wantErr)
+			}
+			if !tt.wantErr && !slices.Equal(got, tt.want) {
+				t.Errorf("ParseCipherSuites(%v) = %v, want %v", tt.names, got, tt.want)
+			}
+		})
+	}
+}
+
+// servedCommonName returns the common name of the certificate a TLS server presents
+func servedCommonName(t *testing.T, tlsConfig *tls.Config) string {
+	t.Helper()
+	certificate, err := tlsConfig.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("GetCertificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestNewConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCertificate(t, certFile, keyFile, "first")
+
+	tests := []struct {
+		name    string
+		config  types.ServerConfig
+		wantErr bool
+	}{
+		{name: "defaults", config: types.ServerConfig{TLSCertFile: certFile, TLSKeyFile: keyFile, TLSMinVersion: "TLS1.2"}},
+		{name: "cipher suites", config: types.ServerConfig{TLSCertFile: certFile, TLSKeyFile: keyFile, TLSMinVersion: "TLS1.2", TLSCipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}}},
+		{name: "bad version", config: types.ServerConfig{TLSCertFile: certFile, TLSKeyFile: keyFile, TLSMinVersion: "TLS9"}, wantErr: true},
+		{name: "bad cipher suite", config: types.ServerConfig{TLSCertFile: certFile, TLSKeyFile: keyFile, TLSMinVersion: "TLS1.2", TLSCipherSuites: []string{"AES128"}}, wantErr: true},
+		{name: "missing certificate", config: types.ServerConfig{TLSCertFile: filepath.Join(dir, "missing.pem"), TLSKeyFile: keyFile, TLSMinVersion: "TLS1.2"}, wantErr: true},
+		{name: "key does not match", config: types.ServerConfig{TLSCertFile: certFile, TLSKeyFile: certFile, TLSMinVersion: "TLS1.2"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheduler := &taskRecorder{}
+			tlsConfig, err := NewConfig(tt.config, scheduler)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewConfig error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tlsConfig.MinVersion != tls.VersionTLS12 {
+				t.Errorf("min version = %#x, want TLS 1.2", tlsConfig.MinVersion)
+			}
+			if len(tlsConfig.CipherSuites) != len(tt.config.TLSCipherSuites) {
+				t.Errorf("cipher suites = %v, want %v", tlsConfig.CipherSuites, tt.config.TLSCipherSuites)
+			}
+			if name := servedCommonName(t, tlsConfig); name != "first" {
+				t.Errorf("served certificate %q, want first", name)
+			}
+			if len(scheduler.names) != 1 || scheduler.intervals[0] != reloadInterval {
+				t.Errorf("reload tasks %v every %v, want one every %v", scheduler.names, scheduler.intervals, reloadInterval)
+			}
+		})
+	}
+}
+
+func TestReloadIfChanged(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCertificate(t, certFile, keyFile, "first")
+	r, err := newReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("newReloader: %v", err)
+	}
+	tlsConfig := &tls.Config{GetCertificate: r.getCertificate}
+
+	// touch moves both files' modification time forward by step
+	modTime := time.Now()
+	touch := func(step time.Duration) {
+		modTime = modTime.Add(step)
+		for _, path := range []string{certFile, keyFile} {
+			if err := os.Chtimes(path, modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func()
+		want   string
+	}{
+		{name: "unchanged files", change: func() {}, want: "first"},
+		{name: "rewritten certificate", change: func() { writeCertificate(t, certFile, keyFile, "second"); touch(time.Minute) }, want: "second"},
+		{name: "broken pair keeps the current certificate", change: func() { os.WriteFile(keyFile, []byte("not a key"), 0o600); touch(time.Minute) }, want: "second"},
+		{name: "fixed pair loaded", change: func() { writeCertificate(t, certFile, keyFile, "third"); touch(time.Minute) }, want: "third"},
+		{name: "removed files keep the current certificate", change: func() { os.Remove(certFile) }, want: "third"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.change()
+			r.reloadIfChanged(context.Background())
+			if name := servedCommonName(t, tlsConfig); name != tt.want {
+				t.Errorf("served certificate %q, want %q", name, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+// Package tracing provides OpenTelemetry tracing for proxied requests
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"gpt-load/pkg/types"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the spans created by the proxy
+const tracerName = "gpt-load/proxy"
+
+// Init installs a global tracer provider exporting spans over OTLP/HTTP and
+// the W3C trace context propagator. The returned function flushes and stops
+// the exporter.
+func Init(config types.PerformanceConfig) (func(context.Context) error, error) {
+	exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(config.OTELEndpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", config.OTELServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return provider.Shutdown, nil
+}
+
+// Middleware extracts the caller's traceparent header into the request
+// context, so upstream spans join the caller's trace
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// StartUpstreamSpan starts a client span for one upstream attempt. Only the
+// last 4 characters of the key are recorded.
+func StartUpstreamSpan(ctx context.Context, upstream, key, model string) (context.Context, trace.Span) {
+	keySuffix := key
+	if len(key) > 4 {
+		keySuffix = key[len(key)-4:]
+	}
+
+	return otel.Tracer(tracerName).Start(ctx, "upstream request",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("gptload.upstream.url", upstream),
+			attribute.String("gptload.key.id", keySuffix),
+			attribute.String("gptload.model", model),
+		),
+	)
+}
+
+// Inject writes the span context of ctx into outgoing request headers
+func Inject(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// RecordStatus records the upstream response status on a span, marking 5xx as errors
+func RecordStatus(span trace.Span, statusCode int) {
+	span.SetAttributes(attribute.Int("http.response.status_code", statusCode))
+	if statusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(statusCode))
+	}
+}
+
+// RecordError marks a span as failed by an error without a response
+func RecordError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,127 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// callerTraceparent is the traceparent header of an incoming request
+const callerTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// newMemoryExporter installs a tracer provider recording spans in memory, like Init with a synchronous exporter
+func newMemoryExporter(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		provider.Shutdown(context.Background())
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+	return exporter
+}
+
+// spanAttributes returns the attributes of a recorded span by key
+func spanAttributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attributes := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes {
+		attributes[kv.Key] = kv.Value
+	}
+	return attributes
+}
+
+func TestUpstreamSpan(t *testing.T) {
+	tests := []struct {
+		name        string
+		traceparent string
+		key         string
+		record      func(trace.Span)
+		wantKeyID   string
+		wantStatus  int64
+		wantCode    codes.Code
+	}{
+		{name: "success", traceparent: callerTraceparent, key: "sk-abcdef1234", record: func(s trace.Span) { RecordStatus(s, 200) }, wantKeyID: "1234", wantStatus: 200, wantCode: codes.Unset},
+		{name: "client error", traceparent: callerTraceparent, key: "sk-abcdef1234", record: func(s trace.Span) { RecordStatus(s, 429) }, wantKeyID: "1234", wantStatus: 429, wantCode: codes.Unset},
+		{name: "server error", traceparent: callerTraceparent, key: "sk-abcdef1234", record: func(s trace.Span) { RecordStatus(s, 502) }, wantKeyID: "1234", wantStatus: 502, wantCode: codes.Error},
+		{name: "transport error", traceparent: callerTraceparent, key: "sk-abcdef1234", record: func(s trace.Span) { RecordError(s, errors.New("connection refused")) }, wantKeyID: "1234", wantCode: codes.Error},
+		{name: "short key", traceparent: callerTraceparent, key: "abc", record: func(s trace.Span) { RecordStatus(s, 200) }, wantKeyID: "abc", wantStatus: 200},
+		{name: "new trace without traceparent", key: "sk-abcdef1234", record: func(s trace.Span) { RecordStatus(s, 200) }, wantKeyID: "1234", wantStatus: 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := newMemoryExporter(t)
+			var forwarded http.Header
+
+			router := gin.New()
+			router.Use(Middleware())
+			router.POST("/v1/chat/completions", func(c *gin.Context) {
+				ctx, span := StartUpstreamSpan(c.Request.Context(), "https://api.example", tt.key, "gpt-4o")
+				forwarded = http.Header{}
+				Inject(ctx, forwarded)
+				tt.record(span)
+				span.End()
+				c.Status(http.StatusOK)
+			})
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+			if tt.traceparent != "" {
+				req.Header.Set("traceparent", tt.traceparent)
+			}
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			spans := exporter.GetSpans()
+			if len(spans) != 1 {
+				t.Fatalf("recorded %d spans, want 1", len(spans))
+			}
+			span := spans[0]
+			if span.SpanKind != trace.SpanKindClient {
+				t.Errorf("span kind = %v, want client", span.SpanKind)
+			}
+
+			// The span joins the caller's trace and is what the upstream sees as parent
+			caller := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), propagation.HeaderCarrier(req.Header)))
+			if caller.IsValid() {
+				if span.SpanContext.TraceID() != caller.TraceID() || span.Parent.SpanID() != caller.SpanID() {
+					t.Errorf("span trace %s parent %s, want trace %s parent %s", span.SpanContext.TraceID(), span.Parent.SpanID(), caller.TraceID(), caller.SpanID())
+				}
+			} else if span.Parent.IsValid() {
+				t.Errorf("span has parent %s without a traceparent", span.Parent.SpanID())
+			}
+			upstream := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), propagation.HeaderCarrier(forwarded)))
+			if upstream.TraceID() != span.SpanContext.TraceID() || upstream.SpanID() != span.SpanContext.SpanID() {
+				t.Errorf("forwarded traceparent %q, want the upstream span", forwarded.Get("traceparent"))
+			}
+
+			attributes := spanAttributes(span)
+			if got := attributes["gptload.upstream.url"].AsString(); got != "https://api.example" {
+				t.Errorf("upstream url = %q", got)
+			}
+			if got := attributes["gptload.key.id"].AsString(); got != tt.wantKeyID {
+				t.Errorf("key id = %q, want %q", got, tt.wantKeyID)
+			}
+			if got := attributes["gptload.model"].AsString(); got != "gpt-4o" {
+				t.Errorf("model = %q, want gpt-4o", got)
+			}
+			if got := attributes["http.response.status_code"].AsInt64(); got != tt.wantStatus {
+				t.Errorf("status code = %d, want %d", got, tt.wantStatus)
+			}
+			if span.Status.Code != tt.wantCode {
+				t.Errorf("span status = %v, want %v", span.Status.Code, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,5 @@
+// Package version holds build information injected at link time
+package version
+
+// Version is the application version, set with -ldflags "-X gpt-load/internal/version.Version=..."
+var Version = "dev"
@@ -2,6 +2,8 @@
 package types
 
 import (
+	"context"
+	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -12,26 +14,71 @@ type ConfigManager interface {
 	GetServerConfig() ServerConfig
 	GetKeysConfig() KeysConfig
 	GetOpenAIConfig() OpenAIConfig
+	GetOpenAIConfigForModel(model string) OpenAIConfig
+	GetUpstreamForCaller(callerID, model string) string
+	SetUpstreamOrder(baseURLs []string)
+	RecordUpstreamResult(baseURL string, failed bool)
+	RecordUpstreamLatency(baseURL string, latency time.Duration)
+	AcquireUpstream(baseURL string) func()
+	GetCircuitStates() []CircuitStatus
+	GetUpstreamHealth() []UpstreamHealth
+	GetModelTags(model string) map[string]string
 	GetAuthConfig() AuthConfig
+	GetAdminConfig() AdminConfig
+	GetMetricsConfig() MetricsConfig
 	GetCORSConfig() CORSConfig
 	GetPerformanceConfig() PerformanceConfig
 	GetLogConfig() LogConfig
+	GetQuotaConfig() QuotaConfig
+	GetRateLimitConfig() RateLimitConfig
+	GetRoutingConfig() RoutingConfig
+	GetScheduler() Scheduler
+	GetSanitizedConfig() any // Running configuration with secrets masked, for export
+	GenerateRequestID() string
 	Validate() error
+	Reload() error
 	DisplayConfig()
 }
 
+// Scheduler defines the interface for periodic background task execution
+type Scheduler interface {
+	AddTask(name string, interval time.Duration, fn func(ctx context.Context)) error
+	Start(ctx context.Context)
+	Stop()
+}
+
+// KeyProber sends a lightweight request authenticated with key to the upstream,
+// the same way proxied requests are sent. The caller closes the response body.
+type KeyProber func(ctx context.Context, key string) (*http.Response, error)
+
 // KeyManager defines the interface for API key management
 type KeyManager interface {
 	LoadKeys() error
+	ReloadKeys(path string) error
+	ProbeKeys(prober KeyProber)
+	EnableRecoveryProbe(prober KeyProber)
 	GetNextKey() (*KeyInfo, error)
 	RecordSuccess(key string)
 	RecordFailure(key string, err error)
+	RecordLatency(key string, latency time.Duration)
+	BlacklistKey(key string)
+	CooldownKey(keyIndex int)
 	GetStats() Stats
+	GetCapacity() KeyCapacity
 	ResetBlacklist()
 	GetBlacklist() []BlacklistEntry
 	Close()
 }
 
+// AdminManager defines runtime key management operations for the admin API
+type AdminManager interface {
+	ListKeys() []KeyStatus
+	FindKeys(prefix string) []KeyStatus
+	ForceBlacklist(id string) bool
+	RecoverKey(id string) bool
+	KeyUsage() []KeyUsage
+}
+
 // ProxyServer defines the interface for proxy server
 type ProxyServer interface {
 	HandleProxy(c *gin.Context)
@@ -46,29 +93,322 @@ type ServerConfig struct {
 	WriteTimeout            int    `json:"writeTimeout"`
 	IdleTimeout             int    `json:"idleTimeout"`
 	GracefulShutdownTimeout int    `json:"gracefulShutdownTimeout"`
+	ErrorTemplatesFile      string `json:"errorTemplatesFile"`
+	HealthResponseTemplate  string `json:"healthResponseTemplate"`
+	SelfTestOnStartup       bool   `json:"selfTestOnStartup"`
+	SelfTestTimeoutSeconds  int    `json:"selfTestTimeoutSeconds"`
+	SelfTestFailFast        bool   `json:"selfTestFailFast"`
+	RequestIDFormat         string `json:"requestIdFormat"`
+	SnowflakeMachineID      int    `json:"snowflakeMachineId"` // -1 derives the ID from the hostname
+	// SSE comment sent after this many seconds without upstream data, 0 disables it
+	SSEHeartbeatIntervalSeconds int `json:"sseHeartbeatIntervalSeconds"`
+	// HTTPS, enabled when both the certificate and key files are set
+	TLSEnabled      bool     `json:"tlsEnabled"`
+	TLSCertFile     string   `json:"tlsCertFile"`
+	TLSKeyFile      string   `json:"tlsKeyFile"`
+	TLSMinVersion   string   `json:"tlsMinVersion"`
+	TLSCipherSuites []string `json:"tlsCipherSuites"` // Go's default suites when empty
+	// X-Forwarded-For and X-Real-IP towards the upstream, extended rather than
+	// replaced when the connection comes from a trusted proxy
+	ForwardClientIP   bool     `json:"forwardClientIp"`
+	TrustedProxyCIDRs []string `json:"trustedProxyCidrs"`
+	// Liveness and readiness probe routes
+	HealthPath string `json:"healthPath"`
+	ReadyPath  string `json:"readyPath"`
 }
 
 // KeysConfig represents keys configuration
 type KeysConfig struct {
-	APIKeys            []string `json:"apiKeys"`
-	StartIndex         int      `json:"startIndex"`
-	BlacklistThreshold int      `json:"blacklistThreshold"`
-	MaxRetries         int      `json:"maxRetries"`
+	APIKeys     []string `json:"apiKeys"`
+	KeyFilePath string   `json:"keyFilePath"` // One key per line, replaces APIKeys when set
+	StartIndex  int      `json:"startIndex"`
+	MaxKeyCount int      `json:"maxKeyCount"`
+	// Requests in flight per key, saturated keys are skipped, 0 means unlimited
+	KeyMaxConcurrent int `json:"keyMaxConcurrent"`
+	// Requests per minute per key, keys out of tokens are skipped, 0 means unlimited
+	KeyRateLimitRPM int `json:"keyRateLimitRpm"`
+	// token_bucket allows bursts of KeyRateLimitRPM, sliding_window never exceeds it in any window
+	KeyRateLimitAlgorithm     string `json:"keyRateLimitAlgorithm"`
+	KeyRateLimitWindowSeconds int    `json:"keyRateLimitWindowSeconds"`
+	// Endpoint returning a JSON array of keys, replaces KeyFilePath and APIKeys when set
+	KeyFetchURL             string `json:"-"`
+	KeyFetchIntervalSeconds int    `json:"keyFetchIntervalSeconds"`
+	KeyFetchAuthHeader      string `json:"-"` // "Name: value" header sent with each fetch
+	// Secrets Manager secret holding the keys, API_KEYS is the fallback when it cannot be read
+	KeyAWSSecretARN string `json:"keyAwsSecretArn"`
+	KeyAWSRegion    string `json:"keyAwsRegion"` // Region from the AWS environment when empty
+	// Emergency key used only when all regular keys are blacklisted
+	HotStandbyKey                string `json:"-"`
+	HotStandbyBlacklistThreshold int    `json:"hotStandbyBlacklistThreshold"`
+	BlacklistThreshold           int    `json:"blacklistThreshold"`
+	Cooldown429Ms                int    `json:"cooldown429Ms"` // Skip a key after a 429, 0 disables
+	MaxRetries                   int    `json:"maxRetries"`
+	RetryBaseDelayMs             int    `json:"retryBaseDelayMs"` // 0 retries immediately
+	RetryMaxDelayMs              int    `json:"retryMaxDelayMs"`
+	RetryStatusCodes             []int  `json:"retryStatusCodes"` // Other upstream errors are passed through
+	RetryOn401                   bool   `json:"retryOn401"`
+	RetryOn403                   bool   `json:"retryOn403"`
+	KeyProbeOnStartup            bool   `json:"keyProbeOnStartup"`
+	KeyProbeConcurrency          int    `json:"keyProbeConcurrency"`
+	KeyProbeTimeoutMs            int    `json:"keyProbeTimeoutMs"`
+	StartupWaitSeconds           int    `json:"startupWaitSeconds"`
+	// Re-admit blacklisted keys after this long, 0 keeps them until reset
+	BlacklistRecoverySeconds int  `json:"blacklistRecoverySeconds"`
+	BlacklistProbeEnabled    bool `json:"blacklistProbeEnabled"` // Probe the key before re-admitting it
+	// Report key pool capacity in response headers, to admin callers unless public
+	EmitCapacityHeaders       bool `json:"emitCapacityHeaders"`
+	EmitCapacityHeadersPublic bool `json:"emitCapacityHeadersPublic"`
+	// Fraction of the base delay added as random jitter, 0.0-1.0
+	RetryJitterFactor float64 `json:"retryJitterFactor"`
+	// Redis store for sharing key pool state between instances
+	CoordinationStoreURL     string `json:"-"`
+	CoordinationSyncInterval int    `json:"coordinationSyncInterval"`
+	// Receives a signed POST whenever a key is blacklisted
+	BlacklistWebhookURL    string `json:"-"`
+	BlacklistWebhookSecret string `json:"-"`
+	// Redis store persisting failure counts and blacklist across restarts
+	StateStoreURL string `json:"-"`
+	// Known model-specific errors that should not count against a key
+	ErrorSuppression []KeyErrorSuppression `json:"errorSuppression"`
+	// Per-key usage statistics start over after this many hours, 0 never resets them
+	StatsResetIntervalHours int `json:"statsResetIntervalHours"`
+}
+
+// KeyErrorSuppression describes errors a key is known to return for specific models
+type KeyErrorSuppression struct {
+	KeySuffix     string   `json:"key_suffix"`
+	SuppressCodes []int    `json:"suppress_codes"`
+	ForModels     []string `json:"for_models"`
 }
 
 // OpenAIConfig represents OpenAI API configuration
 type OpenAIConfig struct {
-	BaseURL         string   `json:"baseUrl"`
-	BaseURLs        []string `json:"baseUrls"`
-	RequestTimeout  int      `json:"requestTimeout"`
-	ResponseTimeout int      `json:"responseTimeout"`
-	IdleConnTimeout int      `json:"idleConnTimeout"`
+	BaseURL                string      `json:"baseUrl"`
+	BaseURLs               []string    `json:"baseUrls"`
+	BaseURLWeights         []int       `json:"baseUrlWeights"` // Weighted round-robin weights (":N" URL suffix), 1 by default
+	LoadBalanceStrategy    string      `json:"loadBalanceStrategy"`
+	ConsistentHashReplicas int         `json:"consistentHashReplicas"`
+	RequestTimeout         int         `json:"requestTimeout"`
+	ResponseTimeout        int         `json:"responseTimeout"`
+	IdleConnTimeout        int         `json:"idleConnTimeout"`
+	StatusRemap            map[int]int `json:"statusRemap"`
+	TimeoutWarningPercent  float64     `json:"timeoutWarningPercent"`
+	// TCP+TLS handshake and first response byte limits in ms, 0 keeps the defaults
+	UpstreamConnectTimeoutMs        int `json:"upstreamConnectTimeoutMs"`
+	UpstreamResponseHeaderTimeoutMs int `json:"upstreamResponseHeaderTimeoutMs"`
+	// Upstreams whose average latency is above this many ms lose most of their picks, 0 disables it
+	UpstreamSLAThresholdMs int `json:"upstreamSlaThresholdMs"`
+	// Upstream host lookup cache in seconds, 0 disables it
+	DNSCacheTTLSeconds         int `json:"dnsCacheTtlSeconds"`
+	DNSNegativeCacheTTLSeconds int `json:"dnsNegativeCacheTtlSeconds"`
+	// Connection pool sizes of each upstream's own transport, 0 keeps the defaults
+	UpstreamMaxIdleConns        int                  `json:"upstreamMaxIdleConns"`
+	UpstreamMaxIdleConnsPerHost int                  `json:"upstreamMaxIdleConnsPerHost"`
+	UpstreamMaxConnsPerHost     int                  `json:"upstreamMaxConnsPerHost"`
+	UpstreamPools               map[int]UpstreamPool `json:"upstreamPools"` // Index in BaseURLs -> pool size override
+	// Active upstream health checks, interval in seconds, 0 disables
+	HealthCheckInterval         int    `json:"healthCheckInterval"`
+	HealthCheckPath             string `json:"healthCheckPath"`
+	HealthCheckFailThreshold    int    `json:"healthCheckFailThreshold"`
+	HealthCheckRecoverThreshold int    `json:"healthCheckRecoverThreshold"`
+	// Per-upstream circuit breaker driven by live traffic, 0 fail threshold disables
+	CircuitFailThreshold    int `json:"circuitFailThreshold"`
+	CircuitSuccessThreshold int `json:"circuitSuccessThreshold"`
+	CircuitOpenTimeout      int `json:"circuitOpenTimeout"` // Seconds an open circuit waits before probing
+	// Response body size limits in MB, global and per upstream (max_response_mb URL param), 0 means unlimited
+	MaxResponseBodySizeMB int            `json:"maxResponseBodySizeMb"`
+	UpstreamMaxResponseMB map[string]int `json:"upstreamMaxResponseMb"`
+	// Upstream connection establishment limit, 0 means unlimited
+	MaxConnectAttemptsPerSecond int  `json:"maxConnectAttemptsPerSecond"`
+	ForwardResponseTrailers     bool `json:"forwardResponseTrailers"`
+	// Transparent reverse proxy without OpenAI-specific handling
+	GenericProxyMode bool `json:"genericProxyMode"`
+	// Extra JSON fields merged into request bodies, keys may use dot notation
+	InjectBodyFields   map[string]any `json:"injectBodyFields"`
+	InjectBodyOverride bool           `json:"injectBodyOverride"`
+	// Query params appended to every upstream request URL (e.g. "api_version=2&region=us")
+	UpstreamQueryParams string `json:"-"`
+	// Move system messages ahead of the rest of the conversation
+	NormalizeMessageOrder bool `json:"normalizeMessageOrder"`
+	// Upstream tried once when all primary upstreams look down
+	FallbackUpstreamURL  string   `json:"fallbackUpstreamUrl"`
+	FallbackUpstreamKeys []string `json:"-"`
+	FallbackTriggerCodes []int    `json:"fallbackTriggerCodes"`
+	// Upstream receiving copies of sampled requests, its responses are discarded
+	MirrorURL        string  `json:"mirrorUrl"`
+	MirrorSampleRate float64 `json:"mirrorSampleRate"` // 0.0-1.0
+	MirrorTimeoutMs  int     `json:"mirrorTimeoutMs"`
+	// Second upstream group receiving UpstreamBWeight percent of requests, for gradual migrations
+	UpstreamBURLs   []string `json:"upstreamBUrls"`
+	UpstreamBWeight int      `json:"upstreamBWeight"`
+	UpstreamGroup   string   `json:"-"` // Group BaseURL was picked from, empty without group B
+	// Failover tiers of group A, later tiers only serve while the earlier ones are all down
+	UpstreamTiers []UpstreamTier `json:"upstreamTiers"`
+	// Header carrying the upstream API key and its format, {key} is replaced by the key
+	KeyHeader string `json:"keyHeader"`
+	KeyFormat string `json:"-"`
+	// Upstream API flavour, Azure OpenAI maps models to deployments in the URL,
+	// chat completions are translated to and from the Anthropic Messages API
+	UpstreamType        string            `json:"upstreamType"`
+	AzureAPIVersion     string            `json:"azureApiVersion"`
+	AzureDeployments    map[string]string `json:"azureDeployments"` // Model name -> deployment name, unmapped models are used as is
+	AnthropicAPIVersion string            `json:"anthropicApiVersion"`
+	// Paths sent to all upstreams at once, the first 2xx response wins
+	BroadcastEnabled bool     `json:"broadcastEnabled"`
+	BroadcastPaths   []string `json:"broadcastPaths"`
+	// Request ID correlation with the upstream's own logs
+	ForwardRequestIDToUpstream bool   `json:"forwardRequestIdToUpstream"`
+	UpstreamRequestIDHeader    string `json:"upstreamRequestIdHeader"`
+	CaptureUpstreamIDHeader    string `json:"captureUpstreamRequestIdHeader"`
+	// User-Agent sent upstream, the override replaces the client's, the default fills in when it has none
+	UpstreamUserAgent        string `json:"upstreamUserAgent"`
+	UpstreamDefaultUserAgent string `json:"upstreamDefaultUserAgent"`
+	// Model name -> tag key -> tag value, for cost attribution
+	ModelTags map[string]map[string]string `json:"modelTags"`
+	// Reorder upstreams by p95 latency every interval, 0 disables
+	LatencySortInterval int `json:"latencySortInterval"`
+	LatencyWindow       int `json:"latencyWindow"`
+	// Emit a gptload_metadata SSE event after [DONE]
+	StreamingMetadataEventEnabled bool `json:"streamingMetadataEventEnabled"`
+	// Hash upstream URLs before exposing them to callers
+	UpstreamHeaderHash bool `json:"upstreamHeaderHash"`
+	// AWS SigV4 signing for Bedrock-compatible upstreams
+	AWSSigV4Enabled    bool   `json:"awsSigV4Enabled"`
+	AWSAccessKeyID     string `json:"-"`
+	AWSSecretAccessKey string `json:"-"`
+	AWSSessionToken    string `json:"-"`
+	AWSSigV4Service    string `json:"awsSigV4Service"`
+	AWSRegion          string `json:"awsRegion"`
+	// Client certificates and CA pool for upstreams requiring mTLS
+	UpstreamTLSCertFile   string                  `json:"upstreamTlsCertFile"`
+	UpstreamTLSKeyFile    string                  `json:"upstreamTlsKeyFile"`
+	UpstreamTLSCAFile     string                  `json:"upstreamTlsCaFile"`
+	UpstreamTLSSkipVerify bool                    `json:"upstreamTlsSkipVerify"`
+	UpstreamTLSCerts      map[int]UpstreamTLSCert `json:"upstreamTlsCerts"` // Index in BaseURLs -> client certificate override
+	// HTTP/2 for HTTPS upstreams, strict streams queue requests at the upstream's
+	// MAX_CONCURRENT_STREAMS instead of opening another connection
+	UpstreamHTTP2Enabled       bool `json:"upstreamHttp2Enabled"`
+	UpstreamHTTP2StrictStreams bool `json:"upstreamHttp2StrictStreams"`
+}
+
+// UpstreamTier represents one failover tier, balanced like the upstreams without tiers
+type UpstreamTier struct {
+	Name     string   `json:"name"`
+	BaseURLs []string `json:"baseUrls"`
+}
+
+// UpstreamPool represents the connection pool sizes of one upstream, 0 keeps the shared value
+type UpstreamPool struct {
+	MaxIdleConns        int `json:"maxIdleConns"`
+	MaxIdleConnsPerHost int `json:"maxIdleConnsPerHost"`
+	MaxConnsPerHost     int `json:"maxConnsPerHost"`
+}
+
+// UpstreamTLSCert represents the client certificate presented to one upstream
+type UpstreamTLSCert struct {
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+}
+
+// QuotaTracker defines the interface for caller quota enforcement
+type QuotaTracker interface {
+	Check(caller string) (QuotaStatus, bool)
+	Record(caller string, tokens int64)
+}
+
+// ClientRateLimiter defines the interface for per-client rate limiting
+type ClientRateLimiter interface {
+	Allow(client string) (retryAfter time.Duration, allowed bool)
+}
+
+// TokenVerifier defines the interface for bearer token (JWT) verification
+type TokenVerifier interface {
+	VerifyToken(token string) (subject string, err error)
+}
+
+// RequestCounter defines the interface for counting requests served since startup
+type RequestCounter interface {
+	Counts() RequestCounts
+	Uptime() time.Duration
+}
+
+// RequestQueue defines the interface for reading the concurrency queue
+type RequestQueue interface {
+	QueueDepth() int
 }
 
 // AuthConfig represents authentication configuration
 type AuthConfig struct {
-	Key     string `json:"key"`
+	Keys                []string `json:"keys"`
+	KeyLabels           []string `json:"keyLabels"` // Label of each key for attribution, empty when unlabelled
+	Enabled             bool     `json:"enabled"`
+	JWKSURL             string   `json:"jwksUrl"`
+	JWKSRefreshInterval int      `json:"jwksRefreshInterval"`
+	JWTAudience         string   `json:"jwtAudience"` // Required aud claim, unchecked when empty
+	// Client IPs or CIDR ranges, an allowlisted IP is never blocked
+	IPAllowlist    []string `json:"ipAllowlist"`
+	IPBlocklist    []string `json:"ipBlocklist"`
+	ClientIPHeader string   `json:"clientIpHeader"` // X-Real-IP, X-Forwarded-For, RemoteAddr when empty
+	// Paths served without authentication, exact or a prefix ending in *
+	ExemptPaths []string `json:"exemptPaths"`
+}
+
+// AdminKeyLabel labels the AUTH_KEYS entries whose callers count as admins
+const AdminKeyLabel = "admin"
+
+// AdminConfig represents the separate admin server configuration
+type AdminConfig struct {
+	Enabled bool   `json:"enabled"`
+	Port    int    `json:"port"`
+	AuthKey string `json:"-"`
+}
+
+// MetricsConfig represents the Prometheus metrics server configuration
+type MetricsConfig struct {
+	Enabled bool `json:"enabled"`
+	Port    int  `json:"port"`
+}
+
+// QuotaConfig represents caller quota configuration
+type QuotaConfig struct {
 	Enabled bool   `json:"enabled"`
+	Period  string `json:"period"`
+	// Caller (JWT subject or proxy key) -> limits
+	Quotas map[string]QuotaLimit `json:"-"`
+}
+
+// RateLimitConfig represents per-client rate limiting configuration
+type RateLimitConfig struct {
+	Enabled           bool   `json:"enabled"`
+	RequestsPerMinute int    `json:"requestsPerMinute"`
+	BurstSize         int    `json:"burstSize"`
+	LimitByHeader     string `json:"limitByHeader"` // Client identity header, the client IP when empty
+	EntryTTLSeconds   int    `json:"entryTtlSeconds"`
+}
+
+// RoutingConfig represents model-based upstream routing configuration
+type RoutingConfig struct {
+	Rules map[string][]string `json:"rules"` // Model name prefix ("*" for any other model) -> upstream URLs
+}
+
+// QuotaLimit represents a caller's usage limits per period, 0 means unlimited
+type QuotaLimit struct {
+	Requests int64 `json:"requests"`
+	Tokens   int64 `json:"tokens"`
+}
+
+// QuotaStatus represents a caller's remaining quota
+type QuotaStatus struct {
+	Limited   bool
+	Remaining int64
+	ResetAt   time.Time
+}
+
+// QuotaUsage represents a caller's usage in the current period
+type QuotaUsage struct {
+	Requests int64      `json:"requests"`
+	Tokens   int64      `json:"tokens"`
+	Limit    QuotaLimit `json:"limit"`
 }
 
 // CORSConfig represents CORS configuration
@@ -83,7 +423,28 @@ type CORSConfig struct {
 // PerformanceConfig represents performance configuration
 type PerformanceConfig struct {
 	MaxConcurrentRequests int  `json:"maxConcurrentRequests"`
+	MaxQueueSize          int  `json:"maxQueueSize"` // Requests waiting for a slot, 0 rejects at once
+	QueueTimeoutMs        int  `json:"queueTimeoutMs"`
 	EnableGzip            bool `json:"enableGzip"`
+	EnableBrotli          bool `json:"enableBrotli"`
+	// Honor Accept-Encoding q-values when choosing the response encoding
+	CompressionPreferClient bool `json:"compressionPreferClient"`
+	SingleflightEnabled     bool `json:"singleflightEnabled"`
+	MaxSSEEventsPerResponse int  `json:"maxSseEventsPerResponse"` // 0 means unlimited
+	MaxRequestBodyBytes     int  `json:"maxRequestBodyBytes"`     // 0 means unlimited
+	MaxResponseBodyBytes    int  `json:"maxResponseBodyBytes"`    // 0 means unlimited
+	WSEnabled               bool `json:"wsEnabled"`               // Tunnel WebSocket upgrades to the upstream
+	// Response cache for identical non-streaming chat completions
+	CacheEnabled    bool `json:"cacheEnabled"`
+	CacheTTLSeconds int  `json:"cacheTtlSeconds"`
+	CacheMaxSizeMB  int  `json:"cacheMaxSizeMb"`
+	// OpenTelemetry tracing exported over OTLP/HTTP
+	OTELEnabled     bool   `json:"otelEnabled"`
+	OTELEndpoint    string `json:"otelEndpoint"`
+	OTELServiceName string `json:"otelServiceName"`
+	// "none" flushes every upstream chunk to the client, "full" sends the
+	// complete body at once with its Content-Length
+	ResponseBuffering string `json:"responseBuffering"`
 }
 
 // LogConfig represents logging configuration
@@ -93,6 +454,66 @@ type LogConfig struct {
 	EnableFile    bool   `json:"enableFile"`
 	FilePath      string `json:"filePath"`
 	EnableRequest bool   `json:"enableRequest"`
+	// Header carrying the request ID, read from requests and set on responses
+	RequestIDHeader string `json:"requestIdHeader"`
+	// Request header name -> log field name
+	ExtractHeaders       map[string]string `json:"extractHeaders"`
+	AuditLogEnabled      bool              `json:"auditLogEnabled"`
+	CloneRequestForAudit bool              `json:"cloneRequestForAudit"`
+	ServerTimingEnabled  bool              `json:"serverTimingEnabled"`
+	// Path prefixes whose requests are not logged, matched case-insensitively
+	ExcludePaths []string `json:"excludePaths"`
+	// Regexes whose matches are replaced in logged bodies
+	BodyRedactPatterns []string `json:"bodyRedactPatterns"`
+	// Fields included in JSON request log entries
+	RequestFields []string `json:"requestFields"`
+	// Mask API keys wherever they are logged
+	MaskKeys bool `json:"maskKeys"`
+
+	// Log file rotation, sizes in megabytes and ages in days
+	FileMaxSizeMB      int  `json:"fileMaxSizeMb"`
+	FileMaxBackups     int  `json:"fileMaxBackups"`
+	FileMaxAgeDays     int  `json:"fileMaxAgeDays"`
+	FileCompress       bool `json:"fileCompress"`
+	FileRotateOnSIGHUP bool `json:"fileRotateOnSighup"`
+}
+
+// Request log field names
+const (
+	RequestLogFieldTimestamp = "timestamp"
+	RequestLogFieldMethod    = "method"
+	RequestLogFieldPath      = "path"
+	RequestLogFieldStatus    = "status"
+	RequestLogFieldUpstream  = "upstream"
+	RequestLogFieldKeyID     = "key_id"
+	RequestLogFieldLatency   = "latency_ms"
+	RequestLogFieldRequestID = "request_id"
+	RequestLogFieldClientIP  = "client_ip"
+	RequestLogFieldModel     = "model"
+)
+
+// RequestLogFields lists every field a JSON request log entry can carry
+var RequestLogFields = []string{
+	RequestLogFieldTimestamp,
+	RequestLogFieldMethod,
+	RequestLogFieldPath,
+	RequestLogFieldStatus,
+	RequestLogFieldUpstream,
+	RequestLogFieldKeyID,
+	RequestLogFieldLatency,
+	RequestLogFieldRequestID,
+	RequestLogFieldClientIP,
+	RequestLogFieldModel,
+}
+
+// IsRequestLogField reports whether name is a known request log field
+func IsRequestLogField(name string) bool {
+	for _, field := range RequestLogFields {
+		if field == name {
+			return true
+		}
+	}
+	return false
 }
 
 // KeyInfo represents API key information
@@ -100,6 +521,22 @@ type KeyInfo struct {
 	Key     string `json:"key"`
 	Index   int    `json:"index"`
 	Preview string `json:"preview"`
+	Tier    string `json:"tier"`
+	// Release frees the key's concurrency slot once the request is done, safe to call more than once
+	Release func() `json:"-"`
+}
+
+// Key tiers
+const (
+	KeyTierPrimary = "primary"
+	KeyTierStandby = "standby"
+)
+
+// KeyCapacity represents key pool sizes reported in capacity headers
+type KeyCapacity struct {
+	Total       int `json:"total"`
+	Active      int `json:"active"`
+	Blacklisted int `json:"blacklisted"`
 }
 
 // Stats represents system statistics
@@ -113,6 +550,23 @@ type Stats struct {
 	MemoryUsage     MemoryUsage `json:"memoryUsage"`
 }
 
+// HealthTemplateData is the data available to HEALTH_RESPONSE_TEMPLATE
+type HealthTemplateData struct {
+	Version         string
+	UptimeSeconds   int64
+	InstanceID      string
+	ActiveKeys      int
+	BlacklistedKeys int
+}
+
+// LatencyPercentiles represents recent latency percentiles of an upstream
+type LatencyPercentiles struct {
+	Samples int   `json:"samples"`
+	P50Ms   int64 `json:"p50Ms"`
+	P95Ms   int64 `json:"p95Ms"`
+	P99Ms   int64 `json:"p99Ms"`
+}
+
 // MemoryUsage represents memory usage statistics
 type MemoryUsage struct {
 	Alloc        uint64 `json:"alloc"`
@@ -132,10 +586,92 @@ type BlacklistEntry struct {
 	FailCount   int       `json:"failCount"`
 }
 
+// KeyStatus represents a key as seen by the admin API
+type KeyStatus struct {
+	ID            string     `json:"id"`
+	Preview       string     `json:"preview"`
+	Status        string     `json:"status"` // active, cooling_down or blacklisted
+	FailCount     int        `json:"failCount"`
+	BlacklistedAt *time.Time `json:"blacklistedAt,omitempty"`
+}
+
+// KeyUsage represents the use of one key since the last stats reset
+type KeyUsage struct {
+	ID           string     `json:"id"`
+	Preview      string     `json:"preview"`
+	Requests     int64      `json:"requests"` // Requests that finished with a success or an error
+	Successes    int64      `json:"successes"`
+	Errors       int64      `json:"errors"`
+	Blacklists   int64      `json:"blacklists"` // Times the key was blacklisted
+	LastUsed     *time.Time `json:"lastUsed,omitempty"`
+	AvgLatencyMs float64    `json:"avgLatencyMs"` // Time until the upstream's response headers
+}
+
+// CircuitStatus represents the circuit breaker state of one upstream
+type CircuitStatus struct {
+	URL      string     `json:"url"`
+	State    string     `json:"state"` // CLOSED, OPEN or HALF_OPEN
+	Failures int        `json:"failures"`
+	OpenedAt *time.Time `json:"openedAt,omitempty"`
+}
+
+// UpstreamHealth combines the health check and circuit breaker view of one upstream
+type UpstreamHealth struct {
+	URL      string `json:"url"`
+	Healthy  bool   `json:"healthy"`
+	Degraded bool   `json:"degraded"`          // Marked degraded by active health checks
+	Circuit  string `json:"circuit,omitempty"` // Empty when circuit breaking is disabled
+	// Moving average of the upstream's response latency, omitted until measured
+	LatencyEMAMs float64 `json:"latencyEmaMs,omitempty"`
+}
+
+// RequestCounts represents requests handled by the proxy server
+type RequestCounts struct {
+	Total    int64 `json:"total"`
+	InFlight int64 `json:"inFlight"`
+}
+
+// StatusResponse is the runtime health summary served by GET /admin/status
+type StatusResponse struct {
+	Version       string           `json:"version"`
+	UptimeSeconds int64            `json:"uptimeSeconds"`
+	Requests      RequestCounts    `json:"requests"`
+	QueueDepth    int              `json:"queueDepth"`
+	Keys          KeyCapacity      `json:"keys"`
+	Upstreams     []UpstreamHealth `json:"upstreams"`
+	Config        StatusConfig     `json:"config"`
+	Memory        StatusMemory     `json:"memory"`
+	Goroutines    int              `json:"goroutines"`
+	Timestamp     time.Time        `json:"timestamp"`
+}
+
+// StatusConfig is the non-sensitive configuration summary in StatusResponse
+type StatusConfig struct {
+	UpstreamType          string `json:"upstreamType"`
+	LoadBalance           string `json:"loadBalance"`
+	MaxRetries            int    `json:"maxRetries"`
+	BlacklistThreshold    int    `json:"blacklistThreshold"`
+	KeyMaxConcurrent      int    `json:"keyMaxConcurrent"`
+	MaxConcurrentRequests int    `json:"maxConcurrentRequests"`
+	AuthEnabled           bool   `json:"authEnabled"`
+	CircuitBreaker        bool   `json:"circuitBreaker"`
+	HealthChecks          bool   `json:"healthChecks"`
+}
+
+// StatusMemory is the memory usage in StatusResponse
+type StatusMemory struct {
+	AllocMB uint64 `json:"allocMb"`
+	SysMB   uint64 `json:"sysMb"`
+	NumGC   uint32 `json:"numGc"`
+}
+
 // RetryError represents retry error information
 type RetryError struct {
 	StatusCode   int    `json:"statusCode"`
 	ErrorMessage string `json:"errorMessage"`
 	KeyIndex     int    `json:"keyIndex"`
 	Attempt      int    `json:"attempt"`
+	Timeout      bool   `json:"timeout,omitempty"`
+	// Retry-After sent with an upstream 429, in seconds
+	RetryAfterSeconds int `json:"retryAfterSeconds,omitempty"`
 }